@@ -5,9 +5,12 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -18,11 +21,17 @@ import (
 	"github.com/substantialcattle5/sietch/internal/chunk"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/encryption/pathencryption"
 	"github.com/substantialcattle5/sietch/internal/fs"
-
-	// manifest raw storage removed in favor of transactional helper
+	"github.com/substantialcattle5/sietch/internal/ingest"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+	"github.com/substantialcattle5/sietch/internal/pack"
 	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/rechunk"
+	"github.com/substantialcattle5/sietch/internal/stats"
 	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
 	"github.com/substantialcattle5/sietch/util"
 	"gopkg.in/yaml.v3"
 )
@@ -51,31 +60,64 @@ Supports two usage patterns:
 2. Single destination: sietch add source1 source2 ... dest
 	  All source files are stored under the same destination directory.
 
+With --stdin, the data piped into sietch is stored as one file called --name,
+under the destination directory given as the only argument (the vault root if
+omitted). The input is streamed through the chunker, never held in memory.
+
 Examples:
 	 sietch add document.txt vault/documents/
 	 sietch add file1.txt dest1/ file2.txt dest2/
-	 sietch add ~/photos/img1.jpg ~/photos/img2.jpg vault/photos/`,
-	Args: cobra.MinimumNArgs(2),
+	 sietch add ~/photos/img1.jpg ~/photos/img2.jpg vault/photos/
+	 sietch add -r ~/photos vault/photos/ --if-changed
+	 sietch add -r ~/photos vault/photos/ --since 7d
+	 pg_dump mydb | sietch add --stdin --name backup.sql backups/`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if fromStdin, _ := cmd.Flags().GetBool("stdin"); fromStdin {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate argument count (reasonable limit for batch operations)
 		if len(args) > 100 {
 			return fmt.Errorf("too many arguments: maximum 100 files per command (received %d)", len(args))
 		}
 
-		// Parse file pairs from arguments
-		filePairs, err := parseFileArguments(args)
-		if err != nil {
-			return err
-		}
-
 		// Get recursive and includeHidden flags
 		recursive, _ := cmd.Flags().GetBool("recursive")
 		includeHidden, _ := cmd.Flags().GetBool("include-hidden")
+		symlinks, _ := cmd.Flags().GetString("symlinks")
+		if symlinks != "follow" && symlinks != "store" {
+			return fmt.Errorf("invalid --symlinks %q: use follow or store", symlinks)
+		}
 
-		// Expand directories if needed
-		filePairs, err = expandDirectories(filePairs, recursive, includeHidden)
-		if err != nil {
-			return err
+		fromStdin, _ := cmd.Flags().GetBool("stdin")
+		stdinName, _ := cmd.Flags().GetString("name")
+		var filePairs []FilePair
+		if fromStdin {
+			if err := checkStdinFlags(cmd); err != nil {
+				return err
+			}
+			pair, err := stdinFilePair(stdinName, args)
+			if err != nil {
+				return err
+			}
+			filePairs = []FilePair{pair}
+		} else {
+			if stdinName != "" {
+				return fmt.Errorf("--name is only used with --stdin")
+			}
+			// Parse file pairs from arguments
+			pairs, err := parseFileArguments(args)
+			if err != nil {
+				return err
+			}
+
+			// Expand directories if needed
+			filePairs, err = expandDirectories(pairs, recursive, includeHidden)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Get tags from flags
@@ -93,6 +135,32 @@ Examples:
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		quiet, _ := cmd.Flags().GetBool("quiet")
 
+		ifChanged, _ := cmd.Flags().GetBool("if-changed")
+		forceRehash, _ := cmd.Flags().GetBool("force-rehash")
+		verifySample, _ := cmd.Flags().GetFloat64("verify-sample")
+		wholeFile, _ := cmd.Flags().GetBool("whole-file")
+		verifyAfterWrite, _ := cmd.Flags().GetBool("verify-after-write")
+		dedupHintsPath, _ := cmd.Flags().GetString("dedup-hints")
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		if jobs < 1 {
+			return fmt.Errorf("--jobs must be at least 1")
+		}
+		if dedupHintsPath != "" && verifyAfterWrite {
+			return fmt.Errorf("--verify-after-write cannot read back chunks recorded as remote by --dedup-hints")
+		}
+		if (forceRehash || verifySample > 0) && !ifChanged {
+			return fmt.Errorf("--force-rehash and --verify-sample require --if-changed")
+		}
+		if verifySample < 0 || verifySample > 100 {
+			return fmt.Errorf("--verify-sample must be a percentage between 0 and 100")
+		}
+		var sinceCutoff time.Time
+		if sinceFlag, _ := cmd.Flags().GetString("since"); sinceFlag != "" {
+			if sinceCutoff, err = util.ParseSince(sinceFlag, time.Now()); err != nil {
+				return fmt.Errorf("invalid --since: %v", err)
+			}
+		}
+
 		vaultRoot, err := fs.FindVaultRoot()
 		if err != nil {
 			return fmt.Errorf("not inside a vault: %v", err)
@@ -109,13 +177,55 @@ Examples:
 			return fmt.Errorf("failed to load vault configuration: %v", err)
 		}
 
-		// Parse chunk size
-		chunkSize, err := util.ParseChunkSize(vaultConfig.Chunking.ChunkSize)
-		if err != nil {
-			// Fallback to default if parsing fails
+		// Check chunk size; ResolvePolicy falls back to the default if it is invalid
+		if _, err := util.ParseChunkSize(vaultConfig.Chunking.ChunkSize); err != nil {
 			fmt.Printf("Warning: Invalid chunk size in configuration (%s). Using default (4MB).\n",
 				vaultConfig.Chunking.ChunkSize)
-			chunkSize = int64(constants.DefaultChunkSize) // Default to 4MB
+		}
+
+		// Per-pattern chunk policies must be valid before any file is processed
+		if err := chunk.ValidatePolicies(vaultConfig.Chunking.Policies); err != nil {
+			return fmt.Errorf("invalid chunking policy in vault configuration: %v", err)
+		}
+		if err := chunk.ValidateCompressionPolicies(vaultConfig.CompressionPolicies); err != nil {
+			return fmt.Errorf("invalid compression policy in vault configuration: %v", err)
+		}
+		if err := deduplication.ValidateScopes(vaultConfig.Deduplication.Scopes); err != nil {
+			return fmt.Errorf("invalid dedup scope in vault configuration: %v", err)
+		}
+		// Files added now would be stored under settings the rechunk is replacing
+		if rechunk.InProgress(vaultRoot) {
+			return fmt.Errorf("a rechunk is in progress; run 'sietch vault rechunk' to finish it before adding files")
+		}
+		// A hand-edited hash algorithm would orphan every chunk already stored
+		if err := config.CheckHashAlgorithm(vaultRoot, vaultConfig); err != nil {
+			return err
+		}
+		hashAlgorithm := vaultConfig.Chunking.HashAlgorithm
+		if hashAlgorithm == "" {
+			hashAlgorithm = constants.HashAlgorithmSHA256
+		}
+
+		// A chunk size far too small for a file would bloat its manifest
+		maxChunks := chunk.MaxChunksPerFile(*vaultConfig)
+		if cmd.Flags().Changed("num-chunks-per-file") {
+			if maxChunks, _ = cmd.Flags().GetInt("num-chunks-per-file"); maxChunks < 0 {
+				return fmt.Errorf("--num-chunks-per-file cannot be negative")
+			}
+		}
+
+		// Chunks another vault already holds are recorded as remote instead of stored
+		var hints *deduplication.Hints
+		if dedupHintsPath != "" {
+			if hints, err = deduplication.ReadHints(dedupHintsPath); err != nil {
+				return err
+			}
+			if err := hints.CheckCompatible(vaultConfig); err != nil {
+				return fmt.Errorf("cannot use dedup hints: %v", err)
+			}
+			if verbose {
+				fmt.Printf("Loaded dedup hints for %d chunks (%s)\n", hints.Len(), util.HumanReadableSize(hints.TotalSize()))
+			}
 		}
 
 		// Get passphrase if needed for encryption
@@ -123,6 +233,19 @@ Examples:
 		if err != nil {
 			return err
 		}
+		retryPolicy, err := storeRetryPolicy(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		// Vaults that encrypt paths seal each manifest's path before it is written
+		paths, err := pathencryption.Unlock(vaultRoot, vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+		if err := deduplication.UnlockIndex(vaultRoot, vaultConfig, passphrase); err != nil {
+			return err
+		}
 
 		// Create progress manager
 		progressMgr := progress.NewManager(progress.Options{
@@ -137,7 +260,12 @@ Examples:
 		// Process each file pair
 		successCount := 0
 		var failedFiles []string
+		var changes changeCounts
+		var sinceSkipped int
 		var totalSpaceSavings SpaceSavings
+		remoteChunks := 0
+		compressedChunks, rawChunks := 0, 0
+		var ingests []*ingest.Ingest
 
 		// Show initial progress for multiple files
 		if len(filePairs) > 1 {
@@ -158,18 +286,63 @@ Examples:
 			}
 		}()
 
+		// One index for the whole add; it is only saved once the transaction commits
+		dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+		}
+		dedupManager.SetProgressManager(progressMgr)
+
+		// The file strategy reuses the chunks of identical files instead of chunks
+		var fileIndex *deduplication.FileIndex
+		if deduplication.FileLevel(vaultConfig.Deduplication) {
+			var revealer config.PathRevealer
+			if paths != nil {
+				revealer = paths
+			}
+			if fileIndex, err = deduplication.LoadFileIndex(vaultRoot, vaultConfig.Deduplication.Scopes, revealer); err != nil {
+				return err
+			}
+		}
+
+		// Files below the packing threshold are appended to shared packs instead of being chunked
+		var packWriter *pack.Writer
+		if vaultConfig.Packing.Enabled {
+			packWriter, err = pack.NewWriter(vaultRoot, *vaultConfig, passphrase, txn)
+			if err != nil {
+				return err
+			}
+		}
+
+		// With --verify-after-write every file is read back and decrypted before commit
+		var verifyOpts chunker.Options
+		if verifyAfterWrite {
+			if verifyOpts, err = chunker.OptionsFromConfig(vaultRoot, *vaultConfig, passphrase); err != nil {
+				return err
+			}
+			if packWriter != nil {
+				packWriter.SetVerifyAfterWrite(true)
+			}
+		}
+
 		for i, pair := range filePairs {
 			// Enhanced progress display for multiple files
 			if len(filePairs) > 1 {
 				fmt.Printf("[%d/%d] Processing: %s → %s\n",
 					i+1, len(filePairs), filepath.Base(pair.Source), pair.Destination)
+			} else if fromStdin {
+				fmt.Printf("Processing: stdin → %s%s\n", pair.Destination, pair.Source)
 			} else {
 				fmt.Printf("Processing: %s\n", pair.Source)
 			}
 
-			// Determine path type and handle accordingly
-			fileInfo, pathType, err := fs.GetPathInfo(pair.Source)
-			if err != nil {
+			// Data read from stdin has no file info; its size is known once it is stored
+			var fileInfo os.FileInfo
+			var pathType fs.PathType
+			var actualSourcePath string
+			if fromStdin {
+				pathType = fs.PathTypeFile
+			} else if fileInfo, pathType, err = fs.GetPathInfo(pair.Source); err != nil {
 				errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
 				fmt.Println(errorMsg)
 				failedFiles = append(failedFiles, errorMsg)
@@ -177,13 +350,24 @@ Examples:
 			}
 
 			// Handle different path types
-			var actualSourcePath string
+			var entry *config.FileManifest
 			switch pathType {
 			case fs.PathTypeFile:
 				// Regular file - use as is
 				actualSourcePath = pair.Source
 
 			case fs.PathTypeSymlink:
+				// With --symlinks store the link itself is recorded, by its target
+				if symlinks == "store" {
+					if entry, err = treeEntryManifest(pair, fileInfo, tags); err != nil {
+						errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+						fmt.Println(errorMsg)
+						failedFiles = append(failedFiles, errorMsg)
+						continue
+					}
+					break
+				}
+
 				// Resolve symlink and verify target is a regular file
 				targetPath, targetInfo, targetType, err := fs.ResolveSymlink(pair.Source)
 				if err != nil {
@@ -209,6 +393,10 @@ Examples:
 				}
 
 			case fs.PathTypeDir:
+				if pair.EmptyDir {
+					entry, _ = treeEntryManifest(pair, fileInfo, tags)
+					break
+				}
 				// Directories should have been expanded already
 				errorMsg := fmt.Sprintf("✗ %s: unexpected directory in processing loop", filepath.Base(pair.Source))
 				fmt.Println(errorMsg)
@@ -222,13 +410,117 @@ Examples:
 				continue
 			}
 
-			// Get file size in human-readable format
-			sizeInBytes := fileInfo.Size()
+			// Symlinks and empty directories have no content to chunk
+			if entry != nil {
+				manifestName := manifestFileName(paths, pair.Destination, entry.FilePath)
+				replaced, err := manifest.LoadFileManifest(vaultRoot, manifestName)
+				if err == nil && paths != nil {
+					err = paths.Reveal(replaced)
+				}
+				if err != nil {
+					replaced = nil
+				}
+				if ifChanged && replaced != nil && replaced.Type == entry.Type && replaced.LinkTarget == entry.LinkTarget {
+					if verbose {
+						fmt.Printf("= %s (unchanged)\n", filepath.Base(pair.Source))
+					}
+					continue
+				}
+				if paths != nil {
+					if err := paths.Seal(entry); err != nil {
+						errorMsg := fmt.Sprintf("✗ %s: path encryption failed - %v", filepath.Base(pair.Source), err)
+						fmt.Println(errorMsg)
+						failedFiles = append(failedFiles, errorMsg)
+						continue
+					}
+				}
+				if err := storeManifestTransactional(txn, vaultRoot, manifestName, pair.Destination+filepath.Base(pair.Source), entry, ifChanged && replaced != nil, vaultConfig.CompressesManifests()); err != nil {
+					if err.Error() == "skipped" {
+						fmt.Printf("✗ '%s': skipped\n", pair.Destination+filepath.Base(pair.Source))
+						continue
+					}
+					errorMsg := fmt.Sprintf("✗ %s: manifest storage failed - %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+				if entry.IsSymlink() {
+					fmt.Printf("✓ %s (symlink)\n", filepath.Base(pair.Source))
+				} else {
+					fmt.Printf("✓ %s (empty directory)\n", filepath.Base(pair.Source))
+				}
+				if replaced != nil {
+					dedupManager.ReleaseChunks(replaced.Chunks)
+				}
+				successCount++
+				operationCounts.Files++
+				continue
+			}
+
+			// Files last modified before --since were stored by an earlier add
+			if !sinceCutoff.IsZero() && fileInfo.ModTime().Before(sinceCutoff) {
+				sinceSkipped++
+				if verbose {
+					fmt.Printf("= %s (older than --since)\n", filepath.Base(pair.Source))
+				}
+				continue
+			}
+
+			manifestName := manifestFileName(paths, pair.Destination, filepath.Base(pair.Source))
+
+			// Skip files already in the vault whose size, mtime and inode are unchanged
+			var replaced *config.FileManifest
+			overwrite := false // Replace an existing manifest without asking
+			if ifChanged {
+				existing, err := manifest.LoadFileManifest(vaultRoot, manifestName)
+				if err == nil && paths != nil {
+					err = paths.Reveal(existing)
+				}
+				if err == nil {
+					verify := forceRehash || rand.Float64()*100 < verifySample
+					unchanged, err := changes.check(existing, actualSourcePath, fileInfo, *vaultConfig, verify)
+					if err != nil {
+						errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+						fmt.Println(errorMsg)
+						failedFiles = append(failedFiles, errorMsg)
+						continue
+					}
+					if unchanged {
+						if verbose {
+							fmt.Printf("= %s (unchanged)\n", filepath.Base(pair.Source))
+						}
+						continue
+					}
+					replaced, overwrite = existing, true
+				}
+			}
+
+			// Stdin cannot also answer the overwrite prompt, so replacing needs --force
+			if fromStdin {
+				if existing, err := manifest.LoadFileManifest(vaultRoot, manifestName); err == nil {
+					if force, _ := cmd.Flags().GetBool("force"); !force {
+						return fmt.Errorf("'%s%s' is already in the vault; use --force to replace it", pair.Destination, pair.Source)
+					}
+					replaced, overwrite = existing, true
+				}
+			}
+			// A version replaced through the overwrite prompt releases its chunks too
+			if replaced == nil {
+				if existing, err := manifest.LoadFileManifest(vaultRoot, manifestName); err == nil {
+					replaced = existing
+				}
+			}
+
+			// Get file size in human-readable format; stdin's is known once it is stored
+			sizeInBytes := int64(-1)
+			if fileInfo != nil {
+				sizeInBytes = fileInfo.Size()
+			}
 			sizeReadable := util.HumanReadableSize(sizeInBytes)
 
 			// Display file metadata for confirmation (only for single files or when verbose)
 			verbose, _ := cmd.Flags().GetBool("verbose")
-			if len(filePairs) == 1 || verbose {
+			if fileInfo != nil && (len(filePairs) == 1 || verbose) {
 				fmt.Printf("  Size: %s (%d bytes)\n", sizeReadable, sizeInBytes)
 				fmt.Printf("  Modified: %s\n", fileInfo.ModTime().Format(time.RFC3339))
 				if len(tags) > 0 {
@@ -238,33 +530,184 @@ Examples:
 
 			// Process the file and store chunks - using the appropriate chunking function
 			var chunkRefs []config.ChunkRef
-			// Use transactional chunking to stage new chunks
-			chunkRefs, err = chunk.ChunkFileTransactional(ctx, actualSourcePath, chunkSize, vaultRoot, passphrase, progressMgr, txn)
+			var packRef *config.PackRef
+			var chunking *config.FileChunking
+			var ing *ingest.Ingest
+			var contentHash string
+			var identical *config.FileManifest
+			if fileIndex != nil && !fromStdin {
+				if contentHash, err = deduplication.HashFile(actualSourcePath, hashAlgorithm); err != nil {
+					errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+				identical = fileIndex.Lookup(pair.Destination+filepath.Base(pair.Source), contentHash)
+			}
+			if identical != nil {
+				// Already stored: the manifest points at the identical file's chunks
+				chunkRefs = deduplication.ReuseChunks(identical.Chunks)
+				chunking = identical.Chunking
+				if verbose {
+					fmt.Printf("  Identical to a stored file, reusing its %d chunks\n", len(chunkRefs))
+				}
+			} else if packWriter != nil && !fromStdin && pack.ShouldPack(*vaultConfig, sizeInBytes) {
+				packRef, err = addToPack(packWriter, actualSourcePath)
+				if errors.Is(err, pack.ErrVerifyFailed) {
+					// A pack that was already written does not read back; nothing in it can be trusted
+					return err
+				}
+				if err != nil {
+					errorMsg := fmt.Sprintf("✗ %s: packing failed - %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+			} else {
+				// Small files may skip the splitter; otherwise pick the chunking policy
+				// for this file (first matching pattern wins)
+				policy := chunk.WholePolicy(sizeInBytes)
+				if fromStdin || !chunk.StoresWhole(*vaultConfig, sizeInBytes, wholeFile) {
+					policy, err = chunk.ResolvePolicyForVault(*vaultConfig, pair.Destination+filepath.Base(pair.Source))
+				}
+				if err != nil {
+					errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+				if verbose && policy.Pattern != "" {
+					fmt.Printf("  Chunk policy: %s → %s (%s)\n", policy.Pattern, policy.Strategy, util.HumanReadableSize(policy.ChunkSize))
+				}
+				if err := chunk.CheckChunkCount(chunk.EstimateChunks(sizeInBytes, policy), sizeInBytes, policy.ChunkSize, maxChunks); err != nil {
+					errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+				chunking = policy.ManifestInfo()
+				chunking.HashAlgorithm = hashAlgorithm
+				fileCompression := chunk.ResolveCompression(*vaultConfig, pair.Destination+filepath.Base(pair.Source), sizeInBytes)
+				if verbose && fileCompression.Pattern != "" {
+					fmt.Printf("  Compression policy: %s → %s\n", fileCompression.Pattern, fileCompression)
+				} else if verbose && fileCompression.Dictionary != "" {
+					fmt.Printf("  Compression: %s\n", fileCompression)
+				}
 
-			if err != nil {
-				errorMsg := fmt.Sprintf("✗ %s: chunking failed - %v", filepath.Base(pair.Source), err)
-				fmt.Println(errorMsg)
-				failedFiles = append(failedFiles, errorMsg)
-				continue
+				// Use transactional chunking to stage new chunks, reusing only chunks
+				// of the file's dedup scope
+				scope := deduplication.ResolveScope(vaultConfig.Deduplication.Scopes, pair.Destination+filepath.Base(pair.Source))
+				if verbose && scope != "" {
+					fmt.Printf("  Dedup scope: %s\n", scope)
+				}
+				var store chunker.ChunkStore = chunker.NewRetryStore(dedupManager.TransactionalStore(txn).WithScope(scope).WithHints(hints), retryPolicy)
+
+				// Large files commit their chunks in checkpoints of their own, so an
+				// interrupted add of the file resumes after the last one
+				if !fromStdin && policy.Strategy != chunk.StrategyWhole && ingest.Resumable(sizeInBytes) {
+					source := ingestSource(actualSourcePath, fileInfo, policy, fileCompression, hashAlgorithm, scope, *vaultConfig)
+					ing, err = ingest.Start(vaultRoot, manifestName, source, func(t *atomic.Transaction) chunker.ChunkStore {
+						return dedupManager.TransactionalStore(t).WithScope(scope).WithHints(hints)
+					})
+					if err != nil {
+						errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+						fmt.Println(errorMsg)
+						failedFiles = append(failedFiles, errorMsg)
+						continue
+					}
+					if ing.Resumed() > 0 {
+						fmt.Printf("  Resuming an interrupted add: %d chunks (%s) already stored\n",
+							ing.Resumed(), util.HumanReadableSize(ing.Offset()))
+					}
+					store = chunker.NewRetryStore(ing, retryPolicy)
+				}
+				if fromStdin {
+					chunkRefs, err = chunkReaderTransactional(ctx, os.Stdin, -1, policy, fileCompression, vaultRoot, *vaultConfig, passphrase, jobs, progressMgr, store, nil)
+				} else {
+					chunkRefs, err = chunkFileTransactional(ctx, actualSourcePath, policy, fileCompression, vaultRoot, *vaultConfig, passphrase, jobs, progressMgr, store, ing)
+				}
+
+				if err != nil {
+					if ing != nil {
+						ing.Abort()
+					}
+					errorMsg := fmt.Sprintf("✗ %s: chunking failed - %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+				if ing != nil {
+					dedupManager.ResumeChunks(chunkRefs[:ing.Resumed()])
+				}
+
+				// The size of stdin, and the chunks cdc cuts, are only known now
+				stored := calculateSpaceSavings(chunkRefs).OriginalSize
+				if err := chunk.CheckChunkCount(int64(len(chunkRefs)), stored, policy.ChunkSize, maxChunks); err != nil {
+					if ing != nil {
+						ing.Abort()
+					}
+					dedupManager.ReleaseChunks(chunkRefs)
+					errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+
+				// Read the file back from what was just written; a mismatch fails the whole add
+				if verifyAfterWrite {
+					if err := verifyWrittenFile(actualSourcePath, chunkRefs, store, verifyOpts); err != nil {
+						return fmt.Errorf("%s: read-back verification failed: %v", filepath.Base(pair.Source), err)
+					}
+					if verbose {
+						fmt.Printf("  Verified %d chunks read back\n", len(chunkRefs))
+					}
+				}
 			}
 
 			// Create and store the file manifest
+			modTime, inode := time.Now(), uint64(0)
+			if fileInfo != nil {
+				modTime, inode = fileInfo.ModTime(), fs.Inode(fileInfo)
+			} else {
+				sizeInBytes = calculateSpaceSavings(chunkRefs).OriginalSize
+			}
 			fileManifest := &config.FileManifest{
 				FilePath:    filepath.Base(pair.Source),
 				Size:        sizeInBytes,
-				ModTime:     fileInfo.ModTime().Format(time.RFC3339),
+				ModTime:     modTime.Format(time.RFC3339Nano),
+				Inode:       inode,
 				Chunks:      chunkRefs,
+				Pack:        packRef,
+				Chunking:    chunking,
 				Destination: pair.Destination,
+				ContentHash: contentHash,
 				AddedAt:     time.Now().UTC(),
 				Tags:        tags, // Include tags in the manifest
 			}
+			if fileInfo != nil {
+				fileManifest.Mode = fs.FormatMode(fileInfo.Mode())
+				fileManifest.Owner = fileOwner(fileInfo)
+			}
+			vaultPath := pair.Destination + filepath.Base(pair.Source)
 
 			// Save the manifest
 			// Store manifest via transaction (stage create)
-			if err := storeManifestTransactional(txn, vaultRoot, filepath.Base(pair.Source), fileManifest); err != nil {
+			if paths != nil {
+				if err := paths.Seal(fileManifest); err != nil {
+					errorMsg := fmt.Sprintf("✗ %s: path encryption failed - %v", filepath.Base(pair.Source), err)
+					fmt.Println(errorMsg)
+					failedFiles = append(failedFiles, errorMsg)
+					continue
+				}
+			}
+			if err := storeManifestTransactional(txn, vaultRoot, manifestName, pair.Destination+filepath.Base(pair.Source), fileManifest, overwrite, vaultConfig.CompressesManifests()); err != nil {
 				if err.Error() == "skipped" {
-					errorMsg := fmt.Sprintf("✗ '%s': skipped", fileManifest.Destination+filepath.Base(pair.Source))
+					errorMsg := fmt.Sprintf("✗ '%s': skipped", pair.Destination+filepath.Base(pair.Source))
 					fmt.Println(errorMsg)
+					// The file stays as it was, so the chunks just read hold no reference from it
+					if identical == nil {
+						dedupManager.ReleaseChunks(chunkRefs)
+					}
 					continue
 				}
 				errorMsg := fmt.Sprintf("✗ %s: manifest storage failed - %v", filepath.Base(pair.Source), err)
@@ -277,7 +720,15 @@ Examples:
 			spaceSavings := calculateSpaceSavings(chunkRefs)
 
 			// Success message
-			if len(filePairs) > 1 {
+			if packRef != nil {
+				if len(filePairs) > 1 {
+					fmt.Printf("✓ %s (packed)\n", filepath.Base(pair.Source))
+				} else {
+					fmt.Printf("✓ File added to vault: %s\n", filepath.Base(pair.Source))
+					fmt.Printf("✓ Stored in pack %s\n", packRef.ID[:chunk.HashDisplayLength])
+					fmt.Printf("✓ Manifest written to .sietch/manifests/%s.yaml\n", manifestName)
+				}
+			} else if len(filePairs) > 1 {
 				fmt.Printf("✓ %s (%d chunks", filepath.Base(pair.Source), len(chunkRefs))
 				if spaceSavings.SpaceSaved > 0 {
 					fmt.Printf(", %s saved", util.HumanReadableSize(spaceSavings.SpaceSaved))
@@ -291,10 +742,40 @@ Examples:
 						util.HumanReadableSize(spaceSavings.SpaceSaved),
 						spaceSavings.SpaceSavedPct)
 				}
-				fmt.Printf("✓ Manifest written to .sietch/manifests/%s.yaml\n", filepath.Base(pair.Source))
+				fmt.Printf("✓ Manifest written to .sietch/manifests/%s.yaml\n", manifestName)
 			}
 
 			successCount++
+			operationCounts.Files++
+			operationCounts.Chunks += len(chunkRefs)
+			operationCounts.Bytes += sizeInBytes
+			runMetrics.BytesIn += sizeInBytes
+			runMetrics.AddChunks(chunkRefs)
+			if fileIndex != nil {
+				fileIndex.Add(vaultPath, fileManifest)
+			}
+			if ing != nil {
+				ingests = append(ingests, ing)
+			}
+			if replaced != nil {
+				// The previous version's chunks lose the references it held
+				dedupManager.ReleaseChunks(replaced.Chunks)
+			}
+			if overwrite {
+				changes.readded++
+			}
+
+			for _, ref := range chunkRefs {
+				switch {
+				case ref.Remote:
+					remoteChunks++
+				case ref.Zero || ref.Deduplicated:
+				case ref.Compressed:
+					compressedChunks++
+				case ref.Incompressible:
+					rawChunks++
+				}
+			}
 
 			// Add to total space savings
 			fileSavings := calculateSpaceSavings(chunkRefs)
@@ -310,6 +791,27 @@ Examples:
 		fmt.Printf("\n=== Batch Processing Summary ===\n")
 		fmt.Printf("Total files: %d\n", len(filePairs))
 		fmt.Printf("Successful: %d\n", successCount)
+		if !sinceCutoff.IsZero() {
+			fmt.Printf("Skipped (older than --since): %d\n", sinceSkipped)
+		}
+		if ifChanged {
+			fmt.Printf("Skipped (unchanged): %d\n", changes.skipped)
+			fmt.Printf("Re-added (changed): %d\n", changes.readded)
+			if changes.verified > 0 {
+				fmt.Printf("Re-hashed to verify: %d (%d changed despite matching size and mtime)\n",
+					changes.verified, changes.statMismatch)
+			}
+		}
+		if remoteChunks > 0 {
+			fmt.Printf("Remote chunks (from dedup hints): %d; run 'sietch sync' to fetch them\n", remoteChunks)
+		}
+		if compressedChunks+rawChunks > 0 {
+			minSavings := vaultConfig.CompressionMinSavings
+			if minSavings == 0 {
+				minSavings = constants.DefaultCompressionMinSavings
+			}
+			fmt.Printf("New chunks compressed: %d; stored raw (saved under %d%%): %d\n", compressedChunks, minSavings, rawChunks)
+		}
 
 		if len(failedFiles) > 0 {
 			fmt.Printf("Failed: %d\n", len(failedFiles))
@@ -338,12 +840,16 @@ Examples:
 			}
 			fmt.Println()
 
-			fmt.Printf("  • Compression: %s\n", vaultConfig.Compression)
+			fmt.Printf("  • Compression: %s", vaultConfig.Compression)
+			if len(vaultConfig.CompressionPolicies) > 0 {
+				fmt.Printf(" (%d per-pattern policies)", len(vaultConfig.CompressionPolicies))
+			}
+			fmt.Println()
 
 			fmt.Printf("  • Chunking: %s (size: %s)\n", vaultConfig.Chunking.Strategy, vaultConfig.Chunking.ChunkSize)
 
 			// Show total space savings if compression is used
-			if vaultConfig.Compression != "none" && totalSpaceSavings.SpaceSaved > 0 {
+			if (vaultConfig.Compression != "none" || len(vaultConfig.CompressionPolicies) > 0) && totalSpaceSavings.SpaceSaved > 0 {
 				totalSpaceSavedPct := float64(0)
 				if totalSpaceSavings.OriginalSize > 0 {
 					totalSpaceSavedPct = float64(totalSpaceSavings.SpaceSaved) / float64(totalSpaceSavings.OriginalSize) * 100
@@ -359,21 +865,212 @@ Examples:
 
 		// Commit transaction if we had any successes
 		if successCount == 0 {
+			if changes.skipped > 0 && len(failedFiles) == 0 {
+				_ = txn.Rollback()
+				committed = true
+				fmt.Println("\n✓ Vault is up to date")
+				return nil
+			}
 			return fmt.Errorf("all files failed to process")
 		}
+		if packWriter != nil {
+			if err := packWriter.Flush(); err != nil {
+				return fmt.Errorf("failed to write pack: %w", err)
+			}
+		}
 		if err := txn.Commit(); err != nil {
 			return fmt.Errorf("commit transaction: %w", err)
 		}
 		committed = true
+		if err := dedupManager.Save(); err != nil {
+			return fmt.Errorf("failed to save deduplication index (run 'sietch index rebuild'): %v", err)
+		}
+		for _, ing := range ingests {
+			if err := ing.Done(); err != nil {
+				fmt.Printf("Warning: failed to remove add progress: %v\n", err)
+			}
+		}
+		if err := stats.UpdateCounters(vaultRoot, func(c *stats.Counters) { c.LastAdd = time.Now().UTC() }); err != nil {
+			fmt.Printf("Warning: failed to record the add time: %v\n", err)
+		}
 		fmt.Println("txn successful; add committed")
 		return nil
 	},
 }
 
+// changeCounts tallies how add --if-changed treated files already in the vault
+type changeCounts struct {
+	skipped      int // Unchanged files left as they are
+	readded      int // Changed files stored again
+	verified     int // Stat-matching files re-hashed to confirm they are unchanged
+	statMismatch int // Re-hashed files whose content changed despite matching stat
+}
+
+// check reports whether a source file still matches its manifest. Files whose
+// size, mtime and inode match are taken as unchanged without reading them unless
+// verify is set, in which case they are re-hashed.
+func (c *changeCounts) check(existing *config.FileManifest, path string, info os.FileInfo, vaultConfig config.VaultConfig, verify bool) (bool, error) {
+	if !manifest.StatMatches(existing, info) {
+		return false, nil
+	}
+	if verify {
+		c.verified++
+		same, err := manifest.ContentMatches(path, existing, vaultConfig)
+		if err != nil {
+			return false, fmt.Errorf("failed to verify content: %v", err)
+		}
+		if !same {
+			c.statMismatch++
+			return false, nil
+		}
+	}
+	c.skipped++
+	return true, nil
+}
+
+// addToPack reads a small file and appends it to the current pack
+func addToPack(packWriter *pack.Writer, filePath string) (*config.PackRef, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return packWriter.Add(data)
+}
+
+// verifyWrittenFile reads a file's chunks back, staged or already stored, and
+// checks that they reassemble to the source file
+func verifyWrittenFile(sourcePath string, chunkRefs []config.ChunkRef, store chunker.ChunkStore, opts chunker.Options) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer source.Close()
+	return chunker.VerifyContent(source, store, chunkRefs, opts)
+}
+
+// chunkFileTransactional splits a file with the chunker pipeline, deduplicating against the
+// vault index and staging new chunks through the transaction store. With an ingest, the file
+// is split from where the interrupted add it resumes stopped.
+func chunkFileTransactional(ctx context.Context, filePath string, policy chunk.Policy, fileCompression chunk.CompressionChoice, vaultRoot string, vaultConfig config.VaultConfig, passphrase string, jobs int, progressMgr *progress.Manager, store chunker.ChunkStore, ing *ingest.Ingest) ([]config.ChunkRef, error) {
+	file, err := fs.VerifyFileAndReturnFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+	size := fileInfo.Size()
+	if ing != nil && ing.Offset() > 0 {
+		if _, err := file.Seek(ing.Offset(), io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to seek to resume point: %v", err)
+		}
+		size -= ing.Offset()
+	}
+	return chunkReaderTransactional(ctx, file, size, policy, fileCompression, vaultRoot, vaultConfig, passphrase, jobs, progressMgr, store, ing)
+}
+
+// chunkReaderTransactional streams r through the chunker pipeline like
+// chunkFileTransactional. size is used for progress only; -1 when unknown.
+func chunkReaderTransactional(ctx context.Context, r io.Reader, size int64, policy chunk.Policy, fileCompression chunk.CompressionChoice, vaultRoot string, vaultConfig config.VaultConfig, passphrase string, jobs int, progressMgr *progress.Manager, store chunker.ChunkStore, ing *ingest.Ingest) ([]config.ChunkRef, error) {
+	progressMgr.InitTotalProgress(size, "Chunking file (txn)")
+
+	opts, err := chunker.OptionsFromConfig(vaultRoot, vaultConfig, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	opts.Strategy = policy.Strategy
+	opts.ChunkSize = policy.ChunkSize
+	opts.Compression = fileCompression.Algorithm
+	opts.Level = fileCompression.Level
+	opts.Jobs = jobs
+	if err := opts.UseDictionary(fileCompression.Dictionary); err != nil {
+		return nil, err
+	}
+
+	totalBytes := int64(0)
+	opts.OnChunk = func(ref config.ChunkRef) {
+		if ing != nil {
+			ing.Record(ref)
+		}
+		totalBytes += ref.Size
+		progressMgr.UpdateTotalProgress(ref.Size)
+		progressMgr.PrintVerbose("%s", chunk.FormatChunkRefString(ref))
+	}
+
+	var chunkRefs []config.ChunkRef
+	if policy.Strategy == chunk.StrategyWhole {
+		chunkRefs, err = chunker.StoreWhole(r, store, opts)
+	} else {
+		chunkRefs, err = chunker.Split(ctx, r, store, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ing != nil {
+		// The chunks stored by the interrupted add come first
+		if chunkRefs, err = ing.Finish(); err != nil {
+			return nil, err
+		}
+	}
+
+	progressMgr.PrintInfo("Total chunks processed: %d\n", len(chunkRefs))
+	progressMgr.PrintInfo("Total bytes processed: %s\n", util.HumanReadableSize(totalBytes))
+	return chunkRefs, nil
+}
+
+// ingestSource identifies a file added with checkpoints and the settings its
+// chunks are stored under, so only an add of the same file resumes them
+func ingestSource(path string, info os.FileInfo, policy chunk.Policy, fileCompression chunk.CompressionChoice, hashAlgorithm, scope string, vaultConfig config.VaultConfig) ingest.Source {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return ingest.Source{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime().Format(time.RFC3339Nano),
+		Inode:   fs.Inode(info),
+		Settings: fmt.Sprintf("%s %d %s %d %s %s %s %s", policy.Strategy, policy.ChunkSize,
+			fileCompression.Algorithm, fileCompression.Level, fileCompression.Dictionary,
+			hashAlgorithm, vaultConfig.Encryption.Type, scope),
+	}
+}
+
+// checkStdinFlags rejects the flags add --stdin cannot honour
+func checkStdinFlags(cmd *cobra.Command) error {
+	for _, name := range []string{"recursive", "if-changed", "verify-after-write", "whole-file", "passphrase-stdin"} {
+		if set, _ := cmd.Flags().GetBool(name); set {
+			return fmt.Errorf("--%s cannot be used with --stdin", name)
+		}
+	}
+	if cmd.Flags().Changed("since") {
+		return fmt.Errorf("--since cannot be used with --stdin")
+	}
+	return nil
+}
+
+// stdinFilePair returns the file pair add --stdin stores its input as: a file
+// called name in the directory given by the optional destination argument
+func stdinFilePair(name string, args []string) (FilePair, error) {
+	if name == "" {
+		return FilePair{}, fmt.Errorf("--stdin requires --name to name the stored file")
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return FilePair{}, fmt.Errorf("--name must be a file name, not a path; give the directory as the destination")
+	}
+	pair := FilePair{Source: name}
+	if len(args) > 0 && args[0] != "" {
+		pair.Destination = strings.TrimSuffix(args[0], "/") + "/"
+	}
+	return pair, nil
+}
+
 // FilePair represents a source file and its destination path
 type FilePair struct {
 	Source      string
 	Destination string
+	EmptyDir    bool // An empty directory of an added tree, recorded without content
 }
 
 // calculateSpaceSavings calculates space savings for a file based on its chunks
@@ -421,7 +1118,7 @@ func parseFileArguments(args []string) ([]FilePair, error) {
 		for i := 0; i < len(args); i += 2 {
 			pairs = append(pairs, FilePair{
 				Source:      args[i],
-				Destination: args[i+1],
+				Destination: filepath.ToSlash(args[i+1]),
 			})
 		}
 		return pairs, nil
@@ -429,7 +1126,7 @@ func parseFileArguments(args []string) ([]FilePair, error) {
 
 	// Odd number of arguments (single destination pattern)
 	// Last argument is the destination for all sources
-	destination := args[len(args)-1]
+	destination := filepath.ToSlash(args[len(args)-1])
 	var pairs []FilePair
 
 	for i := 0; i < len(args)-1; i++ {
@@ -482,23 +1179,36 @@ func expandDirectories(pairs []FilePair, recursive bool, includeHidden bool) ([]
 					return nil
 				}
 
-				// Only add regular files and symlinks
-				if !d.IsDir() {
-					// Compute relative path from source directory
-					relPath, err := filepath.Rel(pair.Source, path)
+				// Compute relative path from source directory
+				relPath, err := filepath.Rel(pair.Source, path)
+				if err != nil {
+					return fmt.Errorf("failed to compute relative path: %v", err)
+				}
+
+				// Add regular files and symlinks, and empty directories so the
+				// tree can be reproduced
+				if d.IsDir() {
+					if path == pair.Source {
+						return nil
+					}
+					empty, err := isEmptyDir(path, includeHidden)
 					if err != nil {
-						return fmt.Errorf("failed to compute relative path: %v", err)
+						return err
 					}
-
-					// Preserve directory structure in destination
-					destPath := filepath.Join(pair.Destination, relPath)
-
-					expandedPairs = append(expandedPairs, FilePair{
-						Source:      path,
-						Destination: destPath,
-					})
+					if empty {
+						expandedPairs = append(expandedPairs, FilePair{
+							Source:      path,
+							Destination: treeDestination(pair.Destination, relPath),
+							EmptyDir:    true,
+						})
+					}
+					return nil
 				}
 
+				expandedPairs = append(expandedPairs, FilePair{
+					Source:      path,
+					Destination: treeDestination(pair.Destination, relPath),
+				})
 				return nil
 			})
 
@@ -516,6 +1226,66 @@ func expandDirectories(pairs []FilePair, recursive bool, includeHidden bool) ([]
 	return expandedPairs, nil
 }
 
+// treeEntryManifest returns the manifest recording a symlink, by its target,
+// or an empty directory
+func treeEntryManifest(pair FilePair, info os.FileInfo, tags []string) (*config.FileManifest, error) {
+	m := &config.FileManifest{
+		FilePath:    filepath.Base(pair.Source),
+		ModTime:     info.ModTime().Format(time.RFC3339Nano),
+		Destination: pair.Destination,
+		AddedAt:     time.Now().UTC(),
+		Tags:        tags,
+		Owner:       fileOwner(info),
+	}
+	if info.IsDir() {
+		m.Type = config.FileTypeDir
+		m.Mode = fs.FormatMode(info.Mode())
+		return m, nil
+	}
+	target, err := os.Readlink(pair.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read symlink: %v", err)
+	}
+	m.Type = config.FileTypeSymlink
+	m.LinkTarget = filepath.ToSlash(target)
+	return m, nil
+}
+
+// fileOwner returns the owner of a file to record, or nil where the platform
+// has none
+func fileOwner(info os.FileInfo) *config.FileOwner {
+	uid, gid, ok := fs.Owner(info)
+	if !ok {
+		return nil
+	}
+	return &config.FileOwner{UID: uid, GID: gid}
+}
+
+// treeDestination returns the vault directory of a path found relPath deep
+// in a tree added to destination. Vault paths use forward slashes whatever
+// the host.
+func treeDestination(destination, relPath string) string {
+	dir := path.Join(filepath.ToSlash(destination), filepath.ToSlash(filepath.Dir(relPath)))
+	if dir == "." {
+		return ""
+	}
+	return dir + "/"
+}
+
+// isEmptyDir reports whether a directory holds nothing add would store
+func isEmptyDir(dir string, includeHidden bool) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !fs.ShouldSkipHidden(entry.Name(), includeHidden) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func init() {
 	rootCmd.AddCommand(addCmd)
 
@@ -524,27 +1294,43 @@ func init() {
 	addCmd.Flags().StringP("tags", "t", "", "Comma-separated tags to associate with the file")
 	addCmd.Flags().BoolP("recursive", "r", false, "Recursively add directories")
 	addCmd.Flags().BoolP("include-hidden", "H", false, "Include hidden files and directories")
+	addCmd.Flags().String("symlinks", "follow", "How to add symlinks: follow stores the file a link points to, store records the link itself by its target")
 	addCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
 	addCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	addCmd.Flags().Bool("if-changed", false, "Skip files already in the vault whose size, mtime and inode are unchanged, without reading them; "+
+		"a file edited without changing its size or mtime (e.g. a restored mtime) is also skipped")
+	addCmd.Flags().Bool("force-rehash", false, "With --if-changed, re-hash every file instead of trusting size and mtime")
+	addCmd.Flags().Bool("verify-after-write", false, "Read every file back from the vault after writing it and fail the add if it does not match the source")
+	addCmd.Flags().String("dedup-hints", "", "Record chunks listed in this hints file (from 'sietch dedup export-hints') as remote instead of storing them")
+	addCmd.Flags().Bool("whole-file", false, "Store files smaller than the dedup min_chunk_size as a single blob without chunking them")
+	addCmd.Flags().Int("jobs", 1, "Compress and encrypt this many chunks of each file in parallel; worth raising for brotli and high zstd levels")
+	addCmd.Flags().Bool("stdin", false, "Store the data piped into sietch as one file named by --name")
+	addCmd.Flags().String("name", "", "With --stdin, the file name to store the data under")
+	addCmd.Flags().Int("num-chunks-per-file", constants.DefaultMaxChunksPerFile, "Refuse files split into more chunks than this (0 = no limit); defaults to the vault's chunking.max_chunks_per_file")
+	addCmd.Flags().Float64("verify-sample", 0, "With --if-changed, re-hash this percentage of the files skipped by size and mtime")
+	addCmd.Flags().String("since", "", "Skip files last modified before this time: a duration back from now (36h, 7d, 2w) or a date (YYYY-MM-DD, RFC 3339); "+
+		"combine with --if-changed to also skip unchanged files already in the vault")
 }
 
 // storeManifestTransactional writes a manifest yaml via the transaction staging new file.
-func storeManifestTransactional(txn *atomic.Transaction, vaultRoot string, fileName string, m *config.FileManifest) error {
+// An existing manifest is replaced without asking when overwrite is set.
+func storeManifestTransactional(txn *atomic.Transaction, vaultRoot string, name string, displayPath string, m *config.FileManifest, overwrite, compress bool) error {
 	// Mirror logic from manifest.StoreFileManifest but stage instead of direct write.
 	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
 	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
 		return fmt.Errorf("failed to create manifests directory: %v", err)
 	}
-	destination := strings.ReplaceAll(m.Destination, "/", ".")
-	uniqueFileIdentifier := destination + fileName + ".yaml"
+	uniqueFileIdentifier := name + ".yaml"
 	relPath := filepath.ToSlash(filepath.Join(".sietch", "manifests", uniqueFileIdentifier))
 	// Prompt overwrite if exists in final location
 	finalPath := filepath.Join(manifestsDir, uniqueFileIdentifier)
 	if _, err := os.Stat(finalPath); err == nil {
-		message := fmt.Sprintf("'%s' exists. Overwrite? ", m.Destination+fileName)
-		response, err2 := util.ConfirmOverwrite(message, os.Stdin, os.Stdout)
-		if err2 != nil || !response {
-			return fmt.Errorf("skipped")
+		if !overwrite {
+			message := fmt.Sprintf("'%s' exists. Overwrite? ", displayPath)
+			response, err2 := util.ConfirmOverwrite(message, os.Stdin, os.Stdout)
+			if err2 != nil || !response {
+				return fmt.Errorf("skipped")
+			}
 		}
 		// Stage replace instead of create
 		w, err2 := txn.StageReplace(relPath)
@@ -552,24 +1338,34 @@ func storeManifestTransactional(txn *atomic.Transaction, vaultRoot string, fileN
 			return err2
 		}
 		defer w.Close()
-		return writeManifestYAML(w, m)
+		return writeManifestYAML(w, m, compress)
 	}
 	w, err := txn.StageCreate(relPath)
 	if err != nil {
 		return err
 	}
 	defer w.Close()
-	return writeManifestYAML(w, m)
+	return writeManifestYAML(w, m, compress)
 }
 
-func writeManifestYAML(w io.Writer, m *config.FileManifest) error {
-	enc := yaml.NewEncoder(w)
+// manifestFileName returns the name, without extension, of the manifest for a file.
+// Vaults that encrypt paths name it after the keyed path hash instead.
+func manifestFileName(paths *pathencryption.Cipher, destination, fileName string) string {
+	if paths != nil {
+		return paths.PathID(destination + fileName)
+	}
+	return strings.ReplaceAll(destination, "/", ".") + fileName
+}
+
+// writeManifestYAML encodes a manifest to w, zstd-compressed when compress is set
+func writeManifestYAML(w io.Writer, m *config.FileManifest, compress bool) error {
+	mw := config.NewManifestWriter(w, compress)
+	enc := yaml.NewEncoder(mw)
 	enc.SetIndent(2)
 	if err := enc.Encode(m); err != nil {
 		return fmt.Errorf("encode manifest: %w", err)
 	}
-	return nil
+	return mw.Close()
 }
 
-//TODO: Need to check how symlinks will be handled
 //TODO: Interactive mode with real time progress indicators
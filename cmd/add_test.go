@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
 	"github.com/substantialcattle5/sietch/testutil"
 )
 
@@ -264,3 +270,246 @@ func TestAddCommandBatchProcessingOutput(t *testing.T) {
 		}
 	}
 }
+
+func TestStdinFilePair(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    FilePair
+		wantErr string
+	}{
+		{name: "backup.sql", want: FilePair{Source: "backup.sql"}},
+		{name: "backup.sql", args: []string{"backups/"}, want: FilePair{Source: "backup.sql", Destination: "backups/"}},
+		{name: "backup.sql", args: []string{"db/backups"}, want: FilePair{Source: "backup.sql", Destination: "db/backups/"}},
+		{name: "", wantErr: "requires --name"},
+		{name: "db/backup.sql", wantErr: "must be a file name"},
+		{name: "..", wantErr: "must be a file name"},
+	}
+	for _, tt := range tests {
+		got, err := stdinFilePair(tt.name, tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("stdinFilePair(%q, %v) error = %v, want %q", tt.name, tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("stdinFilePair(%q, %v) = %+v, %v; want %+v", tt.name, tt.args, got, err, tt.want)
+		}
+	}
+}
+
+// TestExpandDirectoriesTree ensures a tree keeps its layout, empty directories included
+func TestExpandDirectoriesTree(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"sub/deep", "empty", "hidden-only/.cache"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"top.txt", "sub/deep/a.txt"} {
+		if err := os.WriteFile(filepath.Join(root, file), []byte("spice"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("top.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	pairs, err := expandDirectories([]FilePair{{Source: root, Destination: "tree/"}}, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pair := range pairs {
+		entry := pair.Destination + filepath.Base(pair.Source)
+		if pair.EmptyDir {
+			entry += "/"
+		}
+		got = append(got, entry)
+	}
+	slices.Sort(got)
+	want := []string{"tree/empty/", "tree/hidden-only/", "tree/link", "tree/sub/deep/a.txt", "tree/top.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expandDirectories() = %v, want %v", got, want)
+	}
+
+	info, err := os.Lstat(filepath.Join(root, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := treeEntryManifest(FilePair{Source: filepath.Join(root, "link"), Destination: "tree/"}, info, nil)
+	if err != nil || !m.IsSymlink() || m.LinkTarget != "top.txt" || m.FilePath != "link" {
+		t.Errorf("treeEntryManifest() = %+v, %v", m, err)
+	}
+}
+
+// TestAddOverwritePromptReleasesChunks ensures a file replaced by answering the
+// overwrite prompt gives up the references its old chunks held, and a declined
+// prompt leaves none behind for the chunks just read
+func TestAddOverwritePromptReleasesChunks(t *testing.T) {
+	testutil.SkipIfShort(t, "integration test")
+
+	vaultRoot := newTestVault(t)
+
+	add := func(answer string, files map[string]string) (err error) {
+		t.Helper()
+		sources := t.TempDir()
+		args := []string{"add"}
+		for name, content := range files {
+			source := filepath.Join(sources, name)
+			if err := os.WriteFile(source, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			args = append(args, source, "docs/")
+		}
+		in := filepath.Join(t.TempDir(), "answer")
+		if err := os.WriteFile(in, []byte(answer), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stdin, err := os.Open(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stdin.Close()
+		saved := os.Stdin
+		os.Stdin = stdin
+		defer func() { os.Stdin = saved }()
+
+		return runSietch(t, args...)
+	}
+	checkIndex := func(when string) {
+		t.Helper()
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check, err := dedupManager.CheckIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !check.OK() {
+			t.Errorf("%s: index does not match the manifests: %+v", when, check.Problems)
+		}
+	}
+
+	if err := add("", map[string]string{"notes.txt": strings.Repeat("first version\n", 512)}); err != nil {
+		t.Fatalf("first add: %v", err)
+	}
+	checkIndex("after the first add")
+	if err := add("y\n", map[string]string{"notes.txt": strings.Repeat("second version\n", 512)}); err != nil {
+		t.Fatalf("overwriting add: %v", err)
+	}
+	checkIndex("after overwriting at the prompt")
+	// Another file in the batch commits the index along with the declined one
+	declined := map[string]string{
+		"notes.txt": strings.Repeat("third version\n", 512),
+		"todo.txt":  strings.Repeat("a new file\n", 512),
+	}
+	if err := add("n\n", declined); err != nil {
+		t.Fatalf("add declining the overwrite: %v", err)
+	}
+	checkIndex("after declining the prompt")
+}
+
+// newTestVault creates an unencrypted vault with chunk deduplication and runs
+// the test inside it with a HOME of its own
+func newTestVault(t testing.TB) string {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	if err := fs.CreateVaultStructure(vaultRoot); err != nil {
+		t.Fatal(err)
+	}
+	vaultYAML := `name: test
+encryption:
+  type: none
+chunking:
+  strategy: fixed
+  chunk_size: 4MB
+  hash_algorithm: sha256
+deduplication:
+  enabled: true
+  strategy: content
+  min_chunk_size: 1KB
+  max_chunk_size: 64MB
+  index_enabled: true
+`
+	if err := os.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), []byte(vaultYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(vaultRoot)
+	return vaultRoot
+}
+
+// runSietch runs a sietch command line in-process, discarding its output
+func runSietch(t testing.TB, args ...string) (err error) {
+	t.Helper()
+	rootCmd.SetArgs(args)
+	testutil.CaptureOutput(t, func() { err = rootCmd.Execute() })
+	return err
+}
+
+// BenchmarkAdd times 'sietch add' of one small file against vaults already
+// holding more and more files. add lists no manifests, so what still grows
+// with the vault is loading the dedup index, which it reads whole.
+func BenchmarkAdd(b *testing.B) {
+	for _, files := range []int{1_000, 10_000, 100_000} {
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			vaultRoot := newTestVault(b)
+			populateVault(b, vaultRoot, files)
+			sources := b.TempDir()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				source := filepath.Join(sources, fmt.Sprintf("new%d.txt", i))
+				if err := os.WriteFile(source, []byte(strings.Repeat(fmt.Sprintf("new file %d\n", i), 128)), 0o644); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if err := runSietch(b, "add", source, "docs/"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// populateVault writes the manifests of n files of one distinct chunk each and
+// builds the dedup index from them, as if they had been added one by one
+func populateVault(b *testing.B, vaultRoot string, n int) {
+	b.Helper()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	for i := 0; i < n; i++ {
+		m := &config.FileManifest{
+			FilePath:    fmt.Sprintf("file%07d.txt", i),
+			Size:        2048,
+			Destination: "docs/",
+			Chunks:      []config.ChunkRef{{Hash: fmt.Sprintf("%064x", i), Size: 2048}},
+			Chunking:    &config.FileChunking{Strategy: "fixed", HashAlgorithm: "sha256"},
+		}
+		f, err := os.Create(filepath.Join(manifestsDir, fmt.Sprintf("docs.file%07d.txt.yaml", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = writeManifestYAML(f, m, false)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := deduplication.RebuildIndex(vaultRoot, vaultConfig.Deduplication); err != nil {
+		b.Fatal(err)
+	}
+}
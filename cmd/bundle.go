@@ -0,0 +1,410 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/bundle"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// bundleCmd groups the commands that sync vaults through files carried by hand
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Sync with a peer through files carried on removable media",
+	Long: `Sync with a trusted peer that never shares a network with this vault.
+
+'bundle create' packages what the peer is missing into a bundle file,
+encrypted to the peer's sync key and signed with this vault's. 'bundle apply'
+on the peer checks the signature, imports the bundle and writes a have-list of
+what the peer now holds, to carry back. Giving that have-list to the next
+'bundle create' keeps bundles to what is really missing; without one, bundles
+leave out what earlier bundles for the peer carried.
+
+Bundles need RSA sync keys on both sides, and like 'sietch sync' the two
+vaults must share their encryption key.
+
+Example:
+  sietch bundle create --for laptop --output /media/usb/delta.sietchbundle
+  sietch bundle apply /media/usb/delta.sietchbundle
+  sietch bundle create --for laptop --have /media/usb/delta.sietchbundle.have --output /media/usb/delta.sietchbundle`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// bundleCreateCmd writes a bundle of what a peer is missing
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create --for <peer> --output <file>",
+	Short: "Write a bundle of what a peer is missing",
+	Long: `Write the chunks, packs, compression dictionaries and file manifests a
+trusted peer is missing to a bundle file, encrypted to the peer's sync key.
+
+What the peer holds is taken from --have, a have-list written by the peer's
+last 'bundle apply' or 'bundle have', or else from what this vault knows
+from earlier have-lists and bundles. The first bundle for a peer without a
+have-list holds the whole vault. --full ignores what is known.
+
+--max-size splits the bundle into parts of at most that size, named
+<output>.001, <output>.002 and so on, for FAT32 drives (4GB per file).`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		peerArg, _ := cmd.Flags().GetString("for")
+		output, _ := cmd.Flags().GetString("output")
+		havePath, _ := cmd.Flags().GetString("have")
+		full, _ := cmd.Flags().GetBool("full")
+		maxSizeFlag, _ := cmd.Flags().GetString("max-size")
+		var maxSize int64
+		if maxSizeFlag != "" {
+			var err error
+			if maxSize, err = util.ParseChunkSize(maxSizeFlag); err != nil {
+				return fmt.Errorf("invalid --max-size: %v", err)
+			}
+			if maxSize < 1024*1024 {
+				return fmt.Errorf("--max-size must be at least 1MB")
+			}
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		peer := matchTrustedPeer(vaultConfig, peerArg)
+		if peer == nil {
+			return fmt.Errorf("%s is not a trusted peer of this vault; trust it with 'sietch sync' or 'sietch peers discover' first", peerArg)
+		}
+		peerKey, err := keys.ParseSyncPublicKeyPEM([]byte(peer.PublicKey))
+		if err != nil {
+			return fmt.Errorf("failed to parse the sync key of %s: %v", peerName(*peer), err)
+		}
+		privateKey, fingerprint, err := loadBundleKeys(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		// What the peer holds
+		statePath := bundle.PeerStatePath(vaultRoot, peer.ID)
+		have := &bundle.HaveList{}
+		switch {
+		case havePath != "":
+			if have, err = bundle.LoadHaveList(havePath); err != nil {
+				return fmt.Errorf("failed to read have-list: %v", err)
+			}
+			if have.Fingerprint != "" && have.Fingerprint != peer.Fingerprint {
+				return fmt.Errorf("%s is the have-list of another vault (sync key %s)", havePath, have.Fingerprint)
+			}
+		case full:
+		default:
+			if known, err := bundle.LoadHaveList(statePath); err == nil {
+				have = known
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read what %s holds: %v", peerName(*peer), err)
+			} else {
+				fmt.Printf("No have-list from %s yet; the bundle holds the whole vault.\n", peerName(*peer))
+			}
+		}
+
+		vaultMgr, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault: %v", err)
+		}
+		vaultManifest, err := vaultMgr.GetManifest()
+		if err != nil {
+			return fmt.Errorf("failed to load vault manifest: %v", err)
+		}
+		plan := bundle.NewPlan(vaultManifest, have)
+		if plan.Empty() {
+			fmt.Printf("✓ %s holds everything in this vault; no bundle written.\n", peerName(*peer))
+			return nil
+		}
+
+		pw, err := bundle.CreateParts(output, maxSize)
+		if err != nil {
+			return err
+		}
+		header := bundle.Header{
+			VaultID:   vaultConfig.VaultID,
+			VaultName: vaultConfig.Name,
+			From:      fingerprint,
+			To:        peer.Fingerprint,
+			Created:   time.Now().UTC(),
+		}
+		bw, err := bundle.NewWriter(pw, header, peerKey, privateKey)
+		if errors.Is(err, bundle.ErrNotRSA) {
+			pw.Abort()
+			return fmt.Errorf("%s has an %s sync key; %v", peerName(*peer), peer.KeyType, err)
+		}
+		if err != nil {
+			pw.Abort()
+			return err
+		}
+		size, err := plan.Write(vaultRoot, bw)
+		if err == nil {
+			err = bw.Close()
+		}
+		if err == nil {
+			err = pw.Close()
+		}
+		if err != nil {
+			pw.Abort()
+			return fmt.Errorf("failed to write bundle: %v", err)
+		}
+
+		// Later bundles leave out what this one carries
+		have.Merge(plan.Sent())
+		have.Fingerprint = peer.Fingerprint
+		if err := have.Save(statePath); err != nil {
+			fmt.Printf("Warning: failed to record what the bundle carries: %v\n", err)
+		}
+
+		fmt.Printf("✓ Bundle for %s: %d files, %d chunks, %d packs, %s\n",
+			peerName(*peer), len(plan.Files), len(plan.Chunks), len(plan.Packs), util.HumanReadableSize(size))
+		for _, path := range pw.Paths() {
+			fmt.Printf("  %s\n", path)
+		}
+		return nil
+	},
+}
+
+// bundleApplyCmd imports a bundle
+var bundleApplyCmd = &cobra.Command{
+	Use:   "apply <file>",
+	Short: "Import a bundle from a trusted peer",
+	Long: `Check the signature of a bundle against the sync key of the trusted peer that
+wrote it, then import the chunks and file manifests it holds. A split bundle
+is given by its first part or the name it was split from.
+
+Applying is idempotent: what the vault already holds is skipped, so an apply
+that was interrupted is finished by running it again. A file the vault holds
+another version of is handled as a sync with the peer would: the peer's
+version replaces one not changed here since the two last exchanged it, and a
+file changed on both sides is a conflict, resolved by --conflict or else left
+to 'sietch conflicts resolve' before the bundle is applied again. Afterwards a have-list
+of what the vault holds is written to --have-output (by default next to the
+bundle, as <file>.have) to carry back to the peer.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := strings.TrimSuffix(args[0], ".001")
+		haveOutput, _ := cmd.Flags().GetString("have-output")
+		if haveOutput == "" {
+			haveOutput = path + ".have"
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		privateKey, fingerprint, err := loadBundleKeys(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		r, parts, err := bundle.OpenParts(path)
+		if err != nil {
+			return fmt.Errorf("failed to open bundle: %v", err)
+		}
+		header, err := bundle.ReadHeader(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if header.To != fingerprint {
+			return fmt.Errorf("the bundle is addressed to another vault (sync key %s)", header.To)
+		}
+		sender := matchTrustedPeer(vaultConfig, header.From)
+		if sender == nil {
+			return fmt.Errorf("the bundle comes from %s (sync key %s), which this vault does not trust", header.VaultName, header.From)
+		}
+		senderKey, err := keys.ParseSyncPublicKeyPEM([]byte(sender.PublicKey))
+		if err != nil {
+			return fmt.Errorf("failed to parse the sync key of %s: %v", peerName(*sender), err)
+		}
+
+		fmt.Printf("🔍 Checking bundle from %s (%d part(s))...\n", peerName(*sender), len(parts))
+		if r, _, err = bundle.OpenParts(path); err != nil {
+			return fmt.Errorf("failed to open bundle: %v", err)
+		}
+		err = bundle.Verify(r, senderKey)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		senderID, err := peer.Decode(sender.ID)
+		if err != nil {
+			return fmt.Errorf("invalid peer ID %q for %s: %v", sender.ID, peerName(*sender), err)
+		}
+		conflictStrategy, err := syncConflictStrategy(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		applier, err := bundle.NewApplier(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if r, _, err = bundle.OpenParts(path); err != nil {
+			return fmt.Errorf("failed to open bundle: %v", err)
+		}
+		err = bundle.Read(r, privateKey, applier.Record)
+		r.Close()
+		if err == nil {
+			err = applier.Finish(senderID, sender.Name, conflictStrategy)
+		}
+		result := &applier.Result
+		operationCounts.Files += result.Files + result.Updated
+		operationCounts.Chunks += result.Chunks
+		operationCounts.Bytes += result.BytesImported
+		var conflictErr *p2p.ConflictError
+		if errors.As(err, &conflictErr) {
+			cmd.SilenceUsage = true
+			fmt.Printf("\n⚠️  Changed both here and by %s since they were last exchanged:\n", peerName(*sender))
+			listConflicts(conflictErr.Conflicts)
+			return fmt.Errorf("no file of the bundle was stored: %d files were changed on both sides; resolve them with "+
+				"'sietch conflicts resolve' or pass --conflict newest or keep-both, then apply the bundle again", len(conflictErr.Conflicts))
+		}
+		if err != nil {
+			return fmt.Errorf("%v; what was imported is kept, apply the bundle again to finish", err)
+		}
+
+		vaultMgr, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault: %v", err)
+		}
+		if err := vaultMgr.RebuildReferences(); err != nil {
+			return fmt.Errorf("failed to rebuild references: %v", err)
+		}
+
+		fmt.Printf("✓ Imported %d files, %d chunks, %d packs and %d compression dictionaries (%s)\n",
+			result.Files, result.Chunks, result.Packs, result.Dicts, util.HumanReadableSize(result.BytesImported))
+		if result.Updated > 0 {
+			fmt.Printf("  Updated %d files to the peer's version\n", result.Updated)
+		}
+		for _, c := range result.Conflicts {
+			fmt.Printf("  Changed on both sides: %s, %s\n", c.DisplayPath(), describePlannedResolution(c.Resolution))
+		}
+		if result.Skipped > 0 {
+			fmt.Printf("  %d items were already in the vault\n", result.Skipped)
+		}
+		if err := writeHaveList(vaultMgr, vaultConfig, fingerprint, haveOutput); err != nil {
+			return err
+		}
+		fmt.Printf("Carry %s back to %s for its next bundle.\n", haveOutput, peerName(*sender))
+		return nil
+	},
+}
+
+// bundleHaveCmd writes the vault's have-list
+var bundleHaveCmd = &cobra.Command{
+	Use:   "have <file>",
+	Short: "Write a have-list of what the vault holds",
+	Long: `Write a have-list of what the vault holds, for a peer to give to
+'bundle create --have' so its first bundle for this vault leaves out what the
+vault already holds.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		_, fingerprint, err := loadBundleKeys(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+		vaultMgr, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault: %v", err)
+		}
+		return writeHaveList(vaultMgr, vaultConfig, fingerprint, args[0])
+	},
+}
+
+// loadBundleKeys loads the vault's sync key and its fingerprint
+func loadBundleKeys(vaultRoot string, vaultConfig *config.VaultConfig) (crypto.Signer, string, error) {
+	if vaultConfig.Sync.RSA == nil {
+		return nil, "", fmt.Errorf("vault has no sync key configured")
+	}
+	privateKey, publicKey, _, err := keys.LoadSyncKeys(vaultRoot, vaultConfig.Sync.RSA)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load sync keys: %v", err)
+	}
+	fingerprint, err := keys.SyncKeyFingerprint(publicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return privateKey, fingerprint, nil
+}
+
+// writeHaveList writes the have-list of the vault to path
+func writeHaveList(vaultMgr *config.Manager, vaultConfig *config.VaultConfig, fingerprint, path string) error {
+	vaultManifest, err := vaultMgr.GetManifest()
+	if err != nil {
+		return fmt.Errorf("failed to load vault manifest: %v", err)
+	}
+	have := bundle.HaveListOf(vaultManifest, vaultConfig.VaultID, fingerprint)
+	if err := have.Save(path); err != nil {
+		return fmt.Errorf("failed to write have-list: %v", err)
+	}
+	fmt.Printf("✓ Have-list written to %s (%d files, %d chunks)\n", path, len(have.Files), len(have.Chunks))
+	return nil
+}
+
+// matchTrustedPeer returns the trusted peer with the given name, ID or
+// fingerprint, or nil
+func matchTrustedPeer(vaultConfig *config.VaultConfig, nameOrID string) *config.TrustedPeer {
+	peers := trustedPeers(vaultConfig)
+	for i := range peers {
+		if peers[i].ID == nameOrID || peers[i].Name == nameOrID || peers[i].Fingerprint == nameOrID {
+			return &peers[i]
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleCreateCmd)
+	bundleCmd.AddCommand(bundleApplyCmd)
+	bundleCmd.AddCommand(bundleHaveCmd)
+
+	bundleCreateCmd.Flags().String("for", "", "Trusted peer the bundle is for, by name, ID or fingerprint")
+	bundleCreateCmd.Flags().StringP("output", "o", "", "Bundle file to write")
+	bundleCreateCmd.Flags().String("have", "", "Have-list of the peer, written by its 'bundle apply' or 'bundle have'")
+	bundleCreateCmd.Flags().Bool("full", false, "Bundle the whole vault, ignoring what the peer is known to hold")
+	bundleCreateCmd.Flags().String("max-size", "", "Split the bundle into parts of at most this size (e.g. 4000MB for FAT32)")
+	_ = bundleCreateCmd.MarkFlagRequired("for")
+	_ = bundleCreateCmd.MarkFlagRequired("output")
+	_ = bundleCreateCmd.RegisterFlagCompletionFunc("for", completeTrustedPeers)
+
+	bundleApplyCmd.Flags().String("conflict", "", "How to handle files changed here and in the bundle: manual, newest or keep-both (default: the vault's sync.conflict, else manual)")
+	bundleApplyCmd.Flags().String("have-output", "", "Where to write the vault's have-list afterwards (default: <file>.have)")
+}
@@ -0,0 +1,195 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// chunkInspectEntry describes a single chunk reported by `sietch chunk inspect`
+type chunkInspectEntry struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Hash   string `json:"hash"`
+	Exists bool   `json:"exists"`
+	Zero   bool   `json:"zero,omitempty"` // All-zero chunk, recorded without storing data
+}
+
+// chunkInspectReport is the full result of `sietch chunk inspect`
+type chunkInspectReport struct {
+	File          string              `json:"file"`
+	Strategy      string              `json:"strategy"`
+	ChunkSize     int64               `json:"chunk_size"`
+	HashAlgorithm string              `json:"hash_algorithm"`
+	TotalSize     int64               `json:"total_size"`
+	ExistingCount int                 `json:"existing_chunks"`
+	Chunks        []chunkInspectEntry `json:"chunks"`
+}
+
+// chunkCmd groups chunk-level debugging commands
+var chunkCmd = &cobra.Command{
+	Use:   "chunk",
+	Short: "Inspect how files are chunked",
+	Long: `Debugging tools for the chunking and deduplication pipeline. 'sietch chunks'
+shows how a file already in the vault was chunked.
+
+Example:
+  sietch chunk inspect photo.jpg
+  sietch chunk inspect photo.jpg --output json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// chunkInspectCmd runs the vault's chunker over a local file without adding it
+var chunkInspectCmd = &cobra.Command{
+	Use:   "inspect <file>",
+	Short: "Show how a file would be chunked by this vault",
+	Long: `Run the vault's configured chunker over a local file without adding it
+to the vault, and print each chunk's offset, length and hash along with
+whether that chunk already exists in the vault.
+
+Useful for answering "why didn't these two similar files deduplicate?".
+
+Example:
+  sietch chunk inspect report-v1.pdf
+  sietch chunk inspect report-v2.pdf --output json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		chunkSize, err := util.ParseChunkSize(vaultConfig.Chunking.ChunkSize)
+		if err != nil {
+			chunkSize = int64(constants.DefaultChunkSize)
+		}
+		chunkSize = chunk.BoundChunkSize(vaultConfig.Deduplication, chunkSize)
+
+		dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+		}
+
+		report, err := inspectFileChunks(args[0], *vaultConfig, chunkSize, dedupManager.ChunkExists)
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		displayChunkInspectReport(report)
+		return nil
+	},
+}
+
+// inspectFileChunks chunks a file with the vault's settings and checks each hash with exists
+func inspectFileChunks(filePath string, vaultConfig config.VaultConfig, chunkSize int64, exists func(hash string) bool) (*chunkInspectReport, error) {
+	file, err := fs.VerifyFileAndReturnFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	chunker, err := chunk.NewChunkerForVault(file, vaultConfig, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &chunkInspectReport{
+		File:          filePath,
+		Strategy:      vaultConfig.Chunking.Strategy,
+		ChunkSize:     chunkSize,
+		HashAlgorithm: vaultConfig.Chunking.HashAlgorithm,
+		Chunks:        []chunkInspectEntry{},
+	}
+
+	for {
+		next, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := chunkInspectEntry{
+			Index:  next.Index,
+			Offset: next.Offset,
+			Length: len(next.Data),
+			Hash:   next.Hash,
+			Zero:   chunk.IsZero(next.Data),
+		}
+		// Zero chunks are never stored, so they are always available
+		entry.Exists = entry.Zero || exists(next.Hash)
+		if entry.Exists {
+			report.ExistingCount++
+		}
+		report.TotalSize += int64(entry.Length)
+		report.Chunks = append(report.Chunks, entry)
+	}
+
+	return report, nil
+}
+
+// displayChunkInspectReport prints a human readable chunk table
+func displayChunkInspectReport(report *chunkInspectReport) {
+	fmt.Printf("File: %s (%s)\n", report.File, util.HumanReadableSize(report.TotalSize))
+	fmt.Printf("Chunking: %s, %s chunks, %s\n", report.Strategy, util.HumanReadableSize(report.ChunkSize), report.HashAlgorithm)
+	fmt.Println()
+	fmt.Printf("%-6s %-12s %-10s %-8s %s\n", "INDEX", "OFFSET", "LENGTH", "IN VAULT", "HASH")
+	for _, c := range report.Chunks {
+		inVault := "no"
+		if c.Zero {
+			inVault = "zero"
+		} else if c.Exists {
+			inVault = "yes"
+		}
+		fmt.Printf("%-6d %-12d %-10d %-8s %s\n", c.Index, c.Offset, c.Length, inVault, c.Hash)
+	}
+	fmt.Println()
+	fmt.Printf("%d chunk(s), %d already in vault\n", len(report.Chunks), report.ExistingCount)
+}
+
+func init() {
+	rootCmd.AddCommand(chunkCmd)
+	chunkCmd.AddCommand(chunkInspectCmd)
+
+	chunkInspectCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
@@ -0,0 +1,222 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	lsui "github.com/substantialcattle5/sietch/internal/ls"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// storedChunk is one chunk of a stored file, as `sietch chunks` reports it
+type storedChunk struct {
+	Index          int      `json:"index"`
+	Hash           string   `json:"hash"`
+	Size           int64    `json:"size"`
+	CompressedSize int64    `json:"compressed_size,omitempty"` // Before encryption; absent when uncompressed or not recorded
+	Compression    string   `json:"compression"`               // Codec the chunk is stored with, or none
+	Incompressible bool     `json:"incompressible,omitempty"`  // Stored raw because compression saved too little
+	Zero           bool     `json:"zero,omitempty"`            // All-zero chunk, recorded without storing data
+	Refs           int      `json:"refs"`                      // References from the vault's files, this one's included
+	SharedWith     []string `json:"shared_with,omitempty"`     // Other files referencing the chunk
+}
+
+// storedChunksReport is the full result of `sietch chunks`
+type storedChunksReport struct {
+	File        string        `json:"file"`
+	Size        int64         `json:"size"`
+	Strategy    string        `json:"strategy,omitempty"`
+	ChunkSize   int64         `json:"chunk_size,omitempty"`
+	Pack        string        `json:"pack,omitempty"` // Pack holding the whole file, which then has no chunks
+	Chunks      []storedChunk `json:"chunks"`
+	Unique      int           `json:"unique_chunks"`   // Distinct chunks
+	Shared      int           `json:"shared_chunks"`   // Distinct chunks other files reference too
+	Repeated    int           `json:"repeated_chunks"` // References to a chunk already used earlier in the file
+	SharedBytes int64         `json:"shared_bytes"`    // Size of the distinct chunks other files reference too
+}
+
+// chunksCmd lists the chunks a stored file was split into
+var chunksCmd = &cobra.Command{
+	Use:   "chunks <file>",
+	Short: "Show how a stored file was chunked",
+	Long: `List the chunks a file in the vault was split into, in order, with each
+chunk's size, the compression it is stored with and how many references the
+vault's files make to it, and name the other files that share it.
+
+Useful to see why a file deduplicated well or badly: chunks shared with other
+files are stored once, and chunk sizes show where content-defined chunking put
+its boundaries. 'sietch chunk inspect' shows how a local file would be chunked
+before adding it.
+
+Reference counts come from the manifests of the vault's current files, so
+chunks kept only by snapshots count no references.
+
+Example:
+  sietch chunks docs/report.pdf
+  sietch chunks report.pdf -o json`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		paths, err := unlockPaths(cmd, vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+		if paths != nil {
+			manager.SetPathRevealer(paths)
+		}
+		manifest, err := manager.GetManifest()
+		if err != nil {
+			return fmt.Errorf("failed to get vault manifest: %v", err)
+		}
+		file, err := matchFileManifest(manifest.Files, args[0])
+		if err != nil {
+			return fmt.Errorf("file not found in vault: %v", err)
+		}
+
+		report := buildStoredChunksReport(*file, buildChunkIndex(manifest.Files))
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		displayStoredChunksReport(report)
+		return nil
+	},
+}
+
+// buildStoredChunksReport describes the chunks of file; chunkRefs maps each
+// chunk hash to the path of every file reference to it, as buildChunkIndex
+// returns
+func buildStoredChunksReport(file config.FileManifest, chunkRefs map[string][]string) *storedChunksReport {
+	path := file.Destination + file.FilePath
+	report := &storedChunksReport{File: path, Size: file.Size, Chunks: []storedChunk{}}
+	if file.Chunking != nil {
+		report.Strategy, report.ChunkSize = file.Chunking.Strategy, file.Chunking.ChunkSize
+	}
+	if file.Pack != nil {
+		report.Pack = file.Pack.ID
+	}
+
+	seen := make(map[string]bool)
+	for _, ref := range file.Chunks {
+		chunk := storedChunk{
+			Index:          ref.Index,
+			Hash:           ref.Hash,
+			Size:           ref.Size,
+			Compression:    constants.CompressionTypeNone,
+			Incompressible: ref.Incompressible,
+			Zero:           ref.Zero,
+		}
+		if ref.Compressed && ref.CompressionType != "" {
+			if compressed, ok := ref.CompressedBytes(); ok {
+				chunk.CompressedSize = compressed
+			}
+			chunk.Compression = ref.CompressionType
+			if ref.CompressionDict != "" {
+				chunk.Compression += "+dict"
+			}
+		}
+
+		id := ref.Hash
+		if id == "" {
+			id = ref.EncryptedHash
+		}
+		refs := chunkRefs[id]
+		chunk.Refs = len(refs)
+		for _, other := range refs {
+			if other != path && !slices.Contains(chunk.SharedWith, other) {
+				chunk.SharedWith = append(chunk.SharedWith, other)
+			}
+		}
+		report.Chunks = append(report.Chunks, chunk)
+
+		if seen[id] {
+			report.Repeated++
+			continue
+		}
+		seen[id] = true
+		report.Unique++
+		if len(chunk.SharedWith) > 0 {
+			report.Shared++
+			report.SharedBytes += ref.Size
+		}
+	}
+	return report
+}
+
+// displayStoredChunksReport prints the chunks of a stored file as a table
+func displayStoredChunksReport(report *storedChunksReport) {
+	fmt.Printf("File: %s (%s)\n", report.File, util.HumanReadableSize(report.Size))
+	if report.Pack != "" {
+		fmt.Printf("Stored whole in pack %s, without chunks\n", report.Pack)
+		return
+	}
+	if report.Strategy != "" {
+		fmt.Printf("Chunking: %s, %s chunks\n", report.Strategy, util.HumanReadableSize(report.ChunkSize))
+	}
+	fmt.Println()
+	fmt.Printf("%-6s %-10s %-10s %-12s %-5s %-64s %s\n", "INDEX", "SIZE", "COMPRESSED", "COMPRESSION", "REFS", "HASH", "SHARED WITH")
+	for _, c := range report.Chunks {
+		compressed := "-"
+		if c.CompressedSize > 0 {
+			compressed = util.HumanReadableSize(c.CompressedSize)
+		}
+		compression := c.Compression
+		switch {
+		case c.Zero:
+			compression = "zero"
+		case c.Incompressible:
+			compression += " (raw)"
+		}
+		sharedWith := "-"
+		if len(c.SharedWith) > 0 {
+			sharedWith = lsui.FormatSharedWith(c.SharedWith, 2)
+		}
+		fmt.Printf("%-6d %-10s %-10s %-12s %-5d %-64s %s\n", c.Index, util.HumanReadableSize(c.Size), compressed,
+			compression, c.Refs, c.Hash, sharedWith)
+	}
+	fmt.Println()
+	fmt.Printf("%d chunk(s), %d unique, %d shared with other files (%s)", len(report.Chunks), report.Unique,
+		report.Shared, util.HumanReadableSize(report.SharedBytes))
+	if report.Repeated > 0 {
+		fmt.Printf(", %d repeated within the file", report.Repeated)
+	}
+	fmt.Println()
+}
+
+func init() {
+	rootCmd.AddCommand(chunksCmd)
+	chunksCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
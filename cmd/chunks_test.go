@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// TestBuildStoredChunksReport ensures chunks are counted as shared only when
+// another file references them
+func TestBuildStoredChunksReport(t *testing.T) {
+	a := config.FileManifest{FilePath: "a.bin", Size: 300, Chunks: []config.ChunkRef{
+		{Index: 0, Hash: "h1", Size: 100, Compressed: true, CompressionType: "zstd", CompressedSize: 40},
+		{Index: 1, Hash: "h2", Size: 100},
+		{Index: 2, Hash: "h2", Size: 100},
+	}}
+	b := config.FileManifest{FilePath: "b.bin", Size: 100, Chunks: []config.ChunkRef{
+		{Index: 0, Hash: "h1", Size: 100, Compressed: true, CompressionType: "zstd"},
+	}}
+	chunkRefs := buildChunkIndex([]config.FileManifest{a, b})
+
+	report := buildStoredChunksReport(a, chunkRefs)
+	want := []storedChunk{
+		{Index: 0, Hash: "h1", Size: 100, CompressedSize: 40, Compression: "zstd", Refs: 2, SharedWith: []string{"b.bin"}},
+		{Index: 1, Hash: "h2", Size: 100, Compression: "none", Refs: 2},
+		{Index: 2, Hash: "h2", Size: 100, Compression: "none", Refs: 2},
+	}
+	if !reflect.DeepEqual(report.Chunks, want) {
+		t.Errorf("chunks = %+v, want %+v", report.Chunks, want)
+	}
+	if report.Unique != 2 || report.Shared != 1 || report.Repeated != 1 || report.SharedBytes != 100 {
+		t.Errorf("unique %d, shared %d, repeated %d, shared bytes %d; want 2, 1, 1, 100",
+			report.Unique, report.Shared, report.Repeated, report.SharedBytes)
+	}
+}
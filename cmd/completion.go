@@ -0,0 +1,120 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/scaffold"
+)
+
+// completionCmd prints the shell completion script, replacing cobra's default
+// command so the install steps are spelled out
+var completionCmd = &cobra.Command{
+	Use:   "completion <bash|zsh|fish|powershell>",
+	Short: "Generate the shell completion script",
+	Long: `Generate the completion script for your shell. Besides commands and flags it
+completes template names for --template and the vault's trusted peers.
+
+Bash (needs the bash-completion package):
+  sietch completion bash > /etc/bash_completion.d/sietch
+  # or, for your user only:
+  sietch completion bash > ~/.local/share/bash-completion/completions/sietch
+
+Zsh:
+  sietch completion zsh > "${fpath[1]}/_sietch"
+  # completion must be enabled once with: autoload -U compinit; compinit
+
+Fish:
+  sietch completion fish > ~/.config/fish/completions/sietch.fish
+
+PowerShell:
+  sietch completion powershell | Out-String | Invoke-Expression
+
+Start a new shell for the completion to take effect.`,
+	Args:                  cobra.ExactArgs(1),
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	DisableFlagsInUseLine: true,
+	SilenceUsage:          true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(out, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(out)
+		case "fish":
+			return rootCmd.GenFishCompletion(out, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(out)
+		}
+		return fmt.Errorf("unsupported shell %q (expected bash, zsh, fish or powershell)", args[0])
+	},
+}
+
+// completeTemplateNames offers the installed scaffold templates
+func completeTemplateNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := scaffold.EnsureDefaultTemplates(); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	templates, err := scaffold.ListAvailableTemplates()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, name := range templates {
+		if !strings.HasPrefix(name, toComplete) {
+			continue
+		}
+		if template, err := scaffold.LoadTemplate(name); err == nil && template.Description != "" {
+			name += "\t" + template.Description
+		}
+		names = append(names, name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTrustedPeers offers the names of the peers the vault trusts, for a
+// command taking a single peer
+func completeTrustedPeers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return peerCompletions(toComplete, peerName), cobra.ShellCompDirectiveNoFileComp
+}
+
+// peerCompletions lists key(peer) for the trusted peers of the current vault
+// starting with toComplete, described by their fingerprint
+func peerCompletions(toComplete string, key func(config.TrustedPeer) string) []string {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return nil
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return nil
+	}
+	var peers []string
+	for _, peer := range trustedPeers(vaultConfig) {
+		if value := key(peer); strings.HasPrefix(value, toComplete) {
+			peers = append(peers, value+"\t"+peer.Fingerprint)
+		}
+	}
+	return peers
+}
+
+// completeTrustedPeerIDs offers the IDs of the peers the vault trusts, for
+// flags that take a peer ID
+func completeTrustedPeerIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return peerCompletions(toComplete, func(peer config.TrustedPeer) string { return peer.ID }), cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
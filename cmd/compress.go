@@ -0,0 +1,370 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/dictionary"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/stats"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// compressCmd groups commands that report on compression and manage
+// compression dictionaries
+var compressCmd = &cobra.Command{
+	Use:   "compress",
+	Short: "Show compression savings and manage compression dictionaries",
+	Long: `Show what each compression codec saves, and manage the zstd dictionaries a
+vault compresses small files with.
+
+Small files compress poorly on their own because every file starts with an
+empty history. A dictionary trained on the vault's own small files gives zstd
+that history up front, which often shrinks configs, JSON and source files
+several times further.
+
+Example:
+  sietch compress stats                 # Savings per codec
+  sietch compress train-dict            # Train on files up to 64KB
+  sietch compress list-dicts
+  sietch compress delete-dict 3a9c01f2
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// compressStatsOutput is what compress stats reports
+type compressStatsOutput struct {
+	Compression   string             `json:"compression"`          // The vault's compression for new chunks
+	Level         int                `json:"level,omitempty"`      // 0 = the algorithm's default
+	Policies      int                `json:"policies"`             // Per-pattern compression policies
+	Codecs        []stats.CodecStats `json:"codecs"`               // Those saving the most first
+	UnknownChunks int                `json:"unknown_chunks"`       // Written without size information, not counted
+	Dictionary    string             `json:"dictionary,omitempty"` // The active dictionary
+}
+
+// compressStatsCmd shows what each compression codec saves
+var compressStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how much space each compression codec saves",
+	Long: `Show, for each compression codec the vault's chunks are stored with, how many
+chunks use it, their size before and after compression, the ratio and the
+space saved. Chunks compressed with a zstd dictionary are listed as zstd+dict,
+and chunks stored raw, because compression is off or saved too little, as
+none. Figures come from the compression recorded in each chunk's manifest
+entry, counting each stored chunk once.
+
+Chunks do not record the level they were compressed at, so the level shown is
+the vault's current setting; 'sietch vault recompress --force' rewrites
+existing chunks at a new level. Chunks written before compressed sizes were
+recorded are left out and counted separately.
+
+Example:
+  sietch compress stats
+  sietch compress stats -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		vaultStats, err := stats.Compute(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to compute vault statistics: %v", err)
+		}
+		output := compressStatsOutput{
+			Compression:   vaultConfig.Compression,
+			Level:         vaultConfig.CompressionLevel,
+			Policies:      len(vaultConfig.CompressionPolicies),
+			Codecs:        vaultStats.Codecs,
+			UnknownChunks: vaultStats.UnknownChunks,
+		}
+		if output.Codecs == nil {
+			output.Codecs = []stats.CodecStats{}
+		}
+		if vaultConfig.CompressionDict != nil {
+			output.Dictionary = vaultConfig.CompressionDict.ID
+		}
+
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(output, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode compression statistics: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		displayCompressStats(output)
+		return nil
+	},
+}
+
+// displayCompressStats prints the savings of each codec as a table
+func displayCompressStats(output compressStatsOutput) {
+	setting := compression.Describe(output.Compression, output.Level)
+	if output.Policies > 0 {
+		setting += fmt.Sprintf(" (%d per-pattern policies)", output.Policies)
+	}
+	if output.Dictionary != "" {
+		setting += ", dictionary " + output.Dictionary
+	}
+	fmt.Printf("Vault compression: %s\n", setting)
+	fmt.Println("Levels are not recorded per chunk; the level above applies to new chunks.")
+	fmt.Println()
+	if len(output.Codecs) == 0 {
+		fmt.Println("No chunks with recorded sizes.")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CODEC\tCHUNKS\tBEFORE\tAFTER\tRATIO\tSAVED")
+		var total stats.CodecStats
+		for _, codec := range output.Codecs {
+			fmt.Fprintln(w, codecRow(codec.Name(), codec))
+			total.Chunks += codec.Chunks
+			total.ChunkBytes += codec.ChunkBytes
+			total.CompressedBytes += codec.CompressedBytes
+			total.Incompressible += codec.Incompressible
+		}
+		if len(output.Codecs) > 1 {
+			fmt.Fprintln(w, codecRow("total", total))
+		}
+		_ = w.Flush()
+		if total.Incompressible > 0 {
+			fmt.Printf("\n%d chunk(s) were stored raw because compression saved too little.\n", total.Incompressible)
+		}
+	}
+	if output.UnknownChunks > 0 {
+		fmt.Printf("%d chunk(s) written without size information are not counted.\n", output.UnknownChunks)
+	}
+}
+
+// codecRow formats one line of the compress stats table
+func codecRow(name string, codec stats.CodecStats) string {
+	ratio := "-"
+	if r, ok := codec.Ratio(); ok {
+		ratio = fmt.Sprintf("%.2fx", r)
+	}
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s\t%s", name, codec.Chunks,
+		util.HumanReadableSize(codec.ChunkBytes), util.HumanReadableSize(codec.CompressedBytes),
+		ratio, util.HumanReadableSize(codec.ChunkBytes-codec.CompressedBytes))
+}
+
+// compressTrainDictCmd trains a dictionary from the vault's small files
+var compressTrainDictCmd = &cobra.Command{
+	Use:   "train-dict",
+	Short: "Train a zstd dictionary on the vault's small files",
+	Long: `Sample small files already in the vault, train a zstd dictionary on them and
+make it the vault's active dictionary. Files added afterwards that are no larger
+than --max-file-size, and that no compression policy matches, are compressed
+with zstd and the dictionary. Files small enough to be packed are compressed
+together with their pack instead.
+
+Each chunk records the dictionary it was compressed with, so files added under
+an earlier dictionary stay readable after training a new one. Dictionaries are
+stored in .sietch/compression/, encrypted like chunks, and sync along with them.
+
+Example:
+  sietch compress train-dict
+  sietch compress train-dict --max-file-size 16KB --dict-size 64KB`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		maxFileSizeFlag, _ := cmd.Flags().GetString("max-file-size")
+		dictSizeFlag, _ := cmd.Flags().GetString("dict-size")
+		maxSamples, _ := cmd.Flags().GetInt("samples")
+
+		maxFileSize, err := util.ParseChunkSize(maxFileSizeFlag)
+		if err != nil || maxFileSize <= 0 {
+			return fmt.Errorf("invalid --max-file-size %q", maxFileSizeFlag)
+		}
+		dictSize, err := util.ParseChunkSize(dictSizeFlag)
+		if err != nil || dictSize < 1024 {
+			return fmt.Errorf("invalid --dict-size %q: must be at least 1KB", dictSizeFlag)
+		}
+		if maxSamples < compression.MinDictionarySamples {
+			return fmt.Errorf("--samples must be at least %d", compression.MinDictionarySamples)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		// Chunks in a shared store are read by every vault using it, and the
+		// others would not have this vault's dictionaries
+		if vaultConfig.SharedStore.Path != "" {
+			return fmt.Errorf("vaults using a shared chunk store cannot use compression dictionaries")
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		opts, err := chunker.OptionsFromConfig(vaultRoot, *vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+
+		samples, err := dictionary.CollectSamples(vaultRoot, *vaultConfig, passphrase, opts, maxFileSize, maxSamples)
+		if err != nil {
+			return err
+		}
+		if len(samples) < compression.MinDictionarySamples {
+			return fmt.Errorf("found %d file(s) of at most %s; at least %d are needed to train a dictionary",
+				len(samples), util.HumanReadableSize(maxFileSize), compression.MinDictionarySamples)
+		}
+		fmt.Printf("Training on %d file(s)...\n", len(samples))
+
+		dict, err := dictionary.Train(samples, int(dictSize))
+		if err != nil {
+			return err
+		}
+
+		// Compare against zstd without a dictionary on the same samples
+		level := 0
+		if vaultConfig.Compression == constants.CompressionTypeZstd {
+			level = vaultConfig.CompressionLevel
+		}
+		var original, plain, withDict int64
+		for _, sample := range samples {
+			compressedPlain, err := compression.CompressDataLevel(sample, constants.CompressionTypeZstd, level)
+			if err != nil {
+				return err
+			}
+			compressedDict, err := compression.CompressWithDictionary(sample, level, dict.Data)
+			if err != nil {
+				return err
+			}
+			original += int64(len(sample))
+			plain += int64(len(compressedPlain))
+			withDict += int64(len(compressedDict))
+		}
+		fmt.Printf("Sampled files: %s, zstd alone: %s, with dictionary: %s\n",
+			util.HumanReadableSize(original), util.HumanReadableSize(plain), util.HumanReadableSize(withDict))
+		if withDict >= plain {
+			return fmt.Errorf("the dictionary does not improve compression of the sampled files; not saved")
+		}
+
+		if err := chunker.SaveDictionary(vaultRoot, dict, opts); err != nil {
+			return err
+		}
+		vaultConfig.CompressionDict = &config.CompressionDictConfig{ID: dict.ID, MaxFileSize: maxFileSizeFlag}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to update vault configuration: %v", err)
+		}
+
+		fmt.Printf("✓ Trained dictionary %s (%s); files up to %s are now compressed with it\n",
+			dict.ID, util.HumanReadableSize(int64(len(dict.Data))), util.HumanReadableSize(maxFileSize))
+		return nil
+	},
+}
+
+// compressListDictsCmd lists the vault's dictionaries
+var compressListDictsCmd = &cobra.Command{
+	Use:          "list-dicts",
+	Short:        "List compression dictionaries",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		infos, err := dictionary.List(vaultRoot, *vaultConfig)
+		if err != nil {
+			return err
+		}
+		if len(infos) == 0 {
+			fmt.Println("No compression dictionaries. Train one with 'sietch compress train-dict'.")
+			return nil
+		}
+		for _, info := range infos {
+			size := "missing"
+			if info.Size >= 0 {
+				size = util.HumanReadableSize(info.Size)
+			}
+			line := fmt.Sprintf("%s  %-10s  %d chunk(s)", info.ID, size, info.References)
+			if info.Active {
+				line += fmt.Sprintf("  active (files up to %s)", vaultConfig.CompressionDict.MaxFileSize)
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+// compressDeleteDictCmd deletes a dictionary no chunk uses
+var compressDeleteDictCmd = &cobra.Command{
+	Use:   "delete-dict <id>",
+	Short: "Delete a compression dictionary",
+	Long: `Delete a compression dictionary. Dictionaries that chunks were compressed
+with, in the live vault or in snapshots, cannot be deleted, nor can the active
+dictionary.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		if err := dictionary.Delete(vaultRoot, *vaultConfig, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Deleted dictionary %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compressCmd)
+	compressCmd.AddCommand(compressStatsCmd)
+	compressCmd.AddCommand(compressTrainDictCmd)
+	compressCmd.AddCommand(compressListDictsCmd)
+	compressCmd.AddCommand(compressDeleteDictCmd)
+
+	compressStatsCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+
+	compressTrainDictCmd.Flags().String("max-file-size", dictionary.DefaultMaxFileSize, "Largest file sampled and compressed with the dictionary")
+	compressTrainDictCmd.Flags().String("dict-size", dictionary.DefaultSize, "Largest dictionary to train")
+	compressTrainDictCmd.Flags().Int("samples", dictionary.DefaultSamples, "Most files to sample")
+	compressTrainDictCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	compressTrainDictCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
@@ -0,0 +1,330 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// configCmd groups commands that inspect and change the vault configuration
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and change the vault configuration",
+	Long: `Inspect and change settings stored in the vault's vault.yaml.
+
+Example:
+  sietch config get compression
+  sietch config set deduplication.min_chunk_size 8KB
+  sietch config chunk-policy test photos/IMG_0001.jpg
+  sietch config compression test reports/q3.csv
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// configGetCmd prints one vault.yaml setting
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a vault setting",
+	Long: `Print a setting from vault.yaml, named by its dotted YAML key.
+
+Lists of strings are printed comma separated; whole sections such as
+"deduplication" are printed as YAML. With --output json the key and its
+value are printed as a JSON object, sections as nested objects.
+
+Keys may also be written in camelCase, and "dedup" stands for
+"deduplication" (dedup.gcThreshold is deduplication.gc_threshold).
+
+Example:
+  sietch config get compression
+  sietch config get chunking.hash_algorithm
+  sietch config get deduplication --output json`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		if outputFormat == "json" {
+			value, err := config.GetSettingValue(vaultConfig, args[0])
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(map[string]any{"key": config.CanonicalSettingKey(args[0]), "value": value}, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode setting: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		value, err := config.GetSetting(vaultConfig, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+// configSetCmd changes one vault.yaml setting
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a vault setting",
+	Long: `Change a setting in vault.yaml without editing the file by hand.
+
+The value is validated and the configuration is rewritten through the same
+path as the other vault commands. Settings that would make existing data
+unreadable are refused: the hash algorithm can only change before anything is
+added, and encryption and vault identity settings cannot be changed at all.
+New settings apply to files added afterwards; existing files keep the
+compression and chunking they were stored with.
+
+Settable keys:
+  ` + strings.Join(config.SettableKeys(), "\n  ") + `
+
+Lists (metadata.tags) are given comma separated.
+
+Example:
+  sietch config set compression zstd
+  sietch config set deduplication.min_chunk_size 8KB
+  sietch config set metadata.tags photos,archive`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, value := args[0], args[1]
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		previous, err := config.GetSetting(vaultConfig, key)
+		if err != nil {
+			return err
+		}
+		if err := config.SetSetting(vaultRoot, vaultConfig, key, value); err != nil {
+			return err
+		}
+		current, _ := config.GetSetting(vaultConfig, key)
+		if current == previous {
+			fmt.Printf("%s is already %s\n", key, current)
+			return nil
+		}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save configuration: %v", err)
+		}
+
+		if previous == "" {
+			previous = "(unset)"
+		}
+		fmt.Printf("✓ %s: %s → %s\n", key, previous, current)
+		return nil
+	},
+}
+
+// configChunkPolicyCmd groups chunking policy helpers
+var configChunkPolicyCmd = &cobra.Command{
+	Use:   "chunk-policy",
+	Short: "Work with per-pattern chunking policies",
+	Long: `Per-pattern chunking policies live under chunking.policies in vault.yaml:
+
+  chunking:
+    strategy: fixed
+    chunk_size: 4MB
+    policies:
+      - pattern: "*.jpg"
+        strategy: fixed
+        chunk_size: 8MB
+      - pattern: "*.sql"
+        strategy: cdc
+        chunk_size: 512KB
+
+Policies are evaluated in order when files are added and the first match wins.
+Patterns without a "/" match the file name, others the full vault path.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// configChunkPolicyTestCmd shows which chunking policy applies to a file name
+var configChunkPolicyTestCmd = &cobra.Command{
+	Use:   "test <filename>",
+	Short: "Show which chunking policy applies to a file",
+	Long: `Show which chunking policy 'sietch add' would use for a file.
+
+The filename is matched as a vault path (e.g. photos/IMG_0001.jpg) and does
+not need to exist. Every matching rule is listed so shadowed rules are easy
+to spot; only the first one is used.
+
+Example:
+  sietch config chunk-policy test backups/db.sql`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		return displayChunkPolicyTest(*vaultConfig, args[0])
+	},
+}
+
+// displayChunkPolicyTest prints the winning policy and any rules it shadows
+func displayChunkPolicyTest(vaultConfig config.VaultConfig, filePath string) error {
+	chunking := vaultConfig.Chunking
+	if err := chunk.ValidatePolicies(chunking.Policies); err != nil {
+		return fmt.Errorf("invalid chunking policy in vault configuration: %v", err)
+	}
+	policy, err := chunk.ResolvePolicyForVault(vaultConfig, filePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("File: %s\n", filePath)
+	matches := chunk.MatchingPolicies(chunking.Policies, filePath)
+	if len(matches) == 0 {
+		fmt.Printf("No policy matches; vault default applies: %s, %s chunks\n",
+			policy.Strategy, util.HumanReadableSize(policy.ChunkSize))
+		return nil
+	}
+
+	fmt.Printf("Rule %d wins: %s → %s, %s chunks\n",
+		matches[0]+1, policy.Pattern, policy.Strategy, util.HumanReadableSize(policy.ChunkSize))
+	if len(matches) > 1 {
+		fmt.Println("Also matched (ignored, first match wins):")
+		for _, i := range matches[1:] {
+			fmt.Printf("  rule %d: %s\n", i+1, chunking.Policies[i].Pattern)
+		}
+	}
+	return nil
+}
+
+// configCompressionCmd groups compression policy helpers
+var configCompressionCmd = &cobra.Command{
+	Use:   "compression",
+	Short: "Work with per-pattern compression policies",
+	Long: `Per-pattern compression policies live under compression_policies in vault.yaml:
+
+  compression: gzip
+  compression_policies:
+    - pattern: "*.txt"
+      compression: zstd
+      level: 9
+    - pattern: "*.csv"
+      compression: zstd
+      level: 9
+    - pattern: "*.jpg"
+      compression: none
+    - pattern: "*.mp4"
+      compression: none
+
+Policies are evaluated in order when files are added and the first match wins;
+files no policy matches use the vault's compression. Patterns without a "/"
+match the file name, others the full vault path. Each chunk records the
+algorithm it was stored with, so changing the policies only affects files
+added afterwards. Files small enough to go into a pack use the vault's
+compression.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// configCompressionTestCmd shows which compression policy applies to a file name
+var configCompressionTestCmd = &cobra.Command{
+	Use:   "test <filename>",
+	Short: "Show which compression policy applies to a file",
+	Long: `Show which compression 'sietch add' would use for a file.
+
+The filename is matched as a vault path (e.g. reports/q3.csv) and does not
+need to exist. Every matching rule is listed so shadowed rules are easy to
+spot; only the first one is used.
+
+Example:
+  sietch config compression test photos/IMG_0001.jpg`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		return displayCompressionTest(*vaultConfig, args[0])
+	},
+}
+
+// displayCompressionTest prints the winning compression policy and any rules it shadows
+func displayCompressionTest(vaultConfig config.VaultConfig, filePath string) error {
+	if err := chunk.ValidateCompressionPolicies(vaultConfig.CompressionPolicies); err != nil {
+		return fmt.Errorf("invalid compression policy in vault configuration: %v", err)
+	}
+	// Small files use the vault's dictionary; that depends on the size of the
+	// file, if it exists
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
+	}
+	choice := chunk.ResolveCompression(vaultConfig, filePath, size)
+
+	fmt.Printf("File: %s\n", filePath)
+	matches := chunk.MatchingCompressionPolicies(vaultConfig.CompressionPolicies, filePath)
+	if len(matches) == 0 {
+		fmt.Printf("No policy matches; vault default applies: %s\n", choice)
+		return nil
+	}
+
+	fmt.Printf("Rule %d wins: %s → %s\n", matches[0]+1, choice.Pattern, choice)
+	if len(matches) > 1 {
+		fmt.Println("Also matched (ignored, first match wins):")
+		for _, i := range matches[1:] {
+			fmt.Printf("  rule %d: %s\n", i+1, vaultConfig.CompressionPolicies[i].Pattern)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configGetCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configChunkPolicyCmd)
+	configChunkPolicyCmd.AddCommand(configChunkPolicyTestCmd)
+	configCmd.AddCommand(configCompressionCmd)
+	configCompressionCmd.AddCommand(configCompressionTestCmd)
+}
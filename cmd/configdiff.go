@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/scaffold"
+)
+
+// configDiffCmd compares the vault's settings with a template or another vault
+var configDiffCmd = &cobra.Command{
+	Use:   "diff (--template <name> | --against <path|name>)",
+	Short: "Compare the vault's settings with a template or another vault",
+	Long: `Show field by field how the vault's chunking, compression, deduplication, sync
+and encryption settings differ from the current version of a template, or from
+another vault given by path or registered name (--vault still selects the
+vault being compared).
+
+Each difference is marked with how the vault can adopt the other value:
+
+  in-place   'sietch config set' changes it; files added afterwards follow
+             (and 'sietch vault recompress' rewrites stored chunks for compression)
+  rechunk    'sietch vault rechunk' rewrites the stored files
+  reencrypt  only a new vault can have it; move the files over
+  manual     edit vault.yaml; files added afterwards follow
+
+With --output json the differences are printed as change records.
+
+Example:
+  sietch config diff --template photoVault
+  sietch config diff --against /media/usb/photos-backup
+  sietch --vault photos config diff --against archive -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		templateName, _ := cmd.Flags().GetString("template")
+		against, _ := cmd.Flags().GetString("against")
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+		if (templateName == "") == (against == "") {
+			return fmt.Errorf("give either --template or --against")
+		}
+
+		vaultRoot, vaultConfig, err := loadCurrentVaultConfig()
+		if err != nil {
+			return err
+		}
+
+		var other *config.VaultConfig
+		var otherName string
+		keys := config.VaultDiffKeys
+		if templateName != "" {
+			if other, otherName, err = loadTemplateVaultConfig(templateName); err != nil {
+				return err
+			}
+			keys = config.TemplateDiffKeys
+		} else {
+			otherRoot, err := resolveVaultName(against)
+			if err != nil {
+				return err
+			}
+			if !fs.IsVaultInitialized(otherRoot) {
+				return fmt.Errorf("%s is not a vault", against)
+			}
+			if other, err = config.LoadVaultConfig(otherRoot); err != nil {
+				return fmt.Errorf("failed to load the configuration of %s: %v", against, err)
+			}
+			otherName = "vault " + otherRoot
+		}
+
+		changes, err := config.DiffSettings(vaultConfig, other, keys)
+		if err != nil {
+			return err
+		}
+		if outputFormat == "json" {
+			report := struct {
+				Vault   string                 `json:"vault"`
+				Other   string                 `json:"other"`
+				Changes []config.SettingChange `json:"changes"`
+			}{Vault: vaultRoot, Other: otherName, Changes: changes}
+			if report.Changes == nil {
+				report.Changes = []config.SettingChange{}
+			}
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode diff: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		displayConfigDiff(vaultConfig.Name, otherName, changes)
+		return nil
+	},
+}
+
+// loadTemplateVaultConfig returns the configuration a template gives a new
+// vault, fetching remote templates as scaffold does
+func loadTemplateVaultConfig(templateName string) (*config.VaultConfig, string, error) {
+	if err := scaffold.EnsureConfigDirectories(); err != nil {
+		return nil, "", fmt.Errorf("failed to ensure config directories: %v", err)
+	}
+	if err := scaffold.EnsureDefaultTemplates(); err != nil {
+		return nil, "", fmt.Errorf("failed to ensure default templates: %v", err)
+	}
+	if scaffold.IsRemoteTemplate(templateName) {
+		cachedName, err := scaffold.FetchRemoteTemplate(templateName)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to fetch remote template: %v", err)
+		}
+		templateName = cachedName
+	}
+	template, err := scaffold.LoadTemplate(templateName)
+	if err != nil {
+		return nil, "", err
+	}
+	configuration := templateVaultConfig(template, "", template.Name, "", "", template.Config.Passphrase, nil)
+	return &configuration, fmt.Sprintf("template %s (v%s)", template.Name, template.Version), nil
+}
+
+// displayConfigDiff prints the differences grouped by section
+func displayConfigDiff(vaultName, otherName string, changes []config.SettingChange) {
+	if len(changes) == 0 {
+		fmt.Printf("✓ %s has the same settings as %s\n", vaultName, otherName)
+		return
+	}
+	fmt.Printf("Comparing %s with %s (this vault → other):\n", vaultName, otherName)
+
+	section := ""
+	counts := make(map[string]int)
+	for _, change := range changes {
+		if change.Section != section {
+			section = change.Section
+			fmt.Printf("\n%s\n", section)
+		}
+		name := strings.TrimPrefix(change.Key, section+".")
+		value, other := diffValue(change.Value), diffValue(change.Other)
+		if strings.Contains(value+other, "\n") {
+			fmt.Printf("  %s:\n    this vault:\n%s    other:\n%s", name, indentLines(value, "      "), indentLines(other, "      "))
+		} else {
+			fmt.Printf("  %s: %s → %s\n", name, value, other)
+		}
+		fmt.Printf("      %s: %s\n", change.Migration, change.Hint)
+		counts[change.Migration]++
+	}
+
+	var summary []string
+	for _, migration := range []string{config.MigrateInPlace, config.MigrateRechunk, config.MigrateReencrypt, config.MigrateManual} {
+		if counts[migration] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[migration], migration))
+		}
+	}
+	fmt.Printf("\n%d differences: %s\n", len(changes), strings.Join(summary, ", "))
+}
+
+// diffValue formats a setting value for the text diff
+func diffValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "(unset)"
+	case string:
+		return displaySetting(v)
+	case []any, map[string]any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// indentLines prefixes every line of s
+func indentLines(s, prefix string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		b.WriteString(prefix + line + "\n")
+	}
+	return b.String()
+}
+
+func init() {
+	configCmd.AddCommand(configDiffCmd)
+	configDiffCmd.Flags().String("template", "", "Template to compare with, as given to 'sietch scaffold'")
+	configDiffCmd.Flags().String("against", "", "Other vault to compare with, by path or registered name")
+	configDiffCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	_ = configDiffCmd.RegisterFlagCompletionFunc("template", completeTemplateNames)
+}
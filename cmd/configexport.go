@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
+)
+
+// configExportCmd prints the vault configuration, optionally without secrets
+var configExportCmd = &cobra.Command{
+	Use:   "export [output]",
+	Short: "Export the vault configuration, optionally without its secrets",
+	Long: `Write the vault's whole configuration as YAML: vault.yaml with the key
+paths, KDF salts, key checks, wrapped keys and sync private key path from
+.sietch/secrets.yaml filled back in.
+
+With --sanitized those secrets are left out, giving the half that can be
+shared or committed to git for review. It works the same for vaults whose
+vault.yaml still holds its secrets. Without an output the YAML goes to stdout;
+a file written without --sanitized is readable by its owner only.
+
+Example:
+  sietch config export --sanitized vault.public.yaml
+  sietch config export --sanitized | diff - ../other-vault/vault.yaml`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sanitized, _ := cmd.Flags().GetBool("sanitized")
+		_, vaultConfig, err := loadCurrentVaultConfig()
+		if err != nil {
+			return err
+		}
+		data, err := config.ExportVaultConfig(vaultConfig, sanitized)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 || args[0] == "-" {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		if sanitized {
+			err = atomic.WriteFile(args[0], data, 0o644)
+		} else {
+			err = private.WriteFileAtomic(args[0], data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write export file: %v", err)
+		}
+		if sanitized {
+			fmt.Printf("Exported the configuration of %s without secrets to %s\n", vaultConfig.Name, args[0])
+		} else {
+			fmt.Printf("Exported the configuration of %s, secrets included, to %s\n", vaultConfig.Name, args[0])
+		}
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configExportCmd)
+	configExportCmd.Flags().Bool("sanitized", false, "Leave out key paths, salts, wrapped keys and other secrets")
+}
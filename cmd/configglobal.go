@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// configGlobalCmd groups commands that edit the user's global config
+var configGlobalCmd = &cobra.Command{
+	Use:   "global",
+	Short: "Inspect and change defaults in the global config",
+	Long: `Inspect and change the command defaults kept in ~/.config/sietch/config.yaml.
+
+A flag given on the command line wins over its SIETCH_* environment variable,
+which wins over the global config:
+
+  vault            --vault            SIETCH_VAULT
+  passphrase_file  --passphrase-file  SIETCH_PASSPHRASE_FILE
+  jobs             --jobs             SIETCH_JOBS
+
+New vaults made by init and scaffold take these defaults; cipher and
+compression apply to init only:
+
+  default_vault_path  --path         SIETCH_DEFAULT_VAULT_PATH
+  author              --author       SIETCH_AUTHOR
+  cipher              --key-type     SIETCH_CIPHER
+  compression         --compression  SIETCH_COMPRESSION
+
+Example:
+  sietch config global set passphrase_file ~/.sietch-pass
+  sietch config global set jobs 4
+  sietch config global set default_vault_path ~/vaults
+  sietch config global get vault`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// configGlobalGetCmd prints one global setting
+var configGlobalGetCmd = &cobra.Command{
+	Use:          "get <key>",
+	Short:        "Print a global setting",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	ValidArgs:    config.GlobalSettingKeys(),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		global, err := config.LoadGlobalConfig()
+		if err != nil {
+			return err
+		}
+		value, err := config.GetGlobalSetting(global, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+// configGlobalSetCmd changes one global setting
+var configGlobalSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a global setting",
+	Long: `Change a setting in ~/.config/sietch/config.yaml, creating the file if needed.
+Relative paths are stored as absolute paths, and an empty value ("") removes
+the setting.
+
+Keys:
+  ` + strings.Join(config.GlobalSettingKeys(), "\n  ") + `
+
+Example:
+  sietch config global set vault ~/vaults/photos
+  sietch config global set jobs ""`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	ValidArgs:    config.GlobalSettingKeys(),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, value := config.CanonicalSettingKey(args[0]), args[1]
+		global, err := config.LoadGlobalConfig()
+		if err != nil {
+			return err
+		}
+		previous, err := config.GetGlobalSetting(global, key)
+		if err != nil {
+			return err
+		}
+		if err := config.SetGlobalSetting(global, key, value); err != nil {
+			return err
+		}
+		current, _ := config.GetGlobalSetting(global, key)
+		if current == previous {
+			fmt.Printf("%s is already %s\n", key, displaySetting(current))
+			return nil
+		}
+		if err := config.SaveGlobalConfig(global); err != nil {
+			return fmt.Errorf("failed to save global config: %v", err)
+		}
+		fmt.Printf("✓ %s: %s → %s\n", key, displaySetting(previous), displaySetting(current))
+		return nil
+	},
+}
+
+// configEffectiveCmd shows the value each command default resolves to
+var configEffectiveCmd = &cobra.Command{
+	Use:   "effective",
+	Short: "Show the command defaults in effect",
+	Long: `Show the value each configurable flag takes when it is not given on the
+command line, resolved from the SIETCH_* environment variables, the global
+config (~/.config/sietch/config.yaml) and the built-in defaults, in that order.
+With --show-origin each value is followed by where it came from.
+
+Example:
+  sietch config effective --show-origin
+  SIETCH_JOBS=8 sietch config effective --show-origin`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showOrigin, _ := cmd.Flags().GetBool("show-origin")
+		global, globalPath, err := loadGlobalConfig()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, d := range flagDefaults {
+			resolved := resolveFlag(d, lookupFlag(cmd, d), global, globalPath)
+			if !showOrigin {
+				fmt.Fprintf(w, "%s\t%s\n", d.key, displaySetting(resolved.value))
+				continue
+			}
+			origin := resolved.origin
+			if resolved.source != "" {
+				origin += " " + resolved.source
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", d.key, displaySetting(resolved.value), origin)
+		}
+		return w.Flush()
+	},
+}
+
+// displaySetting shows an empty setting as "(unset)"
+func displaySetting(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
+
+func init() {
+	configCmd.AddCommand(configGlobalCmd)
+	configGlobalCmd.AddCommand(configGlobalGetCmd)
+	configGlobalCmd.AddCommand(configGlobalSetCmd)
+	configCmd.AddCommand(configEffectiveCmd)
+	configEffectiveCmd.Flags().Bool("show-origin", false, "Show where each value comes from")
+}
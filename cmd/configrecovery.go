@@ -0,0 +1,64 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// recoverVaultConfig restores a damaged vault.yaml from its latest usable
+// backup before the command runs, after asking on a terminal or right away
+// with --auto-recover. Outside a vault it does nothing.
+func recoverVaultConfig(cmd *cobra.Command) error {
+	if cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd {
+		// Completing a command line must never prompt
+		return nil
+	}
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil || !fs.IsVaultInitialized(vaultRoot) {
+		return nil
+	}
+	damaged := config.CheckVaultConfig(vaultRoot)
+	if !errors.Is(damaged, config.ErrDamagedConfig) {
+		// Anything else is reported by the command when it loads the vault
+		return nil
+	}
+
+	autoRecover, _ := cmd.Flags().GetBool("auto-recover")
+	if !autoRecover {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("%v; run again with --auto-recover to restore it from the latest backup", damaged)
+		}
+		fmt.Fprintf(os.Stderr, "%v\n", damaged)
+		restore, err := util.ConfirmOverwrite("Restore vault.yaml from the latest valid backup?", os.Stdin, os.Stderr)
+		if err != nil || !restore {
+			return damaged
+		}
+	}
+
+	if heldLock == nil {
+		// Commands that only read run unlocked, but vault.yaml is restored under the lock
+		l, err := lock.Acquire(vaultRoot, lock.Exclusive, cmd.CommandPath())
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+	backup, err := config.RestoreVaultConfig(vaultRoot)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Restored vault.yaml from %s; the damaged file is kept as vault.yaml.damaged\n", backup)
+	return nil
+}
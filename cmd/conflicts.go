@@ -0,0 +1,217 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// conflictsCmd groups commands that manage the files sync found changed both
+// here and on a peer
+var conflictsCmd = &cobra.Command{
+	Use:     "conflicts",
+	Aliases: []string{"conflict"},
+	Short:   "Manage files changed both here and on a sync peer",
+	Long: `Manage the files sync found changed both in this vault and on a peer since
+they last synced.
+
+With the manual conflict strategy (the default; see 'sietch sync --conflict')
+sync records such files and stops before transferring anything. Pick the
+version to keep with 'sietch conflicts resolve'; the next sync with the peer
+applies it, as long as neither side changed the file again.
+
+Example:
+  sietch conflicts list
+  sietch conflicts resolve docs/notes.txt --keep both
+  sietch conflicts resolve --all --keep local`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// conflictsListCmd shows the recorded conflicts
+var conflictsListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the files changed both here and on a peer",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		conflicts, err := p2p.LoadConflicts(vaultRoot)
+		if err != nil {
+			return err
+		}
+		peerFilter, _ := cmd.Flags().GetString("peer")
+		conflicts = slices.DeleteFunc(conflicts, func(c p2p.Conflict) bool {
+			return peerFilter != "" && c.Peer != peerFilter && c.PeerName != peerFilter
+		})
+
+		if outputFormat == "json" {
+			if conflicts == nil {
+				conflicts = []p2p.Conflict{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(conflicts)
+		}
+		if len(conflicts) == 0 {
+			fmt.Println("No sync conflicts.")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tPEER\tDETECTED\tLOCAL\tPEER VERSION\tRESOLUTION")
+		for _, c := range conflicts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.DisplayPath(), c.DisplayPeer(),
+				c.Detected.Local().Format("2006-01-02 15:04"), describeVersion(c.Local), describeVersion(c.Remote),
+				describeResolution(c.Resolution))
+		}
+		return w.Flush()
+	},
+}
+
+// conflictsResolveCmd records which version of conflicting files to keep
+var conflictsResolveCmd = &cobra.Command{
+	Use:   "resolve [path...]",
+	Short: "Pick the version to keep of files changed both here and on a peer",
+	Long: `Record which version of conflicting files to keep. The next sync with the
+peer applies it, as long as neither side changed the file again:
+
+  local  keep this vault's version
+  peer   replace it with the peer's version
+  both   keep this vault's version and store the peer's beside it, as
+         <name>.conflict-<peer>-<date> (not for encrypted paths)
+
+Files are named by their vault path, or by the identity 'sietch conflicts
+list -o json' shows for encrypted paths. --all picks every recorded conflict,
+or those with one peer with --peer.
+
+Example:
+  sietch conflicts resolve docs/notes.txt --keep peer
+  sietch conflicts resolve --all --peer laptop --keep both`,
+	SilenceUsage:      true,
+	ValidArgsFunction: completeConflicts,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keep, _ := cmd.Flags().GetString("keep")
+		all, _ := cmd.Flags().GetBool("all")
+		peerFilter, _ := cmd.Flags().GetString("peer")
+		if !slices.Contains(p2p.Resolutions, keep) {
+			return fmt.Errorf("--keep must be one of %s", strings.Join(p2p.Resolutions, ", "))
+		}
+		if all == (len(args) > 0) {
+			return fmt.Errorf("give the paths of the conflicts to resolve, or --all")
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		conflicts, err := p2p.LoadConflicts(vaultRoot)
+		if err != nil {
+			return err
+		}
+
+		matched := make(map[string]bool, len(args))
+		resolved := 0
+		for i := range conflicts {
+			c := &conflicts[i]
+			if peerFilter != "" && c.Peer != peerFilter && c.PeerName != peerFilter {
+				continue
+			}
+			if !all {
+				arg := slices.IndexFunc(args, func(arg string) bool {
+					return arg == c.Path || arg == c.Identity
+				})
+				if arg < 0 {
+					continue
+				}
+				matched[args[arg]] = true
+			}
+			if keep == p2p.ResolveBoth && c.Path == "" {
+				return fmt.Errorf("%s has an encrypted path, so the peer's version cannot be stored beside it; keep local or peer", c.DisplayPath())
+			}
+			c.Resolution = keep
+			resolved++
+			fmt.Printf("✓ %s: %s at the next sync with %s\n", c.DisplayPath(), describeResolution(keep), c.DisplayPeer())
+		}
+		for _, arg := range args {
+			if !matched[arg] {
+				return fmt.Errorf("no sync conflict recorded for %s; see 'sietch conflicts list'", arg)
+			}
+		}
+		if resolved == 0 {
+			fmt.Println("No sync conflicts to resolve.")
+			return nil
+		}
+		return p2p.SaveConflicts(vaultRoot, conflicts)
+	},
+}
+
+// describeVersion shows one side's version of a conflicting file
+func describeVersion(v p2p.ConflictVersion) string {
+	modTime, err := time.Parse(time.RFC3339Nano, v.ModTime)
+	if err != nil {
+		return util.HumanReadableSize(v.Size)
+	}
+	return fmt.Sprintf("%s, modified %s", util.HumanReadableSize(v.Size), modTime.Local().Format("2006-01-02 15:04"))
+}
+
+// describeResolution shows how a conflict is resolved
+func describeResolution(resolution string) string {
+	switch resolution {
+	case p2p.ResolveLocal:
+		return "keep local"
+	case p2p.ResolvePeer:
+		return "take the peer's"
+	case p2p.ResolveBoth:
+		return "keep both"
+	}
+	return "unresolved"
+}
+
+// completeConflicts completes the paths of the recorded conflicts
+func completeConflicts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	conflicts, _ := p2p.LoadConflicts(vaultRoot)
+	var paths []string
+	for _, c := range conflicts {
+		if c.Path != "" && !slices.Contains(args, c.Path) {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	rootCmd.AddCommand(conflictsCmd)
+	conflictsCmd.AddCommand(conflictsListCmd)
+	conflictsCmd.AddCommand(conflictsResolveCmd)
+	conflictsListCmd.Flags().String("peer", "", "Only list the conflicts with this peer (name or ID)")
+	conflictsListCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	conflictsResolveCmd.Flags().String("keep", "", "Version to keep: local, peer or both")
+	conflictsResolveCmd.Flags().Bool("all", false, "Resolve every recorded conflict")
+	conflictsResolveCmd.Flags().String("peer", "", "Only resolve the conflicts with this peer (name or ID)")
+	_ = conflictsResolveCmd.MarkFlagRequired("keep")
+}
@@ -0,0 +1,114 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/clone"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// copyCmd clones the vault to another local directory
+var copyCmd = &cobra.Command{
+	Use:     "copy <destination>",
+	Aliases: []string{"clone"},
+	Short:   "Copy the vault to another local directory",
+	Long: `Copy the vault to another directory on this machine, such as an external drive.
+
+The copy holds the file manifests, snapshots, dedup index, keys and every chunk
+and pack they reference; unreferenced chunks are left behind. The destination
+must be absent, empty or an earlier copy of the same vault. Copying to an
+earlier copy only writes the chunks it lacks and the metadata that changed,
+and removes the manifests of files deleted since, so the same drive can take
+incremental backups.
+
+Afterwards a random sample of the copied chunks is read back and checked
+against their hashes (--verify-sample, 0 to skip, -1 for all). A first copy is
+registered like a new vault, so --vault can name it.
+
+Example:
+  sietch copy /media/usb/photos-backup
+  sietch --vault photos copy /media/usb/photos-backup --verify-sample -1`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verifySample, _ := cmd.Flags().GetInt("verify-sample")
+		dest, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid destination: %v", err)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		if _, err := clone.CheckDestination(vaultRoot, dest); err != nil {
+			return err
+		}
+		if destConfig, err := config.LoadVaultConfig(dest); err == nil && destConfig.ReadOnly {
+			return fmt.Errorf("the copy at %s is frozen; run 'sietch vault thaw --vault %s' to update it", dest, dest)
+		}
+		if err := os.MkdirAll(filepath.Join(dest, ".sietch"), 0o755); err != nil {
+			return fmt.Errorf("failed to create destination: %v", err)
+		}
+		destLock, err := lock.Acquire(dest, lock.Exclusive, cmd.CommandPath())
+		if err != nil {
+			return fmt.Errorf("destination: %w", err)
+		}
+		defer destLock.Release()
+
+		fmt.Printf("📦 Copying %s (%s) to %s\n", vaultConfig.Name, vaultRoot, dest)
+		start := time.Now()
+		result, err := clone.Copy(vaultRoot, dest, clone.Options{VerifySample: verifySample})
+		if result == nil {
+			return err
+		}
+
+		fmt.Printf("   Chunks copied:   %d (%d already there)\n", result.ChunksCopied, result.ChunksSkipped)
+		if result.PacksCopied+result.PacksSkipped > 0 {
+			fmt.Printf("   Packs copied:    %d (%d already there)\n", result.PacksCopied, result.PacksSkipped)
+		}
+		fmt.Printf("   Metadata files:  %d written, %d removed\n", result.FilesCopied, result.FilesRemoved)
+		fmt.Printf("   Data written:    %s in %s\n", util.HumanReadableSize(result.BytesCopied), time.Since(start).Round(time.Millisecond))
+		if err != nil {
+			return err
+		}
+		if result.Verified > 0 {
+			fmt.Printf("✓ Verified %d chunks at the destination\n", result.Verified)
+		}
+		if vaultConfig.ReadOnly {
+			// The copy of a frozen vault is frozen too
+			if err := setVaultStoreWritable(dest, false); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not make the copy's files read-only: %v\n", err)
+			}
+		}
+		if result.Fresh {
+			registerVault(vaultConfig, dest)
+		}
+		if len(result.Missing) > 0 {
+			return fmt.Errorf("%d referenced chunks are missing from the source and were not copied; run 'sietch fsck' on it", len(result.Missing))
+		}
+		fmt.Println("✅ Copy complete")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(copyCmd)
+	copyCmd.Flags().Int("verify-sample", 100, "Chunks to read back and check at the destination (0 skips, -1 checks all)")
+}
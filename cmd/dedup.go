@@ -4,14 +4,28 @@ Copyright © 2025 SubstantialCattle5, nilaysharan.com
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 
+	"github.com/substantialcattle5/sietch/internal/chunk"
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/deduplication"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/pack"
+	"github.com/substantialcattle5/sietch/internal/sharedstore"
+	"github.com/substantialcattle5/sietch/internal/ui"
 	"github.com/substantialcattle5/sietch/util"
 )
 
@@ -25,9 +39,21 @@ This command provides subcommands for:
 - Getting deduplication statistics
 - Running garbage collection
 - Optimizing storage
+- Exporting chunk hints for seeding another vault
+- Estimating how much of a directory is new before adding it
 
 You can also configure deduplication settings interactively using the --setup flag.
 
+The strategy (deduplication.strategy, chosen with init --dedup-strategy or
+changed with config set) decides what is reused:
+  content  Identical chunks are reused across all files. The most savings, also
+           for files that only share part of their content; every chunk is
+           looked up in the dedup index.
+  file     Only files whose whole content is identical share chunks. Each file
+           is read once more to hash it, but the index stays empty and files
+           that merely overlap are stored in full.
+  none     Every file's chunks are stored anew.
+
 Example:
   sietch dedup --setup   # Configure deduplication settings interactively
   sietch dedup stats     # Show deduplication statistics
@@ -133,18 +159,35 @@ Example:
 var dedupStatsCmd = &cobra.Command{
 	Use:   "stats",
 	Short: "Show deduplication statistics",
-	Long: `Display detailed statistics about deduplication in your vault.
+	Long: `Display what deduplication actually saves in your vault.
 
-This includes:
-- Total number of chunks
-- Total storage size
-- Space saved through deduplication
-- Number of unreferenced chunks
+The report is computed from the file manifests and the chunk store:
+- Logical bytes (sum of file sizes) and unique chunk bytes stored
+- Deduplication ratio and space saved
+- The files that save the most through shared chunks
+- How many chunks are shared by 1, 2, ... N files
+- Index statistics, including unreferenced chunks
 
 Example:
   sietch dedup stats
+  sietch dedup stats --since 2025-01-01
+  sietch dedup stats --output json
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+
+		var since *time.Time
+		if sinceFlag, _ := cmd.Flags().GetString("since"); sinceFlag != "" {
+			parsed, err := util.ParseDate(sinceFlag)
+			if err != nil {
+				return err
+			}
+			since = &parsed
+		}
+
 		vaultRoot, err := fs.FindVaultRoot()
 		if err != nil {
 			return fmt.Errorf("not inside a vault: %v", err)
@@ -167,31 +210,92 @@ Example:
 			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
 		}
 
-		// Get statistics
-		stats := dedupManager.GetStats()
-
-		// Display statistics
-		fmt.Printf("\nDeduplication Statistics:\n")
-		fmt.Printf("========================\n")
-		fmt.Printf("Deduplication enabled: %v\n", vaultConfig.Deduplication.Enabled)
-		fmt.Printf("Total chunks: %d\n", stats.TotalChunks)
-		fmt.Printf("Total size: %s\n", util.HumanReadableSize(stats.TotalSize))
-		fmt.Printf("Space saved: %s\n", util.HumanReadableSize(stats.SavedSpace))
-		fmt.Printf("Unreferenced chunks: %d\n", stats.UnreferencedChunks)
+		savings, err := deduplication.ComputeSavings(vaultRoot, since)
+		if err != nil {
+			return fmt.Errorf("failed to compute deduplication savings: %v", err)
+		}
 
-		if stats.TotalSize > 0 {
-			percentage := float64(stats.SavedSpace) / float64(stats.TotalSize+stats.SavedSpace) * 100
-			fmt.Printf("Deduplication ratio: %.2f%%\n", percentage)
+		report := dedupStatsReport{
+			Enabled: vaultConfig.Deduplication.Enabled,
+			Savings: savings,
+			Index:   dedupManager.GetStats(),
 		}
 
-		if stats.UnreferencedChunks > 0 {
-			fmt.Printf("\n⚠️  You have %d unreferenced chunks. Consider running 'sietch dedup gc' to clean them up.\n", stats.UnreferencedChunks)
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
 		}
 
+		displayDedupStats(report)
 		return nil
 	},
 }
 
+// dedupStatsReport is the output of 'sietch dedup stats'
+type dedupStatsReport struct {
+	Enabled bool                             `json:"enabled"`
+	Savings *deduplication.SavingsReport     `json:"savings"`
+	Index   deduplication.DeduplicationStats `json:"index"`
+}
+
+// displayDedupStats prints a human readable deduplication report
+func displayDedupStats(report dedupStatsReport) {
+	savings, stats := report.Savings, report.Index
+
+	fmt.Printf("\nDeduplication Statistics:\n")
+	fmt.Printf("========================\n")
+	fmt.Printf("Deduplication enabled: %v\n", report.Enabled)
+	if savings.Since != nil {
+		fmt.Printf("Files added since:     %s\n", savings.Since.Format("2006-01-02 15:04"))
+	}
+	fmt.Printf("Files:                 %d\n", savings.Files)
+	fmt.Printf("Logical size:          %s\n", util.HumanReadableSize(savings.LogicalBytes))
+	if savings.ZeroBytes > 0 {
+		fmt.Printf("Zero regions:          %s (not stored)\n", util.HumanReadableSize(savings.ZeroBytes))
+	}
+	fmt.Printf("Unique chunk data:     %s in %d chunks (%d references)\n",
+		util.HumanReadableSize(savings.UniqueBytes), savings.UniqueChunks, savings.References)
+	fmt.Printf("Stored on disk:        %s\n", util.HumanReadableSize(savings.StoredBytes))
+	fmt.Printf("Space saved:           %s\n", util.HumanReadableSize(savings.SavedBytes))
+	if savings.UniqueBytes > 0 {
+		fmt.Printf("Deduplication ratio:   %.2fx\n", savings.DedupRatio)
+	}
+
+	if len(savings.TopFiles) > 0 {
+		fmt.Printf("\nTop files by shared-chunk savings:\n")
+		fmt.Printf("  %-10s %-10s %-7s %s\n", "SAVED", "SIZE", "SHARED", "FILE")
+		for _, file := range savings.TopFiles {
+			fmt.Printf("  %-10s %-10s %-7d %s\n",
+				util.HumanReadableSize(file.SavedBytes), util.HumanReadableSize(file.Size), file.SharedChunks, file.File)
+		}
+	}
+
+	if len(savings.Sharing) > 0 {
+		fmt.Printf("\nChunks by number of files sharing them:\n")
+		for _, bucket := range savings.Sharing {
+			fmt.Printf("  %3d file(s): %d chunk(s)\n", bucket.Files, bucket.Chunks)
+		}
+	}
+
+	fmt.Printf("\nIndex: %d chunks, %s, %d unreferenced\n",
+		stats.TotalChunks, util.HumanReadableSize(stats.TotalSize), stats.UnreferencedChunks)
+	if len(stats.Scopes) > 0 {
+		fmt.Printf("\nBy dedup scope:\n")
+		for _, name := range sortedScopeNames(stats.Scopes) {
+			scope := stats.Scopes[name]
+			fmt.Printf("  %-12s %d chunks, %s, %s saved, %d unreferenced\n", name, scope.TotalChunks,
+				util.HumanReadableSize(scope.TotalSize), util.HumanReadableSize(scope.SavedSpace), scope.UnreferencedChunks)
+		}
+	}
+	if stats.UnreferencedChunks > 0 {
+		fmt.Printf("\n⚠️  You have %d unreferenced chunks. Consider running 'sietch dedup gc' to clean them up.\n", stats.UnreferencedChunks)
+	}
+}
+
 // dedupGcCmd runs garbage collection
 var dedupGcCmd = &cobra.Command{
 	Use:   "gc",
@@ -202,6 +306,14 @@ This command will:
 - Identify chunks that are not referenced by any file manifests
 - Remove these chunks from storage
 - Update the deduplication index
+- Remove unreferenced small-file packs and repack packs left mostly
+  empty by deletions
+- With packing.chunks set, move chunks smaller than packing.threshold into
+  chunk packs, and drop dead chunks from chunk packs the same way
+
+In a vault using a shared chunk store, a chunk is only removed once no vault
+registered with the store references it, and every registered vault must be
+reachable.
 
 Example:
   sietch dedup gc
@@ -223,36 +335,343 @@ Example:
 			return fmt.Errorf("failed to load vault configuration: %v", err)
 		}
 
-		if !vaultConfig.Deduplication.Enabled {
+		packIDs, err := layout.ListPackIDs(vaultRoot)
+		if err != nil {
+			return err
+		}
+		hasPacks := len(packIDs) > 0
+		chunkPackIDs, err := layout.ListChunkPackIDs(vaultRoot)
+		if err != nil {
+			return err
+		}
+		packChunks := vaultConfig.Packing.Chunks || len(chunkPackIDs) > 0
+
+		if !vaultConfig.Deduplication.Enabled && !hasPacks && !packChunks {
 			return fmt.Errorf("deduplication is not enabled in this vault")
 		}
 
-		// Initialize deduplication manager
-		dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		fmt.Println("Running garbage collection...")
+
+		store, err := sharedstore.ForVault(vaultRoot)
 		if err != nil {
-			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+			return fmt.Errorf("failed to open shared store: %v", err)
 		}
+		if store != nil {
+			if err := collectSharedStore(store, vaultRoot, vaultConfig); err != nil {
+				return err
+			}
+		} else if vaultConfig.Deduplication.Enabled {
+			// Initialize deduplication manager
+			dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+			if err != nil {
+				return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+			}
 
-		fmt.Println("Running garbage collection...")
+			// Run garbage collection
+			removedByScope, err := dedupManager.GarbageCollectScopes()
+			if err != nil {
+				return fmt.Errorf("garbage collection failed: %v", err)
+			}
+			removedChunks := 0
+			for _, count := range removedByScope {
+				removedChunks += count
+			}
+
+			// Save the updated index
+			if err := dedupManager.Save(); err != nil {
+				return fmt.Errorf("failed to save updated index: %v", err)
+			}
+
+			operationCounts.Chunks += removedChunks
+			fmt.Printf("✓ Garbage collection completed\n")
+			fmt.Printf("✓ Removed %d unreferenced chunks\n", removedChunks)
+			if len(vaultConfig.Deduplication.Scopes) > 0 {
+				for _, name := range sortedScopeNames(removedByScope) {
+					fmt.Printf("  %s: %d\n", name, removedByScope[name])
+				}
+			}
+		}
+
+		if hasPacks {
+			// Repacking decrypts packs, so encrypted vaults may need the passphrase
+			passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+			if err != nil {
+				return err
+			}
+
+			result, err := pack.Repack(vaultRoot, *vaultConfig, passphrase)
+			if err != nil {
+				return fmt.Errorf("repack failed: %v", err)
+			}
+
+			operationCounts.Bytes += result.BytesReclaimed
+			fmt.Printf("✓ Removed %d unreferenced packs\n", result.PacksRemoved)
+			if result.PacksRewritten > 0 {
+				fmt.Printf("✓ Repacked %d packs (%d files moved)\n", result.PacksRewritten, result.EntriesMoved)
+			}
+			if result.BytesReclaimed > 0 {
+				fmt.Printf("✓ Reclaimed %s\n", util.HumanReadableSize(result.BytesReclaimed))
+			}
+		}
+
+		if packChunks {
+			result, err := pack.RepackChunks(vaultRoot, *vaultConfig)
+			if err != nil {
+				return fmt.Errorf("chunk repack failed: %v", err)
+			}
+
+			operationCounts.Bytes += result.BytesReclaimed
+			if result.ChunksPacked > 0 {
+				fmt.Printf("✓ Packed %d small chunks\n", result.ChunksPacked)
+			}
+			fmt.Printf("✓ Removed %d unreferenced chunk packs\n", result.PacksRemoved)
+			if result.PacksRewritten > 0 {
+				fmt.Printf("✓ Repacked %d chunk packs (%d chunks moved)\n", result.PacksRewritten, result.ChunksMoved)
+			}
+			if result.BytesReclaimed > 0 {
+				fmt.Printf("✓ Reclaimed %s from chunk packs\n", util.HumanReadableSize(result.BytesReclaimed))
+			}
+		}
+
+		return nil
+	},
+}
+
+// dedupExportHintsCmd writes the vault's chunk hashes for seeding another vault
+var dedupExportHintsCmd = &cobra.Command{
+	Use:   "export-hints <output>",
+	Short: "Export the hashes and sizes of stored chunks for seeding another vault",
+	Long: `Write a compact file listing every chunk stored in this vault: its hash,
+size and how it is stored.
+
+In another vault holding much of the same data, 'sietch add --dedup-hints'
+uses the file to record chunks this vault already has as remote references
+instead of storing them. A following 'sietch sync' with this vault fetches
+them; until then, restoring a file with unfetched chunks fails. Both vaults
+must use the same hash algorithm, encryption and key.
+
+Example:
+  sietch dedup export-hints hints.bin
+  sietch add --dedup-hints hints.bin ~/photos vault/photos/   # in the new vault
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		hints, err := deduplication.ExportHints(vaultRoot, vaultConfig)
+		if err != nil {
+			return fmt.Errorf("failed to collect chunk hints: %v", err)
+		}
+		file, err := os.Create(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create hints file: %v", err)
+		}
+		if err := deduplication.WriteHints(file, hints); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write hints file: %v", err)
+		}
+
+		fmt.Printf("Exported hints for %d chunks (%s) to %s\n",
+			hints.Len(), util.HumanReadableSize(hints.TotalSize()), args[0])
+		return nil
+	},
+}
 
-		// Run garbage collection
-		removedChunks, err := dedupManager.GarbageCollect()
+// dedupExportCmd dumps the dedup index for analysis outside sietch
+var dedupExportCmd = &cobra.Command{
+	Use:   "export [output]",
+	Short: "Export the deduplication index as CSV or JSON lines",
+	Long: `Write one row per chunk in the deduplication index: its hash, size,
+reference count, whether its stored copy is compressed and with what, and its
+dedup scope. Load the file into a spreadsheet or notebook to see how chunk
+sizes and reuse are distributed when tuning chunk sizes or planning capacity.
+
+The index is streamed, not loaded into memory, so large vaults export in
+constant memory. The format is taken from --format, or else from the output's
+extension (.csv, .jsonl or .ndjson); without an output the rows go to stdout.
+
+Example:
+  sietch dedup export chunks.csv
+  sietch dedup export --format jsonl | jq -s 'group_by(.ref_count) | map({refs: .[0].ref_count, chunks: length})'`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
 		if err != nil {
-			return fmt.Errorf("garbage collection failed: %v", err)
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+
+		output := ""
+		if len(args) == 1 && args[0] != "-" {
+			output = args[0]
+		}
+		format, _ := cmd.Flags().GetString("format")
+		if !cmd.Flags().Changed("format") {
+			format = exportFormatFor(output)
+		}
+		if !slices.Contains(deduplication.ExportFormats, format) {
+			return fmt.Errorf("unsupported --format %q (expected csv or jsonl)", format)
+		}
+
+		file := os.Stdout
+		if output != "" {
+			if file, err = os.Create(output); err != nil {
+				return fmt.Errorf("failed to create export file: %v", err)
+			}
+			defer file.Close()
+		}
+		out := bufio.NewWriter(file)
+		summary, err := deduplication.ExportIndex(vaultRoot, out, format)
+		if err != nil {
+			return fmt.Errorf("failed to export deduplication index: %w", err)
+		}
+		if err := out.Flush(); err != nil {
+			return fmt.Errorf("failed to write export: %v", err)
+		}
+		if output == "" {
+			return nil
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write export file: %v", err)
+		}
+		fmt.Printf("Exported %d chunks (%s) to %s\n", summary.Chunks, util.HumanReadableSize(summary.Bytes), output)
+		return nil
+	},
+}
+
+// exportFormatFor picks the export format from an output file's extension,
+// CSV when it has none that names a format
+func exportFormatFor(output string) string {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".jsonl", ".ndjson":
+		return deduplication.ExportJSONL
+	}
+	return deduplication.ExportCSV
+}
+
+// estimateProbeSize is how much data the write throughput probe writes
+const estimateProbeSize = 8 * 1024 * 1024
+
+// dedupEstimateCmd projects what adding a directory would store
+var dedupEstimateCmd = &cobra.Command{
+	Use:   "estimate <path>",
+	Short: "Estimate how much new data adding a directory would store",
+	Long: `Estimate, before adding it, how much of a directory is new to the vault.
+
+A sample of the directory is chunked with the vault's chunking settings and
+each chunk is looked up in the deduplication index. The sample is either a
+random percentage of the files (--sample), chunked in full, or every Nth chunk
+of every file (--every). The results are extrapolated to the whole directory,
+and the add duration is projected from the sample's hashing throughput and a
+short write probe in the vault. Encryption and compression are not timed.
+
+Sampling is deterministic for a given --seed, so an estimate can be reproduced.
+
+Example:
+  sietch dedup estimate ~/datasets
+  sietch dedup estimate ~/datasets --sample 2 --seed 42
+  sietch dedup estimate ~/datasets --every 100 -o json
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+		samplePercent, _ := cmd.Flags().GetFloat64("sample")
+		everyNth, _ := cmd.Flags().GetInt("every")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		includeHidden, _ := cmd.Flags().GetBool("include-hidden")
+		if cmd.Flags().Changed("sample") && cmd.Flags().Changed("every") {
+			return fmt.Errorf("--sample and --every cannot be combined")
 		}
 
-		// Save the updated index
-		if err := dedupManager.Save(); err != nil {
-			return fmt.Errorf("failed to save updated index: %v", err)
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := chunk.ValidatePolicies(vaultConfig.Chunking.Policies); err != nil {
+			return fmt.Errorf("invalid chunking policy in vault configuration: %v", err)
+		}
+		dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
 		}
 
-		fmt.Printf("✓ Garbage collection completed\n")
-		fmt.Printf("✓ Removed %d unreferenced chunks\n", removedChunks)
+		estimate, err := dedupManager.Estimate(cmd.Context(), args[0], vaultConfig.Chunking, deduplication.EstimateOptions{
+			SamplePercent: samplePercent,
+			EveryNth:      everyNth,
+			Seed:          seed,
+			IncludeHidden: includeHidden,
+		})
+		if err != nil {
+			return err
+		}
+		writeRate, err := deduplication.ProbeWriteRate(layout.LocalChunkDirectory(vaultRoot), estimateProbeSize)
+		if err != nil {
+			return err
+		}
+		estimate.Project(writeRate)
 
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(estimate, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode estimate: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		displayEstimate(estimate, vaultConfig.Deduplication.Enabled)
 		return nil
 	},
 }
 
+// displayEstimate prints a dedup estimate
+func displayEstimate(e *deduplication.Estimate, dedupEnabled bool) {
+	fmt.Printf("Estimate for %s (seed %d)\n", e.Path, e.Seed)
+	fmt.Printf("  Files:               %d (%s)\n", e.Files, util.HumanReadableSize(e.Bytes))
+	if e.EveryNth > 0 {
+		fmt.Printf("  Sample:              every %d chunks of every file (%d chunks, %s)\n",
+			e.EveryNth, e.SampledChunks, util.HumanReadableSize(e.SampledBytes))
+	} else {
+		fmt.Printf("  Sample:              %d files (%.1f%%), %d chunks, %s\n",
+			e.SampledFiles, e.SamplePercent, e.SampledChunks, util.HumanReadableSize(e.SampledBytes))
+	}
+	fmt.Printf("  Sampled chunks:      %d new, %d already in vault, %d repeated, %d all-zero\n",
+		e.NewChunks, e.KnownChunks, e.RepeatedChunks, e.ZeroChunks)
+	if !dedupEnabled {
+		fmt.Println("  Deduplication is disabled in this vault; every chunk would be stored")
+	}
+
+	fmt.Println("\nProjected for the whole directory:")
+	fmt.Printf("  New data:            %s", util.HumanReadableSize(e.EstimatedNewBytes))
+	if e.Bytes > 0 {
+		fmt.Printf(" (%.1f%% of %s)", float64(e.EstimatedNewBytes)/float64(e.Bytes)*100, util.HumanReadableSize(e.Bytes))
+	}
+	fmt.Println()
+	fmt.Printf("  Unique new chunks:   %d of %d\n", e.EstimatedUniqueChunks, e.EstimatedChunks)
+	fmt.Printf("  Throughput:          %s/s hashing, %s/s writing\n",
+		util.HumanReadableSize(int64(e.HashRate)), util.HumanReadableSize(int64(e.WriteRate)))
+	fmt.Printf("  Add duration:        ~%s\n", time.Duration(e.EstimatedSeconds*float64(time.Second)).Round(time.Second))
+}
+
 // dedupOptimizeCmd optimizes storage
 var dedupOptimizeCmd = &cobra.Command{
 	Use:   "optimize",
@@ -320,14 +739,65 @@ Example:
 	},
 }
 
+// sortedScopeNames returns the dedup scope names of a per-scope map in order
+func sortedScopeNames[T any](byScope map[string]T) []string {
+	names := make([]string, 0, len(byScope))
+	for name := range byScope {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectSharedStore removes chunks no vault of the shared store references and
+// rebuilds the store's index to match
+func collectSharedStore(store *sharedstore.Store, vaultRoot string, vaultConfig *config.VaultConfig) error {
+	fmt.Printf("Collecting shared store %s...\n", store.Path)
+	grace := time.Duration(constants.SharedStoreGCGraceHours) * time.Hour
+	result, err := store.GarbageCollect(grace, false)
+	if err != nil {
+		return fmt.Errorf("garbage collection failed: %v", err)
+	}
+	if _, err := deduplication.RebuildIndex(vaultRoot, vaultConfig.Deduplication); err != nil {
+		return fmt.Errorf("failed to rebuild shared index: %v", err)
+	}
+
+	operationCounts.Chunks += result.ChunksRemoved
+	operationCounts.Bytes += result.BytesReclaimed
+	fmt.Printf("✓ Scanned %d vaults and %d chunks\n", result.Vaults, result.ChunksScanned)
+	fmt.Printf("✓ Removed %d unreferenced chunks (%s)\n", result.ChunksRemoved, util.HumanReadableSize(result.BytesReclaimed))
+	if result.SkippedRecent > 0 {
+		fmt.Printf("  Kept %d unreferenced chunks written in the last %d hours\n", result.SkippedRecent, constants.SharedStoreGCGraceHours)
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(dedupCmd)
 
 	// Add --setup flag for interactive configuration
 	dedupCmd.Flags().BoolP("setup", "s", false, "Configure deduplication settings interactively")
 
+	dedupStatsCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	dedupStatsCmd.Flags().String("since", "", "Only count files added on or after this date (YYYY-MM-DD or RFC 3339)")
+
 	// Add subcommands
 	dedupCmd.AddCommand(dedupStatsCmd)
 	dedupCmd.AddCommand(dedupGcCmd)
 	dedupCmd.AddCommand(dedupOptimizeCmd)
+	dedupCmd.AddCommand(dedupExportHintsCmd)
+	dedupCmd.AddCommand(dedupExportCmd)
+	dedupCmd.AddCommand(dedupEstimateCmd)
+
+	dedupExportCmd.Flags().String("format", "", "Export format: csv or jsonl (default: from the output's extension, else csv)")
+
+	dedupEstimateCmd.Flags().Float64("sample", 10, "Percentage of files to chunk in full")
+	dedupEstimateCmd.Flags().Int("every", 0, "Sample every Nth chunk of every file instead of a share of the files")
+	dedupEstimateCmd.Flags().Int64("seed", 1, "Seed for choosing the sample; the same seed gives the same estimate")
+	dedupEstimateCmd.Flags().BoolP("include-hidden", "H", false, "Include hidden files and directories")
+	dedupEstimateCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+
+	// Repacking during gc needs the passphrase for passphrase-protected vaults
+	dedupGcCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	dedupGcCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 }
@@ -0,0 +1,181 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// flagDefault ties a flag to the environment variable and the global config
+// key that supply its value when it is not given on the command line
+type flagDefault struct {
+	flag     string
+	env      string
+	key      string   // Key in ~/.config/sietch/config.yaml
+	commands []string // Commands the default applies to; all with the flag when empty
+}
+
+// flagDefaults resolve as flag > SIETCH_* variable > global config > default,
+// for every command that has the flag
+var flagDefaults = []flagDefault{
+	{flag: "vault", env: "SIETCH_VAULT", key: "vault"},
+	{flag: "passphrase-file", env: "SIETCH_PASSPHRASE_FILE", key: "passphrase_file"},
+	{flag: "jobs", env: "SIETCH_JOBS", key: "jobs"},
+	// Defaults for new vaults; log and vault rechunk have an --author and a
+	// --compression of their own
+	{flag: "path", env: "SIETCH_DEFAULT_VAULT_PATH", key: "default_vault_path", commands: []string{"init", "scaffold"}},
+	{flag: "author", env: "SIETCH_AUTHOR", key: "author", commands: []string{"init", "scaffold"}},
+	{flag: "key-type", env: "SIETCH_CIPHER", key: "cipher", commands: []string{"init"}},
+	{flag: "compression", env: "SIETCH_COMPRESSION", key: "compression", commands: []string{"init"}},
+}
+
+// appliesTo reports whether d is a default for the flag of cmd
+func (d flagDefault) appliesTo(cmd *cobra.Command) bool {
+	return len(d.commands) == 0 || slices.Contains(d.commands, cmd.Name())
+}
+
+// Where a resolved flag value came from
+const (
+	originFlag    = "flag"
+	originEnv     = "env"
+	originConfig  = "config"
+	originDefault = "default"
+)
+
+// resolvedFlag is the value a flag resolves to and where it came from
+type resolvedFlag struct {
+	value  string
+	origin string // One of the origin constants
+	source string // The flag, variable or file the value was read from
+}
+
+// resolveFlag picks the value of f from the command line, the environment or
+// the global config, falling back to the flag's default. f may be nil when no
+// command defines the flag.
+func resolveFlag(d flagDefault, f *pflag.Flag, global *config.GlobalConfig, globalPath string) resolvedFlag {
+	if f != nil && f.Changed {
+		return resolvedFlag{value: f.Value.String(), origin: originFlag, source: "--" + d.flag}
+	}
+	if value := os.Getenv(d.env); value != "" {
+		return resolvedFlag{value: value, origin: originEnv, source: d.env}
+	}
+	if value, _ := config.GetGlobalSetting(global, d.key); value != "" {
+		return resolvedFlag{value: value, origin: originConfig, source: globalPath}
+	}
+	resolved := resolvedFlag{origin: originDefault}
+	if f != nil {
+		resolved.value = f.DefValue
+	}
+	return resolved
+}
+
+// loadGlobalConfig reads the global config and returns it with its path.
+// Without a home directory there is no global config.
+func loadGlobalConfig() (*config.GlobalConfig, string, error) {
+	path, err := config.GlobalConfigPath()
+	if err != nil {
+		return &config.GlobalConfig{}, "", nil
+	}
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	return global, path, nil
+}
+
+// applyFlagDefaults fills the flags a command was not given from the SIETCH_*
+// variables and the global config, so commands read them with GetString and
+// GetInt as usual, then points vault lookups at the resolved --vault, which may
+// name a registered vault
+func applyFlagDefaults(cmd *cobra.Command) error {
+	global, globalPath, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+	for _, d := range flagDefaults {
+		f := cmd.Flags().Lookup(d.flag)
+		if f == nil || !d.appliesTo(cmd) {
+			continue
+		}
+		resolved := resolveFlag(d, f, global, globalPath)
+		if resolved.origin != originEnv && resolved.origin != originConfig {
+			continue
+		}
+		// Set on the value directly, so the flag still reads as not given
+		if err := f.Value.Set(resolved.value); err != nil {
+			return fmt.Errorf("invalid --%s %q from %s: %v", d.flag, resolved.value, resolved.source, err)
+		}
+	}
+
+	vaultPath, _ := cmd.Flags().GetString("vault")
+	vaultPath, err = resolveVaultName(vaultPath)
+	if err != nil {
+		return err
+	}
+	fs.SetVaultSearchStart(vaultPath)
+	return nil
+}
+
+// resolveVaultName returns the path of the registered vault a --vault value
+// names, or the value itself when it is a path. A name that is also a
+// directory here resolves to the registered vault, with a warning.
+func resolveVaultName(value string) (string, error) {
+	if !config.IsRegistryName(value) {
+		return value, nil
+	}
+	if _, err := config.RegistryPath(); err != nil {
+		// Without a home directory there is no registry
+		return value, nil
+	}
+	registry, err := config.LoadRegistry()
+	if err != nil {
+		return "", err
+	}
+	vault, ok := registry.Lookup(value)
+	if !ok {
+		return value, nil
+	}
+	if info, err := os.Stat(value); err == nil && info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Warning: %q is both a registered vault and a directory here; using the registered vault at %s (give ./%s for the directory)\n",
+			value, vault.Path, value)
+	}
+	return vault.Path, nil
+}
+
+// lookupFlag finds the flag of d on cmd or, failing that, on the first command
+// d applies to
+func lookupFlag(cmd *cobra.Command, d flagDefault) *pflag.Flag {
+	name := d.flag
+	if f := cmd.Flags().Lookup(name); f != nil && d.appliesTo(cmd) {
+		return f
+	}
+	if len(d.commands) > 0 {
+		if c, _, err := rootCmd.Find(d.commands[:1]); err == nil && c.Name() == d.commands[0] {
+			return c.Flags().Lookup(name)
+		}
+		return nil
+	}
+	var found *pflag.Flag
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		for _, child := range c.Commands() {
+			if found != nil {
+				return
+			}
+			if found = child.LocalFlags().Lookup(name); found == nil {
+				walk(child)
+			}
+		}
+	}
+	walk(rootCmd)
+	return found
+}
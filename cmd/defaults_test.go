@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestResolveFlag(t *testing.T) {
+	jobs := flagDefault{flag: "jobs", env: "SIETCH_JOBS", key: "jobs"}
+	tests := []struct {
+		name       string
+		args       []string
+		env        string
+		global     config.GlobalConfig
+		wantValue  string
+		wantOrigin string
+	}{
+		{"default", nil, "", config.GlobalConfig{}, "1", originDefault},
+		{"global config", nil, "", config.GlobalConfig{Jobs: 4}, "4", originConfig},
+		{"env over global config", nil, "8", config.GlobalConfig{Jobs: 4}, "8", originEnv},
+		{"flag over env", []string{"--jobs", "2"}, "8", config.GlobalConfig{Jobs: 4}, "2", originFlag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SIETCH_JOBS", tt.env)
+			flags := pflag.NewFlagSet("add", pflag.ContinueOnError)
+			flags.Int("jobs", 1, "")
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			resolved := resolveFlag(jobs, flags.Lookup("jobs"), &tt.global, "config.yaml")
+			if resolved.value != tt.wantValue || resolved.origin != tt.wantOrigin {
+				t.Errorf("resolveFlag() = %s from %s, want %s from %s", resolved.value, resolved.origin, tt.wantValue, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestFlagDefaultAppliesTo(t *testing.T) {
+	byKey := make(map[string]flagDefault)
+	for _, d := range flagDefaults {
+		byKey[d.key] = d
+	}
+	tests := []struct {
+		key     string
+		command string
+		want    bool
+	}{
+		{"jobs", "add", true},
+		{"author", "init", true},
+		{"author", "scaffold", true},
+		{"author", "log", false}, // log filters by its own --author
+		{"compression", "init", true},
+		{"compression", "rechunk", false},
+		{"default_vault_path", "init", true},
+	}
+	for _, tt := range tests {
+		if got := byKey[tt.key].appliesTo(&cobra.Command{Use: tt.command}); got != tt.want {
+			t.Errorf("%s applies to %s = %v, want %v", tt.key, tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestResolveVaultName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	vaultPath := t.TempDir()
+	registry := &config.Registry{}
+	if _, err := registry.Register("photos", vaultPath, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SaveRegistry(registry); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("photos", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for value, want := range map[string]string{
+		"photos":   vaultPath, // The registry wins over the directory
+		"./photos": "./photos",
+		"music":    "music",
+		"":         "",
+	} {
+		if got, err := resolveVaultName(value); err != nil || got != want {
+			t.Errorf("resolveVaultName(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+}
@@ -14,7 +14,10 @@ import (
 
 	"github.com/substantialcattle5/sietch/internal/atomic"
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
 )
 
 // deleteCmd represents the delete command
@@ -46,6 +49,19 @@ Examples:
 			return fmt.Errorf("failed to create vault manager: %v", err)
 		}
 
+		// Decrypt file paths in vaults that encrypt them
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		paths, err := unlockPaths(cmd, vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+		if paths != nil {
+			manager.SetPathRevealer(paths)
+		}
+
 		// Get the vault manifest to find the file
 		manifest, err := manager.GetManifest()
 		if err != nil {
@@ -97,42 +113,55 @@ Examples:
 		}()
 
 		// Step 1: Stage removal of the manifest file
-		destination := strings.ReplaceAll(targetFile.Destination, "/", ".")
-		uniqueFileIdentifier := destination + fileBaseName + ".yaml"
 		// relative manifest path inside vault root
-		relManifest := filepath.ToSlash(filepath.Join(".sietch", "manifests", uniqueFileIdentifier))
+		relManifest := manifestRelPath(manifestFileName(paths, targetFile.Destination, fileBaseName))
 		if err := txn.StageDelete(relManifest); err != nil {
 			return fmt.Errorf("stage manifest delete: %v", err)
 		}
 
 		// Step 2: Clean up orphaned chunks if --keep-chunks is not specified
+		// Chunks in a shared store may be used by other vaults; the store's GC removes them
 		keepChunks, _ := cmd.Flags().GetBool("keep-chunks")
-		if !keepChunks {
-			// Get the remaining manifests to check for chunk references
+		if !keepChunks && layout.SharedStore(vaultRoot) == "" {
+			// Get the remaining manifests and snapshots to check for chunk references
 			remainingManifest, err := manager.GetManifest()
 			if err != nil {
 				fmt.Printf("Warning: Failed to check for orphaned chunks: %v\n", err)
+			} else if snapshotRefs, err := snapshot.CollectReferences(vaultRoot); err != nil {
+				fmt.Printf("Warning: Failed to read snapshots, keeping chunks: %v\n", err)
 			} else {
 				// Find and remove orphaned chunks
-				if err := stageOrphanedChunkDeletes(txn, vaultRoot, targetFile.Chunks, remainingManifest); err != nil {
+				if err := stageOrphanedChunkDeletes(txn, vaultRoot, targetFile.Chunks, remainingManifest, snapshotRefs.Chunks); err != nil {
 					fmt.Printf("Warning: Failed to stage some orphaned chunks: %v\n", err)
 				}
 			}
 		}
 
+		// Drop the file's references from the dedup index before committing, so the
+		// index never points at a chunk this delete removed
+		if err := releaseDedupReferences(vaultRoot, targetFile.Chunks); err != nil {
+			return err
+		}
+
 		if err := txn.Commit(); err != nil {
 			return fmt.Errorf("commit delete transaction: %v", err)
 		}
 		committed = true
+		operationCounts.Files++
+		operationCounts.Bytes += targetFile.Size
 		fmt.Println("txn successful; delete committed")
 		fmt.Printf("✓ Successfully deleted '%s' from vault\n", filePath)
 		return nil
 	},
 }
 
-// stageOrphanedChunkDeletes stages deletions for chunks no longer referenced.
-func stageOrphanedChunkDeletes(txn *atomic.Transaction, vaultRoot string, deletedChunks []config.ChunkRef, remainingManifest *config.Manifest) error {
-	chunksInUse := make(map[string]bool)
+// stageOrphanedChunkDeletes stages deletions for chunks no longer referenced by
+// the remaining files or by any snapshot.
+func stageOrphanedChunkDeletes(txn *atomic.Transaction, vaultRoot string, deletedChunks []config.ChunkRef, remainingManifest *config.Manifest, snapshotChunks map[string]bool) error {
+	chunksInUse := make(map[string]bool, len(snapshotChunks))
+	for hash := range snapshotChunks {
+		chunksInUse[hash] = true
+	}
 	for _, file := range remainingManifest.Files {
 		for _, ch := range file.Chunks {
 			chunksInUse[ch.Hash] = true
@@ -140,21 +169,53 @@ func stageOrphanedChunkDeletes(txn *atomic.Transaction, vaultRoot string, delete
 	}
 	var lastErr error
 	for _, ch := range deletedChunks {
-		if chunksInUse[ch.Hash] {
+		if ch.Zero || ch.Remote || chunksInUse[ch.Hash] {
 			continue
 		}
-		rel := filepath.ToSlash(filepath.Join(".sietch", "chunks", ch.Hash))
-		if err := txn.StageDelete(rel); err != nil {
+		loc, _ := layout.LocateChunk(vaultRoot, ch.Hash)
+		if loc.Packed() {
+			// Chunk packs are never modified; 'sietch dedup gc' drops the chunk
+			continue
+		}
+		rel, err := filepath.Rel(vaultRoot, loc.Path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := txn.StageDelete(filepath.ToSlash(rel)); err != nil {
 			lastErr = err
 		}
 	}
 	return lastErr
 }
 
+// releaseDedupReferences removes a deleted file's chunk references from the dedup index
+func releaseDedupReferences(vaultRoot string, chunks []config.ChunkRef) error {
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	if !vaultConfig.Deduplication.Enabled {
+		return nil
+	}
+
+	dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+	if err != nil {
+		return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+	}
+	dedupManager.ReleaseChunks(chunks)
+	if err := dedupManager.Save(); err != nil {
+		return fmt.Errorf("failed to save deduplication index: %v", err)
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(deleteCmd)
 
 	// Add flags
 	deleteCmd.Flags().BoolP("force", "f", false, "Force deletion without confirmation")
 	deleteCmd.Flags().Bool("keep-chunks", false, "Keep chunks, only delete manifest")
+	deleteCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	deleteCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 }
@@ -0,0 +1,146 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// diffCmd compares the files of two vaults
+var diffCmd = &cobra.Command{
+	Use:   "diff <vaultA> <vaultB>",
+	Short: "Compare the files of two vaults",
+	Long: `Compare two vaults, given by path or registered name, without syncing them:
+list the files only one of them holds and the files whose chunk lists differ,
+then say whether they are in sync. The command exits non-zero when they are
+not, so a replication script can check a backup vault against its primary.
+
+Only manifests are read, so no key or passphrase is needed. Chunks are
+compared by their plaintext hash, which only agrees between vaults with the
+same chunking strategy, chunk size and hash algorithm; other vaults are
+refused.
+
+Example:
+  sietch diff ~/vaults/photos /media/usb/photos-backup
+  sietch diff photos photos-backup -o json`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+
+		var roots [2]string
+		var configs [2]*config.VaultConfig
+		for i, arg := range args {
+			root, err := resolveVaultName(arg)
+			if err != nil {
+				return err
+			}
+			if !fs.IsVaultInitialized(root) {
+				return fmt.Errorf("%s is not a vault", arg)
+			}
+			if configs[i], err = config.LoadVaultConfig(root); err != nil {
+				return fmt.Errorf("failed to load the configuration of %s: %v", arg, err)
+			}
+			roots[i] = root
+		}
+		if mismatch := chunkingMismatch(configs[0].Chunking, configs[1].Chunking); len(mismatch) > 0 {
+			return fmt.Errorf("the vaults chunk differently (%s), so their chunk lists cannot be compared",
+				strings.Join(mismatch, ", "))
+		}
+
+		diff, err := snapshot.CompareVaults(roots[0], roots[1])
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(diff, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode diff: %v", err)
+			}
+			fmt.Println(string(data))
+		} else if err := printVaultDiff(args, diff); err != nil {
+			return err
+		}
+		if len(diff.Changes) > 0 {
+			return fmt.Errorf("the vaults are out of sync")
+		}
+		return nil
+	},
+}
+
+// printVaultDiff lists the differences between vaults A and B and the verdict
+func printVaultDiff(names []string, diff *snapshot.Diff) error {
+	fmt.Printf("Comparing A: %s\n      and B: %s\n\n", names[0], names[1])
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, change := range diff.Changes {
+		switch change.Status {
+		case snapshot.StatusRemoved:
+			fmt.Fprintf(w, "< %s\tonly in A\t%s\n", change.Path, util.HumanReadableSize(change.OldSize))
+		case snapshot.StatusAdded:
+			fmt.Fprintf(w, "> %s\tonly in B\t%s\n", change.Path, util.HumanReadableSize(change.NewSize))
+		default:
+			fmt.Fprintf(w, "~ %s\tdiffers\t%s vs %s, %d chunks only in A, %d only in B\n", change.Path,
+				util.HumanReadableSize(change.OldSize), util.HumanReadableSize(change.NewSize),
+				change.ChunksRemoved, change.ChunksAdded)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(diff.Changes) == 0 {
+		fmt.Printf("✓ In sync: %d files identical\n", diff.Unchanged)
+		return nil
+	}
+	fmt.Printf("\n✗ Out of sync: %d only in A, %d only in B, %d different, %d identical\n",
+		diff.Count(snapshot.StatusRemoved), diff.Count(snapshot.StatusAdded),
+		diff.Count(snapshot.StatusModified), diff.Unchanged)
+	return nil
+}
+
+// chunkingMismatch names the chunking settings two vaults differ in that
+// change the chunks a file is split into
+func chunkingMismatch(a, b config.ChunkingConfig) []string {
+	var mismatch []string
+	if a.Strategy != b.Strategy {
+		mismatch = append(mismatch, fmt.Sprintf("strategy %s vs %s", a.Strategy, b.Strategy))
+	}
+	sizeA, errA := util.ParseChunkSize(a.ChunkSize)
+	sizeB, errB := util.ParseChunkSize(b.ChunkSize)
+	if errA != nil || errB != nil || sizeA != sizeB {
+		mismatch = append(mismatch, fmt.Sprintf("chunk size %s vs %s", a.ChunkSize, b.ChunkSize))
+	}
+	hashA, hashB := a.HashAlgorithm, b.HashAlgorithm
+	if hashA == "" {
+		hashA = constants.HashAlgorithmSHA256
+	}
+	if hashB == "" {
+		hashB = constants.HashAlgorithmSHA256
+	}
+	if hashA != hashB {
+		mismatch = append(mismatch, fmt.Sprintf("hash algorithm %s vs %s", hashA, hashB))
+	}
+	return mismatch
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
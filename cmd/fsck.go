@@ -0,0 +1,181 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/fsck"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// fsckOutput is the JSON output of 'sietch fsck'
+type fsckOutput struct {
+	Report *fsck.Report       `json:"report"`
+	Repair *fsck.RepairResult `json:"repair,omitempty"`
+}
+
+// fsckCmd checks, and with --repair fixes, chunk references across the vault
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Find and repair orphaned chunks, missing chunks and index drift",
+	Long: `Check the vault's chunk store against the manifests of the live vault and of
+every snapshot, as left behind by an interrupted add or delete:
+
+- orphaned chunks and packs that no manifest references
+- files whose manifest references chunks that are not on disk
+- dedup index reference counts that disagree with the manifests
+
+By default nothing is changed. With --repair, a missing chunk that another
+file or snapshot has a stored copy of is adopted from that copy, files still
+missing data are marked damaged (shown by 'sietch ls', refused by 'sietch get')
+and unmarked once their chunks are back, and the dedup index is rebuilt from
+the manifests. Orphans are only deleted with --delete-orphans. A chunk that any
+manifest references is never deleted, whatever the index says.
+
+In a vault using a shared chunk store, orphans are left to 'sietch dedup gc'.
+
+Examples:
+  sietch fsck
+  sietch fsck --repair
+  sietch fsck --repair --delete-orphans
+  sietch fsck -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		repair, _ := cmd.Flags().GetBool("repair")
+		deleteOrphans, _ := cmd.Flags().GetBool("delete-orphans")
+		if deleteOrphans && !repair {
+			return fmt.Errorf("--delete-orphans requires --repair")
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		report, err := fsck.Check(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+		var result *fsck.RepairResult
+		if repair {
+			result, err = fsck.Repair(report, fsck.RepairOptions{DeleteOrphans: deleteOrphans})
+			if err != nil {
+				return err
+			}
+		}
+
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(fsckOutput{Report: report, Repair: result}, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			displayFsckReport(report, result)
+		}
+
+		if !repair && !report.OK() {
+			return fmt.Errorf("fsck found problems; run 'sietch fsck --repair' to fix them")
+		}
+		return nil
+	},
+}
+
+// displayFsckReport prints the check summary followed by what a repair changed
+func displayFsckReport(report *fsck.Report, result *fsck.RepairResult) {
+	fmt.Printf("Checked %d files and %d snapshot files\n", report.Files, report.SnapshotFiles)
+
+	switch {
+	case report.SharedStore != "":
+		fmt.Printf("- Orphan scan skipped: chunks live in the shared store %s ('sietch dedup gc' collects them)\n", report.SharedStore)
+	case len(report.Orphans) == 0 && len(report.OrphanPacks) == 0:
+		fmt.Printf("✓ No orphaned chunks (%d stored)\n", report.StoredChunks)
+	default:
+		fmt.Printf("✗ %d orphaned chunks and %d orphaned packs (%s)\n",
+			len(report.Orphans), len(report.OrphanPacks), util.HumanReadableSize(report.OrphanBytes()))
+		for i, orphan := range report.Orphans {
+			if i == verifyReportLimit {
+				fmt.Printf("  ... and %d more\n", len(report.Orphans)-i)
+				break
+			}
+			fmt.Printf("  %s  %s\n", orphan.Key, util.HumanReadableSize(orphan.Size))
+		}
+	}
+
+	if len(report.Damaged) == 0 {
+		fmt.Println("✓ All files have their chunks")
+	} else {
+		fmt.Printf("✗ %d files are missing chunks:\n", len(report.Damaged))
+		for i, damaged := range report.Damaged {
+			if i == verifyReportLimit {
+				fmt.Printf("  ... and %d more\n", len(report.Damaged)-i)
+				break
+			}
+			where := ""
+			if damaged.Snapshot != "" {
+				where = fmt.Sprintf(" (snapshot %s)", damaged.Snapshot)
+			}
+			fmt.Printf("  %s%s: %d missing, %d recoverable from other files\n", damaged.File, where, damaged.Missing, damaged.Adoptable)
+		}
+	}
+	if len(report.Recovered) > 0 {
+		fmt.Printf("- %d files marked damaged have all their chunks again\n", len(report.Recovered))
+	}
+	if report.RemoteChunks > 0 {
+		fmt.Printf("- %d remote chunks not fetched yet; run 'sietch sync' to fetch them\n", report.RemoteChunks)
+	}
+
+	switch {
+	case report.IndexError != "":
+		fmt.Printf("✗ Deduplication index unreadable: %s\n", report.IndexError)
+	case report.Index == nil:
+		// Deduplication disabled
+	case report.Index.OK():
+		fmt.Printf("✓ Deduplication index consistent (%d chunks)\n", report.Index.IndexedChunks)
+	default:
+		fmt.Printf("✗ Deduplication index has %d problems\n", len(report.Index.Problems))
+	}
+
+	if result == nil {
+		if !report.OK() {
+			fmt.Println("\nRun 'sietch fsck --repair' to fix these problems.")
+		}
+		return
+	}
+
+	fmt.Println("\nRepair:")
+	fmt.Printf("  Adopted chunk references: %d\n", result.Adopted)
+	fmt.Printf("  Marked damaged:           %d\n", result.MarkedDamaged)
+	fmt.Printf("  No longer damaged:        %d\n", result.Cleared)
+	if result.Index != nil {
+		fmt.Printf("  Index rebuilt:            %d chunks, %d references\n", result.Index.Chunks, result.Index.References)
+	}
+	if result.OrphansDeleted > 0 {
+		fmt.Printf("  Orphans deleted:          %d (%s freed)\n", result.OrphansDeleted, util.HumanReadableSize(result.BytesFreed))
+	} else if len(report.Orphans)+len(report.OrphanPacks) > 0 {
+		fmt.Println("  Orphans kept; add --delete-orphans to remove them")
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+	fsckCmd.Flags().Bool("repair", false, "Fix the problems found instead of only reporting them")
+	fsckCmd.Flags().Bool("delete-orphans", false, "With --repair, delete chunks and packs no manifest references")
+	fsckCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
@@ -6,38 +6,73 @@ package cmd
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 
-	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/chunk"
 	"github.com/substantialcattle5/sietch/internal/config"
-	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/pathencryption"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/pack"
 	"github.com/substantialcattle5/sietch/internal/progress"
 	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
 	"github.com/substantialcattle5/sietch/util"
 )
 
+// zeroReader reads zeros, for hashing the holes of a sparse file
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// unfetchedChunks counts the remote chunks of a file that are not stored locally
+func unfetchedChunks(vaultRoot string, refs []config.ChunkRef) int {
+	missing := 0
+	for _, ref := range refs {
+		if !ref.Remote {
+			continue
+		}
+		if _, exists := layout.LocateChunk(vaultRoot, chunker.StorageKey(ref)); !exists {
+			missing++
+		}
+	}
+	return missing
+}
+
 // findFileManifest searches for a file manifest by path, trying multiple approaches
-func findFileManifest(vaultRoot, filePath string) (*config.FileManifest, error) {
+func findFileManifest(vaultRoot, filePath string, paths *pathencryption.Cipher) (*config.FileManifest, error) {
 	// Create a vault manager to get all manifests
 	manager, err := config.NewManager(vaultRoot)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vault manager: %v", err)
 	}
+	if paths != nil {
+		manager.SetPathRevealer(paths)
+	}
 
 	// Get all manifests
 	vaultManifest, err := manager.GetManifest()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get vault manifest: %v", err)
 	}
+	return matchFileManifest(vaultManifest.Files, filePath)
+}
 
+// matchFileManifest finds the manifest of filePath among files
+func matchFileManifest(files []config.FileManifest, filePath string) (*config.FileManifest, error) {
 	// Search through all files to find a match
-	for _, fileManifest := range vaultManifest.Files {
+	for _, fileManifest := range files {
 		// Try multiple matching strategies:
 		// 1. Exact match with full path (Destination + FilePath)
 		fullPath := fileManifest.Destination + fileManifest.FilePath
@@ -62,13 +97,13 @@ func findFileManifest(vaultRoot, filePath string) (*config.FileManifest, error)
 	}
 
 	// If we get here, no file was found - provide helpful error message
-	if len(vaultManifest.Files) == 0 {
+	if len(files) == 0 {
 		return nil, fmt.Errorf("no files found in vault")
 	}
 
 	// Show similar files to help user
 	var suggestions []string
-	for _, fileManifest := range vaultManifest.Files {
+	for _, fileManifest := range files {
 		fullPath := fileManifest.Destination + fileManifest.FilePath
 		if filepath.Base(fullPath) == filepath.Base(filePath) {
 			suggestions = append(suggestions, fullPath)
@@ -96,9 +131,20 @@ var getCmd = &cobra.Command{
 This command retrieves a file from your vault, decrypts it if necessary,
 and writes it to the specified destination.
 
+Every chunk is checked against the hash recorded in the file's manifest, and
+files added with the file dedup strategy are also checked as a whole; a
+mismatch stops the retrieval and removes what was written so far, so corrupt
+data is never returned. --verify=false skips the hash checks for faster reads,
+and 'sietch config set verify_on_read off' makes that the vault's default.
+
+The file gets back the permissions and modification time it had when it was
+added. --same-owner also restores its owner and group, which usually needs
+root; without it, setuid and setgid bits are dropped.
+
 Example:
   sietch get document.txt ~/Documents/
-  sietch get vault/photos/vacation.jpg ./retrieved_photos/`,
+  sietch get vault/photos/vacation.jpg ./retrieved_photos/
+  sietch get --verify=false large.iso ./`,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get global flags
@@ -126,20 +172,60 @@ Example:
 
 		// Get flags
 		force, _ := cmd.Flags().GetBool(force)
+		sameOwner, _ := cmd.Flags().GetBool("same-owner")
 		skipEncryption, _ := cmd.Flags().GetBool(skipDecryption)
+		verify := vaultConfig.VerifiesOnRead()
+		if cmd.Flags().Changed("verify") {
+			verify, _ = cmd.Flags().GetBool("verify")
+		}
+		cache, err := readCache(cmd)
+		if err != nil {
+			return err
+		}
 
 		if !quiet {
 			fmt.Printf("Retrieving %s from vault\n", filePath)
 		}
 
+		// Get passphrase if needed for decryption
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return fmt.Errorf("failed to get passphrase: %v", err)
+		}
+		paths, err := pathencryption.Unlock(vaultRoot, vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+
 		// Find the file manifest by searching through all manifests
-		fileManifest, err := findFileManifest(vaultRoot, filePath)
+		fileManifest, err := findFileManifest(vaultRoot, filePath, paths)
 		if err != nil {
 			return fmt.Errorf("file not found in vault: %v", err)
 		}
+		if fileManifest.Damaged {
+			return fmt.Errorf("%s is damaged: some of its chunks are missing (see 'sietch fsck')", filePath)
+		}
+		if missing := unfetchedChunks(vaultRoot, fileManifest.Chunks); missing > 0 {
+			return fmt.Errorf("%s: %d chunks not local, run 'sietch sync' to fetch them", filePath, missing)
+		}
 
 		// Determine output path
 		outputPath := filepath.Join(destPath, fileManifest.FilePath)
+		if err := fs.CheckRestorePath(outputPath); err != nil {
+			return fmt.Errorf("cannot restore %s here: %v", filePath, err)
+		}
+		if fileManifest.IsSymlink() || fileManifest.IsDir() {
+			if err := restoreTreeEntry(fileManifest, outputPath, force); err != nil {
+				return err
+			}
+			if err := restoreMetadata(outputPath, fileManifest, sameOwner); err != nil {
+				return err
+			}
+			if !quiet {
+				fmt.Printf("\nRetrieved %s\n", outputPath)
+			}
+			return nil
+		}
 		if _, err := os.Stat(outputPath); err == nil && !force {
 			return fmt.Errorf("file %s already exists, use --force to overwrite", outputPath)
 		}
@@ -156,12 +242,14 @@ Example:
 			return fmt.Errorf("failed to create output file: %v", err)
 		}
 		defer outputFile.Close()
-
-		// Get passphrase if needed for decryption
-		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
-		if err != nil {
-			return fmt.Errorf("failed to get passphrase: %v", err)
-		}
+		// A failed read, a hash mismatch in particular, leaves no partial file behind
+		retrieved := false
+		defer func() {
+			if !retrieved {
+				_ = outputFile.Close()
+				_ = os.Remove(outputPath)
+			}
+		}()
 
 		// Create progress manager
 		progressMgr := progress.NewManager(progress.Options{
@@ -173,6 +261,32 @@ Example:
 		ctx := context.Background()
 		ctx = progressMgr.SetupCancellation(ctx)
 
+		// Small files are stored inside a pack rather than as chunks
+		if fileManifest.Pack != nil {
+			if skipEncryption {
+				return fmt.Errorf("--skip-decryption is not supported for packed files")
+			}
+			data, err := pack.ReadFile(vaultRoot, *vaultConfig, passphrase, fileManifest.Pack)
+			if err != nil {
+				return fmt.Errorf("failed to read packed file: %v", err)
+			}
+			if _, err := outputFile.Write(data); err != nil {
+				return fmt.Errorf("failed to write to output file: %v", err)
+			}
+			if err := outputFile.Close(); err != nil {
+				return fmt.Errorf("failed to write to output file: %v", err)
+			}
+			if err := restoreMetadata(outputPath, fileManifest, sameOwner); err != nil {
+				return err
+			}
+			retrieved = true
+			runMetrics.BytesOut += int64(len(data))
+			progressMgr.Cleanup()
+			progressMgr.PrintInfo("\nFile retrieved successfully: %s\n", outputPath)
+			progressMgr.PrintInfo("Size: %s\n", util.HumanReadableSize(fileManifest.Size))
+			return nil
+		}
+
 		// Process each chunk
 		chunkCount := len(fileManifest.Chunks)
 		totalSize := int64(0)
@@ -187,6 +301,35 @@ Example:
 			fmt.Printf("Reassembling file from %d chunks\n", chunkCount)
 		}
 
+		// Zero chunks are restored as holes where the filesystem supports sparse files
+		writer := fs.NewSparseWriter(outputFile)
+		retryPolicy, err := storeRetryPolicy(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		store := chunker.NewRetryStore(chunker.NewVaultStore(vaultRoot), retryPolicy)
+
+		// Without decryption the stored (encrypted) bytes are written as they are
+		rawChunks := skipEncryption && vaultConfig.Encryption.Type != constants.EncryptionTypeNone
+		opts, err := chunker.OptionsFromConfig(vaultRoot, *vaultConfig, passphrase)
+		if err != nil && !rawChunks {
+			return err
+		}
+		opts.Cache = cache
+		// Chunks are verified with the algorithm the file was added with, which
+		// differs from the vault's while a rechunk to another one is under way
+		if fileManifest.Chunking != nil && fileManifest.Chunking.HashAlgorithm != "" {
+			opts.HashAlgorithm = fileManifest.Chunking.HashAlgorithm
+		}
+		opts.SkipHashCheck = !verify
+		reader := chunker.NewReader(store, fileManifest.Chunks, opts)
+		var content hash.Hash
+		if verify && !rawChunks && fileManifest.ContentHash != "" {
+			if content, err = chunk.CreateHasher(opts.HashAlgorithm); err != nil {
+				return err
+			}
+		}
+
 		for i, chunkRef := range fileManifest.Chunks {
 			// Check for cancellation
 			select {
@@ -198,83 +341,36 @@ Example:
 
 			progressMgr.PrintVerbose("Processing chunk %d/%d\n", i+1, chunkCount)
 
-			// Get the chunk hash to use - if encrypted, use the encrypted hash
-			chunkHash := chunkRef.Hash
-			if chunkRef.EncryptedHash != "" {
-				chunkHash = chunkRef.EncryptedHash
-			}
-
-			// Get the chunk path
-			chunkPath := filepath.Join(vaultRoot, ".sietch", "chunks", chunkHash)
-
-			// Check if chunk exists
-			if _, err := os.Stat(chunkPath); os.IsNotExist(err) {
-				return fmt.Errorf("chunk %s not found", chunkHash)
+			var chunkData []byte
+			if rawChunks {
+				if !chunkRef.Zero {
+					chunkData, err = store.Get(chunkRef)
+				}
+			} else {
+				chunkRef, chunkData, err = reader.Next()
 			}
-
-			// Read the chunk data
-			chunkData, err := os.ReadFile(chunkPath)
 			if err != nil {
-				return fmt.Errorf("failed to read chunk: %v", err)
+				progressMgr.Cleanup()
+				return err
 			}
 
-			// Decrypt the chunk if encryption is enabled and not skipped
-			if !skipEncryption && vaultConfig.Encryption.Type != "none" {
-				if len(chunkData) == 0 {
-					return fmt.Errorf("chunk %s is empty", chunkHash)
+			if chunkRef.Zero {
+				if err := writer.WriteZeros(chunkRef.Size); err != nil {
+					progressMgr.Cleanup()
+					return err
 				}
-
-				// Decrypt the data using the appropriate method based on passphrase protection
-				var decryptedData string
-				if vaultConfig.Encryption.PassphraseProtected {
-					decryptedData, err = encryption.DecryptDataWithPassphrase(
-						string(chunkData),
-						vaultRoot,
-						passphrase,
-					)
-				} else {
-					decryptedData, err = encryption.DecryptData(
-						string(chunkData),
-						vaultRoot,
-					)
-				}
-				if err != nil {
-					return fmt.Errorf("failed to decrypt chunk %s: %v", chunkHash, err)
-				}
-
-				// TODO: Implement chunk integrity verification
-				// if !skipEncryption && chunkRef.Hash != "" {
-				//     if util.SHA256Sum([]byte(decryptedData)) != chunkRef.Hash {
-				//         return fmt.Errorf("chunk integrity check failed")
-				//     }
-				// }
-
-				// The original data was base64-encoded before encryption. Decode back to bytes.
-				decodedBytes, err := base64.StdEncoding.DecodeString(decryptedData)
-				if err != nil {
-					return fmt.Errorf("failed to base64-decode decrypted chunk %s: %v", chunkHash, err)
+				if content != nil {
+					_, _ = io.CopyN(content, zeroReader{}, chunkRef.Size)
 				}
-				chunkData = decodedBytes
+				progressMgr.UpdateTotalProgress(chunkRef.Size)
+				continue
 			}
-
-			// Decompress the chunk if it was compressed
-			if chunkRef.Compressed {
-				// Use the compression type stored in the chunk ref, not the current vault config
-				// This handles cases where the vault compression setting changed after the file was added
-				compressionType := chunkRef.CompressionType
-				if compressionType == "" {
-					// Fallback to vault config for backwards compatibility with old manifests
-					compressionType = vaultConfig.Compression
-				}
-				decompressedData, err := compression.DecompressData(chunkData, compressionType)
-				if err != nil {
-					return fmt.Errorf("failed to decompress chunk %s: %v", chunkHash, err)
-				}
-				chunkData = decompressedData
+			if content != nil {
+				content.Write(chunkData)
 			}
 
 			// Write the chunk to the output file
-			bytesWritten, err := outputFile.Write(chunkData)
+			bytesWritten, err := writer.Write(chunkData)
 			if err != nil {
 				progressMgr.Cleanup()
 				return fmt.Errorf("failed to write to output file: %v", err)
@@ -284,6 +380,25 @@ Example:
 			progressMgr.UpdateTotalProgress(int64(bytesWritten))
 		}
 
+		if err := writer.Finish(); err != nil {
+			progressMgr.Cleanup()
+			return err
+		}
+		if content != nil && fmt.Sprintf("%x", content.Sum(nil)) != fileManifest.ContentHash {
+			progressMgr.Cleanup()
+			return fmt.Errorf("integrity check failed for %s: its content does not match the hash recorded when it was added", filePath)
+		}
+		if err := outputFile.Close(); err != nil {
+			progressMgr.Cleanup()
+			return fmt.Errorf("failed to write to output file: %v", err)
+		}
+		if err := restoreMetadata(outputPath, fileManifest, sameOwner); err != nil {
+			progressMgr.Cleanup()
+			return err
+		}
+		retrieved = true
+		runMetrics.BytesOut += fileManifest.Size
+
 		// Complete progress bars
 		progressMgr.FinishTotalProgress()
 		progressMgr.Cleanup()
@@ -307,13 +422,75 @@ Example:
 	},
 }
 
+// restoreTreeEntry recreates a stored symlink or empty directory at path
+func restoreTreeEntry(m *config.FileManifest, path string, force bool) error {
+	if m.IsDir() {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		return nil
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		if !force {
+			return fmt.Errorf("file %s already exists, use --force to overwrite", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to replace %s: %v", path, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+	if err := os.Symlink(filepath.FromSlash(m.LinkTarget), path); err != nil {
+		return fmt.Errorf("failed to create symlink: %v", err)
+	}
+	return nil
+}
+
+// restoreMetadata applies a file's recorded mode and modification time to
+// path and, with sameOwner, its owner. Setuid and setgid bits are only
+// restored along with the owner they were granted for.
+func restoreMetadata(path string, m *config.FileManifest, sameOwner bool) error {
+	// Chown clears setuid and setgid, so it goes before the mode
+	if sameOwner && m.Owner != nil {
+		if err := os.Lchown(path, m.Owner.UID, m.Owner.GID); err != nil {
+			return fmt.Errorf("failed to restore owner of %s: %v", path, err)
+		}
+	}
+	// A symlink has no mode of its own, and Chtimes would follow it
+	if m.IsSymlink() {
+		return nil
+	}
+	if m.Mode != "" {
+		mode, err := fs.ParseMode(m.Mode)
+		if err != nil {
+			return err
+		}
+		if !sameOwner {
+			mode &^= os.ModeSetuid | os.ModeSetgid
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to restore mode of %s: %v", path, err)
+		}
+	}
+	if modTime, err := time.Parse(time.RFC3339Nano, m.ModTime); err == nil {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return fmt.Errorf("failed to restore modification time of %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(getCmd)
 
 	// Add flags
 	getCmd.Flags().BoolP(force, "f", false, "Force overwrite if file exists at destination")
+	getCmd.Flags().Bool("same-owner", false, "Restore the file's recorded owner and group too, along with setuid and setgid bits (usually needs root)")
 	getCmd.Flags().Bool(skipDecryption, false, "Skip decryption and retrieve raw chunks (for recovery)")
 	getCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	getCmd.Flags().Bool("verify", true, "Check chunk hashes while reading (default from the vault's verify_on_read)")
 	getCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 }
 
@@ -0,0 +1,75 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// indexCmd groups commands that maintain the deduplication index
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Maintain the deduplication index",
+	Long: `Maintain the deduplication index stored in .sietch/index/.
+
+The index maps every deduplicated chunk to its reference count and storage
+location. It is updated incrementally as files are added and deleted; use
+'sietch verify' to compare it against the file manifests.
+
+Example:
+  sietch index rebuild`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// indexRebuildCmd reconstructs the index from the file manifests
+var indexRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Reconstruct the deduplication index from the file manifests",
+	Long: `Reconstruct the deduplication index by scanning every file manifest.
+
+Use this when the index is missing, reported as corrupt, or when 'sietch verify'
+finds reference counts that disagree with the manifests. The existing index is
+replaced and does not need to be readable.
+
+Example:
+  sietch index rebuild`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if !vaultConfig.Deduplication.Enabled {
+			return fmt.Errorf("deduplication is not enabled in this vault")
+		}
+
+		fmt.Println("Rebuilding deduplication index from manifests...")
+		result, err := deduplication.RebuildIndex(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			return fmt.Errorf("index rebuild failed: %v", err)
+		}
+
+		fmt.Printf("✓ Scanned %d files\n", result.Files)
+		fmt.Printf("✓ Indexed %d chunks (%d references)\n", result.Chunks, result.References)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+	indexCmd.AddCommand(indexRebuildCmd)
+}
@@ -13,14 +13,18 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
+	"github.com/substantialcattle5/sietch/internal/compression"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/encryption/keys"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
+	"github.com/substantialcattle5/sietch/internal/layout"
 	"github.com/substantialcattle5/sietch/internal/manifest"
 	"github.com/substantialcattle5/sietch/internal/ui"
 	"github.com/substantialcattle5/sietch/internal/validation"
 	"github.com/substantialcattle5/sietch/internal/vault"
+	"github.com/substantialcattle5/sietch/util"
 )
 
 var (
@@ -43,9 +47,11 @@ var (
 	chunkingStrategy string
 	chunkSize        string
 	hashAlgorithm    string
+	chunkLayout      string
 
 	// Compression
-	compressionType string
+	compressionType  string
+	compressionLevel int
 
 	// Sync
 	syncMode string
@@ -61,9 +67,16 @@ var (
 	dedupMaxChunkSize   string
 	dedupGCThreshold    int
 
+	// Small-file packing
+	packSmallFiles bool
+	packChunks     bool
+	packThreshold  string
+	wholeFileSmall bool
+
 	// Other options
 	interactiveMode bool
 	forceInit       bool
+	overwriteVault  bool
 	templateName    string
 	configFile      string
 )
@@ -129,17 +142,26 @@ Examples:
   # AES with key file
   sietch init --key-type aes --key-file path/to/key.bin
 
+  # AES key wrapped with an age identity (or an age1... recipients file)
+  sietch init --key-type aes --key-file ~/.config/age/keys.txt
+
   # Custom chunking and GPG encryption
   sietch init --chunking-strategy cdc --chunk-size 2MB --key-type gpg
 
+  # Two levels of chunk directories, for a vault of millions of chunks
+  sietch init --chunk-layout nested
+
   # Use config file from template or backup
   sietch init --from-config my-old-vault.yaml
 
   # Use predefined template
   sietch init --template photo-vault
 
-  # Force re-initialization of an existing vault
-  sietch init --force`,
+  # Initialize over what an interrupted init left behind
+  sietch init --force
+
+  # Replace an existing vault (its data becomes unreadable)
+  sietch init --overwrite-vault`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runInit(cmd)
@@ -156,7 +178,7 @@ func init() {
 	// Encryption vars
 	initCmd.Flags().StringVar(&keyType, "key-type", "aes", "Type of encryption key (aes, chacha20, gpg, none)")
 	initCmd.Flags().BoolVar(&usePassphrase, "passphrase", false, "Protect key with passphrase")
-	initCmd.Flags().StringVar(&keyFile, "key-file", "", "Path to key file (for importing an existing key)")
+	initCmd.Flags().StringVar(&keyFile, "key-file", "", "Path to key file (for importing an existing key, or an age identity/recipients file to wrap a new one)")
 	initCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
 	initCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 
@@ -171,9 +193,11 @@ func init() {
 	initCmd.Flags().StringVar(&chunkingStrategy, "chunking-strategy", "fixed", "Strategy for chunking (fixed, cdc)")
 	initCmd.Flags().StringVar(&chunkSize, "chunk-size", "4MB", "Size of chunks")
 	initCmd.Flags().StringVar(&hashAlgorithm, "hash", "sha256", "Hash algorithm (sha256, blake3)")
+	initCmd.Flags().StringVar(&chunkLayout, "chunk-layout", "sharded", "Chunk directory layout (sharded: chunks/ab/<hash>, nested: chunks/ab/cd/<hash> for vaults of millions of chunks)")
 
 	// Compression vars
-	initCmd.Flags().StringVar(&compressionType, "compression", "none", "Compression type (none, gzip, zstd)")
+	initCmd.Flags().StringVar(&compressionType, "compression", "none", "Compression type (none, gzip, zstd, lz4, brotli)")
+	initCmd.Flags().IntVar(&compressionLevel, "compression-level", 0, "Compression level (gzip 1-9, zstd 1-19, brotli 1-11; 0 = default)")
 
 	// Sync vars
 	initCmd.Flags().StringVar(&syncMode, "sync-mode", "manual", "Synchronization mode (manual, auto)")
@@ -184,19 +208,31 @@ func init() {
 
 	// RSA Keys
 	initCmd.Flags().Int("rsa-bits", constants.DefaultRSAKeySize, "Bit size for the RSA key pair (min 2048, recommended 4096)")
+	initCmd.Flags().String("sync-key-type", constants.SyncKeyTypeRSA, "Sync identity key type (rsa, ed25519)")
 
 	// Deduplication options
 	initCmd.Flags().BoolVar(&enableDeduplication, "enable-dedup", true, "Enable deduplication (default: true)")
-	initCmd.Flags().StringVar(&dedupStrategy, "dedup-strategy", "content", "Deduplication strategy (content)")
+	initCmd.Flags().StringVar(&dedupStrategy, "dedup-strategy", constants.DedupStrategyContent,
+		"Deduplication strategy: content (reuse identical chunks across files; most savings), "+
+			"file (reuse only whole identical files; no chunk index, one extra read per file) "+
+			"or none (store every file's chunks anew)")
 	initCmd.Flags().StringVar(&dedupMinChunkSize, "dedup-min-size", "1KB", "Minimum chunk size for deduplication")
 	initCmd.Flags().StringVar(&dedupMaxChunkSize, "dedup-max-size", "64MB", "Maximum chunk size for deduplication")
 	initCmd.Flags().IntVar(&dedupGCThreshold, "dedup-gc-threshold", 1000, "Unreferenced chunk count before GC suggestion")
 
+	// Small-file packing options
+	initCmd.Flags().BoolVar(&packSmallFiles, "pack-small-files", false, "Store small files in shared packs instead of individual chunks")
+	initCmd.Flags().BoolVar(&wholeFileSmall, "whole-file", false, "Store files smaller than the dedup min chunk size as a single blob without chunking them")
+	initCmd.Flags().BoolVar(&packChunks, "pack-chunks", false, "Move small chunks into chunk packs during 'sietch dedup gc'")
+	initCmd.Flags().StringVar(&packThreshold, "pack-threshold", constants.DefaultPackThreshold, "Files and chunks smaller than this are packed (with --pack-small-files or --pack-chunks)")
+
 	// Other options
 	initCmd.Flags().BoolVar(&interactiveMode, "interactive", false, "Use interactive mode")
-	initCmd.Flags().BoolVar(&forceInit, "force", false, "Force re-initialization of existing vault")
+	initCmd.Flags().BoolVar(&forceInit, "force", false, "Initialize over a directory left by an incomplete init; never replaces a working vault")
+	initCmd.Flags().BoolVar(&overwriteVault, "overwrite-vault", false, "Re-initialize an existing vault, destroying its data")
 	initCmd.Flags().StringVar(&templateName, "template", "", "Use a predefined template structure")
 	initCmd.Flags().StringVar(&configFile, "from-config", "", "Initialize from a configuration file")
+	_ = initCmd.RegisterFlagCompletionFunc("template", completeTemplateNames)
 }
 
 func runInit(cmd *cobra.Command) error {
@@ -231,18 +267,41 @@ func runInit(cmd *cobra.Command) error {
 	if err != nil {
 		return err
 	}
+	if err := compression.ValidateAlgorithm(compressionType); err != nil {
+		return fmt.Errorf("invalid --compression: %w", err)
+	}
+	if err := compression.ValidateLevel(compressionType, compressionLevel); err != nil {
+		return fmt.Errorf("invalid --compression-level: %w", err)
+	}
+	if enableDeduplication {
+		if err := config.ValidateDedupStrategy(dedupStrategy); err != nil {
+			return fmt.Errorf("invalid --dedup-strategy: %w", err)
+		}
+	}
+	chunkBounds := config.DeduplicationConfig{MinChunkSize: dedupMinChunkSize, MaxChunkSize: dedupMaxChunkSize}
+	if err := config.ValidateChunkSizes(config.ChunkingConfig{ChunkSize: chunkSize}, chunkBounds); err != nil {
+		return fmt.Errorf("invalid chunk sizes (--chunk-size, --dedup-min-size, --dedup-max-size): %w", err)
+	}
+	layoutVersion, err := layout.Parse(chunkLayout)
+	if err != nil {
+		return fmt.Errorf("invalid --chunk-layout: %w", err)
+	}
+	if layoutVersion == constants.ChunkLayoutFlat {
+		return fmt.Errorf("invalid --chunk-layout: new vaults use the sharded or nested layout")
+	}
+	structure := fs.VaultOptions{ChunkLayout: layoutVersion}
 	// Update the original variables with validated values
 	author = authorValidated
 	tags = tagsValidated
 
 	// Prepare vault path and check for existing vault
-	absVaultPath, err := vault.PrepareVaultPath(vaultPath, vaultName, forceInit)
+	absVaultPath, err := vault.PrepareVaultPath(vaultPath, vaultName, forceInit, overwriteVault)
 	if err != nil {
 		return err
 	}
 
 	// Create directory structure
-	if err := fs.CreateVaultStructure(absVaultPath); err != nil {
+	if err := fs.CreateVaultStructureWith(absVaultPath, structure); err != nil {
 		return fmt.Errorf("failed to create vault structure: %w", err)
 	}
 
@@ -306,13 +365,13 @@ func runInit(cmd *cobra.Command) error {
 
 		// Create directory structure for the key if it doesn't exist
 		keyDir := filepath.Dir(keyPath)
-		if err := os.MkdirAll(keyDir, constants.SecureDirPerms); err != nil {
+		if err := private.Mkdir(keyDir); err != nil {
 			cleanupOnError(absVaultPath)
 			return fmt.Errorf("failed to create key directory %s: %w", keyDir, err)
 		}
 
 		// Write the key with secure permissions (only owner can read/write)
-		if err := os.WriteFile(keyPath, keyMaterial, constants.SecureFilePerms); err != nil {
+		if err := private.WriteFileAtomic(keyPath, keyMaterial); err != nil {
 			cleanupOnError(absVaultPath)
 			return fmt.Errorf("failed to write key to %s: %w", keyPath, err)
 		}
@@ -348,6 +407,23 @@ func runInit(cmd *cobra.Command) error {
 		true, // index enabled
 	)
 
+	// Small-file and small-chunk packing
+	if packSmallFiles || packChunks {
+		if _, err := util.ParseChunkSize(packThreshold); err != nil {
+			cleanupOnError(absVaultPath)
+			return fmt.Errorf("invalid pack threshold %q: %w", packThreshold, err)
+		}
+		configuration.Packing = config.PackingConfig{
+			Enabled:     packSmallFiles,
+			Chunks:      packChunks,
+			Threshold:   packThreshold,
+			MaxPackSize: constants.DefaultMaxPackSize,
+		}
+	}
+	configuration.Chunking.WholeFile = wholeFileSmall
+	configuration.Chunking.LayoutVersion = structure.Layout()
+	configuration.CompressionLevel = compressionLevel
+
 	// Initialize RSA config if not present
 	if configuration.Sync.RSA == nil {
 		configuration.Sync.RSA = &config.RSAConfig{
@@ -362,11 +438,19 @@ func runInit(cmd *cobra.Command) error {
 		configuration.Sync.RSA.KeySize = rsaBits
 	}
 
-	// Generate RSA key pair for sync
-	err = keys.GenerateRSAKeyPair(absVaultPath, &configuration)
+	// Ed25519 identities are smaller and faster to sign with than RSA
+	syncKeyType, _ := cmd.Flags().GetString("sync-key-type")
+	if syncKeyType != "" && syncKeyType != constants.SyncKeyTypeRSA && syncKeyType != constants.SyncKeyTypeEd25519 {
+		cleanupOnError(absVaultPath)
+		return fmt.Errorf("invalid sync key type %q (supported: rsa, ed25519)", syncKeyType)
+	}
+	configuration.Sync.RSA.KeyType = syncKeyType
+
+	// Generate the key pair for sync
+	err = keys.GenerateSyncKeyPair(absVaultPath, &configuration)
 	if err != nil {
 		cleanupOnError(absVaultPath)
-		return fmt.Errorf("failed to generate RSA keys for sync: %w", err)
+		return fmt.Errorf("failed to generate sync keys: %w", err)
 	}
 
 	// Print the final configuration to verify it has the key
@@ -383,6 +467,7 @@ func runInit(cmd *cobra.Command) error {
 
 	// Print success message
 	ui.PrintSuccessMessage(&configuration, vaultID, absVaultPath)
+	registerVault(&configuration, absVaultPath)
 
 	return nil
 }
@@ -444,6 +529,9 @@ func handleInteractiveMode() (*config.VaultConfig, error) {
 	chunkingStrategy = vaultConfig.Chunking.Strategy
 	chunkSize = vaultConfig.Chunking.ChunkSize
 	hashAlgorithm = vaultConfig.Chunking.HashAlgorithm
+	if vaultConfig.Chunking.LayoutVersion == constants.ChunkLayoutNested {
+		chunkLayout = layout.Name(constants.ChunkLayoutNested)
+	}
 
 	// Handle other configuration
 	compressionType = vaultConfig.Compression
@@ -458,6 +546,14 @@ func handleInteractiveMode() (*config.VaultConfig, error) {
 	dedupMaxChunkSize = vaultConfig.Deduplication.MaxChunkSize
 	dedupGCThreshold = vaultConfig.Deduplication.GCThreshold
 
+	// Handle packing configuration
+	packSmallFiles = vaultConfig.Packing.Enabled
+	packChunks = vaultConfig.Packing.Chunks
+	if vaultConfig.Packing.Threshold != "" {
+		packThreshold = vaultConfig.Packing.Threshold
+	}
+	wholeFileSmall = vaultConfig.Chunking.WholeFile
+
 	return vaultConfig, nil
 }
 
@@ -0,0 +1,221 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// keyInfo is how the vault key is protected, without any secret: no key,
+// salt, nonce or key check
+type keyInfo struct {
+	Cipher             string   `json:"cipher"`
+	Mode               string   `json:"mode,omitempty"` // AES mode, or poly1305 for ChaCha20
+	PassphraseRequired bool     `json:"passphrase_required"`
+	KDF                *kdfInfo `json:"kdf,omitempty"` // Only when a passphrase protects the key
+	KeyPath            string   `json:"key_path,omitempty"`
+	KeyFingerprint     string   `json:"key_fingerprint,omitempty"`
+	KeySource          string   `json:"key_source,omitempty"`     // generated or imported
+	AgeRecipients      int      `json:"age_recipients,omitempty"` // Set when the key file is age-wrapped
+	Recipients         []string `json:"recipients"`               // Names of the RSA keys holding a wrapped copy
+	EncryptedPaths     bool     `json:"encrypted_paths"`
+	EncryptedIndex     bool     `json:"encrypted_index"`
+	Convergent         bool     `json:"convergent"`
+	GPGKeyID           string   `json:"gpg_key_id,omitempty"`
+	GPGRecipient       string   `json:"gpg_recipient,omitempty"`
+}
+
+// kdfInfo is the function deriving the key encryption key from the passphrase
+type kdfInfo struct {
+	Type             string `json:"type"`
+	ScryptN          int    `json:"scrypt_n,omitempty"`
+	ScryptR          int    `json:"scrypt_r,omitempty"`
+	ScryptP          int    `json:"scrypt_p,omitempty"`
+	PBKDF2Iterations int    `json:"pbkdf2_iterations,omitempty"`
+}
+
+// keyinfoCmd shows how the vault key is protected
+var keyinfoCmd = &cobra.Command{
+	Use:   "keyinfo",
+	Short: "Show how the vault key is protected, without revealing it",
+	Long: `Show the vault's key configuration: the cipher and AES mode, whether a
+passphrase is required to unlock the key, and the key derivation function
+with its parameters (scrypt N, r and p, or PBKDF2 iterations). Also shown are
+where the key file is, its fingerprint, the keys holding a wrapped copy of it,
+and whether file paths and the dedup index are encrypted and chunks encrypted
+convergently.
+
+Nothing secret is printed: not the key, nor the salt, nonce or key check, so
+the output can be attached to a security review.
+
+Example:
+  sietch keyinfo
+  sietch keyinfo -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		info := buildKeyInfo(vaultConfig.Encryption)
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode key information: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		displayKeyInfo(info)
+		return nil
+	},
+}
+
+// buildKeyInfo gathers what keyinfo reports from the encryption settings
+func buildKeyInfo(enc config.EncryptionConfig) *keyInfo {
+	info := &keyInfo{
+		Cipher:             enc.Type,
+		PassphraseRequired: enc.PassphraseProtected,
+		KeyPath:            enc.KeyPath,
+		KeyFingerprint:     enc.KeyHash,
+		Recipients:         []string{},
+		EncryptedPaths:     enc.EncryptPaths,
+		EncryptedIndex:     enc.EncryptIndex,
+		Convergent:         enc.Convergent != nil && enc.Convergent.Enabled,
+	}
+	if info.Cipher == "" {
+		info.Cipher = constants.EncryptionTypeNone
+	}
+	switch {
+	case enc.KeyFile:
+		info.KeySource = "imported"
+	case enc.RandomKey:
+		info.KeySource = "generated"
+	}
+	if enc.AgeConfig != nil {
+		info.AgeRecipients = len(enc.AgeConfig.Recipients)
+	}
+	for _, r := range enc.Recipients {
+		info.Recipients = append(info.Recipients, r.Name)
+	}
+
+	var kdf kdfInfo
+	switch {
+	case enc.Type == constants.EncryptionTypeAES && enc.AESConfig != nil:
+		info.Mode = strings.ToLower(enc.AESConfig.Mode)
+		if info.Mode == "" {
+			info.Mode = constants.AESModeGCM
+		}
+		kdf = kdfInfo{Type: enc.AESConfig.KDF, ScryptN: enc.AESConfig.ScryptN, ScryptR: enc.AESConfig.ScryptR,
+			ScryptP: enc.AESConfig.ScryptP, PBKDF2Iterations: enc.AESConfig.PBKDF2I}
+	case enc.Type == constants.EncryptionTypeChaCha20 && enc.ChaChaConfig != nil:
+		info.Mode = enc.ChaChaConfig.Mode
+		kdf = kdfInfo{Type: enc.ChaChaConfig.KDF, ScryptN: enc.ChaChaConfig.ScryptN, ScryptR: enc.ChaChaConfig.ScryptR,
+			ScryptP: enc.ChaChaConfig.ScryptP, PBKDF2Iterations: enc.ChaChaConfig.PBKDF2I}
+	case enc.Type == constants.EncryptionTypeGPG && enc.GPGConfig != nil:
+		info.GPGKeyID, info.GPGRecipient = enc.GPGConfig.KeyID, enc.GPGConfig.Recipient
+	}
+	// Without a passphrase the key file holds the key itself and the KDF
+	// settings recorded at init are unused
+	if info.PassphraseRequired && kdf.Type != "" {
+		// Only the parameters of the function in use apply
+		if kdf.Type == constants.KDFScrypt {
+			kdf.PBKDF2Iterations = 0
+		} else {
+			kdf.ScryptN, kdf.ScryptR, kdf.ScryptP = 0, 0, 0
+		}
+		info.KDF = &kdf
+	}
+	return info
+}
+
+// displayKeyInfo prints the key configuration for people
+func displayKeyInfo(info *keyInfo) {
+	cipher := info.Cipher
+	if info.Mode != "" {
+		cipher += " (" + info.Mode + ")"
+	}
+	fmt.Printf("Cipher:          %s\n", cipher)
+	if info.Cipher == constants.EncryptionTypeNone {
+		return
+	}
+	if info.GPGKeyID != "" || info.GPGRecipient != "" {
+		fmt.Printf("GPG key:         %s %s\n", info.GPGKeyID, info.GPGRecipient)
+	}
+
+	switch {
+	case info.KDF != nil:
+		fmt.Println("Passphrase:      required")
+		fmt.Printf("KDF:             %s\n", describeKDF(info.KDF))
+	case info.PassphraseRequired:
+		fmt.Println("Passphrase:      required")
+	default:
+		fmt.Println("Passphrase:      not required (the key file holds the key itself)")
+	}
+
+	if info.KeyPath != "" {
+		key := info.KeyPath
+		if info.KeySource != "" {
+			key += " (" + info.KeySource + ")"
+		}
+		fmt.Printf("Key file:        %s\n", key)
+	}
+	if info.AgeRecipients > 0 {
+		fmt.Printf("Key wrapping:    age, for %d recipient(s)\n", info.AgeRecipients)
+	}
+	if info.KeyFingerprint != "" {
+		fmt.Printf("Key fingerprint: %s\n", info.KeyFingerprint)
+	}
+	if len(info.Recipients) > 0 {
+		fmt.Printf("Recipients:      %s\n", strings.Join(info.Recipients, ", "))
+	}
+	fmt.Printf("Encrypted paths: %s\n", yesNo(info.EncryptedPaths))
+	fmt.Printf("Encrypted index: %s\n", yesNo(info.EncryptedIndex))
+	fmt.Printf("Convergent:      %s\n", yesNo(info.Convergent))
+}
+
+// describeKDF shows a key derivation function with its parameters
+func describeKDF(kdf *kdfInfo) string {
+	switch kdf.Type {
+	case constants.KDFScrypt:
+		return fmt.Sprintf("scrypt (N=%d, r=%d, p=%d)", kdf.ScryptN, kdf.ScryptR, kdf.ScryptP)
+	case constants.KDFPBKDF2:
+		return fmt.Sprintf("pbkdf2 (%d iterations)", kdf.PBKDF2Iterations)
+	}
+	return kdf.Type
+}
+
+// yesNo shows a setting that is on or off
+func yesNo(on bool) string {
+	if on {
+		return "yes"
+	}
+	return "no"
+}
+
+func init() {
+	rootCmd.AddCommand(keyinfoCmd)
+	keyinfoCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// TestBuildKeyInfo ensures keyinfo reports the KDF in use and no secret
+func TestBuildKeyInfo(t *testing.T) {
+	aes := func(kdf string, passphrase bool) config.EncryptionConfig {
+		return config.EncryptionConfig{
+			Type:                constants.EncryptionTypeAES,
+			PassphraseProtected: passphrase,
+			KeyPath:             ".sietch/keys/secret.key",
+			AESConfig: &config.AESConfig{Key: "S3CRETKEY", Mode: "GCM", KDF: kdf, Salt: "S3CRETSALT", Nonce: "S3CRETNONCE",
+				KeyCheck: "S3CRETCHECK", ScryptN: 32768, ScryptR: 8, ScryptP: 1, PBKDF2I: 600000},
+		}
+	}
+	tests := []struct {
+		name     string
+		enc      config.EncryptionConfig
+		wantMode string
+		wantKDF  *kdfInfo
+	}{
+		{"scrypt", aes(constants.KDFScrypt, true), "gcm", &kdfInfo{Type: constants.KDFScrypt, ScryptN: 32768, ScryptR: 8, ScryptP: 1}},
+		{"pbkdf2", aes(constants.KDFPBKDF2, true), "gcm", &kdfInfo{Type: constants.KDFPBKDF2, PBKDF2Iterations: 600000}},
+		{"no passphrase", aes(constants.KDFScrypt, false), "gcm", nil},
+		{"chacha20", config.EncryptionConfig{Type: constants.EncryptionTypeChaCha20, PassphraseProtected: true,
+			ChaChaConfig: &config.ChaChaConfig{Key: "S3CRETKEY", Mode: "poly1305", KDF: constants.KDFScrypt, Salt: "S3CRETSALT", ScryptN: 16384, ScryptR: 8, ScryptP: 2}},
+			"poly1305", &kdfInfo{Type: constants.KDFScrypt, ScryptN: 16384, ScryptR: 8, ScryptP: 2}},
+		{"unencrypted", config.EncryptionConfig{}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := buildKeyInfo(tt.enc)
+			if info.Mode != tt.wantMode {
+				t.Errorf("mode = %q, want %q", info.Mode, tt.wantMode)
+			}
+			if (info.KDF == nil) != (tt.wantKDF == nil) || info.KDF != nil && *info.KDF != *tt.wantKDF {
+				t.Errorf("kdf = %+v, want %+v", info.KDF, tt.wantKDF)
+			}
+			data, err := json.Marshal(info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "S3CRET") {
+				t.Errorf("key info reveals a secret: %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/internal/stats"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/internal/validate"
+)
+
+// vaultLockModes is how each command locks the vault it runs in. Commands that
+// change manifests, chunks, the index or vault.yaml lock it exclusively.
+// Commands not listed only read it and run without the lock, so a writer
+// never turns them away.
+var vaultLockModes = map[*cobra.Command]lock.Mode{}
+
+// exclusiveWith lists read commands that write, and so lock, when given a flag
+var exclusiveWith = map[*cobra.Command]string{
+	fsckCmd: "repair",
+}
+
+// heldLock is the vault lock the running command holds
+var heldLock *lock.Lock
+
+// lockVault takes the lock the command needs on the vault it runs in. Outside
+// a vault it does nothing; the command reports that itself.
+func lockVault(cmd *cobra.Command, args []string) error {
+	mode, ok := commandLockMode(cmd)
+	if !ok {
+		return nil
+	}
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil || !fs.IsVaultInitialized(vaultRoot) {
+		return nil
+	}
+
+	if forceUnlock, _ := cmd.Flags().GetBool("force-unlock"); forceUnlock {
+		if holder := lock.Holder(vaultRoot); holder != "" {
+			fmt.Fprintf(os.Stderr, "Warning: breaking the vault lock last held by %s\n", holder)
+		}
+		if err := lock.Break(vaultRoot); err != nil {
+			return err
+		}
+	}
+	wait, _ := cmd.Flags().GetDuration("wait")
+	heldLock, err = lock.AcquireWait(vaultRoot, mode, cmd.CommandPath(), wait)
+	if errors.Is(err, lock.ErrLocked) {
+		return fmt.Errorf("%w; wait for it to finish (--wait 1m waits for you), or run 'sietch vault unlock --force' if its process died", err)
+	}
+	if err != nil || mode != lock.Exclusive {
+		return err
+	}
+	// The sizes 'sietch status' caches are recomputed after any change
+	if err := stats.Invalidate(vaultRoot); err != nil {
+		_ = unlockVault(cmd, args)
+		return fmt.Errorf("failed to reset cached vault statistics: %v", err)
+	}
+	operationVault = vaultRoot
+	return nil
+}
+
+// abortCommand stops a command refused before it ran: its lock is released
+// and, as it changed nothing, it is kept out of the operation log
+func abortCommand(cmd *cobra.Command, args []string, err error) error {
+	operationVault = ""
+	_ = unlockVault(cmd, args)
+	return err
+}
+
+// commandLockMode returns how cmd locks the vault, given its flags, and
+// whether it locks it at all
+func commandLockMode(cmd *cobra.Command) (lock.Mode, bool) {
+	if flag, ok := exclusiveWith[cmd]; ok {
+		if set, _ := cmd.Flags().GetBool(flag); set {
+			return lock.Exclusive, true
+		}
+	}
+	mode, ok := vaultLockModes[cmd]
+	return mode, ok
+}
+
+// unlockVault releases the lock lockVault took, if any
+func unlockVault(cmd *cobra.Command, args []string) error {
+	err := heldLock.Release()
+	heldLock = nil
+	return err
+}
+
+// vaultUnlockCmd clears a lock left behind by a sietch process that died
+var vaultUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Show or clear the vault lock",
+	Long: `Show which process holds the vault lock, or clear it with --force.
+
+The lock is released by the operating system when its process exits, so a
+lock normally needs no clearing. On filesystems that keep locks after a crash
+(network shares, for instance) --force removes it, but only when the process
+recorded in the lock ran on this host and is no longer running. A lock held by
+a process on another host can be broken with --force-unlock on the next command.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+		if !force {
+			l, err := lock.Acquire(vaultRoot, lock.Shared, cmd.CommandPath())
+			if err == nil {
+				fmt.Println("The vault is not locked by a writer.")
+				return l.Release()
+			}
+			if !errors.Is(err, lock.ErrLocked) {
+				return err
+			}
+			fmt.Println(err)
+			if record, ok := lock.ReadRecord(vaultRoot); ok && !record.Since.IsZero() {
+				fmt.Printf("Locked since %s\n", record.Since.Local().Format("2006-01-02 15:04:05"))
+			}
+			return nil
+		}
+
+		record, err := lock.BreakStale(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if record.PID == 0 {
+			fmt.Println("The vault is not locked; nothing to clear.")
+			return nil
+		}
+		fmt.Printf("✓ Cleared the lock left by %s (pid %d, no longer running)\n", record.Command, record.PID)
+		return nil
+	},
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultUnlockCmd)
+	vaultUnlockCmd.Flags().Bool("force", false, "Remove the lock when the process holding it is no longer running")
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := startProfile(cmd); err != nil {
+			return err
+		}
+		strict, _ := cmd.Flags().GetBool("strict")
+		validate.SetStrict(strict)
+		config.HistoryCommand = cmd.CommandPath()
+		// Commands that open an encrypted dedup index without having unlocked
+		// the vault ask for the passphrase when they do
+		deduplication.IndexPassphrase = func(vaultConfig *config.VaultConfig) (string, error) {
+			return ui.GetPassphraseForVault(cmd, vaultConfig)
+		}
+		// Flag defaults decide which vault is locked
+		if err := applyFlagDefaults(cmd); err != nil {
+			return err
+		}
+		if err := lockVault(cmd, args); err != nil {
+			return err
+		}
+		// Restoring vault.yaml is done under the command's lock, or a lock of its own
+		if err := recoverVaultConfig(cmd); err != nil {
+			return abortCommand(cmd, args, err)
+		}
+		if err := refuseFrozenVault(cmd, args); err != nil {
+			return abortCommand(cmd, args, err)
+		}
+		return nil
+	}
+	rootCmd.PersistentPostRunE = unlockVault
+	rootCmd.PersistentFlags().Duration("wait", 0, "How long to wait for another sietch process to release the vault (e.g. 30s); by default fail at once")
+	rootCmd.PersistentFlags().Bool("force-unlock", false, "Break a vault lock left by a process that hangs or runs on another host")
+
+	for _, cmd := range []*cobra.Command{
+		addCmd, deleteCmd, syncCmd, sneakCmd, recoverCmd, repairCmd,
+		snapshotCmd, snapshotDeleteCmd, snapshotRestoreCmd,
+		dedupGcCmd, dedupOptimizeCmd, indexRebuildCmd,
+		configSetCmd, compressTrainDictCmd, compressDeleteDictCmd,
+		recipientAddCmd, recipientRemoveCmd, peerRemoveCmd, conflictsResolveCmd, peerLimitCmd, peerDiscoverCmd, peerAddCmd, peerRenameCmd, peerVerifyCmd, peerRevokeCmd, bundleApplyCmd,
+		storeInitCmd, storeJoinCmd, storeLeaveCmd,
+		vaultMigrateLayoutCmd, vaultMigrateCmd, vaultEncryptPathsCmd, vaultEncryptIndexCmd, vaultRechunkCmd, vaultRecompressCmd, vaultCompactCmd,
+		vaultConvergentEnableCmd, vaultConvergentDisableCmd,
+		vaultTagAddCmd, vaultTagRemoveCmd, vaultMetaSetCmd, vaultFreezeCmd, vaultThawCmd,
+	} {
+		vaultLockModes[cmd] = lock.Exclusive
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+// TestReadsRunWhileAddHoldsLock ensures commands that only read the vault are
+// not turned away by a writer holding its lock, while another writer is
+func TestReadsRunWhileAddHoldsLock(t *testing.T) {
+	testutil.SkipIfShort(t, "integration test")
+
+	vaultRoot := newTestVault(t)
+	source := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(source, []byte(strings.Repeat("spice\n", 512)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runSietch(t, "add", source, "docs/"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	held, err := lock.Acquire(vaultRoot, lock.Exclusive, "sietch add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	out := filepath.Join(t.TempDir(), "notes.txt")
+	for _, args := range [][]string{
+		{"ls"},
+		{"get", "docs/notes.txt", out},
+		{"verify"},
+		{"status"},
+	} {
+		if err := runSietch(t, args...); err != nil {
+			t.Errorf("sietch %s while an add holds the lock: %v", strings.Join(args, " "), err)
+		}
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("get wrote nothing: %v", err)
+	}
+
+	if err := runSietch(t, "add", source, "more/"); !errors.Is(err, lock.ErrLocked) {
+		t.Errorf("second add while the lock is held = %v, want %v", err, lock.ErrLocked)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/oplog"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// operationCounts is what the running command did to the vault; commands that
+// change it add to these as they go, for the operation log
+var operationCounts oplog.Counts
+
+// operationNotes are changes of the running command the operation log
+// records in words, such as the peers it trusted
+var operationNotes []string
+
+// operationVault is the vault the running command locked exclusively, whose
+// operation log records it
+var operationVault string
+
+// logOperation appends the command that just ran to the operation log of the
+// vault it changed, if any. A log that cannot be written only warns.
+func logOperation(cmd *cobra.Command, runErr error) {
+	if operationVault == "" || cmd == nil {
+		return
+	}
+	entry := oplog.Entry{
+		Time:    time.Now().UTC(),
+		Author:  operationAuthor(),
+		Command: cmd.CommandPath(),
+		Args:    cmd.Flags().Args(),
+		Counts:  operationCounts,
+		Notes:   operationNotes,
+	}
+	if runErr != nil {
+		entry.Error = runErr.Error()
+	}
+
+	var signer crypto.Signer
+	if vaultConfig, err := config.LoadVaultConfig(operationVault); err == nil && vaultConfig.SignOperationLog {
+		if vaultConfig.Sync.RSA == nil {
+			fmt.Fprintln(os.Stderr, "Warning: sign_operation_log is set but the vault has no sync key; logging the operation unsigned")
+		} else if signer, _, _, err = keys.LoadSyncKeys(operationVault, vaultConfig.Sync.RSA); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: logging the operation unsigned: %v\n", err)
+			signer = nil
+		}
+	}
+	if err := oplog.Append(operationVault, entry, signer); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record the operation in the vault log: %v\n", err)
+	}
+}
+
+// operationAuthor names who runs sietch, as user@host
+func operationAuthor() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+// logCmd prints the vault's operation log
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the operations that changed the vault",
+	Long: `Show the commands that changed the vault, oldest first.
+
+Every command that takes the vault lock exclusively (add, delete, dedup gc,
+sync, recipient add, vault rechunk, config set, ...) appends an entry to
+.sietch/log when it finishes: the time, who ran it (user@host), the command and
+its arguments, how many files, chunks and bytes it handled where it counts
+them, and the error if it failed. Entries are only ever appended.
+
+With 'sietch config set sign_operation_log true' each entry is signed with the
+vault's sync key; --verify checks the signatures against the vault's sync public
+key and fails if any entry does not match.
+
+Example:
+  sietch log
+  sietch log --command add --since 7d
+  sietch log --author alice --failed
+  sietch log --verify -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		last, _ := cmd.Flags().GetInt("last")
+		if last < 0 {
+			return fmt.Errorf("--last must not be negative")
+		}
+		var filter oplog.Filter
+		filter.Command, _ = cmd.Flags().GetString("command")
+		filter.Author, _ = cmd.Flags().GetString("author")
+		filter.Failed, _ = cmd.Flags().GetBool("failed")
+		if since, _ := cmd.Flags().GetString("since"); since != "" {
+			var err error
+			if filter.Since, err = util.ParseSince(since, time.Now()); err != nil {
+				return fmt.Errorf("invalid --since: %v", err)
+			}
+		}
+		verify, _ := cmd.Flags().GetBool("verify")
+
+		vaultRoot, vaultConfig, err := loadCurrentVaultConfig()
+		if err != nil {
+			return err
+		}
+		var publicKey crypto.PublicKey
+		if verify {
+			if publicKey, err = syncPublicKey(vaultRoot, vaultConfig); err != nil {
+				return err
+			}
+		}
+
+		entries, err := oplog.Load(vaultRoot)
+		if err != nil {
+			return err
+		}
+		var matched []oplog.Entry
+		for _, entry := range entries {
+			if filter.Match(entry) {
+				matched = append(matched, entry)
+			}
+		}
+		if last > 0 && len(matched) > last {
+			matched = matched[len(matched)-last:]
+		}
+
+		// Entries are checked before printing so JSON can report the result
+		results := make([]string, len(matched))
+		badSignatures := 0
+		if verify {
+			for i, entry := range matched {
+				switch err := entry.Verify(publicKey); {
+				case entry.Signature == "":
+					results[i] = "unsigned"
+				case err != nil:
+					results[i] = "bad signature"
+					badSignatures++
+				default:
+					results[i] = "signature ok"
+				}
+			}
+		}
+
+		if outputFormat == "json" {
+			type jsonEntry struct {
+				oplog.Entry
+				Verified string `json:"verified,omitempty"`
+			}
+			out := make([]jsonEntry, len(matched))
+			for i, entry := range matched {
+				out[i] = jsonEntry{Entry: entry, Verified: results[i]}
+			}
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode log: %v", err)
+			}
+			fmt.Println(string(data))
+		} else if len(matched) == 0 {
+			fmt.Println("No operations logged")
+		} else {
+			for i, entry := range matched {
+				fmt.Println(formatLogEntry(entry, results[i]))
+				for _, note := range entry.Notes {
+					fmt.Printf("    %s\n", note)
+				}
+				if entry.Error != "" {
+					fmt.Printf("    failed: %s\n", entry.Error)
+				}
+			}
+		}
+
+		if badSignatures > 0 {
+			return fmt.Errorf("%d log entries do not match their signatures", badSignatures)
+		}
+		return nil
+	},
+}
+
+// formatLogEntry renders an entry on one line, followed by the result of
+// checking its signature when there is one
+func formatLogEntry(entry oplog.Entry, verified string) string {
+	line := fmt.Sprintf("%s  %s  %s", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Author, entry.Command)
+	if len(entry.Args) > 0 {
+		line += " " + strings.Join(entry.Args, " ")
+	}
+	var counts []string
+	if entry.Files > 0 {
+		counts = append(counts, fmt.Sprintf("%d file(s)", entry.Files))
+	}
+	if entry.Chunks > 0 {
+		counts = append(counts, fmt.Sprintf("%d chunk(s)", entry.Chunks))
+	}
+	if entry.Bytes > 0 {
+		counts = append(counts, util.HumanReadableSize(entry.Bytes))
+	}
+	if len(counts) > 0 {
+		line += "  (" + strings.Join(counts, ", ") + ")"
+	}
+	if verified != "" {
+		line += "  [" + verified + "]"
+	}
+	return line
+}
+
+// syncPublicKey reads the vault's sync public key, which signs its log
+func syncPublicKey(vaultRoot string, vaultConfig *config.VaultConfig) (crypto.PublicKey, error) {
+	if vaultConfig.Sync.RSA == nil || vaultConfig.Sync.RSA.PublicKeyPath == "" {
+		return nil, fmt.Errorf("the vault has no sync key to verify the log with")
+	}
+	path := vaultConfig.Sync.RSA.PublicKeyPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(vaultRoot, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync public key: %v", err)
+	}
+	return keys.ParseSyncPublicKeyPEM(data)
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+	logCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	logCmd.Flags().IntP("last", "n", 0, "Show only the newest n matching entries (0 = all)")
+	logCmd.Flags().String("command", "", "Show only commands containing this, e.g. add or \"dedup gc\"")
+	logCmd.Flags().String("author", "", "Show only operations by authors (user@host) containing this")
+	logCmd.Flags().String("since", "", "Show only operations since this time: a duration back from now (36h, 7d) or a date")
+	logCmd.Flags().Bool("failed", false, "Show only commands that failed")
+	logCmd.Flags().Bool("verify", false, "Check each entry's signature against the vault's sync public key")
+}
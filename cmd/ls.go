@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -56,6 +57,19 @@ Examples:
 			return fmt.Errorf("failed to create vault manager: %v", err)
 		}
 
+		// Decrypt file paths in vaults that encrypt them
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		paths, err := unlockPaths(cmd, vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+		if paths != nil {
+			manager.SetPathRevealer(paths)
+		}
+
 		// Get the vault manifest
 		manifest, err := manager.GetManifest()
 		if err != nil {
@@ -142,9 +156,9 @@ func displayLongFormat(files []config.FileManifest, showTags, showDedup bool, ch
 
 	// Print header
 	if showTags {
-		fmt.Fprintln(w, "SIZE\tMODIFIED\tCHUNKS\tPATH\tTAGS")
+		fmt.Fprintln(w, "SIZE\tCOMPRESSED\tSTORED\tMODIFIED\tCHUNKS\tPATH\tTAGS")
 	} else {
-		fmt.Fprintln(w, "SIZE\tMODIFIED\tCHUNKS\tPATH")
+		fmt.Fprintln(w, "SIZE\tCOMPRESSED\tSTORED\tMODIFIED\tCHUNKS\tPATH")
 	}
 
 	// Print each file
@@ -156,18 +170,22 @@ func displayLongFormat(files []config.FileManifest, showTags, showDedup bool, ch
 		// Format output
 		if showTags {
 			tags := strings.Join(file.Tags, ", ")
-			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
 				util.HumanReadableSize(file.Size),
+				sizeColumn(compressedSize(file)),
+				sizeColumn(storedSize(file)),
 				timeFormat,
-				len(file.Chunks),
-				file.Destination+file.FilePath,
+				chunkColumn(file),
+				lsui.DisplayPath(file),
 				tags)
 		} else {
-			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
 				util.HumanReadableSize(file.Size),
+				sizeColumn(compressedSize(file)),
+				sizeColumn(storedSize(file)),
 				timeFormat,
-				len(file.Chunks),
-				file.Destination+file.FilePath)
+				chunkColumn(file),
+				lsui.DisplayPath(file))
 		}
 
 		// Dedup stats (print an indented stats line after the file line)
@@ -179,16 +197,76 @@ func displayLongFormat(files []config.FileManifest, showTags, showDedup bool, ch
 			sharedWithStr := lsui.FormatSharedWith(sharedWith, 10)
 			// Print as indented info (not part of the tabwriter)
 			if len(sharedWith) == 0 {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "", "", "", "") // ensure tabwriter alignment
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "", "", "", "", "", "") // ensure tabwriter alignment
 				fmt.Fprintf(w, "    shared_chunks: %d\t saved: %s\n", sharedChunks, savedStr)
 			} else {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "", "", "", "") // alignment spacer
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "", "", "", "", "", "") // alignment spacer
 				fmt.Fprintf(w, "    shared_chunks: %d\t saved: %s\t shared_with: %s\n", sharedChunks, savedStr, sharedWithStr)
 			}
 		}
 	}
 }
 
+// chunkColumn returns the CHUNKS column value; packed small files have no chunks of their own
+func chunkColumn(file config.FileManifest) string {
+	if file.Pack != nil {
+		return "packed"
+	}
+	zero := 0
+	for _, c := range file.Chunks {
+		if c.Zero {
+			zero++
+		}
+	}
+	if zero > 0 {
+		return fmt.Sprintf("%d (%d zero)", len(file.Chunks), zero)
+	}
+	return strconv.Itoa(len(file.Chunks))
+}
+
+// sizeColumn formats a size that older manifests may not have recorded
+func sizeColumn(size int64, ok bool) string {
+	if !ok {
+		return "unknown"
+	}
+	return util.HumanReadableSize(size)
+}
+
+// compressedSize returns the size of a file's data after compression and before
+// encryption; ok is false when a chunk's manifest entry does not record it
+func compressedSize(file config.FileManifest) (int64, bool) {
+	if file.Pack != nil {
+		return file.Pack.Length, true
+	}
+	var total int64
+	for _, c := range file.Chunks {
+		size, ok := c.CompressedBytes()
+		if !ok {
+			return 0, false
+		}
+		total += size
+	}
+	return total, true
+}
+
+// storedSize returns the physical size of a file's data in the vault. Zero chunks
+// take no space, so sparse files report less than their logical size. ok is
+// false when a chunk's manifest entry does not record it.
+func storedSize(file config.FileManifest) (int64, bool) {
+	if file.Pack != nil {
+		return file.Pack.Length, true
+	}
+	var total int64
+	for _, c := range file.Chunks {
+		size, ok := c.StoredSize()
+		if !ok {
+			return 0, false
+		}
+		total += size
+	}
+	return total, true
+}
+
 // buildChunkIndex creates a mapping chunkID -> []filePaths using the manifest file list.
 // Uses ChunkRef.Hash as the chunk identifier.
 func buildChunkIndex(files []config.FileManifest) map[string][]string {
@@ -196,6 +274,10 @@ func buildChunkIndex(files []config.FileManifest) map[string][]string {
 	for _, f := range files {
 		fp := f.Destination + f.FilePath
 		for _, c := range f.Chunks {
+			if c.Zero {
+				// zero chunks take no space, so sharing them saves nothing
+				continue
+			}
 			// use the Hash field as the chunk identifier
 			chunkID := c.Hash
 			if chunkID == "" {
@@ -222,4 +304,6 @@ func init() {
 
 	// New dedup-stats flag
 	lsCmd.Flags().BoolP("dedup-stats", "d", false, "Show per-file deduplication statistics")
+	lsCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	lsCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 }
@@ -214,3 +214,23 @@ func TestBuildChunkIndex_DeterministicOrder(t *testing.T) {
 		t.Fatalf("sharedWith not sorted: %v", sw)
 	}
 }
+
+func TestStoredSizeSkipsZeroChunks(t *testing.T) {
+	file := config.FileManifest{
+		Size: 12,
+		Chunks: []config.ChunkRef{
+			{Hash: "a", Size: 4, EncryptedSize: 6},
+			{Hash: "z", Size: 4, Zero: true},
+			{Hash: "b", Size: 4, CompressedSize: 2},
+		},
+	}
+	if got, ok := storedSize(file); got != 8 || !ok {
+		t.Errorf("storedSize() = %d, %v; want 8", got, ok)
+	}
+	if got := chunkColumn(file); got != "3 (1 zero)" {
+		t.Errorf("chunkColumn() = %q, want %q", got, "3 (1 zero)")
+	}
+	if idx := buildChunkIndex([]config.FileManifest{file}); len(idx["z"]) != 0 {
+		t.Errorf("zero chunk should not be indexed: %v", idx)
+	}
+}
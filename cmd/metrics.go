@@ -0,0 +1,40 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/metrics"
+)
+
+// runMetrics is what the running command did, written to --metrics-file when
+// it ends; commands add to it as they go
+var runMetrics metrics.Run
+
+// writeMetrics writes the counters of the command that just ran to
+// --metrics-file, if set. A file that cannot be written only warns.
+func writeMetrics(cmd *cobra.Command, runErr error, start time.Time) {
+	if cmd == nil {
+		return
+	}
+	path, _ := cmd.Flags().GetString("metrics-file")
+	if path == "" {
+		return
+	}
+	command := strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" ")
+	end := time.Now()
+	if err := runMetrics.WriteFile(path, command, end.Sub(start), runErr != nil, end); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().String("metrics-file", "", "Write the command's counters (chunks, bytes, dedup hits, compression ratio, duration) to this file in Prometheus text format")
+}
@@ -0,0 +1,679 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// peerCmd groups commands that manage the peers the vault trusts for sync
+var peerCmd = &cobra.Command{
+	Use:     "peer",
+	Aliases: []string{"peers"},
+	Short:   "Manage the peers the vault trusts for sync",
+	Long: `Manage the peers recorded in the vault's trust list.
+
+Peers are trusted on first use: the first sync with a vault shows the
+fingerprint of its sync key and asks whether to trust it ('sietch sync
+--non-interactive' refuses instead), or they are added ahead of time with
+'sietch peer add'. The key each vault was first seen with is kept in
+.sietch/known-peers.json, so a vault presenting another key later fails the
+sync with a POSSIBLE MITM error, even after it was removed from the list.
+
+Revoking a peer refuses syncs with it, both ways, but keeps its entry and
+history; removing it makes the next sync with it ask for trust again.
+
+Example:
+  sietch peer list
+  sietch peer add /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID --name laptop
+  sietch peer verify laptop
+  sietch peer rename QmPeerID laptop
+  sietch peer revoke laptop
+  sietch peers discover
+  sietch peer limit laptop 500KB/s
+  sietch peer remove laptop`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// peerListCmd shows the trusted peers
+var peerListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the peers the vault trusts",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		peers := trustedPeers(vaultConfig)
+		if len(peers) == 0 {
+			fmt.Println("No trusted peers.")
+			return nil
+		}
+		for _, peer := range peers {
+			fmt.Printf("%-20s %s  %s  trusted %s", peerName(peer), peer.ID, peer.Fingerprint, peer.TrustedSince.Format("2006-01-02"))
+			if peer.Verified {
+				fmt.Print("  verified")
+			}
+			if peer.Revoked {
+				fmt.Printf("  REVOKED %s", peer.RevokedAt.Local().Format("2006-01-02"))
+			}
+			if peer.BandwidthLimit != "" {
+				fmt.Printf("  limit %s", peer.BandwidthLimit)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+// peerRemoveCmd drops a peer from the trust list
+var peerRemoveCmd = &cobra.Command{
+	Use:   "remove <name|id|fingerprint|vault-id>",
+	Short: "Stop trusting a peer",
+	Long: `Remove a peer from the trust list, so the next sync with it asks for trust
+again. The key its vault was first seen with is kept, and a different key is
+still refused, unless --forget drops it too: do that only once the peer's
+owner confirmed they replaced its sync key.
+
+Example:
+  sietch peer remove laptop
+  sietch peer remove --forget 3f6c2a1e-7d4b-4c1a-9e2f-5b8a0d6e4c21`,
+	Args:              cobra.ExactArgs(1),
+	SilenceUsage:      true,
+	ValidArgsFunction: completeTrustedPeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		forget, _ := cmd.Flags().GetBool("forget")
+		peers := trustedPeers(vaultConfig)
+		i := lookupPeer(peers, args[0])
+		if i < 0 && !forget {
+			return fmt.Errorf("%s is not a trusted peer of this vault", args[0])
+		}
+		if i >= 0 {
+			peer := peers[i]
+			vaultConfig.Sync.RSA.TrustedPeers = append(peers[:i:i], peers[i+1:]...)
+			if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+				return fmt.Errorf("failed to save vault configuration: %v", err)
+			}
+			fmt.Printf("✓ Removed trusted peer %s (%s)\n", peerName(peer), peer.Fingerprint)
+			operationNotes = append(operationNotes, fmt.Sprintf("removed peer %s (%s), fingerprint %s", peerName(peer), peer.ID, peer.Fingerprint))
+		}
+		if !forget {
+			return nil
+		}
+
+		forgotten := false
+		for _, id := range forgetIDs(peers, i, args[0]) {
+			ok, err := p2p.ForgetPeer(vaultRoot, id)
+			if err != nil {
+				return err
+			}
+			forgotten = forgotten || ok
+		}
+		if !forgotten && i < 0 {
+			return fmt.Errorf("%s is neither a trusted nor a known peer of this vault", args[0])
+		}
+		fmt.Printf("✓ Forgot the key %s was first seen with; its next key is trusted on first use\n", args[0])
+		operationNotes = append(operationNotes, fmt.Sprintf("forgot the first-seen key of %s", args[0]))
+		return nil
+	},
+}
+
+// forgetIDs returns the vault and peer IDs whose first-seen keys remove
+// --forget drops: those of the removed peer at i, if any, and ref itself
+func forgetIDs(peers []config.TrustedPeer, i int, ref string) []string {
+	ids := []string{ref}
+	if i >= 0 {
+		ids = append(ids, peers[i].ID)
+		if peers[i].VaultID != "" {
+			ids = append(ids, peers[i].VaultID)
+		}
+	}
+	return ids
+}
+
+// peerLimitCmd records the bandwidth syncs with a peer are limited to
+var peerLimitCmd = &cobra.Command{
+	Use:   "limit <name|id|fingerprint> <rate>",
+	Short: "Limit the bandwidth of syncs with a peer",
+	Long: `Record the rate syncs with a peer are limited to, in each direction, such as
+500KB/s. 'sietch sync' applies it unless --bwlimit, --bwlimit-up or
+--bwlimit-down is given. A rate of 0 removes the limit.
+
+Example:
+  sietch peer limit laptop 500KB/s
+  sietch peer limit laptop 0`,
+	Args:              cobra.ExactArgs(2),
+	SilenceUsage:      true,
+	ValidArgsFunction: completeTrustedPeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rate, err := util.ParseBandwidth(args[1])
+		if err != nil {
+			return err
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		peers := trustedPeers(vaultConfig)
+		i := lookupPeer(peers, args[0])
+		if i < 0 {
+			return fmt.Errorf("%s is not a trusted peer of this vault", args[0])
+		}
+		peers[i].BandwidthLimit = ""
+		if rate > 0 {
+			peers[i].BandwidthLimit = strings.TrimSpace(args[1])
+		}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save vault configuration: %v", err)
+		}
+		if rate == 0 {
+			fmt.Printf("✓ Removed the bandwidth limit of syncs with %s\n", peerName(peers[i]))
+		} else {
+			fmt.Printf("✓ Syncs with %s limited to %s\n", peerName(peers[i]), formatRate(rate))
+		}
+		return nil
+	},
+}
+
+// peerAddCmd trusts a peer ahead of the first sync with it
+var peerAddCmd = &cobra.Command{
+	Use:   "add <address>",
+	Short: "Trust a peer before syncing with it",
+	Long: `Connect to a peer, exchange sync keys with it and add it to the trust list.
+The address is the peer's multiaddress, as 'sietch sync' prints it there, or
+an ssh:// address.
+
+With --fingerprint the peer's key must have that fingerprint, read from
+'sietch peer verify' on the other machine, and the peer is marked verified.
+Without it the peer's fingerprint is shown and trusting it must be confirmed.
+
+Example:
+  sietch peer add /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID --name laptop
+  sietch peer add ssh://alice@backup.lan/srv/vault --fingerprint <fingerprint>`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		name, _ := cmd.Flags().GetString("name")
+		fingerprint, _ := cmd.Flags().GetString("fingerprint")
+		fingerprint = strings.TrimSpace(fingerprint)
+		if name != "" && lookupPeer(trustedPeers(vaultConfig), name) >= 0 {
+			return fmt.Errorf("another peer is already named %s", name)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		node, syncService, err := newSyncNode(ctx, vaultRoot, vaultConfig, 0, false)
+		if err != nil {
+			return err
+		}
+		defer node.Close()
+		info, disconnect, err := connectToPeer(ctx, cmd, node, args[0])
+		if err != nil {
+			return err
+		}
+		defer disconnect()
+
+		trusted, err := syncService.VerifyAndExchangeKeys(ctx, info.ID)
+		if err != nil {
+			return fmt.Errorf("key exchange failed: %v", err)
+		}
+		peerInfo, _ := syncService.Peer(info.ID)
+		if trusted {
+			fmt.Printf("%s is already trusted (fingerprint %s)\n", peerDisplayName(peerInfo), peerInfo.Fingerprint)
+			return nil
+		}
+		if fingerprint != "" && fingerprint != peerInfo.Fingerprint {
+			return fmt.Errorf("POSSIBLE MITM ATTACK: peer %s presented key %s, not %s; not trusting it", info.ID, peerInfo.Fingerprint, fingerprint)
+		}
+		if fingerprint == "" {
+			fmt.Printf("Peer ID: %s\n", info.ID)
+			if peerInfo.Name != "" {
+				fmt.Printf("Vault: %s (%s)\n", peerInfo.Name, peerInfo.VaultID)
+			}
+			fmt.Printf("Fingerprint: %s\n", peerInfo.Fingerprint)
+			fmt.Println("Check it matches the fingerprint 'sietch peer verify' shows on the other machine.")
+			if !promptForTrust() {
+				return fmt.Errorf("peer not trusted")
+			}
+		}
+		if err := syncService.AddTrustedPeer(ctx, info.ID); err != nil {
+			return fmt.Errorf("failed to add trusted peer: %v", err)
+		}
+
+		// The trust list entry was saved by the sync service
+		if vaultConfig, err = config.LoadVaultConfig(vaultRoot); err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		peers := trustedPeers(vaultConfig)
+		if i := lookupPeer(peers, info.ID.String()); i >= 0 && (name != "" || fingerprint != "") {
+			if name != "" {
+				peers[i].Name = name
+			}
+			peers[i].Verified = fingerprint != ""
+			if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+				return fmt.Errorf("failed to save vault configuration: %v", err)
+			}
+			peerInfo.Name = peers[i].Name
+		}
+		fmt.Printf("✓ Trusted %s\n", peerDisplayName(peerInfo))
+		note := fmt.Sprintf("trusted peer %s (%s), fingerprint %s", peerDisplayName(peerInfo), info.ID, peerInfo.Fingerprint)
+		if fingerprint != "" {
+			note += ", verified"
+		}
+		operationNotes = append(operationNotes, note)
+		return nil
+	},
+}
+
+// peerRenameCmd changes the name a peer is shown and selected by
+var peerRenameCmd = &cobra.Command{
+	Use:               "rename <name|id|fingerprint> <new-name>",
+	Short:             "Rename a trusted peer",
+	Args:              cobra.ExactArgs(2),
+	SilenceUsage:      true,
+	ValidArgsFunction: completeTrustedPeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		peers := trustedPeers(vaultConfig)
+		i := lookupPeer(peers, args[0])
+		if i < 0 {
+			return fmt.Errorf("%s is not a trusted peer of this vault", args[0])
+		}
+		name := strings.TrimSpace(args[1])
+		if name == "" {
+			return fmt.Errorf("the new name is empty")
+		}
+		if j := lookupPeer(peers, name); j >= 0 && j != i {
+			return fmt.Errorf("another peer is already named %s", name)
+		}
+		oldName := peerName(peers[i])
+		peers[i].Name = name
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save vault configuration: %v", err)
+		}
+		fmt.Printf("✓ Renamed %s to %s\n", oldName, name)
+		operationNotes = append(operationNotes, fmt.Sprintf("renamed peer %s (%s) to %s", oldName, peers[i].ID, name))
+		return nil
+	},
+}
+
+// peerVerifyCmd compares sync key fingerprints with a peer's owner
+var peerVerifyCmd = &cobra.Command{
+	Use:   "verify <name|id|fingerprint> [fingerprint]",
+	Short: "Check a peer's key fingerprint with its owner",
+	Long: `Show the fingerprint of this vault's sync key and the one a peer was trusted
+with, to compare with the peer's owner over a channel you trust, such as in
+person or on the phone: 'sietch peer verify' on their machine shows the same
+two fingerprints the other way round.
+
+Given the fingerprint the owner read out, verify checks it against the one
+the peer was trusted with and marks the peer verified when they match.
+
+Example:
+  sietch peer verify laptop
+  sietch peer verify laptop <fingerprint>`,
+	Args:              cobra.RangeArgs(1, 2),
+	SilenceUsage:      true,
+	ValidArgsFunction: completeTrustedPeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		peers := trustedPeers(vaultConfig)
+		i := lookupPeer(peers, args[0])
+		if i < 0 {
+			return fmt.Errorf("%s is not a trusted peer of this vault", args[0])
+		}
+		peer := &peers[i]
+		if len(args) == 1 {
+			publicKey, err := syncPublicKey(vaultRoot, vaultConfig)
+			if err != nil {
+				return err
+			}
+			own, err := keys.SyncKeyFingerprint(publicKey)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-20s %s\n", "This vault:", own)
+			fmt.Printf("%-20s %s\n", peerName(*peer)+":", peer.Fingerprint)
+			if peer.Verified {
+				fmt.Println("\nThe peer's fingerprint was verified.")
+			} else {
+				fmt.Printf("\nCompare both with the peer's owner, then run 'sietch peer verify %s <fingerprint>' with theirs.\n", peerName(*peer))
+			}
+			return nil
+		}
+
+		if strings.TrimSpace(args[1]) != peer.Fingerprint {
+			return fmt.Errorf("fingerprint does not match the key %s was trusted with (%s); do not sync with it until this is explained, and revoke it with 'sietch peer revoke %s'",
+				peerName(*peer), peer.Fingerprint, peerName(*peer))
+		}
+		peer.Verified = true
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save vault configuration: %v", err)
+		}
+		fmt.Printf("✓ Verified %s\n", peerName(*peer))
+		operationNotes = append(operationNotes, fmt.Sprintf("verified peer %s (%s), fingerprint %s", peerName(*peer), peer.ID, peer.Fingerprint))
+		return nil
+	},
+}
+
+// peerRevokeCmd refuses syncs with a peer while keeping its entry
+var peerRevokeCmd = &cobra.Command{
+	Use:   "revoke <name|id|fingerprint>",
+	Short: "Refuse syncs with a peer, keeping its record",
+	Long: `Revoke a peer: syncs with it are refused, whether this vault starts them or
+the peer does, while its trust list entry and the key it was first seen with
+are kept. --undo trusts it again.
+
+Example:
+  sietch peer revoke laptop
+  sietch peer revoke --undo laptop`,
+	Args:              cobra.ExactArgs(1),
+	SilenceUsage:      true,
+	ValidArgsFunction: completeTrustedPeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		undo, _ := cmd.Flags().GetBool("undo")
+
+		peers := trustedPeers(vaultConfig)
+		i := lookupPeer(peers, args[0])
+		if i < 0 {
+			return fmt.Errorf("%s is not a trusted peer of this vault", args[0])
+		}
+		peer := &peers[i]
+		if peer.Revoked != undo {
+			if undo {
+				fmt.Printf("%s is not revoked\n", peerName(*peer))
+			} else {
+				fmt.Printf("%s was already revoked on %s\n", peerName(*peer), peer.RevokedAt.Local().Format("2006-01-02"))
+			}
+			return nil
+		}
+		peer.Revoked = !undo
+		peer.RevokedAt = time.Time{}
+		if !undo {
+			peer.RevokedAt = time.Now().UTC()
+		}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save vault configuration: %v", err)
+		}
+		if undo {
+			fmt.Printf("✓ Trusted %s again\n", peerName(*peer))
+			operationNotes = append(operationNotes, fmt.Sprintf("restored trust in peer %s (%s)", peerName(*peer), peer.ID))
+		} else {
+			fmt.Printf("✓ Revoked %s; syncs with it are refused\n", peerName(*peer))
+			operationNotes = append(operationNotes, fmt.Sprintf("revoked peer %s (%s), fingerprint %s", peerName(*peer), peer.ID, peer.Fingerprint))
+		}
+		return nil
+	},
+}
+
+// peerDiscoverCmd lists the vaults advertising themselves on the local network
+var peerDiscoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Find vaults on the local network and trust them",
+	Long: `List the vaults advertising their sync endpoint on the local network, with
+their address, the fingerprint of their sync key and whether this vault
+trusts them.
+
+A vault advertises itself only while 'sietch sync' runs in it, and only when
+sync.advertise is set ('sietch config set sync.advertise true'). Run
+interactively, discover offers to trust each new vault: it exchanges keys
+with it, checks the key matches the advertised fingerprint, and adds it to
+the trust list once you confirm the fingerprint.
+
+Example:
+  sietch peers discover
+  sietch peers discover --timeout 10 --no-trust`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		timeout, _ := cmd.Flags().GetInt("timeout")
+		noTrust, _ := cmd.Flags().GetBool("no-trust")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+		defer cancel()
+		fmt.Printf("🔍 Looking for vaults on the local network for %ds...\n", timeout)
+		var (
+			mu    sync.Mutex
+			found []p2p.Advertisement
+		)
+		err = p2p.Browse(ctx, func(a p2p.Advertisement) {
+			if a.VaultID == vaultConfig.VaultID {
+				return
+			}
+			mu.Lock()
+			found = append(found, a)
+			mu.Unlock()
+		})
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			fmt.Println("No vaults found. Vaults advertise themselves while 'sietch sync' runs with sync.advertise set.")
+			return nil
+		}
+
+		var untrusted []p2p.Advertisement
+		fmt.Println()
+		for _, a := range found {
+			trusted := "no"
+			if isTrustedPeer(vaultConfig, a) {
+				trusted = "yes"
+			} else {
+				untrusted = append(untrusted, a)
+			}
+			fmt.Printf("%-20s %s  %s  %s  trusted: %s\n", advertisedName(a), a.VaultID, a.Addrs[0], a.Fingerprint, trusted)
+		}
+
+		if noTrust || len(untrusted) == 0 || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil
+		}
+		return trustDiscoveredPeers(vaultRoot, vaultConfig, untrusted)
+	},
+}
+
+// trustDiscoveredPeers offers to trust each discovered vault, after checking
+// its sync key against the fingerprint it advertised
+func trustDiscoveredPeers(vaultRoot string, vaultConfig *config.VaultConfig, untrusted []p2p.Advertisement) error {
+	ctx := context.Background()
+	var (
+		node        host.Host
+		syncService *p2p.SyncService
+	)
+	for _, a := range untrusted {
+		fmt.Printf("\n⚠️  New vault: %s (%s)\n", advertisedName(a), a.PeerID)
+		if node == nil {
+			var err error
+			node, syncService, err = newSyncNode(ctx, vaultRoot, vaultConfig, 0, false)
+			if err != nil {
+				return err
+			}
+			defer node.Close()
+		}
+
+		connectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := node.Connect(connectCtx, peer.AddrInfo{ID: a.PeerID, Addrs: a.Addrs})
+		if err == nil {
+			_, err = syncService.VerifyAndExchangeKeys(connectCtx, a.PeerID)
+		}
+		cancel()
+		if err != nil {
+			fmt.Printf("✗ Could not exchange keys with %s: %v\n", advertisedName(a), err)
+			continue
+		}
+		fingerprint, err := syncService.GetPeerFingerprint(a.PeerID)
+		if err != nil {
+			return err
+		}
+		if fingerprint != a.Fingerprint {
+			fmt.Printf("✗ %s presented key %s, not the advertised %s; not trusting it\n", advertisedName(a), fingerprint, a.Fingerprint)
+			continue
+		}
+
+		fmt.Printf("Fingerprint: %s\n", fingerprint)
+		fmt.Println("Check it matches the sync key fingerprint of the vault on the other machine.")
+		if !promptForTrust() {
+			continue
+		}
+		syncService.NamePeer(a.PeerID, a.VaultName)
+		if err := syncService.AddTrustedPeer(ctx, a.PeerID); err != nil {
+			return fmt.Errorf("failed to add trusted peer: %v", err)
+		}
+		fmt.Printf("✓ Trusted %s\n", advertisedName(a))
+		operationNotes = append(operationNotes, fmt.Sprintf("trusted discovered peer %s (%s), fingerprint %s", advertisedName(a), a.PeerID, fingerprint))
+	}
+	return nil
+}
+
+// isTrustedPeer reports whether the vault trusts the advertised peer, by ID
+// or by key fingerprint
+func isTrustedPeer(vaultConfig *config.VaultConfig, a p2p.Advertisement) bool {
+	for _, peer := range trustedPeers(vaultConfig) {
+		if peer.ID == a.PeerID.String() || (a.Fingerprint != "" && peer.Fingerprint == a.Fingerprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// advertisedName returns the name a discovered vault is shown by
+func advertisedName(a p2p.Advertisement) string {
+	if a.VaultName != "" {
+		return a.VaultName
+	}
+	return a.InstanceName()
+}
+
+// lookupPeer returns the index of the trusted peer with ref as its
+// name, peer ID, fingerprint or vault ID, or -1
+func lookupPeer(peers []config.TrustedPeer, ref string) int {
+	for i, peer := range peers {
+		if peer.ID == ref || peer.Name == ref || peer.Fingerprint == ref || (peer.VaultID != "" && peer.VaultID == ref) {
+			return i
+		}
+	}
+	return -1
+}
+
+// trustedPeers returns the vault's trust list
+func trustedPeers(vaultConfig *config.VaultConfig) []config.TrustedPeer {
+	if vaultConfig.Sync.RSA == nil {
+		return nil
+	}
+	return vaultConfig.Sync.RSA.TrustedPeers
+}
+
+// peerDisplayName returns the name a peer whose key was exchanged is shown
+// by, its ID when it has none
+func peerDisplayName(info p2p.PeerInfo) string {
+	if info.Name != "" {
+		return info.Name
+	}
+	return info.ID.String()
+}
+
+// peerName returns the name a peer is shown and completed by, its ID when unnamed
+func peerName(peer config.TrustedPeer) string {
+	if peer.Name != "" {
+		return peer.Name
+	}
+	return peer.ID
+}
+
+func init() {
+	rootCmd.AddCommand(peerCmd)
+	peerCmd.AddCommand(peerListCmd)
+	peerCmd.AddCommand(peerRemoveCmd)
+	peerCmd.AddCommand(peerLimitCmd)
+	peerCmd.AddCommand(peerDiscoverCmd)
+	peerCmd.AddCommand(peerAddCmd)
+	peerCmd.AddCommand(peerRenameCmd)
+	peerCmd.AddCommand(peerVerifyCmd)
+	peerCmd.AddCommand(peerRevokeCmd)
+	peerRemoveCmd.Flags().Bool("forget", false, "Also forget the key the peer's vault was first seen with, accepting a replaced key")
+	peerAddCmd.Flags().String("name", "", "Name to show and select the peer by")
+	peerAddCmd.Flags().String("fingerprint", "", "Fingerprint the peer's sync key must have; trusts it without asking and marks it verified")
+	peerAddCmd.Flags().String("remote-sietch", "sietch", "With an ssh:// address, the command running sietch on that host")
+	peerRevokeCmd.Flags().Bool("undo", false, "Trust a revoked peer again")
+	peerDiscoverCmd.Flags().Int("timeout", 5, "Seconds to look for vaults")
+	peerDiscoverCmd.Flags().Bool("no-trust", false, "Only list the vaults found, without offering to trust them")
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/spf13/cobra"
+)
+
+// stopProfile finishes the profile started by --profile; nil when the command
+// is not being profiled
+var stopProfile func() error
+
+// startProfile starts the pprof profile --profile asks for, written to
+// --profile-output when the command ends. Without --profile it does nothing.
+func startProfile(cmd *cobra.Command) error {
+	kind, _ := cmd.Flags().GetString("profile")
+	if kind == "" {
+		return nil
+	}
+	path, _ := cmd.Flags().GetString("profile-output")
+	if path == "" {
+		path = "sietch-" + kind + ".pprof"
+	}
+	if kind != "cpu" && kind != "mem" {
+		return fmt.Errorf("invalid --profile %q (use cpu or mem)", kind)
+	}
+
+	// The file is created up front so a bad path fails before the command runs
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create profile: %v", err)
+	}
+	if kind == "cpu" {
+		if err := pprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to start CPU profile: %v", err)
+		}
+		stopProfile = func() error {
+			pprof.StopCPUProfile()
+			return finishProfile(file, "CPU")
+		}
+		return nil
+	}
+	stopProfile = func() error {
+		// Every allocation made while the command ran, and what is still live
+		runtime.GC()
+		if err := pprof.Lookup("allocs").WriteTo(file, 0); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write memory profile: %v", err)
+		}
+		return finishProfile(file, "memory")
+	}
+	return nil
+}
+
+func finishProfile(file *os.File, kind string) error {
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s profile: %v", kind, err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s profile to %s (inspect with 'go tool pprof')\n", kind, file.Name())
+	return nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().String("profile", "", "Write a pprof profile of the command: cpu or mem")
+	rootCmd.PersistentFlags().String("profile-output", "", "File to write the --profile profile to (default sietch-<cpu|mem>.pprof)")
+	_ = rootCmd.PersistentFlags().MarkHidden("profile")
+	_ = rootCmd.PersistentFlags().MarkHidden("profile-output")
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// recipientCmd groups commands that manage who can open the vault key
+var recipientCmd = &cobra.Command{
+	Use:   "recipient",
+	Short: "Manage the keys that can open the vault",
+	Long: `Manage the recipients of the vault key.
+
+A recipient is an RSA public key the vault key has been wrapped for. Whoever
+holds the matching private key can open the vault without the key file (or its
+passphrase) by pointing SIETCH_IDENTITY at the private key:
+
+  SIETCH_IDENTITY=~/.ssh/sietch_rsa.pem sietch get notes.txt ./out
+
+Example:
+  sietch recipient add alice --public-key alice.pem
+  sietch recipient add laptop --peer <peer-id>
+  sietch recipient list
+  sietch recipient remove alice`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// recipientAddCmd wraps the vault key for another public key
+var recipientAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Wrap the vault key for another public key",
+	Long: `Wrap the vault key with an RSA public key and record it in vault.yaml.
+
+The key is read from a PEM file with --public-key, or taken from the sync key of
+a trusted peer with --peer. Opening the vault key needs the key file and
+passphrase, or an identity that is already a recipient.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		publicKeyFile, _ := cmd.Flags().GetString("public-key")
+		peerID, _ := cmd.Flags().GetString("peer")
+		var publicKeyPEM []byte
+		switch {
+		case publicKeyFile != "" && peerID != "":
+			return fmt.Errorf("use either --public-key or --peer, not both")
+		case publicKeyFile != "":
+			publicKeyPEM, err = os.ReadFile(publicKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to read public key: %v", err)
+			}
+		case peerID != "":
+			peer := findTrustedPeer(vaultConfig, peerID)
+			if peer == nil {
+				return fmt.Errorf("%s is not a trusted peer of this vault", peerID)
+			}
+			publicKeyPEM = []byte(peer.PublicKey)
+		default:
+			return fmt.Errorf("--public-key or --peer is required")
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		recipient, err := encryption.AddRecipient(vaultConfig, passphrase, args[0], publicKeyPEM)
+		if err != nil {
+			return err
+		}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save vault configuration: %v", err)
+		}
+
+		fmt.Printf("✓ Added recipient %s (%s)\n", recipient.Name, recipient.Fingerprint)
+		return nil
+	},
+}
+
+// recipientRemoveCmd drops a recipient's copy of the vault key
+var recipientRemoveCmd = &cobra.Command{
+	Use:   "remove <name|fingerprint>",
+	Short: "Remove a recipient's copy of the vault key",
+	Long: `Remove a recipient's wrapped copy of the vault key from vault.yaml.
+
+The vault key itself does not change, so a recipient who already unwrapped it,
+or kept an older copy of vault.yaml, can still decrypt the vault's chunks.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		recipient, err := encryption.RemoveRecipient(vaultConfig, args[0])
+		if err != nil {
+			return err
+		}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save vault configuration: %v", err)
+		}
+
+		fmt.Printf("✓ Removed recipient %s (%s)\n", recipient.Name, recipient.Fingerprint)
+		fmt.Println("⚠️  The vault key is unchanged: anything the recipient already copied stays readable to them.")
+		return nil
+	},
+}
+
+// recipientListCmd shows the recipients of the vault key
+var recipientListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the recipients of the vault key",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		recipients := vaultConfig.Encryption.Recipients
+		if len(recipients) == 0 {
+			fmt.Println("No recipients; the vault opens only with its key file.")
+			return nil
+		}
+		for _, recipient := range recipients {
+			fmt.Printf("%-20s %s  added %s\n", recipient.Name, recipient.Fingerprint, recipient.AddedAt.Format("2006-01-02"))
+		}
+		return nil
+	},
+}
+
+// findTrustedPeer returns the trusted peer with the given ID, or nil
+func findTrustedPeer(vaultConfig *config.VaultConfig, peerID string) *config.TrustedPeer {
+	if vaultConfig.Sync.RSA == nil {
+		return nil
+	}
+	for i := range vaultConfig.Sync.RSA.TrustedPeers {
+		if vaultConfig.Sync.RSA.TrustedPeers[i].ID == peerID {
+			return &vaultConfig.Sync.RSA.TrustedPeers[i]
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(recipientCmd)
+	recipientCmd.AddCommand(recipientAddCmd)
+	recipientCmd.AddCommand(recipientRemoveCmd)
+	recipientCmd.AddCommand(recipientListCmd)
+
+	recipientAddCmd.Flags().String("public-key", "", "PEM file holding the recipient's RSA public key")
+	recipientAddCmd.Flags().String("peer", "", "Use the sync key of this trusted peer")
+	_ = recipientAddCmd.RegisterFlagCompletionFunc("peer", completeTrustedPeerIDs)
+	recipientAddCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	recipientAddCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/fsck"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// repairCmd restores missing and corrupt chunks from a trusted peer
+var repairCmd = &cobra.Command{
+	Use:   "repair --from-peer <peer-address>",
+	Short: "Restore missing and corrupt chunks from a trusted peer",
+	Long: `Read every chunk the live vault and its snapshots reference, and fetch each
+one that is missing or fails its hash check from a trusted peer. Only those
+exact chunks are requested, and each is checked against the hash recorded in
+the manifests before it replaces the local copy, so a peer cannot change the
+vault's contents. Encrypted chunks are checked against the hash of their
+ciphertext, so no passphrase is needed.
+
+The peer must be running 'sietch sync' and be trusted already; sync with it
+once to trust it. A peer given as ssh://[user@]host/path/to/vault is started
+over SSH instead, as 'sietch sync' does. Files marked damaged by 'sietch fsck --repair' are unmarked
+by running it again once their chunks are back.
+
+Example:
+  sietch repair --from-peer /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID
+  sietch repair --from-peer ssh://alice@backup.lan/srv/vault`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		peerAddr, _ := cmd.Flags().GetString("from-peer")
+		port, _ := cmd.Flags().GetInt("port")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signalChan)
+		go func() {
+			if _, ok := <-signalChan; ok {
+				cancel()
+			}
+		}()
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultCfg, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault config: %v", err)
+		}
+
+		// Checking stored chunks needs the hash algorithm and dictionaries, not the key
+		chunkOpts, err := chunker.OptionsFromConfig(vaultRoot, *vaultCfg, "")
+		if err != nil {
+			chunkOpts = chunker.Options{HashAlgorithm: vaultCfg.Chunking.HashAlgorithm}
+		}
+
+		bad, checked, err := fsck.ScanChunks(vaultRoot, chunkOpts)
+		if err != nil {
+			return err
+		}
+		corrupt := 0
+		for _, chunk := range bad {
+			if chunk.Corrupt {
+				corrupt++
+			}
+		}
+		fmt.Printf("Checked %d chunks: %d missing, %d corrupt\n", checked, len(bad)-corrupt, corrupt)
+		if len(bad) == 0 {
+			fmt.Println("✓ Nothing to repair")
+			return nil
+		}
+
+		host, syncService, err := newSyncNode(ctx, vaultRoot, vaultCfg, port, verbose)
+		if err != nil {
+			return err
+		}
+		defer host.Close()
+
+		fmt.Printf("🔄 Connecting to peer: %s\n", peerAddr)
+		info, disconnect, err := connectToPeer(ctx, cmd, host, peerAddr)
+		if err != nil {
+			return err
+		}
+		defer disconnect()
+
+		refs := make([]config.ChunkRef, 0, len(bad))
+		for _, chunk := range bad {
+			refs = append(refs, chunk.Ref)
+		}
+		result, err := syncService.RepairChunks(ctx, info.ID, refs, chunkOpts)
+		if err != nil {
+			return fmt.Errorf("repair failed: %v", err)
+		}
+
+		fmt.Printf("✓ Healed %d chunks (%s)\n", result.Healed, util.HumanReadableSize(result.BytesTransferred))
+		if len(result.Missing) > 0 {
+			stillMissing := make(map[string]bool, len(result.Missing))
+			for _, key := range result.Missing {
+				stillMissing[key] = true
+			}
+			fmt.Printf("✗ %d chunks the peer could not supply:\n", len(result.Missing))
+			shown := 0
+			for _, chunk := range bad {
+				if !stillMissing[chunker.StorageKey(chunk.Ref)] {
+					continue
+				}
+				if shown == verifyReportLimit {
+					fmt.Printf("  ... and %d more\n", len(result.Missing)-shown)
+					break
+				}
+				fmt.Printf("  %s  used by %s\n", chunker.StorageKey(chunk.Ref), formatFileList(chunk.Files))
+				shown++
+			}
+			return fmt.Errorf("%d chunks are still missing or corrupt", len(result.Missing))
+		}
+		fmt.Println("Run 'sietch fsck --repair' to unmark files that were marked damaged")
+		return nil
+	},
+}
+
+// formatFileList names the first file of a list and counts the others
+func formatFileList(files []string) string {
+	switch len(files) {
+	case 0:
+		return "no files"
+	case 1:
+		return files[0]
+	default:
+		return fmt.Sprintf("%s and %d more", files[0], len(files)-1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+
+	repairCmd.Flags().String("from-peer", "", "Multiaddress or ssh:// address of the trusted peer to fetch chunks from (required)")
+	_ = repairCmd.MarkFlagRequired("from-peer")
+	repairCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+	repairCmd.Flags().String("remote-sietch", "sietch", "With an ssh:// peer address, the command running sietch on that host")
+	repairCmd.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+}
@@ -6,8 +6,14 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+	"github.com/substantialcattle5/sietch/util"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -24,12 +30,61 @@ encrypted data across machines, even with limited connectivity.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	start := time.Now()
+	cmd, err := rootCmd.ExecuteC()
+	logOperation(cmd, err)
+	writeMetrics(cmd, err, start)
+	// Failed commands skip the post-run hook that releases the vault lock
+	_ = heldLock.Release()
+	if stopProfile != nil {
+		if perr := stopProfile(); perr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", perr)
+		}
+	}
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+var (
+	chunkCacheOnce sync.Once
+	chunkCache     *chunker.Cache
+	chunkCacheErr  error
+)
+
+// readCache returns the process-wide cache of decrypted chunks sized by
+// --cache-size, shared by every read in this process; nil when caching is off
+func readCache(cmd *cobra.Command) (*chunker.Cache, error) {
+	chunkCacheOnce.Do(func() {
+		cacheSize, _ := cmd.Flags().GetString("cache-size")
+		maxBytes, err := util.ParseChunkSize(cacheSize)
+		if err != nil {
+			chunkCacheErr = fmt.Errorf("invalid --cache-size %q: %v", cacheSize, err)
+			return
+		}
+		chunkCache = chunker.NewCache(maxBytes)
+	})
+	return chunkCache, chunkCacheErr
+}
+
+// storeRetryPolicy returns the vault's retry policy for chunk reads and writes,
+// with --max-retries applied
+func storeRetryPolicy(cmd *cobra.Command, vaultConfig *config.VaultConfig) (chunker.RetryPolicy, error) {
+	policy, err := chunker.RetryPolicyFromConfig(vaultConfig.StoreRetry)
+	if err != nil {
+		return chunker.RetryPolicy{}, err
+	}
+	if cmd.Flags().Changed("max-retries") {
+		maxRetries, _ := cmd.Flags().GetInt("max-retries")
+		if maxRetries < 0 {
+			return chunker.RetryPolicy{}, fmt.Errorf("--max-retries must not be negative")
+		}
+		policy.MaxRetries = maxRetries
+	}
+	return policy, nil
+}
+
 func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -42,4 +97,9 @@ func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Disable progress bars and reduce output")
+	rootCmd.PersistentFlags().Int("max-retries", chunker.DefaultRetryPolicy.MaxRetries, "Retries of chunk reads and writes that fail with a transient error; 0 disables retrying (default: the vault's store_retry.max_retries)")
+	rootCmd.PersistentFlags().String("cache-size", "0", "Memory for caching decrypted chunks across reads (e.g. 256MB); 0 disables the cache")
+	rootCmd.PersistentFlags().Bool("auto-recover", false, "Restore a damaged vault.yaml from its latest valid backup without asking")
+	rootCmd.PersistentFlags().Bool("strict", false, "Treat unknown keys in templates, vault.yaml and manifests as errors instead of warnings")
+	rootCmd.PersistentFlags().String("vault", "", "Vault to operate on, by path or registered name (default: $SIETCH_VAULT, the global config's vault, or the vault containing the current directory)")
 }
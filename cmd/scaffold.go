@@ -5,20 +5,46 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
+	"github.com/substantialcattle5/sietch/internal/compression"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/encryption/keys"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
 	"github.com/substantialcattle5/sietch/internal/manifest"
 	"github.com/substantialcattle5/sietch/internal/scaffold"
 	"github.com/substantialcattle5/sietch/internal/validation"
 	"github.com/substantialcattle5/sietch/internal/vault"
+	"github.com/substantialcattle5/sietch/util"
+	"golang.org/x/term"
 )
 
-func runScaffold(templateName, name, path string, force bool) error {
+// scaffoldOptions holds the scaffold command's flag values
+type scaffoldOptions struct {
+	Template          string
+	Name              string
+	Path              string
+	Force             bool
+	OverwriteVault    bool
+	AllowSpecialModes bool
+	DryRun            bool     // Validate and print the plan without writing anything
+	Author            string   // Recorded in the vault metadata; defaults to scaffold.DefaultAuthor
+	Passphrase        bool     // Protect the vault key with a passphrase
+	SyncKeyType       string   // Sync identity key type: rsa (default) or ed25519
+	RSAKeySize        int      // RSA sync key size in bits; zero means constants.DefaultRSAKeySize
+	Set               []string // key=value variables for the template's files
+
+	// cmd supplies --passphrase-stdin and --passphrase-file; may be nil
+	cmd *cobra.Command
+}
+
+func runScaffold(opts scaffoldOptions) error {
+	templateName, name, path := opts.Template, opts.Name, opts.Path
 	// Ensure config directories exist
 	if err := scaffold.EnsureConfigDirectories(); err != nil {
 		return fmt.Errorf("failed to ensure config directories: %v", err)
@@ -29,8 +55,17 @@ func runScaffold(templateName, name, path string, force bool) error {
 		return fmt.Errorf("failed to ensure default templates: %v", err)
 	}
 
+	// Fetch and cache remote templates (URL / git) before loading them
+	if scaffold.IsRemoteTemplate(templateName) {
+		cachedName, err := scaffold.FetchRemoteTemplate(templateName)
+		if err != nil {
+			return fmt.Errorf("failed to fetch remote template: %v", err)
+		}
+		templateName = cachedName
+	}
+
 	// Load and validate the template
-	template, err := scaffold.ValidateTemplate(templateName)
+	template, err := scaffold.ValidateTemplate(templateName, opts.AllowSpecialModes)
 	if err != nil {
 		return fmt.Errorf("failed to validate template: %v", err)
 	}
@@ -49,10 +84,43 @@ func runScaffold(templateName, name, path string, force bool) error {
 	}
 
 	// Prepare vault path and check for existing vault
-	absVaultPath, err := vault.PrepareVaultPath(path, name, force)
+	absVaultPath, err := vault.PrepareVaultPath(path, name, opts.Force, opts.OverwriteVault)
+	if err != nil {
+		return err
+	}
+
+	author, err := resolveScaffoldAuthor(opts.Author, !opts.DryRun)
+	if err != nil {
+		return err
+	}
+
+	// Render file contents before anything is written, so a missing variable
+	// fails the dry run too
+	setVars, err := scaffold.ParseSetFlags(opts.Set)
 	if err != nil {
 		return err
 	}
+	if err := scaffold.RenderFiles(template, scaffold.TemplateVariables(template, name, author, time.Now(), setVars)); err != nil {
+		return fmt.Errorf("failed to render template files: %v", err)
+	}
+
+	usePassphrase := opts.Passphrase || template.Config.Passphrase
+
+	syncKeyType, rsaKeySize := opts.SyncKeyType, opts.RSAKeySize
+	if syncKeyType == "" {
+		syncKeyType = constants.SyncKeyTypeRSA
+	}
+	if rsaKeySize == 0 {
+		rsaKeySize = constants.DefaultRSAKeySize
+	}
+	if err := keys.ValidateSyncKeyOptions(syncKeyType, rsaKeySize); err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		printScaffoldPlan(template, name, author, absVaultPath, usePassphrase, syncKeyDescription(syncKeyType, rsaKeySize))
+		return nil
+	}
 
 	// Create basic vault structure
 	if err := fs.CreateVaultStructure(absVaultPath); err != nil {
@@ -62,7 +130,7 @@ func runScaffold(templateName, name, path string, force bool) error {
 	// Generate encryption key using AES (default for templates)
 	keyParams := validation.KeyGenParams{
 		KeyType:          constants.EncryptionTypeAES,
-		UsePassphrase:    false, // Default no passphrase for scaffolded vaults
+		UsePassphrase:    usePassphrase,
 		KeyFile:          "",
 		AESMode:          constants.AESModeGCM,
 		UseScrypt:        true,
@@ -72,7 +140,13 @@ func runScaffold(templateName, name, path string, force bool) error {
 		PBKDF2Iterations: constants.DefaultPBKDF2Iters,
 	}
 
-	keyConfig, err := validation.HandleKeyGeneration(nil, absVaultPath, keyParams)
+	keyCmd, err := passphraseCommand(opts.cmd, usePassphrase)
+	if err != nil {
+		scaffoldCleanupOnError(absVaultPath)
+		return err
+	}
+
+	keyConfig, err := validation.HandleKeyGeneration(keyCmd, absVaultPath, keyParams)
 	if err != nil {
 		scaffoldCleanupOnError(absVaultPath)
 		return fmt.Errorf("key generation failed: %w", err)
@@ -95,13 +169,13 @@ func runScaffold(templateName, name, path string, force bool) error {
 
 		// Create directory structure for the key if it doesn't exist
 		keyDir := filepath.Dir(keyPath)
-		if err := os.MkdirAll(keyDir, constants.SecureDirPerms); err != nil {
+		if err := private.Mkdir(keyDir); err != nil {
 			scaffoldCleanupOnError(absVaultPath)
 			return fmt.Errorf("failed to create key directory %s: %w", keyDir, err)
 		}
 
 		// Write the key with secure permissions (only owner can read/write)
-		if err := os.WriteFile(keyPath, keyMaterial, constants.SecureFilePerms); err != nil {
+		if err := private.WriteFileAtomic(keyPath, keyMaterial); err != nil {
 			scaffoldCleanupOnError(absVaultPath)
 			return fmt.Errorf("failed to write key to %s: %w", keyPath, err)
 		}
@@ -110,43 +184,26 @@ func runScaffold(templateName, name, path string, force bool) error {
 	}
 
 	// Build vault configuration using template settings
-	cfg := &template.Config
-	configuration := config.BuildVaultConfigWithDeduplication(
-		vaultID,
-		name,
-		"", // Author will be prompted or use default
-		constants.EncryptionTypeAES,
-		keyPath,
-		false, // No passphrase protection for scaffolded vaults
-		cfg.ChunkingStrategy,
-		cfg.ChunkSize,
-		cfg.HashAlgorithm,
-		cfg.Compression,
-		cfg.SyncMode,
-		template.Tags, // Use template tags
-		keyConfig,
-		// Deduplication parameters from template
-		cfg.EnableDedup,
-		cfg.DedupStrategy,
-		cfg.DedupMinSize,
-		cfg.DedupMaxSize,
-		cfg.DedupGCThreshold,
-		cfg.DedupIndexEnabled,
-	)
+	configuration := templateVaultConfig(template, vaultID, name, author, keyPath, usePassphrase, keyConfig)
+	if err := config.ValidateChunkSizes(configuration.Chunking, configuration.Deduplication); err != nil {
+		scaffoldCleanupOnError(absVaultPath)
+		return fmt.Errorf("template %s has invalid chunk sizes: %w", template.Name, err)
+	}
 
-	// Initialize RSA config if not present
+	// Initialize sync key config if not present
 	if configuration.Sync.RSA == nil {
 		configuration.Sync.RSA = &config.RSAConfig{
-			KeySize:      constants.DefaultRSAKeySize,
 			TrustedPeers: []config.TrustedPeer{},
 		}
 	}
+	configuration.Sync.RSA.KeyType = syncKeyType
+	configuration.Sync.RSA.KeySize = rsaKeySize
 
-	// Generate RSA key pair for sync
-	err = keys.GenerateRSAKeyPair(absVaultPath, &configuration)
+	// Generate the sync identity key pair
+	err = keys.GenerateSyncKeyPair(absVaultPath, &configuration)
 	if err != nil {
 		scaffoldCleanupOnError(absVaultPath)
-		return fmt.Errorf("failed to generate RSA keys for sync: %w", err)
+		return fmt.Errorf("failed to generate sync keys: %w", err)
 	}
 
 	// Write configuration to manifest
@@ -155,20 +212,139 @@ func runScaffold(templateName, name, path string, force bool) error {
 		return fmt.Errorf("failed to write vault manifest: %w", err)
 	}
 
+	// Create the template's directories and files
+	if err := scaffold.ApplyTemplateLayout(absVaultPath, template); err != nil {
+		scaffoldCleanupOnError(absVaultPath)
+		return fmt.Errorf("failed to apply template layout: %w", err)
+	}
+
 	// Print success message
 	fmt.Printf("\n✅ Successfully scaffolded '%s' vault at: %s\n", template.Name, absVaultPath)
 	fmt.Printf("📝 Template: %s (v%s)\n", template.Name, template.Version)
-	fmt.Printf("🔐 Encryption: AES-256-GCM\n")
+	fmt.Printf("👤 Author: %s\n", author)
+	if usePassphrase {
+		fmt.Printf("🔐 Encryption: AES-256-GCM (passphrase protected)\n")
+	} else {
+		fmt.Printf("🔐 Encryption: AES-256-GCM\n")
+	}
+	fmt.Printf("🔑 Sync key: %s\n", syncKeyDescription(syncKeyType, rsaKeySize))
+	cfg := &template.Config
 	fmt.Printf("📦 Chunking: %s (%s chunks)\n", cfg.ChunkingStrategy, cfg.ChunkSize)
 	if cfg.EnableDedup {
 		fmt.Printf("♻️  Deduplication: Enabled (%s strategy)\n", cfg.DedupStrategy)
 	}
-	fmt.Printf("🗜️  Compression: %s\n", cfg.Compression)
+	fmt.Printf("🗜️  Compression: %s\n", compression.Describe(cfg.Compression, cfg.CompressionLevel))
+	registerVault(&configuration, absVaultPath)
 	fmt.Printf("\nYour vault is ready to use! Add files with: sietch add <files>\n")
 
 	return nil
 }
 
+// resolveScaffoldAuthor picks the vault author: the --author flag, then the git or
+// login name, then an interactive prompt when allowed and stdin is a terminal
+func resolveScaffoldAuthor(flagAuthor string, allowPrompt bool) (string, error) {
+	author := flagAuthor
+	if author == "" {
+		author = scaffold.DefaultAuthor()
+	}
+	if author == "" && allowPrompt && term.IsTerminal(int(os.Stdin.Fd())) {
+		authorPrompt := promptui.Prompt{
+			Label:     constants.AuthorLabel,
+			Default:   constants.AuthorDefault,
+			AllowEdit: constants.AuthorAllowEdit,
+		}
+		result, err := authorPrompt.Run()
+		if err != nil {
+			return "", fmt.Errorf("prompt failed: %w", err)
+		}
+		author = result
+	}
+
+	// Normalizes whitespace and falls back to "unknown" when still empty
+	author, _, err := validation.ValidateAndPrepareInputs(author, nil, "", "")
+	return author, err
+}
+
+// passphraseCommand returns the command key generation reads passphrase flags from.
+// Passphrase protection requested by a template is applied to the command's
+// --passphrase flag, and a bare command is used when scaffold runs without one.
+func passphraseCommand(cmd *cobra.Command, usePassphrase bool) (*cobra.Command, error) {
+	if cmd == nil {
+		cmd = &cobra.Command{}
+		addScaffoldPassphraseFlags(cmd)
+	}
+	if usePassphrase {
+		if err := cmd.Flags().Set("passphrase", "true"); err != nil {
+			return nil, fmt.Errorf("failed to enable passphrase protection: %v", err)
+		}
+	}
+	return cmd, nil
+}
+
+// printScaffoldPlan describes what scaffold would create for a validated template
+func printScaffoldPlan(template *scaffold.Template, name, author, absVaultPath string, usePassphrase bool, syncKey string) {
+	cfg := &template.Config
+
+	fmt.Printf("\nDry run: nothing will be written and no keys will be generated.\n\n")
+	fmt.Printf("Vault path:   %s\n", absVaultPath)
+	if _, err := os.Stat(filepath.Join(absVaultPath, ".sietch")); err == nil {
+		// PrepareVaultPath let it through, so --force or --overwrite-vault was given
+		fmt.Printf("              (existing vault would be re-initialized)\n")
+	}
+	fmt.Printf("Vault name:   %s\n", name)
+	fmt.Printf("Author:       %s\n", author)
+	fmt.Printf("Template:     %s (v%s)\n", template.Name, template.Version)
+	if usePassphrase {
+		fmt.Printf("Encryption:   AES-256-GCM (new key, passphrase protected), %s key pair for sync\n", syncKey)
+	} else {
+		fmt.Printf("Encryption:   AES-256-GCM (new key), %s key pair for sync\n", syncKey)
+	}
+	fmt.Printf("Chunking:     %s, %s chunks, %s\n", cfg.ChunkingStrategy, cfg.ChunkSize, cfg.HashAlgorithm)
+	for _, policy := range cfg.ChunkPolicies {
+		fmt.Printf("              %s → %s %s\n", policy.Pattern, policy.Strategy, policy.ChunkSize)
+	}
+	fmt.Printf("Compression:  %s\n", compression.Describe(cfg.Compression, cfg.CompressionLevel))
+	for _, policy := range cfg.CompressionPolicies {
+		fmt.Printf("              %s → %s\n", policy.Pattern, compression.Describe(policy.Compression, policy.Level))
+	}
+	if cfg.EnableDedup {
+		fmt.Printf("Dedup:        enabled (%s strategy, %s - %s, index: %t)\n", cfg.DedupStrategy, cfg.DedupMinSize, cfg.DedupMaxSize, cfg.DedupIndexEnabled)
+	} else {
+		fmt.Printf("Dedup:        disabled\n")
+	}
+	fmt.Printf("Sync mode:    %s\n", cfg.SyncMode)
+
+	fmt.Printf("\nDirectories:\n")
+	if len(template.Directories) == 0 {
+		fmt.Printf("  (none)\n")
+	}
+	for _, dir := range template.Directories {
+		rel, _ := scaffold.SanitizeTemplatePath(dir) // already validated
+		fmt.Printf("  %s%c\n", rel, filepath.Separator)
+	}
+
+	fmt.Printf("\nFiles:\n")
+	if len(template.Files) == 0 {
+		fmt.Printf("  (none)\n")
+	}
+	for _, file := range template.Files {
+		rel, _ := scaffold.SanitizeTemplatePath(file.Path)
+		mode := file.Mode
+		if mode == "" {
+			mode = "0644"
+		}
+		fmt.Printf("  %s (%s, %s)\n", rel, mode, util.HumanReadableSize(int64(len(file.Content))))
+	}
+}
+
+// syncKeyDescription names a sync identity key, e.g. "RSA-4096" or "Ed25519"
+func syncKeyDescription(keyType string, rsaKeySize int) string {
+	if keyType == constants.SyncKeyTypeEd25519 {
+		return "Ed25519"
+	}
+	return fmt.Sprintf("RSA-%d", rsaKeySize)
+}
+
 func scaffoldCleanupOnError(absVaultPath string) {
 	// Attempt to clean up partially created vault on error
 	_ = os.RemoveAll(absVaultPath)
@@ -199,12 +375,33 @@ Available Templates:
 Examples:
   List all available templates:
     sietch scaffold --list
+    sietch scaffold --list --output-format json
 
   Create a vault from a template:
     sietch scaffold --template photoVault
     sietch scaffold --template videoVault --name "My Movies"
     sietch scaffold --template documentsVault --name "Work Docs" --path ~/Documents
     sietch scaffold --template codeVault --name "Projects" --path ~/Code --force
+    sietch scaffold --template reporterVault --author "Jane Doe"
+
+  Protect the vault key with a passphrase:
+    sietch scaffold --template reporterVault --passphrase
+    sietch scaffold --template reporterVault --passphrase --passphrase-file ~/.vault-pass
+
+  Choose the sync identity key:
+    sietch scaffold --template photoVault --sync-key-type ed25519
+    sietch scaffold --template photoVault --rsa-key-size 3072
+
+  Fill in variables used by the template's files ({{.VaultName}}, {{.Author}},
+  {{.Date}} and any others the template defines):
+    sietch scaffold --template teamVault --set project=apollo --set team=infra
+
+  Preview what a template would create without writing anything:
+    sietch scaffold --template photoVault --dry-run
+
+  Use a remote template (must be pinned by checksum or commit):
+    sietch scaffold --template "https://example.com/team.json#sha256=<hex>"
+    sietch scaffold --template "git+https://github.com/org/templates.git//team.json@<commit>"
 
   Learn more about templates:
     See ~/.config/sietch/templates/README.md for detailed comparison`,
@@ -213,7 +410,8 @@ Examples:
 		// Check if user wants to list templates
 		list, _ := cmd.Flags().GetBool("list")
 		if list {
-			return scaffold.ListTemplates()
+			outputFormat, _ := cmd.Flags().GetString("output-format")
+			return listTemplates(outputFormat)
 		}
 
 		// Get flag values
@@ -225,19 +423,104 @@ Examples:
 		name, _ := cmd.Flags().GetString("name")
 		path, _ := cmd.Flags().GetString("path")
 		force, _ := cmd.Flags().GetBool("force")
-
-		return runScaffold(template, name, path, force)
+		overwriteVault, _ := cmd.Flags().GetBool("overwrite-vault")
+		allowSpecialModes, _ := cmd.Flags().GetBool("allow-special-modes")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		author, _ := cmd.Flags().GetString("author")
+		usePassphrase, _ := cmd.Flags().GetBool("passphrase")
+		syncKeyType, _ := cmd.Flags().GetString("sync-key-type")
+		rsaKeySize, _ := cmd.Flags().GetInt("rsa-key-size")
+		set, _ := cmd.Flags().GetStringArray("set")
+
+		return runScaffold(scaffoldOptions{
+			Template:          template,
+			Name:              name,
+			Path:              path,
+			Force:             force,
+			OverwriteVault:    overwriteVault,
+			AllowSpecialModes: allowSpecialModes,
+			DryRun:            dryRun,
+			Author:            author,
+			Passphrase:        usePassphrase,
+			SyncKeyType:       syncKeyType,
+			RSAKeySize:        rsaKeySize,
+			Set:               set,
+			cmd:               cmd,
+		})
 	},
 }
 
+// templateVaultConfig builds the vault configuration a template gives a new
+// vault; the diff against a template uses it without a vault ID or key
+func templateVaultConfig(template *scaffold.Template, vaultID, name, author, keyPath string, usePassphrase bool, keyConfig *config.KeyConfig) config.VaultConfig {
+	cfg := &template.Config
+	configuration := config.BuildVaultConfigWithDeduplication(
+		vaultID,
+		name,
+		author,
+		constants.EncryptionTypeAES,
+		keyPath,
+		usePassphrase,
+		cfg.ChunkingStrategy,
+		cfg.ChunkSize,
+		cfg.HashAlgorithm,
+		cfg.Compression,
+		cfg.SyncMode,
+		template.Tags, // Use template tags
+		keyConfig,
+		// Deduplication parameters from template
+		cfg.EnableDedup,
+		cfg.DedupStrategy,
+		cfg.DedupMinSize,
+		cfg.DedupMaxSize,
+		cfg.DedupGCThreshold,
+		cfg.DedupIndexEnabled,
+	)
+
+	configuration.CompressionLevel = cfg.CompressionLevel
+
+	// Carry over per-pattern chunking policies
+	for _, policy := range cfg.ChunkPolicies {
+		configuration.Chunking.Policies = append(configuration.Chunking.Policies, config.ChunkPolicy{
+			Pattern:   policy.Pattern,
+			Strategy:  policy.Strategy,
+			ChunkSize: policy.ChunkSize,
+		})
+	}
+	for _, policy := range cfg.CompressionPolicies {
+		configuration.CompressionPolicies = append(configuration.CompressionPolicies, config.CompressionPolicy{
+			Pattern:     policy.Pattern,
+			Compression: policy.Compression,
+			Level:       policy.Level,
+		})
+	}
+	return configuration
+}
+
 func init() {
 	rootCmd.AddCommand(scaffoldCmd)
 
 	// Add required flags
-	scaffoldCmd.Flags().StringP("template", "t", "", "Template to use for scaffolding (required)")
+	scaffoldCmd.Flags().StringP("template", "t", "", "Template name, HTTPS URL or git reference to use for scaffolding (required)")
 	scaffoldCmd.Flags().StringP("name", "n", "", "Name for the vault (optional)")
 	scaffoldCmd.Flags().StringP("path", "p", "", "Path where to create the vault (optional)")
-	scaffoldCmd.Flags().BoolP("force", "f", false, "Force creation even if directory exists")
+	scaffoldCmd.Flags().BoolP("force", "f", false, "Create the vault over a directory left by an incomplete init; never replaces a working vault")
+	scaffoldCmd.Flags().Bool("overwrite-vault", false, "Replace an existing vault, destroying its data")
 	scaffoldCmd.Flags().BoolP("list", "l", false, "List available templates")
+	scaffoldCmd.Flags().String("output-format", "text", "Output format for --list: text, json or yaml")
+	scaffoldCmd.Flags().Bool("allow-special-modes", false, "Allow template files with setuid, setgid or sticky bits")
+	scaffoldCmd.Flags().String("author", "", "Author recorded in the vault metadata (default: $GIT_AUTHOR_NAME, git user.name or $USER)")
+	scaffoldCmd.Flags().Bool("dry-run", false, "Validate the template and show what would be created without writing anything")
+	scaffoldCmd.Flags().String("sync-key-type", constants.SyncKeyTypeRSA, "Sync identity key type (rsa, ed25519)")
+	scaffoldCmd.Flags().StringArray("set", nil, "Set a variable used in the template's files, as key=value (repeatable)")
+	scaffoldCmd.Flags().Int("rsa-key-size", constants.DefaultRSAKeySize, "RSA sync key size in bits (2048, 3072, 4096)")
+	addScaffoldPassphraseFlags(scaffoldCmd)
+	_ = scaffoldCmd.RegisterFlagCompletionFunc("template", completeTemplateNames)
+}
 
+// addScaffoldPassphraseFlags registers the flags read by ui.GetPassphraseForInitialization
+func addScaffoldPassphraseFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("passphrase", false, "Protect the vault key with a passphrase")
+	cmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	cmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 }
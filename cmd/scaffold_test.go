@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/scaffold"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+const scaffoldTestTemplate = `{
+  "name": "Test Vault",
+  "description": "Scaffold test template",
+  "version": "1.0.0",
+  "config": {"chunking_strategy": "fixed", "chunk_size": "4MB", "hash_algorithm": "sha256", "compression": "gzip", "sync_mode": "manual"},
+  "directories": ["photos/raw"],
+  "files": [{"path": "scripts/run.sh", "content": "#!/bin/sh\n", "mode": "0755"}]
+}`
+
+// installScaffoldTemplate writes a template into the user templates directory under a temporary HOME
+func installScaffoldTemplate(t *testing.T, name, data string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if err := scaffold.EnsureConfigDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	templatesDir, err := scaffold.GetTemplatesDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templatesDir, name+".json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunScaffoldDryRun(t *testing.T) {
+	installScaffoldTemplate(t, "testVault", scaffoldTestTemplate)
+	parent := t.TempDir()
+
+	var runErr error
+	out := captureStdout(t, func() {
+		runErr = runScaffold(scaffoldOptions{Template: "testVault", Name: "preview", Path: parent, DryRun: true})
+	})
+	if runErr != nil {
+		t.Fatalf("runScaffold() dry run error: %v", runErr)
+	}
+
+	if _, err := os.Stat(filepath.Join(parent, "preview")); !os.IsNotExist(err) {
+		t.Errorf("dry run created the vault directory (stat err: %v)", err)
+	}
+	for _, want := range []string{"Dry run", filepath.Join(parent, "preview"), filepath.FromSlash("photos/raw"), filepath.FromSlash("scripts/run.sh") + " (0755"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry run output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunScaffoldRendersVariables(t *testing.T) {
+	installScaffoldTemplate(t, "teamVault", `{"name": "Team", "description": "x", "version": "1.0.0",
+		"config": {"chunk_size": "4MB", "hash_algorithm": "sha256", "compression": "none"},
+		"variables": {"team": "core"},
+		"files": [{"path": "README.md", "content": "# {{.VaultName}}\n{{.project}} by {{.team}}, {{.Author}}\n"}]}`)
+	parent := t.TempDir()
+
+	var runErr error
+	captureStdout(t, func() {
+		runErr = runScaffold(scaffoldOptions{Template: "teamVault", Name: "missing", Path: parent, Author: "Jane", DryRun: true})
+	})
+	if runErr == nil || !strings.Contains(runErr.Error(), "undefined variable project") {
+		t.Errorf("runScaffold() without --set project error = %v, want an undefined variable error", runErr)
+	}
+
+	captureStdout(t, func() {
+		runErr = runScaffold(scaffoldOptions{Template: "teamVault", Name: "docs", Path: parent, Author: "Jane", Set: []string{"project=apollo"}})
+	})
+	if runErr != nil {
+		t.Fatalf("runScaffold() error: %v", runErr)
+	}
+	readme, err := os.ReadFile(filepath.Join(parent, "docs", "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# docs\napollo by core, Jane\n"; string(readme) != want {
+		t.Errorf("README.md = %q, want %q", readme, want)
+	}
+}
+
+func TestRunScaffoldRecordsAuthor(t *testing.T) {
+	installScaffoldTemplate(t, "testVault", scaffoldTestTemplate)
+	parent := t.TempDir()
+
+	var runErr error
+	captureStdout(t, func() {
+		runErr = runScaffold(scaffoldOptions{Template: "testVault", Name: "authored", Path: parent, Author: "  Jane\tDoe "})
+	})
+	if runErr != nil {
+		t.Fatalf("runScaffold() error: %v", runErr)
+	}
+
+	vaultConfig, err := config.LoadVaultConfig(filepath.Join(parent, "authored"))
+	if err != nil {
+		t.Fatalf("LoadVaultConfig() error: %v", err)
+	}
+	if vaultConfig.Metadata.Author != "Jane Doe" {
+		t.Errorf("author = %q, want %q", vaultConfig.Metadata.Author, "Jane Doe")
+	}
+}
+
+func TestRunScaffoldWithPassphrase(t *testing.T) {
+	installScaffoldTemplate(t, "testVault", scaffoldTestTemplate)
+	t.Setenv("SIETCH_PASSPHRASE", "Correct-Horse-Battery-Staple-42")
+	parent := t.TempDir()
+
+	var runErr error
+	captureStdout(t, func() {
+		runErr = runScaffold(scaffoldOptions{Template: "testVault", Name: "locked", Path: parent, Passphrase: true})
+	})
+	if runErr != nil {
+		t.Fatalf("runScaffold() error: %v", runErr)
+	}
+
+	vaultRoot := filepath.Join(parent, "locked")
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatalf("LoadVaultConfig() error: %v", err)
+	}
+	if !vaultConfig.Encryption.PassphraseProtected {
+		t.Fatal("expected the scaffolded vault to be passphrase protected")
+	}
+
+	// Chunks must round-trip with the passphrase
+	opts, err := chunker.OptionsFromConfig(vaultRoot, *vaultConfig, "Correct-Horse-Battery-Staple-42")
+	if err != nil {
+		t.Fatalf("OptionsFromConfig() error: %v", err)
+	}
+	ref, encoded, err := chunker.Encode([]byte("secret data"), 0, opts)
+	if err != nil {
+		t.Fatalf("Encode() error: %v", err)
+	}
+	if got, err := chunker.Decode(ref, encoded, opts); err != nil || string(got) != "secret data" {
+		t.Errorf("Decode() = %q, %v", got, err)
+	}
+}
+
+func TestRunScaffoldSyncKeyType(t *testing.T) {
+	installScaffoldTemplate(t, "testVault", scaffoldTestTemplate)
+	parent := t.TempDir()
+
+	var runErr error
+	captureStdout(t, func() {
+		runErr = runScaffold(scaffoldOptions{Template: "testVault", Name: "ed", Path: parent, SyncKeyType: "ed25519"})
+	})
+	if runErr != nil {
+		t.Fatalf("runScaffold() error: %v", runErr)
+	}
+
+	vaultConfig, err := config.LoadVaultConfig(filepath.Join(parent, "ed"))
+	if err != nil {
+		t.Fatalf("LoadVaultConfig() error: %v", err)
+	}
+	if got := vaultConfig.Sync.RSA.KeyType; got != "ed25519" {
+		t.Errorf("sync key type = %q, want ed25519", got)
+	}
+
+	// Unsupported RSA sizes are rejected before anything is written
+	captureStdout(t, func() {
+		runErr = runScaffold(scaffoldOptions{Template: "testVault", Name: "odd", Path: parent, RSAKeySize: 1024})
+	})
+	if runErr == nil {
+		t.Error("expected an unsupported RSA key size to fail")
+	}
+	if _, err := os.Stat(filepath.Join(parent, "odd", ".sietch")); err == nil {
+		t.Error("vault was created despite the invalid key size")
+	}
+}
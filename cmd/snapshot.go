@@ -0,0 +1,293 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// snapshotCmd records the current file manifests as a snapshot
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Capture the vault's current state as a snapshot",
+	Long: `Capture a point-in-time copy of the vault's file manifests.
+
+Snapshots are stored in .sietch/snapshots/<timestamp>/. Chunks are content
+addressed and shared with the live vault, so a snapshot only stores manifests.
+Chunks referenced by a snapshot are kept by 'sietch delete' and 'sietch dedup gc'
+until the snapshot is deleted.
+
+Examples:
+  sietch snapshot                          # Snapshot the vault
+  sietch snapshot -m "before cleanup"      # Snapshot with a message
+  sietch snapshot list                     # List snapshots
+  sietch snapshot restore 20250101T120000Z # Roll back to a snapshot`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		message, _ := cmd.Flags().GetString("message")
+		snap, err := snapshot.Create(vaultRoot, message)
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot: %v", err)
+		}
+
+		fmt.Printf("✓ Created snapshot %s (%d files, %s)\n", snap.ID, snap.Files, util.HumanReadableSize(snap.Size))
+		return nil
+	},
+}
+
+// snapshotListCmd lists the vault's snapshots
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	Long: `List the vault's snapshots, oldest first.
+
+Examples:
+  sietch snapshot list
+  sietch snapshot list -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		snapshots, err := snapshot.List(vaultRoot)
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			if snapshots == nil {
+				snapshots = []*snapshot.Snapshot{}
+			}
+			data, err := json.MarshalIndent(snapshots, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode snapshots: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(snapshots) == 0 {
+			fmt.Println("No snapshots. Create one with 'sietch snapshot'.")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tFILES\tSIZE\tMESSAGE")
+		for _, snap := range snapshots {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", snap.ID, snap.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+				snap.Files, util.HumanReadableSize(snap.Size), snap.Message)
+		}
+		return w.Flush()
+	},
+}
+
+// snapshotRestoreCmd rolls the vault back to a snapshot
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Roll the vault back to a snapshot",
+	Long: `Replace the vault's file manifests with those recorded in a snapshot.
+
+Files added after the snapshot are removed from the vault and files deleted
+since are restored. The current state is snapshotted first so the restore can
+itself be undone; pass --no-backup to skip this.
+
+Examples:
+  sietch snapshot restore 20250101T120000Z
+  sietch snapshot restore 20250101T120000Z --force`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := args[0]
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		snap, err := snapshot.Get(vaultRoot, id)
+		if err != nil {
+			return err
+		}
+
+		if err := snapshot.CheckRestorable(vaultRoot, snap.ID); err != nil {
+			return err
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+		if !force {
+			fmt.Printf("Restore the vault to snapshot %s (%d files)? (y/N): ", snap.ID, snap.Files)
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+			if response != "y" && response != "yes" {
+				fmt.Println("Operation canceled")
+				return nil
+			}
+		}
+
+		noBackup, _ := cmd.Flags().GetBool("no-backup")
+		if !noBackup {
+			backup, err := snapshot.Create(vaultRoot, "before restore of "+snap.ID)
+			if err != nil {
+				return fmt.Errorf("failed to snapshot current state: %v", err)
+			}
+			fmt.Printf("✓ Saved current state as snapshot %s\n", backup.ID)
+		}
+
+		result, err := snapshot.Restore(vaultRoot, snap.ID)
+		if err != nil {
+			return fmt.Errorf("restore failed: %v", err)
+		}
+
+		// Reference counts follow the manifests, so the index is rebuilt from them
+		if vaultConfig.Deduplication.Enabled {
+			if _, err := deduplication.RebuildIndex(vaultRoot, vaultConfig.Deduplication); err != nil {
+				return fmt.Errorf("restored snapshot but failed to rebuild deduplication index: %v (run 'sietch index rebuild')", err)
+			}
+		}
+
+		fmt.Printf("✓ Restored snapshot %s: %d files restored, %d removed\n", snap.ID, result.Restored, result.Removed)
+		return nil
+	},
+}
+
+// snapshotDiffCmd compares two snapshots, or a snapshot and the live vault
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff <from> [to]",
+	Short: "Show the files that changed between two snapshots",
+	Long: `List the files added, removed and modified between two snapshots, with the
+number of chunks each modified file gained, lost and kept. Without <to>, the
+snapshot is compared with the vault's current state; either side may also be
+given as "current".
+
+Examples:
+  sietch snapshot diff 20250101T120000Z                   # Changes since a snapshot
+  sietch snapshot diff 20250101T120000Z 20250201T120000Z  # Changes between two snapshots
+  sietch snapshot diff 20250101T120000Z --json`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			outputFormat = "json"
+		}
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		to := ""
+		if len(args) == 2 {
+			to = args[1]
+		}
+		diff, err := snapshot.Compare(vaultRoot, args[0], to)
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(diff, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode diff: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		fmt.Printf("Comparing %s → %s\n\n", diff.From, diff.To)
+		if len(diff.Changes) == 0 {
+			fmt.Printf("No changes (%d files unchanged)\n", diff.Unchanged)
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, change := range diff.Changes {
+			switch change.Status {
+			case snapshot.StatusAdded:
+				fmt.Fprintf(w, "+ %s\t%s\t%d chunks\n", change.Path, util.HumanReadableSize(change.NewSize), change.ChunksAdded)
+			case snapshot.StatusRemoved:
+				fmt.Fprintf(w, "- %s\t%s\t%d chunks\n", change.Path, util.HumanReadableSize(change.OldSize), change.ChunksRemoved)
+			default:
+				fmt.Fprintf(w, "~ %s\t%s → %s\t+%d -%d chunks, %d unchanged\n", change.Path,
+					util.HumanReadableSize(change.OldSize), util.HumanReadableSize(change.NewSize),
+					change.ChunksAdded, change.ChunksRemoved, change.ChunksShared)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("\n%d added, %d removed, %d modified, %d unchanged\n",
+			diff.Count(snapshot.StatusAdded), diff.Count(snapshot.StatusRemoved),
+			diff.Count(snapshot.StatusModified), diff.Unchanged)
+		return nil
+	},
+}
+
+// snapshotDeleteCmd removes a snapshot
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a snapshot",
+	Long: `Delete a snapshot. Chunks referenced only by the snapshot are no longer
+protected and are removed by later deletes and 'sietch dedup gc'.
+
+Example:
+  sietch snapshot delete 20250101T120000Z`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if err := snapshot.Delete(vaultRoot, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Deleted snapshot %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+
+	snapshotCmd.Flags().StringP("message", "m", "", "Describe the snapshot")
+	snapshotListCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	snapshotDiffCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	snapshotDiffCmd.Flags().Bool("json", false, "Shorthand for --output json")
+	snapshotRestoreCmd.Flags().BoolP("force", "f", false, "Restore without confirmation")
+	snapshotRestoreCmd.Flags().Bool("no-backup", false, "Do not snapshot the current state before restoring")
+}
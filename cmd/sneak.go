@@ -89,7 +89,7 @@ Examples:
 		displayAnalysis(analysis)
 
 		// Check if there's anything to transfer
-		if len(analysis.NewFiles) == 0 && len(analysis.NewChunks) == 0 {
+		if len(analysis.NewFiles) == 0 && len(analysis.NewChunks) == 0 && len(analysis.NewPacks) == 0 && len(analysis.NewDicts) == 0 {
 			fmt.Println("✅ Nothing to transfer - vaults are already in sync!")
 			return nil
 		}
@@ -134,6 +134,12 @@ func displayAnalysis(analysis *sneakernet.SneakAnalysis) {
 	fmt.Printf("New files:        %d files\n", len(analysis.NewFiles))
 	fmt.Printf("New chunks:       %d chunks (%s)\n", len(analysis.NewChunks), util.HumanReadableSize(analysis.TransferSize))
 	fmt.Printf("Duplicate chunks: %d chunks (%s - will skip)\n", len(analysis.DuplicateChunks), util.HumanReadableSize(analysis.DuplicateSize))
+	if len(analysis.NewPacks) > 0 {
+		fmt.Printf("New packs:        %d packs\n", len(analysis.NewPacks))
+	}
+	if len(analysis.NewDicts) > 0 {
+		fmt.Printf("New dictionaries: %d\n", len(analysis.NewDicts))
+	}
 
 	if len(analysis.Conflicts) > 0 {
 		fmt.Printf("Conflicts:        %d files (need resolution)\n", len(analysis.Conflicts))
@@ -211,6 +217,12 @@ func displayTransferResults(result *sneakernet.TransferResult) {
 	fmt.Printf("   Files transferred:    %d\n", result.FilesTransferred)
 	fmt.Printf("   Chunks transferred:   %d\n", result.ChunksTransferred)
 	fmt.Printf("   Chunks skipped:       %d (already present)\n", result.ChunksSkipped)
+	if result.PacksTransferred > 0 {
+		fmt.Printf("   Packs transferred:    %d\n", result.PacksTransferred)
+	}
+	if result.DictsTransferred > 0 {
+		fmt.Printf("   Dictionaries:         %d\n", result.DictsTransferred)
+	}
 	fmt.Printf("   Data transferred:     %s\n", util.HumanReadableSize(result.BytesTransferred))
 	fmt.Printf("   Duration:             %s\n", result.Duration.Round(time.Millisecond))
 
@@ -0,0 +1,392 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/internal/stats"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// statusOutput is the JSON output of 'sietch status'
+type statusOutput struct {
+	Name                string             `json:"name"`
+	ID                  string             `json:"id"`
+	Path                string             `json:"path"`
+	Tags                []string           `json:"tags"`
+	Metadata            map[string]string  `json:"metadata,omitempty"` // Freeform fields set with 'vault meta set'
+	ReadOnly            bool               `json:"read_only"`          // Frozen with 'vault freeze'
+	Encryption          string             `json:"encryption"`
+	PassphraseProtected bool               `json:"passphrase_protected"`
+	Chunking            chunkingStatus     `json:"chunking"`
+	Compression         string             `json:"compression"`
+	Deduplication       string             `json:"deduplication"` // Strategy, or "disabled"
+	Stats               *stats.Stats       `json:"stats"`         // Nil while a writer holds the vault and nothing is cached
+	Reclaimable         *stats.Reclaimable `json:"reclaimable,omitempty"`
+	StatsComputedAt     *time.Time         `json:"stats_computed_at,omitempty"`
+	LastAdd             *time.Time         `json:"last_add,omitempty"`
+	LastSync            *time.Time         `json:"last_sync,omitempty"`
+	Peers               []peerStatus       `json:"peers"`
+	Problems            []string           `json:"problems"`
+}
+
+// chunkingStatus is how the vault splits files
+type chunkingStatus struct {
+	Strategy      string `json:"strategy"`
+	ChunkSize     string `json:"chunk_size"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	Policies      int    `json:"policies"` // Per-pattern overrides
+}
+
+// peerStatus is a trusted peer and when the vault last synced with it
+type peerStatus struct {
+	Name     string     `json:"name"`
+	ID       string     `json:"id"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// statusCmd summarizes the vault and the space it takes
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show a summary of the vault",
+	Long: `Show the vault's settings, what it holds, what it takes on disk, when it was
+last added to and synced, its trusted peers, and any problems found: a
+missing key file, a lock held by another process, files marked damaged, or a
+vault.yaml or chunk layout that needs migrating.
+
+Sizes are computed from the file manifests, counting every stored chunk once:
+- Logical size: the sum of the sizes of all files
+- Compression: chunk bytes before and after compression, and the ratio
+- On disk: the chunk files, encryption overhead included, and any packs
+- Reclaimable: unreferenced chunks 'sietch dedup gc' would delete
+
+Chunks written by older versions of sietch do not record their compressed
+size; they are left out of the compression ratio, which shows as unknown when
+no chunk records it, and measured on disk instead.
+
+The sizes are cached in .sietch/status.json and only recomputed after a
+command has changed the vault, so status stays fast on large vaults; --refresh
+recomputes them anyway. While another process writes to the vault, the cached
+sizes are shown as they are.
+
+Example:
+  sietch status
+  sietch status --refresh
+  sietch status -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		refresh, _ := cmd.Flags().GetBool("refresh")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+		// Read before loading, which migrates the configuration
+		schemaVersion, err := config.VaultSchemaVersion(vaultRoot)
+		if err != nil {
+			return err
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		// status probes the lock without keeping it, so a writer is reported rather
+		// than waited for, and one starting meanwhile is not turned away
+		problems := statusProblems(vaultRoot, vaultConfig, schemaVersion)
+		l, err := lock.Acquire(vaultRoot, lock.Shared, cmd.CommandPath())
+		locked := errors.Is(err, lock.ErrLocked)
+		switch {
+		case locked:
+			problems = append(problems, err.Error())
+		case err != nil:
+			return err
+		default:
+			_ = l.Release()
+		}
+
+		cachedAt := countersModTime(vaultRoot)
+		counters, err := stats.LoadCounters(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if (counters.Stats == nil || refresh) && !locked {
+			if err := refreshCounters(vaultRoot, vaultConfig, counters, cachedAt); err != nil {
+				return err
+			}
+		}
+		if counters.Stats != nil && counters.Stats.DamagedFiles > 0 {
+			problems = append(problems, fmt.Sprintf("%d files are marked damaged; see 'sietch fsck'", counters.Stats.DamagedFiles))
+		}
+
+		status := buildStatus(vaultRoot, vaultConfig, counters, problems)
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode status: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		displayStatus(vaultConfig, vaultRoot, status)
+		return nil
+	},
+}
+
+// refreshCounters recomputes the vault's statistics and caches them, unless a
+// command changed the vault after the counters were read at cachedAt
+func refreshCounters(vaultRoot string, vaultConfig *config.VaultConfig, counters *stats.Counters, cachedAt time.Time) error {
+	vaultStats, err := stats.Compute(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to compute vault statistics: %v", err)
+	}
+	counters.Stats, counters.Reclaimable = vaultStats, nil
+	counters.ComputedAt = time.Now().UTC()
+	if vaultConfig.Deduplication.Enabled {
+		if dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication); err == nil {
+			dedupStats := dedupManager.GetStats()
+			counters.Reclaimable = &stats.Reclaimable{Chunks: dedupStats.UnreferencedChunks, Bytes: dedupStats.UnreferencedSize}
+		}
+	}
+	if err := cacheCounters(vaultRoot, counters, cachedAt); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache vault statistics: %v\n", err)
+	}
+	return nil
+}
+
+// cacheCounters saves counters recomputed without holding the vault lock. They
+// are not saved while a writer holds the vault, or when one changed it after
+// they were read at cachedAt, as they may miss its changes.
+func cacheCounters(vaultRoot string, counters *stats.Counters, cachedAt time.Time) error {
+	l, err := lock.Acquire(vaultRoot, lock.Shared, "sietch status")
+	if errors.Is(err, lock.ErrLocked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	if !countersModTime(vaultRoot).Equal(cachedAt) {
+		return nil
+	}
+	return stats.SaveCounters(vaultRoot, counters)
+}
+
+// countersModTime returns when the vault's counters were last written, or the
+// zero time when they never were
+func countersModTime(vaultRoot string) time.Time {
+	info, err := os.Stat(stats.CountersPath(vaultRoot))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// statusProblems lists what stops the vault from working as configured
+func statusProblems(vaultRoot string, vaultConfig *config.VaultConfig, schemaVersion int) []string {
+	problems := []string{}
+	enc := vaultConfig.Encryption
+	if (enc.Type == constants.EncryptionTypeAES || enc.Type == constants.EncryptionTypeChaCha20) && enc.KeyPath != "" {
+		if _, err := os.Stat(enc.KeyPath); err != nil && !encryption.UnlocksWithIdentity(enc) {
+			problems = append(problems, fmt.Sprintf("key file %s is missing", enc.KeyPath))
+		}
+	}
+	if schemaVersion < constants.VaultSchemaVersion {
+		problems = append(problems, fmt.Sprintf("vault.yaml uses schema version %d of %d; run 'sietch vault migrate'", schemaVersion, constants.VaultSchemaVersion))
+	}
+	if layout.SharedStore(vaultRoot) == "" && layout.Version(vaultRoot) < constants.CurrentChunkLayout {
+		problems = append(problems, "chunks use the flat layout; run 'sietch vault migrate-layout'")
+	}
+	return problems
+}
+
+// buildStatus gathers what status reports
+func buildStatus(vaultRoot string, vaultConfig *config.VaultConfig, counters *stats.Counters, problems []string) *statusOutput {
+	status := &statusOutput{
+		Name:                vaultConfig.Name,
+		ID:                  vaultConfig.VaultID,
+		Path:                vaultRoot,
+		Tags:                append([]string{}, vaultConfig.Metadata.Tags...),
+		Metadata:            vaultConfig.Metadata.Fields,
+		ReadOnly:            vaultConfig.ReadOnly,
+		Encryption:          vaultConfig.Encryption.Type,
+		PassphraseProtected: vaultConfig.Encryption.PassphraseProtected,
+		Chunking: chunkingStatus{
+			Strategy:      vaultConfig.Chunking.Strategy,
+			ChunkSize:     vaultConfig.Chunking.ChunkSize,
+			HashAlgorithm: vaultConfig.Chunking.HashAlgorithm,
+			Policies:      len(vaultConfig.Chunking.Policies),
+		},
+		Compression:     vaultConfig.Compression,
+		Deduplication:   "disabled",
+		Stats:           counters.Stats,
+		Reclaimable:     counters.Reclaimable,
+		StatsComputedAt: optionalTime(counters.ComputedAt),
+		LastAdd:         optionalTime(counters.LastAdd),
+		LastSync:        optionalTime(counters.LastSync),
+		Peers:           []peerStatus{},
+		Problems:        problems,
+	}
+	if vaultConfig.Deduplication.Enabled {
+		status.Deduplication = vaultConfig.Deduplication.Strategy
+		if status.Deduplication == "" {
+			status.Deduplication = constants.DedupStrategyContent
+		}
+	}
+	for _, peer := range trustedPeers(vaultConfig) {
+		status.Peers = append(status.Peers, peerStatus{Name: peerName(peer), ID: peer.ID, LastSeen: optionalTime(counters.PeersSeen[peer.ID])})
+	}
+	return status
+}
+
+// optionalTime returns nil for the zero time, which is left out of JSON
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// formatStatusTime shows a recorded time, or "never"
+func formatStatusTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func displayStatus(vaultConfig *config.VaultConfig, vaultRoot string, status *statusOutput) {
+	fmt.Printf("Vault:         %s (%s)\n", vaultConfig.Name, vaultRoot)
+	fmt.Printf("ID:            %s\n", status.ID)
+	if len(status.Tags) > 0 {
+		fmt.Printf("Tags:          %s\n", strings.Join(status.Tags, ", "))
+	}
+	if len(status.Metadata) > 0 {
+		keys := make([]string, 0, len(status.Metadata))
+		for key := range status.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = key + "=" + status.Metadata[key]
+		}
+		fmt.Printf("Metadata:      %s\n", strings.Join(fields, ", "))
+	}
+	if status.ReadOnly {
+		fmt.Println("Read-only:     yes (run 'sietch vault thaw' to change the vault)")
+	}
+	encryption := status.Encryption
+	switch {
+	case encryption == constants.EncryptionTypeNone:
+	case status.PassphraseProtected:
+		encryption += " (passphrase protected)"
+	default:
+		encryption += " (no passphrase)"
+	}
+	fmt.Printf("Encryption:    %s\n", encryption)
+	fmt.Printf("Chunking:      %s, %s chunks, %s", vaultConfig.Chunking.Strategy, vaultConfig.Chunking.ChunkSize, vaultConfig.Chunking.HashAlgorithm)
+	if len(vaultConfig.Chunking.Policies) > 0 {
+		fmt.Printf(" (%d per-pattern policies)", len(vaultConfig.Chunking.Policies))
+	}
+	fmt.Println()
+	fmt.Printf("Deduplication: %s\n", status.Deduplication)
+
+	s := status.Stats
+	if s == nil {
+		fmt.Printf("Compression:   %s\n", vaultConfig.Compression)
+		fmt.Println("Files:         unknown until the vault is unlocked")
+	} else {
+		displayStats(vaultConfig, s)
+		if status.Reclaimable != nil && status.Reclaimable.Chunks > 0 {
+			fmt.Printf("Reclaimable:   %s in %d unreferenced chunk(s); run 'sietch dedup gc'\n",
+				util.HumanReadableSize(status.Reclaimable.Bytes), status.Reclaimable.Chunks)
+		}
+	}
+
+	fmt.Printf("Last add:      %s\n", formatStatusTime(status.LastAdd))
+	fmt.Printf("Last sync:     %s\n", formatStatusTime(status.LastSync))
+	if len(status.Peers) == 0 {
+		fmt.Println("Peers:         none")
+	} else {
+		fmt.Println("Peers:")
+		for _, peer := range status.Peers {
+			fmt.Printf("  %-20s last seen %s\n", peer.Name, formatStatusTime(peer.LastSeen))
+		}
+	}
+
+	if len(status.Problems) == 0 {
+		fmt.Println("Problems:      none")
+	} else {
+		fmt.Println("Problems:")
+		for _, problem := range status.Problems {
+			fmt.Printf("  ✗ %s\n", problem)
+		}
+	}
+	if status.StatsComputedAt != nil {
+		fmt.Printf("\nSizes as of %s; 'sietch status --refresh' recomputes them\n", formatStatusTime(status.StatsComputedAt))
+	}
+}
+
+// displayStats prints what the vault holds and what it takes on disk
+func displayStats(vaultConfig *config.VaultConfig, s *stats.Stats) {
+	if s.PackedFiles > 0 {
+		fmt.Printf("Files:         %d (%d packed)\n", s.Files, s.PackedFiles)
+	} else {
+		fmt.Printf("Files:         %d\n", s.Files)
+	}
+	fmt.Printf("Logical size:  %s\n", util.HumanReadableSize(s.LogicalSize))
+	fmt.Printf("Chunks:        %d\n", s.Chunks)
+
+	if ratio, ok := s.CompressionRatio(); ok {
+		fmt.Printf("Compression:   %s -> %s (%.2fx, %.1f%% saved, %s)\n",
+			util.HumanReadableSize(s.ChunkBytes), util.HumanReadableSize(s.CompressedBytes),
+			ratio, 100*(1-1/ratio), vaultConfig.Compression)
+	} else {
+		fmt.Printf("Compression:   unknown (%s)\n", vaultConfig.Compression)
+	}
+	if s.UnknownChunks > 0 {
+		fmt.Printf("               %d chunk(s) written without size information are not counted\n", s.UnknownChunks)
+	}
+
+	fmt.Printf("On disk:       %s\n", util.HumanReadableSize(s.DiskBytes()))
+	fmt.Printf("  chunks:      %s", util.HumanReadableSize(s.StoredBytes))
+	if s.EncryptionBytes > 0 {
+		fmt.Printf(" (%s encryption overhead)", util.HumanReadableSize(s.EncryptionBytes))
+	}
+	fmt.Println()
+	if s.Packs > 0 {
+		fmt.Printf("  packs:       %s in %d pack(s)\n", util.HumanReadableSize(s.PackBytes), s.Packs)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	statusCmd.Flags().Bool("refresh", false, "Recompute the sizes instead of using the cached ones")
+}
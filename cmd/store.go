@@ -0,0 +1,362 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/sharedstore"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// storeCmd groups commands that manage a chunk store shared between vaults
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Share one chunk store between several vaults",
+	Long: `Share one chunk store between several vaults on the same machine or NAS.
+
+Vaults joined to a shared store keep their own manifests but write chunks to the
+store, with a common deduplication index, so a chunk present in any of them is
+stored once. The store records the participating vaults in its registry;
+'sietch dedup gc' only removes a chunk once none of them references it.
+
+Every vault of a store must use the same encryption key, compression, hash
+algorithm and dedup size range. Encrypted stores rely on a shared key you
+provision yourself: create the other vaults with the same key
+('sietch init --key-file <key>'). Anyone holding that key can read the chunks of
+every vault in the store, and the chunk hashes in the common index reveal which
+vaults hold the same content. Keep vaults with different owners or trust levels
+in separate stores.
+
+Examples:
+  sietch store init /mnt/nas/sietch-store   # Create a store and move this vault's chunks into it
+  sietch store join /mnt/nas/sietch-store   # Join another vault to the store
+  sietch store status
+  sietch store leave                        # Copy this vault's chunks back and leave`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// storeInitCmd creates a shared store from the current vault's settings
+var storeInitCmd = &cobra.Command{
+	Use:   "init <path>",
+	Short: "Create a shared chunk store and join this vault to it",
+	Long: `Create a shared chunk store at <path> using this vault's encryption,
+compression and deduplication settings, then join this vault to it.
+
+Example:
+  sietch store init /mnt/nas/sietch-store`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, err := loadStoreVault()
+		if err != nil {
+			return err
+		}
+		if vaultConfig.SharedStore.Path != "" {
+			return fmt.Errorf("vault already uses the shared store %s", vaultConfig.SharedStore.Path)
+		}
+		if !vaultConfig.Deduplication.Enabled {
+			return fmt.Errorf("deduplication must be enabled to use a shared store")
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		storeConfig := sharedstore.ConfigFor(vaultConfig)
+		if storeConfig.KeyScheme == constants.SharedStoreKeyShared {
+			storeConfig.KeyProbe, err = encryption.EncryptDataWithPassphrase(constants.KeyValidationString, *vaultConfig, passphrase)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt key probe: %v", err)
+			}
+		}
+
+		store, err := sharedstore.Create(args[0], storeConfig)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Created shared store at %s (%s)\n", store.Path, describeKeyScheme(store.Config.KeyScheme))
+		return joinSharedStore(store, vaultRoot, vaultConfig)
+	},
+}
+
+// storeJoinCmd joins the current vault to an existing shared store
+var storeJoinCmd = &cobra.Command{
+	Use:   "join <path>",
+	Short: "Join this vault to an existing shared chunk store",
+	Long: `Join this vault to the shared chunk store at <path>.
+
+The vault must match the store's settings and, for encrypted stores, hold the
+same encryption key. The vault's chunks are moved into the store; chunks the
+store already holds are dropped from the vault.
+
+Example:
+  sietch store join /mnt/nas/sietch-store`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, err := loadStoreVault()
+		if err != nil {
+			return err
+		}
+		if vaultConfig.SharedStore.Path != "" {
+			return fmt.Errorf("vault already uses the shared store %s", vaultConfig.SharedStore.Path)
+		}
+
+		store, err := sharedstore.Open(args[0])
+		if err != nil {
+			return err
+		}
+		if err := store.CheckCompatible(vaultConfig); err != nil {
+			return err
+		}
+		if store.Config.KeyScheme == constants.SharedStoreKeyShared {
+			passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+			if err != nil {
+				return err
+			}
+			probe, err := encryption.DecryptDataWithPassphrase(store.Config.KeyProbe, vaultRoot, passphrase)
+			if err != nil || probe != constants.KeyValidationString {
+				return fmt.Errorf("%w: the vault's encryption key differs from the store's shared key", sharedstore.ErrIncompatible)
+			}
+		}
+
+		return joinSharedStore(store, vaultRoot, vaultConfig)
+	},
+}
+
+// storeLeaveCmd moves the current vault back to its own chunk directory
+var storeLeaveCmd = &cobra.Command{
+	Use:   "leave",
+	Short: "Copy this vault's chunks out of the shared store and leave it",
+	Long: `Copy every chunk this vault references (including from snapshots) out of the
+shared store into the vault, then unregister the vault. The copied chunks stay
+in the store for the other vaults; 'sietch dedup gc' in a remaining vault
+removes those no longer referenced.
+
+Example:
+  sietch store leave`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, err := loadStoreVault()
+		if err != nil {
+			return err
+		}
+		store, err := sharedstore.ForVault(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if store == nil {
+			return fmt.Errorf("vault does not use a shared store")
+		}
+
+		referenced, err := sharedstore.ReferencedBy(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to collect chunk references: %v", err)
+		}
+		copied, missing, err := store.ExportChunks(vaultRoot, referenced)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Copied %d chunks into the vault\n", copied)
+		if len(missing) > 0 {
+			// References are collected by both plaintext and storage hash, so only
+			// chunks missing under every name matter; verify reports those below
+			fmt.Printf("  %d referenced names were not found in the store\n", len(missing))
+		}
+
+		if err := store.Unregister(vaultConfig.VaultID); err != nil {
+			return err
+		}
+		if _, err := deduplication.RebuildIndex(vaultRoot, vaultConfig.Deduplication); err != nil {
+			fmt.Printf("Warning: failed to rebuild the shared index: %v\n", err)
+		}
+
+		vaultConfig.SharedStore = config.SharedStoreConfig{}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to update vault configuration: %v", err)
+		}
+		if _, err := deduplication.RebuildIndex(vaultRoot, vaultConfig.Deduplication); err != nil {
+			return fmt.Errorf("left the store but failed to rebuild the vault index: %v (run 'sietch index rebuild')", err)
+		}
+
+		fmt.Printf("✓ Left shared store %s\n", store.Path)
+		fmt.Println("  Run 'sietch verify' to check that every chunk was copied.")
+		return nil
+	},
+}
+
+// storeStatusCmd shows the shared store and its registered vaults
+var storeStatusCmd = &cobra.Command{
+	Use:          "status",
+	Short:        "Show the shared store this vault uses and its registered vaults",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, _, err := loadStoreVault()
+		if err != nil {
+			return err
+		}
+		store, err := sharedstore.ForVault(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if store == nil {
+			fmt.Println("This vault stores its own chunks (no shared store).")
+			return nil
+		}
+
+		hashes, err := layout.ListChunkHashesIn(layout.SharedChunkDirectory(store.Path))
+		if err != nil {
+			return err
+		}
+		vaults, err := store.Vaults()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Shared store: %s\n", store.Path)
+		fmt.Printf("Key scheme:   %s\n", describeKeyScheme(store.Config.KeyScheme))
+		fmt.Printf("Compression:  %s\n", store.Config.Compression)
+		fmt.Printf("Chunks:       %d\n\n", len(hashes))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VAULT\tID\tPATH\tJOINED\tSTATUS")
+		for _, vault := range vaults {
+			status := "ok"
+			if err := store.CheckMember(vault); err != nil {
+				status = "unreachable"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", vault.Name, vault.VaultID, vault.Path,
+				vault.JoinedAt.Local().Format("2006-01-02"), status)
+		}
+		return w.Flush()
+	},
+}
+
+// storeUnregisterCmd removes a vault that no longer exists from the registry
+var storeUnregisterCmd = &cobra.Command{
+	Use:   "unregister <vault-id>",
+	Short: "Remove a deleted vault from the shared store's registry",
+	Long: `Remove a vault from the shared store's registry without touching the vault.
+
+Use this when a registered vault was deleted or moved, since garbage collection
+refuses to run while a registered vault is unreachable. Chunks only that vault
+referenced become unreferenced and are removed by the next 'sietch dedup gc'.
+
+Example:
+  sietch store unregister 1f0c2a9e-...`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, err := loadStoreVault()
+		if err != nil {
+			return err
+		}
+		store, err := sharedstore.ForVault(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if store == nil {
+			return fmt.Errorf("vault does not use a shared store")
+		}
+		if args[0] == vaultConfig.VaultID {
+			return fmt.Errorf("use 'sietch store leave' to remove this vault from the store")
+		}
+		if err := store.Unregister(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Unregistered vault %s\n", args[0])
+		return nil
+	},
+}
+
+// loadStoreVault finds the current vault and loads its configuration
+func loadStoreVault() (string, *config.VaultConfig, error) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return "", nil, fmt.Errorf("not inside a vault: %v", err)
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	return vaultRoot, vaultConfig, nil
+}
+
+// joinSharedStore moves the vault's chunks into the store, registers the vault and
+// points its configuration at the store
+func joinSharedStore(store *sharedstore.Store, vaultRoot string, vaultConfig *config.VaultConfig) error {
+	if vaultConfig.Encryption.EncryptIndex {
+		return fmt.Errorf("the vault encrypts its deduplication index, which a shared store's vaults share; it cannot join a store")
+	}
+	moved, err := store.ImportChunks(vaultRoot)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Moved %d chunks into the store\n", moved)
+
+	if err := store.Register(sharedstore.Vault{
+		VaultID:  vaultConfig.VaultID,
+		Name:     vaultConfig.Name,
+		Path:     vaultRoot,
+		JoinedAt: time.Now().UTC(),
+	}); err != nil {
+		return err
+	}
+
+	vaultConfig.SharedStore = config.SharedStoreConfig{Path: store.Path}
+	if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+		return fmt.Errorf("failed to update vault configuration: %v", err)
+	}
+
+	result, err := deduplication.RebuildIndex(vaultRoot, vaultConfig.Deduplication)
+	if err != nil {
+		return fmt.Errorf("joined the store but failed to rebuild the shared index: %v (run 'sietch index rebuild')", err)
+	}
+	fmt.Printf("✓ Joined shared store %s (%d vaults, %d chunks indexed)\n", store.Path, len(mustVaults(store)), result.Chunks)
+	return nil
+}
+
+// mustVaults returns the store's registered vaults, or none when the registry cannot be read
+func mustVaults(store *sharedstore.Store) []sharedstore.Vault {
+	vaults, _ := store.Vaults()
+	return vaults
+}
+
+// describeKeyScheme explains how chunks in a store are protected
+func describeKeyScheme(scheme string) string {
+	if scheme == constants.SharedStoreKeyNone {
+		return "unencrypted chunks"
+	}
+	return "encrypted with a shared key"
+}
+
+func init() {
+	rootCmd.AddCommand(storeCmd)
+	storeCmd.AddCommand(storeInitCmd)
+	storeCmd.AddCommand(storeJoinCmd)
+	storeCmd.AddCommand(storeLeaveCmd)
+	storeCmd.AddCommand(storeStatusCmd)
+	storeCmd.AddCommand(storeUnregisterCmd)
+
+	for _, c := range []*cobra.Command{storeInitCmd, storeJoinCmd} {
+		c.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+		c.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	}
+}
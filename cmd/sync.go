@@ -6,25 +6,35 @@ package cmd
 
 import (
 	"context"
+	stdcrypto "crypto"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/pem"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/spf13/cobra"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
 	"github.com/substantialcattle5/sietch/internal/fs"
 	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/internal/stats"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
 	"github.com/substantialcattle5/sietch/util"
 )
 
@@ -37,10 +47,80 @@ var syncCmd = &cobra.Command{
 This command syncs your vault with another vault, either by auto-discovering
 peers on the local network or by connecting to a specified peer address.
 
+Manifest and chunk transfers can be limited with --bwlimit (both directions)
+or --bwlimit-up and --bwlimit-down, across all streams together. Without them
+the limit recorded for the peer with 'sietch peer limit' applies. When the
+vault sets sync.allowed_hours (e.g. 22:00-06:00, local time), sync refuses to
+start outside that window unless --now is given. With sync.advertise set the
+vault announces itself on the local network while sync runs, for
+'sietch peers discover'.
+
+--dry-run exchanges manifests and shows what a sync would transfer each way,
+after deduplication against the chunks the receiving vault already holds, and
+the files both vaults hold in different versions, without moving any data.
+--save-plan keeps that plan, and a later 'sietch sync --plan <file>' syncs
+exactly its files: a file the peer changed in between is skipped, and a plan
+made for another vault or peer is refused.
+
+A file only one side changed since the last sync with the peer takes that
+side's version. One both changed is a conflict, handled by --conflict, or the
+vault's sync.conflict when it is not given:
+  manual     list the conflicts and stop before transferring anything, for
+             'sietch conflicts resolve' (the default)
+  newest     keep the version modified last
+  keep-both  keep the local version and store the peer's beside it as
+             <name>.conflict-<peer>-<date>
+Before the first sync with a peer every file the vaults hold in different
+versions is a conflict.
+
+While files are fetched sync shows a progress bar with the file being
+received, the transfer rate and the time left, or a line every few seconds
+when stdout is not a terminal (neither with --quiet). --progress json instead writes each progress
+event to stdout as a line of JSON, for scripts and GUIs, and the usual output
+to stderr: session_started, diff_computed with the totals to fetch,
+chunk_received, file_completed and session_done, each with the totals and
+what of them is done; chunk_sent for each chunk sent to a peer.
+
+The first sync with a vault shows the fingerprint of its sync key and asks
+whether to trust it; --non-interactive refuses peers not trusted yet and
+--force-trust trusts them without asking. A vault that presents another key
+than the one it was first seen with fails the sync with a POSSIBLE MITM
+error, and peers revoked with 'sietch peer revoke' are refused.
+
+A peer only reachable over SSH is given as ssh://[user@]host[:port]/path/to/vault
+(/~/path for a path in the home directory). sync then runs sietch on that host
+over ssh, with your usual SSH keys and configuration, and syncs through the
+connection; the peer's sync key is still checked against the trusted peers.
+SIETCH_SSH_COMMAND replaces the ssh command (e.g. "ssh -i ~/.ssh/backup"), and
+--remote-sietch the command running sietch on the host.
+
 Examples:
   sietch sync                               # Auto-discover and sync with peers
-  sietch sync /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID  # Sync with a specific peer`,
+  sietch sync /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID  # Sync with a specific peer
+  sietch sync ssh://alice@backup.lan/srv/vault  # Sync with a vault reachable over SSH
+  sietch sync --bwlimit 500KB/s             # Keep the sync under 500KB/s each way
+  sietch sync --dry-run --save-plan plan.json <peer>  # Review, then: sietch sync --plan plan.json <peer>
+  sietch sync --conflict keep-both <peer>   # Keep both versions of files changed on both sides
+  sietch sync --progress json <peer> | jq -c 'select(.type == "file_completed")'`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		serveStdio, _ := cmd.Flags().GetBool("serve-stdio")
+		progressMode, _ := cmd.Flags().GetString("progress")
+		if !slices.Contains(syncProgressModes, progressMode) {
+			return fmt.Errorf("invalid --progress %q (use auto, json or none)", progressMode)
+		}
+		if quiet, _ := cmd.Flags().GetBool("quiet"); quiet && progressMode == "auto" {
+			progressMode = "none"
+		}
+		var relay, events *os.File
+		switch {
+		case serveStdio:
+			// stdout carries the sync connection, so everything else goes to stderr
+			relay, os.Stdout = os.Stdout, os.Stderr
+		case progressMode == "json":
+			// stdout carries the progress events, so everything else goes to stderr
+			events, os.Stdout = os.Stdout, os.Stderr
+		}
+
 		// Create a context with cancellation
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -65,37 +145,59 @@ Examples:
 		if err != nil {
 			return fmt.Errorf("failed to load vault config: %v", err)
 		}
-
-		// Load RSA keys for secure communication
-		privateKey, publicKey, err := loadRSAKeys(vaultRoot, vaultCfg)
-		if err != nil {
-			return fmt.Errorf("failed to load RSA keys: %v", err)
+		if serveStdio {
+			return serveSyncStdio(ctx, cmd, vaultRoot, vaultCfg, relay)
 		}
-
-		// Convert RSA private key to libp2p format
-		libp2pPrivKey, err := rsaToLibp2pPrivateKey(privateKey)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		outputFormat, _ := cmd.Flags().GetString("output")
+		savePlan, _ := cmd.Flags().GetString("save-plan")
+		planPath, _ := cmd.Flags().GetString("plan")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (expected text or json)", outputFormat)
+		}
+		if !dryRun && (savePlan != "" || cmd.Flags().Changed("output")) {
+			return fmt.Errorf("--save-plan and --output only apply to --dry-run")
+		}
+		if dryRun && cmd.Flags().Changed("progress") {
+			return fmt.Errorf("--progress applies to a sync; a dry run transfers nothing")
+		}
+		if dryRun && planPath != "" {
+			return fmt.Errorf("--plan carries out a plan; it cannot be combined with --dry-run")
+		}
+		var plan *p2p.SyncPlan
+		if planPath != "" {
+			if plan, err = p2p.LoadSyncPlan(planPath); err != nil {
+				return err
+			}
+			if plan.VaultID != vaultCfg.VaultID {
+				return fmt.Errorf("the sync plan %s was made for another vault", planPath)
+			}
+		}
+		conflictStrategy, err := syncConflictStrategy(cmd, vaultCfg)
 		if err != nil {
-			return fmt.Errorf("failed to convert RSA key to libp2p format: %v", err)
+			return err
 		}
-
-		// Create a libp2p host with our identity key
-		port, _ := cmd.Flags().GetInt("port")
-		var opts []libp2p.Option
-
-		// Use our RSA key as the node identity
-		opts = append(opts, libp2p.Identity(libp2pPrivKey))
-
-		if port > 0 {
-			opts = append(opts, libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port)))
-		} else {
-			opts = append(opts, libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"))
+		// A dry run moves no data, so it may run outside the allowed hours
+		if !dryRun {
+			if err := checkSyncWindow(cmd, vaultCfg, time.Now()); err != nil {
+				return err
+			}
 		}
 
-		host, err := libp2p.New(opts...)
+		port, _ := cmd.Flags().GetInt("port")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		host, syncService, err := newSyncNode(ctx, vaultRoot, vaultCfg, port, verbose)
 		if err != nil {
-			return fmt.Errorf("failed to create libp2p host: %v", err)
+			return err
 		}
 		defer host.Close()
+		syncService.Progress = syncProgressReporter(progressMode, events, verbose)
+		syncService.SetPlan(plan)
+		syncService.ConflictStrategy = conflictStrategy
+		// Until the peer is known only the flags apply
+		if err := applyBandwidthLimit(cmd, syncService, vaultCfg, ""); err != nil {
+			return err
+		}
 
 		fmt.Printf("🔌 Started Sietch node with ID: %s\n", host.ID().String())
 
@@ -104,49 +206,30 @@ Examples:
 		for _, addr := range host.Addrs() {
 			fmt.Printf("   %s/p2p/%s\n", addr.String(), host.ID().String())
 		}
-
-		// Load the vault manager
-		vaultMgr, err := config.NewManager(vaultRoot)
-		if err != nil {
-			return fmt.Errorf("failed to load vault: %v", err)
-		}
-
-		// Create the sync service with RSA key information
-		syncService, err := p2p.NewSecureSyncService(host, vaultMgr, privateKey, publicKey, vaultCfg.Sync.RSA)
-		if err != nil {
-			return fmt.Errorf("failed to create sync service: %v", err)
+		if vaultCfg.Sync.Advertise {
+			stop, err := advertiseVault(host, syncService, vaultCfg)
+			if err != nil {
+				fmt.Printf("Warning: not advertising the vault: %v\n", err)
+			} else {
+				defer stop()
+			}
 		}
 
-		// Set verbose flag
-		verbose, _ := cmd.Flags().GetBool("verbose")
-		syncService.Verbose = verbose
-
-		// Start secure protocol handlers
-		syncService.RegisterProtocols(ctx)
-
 		// Specific peer address provided
 		if len(args) > 0 {
 			peerAddr := args[0]
 			fmt.Printf("🔄 Connecting to peer: %s\n", peerAddr)
 
-			// Parse the multiaddress
-			maddr, err := multiaddr.NewMultiaddr(peerAddr)
-			if err != nil {
-				return fmt.Errorf("invalid peer address: %v", err)
-			}
-
-			// Extract the peer ID from the multiaddress
-			info, err := peer.AddrInfoFromP2pAddr(maddr)
+			info, disconnect, err := connectToPeer(ctx, cmd, host, peerAddr)
 			if err != nil {
-				return fmt.Errorf("failed to parse peer info: %v", err)
-			}
-
-			// Connect to the peer
-			if err := host.Connect(ctx, *info); err != nil {
-				return fmt.Errorf("failed to connect to peer: %v", err)
+				return err
 			}
+			defer disconnect()
 
 			fmt.Printf("✅ Connected to peer: %s\n", info.ID.String())
+			if err := applyBandwidthLimit(cmd, syncService, vaultCfg, info.ID); err != nil {
+				return err
+			}
 
 			// Perform secure handshake and key exchange
 			trusted, err := syncService.VerifyAndExchangeKeys(ctx, info.ID)
@@ -155,33 +238,22 @@ Examples:
 			}
 
 			if !trusted {
-				// If not automatically trusted, prompt user
-				fmt.Printf("\n⚠️  New peer detected!\n")
-				fmt.Printf("Peer ID: %s\n", info.ID.String())
-
-				fingerprint, err := syncService.GetPeerFingerprint(info.ID)
-				if err == nil {
-					fmt.Printf("Fingerprint: %s\n", fingerprint)
-				}
-
-				if !promptForTrust() {
-					return fmt.Errorf("sync canceled - peer not trusted")
-				}
-
-				// Add peer to trusted list
-				err = syncService.AddTrustedPeer(ctx, info.ID)
-				if err != nil {
-					return fmt.Errorf("failed to add trusted peer: %v", err)
+				if err := trustNewPeer(ctx, cmd, syncService, info.ID); err != nil {
+					return err
 				}
 			}
 
+			if dryRun {
+				return planSync(ctx, syncService, info.ID, outputFormat, savePlan)
+			}
 			fmt.Println("📝 Starting vault synchronization...")
 
 			// Sync with the peer
 			result, err := syncService.SyncWithPeer(ctx, info.ID)
 			if err != nil {
-				return fmt.Errorf("sync failed: %v", err)
+				return syncError(cmd, err)
 			}
+			recordSync(vaultRoot, info.ID)
 
 			// Display sync results
 			displaySyncResults(result)
@@ -205,13 +277,19 @@ Examples:
 		}
 		defer func() { _ = discovery.Stop() }()
 
-		fmt.Println("📡 Searching for peers on local network...")
-
 		// Set timeout for discovery
 		timeout, _ := cmd.Flags().GetInt("timeout")
 		timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 		defer timeoutCancel()
 
+		// A frozen vault takes nothing from peers, but still serves them
+		if vaultCfg.ReadOnly && !dryRun {
+			fmt.Printf("🧊 Vault is frozen: serving peers for %d seconds without fetching from them\n", timeout)
+			<-timeoutCtx.Done()
+			return nil
+		}
+		fmt.Println("📡 Searching for peers on local network...")
+
 		// Wait for peers
 		select {
 		case peerInfo := <-discovery.DiscoveredPeers():
@@ -230,6 +308,9 @@ Examples:
 			}
 
 			fmt.Printf("✅ Found peer: %s\n", peerInfo.ID.String())
+			if err := applyBandwidthLimit(cmd, syncService, vaultCfg, peerInfo.ID); err != nil {
+				return err
+			}
 
 			// Connect to the peer
 			if err := host.Connect(ctx, peerInfo); err != nil {
@@ -243,33 +324,22 @@ Examples:
 			}
 
 			if !trusted {
-				// If not automatically trusted, prompt user
-				fmt.Printf("\n⚠️  New peer detected!\n")
-				fmt.Printf("Peer ID: %s\n", peerInfo.ID.String())
-
-				fingerprint, err := syncService.GetPeerFingerprint(peerInfo.ID)
-				if err == nil {
-					fmt.Printf("Fingerprint: %s\n", fingerprint)
-				}
-
-				if !promptForTrust() {
-					return fmt.Errorf("sync canceled - peer not trusted")
-				}
-
-				// Add peer to trusted list
-				err = syncService.AddTrustedPeer(ctx, peerInfo.ID)
-				if err != nil {
-					return fmt.Errorf("failed to add trusted peer: %v", err)
+				if err := trustNewPeer(ctx, cmd, syncService, peerInfo.ID); err != nil {
+					return err
 				}
 			}
 
+			if dryRun {
+				return planSync(ctx, syncService, peerInfo.ID, outputFormat, savePlan)
+			}
 			fmt.Printf("🔄 Starting sync with peer: %s\n", peerInfo.ID.String())
 
 			// Sync with the peer
 			result, err := syncService.SyncWithPeer(ctx, peerInfo.ID)
 			if err != nil {
-				return fmt.Errorf("sync failed: %v", err)
+				return syncError(cmd, err)
 			}
+			recordSync(vaultRoot, peerInfo.ID)
 
 			// Display sync results
 			displaySyncResults(result)
@@ -282,39 +352,279 @@ Examples:
 	},
 }
 
-// loadRSAKeys loads the RSA key pair from the vault
-func loadRSAKeys(vaultRoot string, cfg *config.VaultConfig) (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	// Get path to private key
-	privateKeyPath := filepath.Join(vaultRoot, cfg.Sync.RSA.PrivateKeyPath)
+// newSyncNode starts a libp2p host with the vault's sync identity and a sync
+// service serving the vault on it. port 0 picks a random port. The caller
+// closes the host.
+func newSyncNode(ctx context.Context, vaultRoot string, vaultCfg *config.VaultConfig, port int, verbose bool) (host.Host, *p2p.SyncService, error) {
+	return newSyncNodeOn(ctx, vaultRoot, vaultCfg, fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port), verbose)
+}
+
+// newSyncNodeOn is newSyncNode listening on the multiaddress listenAddr
+func newSyncNodeOn(ctx context.Context, vaultRoot string, vaultCfg *config.VaultConfig, listenAddr string, verbose bool) (host.Host, *p2p.SyncService, error) {
+	// Load the sync identity (RSA or Ed25519) for secure communication
+	if vaultCfg.Sync.RSA == nil {
+		return nil, nil, fmt.Errorf("vault has no sync key configured")
+	}
+	privateKey, publicKey, syncKeyCfg, err := keys.LoadSyncKeys(vaultRoot, vaultCfg.Sync.RSA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sync keys: %v", err)
+	}
 
-	// Read private key file
-	privateKeyData, err := os.ReadFile(privateKeyPath)
+	// Convert the private key to libp2p format
+	libp2pPrivKey, err := syncKeyToLibp2pPrivateKey(privateKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+		return nil, nil, fmt.Errorf("failed to convert %s key to libp2p format: %v", syncKeyCfg.KeyType, err)
 	}
 
-	// Decode PEM block
-	block, _ := pem.Decode(privateKeyData)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		return nil, nil, fmt.Errorf("failed to decode PEM block containing private key")
+	// Create a libp2p host with our sync key as the node identity
+	opts := []libp2p.Option{
+		libp2p.Identity(libp2pPrivKey),
+		libp2p.ListenAddrStrings(listenAddr),
+	}
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create libp2p host: %v", err)
 	}
 
-	// Parse private key
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	// Load the vault manager
+	vaultMgr, err := config.NewManager(vaultRoot)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+		h.Close()
+		return nil, nil, fmt.Errorf("failed to load vault: %v", err)
 	}
 
-	// Get public key from private key
-	publicKey := &privateKey.PublicKey
+	// Create the sync service with the sync key information
+	syncService, err := p2p.NewSecureSyncService(h, vaultMgr, privateKey, publicKey, vaultCfg.Sync.RSA)
+	if err != nil {
+		h.Close()
+		return nil, nil, fmt.Errorf("failed to create sync service: %v", err)
+	}
+	syncService.Verbose = verbose
+
+	// Check received chunks against decompression bombs when the vault key
+	// is usable without a passphrase; otherwise reads enforce the limit
+	if chunkOpts, err := chunker.OptionsFromConfig(vaultRoot, *vaultCfg, ""); err == nil {
+		syncService.ChunkOptions = &chunkOpts
+	} else if verbose {
+		fmt.Printf("Received chunks are checked when read: %v\n", err)
+	}
 
-	return privateKey, publicKey, nil
+	// Start secure protocol handlers
+	syncService.RegisterProtocols(ctx)
+	return h, syncService, nil
 }
 
-// rsaToLibp2pPrivateKey converts a Go RSA private key to libp2p format
-func rsaToLibp2pPrivateKey(privateKey *rsa.PrivateKey) (crypto.PrivKey, error) {
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-	return crypto.UnmarshalRsaPrivateKey(privateKeyBytes)
+// advertiseVault announces the vault on the local network for 'sietch peers
+// discover' until the returned stop is called
+func advertiseVault(h host.Host, syncService *p2p.SyncService, vaultCfg *config.VaultConfig) (func(), error) {
+	fingerprint, err := syncService.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	a := p2p.Advertisement{VaultID: vaultCfg.VaultID, VaultName: vaultCfg.Name, Fingerprint: fingerprint}
+	stop, err := p2p.Advertise(h, a)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("📣 Advertising as %s\n", a.InstanceName())
+	return stop, nil
+}
+
+// checkSyncWindow refuses to sync outside the vault's sync.allowed_hours,
+// unless --now is given
+func checkSyncWindow(cmd *cobra.Command, vaultCfg *config.VaultConfig, now time.Time) error {
+	if vaultCfg.Sync.AllowedHours == "" {
+		return nil
+	}
+	if force, _ := cmd.Flags().GetBool("now"); force {
+		return nil
+	}
+	window, err := util.ParseTimeWindow(vaultCfg.Sync.AllowedHours)
+	if err != nil {
+		return fmt.Errorf("invalid sync.allowed_hours: %v", err)
+	}
+	if !window.Contains(now) {
+		return fmt.Errorf("sync is only allowed %s (sync.allowed_hours); pass --now to sync anyway", vaultCfg.Sync.AllowedHours)
+	}
+	return nil
+}
+
+// applyBandwidthLimit limits the sync service to --bwlimit, --bwlimit-up and
+// --bwlimit-down, falling back to the limit recorded for peerID
+func applyBandwidthLimit(cmd *cobra.Command, syncService *p2p.SyncService, vaultCfg *config.VaultConfig, peerID peer.ID) error {
+	var up, down int64
+	for _, trusted := range trustedPeers(vaultCfg) {
+		if trusted.ID != peerID.String() || trusted.BandwidthLimit == "" {
+			continue
+		}
+		rate, err := util.ParseBandwidth(trusted.BandwidthLimit)
+		if err != nil {
+			return fmt.Errorf("invalid bandwidth limit of peer %s: %v", peerName(trusted), err)
+		}
+		up, down = rate, rate
+	}
+	for _, flag := range []struct {
+		name string
+		into []*int64
+	}{{"bwlimit", []*int64{&up, &down}}, {"bwlimit-up", []*int64{&up}}, {"bwlimit-down", []*int64{&down}}} {
+		if !cmd.Flags().Changed(flag.name) {
+			continue
+		}
+		value, _ := cmd.Flags().GetString(flag.name)
+		rate, err := util.ParseBandwidth(value)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %v", flag.name, err)
+		}
+		for _, into := range flag.into {
+			*into = rate
+		}
+	}
+
+	syncService.SetBandwidthLimit(up, down)
+	if peerID != "" && (up > 0 || down > 0) {
+		fmt.Printf("🐢 Bandwidth limited to %s up, %s down\n", formatRate(up), formatRate(down))
+	}
+	return nil
+}
+
+// formatRate shows a bandwidth limit, 0 being unlimited
+func formatRate(bytesPerSecond int64) string {
+	if bytesPerSecond <= 0 {
+		return "unlimited"
+	}
+	return util.HumanReadableSize(bytesPerSecond) + "/s"
+}
+
+// connectToPeer connects the host to the peer at a /p2p multiaddress, or at
+// an ssh:// address by running sietch on that host over SSH. The caller calls
+// disconnect once done with the peer.
+func connectToPeer(ctx context.Context, cmd *cobra.Command, h host.Host, peerAddr string) (info *peer.AddrInfo, disconnect func(), err error) {
+	if p2p.IsSSHAddress(peerAddr) {
+		return connectOverSSH(ctx, cmd, h, peerAddr)
+	}
+
+	// Parse the multiaddress
+	maddr, err := multiaddr.NewMultiaddr(peerAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid peer address: %v", err)
+	}
+
+	// Extract the peer ID from the multiaddress
+	info, err = peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse peer info: %v", err)
+	}
+
+	if err := h.Connect(ctx, *info); err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to peer: %v", err)
+	}
+	return info, func() {}, nil
+}
+
+// connectOverSSH runs 'sietch sync --serve-stdio' on the host of an ssh://
+// address and connects the host to the node it starts there
+func connectOverSSH(ctx context.Context, cmd *cobra.Command, h host.Host, peerAddr string) (*peer.AddrInfo, func(), error) {
+	addr, err := p2p.ParseSSHAddress(peerAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := p2p.SSHOptions{Command: strings.Fields(os.Getenv("SIETCH_SSH_COMMAND"))}
+	opts.RemoteSietch, _ = cmd.Flags().GetString("remote-sietch")
+	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+		opts.Stderr = os.Stderr
+	}
+	tunnel, err := p2p.DialSSH(ctx, addr, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &peer.AddrInfo{ID: tunnel.PeerID, Addrs: []multiaddr.Multiaddr{tunnel.Addr}}
+	if err := h.Connect(ctx, *info); err != nil {
+		_ = tunnel.Close()
+		return nil, nil, fmt.Errorf("failed to connect to sietch on %s over SSH: %v", addr.Host, err)
+	}
+	return info, func() { _ = tunnel.Close() }, nil
+}
+
+// serveSyncStdio serves the vault to a peer that ran 'sietch sync' with an
+// ssh:// address, relaying stdin and relay to a node on the loopback interface
+func serveSyncStdio(ctx context.Context, cmd *cobra.Command, vaultRoot string, vaultCfg *config.VaultConfig, relay *os.File) error {
+	if err := checkSyncWindow(cmd, vaultCfg, time.Now()); err != nil {
+		return err
+	}
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	host, syncService, err := newSyncNodeOn(ctx, vaultRoot, vaultCfg, "/ip4/127.0.0.1/tcp/0", verbose)
+	if err != nil {
+		return err
+	}
+	defer host.Close()
+	if err := applyBandwidthLimit(cmd, syncService, vaultCfg, ""); err != nil {
+		return err
+	}
+	return p2p.ServeStdio(ctx, host.Addrs()[0], host.ID(), os.Stdin, relay)
+}
+
+// syncKeyToLibp2pPrivateKey converts an RSA or Ed25519 sync key to libp2p format
+func syncKeyToLibp2pPrivateKey(privateKey stdcrypto.Signer) (crypto.PrivKey, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return crypto.UnmarshalRsaPrivateKey(x509.MarshalPKCS1PrivateKey(key))
+	case ed25519.PrivateKey:
+		libp2pKey, _, err := crypto.KeyPairFromStdKey(&key)
+		return libp2pKey, err
+	default:
+		return nil, fmt.Errorf("unsupported sync key type %T", privateKey)
+	}
+}
+
+// recordSync notes a successful sync with a peer for 'sietch status'
+func recordSync(vaultRoot string, peerID peer.ID) {
+	now := time.Now().UTC()
+	err := stats.UpdateCounters(vaultRoot, func(c *stats.Counters) {
+		c.LastSync = now
+		if c.PeersSeen == nil {
+			c.PeersSeen = make(map[string]time.Time)
+		}
+		c.PeersSeen[peerID.String()] = now
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to record the sync time: %v\n", err)
+	}
+}
+
+// trustNewPeer trusts a peer the vault has not seen before: at once with
+// --force-trust, never with --non-interactive, and otherwise once the user
+// confirmed its fingerprint
+func trustNewPeer(ctx context.Context, cmd *cobra.Command, syncService *p2p.SyncService, peerID peer.ID) error {
+	info, ok := syncService.Peer(peerID)
+	if !ok {
+		return fmt.Errorf("no key was exchanged with peer %s", peerID)
+	}
+	forceTrust, _ := cmd.Flags().GetBool("force-trust")
+	nonInteractive, _ := cmd.Flags().GetBool("non-interactive")
+	switch {
+	case forceTrust:
+		fmt.Printf("⚠️  Trusting new peer %s (fingerprint %s) without confirmation\n", peerID, info.Fingerprint)
+	case nonInteractive:
+		return fmt.Errorf("peer %s is not trusted (fingerprint %s); check the fingerprint with its owner and run 'sietch peer add', or sync interactively", peerID, info.Fingerprint)
+	default:
+		fmt.Printf("\n⚠️  New peer detected!\n")
+		fmt.Printf("Peer ID: %s\n", peerID.String())
+		if info.Name != "" {
+			fmt.Printf("Vault: %s (%s)\n", info.Name, info.VaultID)
+		}
+		fmt.Printf("Fingerprint: %s\n", info.Fingerprint)
+		fmt.Println("Check it matches the fingerprint 'sietch peer verify' shows on the other machine.")
+		if !promptForTrust() {
+			return fmt.Errorf("sync canceled - peer not trusted")
+		}
+	}
+
+	// Add peer to trusted list
+	if err := syncService.AddTrustedPeer(ctx, peerID); err != nil {
+		return fmt.Errorf("failed to add trusted peer: %v", err)
+	}
+	operationNotes = append(operationNotes, fmt.Sprintf("trusted peer %s (%s) on first use, fingerprint %s", peerDisplayName(info), peerID, info.Fingerprint))
+	return nil
 }
 
 // promptForTrust asks the user whether to trust a new peer
@@ -325,14 +635,185 @@ func promptForTrust() bool {
 	return response == "y" || response == "Y" || response == "yes" || response == "Yes"
 }
 
+// planSync works out what a sync with the peer would transfer and prints it,
+// saving the plan to savePath when given
+func planSync(ctx context.Context, syncService *p2p.SyncService, peerID peer.ID, outputFormat, savePath string) error {
+	plan, err := syncService.PlanSync(ctx, peerID)
+	if err != nil {
+		return fmt.Errorf("dry run failed: %v", err)
+	}
+	if savePath != "" {
+		if err := plan.Save(savePath); err != nil {
+			return fmt.Errorf("failed to save the sync plan: %v", err)
+		}
+	}
+
+	if outputFormat == "json" {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode sync plan: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printSyncPlan(plan)
+	if savePath != "" {
+		fmt.Printf("\nPlan saved to %s; 'sietch sync --plan %s <peer>' syncs exactly these files\n", savePath, savePath)
+	}
+	return nil
+}
+
+// printSyncPlan shows what a sync would transfer in each direction
+func printSyncPlan(plan *p2p.SyncPlan) {
+	fmt.Printf("\n📋 Dry run with peer %s, no data was transferred\n", plan.Peer)
+	directions := []struct {
+		title string
+		dir   p2p.PlanDirection
+		mark  string
+	}{
+		{"To receive from the peer", plan.Receive, "<"},
+		{"To send (fetched when the peer syncs with this vault)", plan.Send, ">"},
+	}
+	for _, d := range directions {
+		fmt.Printf("\n%s:\n", d.title)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, file := range d.dir.Files {
+			note := ""
+			if file.Update {
+				note = "\t(newer version)"
+			}
+			fmt.Fprintf(w, "  %s %s\t%s%s\n", d.mark, file.DisplayPath(), util.HumanReadableSize(file.Size), note)
+		}
+		_ = w.Flush()
+		fmt.Printf("   Files:                %d (%s)\n", len(d.dir.Files), util.HumanReadableSize(d.dir.FileBytes))
+		fmt.Printf("   Chunks to transfer:   %d\n", len(d.dir.Chunks))
+		fmt.Printf("   Chunks deduplicated:  %d\n", d.dir.ChunksDeduplicated)
+		if len(d.dir.Packs) > 0 {
+			fmt.Printf("   Packs to transfer:    %d\n", len(d.dir.Packs))
+		}
+		if len(d.dir.Dicts) > 0 {
+			fmt.Printf("   Dictionaries:         %d\n", len(d.dir.Dicts))
+		}
+		fmt.Printf("   Data to transfer:     %s\n", util.HumanReadableSize(d.dir.Bytes))
+	}
+
+	if len(plan.Conflicts) > 0 {
+		fmt.Printf("\nConflicts (changed both here and on the peer since the last sync):\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range plan.Conflicts {
+			fmt.Fprintf(w, "  ! %s\tlocal %s\tpeer %s\t%s\n", c.DisplayPath(),
+				util.HumanReadableSize(c.LocalSize), util.HumanReadableSize(c.PeerSize), describePlannedResolution(c.Resolution))
+		}
+		_ = w.Flush()
+	}
+	if plan.Metadata {
+		fmt.Println("\nThe peer's vault tags and metadata are newer and would be taken.")
+	}
+}
+
+// syncConflictStrategy returns the conflict strategy from --conflict, or
+// else the vault's sync.conflict, manual by default
+func syncConflictStrategy(cmd *cobra.Command, vaultCfg *config.VaultConfig) (string, error) {
+	strategy, _ := cmd.Flags().GetString("conflict")
+	source := "--conflict"
+	if strategy == "" {
+		strategy, source = vaultCfg.Sync.Conflict, "sync.conflict"
+	}
+	if strategy == "" {
+		return constants.ConflictManual, nil
+	}
+	if !slices.Contains(constants.ConflictStrategies, strategy) {
+		return "", fmt.Errorf("invalid %s %q (expected %s)", source, strategy, strings.Join(constants.ConflictStrategies, ", "))
+	}
+	return strategy, nil
+}
+
+// syncError reports a failed sync, listing the conflicts that stopped it
+func syncError(cmd *cobra.Command, err error) error {
+	var conflictErr *p2p.ConflictError
+	if !errors.As(err, &conflictErr) {
+		return fmt.Errorf("sync failed: %v", err)
+	}
+	// The command line is fine, so the usage would only bury the conflicts
+	cmd.SilenceUsage = true
+	fmt.Printf("\n⚠️  Changed both here and on the peer since the last sync:\n")
+	listConflicts(conflictErr.Conflicts)
+	return fmt.Errorf("sync stopped: %v", err)
+}
+
+// listConflicts shows both versions of each conflicting file
+func listConflicts(conflicts []p2p.Conflict) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range conflicts {
+		fmt.Fprintf(w, "  ! %s\tlocal %s\tpeer %s\n", c.DisplayPath(), describeVersion(c.Local), describeVersion(c.Remote))
+	}
+	_ = w.Flush()
+}
+
+// describePlannedResolution shows what a sync would do with a conflict
+func describePlannedResolution(resolution string) string {
+	switch resolution {
+	case p2p.ResolveLocal:
+		return "keeps the local version"
+	case p2p.ResolvePeer:
+		return "takes the peer's version"
+	case p2p.ResolveBoth:
+		return "keeps both versions"
+	}
+	return "stops the sync until resolved"
+}
+
 // displaySyncResults shows the results of a sync operation
 func displaySyncResults(result *p2p.SyncResult) {
+	// What was transferred also goes to the operation log
+	operationCounts.Files += result.FileCount
+	operationCounts.Chunks += result.ChunksTransferred
+	operationCounts.Bytes += result.BytesTransferred
+	runMetrics.ChunksWritten += int64(result.ChunksTransferred)
+	runMetrics.DedupHits += int64(result.ChunksDeduplicated)
+	runMetrics.DedupMisses += int64(result.ChunksTransferred)
+	runMetrics.BytesIn += result.BytesTransferred
 	fmt.Println("\n✅ Synchronization complete!")
 	fmt.Printf("   Files transferred:    %d\n", result.FileCount)
+	if result.FilesUpdated > 0 {
+		fmt.Printf("   Files updated:        %d (changed on the peer)\n", result.FilesUpdated)
+	}
 	fmt.Printf("   Chunks transferred:   %d\n", result.ChunksTransferred)
 	fmt.Printf("   Chunks deduplicated:  %d\n", result.ChunksDeduplicated)
+	if result.ChunksResumed > 0 {
+		fmt.Printf("   Chunks resumed:       %d (received by an interrupted sync)\n", result.ChunksResumed)
+	}
+	if result.PacksTransferred > 0 {
+		fmt.Printf("   Packs transferred:    %d\n", result.PacksTransferred)
+	}
+	if result.DictsTransferred > 0 {
+		fmt.Printf("   Dictionaries fetched: %d\n", result.DictsTransferred)
+	}
+	if result.MetadataUpdated {
+		fmt.Printf("   Vault tags:           updated from peer\n")
+	}
+	if result.PlanSkipped > 0 {
+		fmt.Printf("   Skipped from plan:    %d (changed on the peer since)\n", result.PlanSkipped)
+	}
 	fmt.Printf("   Data transferred:     %s\n", util.HumanReadableSize(result.BytesTransferred))
 	fmt.Printf("   Duration:             %s\n", result.Duration.Round(time.Millisecond))
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("\n⚠️  Changed both here and on the peer since the last sync:\n")
+		for _, c := range result.Conflicts {
+			fmt.Printf("   %s: %s\n", c.DisplayPath(), describeConflictOutcome(c))
+		}
+	}
+}
+
+// describeConflictOutcome shows what sync did with a conflicting file
+func describeConflictOutcome(c p2p.Conflict) string {
+	switch c.Resolution {
+	case p2p.ResolvePeer:
+		return "took the peer's version"
+	case p2p.ResolveBoth:
+		return "kept the local version, the peer's is at " + c.CopyPath
+	}
+	return "kept the local version"
 }
 
 func init() {
@@ -342,6 +823,20 @@ func init() {
 	syncCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
 	syncCmd.Flags().IntP("timeout", "t", 60, "Discovery timeout in seconds (for auto-discovery)")
 	syncCmd.Flags().BoolP("force-trust", "f", false, "Automatically trust new peers without prompting")
+	syncCmd.Flags().Bool("non-interactive", false, "Refuse peers not trusted yet instead of asking whether to trust them")
 	syncCmd.Flags().BoolP("read-only", "r", false, "Only receive files, don't send")
 	syncCmd.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+	syncCmd.Flags().String("bwlimit", "", "Limit transfers in each direction to this rate (e.g. 500KB/s); 0 is unlimited")
+	syncCmd.Flags().String("bwlimit-up", "", "Limit what is sent to this rate, overriding --bwlimit")
+	syncCmd.Flags().String("bwlimit-down", "", "Limit what is received to this rate, overriding --bwlimit")
+	syncCmd.Flags().Bool("now", false, "Sync even outside the vault's sync.allowed_hours")
+	syncCmd.Flags().Bool("dry-run", false, "Exchange manifests and show what would be transferred, without moving any data")
+	syncCmd.Flags().StringP("output", "o", "text", "With --dry-run, output format: text or json")
+	syncCmd.Flags().String("save-plan", "", "With --dry-run, save the plan to this file for a later --plan")
+	syncCmd.Flags().String("plan", "", "Sync only the files of a plan saved by --dry-run --save-plan, skipping those changed since")
+	syncCmd.Flags().String("progress", "auto", "Progress display: auto (a bar on a terminal, else a line every few seconds), json (events as JSON lines on stdout) or none")
+	syncCmd.Flags().String("remote-sietch", "sietch", "With an ssh:// peer address, the command running sietch on that host")
+	syncCmd.Flags().Bool("serve-stdio", false, "Serve the vault over stdin and stdout, for a peer syncing over SSH")
+	_ = syncCmd.Flags().MarkHidden("serve-stdio")
+	syncCmd.Flags().String("conflict", "", "How to handle files changed here and on the peer: manual, newest or keep-both (default: the vault's sync.conflict, else manual)")
 }
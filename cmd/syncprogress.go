@@ -0,0 +1,148 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// syncProgressModes are the values of sync --progress
+var syncProgressModes = []string{"auto", "json", "none"}
+
+// syncProgressInterval is how often progress is printed when stdout is not
+// a terminal
+const syncProgressInterval = 5 * time.Second
+
+// syncProgressReporter returns what renders the progress events of syncs:
+// JSON lines written to events for mode json, nothing for none, and
+// otherwise a progress bar when stdout is a terminal or a line every few
+// seconds when it is not
+func syncProgressReporter(mode string, events io.Writer, verbose bool) func(p2p.ProgressEvent) {
+	switch mode {
+	case "none":
+		return nil
+	case "json":
+		var mu sync.Mutex
+		encoder := json.NewEncoder(events)
+		return func(event p2p.ProgressEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			_ = encoder.Encode(event)
+		}
+	}
+	display := &syncProgressDisplay{
+		out:      os.Stdout,
+		useBar:   !verbose && term.IsTerminal(int(os.Stdout.Fd())), // Verbose output would break up the bar
+		interval: syncProgressInterval,
+	}
+	return display.handle
+}
+
+// syncProgressDisplay shows the progress of the syncs this vault starts
+type syncProgressDisplay struct {
+	mu       sync.Mutex
+	out      io.Writer
+	useBar   bool
+	interval time.Duration
+	bar      *progressbar.ProgressBar
+	start    time.Time // When the session's totals were known
+	printed  time.Time // When progress was last printed
+}
+
+func (d *syncProgressDisplay) handle(event p2p.ProgressEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch event.Type {
+	case p2p.EventDiffComputed:
+		d.start, d.printed = event.Time, event.Time
+		if event.Chunks == 0 {
+			return
+		}
+		fmt.Fprintf(d.out, "📥 Fetching %d chunk(s), %s, for %d file(s)\n",
+			event.Chunks, util.HumanReadableSize(event.TotalBytes), event.Files)
+		if d.useBar {
+			d.bar = progressbar.NewOptions64(max(event.TotalBytes, 1),
+				progressbar.OptionSetWriter(d.out),
+				progressbar.OptionShowBytes(true),
+				progressbar.OptionShowCount(),
+				progressbar.OptionSetWidth(30),
+				progressbar.OptionThrottle(65*time.Millisecond),
+				progressbar.OptionSetPredictTime(true),
+				progressbar.OptionOnCompletion(func() {
+					fmt.Fprintln(d.out)
+				}),
+			)
+		}
+	case p2p.EventChunkReceived:
+		if d.bar != nil {
+			// The totals are estimated from the peer's manifest
+			if event.BytesDone > d.bar.GetMax64() {
+				d.bar.ChangeMax64(event.BytesDone)
+			}
+			d.bar.Describe(syncProgressFile(event))
+			_ = d.bar.Set64(event.BytesDone)
+			return
+		}
+		if event.Time.Sub(d.printed) >= d.interval {
+			fmt.Fprintln(d.out, d.line(event))
+			d.printed = event.Time
+		}
+	case p2p.EventSessionDone:
+		if d.bar != nil {
+			if event.Error == "" {
+				_ = d.bar.Finish()
+			} else {
+				_ = d.bar.Exit()
+				fmt.Fprintln(d.out)
+			}
+			d.bar = nil
+			return
+		}
+		if event.Chunks > 0 {
+			fmt.Fprintln(d.out, d.line(event))
+		}
+	}
+}
+
+// line describes how far a session has got, with its transfer rate and the
+// time it is likely to take yet
+func (d *syncProgressDisplay) line(event p2p.ProgressEvent) string {
+	line := fmt.Sprintf("Received %d/%d file(s), %s of %s", event.FilesDone, event.Files,
+		util.HumanReadableSize(event.BytesDone), util.HumanReadableSize(event.TotalBytes))
+	if event.TotalBytes > 0 {
+		line += fmt.Sprintf(" (%d%%)", min(100, event.BytesDone*100/event.TotalBytes))
+	}
+	elapsed := event.Time.Sub(d.start).Seconds()
+	if elapsed <= 0 || event.BytesDone == 0 {
+		return line
+	}
+	rate := float64(event.BytesDone) / elapsed
+	line += " at " + util.HumanReadableSize(int64(rate)) + "/s"
+	if left := event.TotalBytes - event.BytesDone; left > 0 && event.Type != p2p.EventSessionDone {
+		eta := time.Duration(float64(left) / rate * float64(time.Second))
+		line += fmt.Sprintf(", about %s left", eta.Round(time.Second))
+	}
+	return line
+}
+
+// syncProgressFile describes the file a chunk was fetched for, for the bar
+func syncProgressFile(event p2p.ProgressEvent) string {
+	const width = 32
+	file := []rune(event.File)
+	if len(file) > width {
+		file = append([]rune("…"), file[len(file)-width+1:]...)
+	}
+	return fmt.Sprintf("[%d/%d] %-*s", event.FilesDone, event.Files, width, string(file))
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+func TestSyncProgressLine(t *testing.T) {
+	start := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		event p2p.ProgressEvent
+		want  string
+	}{
+		{"just started", p2p.ProgressEvent{Type: p2p.EventChunkReceived, Time: start, Files: 4, TotalBytes: 4096},
+			"Received 0/4 file(s), 0 B of 4.0 KB (0%)"},
+		{"halfway", p2p.ProgressEvent{Type: p2p.EventChunkReceived, Time: start.Add(2 * time.Second), FilesDone: 1, Files: 4, BytesDone: 2048, TotalBytes: 4096},
+			"Received 1/4 file(s), 2.0 KB of 4.0 KB (50%) at 1.0 KB/s, about 2s left"},
+		{"done", p2p.ProgressEvent{Type: p2p.EventSessionDone, Time: start.Add(4 * time.Second), FilesDone: 4, Files: 4, BytesDone: 4200, TotalBytes: 4096},
+			"Received 4/4 file(s), 4.1 KB of 4.0 KB (100%) at 1.0 KB/s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &syncProgressDisplay{start: start}
+			if got := d.line(tt.event); got != tt.want {
+				t.Errorf("line() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/scaffold"
+	"github.com/substantialcattle5/sietch/internal/validate"
+)
+
+// templateCmd groups template authoring tools
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Work with vault templates",
+	Long: `Tools for authoring and checking vault templates used by 'sietch scaffold'.
+
+Example:
+  sietch template list
+  sietch template validate ./myTemplate.json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// templateListCmd lists the templates available to 'sietch scaffold'
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available templates",
+	Long: `List the templates in ~/.config/sietch/templates.
+
+With --output-format json or yaml every template is emitted with its name,
+version, description, author, tags and main settings (chunking, hash,
+compression, deduplication, sync mode and passphrase protection), for
+scripts and GUIs that offer a choice of templates. Templates that fail to
+load are listed with an error instead.
+
+Example:
+  sietch template list
+  sietch template list --output-format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output-format")
+		return listTemplates(outputFormat)
+	},
+}
+
+// listTemplates prints the available templates in the given output format
+func listTemplates(outputFormat string) error {
+	switch outputFormat {
+	case "text":
+		return scaffold.ListTemplates()
+	case "json", "yaml":
+		return scaffold.WriteTemplateList(os.Stdout, outputFormat)
+	}
+	return fmt.Errorf("invalid output format %q (expected text, json or yaml)", outputFormat)
+}
+
+// templateValidateCmd lints a template file without scaffolding a vault
+var templateValidateCmd = &cobra.Command{
+	Use:   "validate <path>",
+	Short: "Check a template file for problems",
+	Long: `Check a template file (JSON or YAML) without scaffolding a vault.
+
+Every problem is reported, not just the first one, by field path: values
+of the wrong type, invalid chunk sizes, unsupported hash/compression/sync
+settings and bad file modes, with the supported values. Unknown fields are
+warnings, with the field they are closest to (e.g. "compresion" → did you
+mean "compression"?); --strict makes them problems too. The command exits
+non-zero if any problem is found, so it can be used in CI for a template
+repository.
+
+Example:
+  sietch template validate template/photoVault.json
+  sietch template validate --strict template/photoVault.json`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		templatePath := args[0]
+
+		issues, err := scaffold.LintTemplateFile(templatePath)
+		if err != nil {
+			return err
+		}
+
+		problems, warnings := validate.Split(issues)
+		for _, issue := range warnings {
+			fmt.Printf("⚠ %s\n", issue)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("✓ %s is a valid template\n", templatePath)
+			return nil
+		}
+
+		fmt.Printf("✗ %s has %d problem(s):\n", templatePath, len(problems))
+		for _, issue := range problems {
+			fmt.Printf("  - %s\n", issue)
+		}
+		return fmt.Errorf("template validation failed")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateValidateCmd)
+
+	templateListCmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
+}
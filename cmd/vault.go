@@ -0,0 +1,1063 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/compact"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/encryption/convergent"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/encryption/pathencryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/rechunk"
+	"github.com/substantialcattle5/sietch/internal/recompress"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/internal/validation"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// vaultCmd groups vault maintenance operations
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Vault maintenance operations",
+	Long: `Maintenance operations for a Sietch vault.
+
+Example:
+  sietch vault migrate-layout            # Move chunks into the sharded layout
+  sietch vault migrate-layout --dry-run  # Show what would be moved
+  sietch vault encrypt-paths             # Hide file names in manifests
+  sietch vault rechunk --chunk-size 1MB  # Re-chunk stored files under new settings
+  sietch vault recompress --algorithm zstd # Compress stored chunks with another algorithm
+  sietch vault list                      # Show the registered vaults
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// vaultMigrateLayoutCmd moves chunks into the sharded or nested layout
+var vaultMigrateLayoutCmd = &cobra.Command{
+	Use:   "migrate-layout",
+	Short: "Migrate chunk storage to a sharded layout",
+	Long: `Move chunks stored directly in .sietch/chunks/ into sharded directories
+named after the first two characters of the chunk hash
+(e.g. .sietch/chunks/ab/abcdef...), or with --layout nested into two levels
+of them named after the first four (e.g. .sietch/chunks/ab/cd/abcdef...).
+
+Large vaults with a flat chunk directory degrade on many filesystems; the
+nested layout keeps directories small in vaults of millions of chunks.
+The migration is safe to interrupt and re-run: chunks are readable from
+any layout until the vault is marked as migrated.
+
+Example:
+  sietch vault migrate-layout --dry-run
+  sietch vault migrate-layout
+  sietch vault migrate-layout --layout nested`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+		if store := layout.SharedStore(vaultRoot); store != "" {
+			return fmt.Errorf("the vault keeps its chunks in the shared store %s, which is always sharded", store)
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		// Without --layout a nested vault stays nested and any other is sharded
+		target := constants.ChunkLayoutSharded
+		if vaultConfig.Chunking.LayoutVersion == constants.ChunkLayoutNested {
+			target = constants.ChunkLayoutNested
+		}
+		if name, _ := cmd.Flags().GetString("layout"); name != "" {
+			if target, err = layout.Parse(name); err != nil {
+				return err
+			}
+			if target == constants.ChunkLayoutFlat {
+				return fmt.Errorf("chunks can only be migrated to the sharded or nested layout")
+			}
+		}
+
+		misplaced, err := layout.MisplacedChunks(vaultRoot, target)
+		if err != nil {
+			return err
+		}
+
+		alreadyMigrated := vaultConfig.Chunking.LayoutVersion == target
+		if alreadyMigrated && len(misplaced) == 0 {
+			fmt.Printf("✓ Vault already uses the %s chunk layout\n", layout.Name(target))
+			return nil
+		}
+
+		if dryRun {
+			fmt.Printf("Dry run: %d chunk(s) would be moved into the %s layout\n", len(misplaced), layout.Name(target))
+			for _, hash := range misplaced {
+				fmt.Printf("  %s -> %s\n", hash, layout.ChunkRelPathIn(hash, target))
+			}
+			if !alreadyMigrated {
+				fmt.Printf("vault.yaml would be updated to chunking.layout_version: %d\n", target)
+			}
+			return nil
+		}
+
+		total := len(misplaced)
+		for i, hash := range misplaced {
+			if err := layout.MoveChunk(vaultRoot, hash, target); err != nil {
+				return fmt.Errorf("migration stopped after %d/%d chunks: %v", i, total, err)
+			}
+			if (i+1)%100 == 0 || i+1 == total {
+				fmt.Printf("\rMigrated %d/%d chunks", i+1, total)
+			}
+		}
+		if total > 0 {
+			fmt.Println()
+		}
+		layout.RemoveEmptyShards(layout.LocalChunkDirectory(vaultRoot))
+
+		if !alreadyMigrated {
+			vaultConfig.Chunking.LayoutVersion = target
+			if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+				return fmt.Errorf("chunks migrated but failed to update vault configuration: %v", err)
+			}
+		}
+
+		fmt.Printf("✓ Migrated %d chunk(s) to the %s layout\n", total, layout.Name(target))
+		return nil
+	},
+}
+
+// vaultMigrateCmd upgrades vault.yaml to a newer schema version
+var vaultMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the vault configuration schema",
+	Long: `Upgrade vault.yaml to a newer schema version.
+
+Vaults are migrated to the newest schema automatically when they are opened,
+after a copy of the original vault.yaml is saved in .sietch/backups/. This
+command runs the migrations explicitly, optionally stopping at an older
+version with --to, and --dry-run lists them without changing anything.
+
+A vault written by a newer version of sietch is never modified; upgrade sietch
+to open it.
+
+Example:
+  sietch vault migrate --dry-run
+  sietch vault migrate
+  sietch vault migrate --to 2`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, _ := cmd.Flags().GetInt("to")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if to == 0 {
+			to = constants.VaultSchemaVersion
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		from, err := config.VaultSchemaVersion(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if err := config.CheckMigration(from, to); err != nil {
+			return err
+		}
+		if from == to {
+			fmt.Printf("✓ Vault is at schema version %d\n", from)
+			return nil
+		}
+
+		if dryRun {
+			fmt.Printf("Dry run: vault.yaml would be migrated from schema version %d to %d\n", from, to)
+			for _, m := range config.PendingMigrations(from, to) {
+				fmt.Printf("  %d -> %d: %s\n", m.From, m.To, m.Description)
+			}
+			return nil
+		}
+
+		from, backup, err := config.MigrateVaultConfig(vaultRoot, to)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Migrated vault.yaml from schema version %d to %d\n", from, to)
+		fmt.Printf("  The previous vault.yaml is saved as %s\n", backup)
+		return nil
+	},
+}
+
+// vaultRechunkCmd re-ingests every file under new chunking settings
+var vaultRechunkCmd = &cobra.Command{
+	Use:   "rechunk",
+	Short: "Re-chunk stored files under new chunking, hash or compression settings",
+	Long: `Read every file back from the vault, split and hash it again under new
+settings, and rewrite its manifest. Once every file has been rewritten,
+vault.yaml is switched to the new settings and chunks and packs that no file
+or snapshot references any more are removed.
+
+The chunk strategy, chunk size and hash algorithm decide how chunks are
+addressed, so they cannot be changed with 'sietch config set' once a vault
+holds data. Chunks whose content is already stored are reused as they are,
+whatever compression they were stored with; the new compression applies to
+the chunks this command writes.
+
+Files are rewritten in batches that commit together with the progress made.
+The command is safe to interrupt: run it again without flags to resume.
+'sietch add' is refused until the rechunk has finished. Vaults using a shared
+chunk store cannot be rechunked, and the hash algorithm can only change in a
+vault without snapshots.
+
+Example:
+  sietch vault rechunk --strategy cdc --chunk-size 1MB --dry-run
+  sietch vault rechunk --hash-algorithm blake3
+  sietch vault rechunk   # resume an interrupted rechunk`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		if recompress.InProgress(vaultRoot) {
+			return fmt.Errorf("a recompress is in progress; run 'sietch vault recompress' to finish it first")
+		}
+		state, err := rechunk.Resume(vaultRoot)
+		if err != nil {
+			return err
+		}
+		target := rechunkTarget(cmd, vaultConfig)
+		if state != nil {
+			if target != state.To && rechunkFlagsSet(cmd) {
+				return fmt.Errorf("a rechunk to %s is in progress; run 'sietch vault rechunk' without flags to finish it first", state.To)
+			}
+			fmt.Printf("Resuming rechunk to %s (%d files done)\n", state.To, state.Files)
+		} else if dryRun {
+			if err := target.Validate(); err != nil {
+				return err
+			}
+			state = &rechunk.State{From: rechunk.SettingsOf(vaultConfig), To: target}
+			if state.From == state.To {
+				fmt.Println("✓ Vault already uses these settings")
+				return nil
+			}
+		} else {
+			state, err = rechunk.Start(vaultRoot, vaultConfig, target)
+			if errors.Is(err, rechunk.ErrUnchanged) {
+				fmt.Println("✓ Vault already uses these settings")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		plan, err := rechunk.PlanFor(vaultRoot, state)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			fmt.Printf("Dry run: %d file(s) (%s) would be rechunked\n", len(plan.Manifests), util.HumanReadableSize(plan.Bytes))
+			fmt.Printf("  from: %s\n", state.From)
+			fmt.Printf("  to:   %s\n", state.To)
+			return nil
+		}
+		fmt.Printf("Rechunking %d file(s) (%s)\n  from: %s\n  to:   %s\n",
+			len(plan.Manifests), util.HumanReadableSize(plan.Bytes), state.From, state.To)
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		retryPolicy, err := storeRetryPolicy(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		result, err := rechunk.Run(ctx, vaultRoot, vaultConfig, state, rechunk.Options{
+			Passphrase: passphrase,
+			Retry:      retryPolicy,
+			OnFile: func(done, total int) {
+				if done%100 == 0 || done == total {
+					fmt.Printf("\rRechunked %d/%d files", done, total)
+				}
+				if done == total {
+					fmt.Println()
+				}
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("%v (run 'sietch vault rechunk' again to resume)", err)
+		}
+
+		fmt.Printf("✓ Rechunked %d file(s) (%s): %d new chunks, %d reused\n",
+			result.Files, util.HumanReadableSize(result.Bytes), result.NewChunks, result.ReusedChunks)
+		fmt.Printf("✓ Removed %d old chunks and packs (%s freed)\n", result.OrphansDeleted, util.HumanReadableSize(result.BytesFreed))
+		fmt.Printf("✓ Vault now uses %s\n", state.To)
+		return nil
+	},
+}
+
+// rechunkFlags are the settings vault rechunk can change
+var rechunkFlags = []string{"strategy", "chunk-size", "hash-algorithm", "compression", "compression-level"}
+
+// rechunkFlagsSet reports whether any setting was given on the command line
+func rechunkFlagsSet(cmd *cobra.Command) bool {
+	for _, name := range rechunkFlags {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rechunkTarget returns the vault's settings with those given on the command line applied
+func rechunkTarget(cmd *cobra.Command, vaultConfig *config.VaultConfig) rechunk.Settings {
+	target := rechunk.SettingsOf(vaultConfig)
+	if cmd.Flags().Changed("strategy") {
+		target.Strategy, _ = cmd.Flags().GetString("strategy")
+	}
+	if cmd.Flags().Changed("chunk-size") {
+		target.ChunkSize, _ = cmd.Flags().GetString("chunk-size")
+	}
+	if cmd.Flags().Changed("hash-algorithm") {
+		target.HashAlgorithm, _ = cmd.Flags().GetString("hash-algorithm")
+	}
+	if cmd.Flags().Changed("compression") {
+		target.Compression, _ = cmd.Flags().GetString("compression")
+		// A level only means something for the algorithm it was chosen for
+		target.CompressionLevel = 0
+	}
+	if cmd.Flags().Changed("compression-level") {
+		target.CompressionLevel, _ = cmd.Flags().GetInt("compression-level")
+	}
+	return target
+}
+
+// vaultRecompressCmd rewrites stored chunks with another compression
+var vaultRecompressCmd = &cobra.Command{
+	Use:   "recompress [path...]",
+	Short: "Compress stored chunks again with another algorithm or level",
+	Long: `Rewrite the chunks the vault already stores with another compression. Changing
+the vault's compression only affects new chunks; this command reads each old
+chunk, decrypts and decompresses it, compresses it with --algorithm and --level
+(the vault's compression by default) and encrypts it again. The content and its
+hash stay the same, so deduplication is unaffected, and the manifests of live
+files and snapshots referencing a chunk are updated with it.
+
+Chunks already stored with the target algorithm are skipped; the level is not
+recorded per chunk, so use --force to rewrite them at another level. Chunks
+stored uncompressed because compression did not pay off are skipped as well.
+Give vault paths (files or directories) to only rewrite the chunks of those
+files. Small files in packs are compressed with their pack and left alone.
+
+Chunks are rewritten in batches that commit together with the progress made.
+The command is safe to interrupt: run it again without arguments to resume.
+Vaults using a shared chunk store cannot be recompressed.
+
+Example:
+  sietch vault recompress --algorithm zstd --level 6
+  sietch vault recompress --algorithm zstd docs/ --dry-run
+  sietch vault recompress   # resume an interrupted recompress`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if rechunk.InProgress(vaultRoot) {
+			return fmt.Errorf("a rechunk is in progress; run 'sietch vault rechunk' to finish it first")
+		}
+
+		state, err := recompress.Resume(vaultRoot)
+		if err != nil {
+			return err
+		}
+		target := recompressTarget(cmd, vaultConfig, args)
+		if state != nil {
+			if len(args) > 0 || cmd.Flags().Changed("algorithm") || cmd.Flags().Changed("level") || cmd.Flags().Changed("force") {
+				return fmt.Errorf("a recompress to %s is in progress; run 'sietch vault recompress' without arguments to finish it first", state.Target)
+			}
+			fmt.Printf("Resuming recompress to %s (%d chunks done)\n", state.Target, state.Chunks)
+		} else if dryRun {
+			if err := target.Validate(); err != nil {
+				return err
+			}
+			state = &recompress.State{Target: target}
+		} else if state, err = recompress.Start(vaultRoot, target); err != nil {
+			return err
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		plan, err := recompress.PlanFor(vaultRoot, vaultConfig, state, passphrase)
+		if err != nil {
+			return err
+		}
+		if plan.Packed > 0 {
+			fmt.Printf("Skipping %d packed file(s); they are compressed with their pack\n", plan.Packed)
+		}
+		if plan.NotLocal > 0 {
+			fmt.Printf("Skipping %d chunk(s) that are not local yet; run 'sietch sync' first to include them\n", plan.NotLocal)
+		}
+		if dryRun {
+			fmt.Printf("Dry run: %d chunk(s) (%s) would be recompressed to %s, %d already are\n",
+				len(plan.Chunks), util.HumanReadableSize(plan.Bytes), state.Target, plan.Skipped)
+			return nil
+		}
+		if len(plan.Chunks) > 0 {
+			fmt.Printf("Recompressing %d chunk(s) (%s) to %s, skipping %d already in that format\n",
+				len(plan.Chunks), util.HumanReadableSize(plan.Bytes), state.Target, plan.Skipped)
+		}
+
+		retryPolicy, err := storeRetryPolicy(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		progressMgr := progress.NewManager(progress.Options{Quiet: quiet})
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		progressMgr.InitTotalProgress(plan.Bytes, "Recompressing")
+		result, err := recompress.Run(ctx, vaultRoot, vaultConfig, state, plan, recompress.Options{
+			Passphrase: passphrase,
+			Retry:      retryPolicy,
+			OnChunk:    progressMgr.UpdateTotalProgress,
+		})
+		if err != nil {
+			return fmt.Errorf("%v (run 'sietch vault recompress' again to resume)", err)
+		}
+		progressMgr.FinishTotalProgress()
+
+		if result.Chunks == 0 {
+			fmt.Printf("✓ Every chunk is already stored with %s\n", state.Target)
+			return nil
+		}
+		fmt.Printf("✓ Recompressed %d chunk(s) to %s: %s → %s\n", result.Chunks, state.Target,
+			util.HumanReadableSize(result.BytesBefore), util.HumanReadableSize(result.BytesAfter))
+		if saved := result.Saved(); saved >= 0 {
+			fmt.Printf("✓ Saved %s\n", util.HumanReadableSize(saved))
+		} else {
+			fmt.Printf("⚠ Chunks grew by %s\n", util.HumanReadableSize(-saved))
+		}
+		return nil
+	},
+}
+
+// recompressTarget returns the compression given on the command line, defaulting
+// to the vault's own
+func recompressTarget(cmd *cobra.Command, vaultConfig *config.VaultConfig, paths []string) recompress.Target {
+	target := recompress.Target{Algorithm: vaultConfig.Compression, Level: vaultConfig.CompressionLevel, Paths: paths}
+	if target.Algorithm == "" {
+		target.Algorithm = constants.CompressionTypeNone
+	}
+	if cmd.Flags().Changed("algorithm") {
+		target.Algorithm, _ = cmd.Flags().GetString("algorithm")
+		if target.Algorithm != vaultConfig.Compression {
+			target.Level = 0
+		}
+	}
+	if cmd.Flags().Changed("level") {
+		target.Level, _ = cmd.Flags().GetInt("level")
+	}
+	target.Force, _ = cmd.Flags().GetBool("force")
+	return target
+}
+
+// vaultEncryptPathsCmd turns on path encryption and converts the existing manifests
+var vaultEncryptPathsCmd = &cobra.Command{
+	Use:   "encrypt-paths",
+	Short: "Encrypt file paths stored in manifests",
+	Long: `Encrypt the destination and file name recorded in every manifest with the
+vault key, and name manifests after a keyed hash of the path instead of the path
+itself. A manifest synced to a peer without the key then no longer reveals file
+names; 'sietch ls', 'get' and 'delete' decrypt them after asking for the
+passphrase.
+
+Sizes, timestamps, tags and chunk hashes stay readable. Existing snapshots keep
+their plaintext copies until they are deleted. Vaults that have not run this
+command are unaffected.
+
+Example:
+  sietch vault encrypt-paths`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if vaultConfig.Encryption.EncryptPaths {
+			fmt.Println("✓ Vault already encrypts file paths")
+			return nil
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		vaultConfig.Encryption.PathKey, err = pathencryption.NewKey(vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+		vaultConfig.Encryption.EncryptPaths = true
+		paths, err := pathencryption.Unlock(vaultRoot, vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+
+		// The key is saved before any manifest is converted: plaintext manifests stay
+		// readable in a vault that encrypts paths, sealed ones are lost without the key
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to update vault configuration: %v", err)
+		}
+
+		converted, err := sealManifests(vaultRoot, paths)
+		if err != nil {
+			return fmt.Errorf("%v (re-run 'sietch vault encrypt-paths' to finish)", err)
+		}
+		fmt.Printf("✓ Encrypted the paths of %d manifest(s)\n", converted)
+
+		if snapshots, err := snapshot.List(vaultRoot); err == nil && len(snapshots) > 0 {
+			fmt.Printf("  %d existing snapshot(s) still record plaintext paths; delete them to remove the names.\n", len(snapshots))
+		}
+		return nil
+	},
+}
+
+// sealManifests rewrites every manifest with a plaintext path under its path ID
+// in a single transaction
+func sealManifests(vaultRoot string, paths *pathencryption.Cipher) (int, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := manager.GetManifestEntries()
+	if err != nil {
+		return 0, err
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "vault encrypt-paths"})
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	compress := config.ManifestCompression(vaultRoot)
+	converted := 0
+	for _, entry := range entries {
+		if entry.Manifest.EncryptedPath != "" {
+			continue
+		}
+		manifest := entry.Manifest
+		if err := paths.Seal(&manifest); err != nil {
+			return 0, err
+		}
+		w, err := txn.StageCreate(manifestRelPath(manifest.PathID))
+		if err != nil {
+			return 0, fmt.Errorf("stage manifest %s: %w", manifest.PathID, err)
+		}
+		if err := writeManifestYAML(w, &manifest, compress); err != nil {
+			_ = w.Close()
+			return 0, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		if err := txn.StageDelete(manifestRelPath(strings.TrimSuffix(filepath.Base(entry.Path), ".yaml"))); err != nil {
+			return 0, fmt.Errorf("stage manifest delete: %w", err)
+		}
+		converted++
+	}
+
+	if err := txn.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	committed = true
+	return converted, nil
+}
+
+// manifestRelPath returns the vault-relative path of a manifest name without extension
+func manifestRelPath(name string) string {
+	return filepath.ToSlash(filepath.Join(".sietch", "manifests", name+".yaml"))
+}
+
+// unlockPaths asks for the passphrase of a vault that encrypts file paths and
+// returns its path cipher; vaults with plaintext paths need neither
+func unlockPaths(cmd *cobra.Command, vaultRoot string, vaultConfig *config.VaultConfig) (*pathencryption.Cipher, error) {
+	if !vaultConfig.Encryption.EncryptPaths {
+		return nil, nil
+	}
+	passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	return pathencryption.Unlock(vaultRoot, vaultConfig, passphrase)
+}
+
+// vaultEncryptIndexCmd turns on encryption of the deduplication index
+var vaultEncryptIndexCmd = &cobra.Command{
+	Use:   "encrypt-index",
+	Short: "Encrypt the deduplication index at rest",
+	Long: `Encrypt the deduplication index in .sietch/index/ with a key wrapped by
+the vault key. The index records the hash, size and reference count of every
+chunk; encrypted, it reveals none of them until the vault is unlocked. Commands
+that use the index decrypt it into memory when they open it, asking for the
+passphrase if the vault key needs one.
+
+The index is rewritten encrypted at once, and stays encrypted from then on. A
+vault using a shared chunk store cannot encrypt its index, which the other
+vaults in the store read too. Vaults that have not run this command are
+unaffected.
+
+Example:
+  sietch vault encrypt-index`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if vaultConfig.Encryption.EncryptIndex {
+			fmt.Println("✓ Vault already encrypts its deduplication index")
+			return nil
+		}
+		if layout.SharedStore(vaultRoot) != "" {
+			return fmt.Errorf("the vault uses a shared chunk store, whose index the other vaults in it read too; it cannot be encrypted")
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		vaultConfig.Encryption.IndexKey, err = deduplication.NewIndexKey(vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+		vaultConfig.Encryption.EncryptIndex = true
+		if err := deduplication.UnlockIndex(vaultRoot, vaultConfig, passphrase); err != nil {
+			return err
+		}
+
+		// The key is saved before the index is rewritten: a plaintext index stays
+		// readable in a vault that encrypts it, and is encrypted on its next save
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to update vault configuration: %v", err)
+		}
+
+		idx, err := deduplication.NewDeduplicationIndex(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if err := idx.Rewrite(config.ManifestCompression(vaultRoot)); err != nil {
+			return fmt.Errorf("%v (the index is encrypted the next time it is saved)", err)
+		}
+		fmt.Printf("✓ Encrypted the deduplication index (%d chunks)\n", idx.GetStats().TotalChunks)
+		return nil
+	},
+}
+
+// vaultCompactCmd converts the vault's metadata between plain and compressed storage
+var vaultCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Compress the vault's manifests and index",
+	Long: `Rewrite every file manifest, live and in snapshots, and the deduplication
+index snapshot as zstd compressed files, and record manifest_format: 2 in
+vault.yaml so files added later are stored compressed too.
+
+Manifests are mostly chunk hashes and compress to about a third of their
+size; loading them takes the same time. Compressed and plain manifests can be
+mixed, so an interrupted run leaves a working vault and running the command
+again finishes the conversion. Versions of sietch from before manifest
+compression cannot read a compacted vault; --decompress converts it back.
+
+Example:
+  sietch vault compact --dry-run
+  sietch vault compact
+  sietch vault compact --decompress`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		decompress, _ := cmd.Flags().GetBool("decompress")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+
+		result, err := compact.Run(vaultRoot, !decompress, dryRun)
+		if err != nil {
+			return err
+		}
+
+		action := "Compressed"
+		if decompress {
+			action = "Decompressed"
+		}
+		if dryRun {
+			fmt.Printf("Dry run: %d manifest(s) would be rewritten (%s -> %s), %d already converted\n",
+				result.Converted, util.HumanReadableSize(result.BytesBefore), util.HumanReadableSize(result.BytesAfter), result.Unchanged)
+			if result.HasIndex {
+				fmt.Println("The deduplication index snapshot would be rewritten")
+			}
+			return nil
+		}
+		fmt.Printf("✓ %s %d manifest(s): %s -> %s (%d already converted)\n", action, result.Converted,
+			util.HumanReadableSize(result.BytesBefore), util.HumanReadableSize(result.BytesAfter), result.Unchanged)
+		if result.HasIndex {
+			fmt.Printf("✓ Rewrote the deduplication index: %s -> %s\n",
+				util.HumanReadableSize(result.IndexBefore), util.HumanReadableSize(result.IndexAfter))
+		}
+		return nil
+	},
+}
+
+// vaultConvergentCmd groups the convergent encryption commands
+var vaultConvergentCmd = &cobra.Command{
+	Use:   "convergent",
+	Short: "Manage convergent chunk encryption",
+	Long: `Convergent encryption derives each chunk's key from its content and a mixing
+secret, so identical chunks encrypt to identical data. Vaults and peers that
+hold the same secret then store a shared chunk once and skip it when syncing.
+
+The tradeoff: anyone with the secret can confirm whether the vault holds a file
+they already have. Only share the secret with peers you trust with that.
+
+Example:
+  sietch vault convergent enable
+  sietch vault convergent export-secret <peer-id> -o secret.yaml
+  sietch vault convergent enable --secret-file secret.yaml   # on the peer`,
+}
+
+// vaultConvergentEnableCmd turns on convergent encryption for new chunks
+var vaultConvergentEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Encrypt new chunks convergently",
+	Long: `Encrypt chunks added from now on convergently. A new mixing secret is
+generated unless --secret-file names a secret exported by a trusted peer, in
+which case both vaults encrypt identical chunks identically. Chunks already in
+the vault keep their encryption.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		secretFile, _ := cmd.Flags().GetString("secret-file")
+		settings := vaultConfig.Encryption.Convergent
+		if settings != nil && settings.Enabled && secretFile == "" {
+			fmt.Printf("✓ Convergent encryption is already enabled (secret %s)\n", settings.SecretID)
+			return nil
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		secret, err := convergenceSecret(vaultRoot, vaultConfig, passphrase, secretFile)
+		if err != nil {
+			return err
+		}
+		wrapped, err := convergent.Wrap(secret, vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+		vaultConfig.Encryption.Convergent = &config.ConvergentConfig{
+			Enabled:  true,
+			Secret:   wrapped,
+			SecretID: convergent.SecretID(secret),
+		}
+
+		warnings, err := validation.ValidateConvergentEncryption(vaultConfig)
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			fmt.Printf("⚠️  %s\n\n", warning)
+		}
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			fmt.Print("Enable convergent encryption? (y/N): ")
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+			if response != "y" && response != "yes" {
+				fmt.Println("Operation canceled")
+				return nil
+			}
+		}
+
+		if settings != nil && settings.Secret != "" && settings.SecretID != vaultConfig.Encryption.Convergent.SecretID {
+			// Chunks written under the old secret could no longer be read
+			if used, err := vaultUsesConvergentChunks(vaultRoot); err != nil {
+				return err
+			} else if used {
+				return fmt.Errorf("vault already holds chunks encrypted with convergence secret %s; it cannot be replaced", settings.SecretID)
+			}
+		}
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to update vault configuration: %v", err)
+		}
+		fmt.Printf("✓ Convergent encryption enabled (secret %s)\n", vaultConfig.Encryption.Convergent.SecretID)
+		fmt.Println("  Chunks already in the vault keep their current encryption.")
+		return nil
+	},
+}
+
+// vaultConvergentDisableCmd goes back to encrypting new chunks with the vault key
+var vaultConvergentDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop encrypting new chunks convergently",
+	Long: `Encrypt chunks added from now on with the vault key only. The mixing secret
+is kept so chunks already encrypted convergently stay readable.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		settings := vaultConfig.Encryption.Convergent
+		if settings == nil || !settings.Enabled {
+			fmt.Println("✓ Convergent encryption is not enabled")
+			return nil
+		}
+		settings.Enabled = false
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to update vault configuration: %v", err)
+		}
+		fmt.Println("✓ Convergent encryption disabled for new chunks")
+		return nil
+	},
+}
+
+// vaultConvergentExportCmd seals the mixing secret to one trusted peer
+var vaultConvergentExportCmd = &cobra.Command{
+	Use:   "export-secret <peer-id>",
+	Short: "Share the convergence secret with a trusted peer",
+	Long: `Write the vault's mixing secret sealed to the sync key of a trusted peer
+(see 'sietch sync'). Only that peer can open the file, with
+'sietch vault convergent enable --secret-file <file>'. The peer needs an RSA
+sync key.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		peer := findTrustedPeer(vaultConfig, args[0])
+		if peer == nil {
+			return fmt.Errorf("%s is not a trusted peer of this vault", args[0])
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		secret, err := convergent.UnwrapSecret(vaultRoot, vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+		bundle, err := convergent.SealFor(secret, *peer)
+		if err != nil {
+			return err
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			output = fmt.Sprintf("convergence-secret-%s.yaml", convergent.SecretID(secret))
+		}
+		if err := os.WriteFile(output, bundle, 0o600); err != nil {
+			return fmt.Errorf("failed to write secret bundle: %v", err)
+		}
+		fmt.Printf("✓ Sealed convergence secret %s for peer %s to %s\n", convergent.SecretID(secret), args[0], output)
+		return nil
+	},
+}
+
+// convergenceSecret returns the secret to enable convergent encryption with: one
+// imported from a peer's bundle, the vault's previous secret, or a new one
+func convergenceSecret(vaultRoot string, vaultConfig *config.VaultConfig, passphrase, secretFile string) ([]byte, error) {
+	if secretFile != "" {
+		data, err := os.ReadFile(secretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret bundle: %v", err)
+		}
+		if vaultConfig.Sync.RSA == nil {
+			return nil, fmt.Errorf("vault has no sync key to open the secret bundle with")
+		}
+		privateKey, _, _, err := keys.LoadSyncKeys(vaultRoot, vaultConfig.Sync.RSA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sync key: %v", err)
+		}
+		return convergent.OpenBundle(data, privateKey)
+	}
+	if settings := vaultConfig.Encryption.Convergent; settings != nil && settings.Secret != "" {
+		return convergent.UnwrapSecret(vaultRoot, vaultConfig, passphrase)
+	}
+	return convergent.NewSecret()
+}
+
+// vaultUsesConvergentChunks reports whether any manifest, live or in a snapshot,
+// references a convergently encrypted chunk
+func vaultUsesConvergentChunks(vaultRoot string) (bool, error) {
+	dirs := []string{filepath.Join(vaultRoot, ".sietch", "manifests")}
+	snapshots, err := snapshot.List(vaultRoot)
+	if err != nil {
+		return false, err
+	}
+	for _, snap := range snapshots {
+		dirs = append(dirs, snapshot.ManifestDir(vaultRoot, snap.ID))
+	}
+
+	used := false
+	for _, dir := range dirs {
+		err := config.WalkManifestDir(dir, func(entry *config.ManifestEntry) error {
+			for _, chunk := range entry.Manifest.Chunks {
+				if chunk.Convergent {
+					used = true
+					return filepath.SkipAll
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, filepath.SkipAll) {
+			return false, err
+		}
+		if used {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func init() {
+	rootCmd.AddCommand(vaultCmd)
+	vaultCmd.AddCommand(vaultMigrateLayoutCmd)
+	vaultCmd.AddCommand(vaultMigrateCmd)
+	vaultCmd.AddCommand(vaultEncryptPathsCmd)
+	vaultCmd.AddCommand(vaultEncryptIndexCmd)
+	vaultCmd.AddCommand(vaultRechunkCmd)
+	vaultCmd.AddCommand(vaultRecompressCmd)
+	vaultCmd.AddCommand(vaultCompactCmd)
+	vaultCmd.AddCommand(vaultConvergentCmd)
+	vaultConvergentCmd.AddCommand(vaultConvergentEnableCmd)
+	vaultConvergentCmd.AddCommand(vaultConvergentDisableCmd)
+	vaultConvergentCmd.AddCommand(vaultConvergentExportCmd)
+
+	vaultMigrateLayoutCmd.Flags().Bool("dry-run", false, "Show what would be migrated without moving any chunks")
+	vaultMigrateLayoutCmd.Flags().String("layout", "", "Layout to migrate to (sharded, nested); by default the vault's own, or sharded")
+	vaultMigrateCmd.Flags().Int("to", 0, "Schema version to migrate to (default: the newest this sietch supports)")
+	vaultMigrateCmd.Flags().Bool("dry-run", false, "List the migrations that would run without changing anything")
+	vaultRechunkCmd.Flags().String("strategy", "", "Chunking strategy to rechunk with (fixed or cdc)")
+	vaultRechunkCmd.Flags().String("chunk-size", "", "Chunk size to rechunk with (e.g. 1MB)")
+	vaultRechunkCmd.Flags().String("hash-algorithm", "", "Hash algorithm to address chunks with (sha256, sha512, sha1, blake3)")
+	vaultRechunkCmd.Flags().String("compression", "", "Compression for the chunks written (none, gzip, zstd, lz4, brotli)")
+	vaultRechunkCmd.Flags().Int("compression-level", 0, "Compression level for the chunks written (0 for the default)")
+	vaultRechunkCmd.Flags().Bool("dry-run", false, "Show what would be rechunked without changing anything")
+	vaultRechunkCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	vaultRechunkCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	vaultRecompressCmd.Flags().String("algorithm", "", "Compression to rewrite chunks with (none, gzip, zstd, lz4, brotli); defaults to the vault's")
+	vaultRecompressCmd.Flags().Int("level", 0, "Compression level (0 for the default)")
+	vaultRecompressCmd.Flags().Bool("force", false, "Also rewrite chunks already compressed with the algorithm, e.g. to change the level")
+	vaultRecompressCmd.Flags().Bool("dry-run", false, "Show what would be recompressed without changing anything")
+	vaultRecompressCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	vaultRecompressCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	vaultCompactCmd.Flags().Bool("decompress", false, "Convert compressed manifests and index back to plain files")
+	vaultCompactCmd.Flags().Bool("dry-run", false, "Show what would be converted without changing anything")
+	vaultEncryptPathsCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	vaultEncryptPathsCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	vaultEncryptIndexCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	vaultEncryptIndexCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+
+	vaultConvergentEnableCmd.Flags().String("secret-file", "", "Use the secret from a bundle exported by a trusted peer")
+	vaultConvergentEnableCmd.Flags().BoolP("yes", "y", false, "Enable without confirmation")
+	vaultConvergentExportCmd.Flags().StringP("output", "o", "", "File to write the sealed secret to")
+	for _, c := range []*cobra.Command{vaultConvergentEnableCmd, vaultConvergentExportCmd} {
+		c.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+		c.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	}
+}
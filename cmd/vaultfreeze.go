@@ -0,0 +1,156 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// vaultFreezeCmd makes the vault read-only
+var vaultFreezeCmd = &cobra.Command{
+	Use:   "freeze",
+	Short: "Make the vault read-only",
+	Long: `Mark the vault read-only in vault.yaml, for archives that must not change.
+
+While the vault is frozen every command that changes it (add, delete, dedup gc,
+vault rechunk, vault recompress, sync with a peer, config set, ...) refuses to
+run, while get, ls, verify and serving files to peers keep working: 'sietch
+sync' without a peer address then waits to be found and serves peers without
+fetching from them, and peers syncing over SSH are served as usual. Where the filesystem
+allows, the chunk, pack and manifest directories are also made read-only, so
+other tools cannot change them by accident either.
+
+'sietch vault thaw' makes the vault writable again.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, err := loadCurrentVaultConfig()
+		if err != nil {
+			return err
+		}
+		if !vaultConfig.ReadOnly {
+			vaultConfig.ReadOnly = true
+			if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+				return fmt.Errorf("failed to save configuration: %v", err)
+			}
+		}
+		// Run again on a frozen vault, this makes files copied in since read-only
+		if err := setVaultStoreWritable(vaultRoot, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not make the vault's files read-only: %v\n", err)
+		}
+		fmt.Printf("✓ Vault %s is frozen; run 'sietch vault thaw' to change it again\n", vaultConfig.Name)
+		return nil
+	},
+}
+
+// vaultThawCmd makes a frozen vault writable again
+var vaultThawCmd = &cobra.Command{
+	Use:   "thaw",
+	Short: "Make a frozen vault writable again",
+	Long: `Clear the read-only mark 'sietch vault freeze' set and give the owner write
+permission on the chunk, pack and manifest directories back. A vault protected
+by a passphrase asks for it first.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, err := loadCurrentVaultConfig()
+		if err != nil {
+			return err
+		}
+		if !vaultConfig.ReadOnly {
+			fmt.Println("The vault is not frozen")
+			return nil
+		}
+		if vaultConfig.Encryption.Type != "none" && vaultConfig.Encryption.PassphraseProtected {
+			passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+			if err != nil {
+				return err
+			}
+			if _, err := encryption.LoadDataKey(*vaultConfig, passphrase); err != nil {
+				return fmt.Errorf("vault stays frozen: %v", err)
+			}
+		}
+
+		if err := setVaultStoreWritable(vaultRoot, true); err != nil {
+			return fmt.Errorf("failed to restore write permission: %v", err)
+		}
+		vaultConfig.ReadOnly = false
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return fmt.Errorf("failed to save configuration: %v", err)
+		}
+		fmt.Printf("✓ Vault %s is writable again\n", vaultConfig.Name)
+		return nil
+	},
+}
+
+// setVaultStoreWritable changes the permissions of the directories a frozen
+// vault keeps read-only. A shared chunk store is left alone: the other vaults
+// using it still write to it.
+func setVaultStoreWritable(vaultRoot string, writable bool) error {
+	dirs := []string{layout.PackDirectory(vaultRoot), layout.ChunkPackDirectory(vaultRoot), filepath.Join(vaultRoot, ".sietch", "manifests")}
+	if layout.SharedStore(vaultRoot) == "" {
+		dirs = append(dirs, fs.GetChunkDirectory(vaultRoot))
+	}
+	for _, dir := range dirs {
+		if err := fs.SetTreeWritable(dir, writable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refuseFrozenVault stops commands that change the vault from running in a
+// frozen one. Freezing and thawing are the only changes allowed, along with
+// syncs that only send: serving a peer over SSH, a dry run, and waiting to be
+// found by peers, which a frozen vault does without fetching from them.
+func refuseFrozenVault(cmd *cobra.Command, args []string) error {
+	if cmd == vaultFreezeCmd || cmd == vaultThawCmd || syncOnlySends(cmd, args) {
+		return nil
+	}
+	if mode, ok := commandLockMode(cmd); !ok || mode != lock.Exclusive {
+		return nil
+	}
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil || !fs.IsVaultInitialized(vaultRoot) {
+		return nil
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil || !vaultConfig.ReadOnly {
+		// A config that does not load is reported by the command itself
+		return nil
+	}
+	// The command line is fine, so the usage would only bury the reason
+	cmd.SilenceUsage = true
+	return fmt.Errorf("vault %s is frozen (read-only), so '%s' cannot change it; run 'sietch vault thaw' first", vaultConfig.Name, cmd.CommandPath())
+}
+
+// syncOnlySends reports whether cmd is a sync a frozen vault can run, as it
+// fetches nothing: one serving a peer over SSH, a dry run, or one left to
+// discover peers, which only serves them while the vault is frozen
+func syncOnlySends(cmd *cobra.Command, args []string) bool {
+	if cmd != syncCmd {
+		return false
+	}
+	serveStdio, _ := cmd.Flags().GetBool("serve-stdio")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	return serveStdio || dryRun || len(args) == 0
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultFreezeCmd)
+	vaultCmd.AddCommand(vaultThawCmd)
+	vaultThawCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	vaultThawCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// TestRefuseFrozenVault ensures a frozen vault refuses what would change it
+// but still lets syncs that only send run
+func TestRefuseFrozenVault(t *testing.T) {
+	vaultRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), []byte("name: archive\nread_only: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(vaultRoot)
+
+	tests := []struct {
+		name    string
+		cmd     *cobra.Command
+		flags   map[string]string
+		args    []string
+		refused bool
+	}{
+		{"add", addCmd, nil, []string{"notes.txt"}, true},
+		{"sync with a peer", syncCmd, nil, []string{"ssh://backup.lan/srv/vault"}, true},
+		{"sync serving over SSH", syncCmd, map[string]string{"serve-stdio": "true"}, nil, false},
+		{"sync dry run", syncCmd, map[string]string{"dry-run": "true"}, []string{"ssh://backup.lan/srv/vault"}, false},
+		{"sync waiting for peers", syncCmd, nil, nil, false},
+		{"get", getCmd, nil, []string{"notes.txt"}, false},
+		{"thaw", vaultThawCmd, nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for flag, value := range tt.flags {
+				if err := tt.cmd.Flags().Set(flag, value); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() {
+					f := tt.cmd.Flags().Lookup(flag)
+					_ = f.Value.Set(f.DefValue)
+					f.Changed = false
+				})
+			}
+			err := refuseFrozenVault(tt.cmd, tt.args)
+			if (err != nil) != tt.refused {
+				t.Errorf("refuseFrozenVault() = %v, want refused %v", err, tt.refused)
+			}
+		})
+	}
+}
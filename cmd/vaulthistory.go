@@ -0,0 +1,92 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// vaultHistoryCmd prints the changes made to the vault configuration
+var vaultHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show when the vault configuration changed, where and how",
+	Long: `Show the changes made to vault.yaml, oldest first: creation, config set,
+schema migrations, key and recipient changes, peers trusted during a sync or
+removed, and every other command that rewrites the configuration.
+
+Each entry records the time, host, user, sietch version and command, and the
+settings that changed. Secrets are never recorded; lists such as trusted peers
+are shown by their number of entries. The history lives in .sietch/history.jsonl
+and keeps the newest history_limit entries (default 1000), set with
+'sietch config set history_limit <n>'.
+
+Example:
+  sietch vault history
+  sietch vault history -n 10
+  sietch vault history -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		last, _ := cmd.Flags().GetInt("last")
+		if last < 0 {
+			return fmt.Errorf("--last must not be negative")
+		}
+
+		vaultRoot, _, err := loadCurrentVaultConfig()
+		if err != nil {
+			return err
+		}
+		entries, err := config.LoadHistory(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if last > 0 && len(entries) > last {
+			entries = entries[len(entries)-last:]
+		}
+
+		if outputFormat == "json" {
+			if entries == nil {
+				entries = []config.HistoryEntry{}
+			}
+			data, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode history: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("No configuration changes recorded yet")
+			return nil
+		}
+		for _, entry := range entries {
+			command := entry.Command
+			if command == "" {
+				command = "(unknown command)"
+			}
+			fmt.Printf("%s  %s  %s@%s  sietch %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"),
+				command, entry.User, entry.Host, entry.Version)
+			for _, change := range entry.Changes {
+				fmt.Printf("    %s\n", change)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultHistoryCmd)
+	vaultHistoryCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	vaultHistoryCmd.Flags().IntP("last", "n", 0, "Show only the newest n entries (0 = all)")
+}
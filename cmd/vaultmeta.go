@@ -0,0 +1,187 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// vaultTagCmd groups the commands that edit the vault's tags
+var vaultTagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "List and change the vault's tags",
+	Long: `List and change the tags in vault.yaml's metadata section, first set from the
+template at scaffold time. Tags are words of letters, digits and . _ : -, up
+to 64 characters. They are shown by 'sietch status' and 'sietch vault list',
+which can filter on them, and sync passes them to peers: the side edited last
+wins.
+
+Example:
+  sietch vault tag add work archive
+  sietch vault tag remove archive
+  sietch vault list --tag work`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// vaultTagAddCmd adds tags to the vault
+var vaultTagAddCmd = &cobra.Command{
+	Use:          "add <tag>...",
+	Short:        "Add tags to the vault",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editVaultMetadata(func(metadata *config.MetadataConfig) (bool, error) {
+			added, err := config.AddTags(metadata, args...)
+			if err != nil {
+				return false, err
+			}
+			if len(added) == 0 {
+				fmt.Println("The vault already has these tags")
+				return false, nil
+			}
+			fmt.Printf("✓ Added %s\n", strings.Join(added, ", "))
+			return true, nil
+		})
+	},
+}
+
+// vaultTagRemoveCmd removes tags from the vault
+var vaultTagRemoveCmd = &cobra.Command{
+	Use:               "remove <tag>...",
+	Short:             "Remove tags from the vault",
+	Args:              cobra.MinimumNArgs(1),
+	SilenceUsage:      true,
+	ValidArgsFunction: completeVaultTags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editVaultMetadata(func(metadata *config.MetadataConfig) (bool, error) {
+			removed := config.RemoveTags(metadata, args...)
+			if len(removed) == 0 {
+				return false, fmt.Errorf("the vault has none of these tags (see 'sietch vault tag list')")
+			}
+			fmt.Printf("✓ Removed %s\n", strings.Join(removed, ", "))
+			return true, nil
+		})
+	},
+}
+
+// vaultTagListCmd prints the vault's tags
+var vaultTagListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the vault's tags",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, vaultConfig, err := loadCurrentVaultConfig()
+		if err != nil {
+			return err
+		}
+		for _, tag := range vaultConfig.Metadata.Tags {
+			fmt.Println(tag)
+		}
+		return nil
+	},
+}
+
+// vaultMetaCmd groups the commands that edit the vault's freeform metadata
+var vaultMetaCmd = &cobra.Command{
+	Use:   "meta",
+	Short: "Change the vault's metadata",
+	Long: `Change the author and freeform fields in vault.yaml's metadata section. The
+fields are shown by 'sietch status' and passed to peers by sync like the tags.
+
+Example:
+  sietch vault meta set owner "Field team"
+  sietch vault meta set author "Liet Kynes"
+  sietch vault meta set owner ""`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// vaultMetaSetCmd sets one metadata field
+var vaultMetaSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a metadata field",
+	Long: `Set the author or a freeform metadata field. Keys are letters, digits and
+. _ -, starting with a letter; an empty value ("") removes the field.`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, value := args[0], args[1]
+		return editVaultMetadata(func(metadata *config.MetadataConfig) (bool, error) {
+			previous := config.GetMetadata(metadata, key)
+			changed, err := config.SetMetadata(metadata, key, value)
+			if err != nil || !changed {
+				if err == nil {
+					fmt.Printf("%s is already %s\n", key, displaySetting(value))
+				}
+				return false, err
+			}
+			fmt.Printf("✓ %s: %s → %s\n", key, displaySetting(previous), displaySetting(value))
+			return true, nil
+		})
+	},
+}
+
+// loadCurrentVaultConfig finds the vault and loads its configuration
+func loadCurrentVaultConfig() (string, *config.VaultConfig, error) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return "", nil, fmt.Errorf("not inside a vault: %v", err)
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	return vaultRoot, vaultConfig, nil
+}
+
+// editVaultMetadata applies edit to the vault's metadata and saves vault.yaml
+// when edit reports a change
+func editVaultMetadata(edit func(metadata *config.MetadataConfig) (bool, error)) error {
+	vaultRoot, vaultConfig, err := loadCurrentVaultConfig()
+	if err != nil {
+		return err
+	}
+	changed, err := edit(&vaultConfig.Metadata)
+	if err != nil || !changed {
+		return err
+	}
+	if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+		return fmt.Errorf("failed to save configuration: %v", err)
+	}
+	return nil
+}
+
+// completeVaultTags offers the tags the current vault has
+func completeVaultTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	_, vaultConfig, err := loadCurrentVaultConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var tags []string
+	for _, tag := range vaultConfig.Metadata.Tags {
+		if strings.HasPrefix(tag, toComplete) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultTagCmd)
+	vaultTagCmd.AddCommand(vaultTagAddCmd)
+	vaultTagCmd.AddCommand(vaultTagRemoveCmd)
+	vaultTagCmd.AddCommand(vaultTagListCmd)
+	vaultCmd.AddCommand(vaultMetaCmd)
+	vaultMetaCmd.AddCommand(vaultMetaSetCmd)
+}
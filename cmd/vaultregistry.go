@@ -0,0 +1,166 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// vaultListCmd shows the registered vaults
+var vaultListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the registered vaults",
+	Long: `List the vaults registered in ~/.config/sietch/vaults.yaml, which 'sietch init'
+and 'sietch scaffold' add to. Any command reaches a registered vault from
+anywhere with --vault <name> or SIETCH_VAULT=<name>.
+
+Each vault is checked: ok, missing (nothing at its path), not a vault (no
+vault.yaml), unreadable (vault.yaml cannot be loaded), or moved (another vault
+is at its path). The vault the current directory or --vault selects is marked
+with *. --tag only lists the vaults that have all the given tags.
+
+Example:
+  sietch vault list
+  sietch vault list --tag work
+  sietch --vault photos ls`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, err := config.LoadRegistry()
+		if err != nil {
+			return err
+		}
+		if len(registry.Vaults) == 0 {
+			fmt.Println("No vaults registered. 'sietch init' registers the vaults it creates.")
+			return nil
+		}
+
+		wantTags, _ := cmd.Flags().GetStringSlice("tag")
+		current, _ := fs.FindVaultRoot()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "\tNAME\tPATH\tSTATUS\tTAGS")
+		listed := 0
+		for _, vault := range registry.Vaults {
+			health, vaultConfig := registeredVaultHealth(vault)
+			var tags []string
+			if vaultConfig != nil {
+				tags = vaultConfig.Metadata.Tags
+			}
+			if !config.HasAllTags(tags, wantTags) {
+				continue
+			}
+			marker := ""
+			if current != "" && filepath.Clean(current) == vault.Path {
+				marker = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", marker, vault.Name, vault.Path, health, strings.Join(tags, ","))
+			listed++
+		}
+		if listed == 0 {
+			fmt.Printf("No registered vault is tagged %s\n", strings.Join(wantTags, ", "))
+			return nil
+		}
+		return w.Flush()
+	},
+}
+
+// vaultForgetCmd removes a vault from the registry
+var vaultForgetCmd = &cobra.Command{
+	Use:   "forget <name>",
+	Short: "Remove a vault from the registry, keeping its data",
+	Long: `Remove a vault from ~/.config/sietch/vaults.yaml. The vault and its files are
+left untouched; it can still be used from its directory or by path.
+
+Example:
+  sietch vault forget old-photos`,
+	Args:              cobra.ExactArgs(1),
+	SilenceUsage:      true,
+	ValidArgsFunction: completeRegisteredVaults,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, err := config.LoadRegistry()
+		if err != nil {
+			return err
+		}
+		vault, ok := registry.Lookup(args[0])
+		if !ok {
+			return fmt.Errorf("no vault named %s is registered (see 'sietch vault list')", args[0])
+		}
+		registry.Forget(vault.Name)
+		if err := config.SaveRegistry(registry); err != nil {
+			return fmt.Errorf("failed to save vault registry: %v", err)
+		}
+		fmt.Printf("✓ Forgot vault %s; its data at %s is untouched\n", vault.Name, vault.Path)
+		return nil
+	},
+}
+
+// registeredVaultHealth describes the state of a registered vault's path, and
+// returns its configuration when it could be loaded
+func registeredVaultHealth(vault config.RegisteredVault) (string, *config.VaultConfig) {
+	if _, err := os.Stat(vault.Path); errors.Is(err, os.ErrNotExist) {
+		return "missing", nil
+	}
+	if !fs.IsVaultInitialized(vault.Path) {
+		return "not a vault", nil
+	}
+	vaultConfig, err := config.LoadVaultConfig(vault.Path)
+	if err != nil {
+		return "unreadable", nil
+	}
+	if vault.ID != "" && vaultConfig.VaultID != vault.ID {
+		return "moved", vaultConfig
+	}
+	return "ok", vaultConfig
+}
+
+// registerVault adds a newly created vault to the registry. Failing to is only
+// a warning: the vault works without it.
+func registerVault(vaultConfig *config.VaultConfig, vaultRoot string) {
+	if _, err := config.RegistryPath(); err != nil {
+		return
+	}
+	registry, err := config.LoadRegistry()
+	if err == nil {
+		var name string
+		if name, err = registry.Register(vaultConfig.Name, vaultRoot, vaultConfig.VaultID); err == nil {
+			if err = config.SaveRegistry(registry); err == nil {
+				fmt.Printf("📇 Registered as %s: use it from anywhere with --vault %s\n", name, name)
+				return
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Warning: vault not registered: %v\n", err)
+}
+
+// completeRegisteredVaults offers the names of the registered vaults
+func completeRegisteredVaults(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	registry, err := config.LoadRegistry()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, vault := range registry.Vaults {
+		names = append(names, vault.Name+"\t"+vault.Path)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultListCmd)
+	vaultCmd.AddCommand(vaultForgetCmd)
+	vaultListCmd.Flags().StringSlice("tag", nil, "Only list vaults with this tag (repeatable)")
+}
@@ -0,0 +1,202 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// verifyReportLimit caps the problems listed per section in text output
+const verifyReportLimit = 20
+
+// verifyReport is the output of 'sietch verify'
+type verifyReport struct {
+	Files         int                       `json:"files"`
+	ChunkRefs     int                       `json:"chunk_references"`
+	MissingChunks []verifyMissing           `json:"missing_chunks"`
+	RemoteChunks  int                       `json:"remote_chunks,omitempty"` // Recorded from dedup hints and not fetched yet
+	Index         *deduplication.IndexCheck `json:"index,omitempty"`
+	IndexError    string                    `json:"index_error,omitempty"`
+}
+
+// verifyMissing is a chunk or pack referenced by a manifest but absent from the store
+type verifyMissing struct {
+	File string `json:"file"`
+	Hash string `json:"hash"`
+}
+
+// OK reports whether verification found no problems
+func (r *verifyReport) OK() bool {
+	return len(r.MissingChunks) == 0 && r.IndexError == "" && (r.Index == nil || r.Index.OK())
+}
+
+// verifyCmd checks the vault's chunk store and deduplication index
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that every file's chunks exist and the dedup index is consistent",
+	Long: `Check the vault for missing data and index drift.
+
+Every chunk and pack referenced by a file manifest must be present in the
+store. When deduplication is enabled, the reference counts in the index are
+compared with the references found in the manifests, and every indexed chunk
+must exist on disk. Index problems can be fixed with 'sietch index rebuild'.
+
+Exits with an error when problems are found.
+
+Examples:
+  sietch verify
+  sietch verify -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		report, err := verifyVault(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			displayVerifyReport(report)
+		}
+
+		if !report.OK() {
+			return fmt.Errorf("vault verification found problems")
+		}
+		return nil
+	},
+}
+
+// verifyVault checks chunk presence for every manifest and, with deduplication
+// enabled, the index reference counts
+func verifyVault(vaultRoot string, vaultConfig *config.VaultConfig) (*verifyReport, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+
+	report := &verifyReport{MissingChunks: []verifyMissing{}}
+	err = manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		report.Files++
+		file := entry.Manifest.Destination + entry.Manifest.FilePath
+		if pack := entry.Manifest.Pack; pack != nil {
+			if _, err := os.Stat(layout.PackPath(vaultRoot, pack.ID)); err != nil {
+				report.MissingChunks = append(report.MissingChunks, verifyMissing{File: file, Hash: "pack:" + pack.ID})
+			}
+			return nil
+		}
+		for _, ref := range entry.Manifest.Chunks {
+			if ref.Zero {
+				continue
+			}
+			report.ChunkRefs++
+			key := ref.Hash
+			if ref.EncryptedHash != "" {
+				key = ref.EncryptedHash
+			}
+			if _, exists := layout.LocateChunk(vaultRoot, key); !exists {
+				if ref.Remote {
+					report.RemoteChunks++
+					continue
+				}
+				report.MissingChunks = append(report.MissingChunks, verifyMissing{File: file, Hash: key})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %v", err)
+	}
+
+	if !vaultConfig.Deduplication.Enabled {
+		return report, nil
+	}
+	dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+	if err != nil {
+		report.IndexError = err.Error()
+		return report, nil
+	}
+	report.Index, err = dedupManager.CheckIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check deduplication index: %v", err)
+	}
+	return report, nil
+}
+
+// displayVerifyReport prints a human readable verification report
+func displayVerifyReport(report *verifyReport) {
+	fmt.Printf("Checked %d files (%d chunk references)\n", report.Files, report.ChunkRefs)
+
+	if len(report.MissingChunks) == 0 {
+		fmt.Println("✓ All chunks present")
+	} else {
+		fmt.Printf("✗ %d missing chunks:\n", len(report.MissingChunks))
+		for i, missing := range report.MissingChunks {
+			if i == verifyReportLimit {
+				fmt.Printf("  ... and %d more\n", len(report.MissingChunks)-i)
+				break
+			}
+			fmt.Printf("  %s  %s\n", missing.Hash, missing.File)
+		}
+	}
+	if report.RemoteChunks > 0 {
+		fmt.Printf("- %d remote chunks not fetched yet; run 'sietch sync' to fetch them\n", report.RemoteChunks)
+	}
+
+	switch {
+	case report.IndexError != "":
+		fmt.Printf("✗ Deduplication index unreadable: %s\n", report.IndexError)
+	case report.Index == nil:
+		// Deduplication disabled
+	case report.Index.OK():
+		fmt.Printf("✓ Deduplication index consistent (%d chunks)\n", report.Index.IndexedChunks)
+	default:
+		fmt.Printf("✗ Deduplication index has %d problems:\n", len(report.Index.Problems))
+		for i, problem := range report.Index.Problems {
+			if i == verifyReportLimit {
+				fmt.Printf("  ... and %d more\n", len(report.Index.Problems)-i)
+				break
+			}
+			scope := ""
+			if problem.Scope != "" {
+				scope = " in scope " + problem.Scope
+			}
+			fmt.Printf("  %-13s %s%s (index: %d, manifests: %d)\n",
+				problem.Kind, problem.Hash, scope, problem.IndexRefs, problem.ManifestRefs)
+		}
+		fmt.Println("  Run 'sietch index rebuild' to reconstruct the index from the manifests.")
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
@@ -30,21 +30,13 @@ func Recover(vaultRoot string, retention time.Duration) (*RecoveryResult, error)
 		if !e.IsDir() {
 			continue
 		}
-		dir := filepath.Join(txnRoot, e.Name())
-		jpath := filepath.Join(dir, "journal.json")
-		data, err := os.ReadFile(jpath)
+		j, err := readJournal(vaultRoot, filepath.Join(txnRoot, e.Name()))
 		if err != nil {
-			res.Errors = append(res.Errors, fmt.Errorf("read %s: %w", jpath, err))
+			res.Errors = append(res.Errors, err)
 			continue
 		}
-		var j Journal
-		if err := json.Unmarshal(data, &j); err != nil {
-			res.Errors = append(res.Errors, fmt.Errorf("unmarshal %s: %w", jpath, err))
-			continue
-		}
-		j.dir = dir
-		j.vaultRoot = vaultRoot
-		txn := &Transaction{j: &j}
+		dir := j.dir
+		txn := &Transaction{j: j}
 		switch j.State {
 		case StateCommitted:
 			if retention > 0 && now.Sub(j.StartedAt) > retention {
@@ -76,3 +68,65 @@ func Recover(vaultRoot string, retention time.Duration) (*RecoveryResult, error)
 	}
 	return res, nil
 }
+
+// FinishInterrupted resolves the unfinished transactions begun by one command,
+// matched by the "command" metadata passed to Begin. Unlike Recover, a transaction
+// that was still staging is rolled back rather than committed, so a command that
+// stages its progress together with its changes can resume from the last batch
+// it committed. Transactions that had started committing are completed.
+func FinishInterrupted(vaultRoot, command string) (*RecoveryResult, error) {
+	txnRoot := filepath.Join(vaultRoot, ".txn")
+	res := &RecoveryResult{}
+	entries, err := os.ReadDir(txnRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return res, fmt.Errorf("read txn root: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		j, err := readJournal(vaultRoot, filepath.Join(txnRoot, e.Name()))
+		if err != nil {
+			res.Errors = append(res.Errors, err)
+			continue
+		}
+		if j.Metadata["command"] != command {
+			continue
+		}
+		txn := &Transaction{j: j}
+		switch j.State {
+		case StatePending, StateRollingBack:
+			if err := txn.Rollback(); err != nil {
+				res.Errors = append(res.Errors, fmt.Errorf("rollback %s: %v", j.ID, err))
+			} else {
+				res.RolledBack++
+			}
+		case StateCommitting, StateFailed:
+			if err := txn.Commit(); err != nil {
+				res.Errors = append(res.Errors, fmt.Errorf("resume commit %s: %v", j.ID, err))
+			} else {
+				res.ResumedCommits++
+			}
+		}
+	}
+	return res, nil
+}
+
+// readJournal loads the journal of the transaction in dir
+func readJournal(vaultRoot, dir string) (*Journal, error) {
+	jpath := filepath.Join(dir, "journal.json")
+	data, err := os.ReadFile(jpath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", jpath, err)
+	}
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", jpath, err)
+	}
+	j.dir = dir
+	j.vaultRoot = vaultRoot
+	return &j, nil
+}
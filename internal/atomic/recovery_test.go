@@ -30,3 +30,30 @@ func TestRecoveryPurgesOldCommitted(t *testing.T) {
 		t.Fatalf("txn dir should be removed")
 	}
 }
+
+func TestFinishInterruptedRollsBackStagingTransactions(t *testing.T) {
+	root := t.TempDir()
+	staging, _ := Begin(root, map[string]any{"command": "rechunk"})
+	w, _ := staging.StageCreate("half.txt")
+	w.Write([]byte("half"))
+	w.Close()
+	other, _ := Begin(root, map[string]any{"command": "add"})
+	w, _ = other.StageCreate("other.txt")
+	w.Write([]byte("other"))
+	w.Close()
+
+	res, err := FinishInterrupted(root, "rechunk")
+	if err != nil {
+		t.Fatalf("FinishInterrupted: %v", err)
+	}
+	if res.RolledBack != 1 || res.ResumedCommits != 0 {
+		t.Fatalf("got %+v, want one rollback", res)
+	}
+	if _, err := os.Stat(filepath.Join(root, "half.txt")); !os.IsNotExist(err) {
+		t.Fatalf("staged file of an interrupted transaction was committed")
+	}
+	// Transactions of other commands are left alone
+	if err := other.Commit(); err != nil {
+		t.Fatalf("commit of another command's transaction: %v", err)
+	}
+}
@@ -107,6 +107,11 @@ type createWriter struct {
 
 func (cw *createWriter) Write(b []byte) (int, error) { return cw.multi.Write(b) }
 func (cw *createWriter) Close() error {
+	// Staged content must be durable before commit renames it into place
+	if err := cw.f.Sync(); err != nil {
+		_ = cw.f.Close()
+		return fmt.Errorf("stage create sync: %w", err)
+	}
 	if err := cw.f.Close(); err != nil {
 		return err
 	}
@@ -181,6 +186,10 @@ type replaceWriter struct {
 
 func (rw *replaceWriter) Write(b []byte) (int, error) { return rw.multi.Write(b) }
 func (rw *replaceWriter) Close() error {
+	if err := rw.f.Sync(); err != nil {
+		_ = rw.f.Close()
+		return fmt.Errorf("stage replace sync: %w", err)
+	}
 	if err := rw.f.Close(); err != nil {
 		return err
 	}
@@ -195,6 +204,25 @@ func (rw *replaceWriter) Close() error {
 	return rw.t.j.persistLocked()
 }
 
+// StagedPath returns where the content staged for finalRelPath is written until
+// commit, so it can be read back before the transaction commits.
+func (t *Transaction) StagedPath(finalRelPath string) (string, bool) {
+	t.j.mu.Lock()
+	defer t.j.mu.Unlock()
+	rel := filepath.ToSlash(finalRelPath)
+	for i := len(t.j.Entries) - 1; i >= 0; i-- {
+		e := t.j.Entries[i]
+		if e.FinalPath != rel {
+			continue
+		}
+		if e.Type == EntryDelete {
+			return "", false
+		}
+		return e.StagedPath, true
+	}
+	return "", false
+}
+
 func (t *Transaction) Commit() error {
 	t.j.mu.Lock()
 	if t.j.State != StatePending {
@@ -208,6 +236,7 @@ func (t *Transaction) Commit() error {
 	}
 	entries := append([]JournalEntry(nil), t.j.Entries...)
 	t.j.mu.Unlock()
+	promotedDirs := make(map[string]bool)
 	for _, e := range entries {
 		if e.Type == EntryCreate || e.Type == EntryReplace {
 			if e.StagedPath == "" {
@@ -220,6 +249,13 @@ func (t *Transaction) Commit() error {
 			if err := os.Rename(e.StagedPath, finalAbs); err != nil {
 				return t.fail(fmt.Errorf("commit promote %s: %w", e.FinalPath, err))
 			}
+			promotedDirs[filepath.Dir(finalAbs)] = true
+		}
+	}
+	// The renames are only durable once their directories are synced
+	for dir := range promotedDirs {
+		if err := SyncDir(dir); err != nil {
+			return t.fail(fmt.Errorf("commit sync: %w", err))
 		}
 	}
 	for _, e := range entries {
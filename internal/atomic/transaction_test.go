@@ -215,3 +215,36 @@ func TestRecoveryResumesCommit(t *testing.T) {
 		t.Fatalf("expected resume or rollback action")
 	}
 }
+
+func TestStagedPath(t *testing.T) {
+	root := t.TempDir()
+	txn, err := Begin(root, map[string]any{"test": "staged"})
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, ok := txn.StagedPath("data/file.txt"); ok {
+		t.Fatal("nothing staged yet")
+	}
+	w, err := txn.StageCreate("data/file.txt")
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	_, _ = w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	staged, ok := txn.StagedPath("data/file.txt")
+	if !ok {
+		t.Fatal("expected a staged path")
+	}
+	if data, err := os.ReadFile(staged); err != nil || string(data) != "hello" {
+		t.Errorf("staged content = %q, %v", data, err)
+	}
+	if err := txn.StageDelete("data/file.txt"); err != nil {
+		t.Fatalf("stage delete: %v", err)
+	}
+	if _, ok := txn.StagedPath("data/file.txt"); ok {
+		t.Error("a file staged for deletion has no staged content")
+	}
+	_ = txn.Rollback()
+}
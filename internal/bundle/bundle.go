@@ -0,0 +1,354 @@
+// Package bundle carries vault data between vaults that never share a
+// network. A bundle holds the chunks, packs, compression dictionaries and file
+// manifests a peer is missing, encrypted to the peer's sync key and signed
+// with the sender's, in one file or in parts of a maximum size.
+//
+// A bundle is a sequence of frames, each a type byte, a big-endian uint32
+// length and the payload, after a magic line:
+//
+//	H  header (JSON): sender and recipient fingerprints, the record key
+//	   encrypted to the recipient with RSA-OAEP
+//	R  record, sealed with AES-256-GCM under the record key; the nonce is the
+//	   record's sequence number, so records cannot be reordered or dropped
+//	S  signature of the SHA-256 of every byte before the frame
+//
+// Records are written dictionaries first and manifests last, so a bundle
+// whose apply is interrupted never leaves a manifest pointing at a chunk that
+// was not stored; applying it again picks up where it stopped.
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+)
+
+const magic = "SIETCHBUNDLE 1\n"
+
+// Version is the bundle format version written in headers
+const Version = 1
+
+const (
+	frameHeader    = 'H'
+	frameRecord    = 'R'
+	frameSignature = 'S'
+
+	// maxFrame bounds the frames a reader accepts, well above any chunk
+	maxFrame = 1 << 30
+)
+
+// keyLabel binds wrapped record keys to bundles
+var keyLabel = []byte("sietch bundle")
+
+// Record kinds
+const (
+	KindDictionary = 'd' // Compression dictionary, Name is its ID
+	KindChunk      = 'c' // Chunk, Name is the file it is stored as
+	KindPack       = 'p' // Small-file pack, Name is its ID
+	KindManifest   = 'm' // File manifest (YAML), Name is the file path
+)
+
+// ErrNotRSA is returned when a bundle is addressed to a peer whose sync key
+// cannot encrypt
+var ErrNotRSA = errors.New("bundles can only be encrypted to RSA sync keys")
+
+// Header describes a bundle
+type Header struct {
+	Version   int       `json:"version"`
+	VaultID   string    `json:"vault_id"`
+	VaultName string    `json:"vault_name,omitempty"`
+	From      string    `json:"from"` // Fingerprint of the sender's sync key
+	To        string    `json:"to"`   // Fingerprint of the recipient's sync key
+	Created   time.Time `json:"created"`
+	Key       []byte    `json:"key"` // Record key, encrypted to the recipient
+}
+
+// Record is one item of a bundle
+type Record struct {
+	Kind byte
+	Name string
+	Hash string // Chunk hash for chunks, file identity for manifests
+	Data []byte
+}
+
+// Writer writes a bundle
+type Writer struct {
+	w      io.Writer
+	digest hash.Hash
+	aead   cipher.AEAD
+	seq    uint64
+	signer crypto.Signer
+}
+
+// NewWriter starts a bundle on w, addressed to recipient and signed by signer
+// when closed. header.Key is set by NewWriter.
+func NewWriter(w io.Writer, header Header, recipient crypto.PublicKey, signer crypto.Signer) (*Writer, error) {
+	rsaKey, ok := recipient.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrNotRSA
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate record key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header.Version = Version
+	header.Key, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaKey, key, keyLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt record key: %w", err)
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	bw := &Writer{digest: sha256.New(), aead: aead, signer: signer}
+	bw.w = io.MultiWriter(w, bw.digest)
+	if _, err := io.WriteString(bw.w, magic); err != nil {
+		return nil, err
+	}
+	if err := bw.writeFrame(frameHeader, headerJSON); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// Add appends a record to the bundle
+func (bw *Writer) Add(r Record) error {
+	if len(r.Name) > 0xffff || len(r.Hash) > 0xffff {
+		return fmt.Errorf("record name too long")
+	}
+	plain := make([]byte, 0, 5+len(r.Name)+len(r.Hash)+len(r.Data))
+	plain = append(plain, r.Kind)
+	plain = binary.BigEndian.AppendUint16(plain, uint16(len(r.Name)))
+	plain = append(plain, r.Name...)
+	plain = binary.BigEndian.AppendUint16(plain, uint16(len(r.Hash)))
+	plain = append(plain, r.Hash...)
+	plain = append(plain, r.Data...)
+
+	sealed := bw.aead.Seal(nil, nonce(bw.seq), plain, nil)
+	bw.seq++
+	return bw.writeFrame(frameRecord, sealed)
+}
+
+// Close signs the bundle. It does not close the underlying writer.
+func (bw *Writer) Close() error {
+	signature, err := keys.SignChallenge(bw.signer, bw.digest.Sum(nil))
+	if err != nil {
+		return fmt.Errorf("failed to sign bundle: %w", err)
+	}
+	return bw.writeFrame(frameSignature, signature)
+}
+
+func (bw *Writer) writeFrame(kind byte, payload []byte) error {
+	var prefix [5]byte
+	prefix[0] = kind
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(payload)))
+	if _, err := bw.w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := bw.w.Write(payload)
+	return err
+}
+
+// reader reads the frames of a bundle
+type reader struct {
+	r *bufio.Reader
+}
+
+// newReader reads the magic line and header of a bundle
+func newReader(r io.Reader) (*reader, *Header, error) {
+	br := &reader{r: bufio.NewReader(r)}
+	got := make([]byte, len(magic))
+	if _, err := io.ReadFull(br.r, got); err != nil || string(got) != magic {
+		return nil, nil, fmt.Errorf("not a sietch bundle")
+	}
+	kind, payload, err := br.next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if kind != frameHeader {
+		return nil, nil, fmt.Errorf("bundle has no header")
+	}
+	var header Header
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle header: %w", err)
+	}
+	if header.Version != Version {
+		return nil, nil, fmt.Errorf("unsupported bundle version %d", header.Version)
+	}
+	return br, &header, nil
+}
+
+// next reads a frame
+func (br *reader) next() (byte, []byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(br.r, prefix[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, nil, fmt.Errorf("bundle is incomplete: %w", io.ErrUnexpectedEOF)
+		}
+		return 0, nil, fmt.Errorf("bundle is incomplete: %w", err)
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxFrame {
+		return 0, nil, fmt.Errorf("bundle frame of %d bytes is too large", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("bundle is incomplete: %w", io.ErrUnexpectedEOF)
+	}
+	return prefix[0], payload, nil
+}
+
+// ReadHeader reads the header of the bundle in r
+func ReadHeader(r io.Reader) (*Header, error) {
+	_, header, err := newReader(r)
+	return header, err
+}
+
+// Verify checks the signature of the bundle in r against the sender's key
+func Verify(r io.Reader, sender crypto.PublicKey) error {
+	// Hash frame by frame, so the digest stops right before the signature
+	digest := sha256.New()
+	br := bufio.NewReader(r)
+	got := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, got); err != nil || string(got) != magic {
+		return fmt.Errorf("not a sietch bundle")
+	}
+	digest.Write(got)
+	for {
+		var prefix [5]byte
+		if _, err := io.ReadFull(br, prefix[:]); err != nil {
+			return fmt.Errorf("bundle is incomplete: it has no signature")
+		}
+		length := binary.BigEndian.Uint32(prefix[1:])
+		if length > maxFrame {
+			return fmt.Errorf("bundle frame of %d bytes is too large", length)
+		}
+		if prefix[0] == frameSignature {
+			signature := make([]byte, length)
+			if _, err := io.ReadFull(br, signature); err != nil {
+				return fmt.Errorf("bundle is incomplete: %w", io.ErrUnexpectedEOF)
+			}
+			if _, err := br.ReadByte(); err != io.EOF {
+				return fmt.Errorf("bundle has data after its signature")
+			}
+			if err := keys.VerifyChallenge(sender, digest.Sum(nil), signature); err != nil {
+				return fmt.Errorf("bundle signature does not match the sender's key: %w", err)
+			}
+			return nil
+		}
+		digest.Write(prefix[:])
+		if n, err := io.CopyN(digest, br, int64(length)); err != nil || n != int64(length) {
+			return fmt.Errorf("bundle is incomplete: %w", io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// Read decrypts the records of the bundle in r with the recipient's private
+// key and passes them to fn in order. It does not check the signature; Verify
+// the bundle first.
+func Read(r io.Reader, recipient crypto.Signer, fn func(Record) error) error {
+	br, header, err := newReader(r)
+	if err != nil {
+		return err
+	}
+	rsaKey, ok := recipient.(*rsa.PrivateKey)
+	if !ok {
+		return ErrNotRSA
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, rsaKey, header.Key, keyLabel)
+	if err != nil {
+		return fmt.Errorf("bundle was not encrypted to this vault's sync key")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	for seq := uint64(0); ; seq++ {
+		kind, payload, err := br.next()
+		if err != nil {
+			return err
+		}
+		if kind == frameSignature {
+			return nil
+		}
+		if kind != frameRecord {
+			return fmt.Errorf("unexpected bundle frame %q", kind)
+		}
+		plain, err := aead.Open(nil, nonce(seq), payload, nil)
+		if err != nil {
+			return fmt.Errorf("bundle record %d is damaged", seq)
+		}
+		record, err := parseRecord(plain)
+		if err != nil {
+			return fmt.Errorf("bundle record %d: %w", seq, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+func parseRecord(plain []byte) (Record, error) {
+	var r Record
+	buf := bytes.NewReader(plain)
+	kind, err := buf.ReadByte()
+	if err != nil {
+		return r, fmt.Errorf("empty record")
+	}
+	r.Kind = kind
+	if r.Name, err = readString(buf); err != nil {
+		return r, err
+	}
+	if r.Hash, err = readString(buf); err != nil {
+		return r, err
+	}
+	r.Data = plain[len(plain)-buf.Len():]
+	return r, nil
+}
+
+func readString(buf *bytes.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(buf, binary.BigEndian, &length); err != nil {
+		return "", fmt.Errorf("truncated record")
+	}
+	s := make([]byte, length)
+	if _, err := io.ReadFull(buf, s); err != nil {
+		return "", fmt.Errorf("truncated record")
+	}
+	return string(s), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the GCM nonce of the record with sequence number seq
+func nonce(seq uint64) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[4:], seq)
+	return n
+}
@@ -0,0 +1,274 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+func testKeys(t *testing.T) (sender, recipient *rsa.PrivateKey) {
+	t.Helper()
+	sender, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender, recipient
+}
+
+func writeBundle(t *testing.T, w io.Writer, sender, recipient *rsa.PrivateKey, records []Record) {
+	t.Helper()
+	bw, err := NewWriter(w, Header{VaultID: "vault-a", From: "fp-a", To: "fp-b"}, &recipient.PublicKey, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := bw.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBundleRoundTrip ensures records survive a bundle and tampering is caught
+func TestBundleRoundTrip(t *testing.T) {
+	sender, recipient := testKeys(t)
+	records := []Record{
+		{Kind: KindChunk, Name: "abc123", Hash: "abc123", Data: bytes.Repeat([]byte("spice "), 1000)},
+		{Kind: KindManifest, Name: "notes.txt", Hash: "notes.txt", Data: []byte("file: notes.txt\n")},
+	}
+	var buf bytes.Buffer
+	writeBundle(t, &buf, sender, recipient, records)
+
+	header, err := ReadHeader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.From != "fp-a" || header.To != "fp-b" || header.Version != Version {
+		t.Errorf("ReadHeader() = %+v", header)
+	}
+	if err := Verify(bytes.NewReader(buf.Bytes()), &sender.PublicKey); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	var got []Record
+	err = Read(bytes.NewReader(buf.Bytes()), recipient, func(r Record) error {
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Read() = %v", err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("Read() returned %d records, want %d", len(got), len(records))
+	}
+	for i := range records {
+		if got[i].Kind != records[i].Kind || got[i].Name != records[i].Name || got[i].Hash != records[i].Hash || !bytes.Equal(got[i].Data, records[i].Data) {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], records[i])
+		}
+	}
+
+	tests := []struct {
+		name  string
+		check func() error
+	}{
+		{"signed by another key", func() error { return Verify(bytes.NewReader(buf.Bytes()), &recipient.PublicKey) }},
+		{"tampered", func() error {
+			tampered := bytes.Clone(buf.Bytes())
+			tampered[len(tampered)/2] ^= 1
+			return Verify(bytes.NewReader(tampered), &sender.PublicKey)
+		}},
+		{"truncated", func() error { return Verify(bytes.NewReader(buf.Bytes()[:buf.Len()-10]), &sender.PublicKey) }},
+		{"other recipient", func() error {
+			return Read(bytes.NewReader(buf.Bytes()), sender, func(Record) error { return nil })
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check(); err == nil {
+				t.Error("bundle was accepted")
+			}
+		})
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := NewWriter(io.Discard, Header{}, edKey.Public(), sender); !errors.Is(err, ErrNotRSA) {
+		t.Errorf("NewWriter() to an Ed25519 key = %v, want ErrNotRSA", err)
+	}
+}
+
+// TestBundleParts ensures a bundle split into parts reads back whole
+func TestBundleParts(t *testing.T) {
+	sender, recipient := testKeys(t)
+	path := filepath.Join(t.TempDir(), "delta.sietchbundle")
+	data := make([]byte, 10000)
+	_, _ = rand.Read(data)
+
+	pw, err := CreateParts(path, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeBundle(t, pw, sender, recipient, []Record{{Kind: KindChunk, Name: "c1", Hash: "c1", Data: data}})
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	parts := len(pw.Paths())
+	if parts < 3 {
+		t.Fatalf("bundle written to %d parts, want at least 3", parts)
+	}
+	for _, part := range pw.Paths() {
+		if info, err := os.Stat(part); err != nil || info.Size() > 4096 {
+			t.Errorf("part %s: %v", part, err)
+		}
+	}
+
+	for _, open := range []string{path, path + ".001"} {
+		r, paths, err := OpenParts(open)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != parts {
+			t.Errorf("OpenParts(%s) found %d parts", open, len(paths))
+		}
+		if err := Verify(r, &sender.PublicKey); err != nil {
+			t.Errorf("Verify(%s) = %v", open, err)
+		}
+		r.Close()
+	}
+
+	// A later bundle that fits in one part replaces the parts
+	pw, err = CreateParts(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeBundle(t, pw, sender, recipient, nil)
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if paths := pw.Paths(); len(paths) != 1 || paths[0] != path {
+		t.Errorf("single part written to %v, want %s", paths, path)
+	}
+	if _, err := os.Stat(path + ".002"); !os.IsNotExist(err) {
+		t.Errorf("old part left behind: %v", err)
+	}
+}
+
+// TestNewPlan ensures a plan holds only what the have-list lacks
+func TestNewPlan(t *testing.T) {
+	m := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "a.txt", Chunks: []config.ChunkRef{{Hash: "h1"}, {Hash: "h2", CompressionDict: "d1"}}},
+		{FilePath: "b.txt", Chunks: []config.ChunkRef{{Hash: "h2", CompressionDict: "d1"}, {Hash: "zero", Zero: true}}},
+		{FilePath: "small.txt", Pack: &config.PackRef{ID: "p1"}},
+	}}
+
+	full := NewPlan(m, &HaveList{})
+	if len(full.Files) != 3 || len(full.Chunks) != 2 || len(full.Packs) != 1 || len(full.Dicts) != 1 {
+		t.Errorf("NewPlan() for an empty vault = %+v", full)
+	}
+
+	have := HaveListOf(m, "vault-b", "fp-b")
+	if plan := NewPlan(m, have); !plan.Empty() {
+		t.Errorf("NewPlan() for a vault holding everything = %+v", plan)
+	}
+
+	partial := &HaveList{Files: []string{"a.txt"}, Chunks: []string{"h1", "h2"}, Dicts: []string{"d1"}}
+	plan := NewPlan(m, partial)
+	if len(plan.Files) != 2 || len(plan.Chunks) != 0 || len(plan.Packs) != 1 || len(plan.Dicts) != 0 {
+		t.Errorf("NewPlan() = %+v", plan)
+	}
+	partial.Merge(plan.Sent())
+	if plan := NewPlan(m, partial); !plan.Empty() {
+		t.Errorf("NewPlan() after merging what was sent = %+v", plan)
+	}
+}
+
+// TestApplierFinish ensures a newer version of a file the vault holds is
+// applied without asking, as a sync with the sender would decide
+func TestApplierFinish(t *testing.T) {
+	vaultRoot := t.TempDir()
+	sender, err := peer.Decode("QmeHKH5BBMUCHkwLwhSrUQSCZSzQcT8trHpgtKA1dvUCHn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := func(content, modTime string) config.FileManifest {
+		return config.FileManifest{FilePath: "notes.txt", Destination: "docs/", Size: int64(len(content)), ContentHash: content, ModTime: modTime}
+	}
+	local := version("local edit", "2026-01-02T00:00:00Z")
+	if err := manifest.ReplaceFileManifest(vaultRoot, local.FilePath, &local); err != nil {
+		t.Fatal(err)
+	}
+	stored := func() string {
+		t.Helper()
+		mgr, _ := config.NewManager(vaultRoot)
+		m, err := mgr.GetManifest()
+		if err != nil || len(m.Files) != 1 {
+			t.Fatalf("GetManifest() = %v, %v; want one file", m, err)
+		}
+		return m.Files[0].ContentHash
+	}
+	apply := func(file config.FileManifest, strategy string) (*Applier, error) {
+		t.Helper()
+		a, err := NewApplier(vaultRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := yaml.Marshal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Record(Record{Kind: KindManifest, Name: file.FilePath, Hash: file.Identity(), Data: data}); err != nil {
+			t.Fatal(err)
+		}
+		return a, a.Finish(sender, "laptop", strategy)
+	}
+
+	// Never exchanged before, so both sides changed it
+	_, err = apply(version("peer edit", "2026-01-03T00:00:00Z"), constants.ConflictManual)
+	var conflictErr *p2p.ConflictError
+	if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 1 {
+		t.Fatalf("Finish() = %v, want a conflict", err)
+	}
+	if got := stored(); got != "local edit" {
+		t.Errorf("after a conflict the vault holds %q, want the local version", got)
+	}
+
+	a, err := apply(version("peer edit", "2026-01-03T00:00:00Z"), constants.ConflictNewest)
+	if err != nil {
+		t.Fatalf("Finish() with newest: %v", err)
+	}
+	if got := stored(); got != "peer edit" || a.Updated != 1 {
+		t.Errorf("with newest the vault holds %q, %d updated; want the peer's version", got, a.Updated)
+	}
+
+	// Changed only by the peer since, so taken without a strategy
+	if a, err = apply(version("peer edit 2", "2026-01-04T00:00:00Z"), constants.ConflictManual); err != nil {
+		t.Fatalf("Finish() = %v", err)
+	}
+	if got := stored(); got != "peer edit 2" || a.Updated != 1 {
+		t.Errorf("the vault holds %q, %d updated; want the peer's new version", got, a.Updated)
+	}
+
+	// Applying the same bundle again changes nothing
+	if a, err = apply(version("peer edit 2", "2026-01-04T00:00:00Z"), constants.ConflictManual); err != nil || a.Updated != 0 || a.Skipped != 1 {
+		t.Errorf("applying again: %v, %d updated, %d skipped; want it skipped", err, a.Updated, a.Skipped)
+	}
+}
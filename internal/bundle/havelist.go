@@ -0,0 +1,96 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// HaveList records what a vault holds, so a bundle for it carries only what
+// it is missing. Applying a bundle writes one to carry back to the sender.
+type HaveList struct {
+	VaultID     string    `json:"vault_id"`
+	Fingerprint string    `json:"fingerprint,omitempty"` // Fingerprint of the vault's sync key
+	Created     time.Time `json:"created"`
+	Files       []string  `json:"files"`  // File identities
+	Chunks      []string  `json:"chunks"` // Chunk hashes
+	Packs       []string  `json:"packs,omitempty"`
+	Dicts       []string  `json:"dicts,omitempty"`
+}
+
+// HaveListOf returns the have-list of a vault's manifest
+func HaveListOf(m *config.Manifest, vaultID, fingerprint string) *HaveList {
+	have := &HaveList{VaultID: vaultID, Fingerprint: fingerprint, Created: time.Now().UTC()}
+	for _, file := range m.Files {
+		have.Files = append(have.Files, file.Identity())
+		if file.Pack != nil {
+			have.Packs = append(have.Packs, file.Pack.ID)
+		}
+		for _, chunk := range file.Chunks {
+			if chunk.Zero || chunk.Remote {
+				continue
+			}
+			have.Chunks = append(have.Chunks, chunk.Hash)
+			if chunk.CompressionDict != "" {
+				have.Dicts = append(have.Dicts, chunk.CompressionDict)
+			}
+		}
+	}
+	have.compact()
+	return have
+}
+
+// Merge adds what other holds to the have-list
+func (h *HaveList) Merge(other *HaveList) {
+	h.Files = append(h.Files, other.Files...)
+	h.Chunks = append(h.Chunks, other.Chunks...)
+	h.Packs = append(h.Packs, other.Packs...)
+	h.Dicts = append(h.Dicts, other.Dicts...)
+	h.compact()
+}
+
+// compact sorts the lists and drops duplicates
+func (h *HaveList) compact() {
+	for _, list := range []*[]string{&h.Files, &h.Chunks, &h.Packs, &h.Dicts} {
+		slices.Sort(*list)
+		*list = slices.Compact(*list)
+	}
+}
+
+// LoadHaveList reads a have-list file
+func LoadHaveList(path string) (*HaveList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var have HaveList
+	if err := json.Unmarshal(data, &have); err != nil {
+		return nil, fmt.Errorf("invalid have-list %s: %w", path, err)
+	}
+	return &have, nil
+}
+
+// Save writes the have-list to path
+func (h *HaveList) Save(path string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), constants.StandardDirPerms); err != nil {
+		return err
+	}
+	return atomic.WriteFile(path, append(data, '\n'), constants.StandardFilePerms)
+}
+
+// PeerStatePath returns where the vault keeps what it knows a peer holds,
+// from its last have-list and the bundles created for it since
+func PeerStatePath(vaultRoot, peerID string) string {
+	return filepath.Join(vaultRoot, ".sietch", "bundles", peerID+".have")
+}
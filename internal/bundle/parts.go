@@ -0,0 +1,177 @@
+package bundle
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A bundle split with a maximum part size is written as <path>.001,
+// <path>.002 and so on; a bundle that fits in one part is renamed to <path>.
+
+// PartWriter writes a bundle to one file, or to parts of at most a maximum
+// size
+type PartWriter struct {
+	path    string
+	maxSize int64
+	file    *os.File
+	written int64
+	paths   []string
+}
+
+// CreateParts creates the bundle file at path. With maxSize above zero the
+// bundle is split into parts of at most maxSize bytes.
+func CreateParts(path string, maxSize int64) (*PartWriter, error) {
+	// Parts left by an earlier bundle at path would be read as part of this one
+	if err := removeParts(path); err != nil {
+		return nil, err
+	}
+	pw := &PartWriter{path: path, maxSize: maxSize}
+	if err := pw.nextPart(); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *PartWriter) nextPart() error {
+	if pw.file != nil {
+		if err := pw.file.Close(); err != nil {
+			return err
+		}
+	}
+	path := pw.path
+	if pw.maxSize > 0 {
+		path = partPath(pw.path, len(pw.paths)+1)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	pw.file, pw.written = file, 0
+	pw.paths = append(pw.paths, path)
+	return nil
+}
+
+// Write writes p, starting new parts as the current one fills
+func (pw *PartWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if pw.maxSize > 0 && pw.written == pw.maxSize {
+			if err := pw.nextPart(); err != nil {
+				return total, err
+			}
+		}
+		n := len(p)
+		if pw.maxSize > 0 {
+			n = int(min(int64(n), pw.maxSize-pw.written))
+		}
+		n, err := pw.file.Write(p[:n])
+		total += n
+		pw.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close syncs and closes the last part
+func (pw *PartWriter) Close() error {
+	if err := pw.file.Sync(); err != nil {
+		pw.file.Close()
+		return err
+	}
+	if err := pw.file.Close(); err != nil {
+		return err
+	}
+	if len(pw.paths) == 1 && pw.paths[0] != pw.path {
+		if err := os.Rename(pw.paths[0], pw.path); err != nil {
+			return err
+		}
+		pw.paths[0] = pw.path
+	} else if len(pw.paths) > 1 {
+		// A bundle once written unsplit to path is superseded
+		_ = os.Remove(pw.path)
+	}
+	return nil
+}
+
+// Abort closes and removes the parts written
+func (pw *PartWriter) Abort() {
+	pw.file.Close()
+	for _, path := range pw.paths {
+		os.Remove(path)
+	}
+}
+
+// Paths returns the files the bundle was written to
+func (pw *PartWriter) Paths() []string {
+	return pw.paths
+}
+
+// OpenParts opens the bundle at path, which may name the bundle itself, its
+// first part or the path its parts were split from
+func OpenParts(path string) (io.ReadCloser, []string, error) {
+	base := strings.TrimSuffix(path, ".001")
+	if _, err := os.Stat(partPath(base, 1)); err != nil {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, []string{path}, nil
+	}
+
+	var (
+		paths   []string
+		readers []io.Reader
+		files   multiCloser
+	)
+	for i := 1; ; i++ {
+		file, err := os.Open(partPath(base, i))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			files.Close()
+			return nil, nil, err
+		}
+		paths = append(paths, file.Name())
+		readers = append(readers, file)
+		files = append(files, file)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(readers...), files}, paths, nil
+}
+
+// removeParts removes the parts of a bundle split from path
+func removeParts(path string) error {
+	for i := 1; ; i++ {
+		err := os.Remove(partPath(path, i))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove old bundle part: %w", err)
+		}
+	}
+}
+
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, c := range m {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func partPath(path string, n int) string {
+	return fmt.Sprintf("%s.%03d", path, n)
+}
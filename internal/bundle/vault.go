@@ -0,0 +1,248 @@
+package bundle
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+// Plan is what of a vault a peer is missing
+type Plan struct {
+	Files  []config.FileManifest
+	Chunks []config.ChunkRef
+	Packs  []string
+	Dicts  []string
+}
+
+// NewPlan lists what of m a peer holding have is missing
+func NewPlan(m *config.Manifest, have *HaveList) *Plan {
+	plan := &Plan{}
+	files := setOf(have.Files)
+	chunks := setOf(have.Chunks)
+	packs := setOf(have.Packs)
+	dicts := setOf(have.Dicts)
+	for _, file := range m.Files {
+		if file.Pack != nil && !packs[file.Pack.ID] {
+			packs[file.Pack.ID] = true
+			plan.Packs = append(plan.Packs, file.Pack.ID)
+		}
+		for _, chunk := range file.Chunks {
+			if chunk.Zero || chunk.Remote {
+				continue
+			}
+			if dict := chunk.CompressionDict; dict != "" && !dicts[dict] {
+				dicts[dict] = true
+				plan.Dicts = append(plan.Dicts, dict)
+			}
+			if !chunks[chunk.Hash] {
+				chunks[chunk.Hash] = true
+				plan.Chunks = append(plan.Chunks, chunk)
+			}
+		}
+		if !files[file.Identity()] {
+			plan.Files = append(plan.Files, file)
+		}
+	}
+	return plan
+}
+
+func setOf(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+// Empty reports whether the peer is missing nothing
+func (p *Plan) Empty() bool {
+	return len(p.Files) == 0 && len(p.Chunks) == 0 && len(p.Packs) == 0 && len(p.Dicts) == 0
+}
+
+// Sent returns what the peer holds once it applied a bundle of the plan
+func (p *Plan) Sent() *HaveList {
+	sent := &HaveList{Packs: slices.Clone(p.Packs), Dicts: slices.Clone(p.Dicts)}
+	for _, file := range p.Files {
+		sent.Files = append(sent.Files, file.Identity())
+	}
+	for _, chunk := range p.Chunks {
+		sent.Chunks = append(sent.Chunks, chunk.Hash)
+	}
+	return sent
+}
+
+// Write adds the records of the plan, read from the vault at vaultRoot, to
+// the bundle. It returns the bytes of vault data written.
+func (p *Plan) Write(vaultRoot string, bw *Writer) (int64, error) {
+	var total int64
+	add := func(kind byte, name, hash string, loc layout.ChunkLocation) error {
+		data, err := loc.Read()
+		if err != nil {
+			return err
+		}
+		total += int64(len(data))
+		return bw.Add(Record{Kind: kind, Name: name, Hash: hash, Data: data})
+	}
+
+	for _, id := range p.Dicts {
+		if err := add(KindDictionary, id, "", layout.ChunkLocation{Path: layout.DictionaryPath(vaultRoot, id)}); err != nil {
+			return total, fmt.Errorf("failed to read compression dictionary %s: %w", id, err)
+		}
+	}
+	for _, chunk := range p.Chunks {
+		// Chunks of encrypted vaults are stored under their encrypted hash
+		name := chunk.Hash
+		loc, ok := layout.LocateChunk(vaultRoot, name)
+		if !ok && chunk.EncryptedHash != "" {
+			name = chunk.EncryptedHash
+			loc, ok = layout.LocateChunk(vaultRoot, name)
+		}
+		if !ok {
+			return total, fmt.Errorf("chunk %s is missing from the vault", chunk.Hash)
+		}
+		if err := add(KindChunk, name, chunk.Hash, loc); err != nil {
+			return total, fmt.Errorf("failed to read chunk %s: %w", chunk.Hash, err)
+		}
+	}
+	for _, id := range p.Packs {
+		if err := add(KindPack, id, "", layout.ChunkLocation{Path: layout.PackPath(vaultRoot, id)}); err != nil {
+			return total, fmt.Errorf("failed to read pack %s: %w", id, err)
+		}
+	}
+	for _, file := range p.Files {
+		data, err := yaml.Marshal(file)
+		if err != nil {
+			return total, fmt.Errorf("failed to encode manifest for %s: %w", file.FilePath, err)
+		}
+		if err := bw.Add(Record{Kind: KindManifest, Name: file.FilePath, Hash: file.Identity(), Data: data}); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Result is what applying a bundle stored
+type Result struct {
+	Files         int // Files added, including the peer's versions stored beside local ones
+	Updated       int // Files whose local version the peer's replaced
+	Chunks        int
+	Packs         int
+	Dicts         int
+	Skipped       int // Records the vault already held, from an earlier apply, or files it keeps its own version of
+	BytesImported int64
+	Conflicts     []p2p.Conflict // Files both vaults changed since they last exchanged them, as resolved
+}
+
+// Applier stores the records of a bundle in a vault, skipping what the vault
+// already holds. Its Record is meant as the fn of Read; Finish then stores
+// the bundle's files, once all their data is in the vault.
+type Applier struct {
+	Result
+	vaultRoot string
+	mgr       *config.Manager
+	files     []config.FileManifest
+}
+
+// NewApplier returns an Applier storing bundle records in the vault at vaultRoot
+func NewApplier(vaultRoot string) (*Applier, error) {
+	mgr, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	return &Applier{vaultRoot: vaultRoot, mgr: mgr}, nil
+}
+
+// Record stores a bundle record, or keeps a file manifest for Finish
+func (a *Applier) Record(r Record) error {
+	var exists bool
+	var err error
+	switch r.Kind {
+	case KindDictionary:
+		exists = a.mgr.DictionaryExists(r.Name)
+	case KindChunk:
+		if exists, err = a.mgr.ChunkExists(r.Name); err != nil {
+			return err
+		}
+	case KindPack:
+		exists = a.mgr.PackExists(r.Name)
+	case KindManifest:
+		var file config.FileManifest
+		if err := yaml.Unmarshal(r.Data, &file); err != nil {
+			return fmt.Errorf("invalid manifest for %s in bundle: %w", r.Name, err)
+		}
+		a.files = append(a.files, file)
+		return nil
+	default:
+		return fmt.Errorf("unknown bundle record kind %q", r.Kind)
+	}
+	if exists {
+		a.Skipped++
+		return nil
+	}
+
+	switch r.Kind {
+	case KindDictionary:
+		if err := a.mgr.StoreDictionary(r.Name, r.Data); err != nil {
+			return fmt.Errorf("failed to store compression dictionary %s: %w", r.Name, err)
+		}
+		a.Dicts++
+	case KindChunk:
+		if !validName(r.Name) {
+			return fmt.Errorf("bundle holds a chunk with an invalid name %q", r.Name)
+		}
+		if err := a.mgr.StoreChunk(r.Name, r.Data); err != nil {
+			return fmt.Errorf("failed to store chunk %s: %w", r.Hash, err)
+		}
+		a.Chunks++
+	case KindPack:
+		if !validName(r.Name) {
+			return fmt.Errorf("bundle holds a pack with an invalid name %q", r.Name)
+		}
+		if err := a.mgr.StorePack(r.Name, r.Data); err != nil {
+			return fmt.Errorf("failed to store pack %s: %w", r.Name, err)
+		}
+		a.Packs++
+	}
+	a.BytesImported += int64(len(r.Data))
+	return nil
+}
+
+// Finish stores the files of the bundle, which the peer peerID sent. A file
+// the vault holds another version of is replaced or kept as a sync with the
+// peer would decide, with strategy resolving files both changed; conflicts
+// left to the user are recorded and returned in a *p2p.ConflictError, and
+// then no file is stored.
+func (a *Applier) Finish(peerID peer.ID, peerName, strategy string) error {
+	local, err := a.mgr.GetManifest()
+	if err != nil {
+		return fmt.Errorf("failed to load vault manifest: %w", err)
+	}
+	merge, err := p2p.MergePeerFiles(a.vaultRoot, peerID, peerName, strategy, local, a.files)
+	if err != nil {
+		return err
+	}
+	for _, file := range slices.Concat(merge.Add, merge.Copies, merge.Update) {
+		if err := manifest.ReplaceFileManifest(a.vaultRoot, file.FilePath, &file); err != nil {
+			return fmt.Errorf("failed to save manifest for %s: %w", file.FilePath, err)
+		}
+	}
+	a.Files += len(merge.Add) + len(merge.Copies)
+	a.Updated += len(merge.Update)
+	a.Skipped += len(a.files) - len(merge.Add) - len(merge.Copies) - len(merge.Update)
+	a.Conflicts = merge.Conflicts
+	return merge.Stored()
+}
+
+// validName reports whether a chunk or pack name from a bundle is a plain
+// file name
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
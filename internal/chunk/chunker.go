@@ -0,0 +1,102 @@
+package chunk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Chunk is a single piece of a stream produced by a Chunker
+type Chunk struct {
+	Index  int    // 0-based position of the chunk in the stream
+	Offset int64  // Byte offset of the chunk in the stream
+	Data   []byte // Chunk contents; only valid until the next call to Next
+	Hash   string // Hex digest of Data using the configured hash algorithm
+}
+
+// Chunker splits a stream into chunks. Implementations must be deterministic:
+// the same input and settings always produce the same chunk boundaries and hashes.
+type Chunker interface {
+	// Next returns the next chunk, or io.EOF once the stream is exhausted
+	Next() (*Chunk, error)
+}
+
+// NewChunker returns the chunker for the given strategy
+func NewChunker(r io.Reader, strategy string, chunkSize int64, hashAlgorithm string) (Chunker, error) {
+	switch strategy {
+	case "", "fixed", "cdc": // Content-defined chunking is not implemented yet and falls back to fixed-size chunks
+		return NewFixedChunker(r, chunkSize, hashAlgorithm)
+	default:
+		return nil, fmt.Errorf("unsupported chunking strategy: %s", strategy)
+	}
+}
+
+// NewChunkerForVault returns the chunker configured for a vault
+func NewChunkerForVault(r io.Reader, vaultConfig config.VaultConfig, chunkSize int64) (Chunker, error) {
+	return NewChunker(r, vaultConfig.Chunking.Strategy, chunkSize, vaultConfig.Chunking.HashAlgorithm)
+}
+
+// fixedChunker cuts the stream into chunks of exactly chunkSize bytes (the last one may be shorter)
+type fixedChunker struct {
+	reader        io.Reader
+	buffer        []byte
+	hashAlgorithm string
+	index         int
+	offset        int64
+	done          bool
+}
+
+// NewFixedChunker creates a fixed-size chunker
+func NewFixedChunker(r io.Reader, chunkSize int64, hashAlgorithm string) (Chunker, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got: %d", chunkSize)
+	}
+	// Validate the algorithm up front so callers fail before reading anything
+	if _, err := CreateHasher(hashAlgorithm); err != nil {
+		return nil, err
+	}
+
+	return &fixedChunker{
+		reader:        r,
+		buffer:        make([]byte, chunkSize),
+		hashAlgorithm: hashAlgorithm,
+	}, nil
+}
+
+// Next implements Chunker
+func (c *fixedChunker) Next() (*Chunk, error) {
+	if c.done {
+		return nil, io.EOF
+	}
+
+	bytesRead, err := io.ReadFull(c.reader, c.buffer)
+	if err != nil {
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("error reading file: %v", err)
+		}
+		c.done = true
+	}
+	if bytesRead == 0 {
+		return nil, io.EOF
+	}
+
+	hasher, err := CreateHasher(c.hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	data := c.buffer[:bytesRead]
+	hasher.Write(data)
+
+	chunk := &Chunk{
+		Index:  c.index,
+		Offset: c.offset,
+		Data:   data,
+		Hash:   fmt.Sprintf("%x", hasher.Sum(nil)),
+	}
+	c.index++
+	c.offset += int64(bytesRead)
+
+	return chunk, nil
+}
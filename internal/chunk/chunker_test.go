@@ -0,0 +1,122 @@
+package chunk
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// fixtureData returns a deterministic 10000 byte input used by the chunker fixtures
+func fixtureData() []byte {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func collectChunks(t *testing.T, chunker Chunker) []Chunk {
+	t.Helper()
+	var chunks []Chunk
+	for {
+		next, err := chunker.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("Next() unexpected error: %v", err)
+		}
+		copied := *next
+		copied.Data = append([]byte(nil), next.Data...)
+		chunks = append(chunks, copied)
+	}
+}
+
+func TestFixedChunkerFixtures(t *testing.T) {
+	expected := []struct {
+		offset int64
+		length int
+		hash   string
+	}{
+		{0, 4096, "d67c656e01756650d77717b0839985a056ec28ffe174601d690fc407a2ceffca"},
+		{4096, 4096, "416317ed11e1666ed2a36373377df576bd327eb944640bf119b242d6f941bb5a"},
+		{8192, 1808, "825cabc798c5aefd6ec7b0f6dbab6c5fe7ff84336193a4e462556d1b0bc37bf1"},
+	}
+
+	tests := []struct {
+		name   string
+		reader func() io.Reader
+	}{
+		{"whole reader", func() io.Reader { return bytes.NewReader(fixtureData()) }},
+		// Short reads must not change chunk boundaries
+		{"one byte reader", func() io.Reader { return iotest.OneByteReader(bytes.NewReader(fixtureData())) }},
+		{"half reader", func() io.Reader { return iotest.HalfReader(bytes.NewReader(fixtureData())) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunker, err := NewChunker(tt.reader(), "fixed", 4096, "sha256")
+			if err != nil {
+				t.Fatalf("NewChunker() error: %v", err)
+			}
+
+			chunks := collectChunks(t, chunker)
+			if len(chunks) != len(expected) {
+				t.Fatalf("got %d chunks, want %d", len(chunks), len(expected))
+			}
+			for i, want := range expected {
+				got := chunks[i]
+				if got.Index != i || got.Offset != want.offset || len(got.Data) != want.length || got.Hash != want.hash {
+					t.Errorf("chunk %d = {index %d, offset %d, len %d, hash %s}, want {index %d, offset %d, len %d, hash %s}",
+						i, got.Index, got.Offset, len(got.Data), got.Hash, i, want.offset, want.length, want.hash)
+				}
+			}
+		})
+	}
+}
+
+func TestFixedChunkerEmptyInput(t *testing.T) {
+	chunker, err := NewFixedChunker(bytes.NewReader(nil), 4096, "sha256")
+	if err != nil {
+		t.Fatalf("NewFixedChunker() error: %v", err)
+	}
+	if chunks := collectChunks(t, chunker); len(chunks) != 0 {
+		t.Errorf("expected no chunks for empty input, got %d", len(chunks))
+	}
+}
+
+func TestNewChunkerErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  string
+		chunkSize int64
+		algorithm string
+	}{
+		{"zero chunk size", "fixed", 0, "sha256"},
+		{"unknown strategy", "rolling", 4096, "sha256"},
+		{"unknown hash algorithm", "fixed", 4096, "md5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewChunker(bytes.NewReader(nil), tt.strategy, tt.chunkSize, tt.algorithm); err == nil {
+				t.Errorf("NewChunker() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestIsZero(t *testing.T) {
+	large := make([]byte, 200*1024)
+	if !IsZero(large) {
+		t.Error("expected zeroed buffer to be detected as zero")
+	}
+	if !IsZero(nil) {
+		t.Error("expected empty data to be zero")
+	}
+	large[len(large)-1] = 1
+	if IsZero(large) {
+		t.Error("expected a trailing non-zero byte to be detected")
+	}
+}
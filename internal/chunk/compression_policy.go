@@ -0,0 +1,80 @@
+package chunk
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// CompressionChoice is the compression chosen for a single file
+type CompressionChoice struct {
+	Pattern    string // Pattern of the matched compression policy; empty when the vault default applies
+	Algorithm  string
+	Level      int
+	Dictionary string // ID of the zstd dictionary to compress with; empty for none
+}
+
+// String describes the algorithm and level
+func (c CompressionChoice) String() string {
+	if c.Dictionary != "" {
+		return compression.Describe(c.Algorithm, c.Level) + " with dictionary " + c.Dictionary
+	}
+	return compression.Describe(c.Algorithm, c.Level)
+}
+
+// MatchingCompressionPolicies returns the indexes of every compression policy
+// matching filePath, in order. Patterns match as chunking policy patterns do.
+func MatchingCompressionPolicies(policies []config.CompressionPolicy, filePath string) []int {
+	var matches []int
+	for i, policy := range policies {
+		if policyMatches(policy.Pattern, filePath) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// ResolveCompression returns the compression for a file of the given size: the
+// first matching compression policy, the vault's dictionary for small files, or
+// the vault default
+func ResolveCompression(vaultConfig config.VaultConfig, filePath string, size int64) CompressionChoice {
+	for _, policy := range vaultConfig.CompressionPolicies {
+		if policyMatches(policy.Pattern, filePath) {
+			return CompressionChoice{Pattern: policy.Pattern, Algorithm: policy.Compression, Level: policy.Level}
+		}
+	}
+	if dict := vaultConfig.CompressionDict; dict != nil && dict.ID != "" && size > 0 {
+		maxSize, err := util.ParseChunkSize(dict.MaxFileSize)
+		if err == nil && size <= maxSize {
+			choice := CompressionChoice{Algorithm: constants.CompressionTypeZstd, Dictionary: dict.ID}
+			if vaultConfig.Compression == constants.CompressionTypeZstd {
+				choice.Level = vaultConfig.CompressionLevel
+			}
+			return choice
+		}
+	}
+	return CompressionChoice{Algorithm: vaultConfig.Compression, Level: vaultConfig.CompressionLevel}
+}
+
+// ValidateCompressionPolicies checks the pattern, algorithm and level of every policy
+func ValidateCompressionPolicies(policies []config.CompressionPolicy) error {
+	for i, policy := range policies {
+		if policy.Pattern == "" {
+			return fmt.Errorf("compression policy %d: pattern is required", i+1)
+		}
+		if _, err := path.Match(policy.Pattern, ""); err != nil {
+			return fmt.Errorf("compression policy %q: invalid pattern: %v", policy.Pattern, err)
+		}
+		if err := compression.ValidateAlgorithm(policy.Compression); err != nil {
+			return fmt.Errorf("compression policy %q: %v", policy.Pattern, err)
+		}
+		if err := compression.ValidateLevel(policy.Compression, policy.Level); err != nil {
+			return fmt.Errorf("compression policy %q: %v", policy.Pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package chunk
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestResolveCompression(t *testing.T) {
+	vaultConfig := config.VaultConfig{
+		Compression: "gzip",
+		CompressionPolicies: []config.CompressionPolicy{
+			{Pattern: "*.txt", Compression: "zstd", Level: 9},
+			{Pattern: "*.csv", Compression: "zstd", Level: 9},
+			{Pattern: "raw/*", Compression: "lz4"},
+			{Pattern: "*.jpg", Compression: "none"},
+			{Pattern: "*.csv", Compression: "gzip"}, // shadowed by the second rule
+		},
+		CompressionDict: &config.CompressionDictConfig{ID: "4c1f0a2e", MaxFileSize: "64KB"},
+	}
+
+	tests := []struct {
+		path          string
+		wantPattern   string
+		wantAlgorithm string
+		wantLevel     int
+		size          int64
+		wantDict      string
+	}{
+		{"notes/todo.txt", "*.txt", "zstd", 9, 1024, ""},
+		{"REPORT.CSV", "*.csv", "zstd", 9, 0, ""},
+		{"raw/frame.jpg", "raw/*", "lz4", 0, 0, ""},
+		{"photos/IMG_0001.jpg", "*.jpg", "none", 0, 0, ""},
+		{"backup.tar", "", "gzip", 0, 0, ""},
+		{"config.json", "", "zstd", 0, 64 * 1024, "4c1f0a2e"},
+		{"large.json", "", "gzip", 0, 64*1024 + 1, ""},
+	}
+	for _, tt := range tests {
+		got := ResolveCompression(vaultConfig, tt.path, tt.size)
+		if got.Pattern != tt.wantPattern || got.Algorithm != tt.wantAlgorithm || got.Level != tt.wantLevel || got.Dictionary != tt.wantDict {
+			t.Errorf("ResolveCompression(%q, %d) = %+v, want {%s %s %d %s}", tt.path, tt.size, got, tt.wantPattern, tt.wantAlgorithm, tt.wantLevel, tt.wantDict)
+		}
+	}
+
+	if got := MatchingCompressionPolicies(vaultConfig.CompressionPolicies, "a.csv"); len(got) != 2 || got[0] != 1 || got[1] != 4 {
+		t.Errorf("MatchingCompressionPolicies() = %v, want [1 4]", got)
+	}
+}
+
+func TestValidateCompressionPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  config.CompressionPolicy
+		wantErr bool
+	}{
+		{"valid", config.CompressionPolicy{Pattern: "*.csv", Compression: "zstd", Level: 9}, false},
+		{"uncompressed", config.CompressionPolicy{Pattern: "*.mp4", Compression: "none"}, false},
+		{"missing pattern", config.CompressionPolicy{Compression: "gzip"}, true},
+		{"bad pattern", config.CompressionPolicy{Pattern: "[*.txt", Compression: "gzip"}, true},
+		{"missing algorithm", config.CompressionPolicy{Pattern: "*.txt"}, true},
+		{"unknown algorithm", config.CompressionPolicy{Pattern: "*.txt", Compression: "snappy"}, true},
+		{"level out of range", config.CompressionPolicy{Pattern: "*.txt", Compression: "gzip", Level: 12}, true},
+		{"level without levels", config.CompressionPolicy{Pattern: "*.txt", Compression: "lz4", Level: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCompressionPolicies([]config.CompressionPolicy{tt.policy})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCompressionPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
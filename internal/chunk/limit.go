@@ -0,0 +1,73 @@
+package chunk
+
+import (
+	"fmt"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// TooManyChunksError is returned when a file would be split into more chunks
+// than the per-file limit allows. Every chunk adds an entry to the file's
+// manifest, so a chunk size far too small for the file makes it unusable.
+type TooManyChunksError struct {
+	Chunks       int64 // Chunks the file is (or would be) split into
+	Limit        int   // The per-file limit
+	ChunkSize    int64 // Chunk size the file was split with
+	SuggestedMin int64 // Smallest power-of-two chunk size that stays within the limit
+}
+
+func (e *TooManyChunksError) Error() string {
+	return fmt.Sprintf("would be split into %d chunks of %s, more than the limit of %d per file; "+
+		"use a chunk size of at least %s (e.g. a chunk policy for the file) or raise --num-chunks-per-file",
+		e.Chunks, FormatChunkSize(e.ChunkSize), e.Limit, FormatChunkSize(e.SuggestedMin))
+}
+
+// MaxChunksPerFile returns the vault's per-file chunk limit, or the default
+// when chunking.max_chunks_per_file is not set
+func MaxChunksPerFile(vaultConfig config.VaultConfig) int {
+	if vaultConfig.Chunking.MaxChunksPerFile > 0 {
+		return vaultConfig.Chunking.MaxChunksPerFile
+	}
+	return constants.DefaultMaxChunksPerFile
+}
+
+// EstimateChunks returns the number of chunks a file of the given size is split
+// into under policy: exact for fixed-size chunks, the average for cdc. The size
+// of data read from stdin is unknown (-1) and gives 0.
+func EstimateChunks(size int64, policy Policy) int64 {
+	if size <= 0 || policy.ChunkSize <= 0 {
+		return 0
+	}
+	if policy.Strategy == StrategyWhole {
+		return 1
+	}
+	return (size + policy.ChunkSize - 1) / policy.ChunkSize
+}
+
+// CheckChunkCount returns a *TooManyChunksError when chunks exceeds limit for a
+// file of the given size split with chunkSize. A limit of 0 disables the check.
+func CheckChunkCount(chunks, size, chunkSize int64, limit int) error {
+	if limit <= 0 || chunks <= int64(limit) {
+		return nil
+	}
+	suggested := int64(1024)
+	for suggested < constants.MaxSuggestedChunkSize && (size+suggested-1)/suggested > int64(limit) {
+		suggested *= 2
+	}
+	return &TooManyChunksError{Chunks: chunks, Limit: limit, ChunkSize: chunkSize, SuggestedMin: suggested}
+}
+
+// FormatChunkSize writes a size the way chunk_size settings are given, in the
+// largest unit that divides it ("512KB", "8MB"), falling back to bytes
+func FormatChunkSize(size int64) string {
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if size >= unit.bytes && size%unit.bytes == 0 {
+			return fmt.Sprintf("%d%s", size/unit.bytes, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
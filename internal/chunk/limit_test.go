@@ -0,0 +1,64 @@
+package chunk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckChunkCount(t *testing.T) {
+	const gib = 1 << 30
+	tests := []struct {
+		name          string
+		size          int64
+		policy        Policy
+		limit         int
+		wantChunks    int64
+		wantSuggested int64 // 0 = within the limit
+	}{
+		{"within limit", 10 * gib, Policy{Strategy: "fixed", ChunkSize: 4 << 20}, 100000, 2560, 0},
+		{"tiny chunks", 10 * gib, Policy{Strategy: "fixed", ChunkSize: 1024}, 100000, 10 * 1024 * 1024, 128 << 10},
+		{"exactly at limit", 100 << 10, Policy{Strategy: "cdc", ChunkSize: 1024}, 100, 100, 0},
+		{"one over", 100<<10 + 1, Policy{Strategy: "cdc", ChunkSize: 1024}, 100, 101, 2048},
+		{"no limit", 10 * gib, Policy{Strategy: "fixed", ChunkSize: 1024}, 0, 10 * 1024 * 1024, 0},
+		{"whole file", 10 * gib, WholePolicy(10 * gib), 1, 1, 0},
+		{"stdin", -1, Policy{Strategy: "fixed", ChunkSize: 1024}, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := EstimateChunks(tt.size, tt.policy)
+			if chunks != tt.wantChunks {
+				t.Fatalf("EstimateChunks() = %d, want %d", chunks, tt.wantChunks)
+			}
+			err := CheckChunkCount(chunks, tt.size, tt.policy.ChunkSize, tt.limit)
+			if tt.wantSuggested == 0 {
+				if err != nil {
+					t.Fatalf("CheckChunkCount() error: %v", err)
+				}
+				return
+			}
+			var tooMany *TooManyChunksError
+			if !errors.As(err, &tooMany) {
+				t.Fatalf("CheckChunkCount() = %v, want a TooManyChunksError", err)
+			}
+			if tooMany.SuggestedMin != tt.wantSuggested {
+				t.Errorf("suggested chunk size = %s, want %s", FormatChunkSize(tooMany.SuggestedMin), FormatChunkSize(tt.wantSuggested))
+			}
+		})
+	}
+}
+
+func TestFormatChunkSize(t *testing.T) {
+	for size, want := range map[int64]string{
+		512:       "512B",
+		1024:      "1KB",
+		1536:      "1536B",
+		128 << 10: "128KB",
+		4 << 20:   "4MB",
+		1 << 30:   "1GB",
+	} {
+		if got := FormatChunkSize(size); got != want {
+			t.Errorf("FormatChunkSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package chunk
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// Policy is the chunking configuration chosen for a single file
+type Policy struct {
+	Pattern   string // Pattern of the matched chunk policy; empty when the vault default applies
+	Strategy  string
+	ChunkSize int64
+}
+
+// ManifestInfo returns the chunking record stored in the file's manifest
+func (p Policy) ManifestInfo() *config.FileChunking {
+	return &config.FileChunking{Policy: p.Pattern, Strategy: p.Strategy, ChunkSize: p.ChunkSize}
+}
+
+// MatchPolicy returns the index of the first policy matching filePath, or -1.
+// Matching is case-insensitive; patterns without a "/" are matched against the
+// file name only, others against the whole slash-separated vault path.
+func MatchPolicy(policies []config.ChunkPolicy, filePath string) int {
+	for i, policy := range policies {
+		if policyMatches(policy.Pattern, filePath) {
+			return i
+		}
+	}
+	return -1
+}
+
+// MatchingPolicies returns the indexes of every policy matching filePath, in order
+func MatchingPolicies(policies []config.ChunkPolicy, filePath string) []int {
+	var matches []int
+	for i, policy := range policies {
+		if policyMatches(policy.Pattern, filePath) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func policyMatches(pattern, filePath string) bool {
+	target := strings.TrimPrefix(strings.ReplaceAll(filePath, "\\", "/"), "/")
+	if !strings.Contains(pattern, "/") {
+		target = path.Base(target)
+	}
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(target))
+	return err == nil && matched
+}
+
+// ResolvePolicy returns the chunking settings for a file: the first matching
+// policy, with unset fields inherited from the vault defaults
+func ResolvePolicy(chunking config.ChunkingConfig, filePath string) (Policy, error) {
+	policy := Policy{Strategy: chunking.Strategy}
+	chunkSize, err := util.ParseChunkSize(chunking.ChunkSize)
+	if err != nil || chunkSize <= 0 {
+		chunkSize = int64(constants.DefaultChunkSize)
+	}
+	policy.ChunkSize = chunkSize
+
+	i := MatchPolicy(chunking.Policies, filePath)
+	if i < 0 {
+		return policy, nil
+	}
+
+	matched := chunking.Policies[i]
+	policy.Pattern = matched.Pattern
+	if matched.Strategy != "" {
+		policy.Strategy = matched.Strategy
+	}
+	if matched.ChunkSize != "" {
+		size, err := util.ParseChunkSize(matched.ChunkSize)
+		if err != nil || size <= 0 {
+			return Policy{}, fmt.Errorf("chunk policy %q: invalid chunk size %q", matched.Pattern, matched.ChunkSize)
+		}
+		policy.ChunkSize = size
+	}
+	return policy, nil
+}
+
+// ResolvePolicyForVault resolves the policy for a file as ResolvePolicy does,
+// then keeps its chunk size within the vault's chunk size bounds
+func ResolvePolicyForVault(vaultConfig config.VaultConfig, filePath string) (Policy, error) {
+	policy, err := ResolvePolicy(vaultConfig.Chunking, filePath)
+	if err != nil {
+		return Policy{}, err
+	}
+	policy.ChunkSize = BoundChunkSize(vaultConfig.Deduplication, policy.ChunkSize)
+	return policy, nil
+}
+
+// BoundChunkSize clamps a chunk size to deduplication.min_chunk_size and
+// max_chunk_size: chunks are cut at the maximum and never split below the
+// minimum. A file's last chunk still holds whatever is left, so it may be
+// smaller; merging it into the chunk before would change the chunks of every
+// file already stored.
+func BoundChunkSize(dedup config.DeduplicationConfig, size int64) int64 {
+	min, max := dedup.ChunkSizeBounds()
+	if max > 0 && size > max {
+		size = max
+	}
+	if min > 0 && size < min && (max == 0 || min <= max) {
+		size = min
+	}
+	return size
+}
+
+// ValidatePolicies checks the pattern, strategy and size of every policy
+func ValidatePolicies(policies []config.ChunkPolicy) error {
+	for i, policy := range policies {
+		if policy.Pattern == "" {
+			return fmt.Errorf("chunk policy %d: pattern is required", i+1)
+		}
+		if _, err := path.Match(policy.Pattern, ""); err != nil {
+			return fmt.Errorf("chunk policy %q: invalid pattern: %v", policy.Pattern, err)
+		}
+		if policy.Strategy != "" {
+			if _, err := NewChunker(strings.NewReader(""), policy.Strategy, 1, ""); err != nil {
+				return fmt.Errorf("chunk policy %q: %v", policy.Pattern, err)
+			}
+		}
+		if policy.ChunkSize != "" {
+			if size, err := util.ParseChunkSize(policy.ChunkSize); err != nil || size <= 0 {
+				return fmt.Errorf("chunk policy %q: invalid chunk size %q", policy.Pattern, policy.ChunkSize)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package chunk
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestResolvePolicy(t *testing.T) {
+	chunking := config.ChunkingConfig{
+		Strategy:  "fixed",
+		ChunkSize: "4MB",
+		Policies: []config.ChunkPolicy{
+			{Pattern: "*.jpg", ChunkSize: "8MB"},
+			{Pattern: "db/*.sql", Strategy: "cdc", ChunkSize: "512KB"},
+			{Pattern: "*.sql", ChunkSize: "1MB"},
+			{Pattern: "*.jpg", ChunkSize: "16MB"}, // shadowed by the first rule
+		},
+	}
+
+	tests := []struct {
+		path         string
+		wantPattern  string
+		wantStrategy string
+		wantSize     int64
+	}{
+		{"photos/IMG_0001.jpg", "*.jpg", "fixed", 8 * 1024 * 1024},
+		{"photos/IMG_0002.JPG", "*.jpg", "fixed", 8 * 1024 * 1024},
+		{"db/dump.sql", "db/*.sql", "cdc", 512 * 1024},
+		{"other/dump.sql", "*.sql", "fixed", 1024 * 1024},
+		{"notes.txt", "", "fixed", 4 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			policy, err := ResolvePolicy(chunking, tt.path)
+			if err != nil {
+				t.Fatalf("ResolvePolicy() error: %v", err)
+			}
+			if policy.Pattern != tt.wantPattern || policy.Strategy != tt.wantStrategy || policy.ChunkSize != tt.wantSize {
+				t.Errorf("ResolvePolicy(%q) = %+v, want {%s %s %d}", tt.path, policy, tt.wantPattern, tt.wantStrategy, tt.wantSize)
+			}
+		})
+	}
+
+	if got := MatchingPolicies(chunking.Policies, "a.jpg"); len(got) != 2 || got[0] != 0 || got[1] != 3 {
+		t.Errorf("MatchingPolicies() = %v, want [0 3]", got)
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  config.ChunkPolicy
+		wantErr bool
+	}{
+		{"valid", config.ChunkPolicy{Pattern: "*.mp4", Strategy: "fixed", ChunkSize: "16MB"}, false},
+		{"missing pattern", config.ChunkPolicy{ChunkSize: "1MB"}, true},
+		{"bad pattern", config.ChunkPolicy{Pattern: "[*.jpg"}, true},
+		{"unknown strategy", config.ChunkPolicy{Pattern: "*.db", Strategy: "rolling"}, true},
+		{"bad size", config.ChunkPolicy{Pattern: "*.db", ChunkSize: "huge"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePolicies([]config.ChunkPolicy{tt.policy})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStoresWhole(t *testing.T) {
+	var perAdd, perVault, raisedMin config.VaultConfig
+	perVault.Chunking.WholeFile = true
+	raisedMin.Chunking.WholeFile = true
+	raisedMin.Deduplication.MinChunkSize = "64KB"
+
+	tests := []struct {
+		name        string
+		vaultConfig config.VaultConfig
+		size        int64
+		requested   bool
+		want        bool
+	}{
+		{"off", perAdd, 100, false, false},
+		{"requested for one add", perAdd, 100, true, true},
+		{"vault setting", perVault, 1023, false, true},
+		{"at the default minimum", perVault, 1024, false, false},
+		{"empty file", perVault, 0, false, false},
+		{"configured minimum", raisedMin, 32 * 1024, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StoresWhole(tt.vaultConfig, tt.size, tt.requested); got != tt.want {
+				t.Errorf("StoresWhole(%d) = %v, want %v", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePolicyForVault(t *testing.T) {
+	var vaultConfig config.VaultConfig
+	vaultConfig.Chunking = config.ChunkingConfig{
+		ChunkSize: "4MB",
+		Policies: []config.ChunkPolicy{
+			{Pattern: "*.mp4", ChunkSize: "1GB"},
+			{Pattern: "*.db", ChunkSize: "512"},
+		},
+	}
+	vaultConfig.Deduplication = config.DeduplicationConfig{MinChunkSize: "1KB", MaxChunkSize: "64MB"}
+
+	tests := []struct {
+		path     string
+		wantSize int64
+	}{
+		{"notes.txt", 4 * 1024 * 1024},
+		{"movie.mp4", 64 * 1024 * 1024}, // cut at the maximum
+		{"app.db", 1024},                // grown to the minimum
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			policy, err := ResolvePolicyForVault(vaultConfig, tt.path)
+			if err != nil {
+				t.Fatalf("ResolvePolicyForVault() error: %v", err)
+			}
+			if policy.ChunkSize != tt.wantSize {
+				t.Errorf("ResolvePolicyForVault(%q) chunk size = %d, want %d", tt.path, policy.ChunkSize, tt.wantSize)
+			}
+		})
+	}
+
+	// Without bounds the policy size is kept as is
+	if got := BoundChunkSize(config.DeduplicationConfig{}, 512); got != 512 {
+		t.Errorf("BoundChunkSize() without bounds = %d, want 512", got)
+	}
+}
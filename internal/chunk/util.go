@@ -13,6 +13,43 @@ import (
 	"github.com/zeebo/blake3"
 )
 
+const (
+	// Display constants
+	HashDisplayLength = 12 // Length of hash to display in logs
+)
+
+// FormatChunkRefString formats the processing summary of a stored chunk reference
+func FormatChunkRefString(ref config.ChunkRef) string {
+	if ref.Zero {
+		return fmt.Sprintf("Chunk %d: %s bytes, all zeros (not stored)\n", ref.Index+1, util.HumanReadableSize(ref.Size))
+	}
+
+	encrypted := ref.EncryptedHash != ""
+	displayHash := ref.Hash
+	if encrypted && len(displayHash) > HashDisplayLength {
+		displayHash = displayHash[:HashDisplayLength]
+	}
+
+	info := ""
+	if encrypted {
+		info += " (encrypted)"
+	}
+	if ref.Compressed {
+		info += fmt.Sprintf(" (compressed with %s: %s -> %s)",
+			ref.CompressionType,
+			util.HumanReadableSize(ref.Size),
+			util.HumanReadableSize(ref.CompressedSize))
+	}
+	if ref.Incompressible {
+		info += " (stored uncompressed, compression saved too little)"
+	}
+	if ref.Deduplicated {
+		info += " [deduplicated]"
+	}
+
+	return fmt.Sprintf("Chunk %d: %s bytes, hash: %s%s\n", ref.Index+1, util.HumanReadableSize(ref.Size), displayHash, info)
+}
+
 // formatChunkInfo formats and returns chunk processing information as a string
 func FormatChunkInfoString(chunkCount int, bytesRead int, chunkHash string, vaultConfig config.VaultConfig, chunkDataToProcess []byte, deduplicated bool, encrypted bool) string {
 	compressionInfo := ""
@@ -0,0 +1,33 @@
+package chunk
+
+import (
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// StrategyWhole is the strategy recorded for files stored as a single chunk
+// without being split
+const StrategyWhole = "whole"
+
+// defaultDedupMinSize mirrors the deduplication manager's fallback minimum
+const defaultDedupMinSize = 1024
+
+// StoresWhole reports whether a file of the given size is stored whole: the vault
+// (or the add, with requested) uses whole-file mode and the file is smaller than
+// the dedup minimum chunk size, below which chunks are never deduplicated anyway.
+// Empty files have no chunks either way.
+func StoresWhole(vaultConfig config.VaultConfig, size int64, requested bool) bool {
+	if !vaultConfig.Chunking.WholeFile && !requested {
+		return false
+	}
+	minSize, err := util.ParseChunkSize(vaultConfig.Deduplication.MinChunkSize)
+	if err != nil || minSize <= 0 {
+		minSize = defaultDedupMinSize
+	}
+	return size > 0 && size < minSize
+}
+
+// WholePolicy returns the policy recorded for a file of the given size stored whole
+func WholePolicy(size int64) Policy {
+	return Policy{Strategy: StrategyWhole, ChunkSize: size}
+}
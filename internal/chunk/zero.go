@@ -0,0 +1,33 @@
+package chunk
+
+import (
+	"bytes"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// zeroBlock is compared against chunk data in slices of this size
+var zeroBlock = make([]byte, 64*1024)
+
+// IsZero reports whether data consists only of zero bytes
+func IsZero(data []byte) bool {
+	for len(data) > 0 {
+		n := min(len(data), len(zeroBlock))
+		if !bytes.Equal(data[:n], zeroBlock[:n]) {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
+
+// ZeroChunkRef returns the synthetic reference recorded for an all-zero chunk.
+// No data is compressed, encrypted or stored for it.
+func ZeroChunkRef(next *Chunk) config.ChunkRef {
+	return config.ChunkRef{
+		Hash:  next.Hash,
+		Size:  int64(len(next.Data)),
+		Index: next.Index,
+		Zero:  true,
+	}
+}
@@ -0,0 +1,363 @@
+// Package clone copies a vault to another local directory, such as an external
+// drive. Chunks already at the destination are skipped, so copying to the same
+// place again only writes what changed.
+package clone
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// skipped are the entries of .sietch that belong to the running vault rather
+// than its data: the lock, cached sizes and adds in progress
+var skipped = map[string]bool{"lock": true, "status.json": true, "ingest": true}
+
+// mirrored are the directories of .sietch whose files are removed from the
+// destination when the source no longer has them
+var mirrored = []string{"manifests", "snapshots"}
+
+// Options tune a copy
+type Options struct {
+	// VerifySample is how many chunks are re-read at the destination and checked
+	// against their hashes: 0 checks none, a negative number all of them
+	VerifySample int
+}
+
+// Result is what a copy did
+type Result struct {
+	Fresh         bool     // The destination did not hold the vault before
+	ChunksCopied  int      // Chunks written to the destination
+	ChunksSkipped int      // Chunks the destination already had
+	PacksCopied   int      // Small-file packs written
+	PacksSkipped  int      // Packs the destination already had
+	FilesCopied   int      // Manifests, index, keys and other metadata files written
+	FilesRemoved  int      // Manifests removed because the source no longer has them
+	BytesCopied   int64    // Size of everything written
+	Verified      int      // Chunks checked at the destination
+	Missing       []string // Chunks the manifests reference that the source lacks
+}
+
+// CheckDestination reports whether dest can receive a copy of the vault at
+// source: it is absent, empty, left by an interrupted first copy, or a copy of
+// the same vault. fresh is true unless dest already holds the vault.
+func CheckDestination(source, dest string) (fresh bool, err error) {
+	sourceAbs, err := filepath.Abs(source)
+	if err != nil {
+		return false, err
+	}
+	destAbs, err := filepath.Abs(dest)
+	if err != nil {
+		return false, err
+	}
+	if rel, err := filepath.Rel(sourceAbs, destAbs); err == nil && (rel == "." || !strings.HasPrefix(rel, "..")) {
+		return false, fmt.Errorf("destination %s is inside the vault being copied", dest)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "vault.yaml")); err == nil {
+		sourceConfig, err := config.LoadVaultConfig(source)
+		if err != nil {
+			return false, fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		destConfig, err := config.LoadVaultConfig(dest)
+		if err != nil {
+			return false, fmt.Errorf("failed to load the destination's vault configuration: %v", err)
+		}
+		if destConfig.VaultID != sourceConfig.VaultID {
+			return false, fmt.Errorf("destination %s holds a different vault (%s, ID %s); copy to an empty directory instead",
+				dest, destConfig.Name, destConfig.VaultID)
+		}
+		return false, nil
+	}
+
+	entries, err := os.ReadDir(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read destination: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != ".sietch" && entry.Name() != "data" {
+			return false, fmt.Errorf("destination %s is not empty and not a copy of this vault", dest)
+		}
+	}
+	return true, nil
+}
+
+// Copy copies the vault at source to dest, which CheckDestination accepted
+// and the caller has locked. Only the chunks and packs the live files and
+// snapshots reference are copied. vault.yaml is written last, so an
+// interrupted first copy is not mistaken for a vault and is finished by
+// copying again.
+func Copy(source, dest string, opts Options) (*Result, error) {
+	if store := layout.SharedStore(source); store != "" {
+		return nil, fmt.Errorf("the vault keeps its chunks in the shared store %s; copy the store with its vaults instead", store)
+	}
+	fresh, err := CheckDestination(source, dest)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Fresh: fresh}
+	if err := fs.CreateVaultStructure(dest); err != nil {
+		return nil, err
+	}
+
+	refs, packs, err := references(source)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(refs))
+	for key := range refs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sourceChunks, destChunks := layout.LocalChunkDirectory(source), layout.LocalChunkDirectory(dest)
+	for _, key := range keys {
+		loc, ok := layout.LocateChunk(source, key)
+		if !ok {
+			result.Missing = append(result.Missing, key)
+			continue
+		}
+		// Chunks held in chunk packs are copied as chunk files of their own
+		rel := filepath.FromSlash(layout.ChunkRelPathIn(key, layout.Version(source)))
+		if !loc.Packed() {
+			if rel, err = filepath.Rel(sourceChunks, loc.Path); err != nil {
+				return nil, err
+			}
+		}
+		copied, size, err := copyBlob(loc, filepath.Join(destChunks, rel))
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy chunk %s: %v", key, err)
+		}
+		if copied {
+			result.ChunksCopied++
+			result.BytesCopied += size
+		} else {
+			result.ChunksSkipped++
+		}
+	}
+
+	for _, packID := range packs {
+		copied, size, err := copyBlob(layout.ChunkLocation{Path: layout.PackPath(source, packID)}, layout.PackPath(dest, packID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy pack %s: %v", packID, err)
+		}
+		if copied {
+			result.PacksCopied++
+			result.BytesCopied += size
+		} else {
+			result.PacksSkipped++
+		}
+	}
+
+	if err := copyMetadata(source, dest, result); err != nil {
+		return nil, err
+	}
+	for _, dir := range mirrored {
+		if err := removeStale(filepath.Join(source, ".sietch", dir), filepath.Join(dest, ".sietch", dir), result); err != nil {
+			return nil, err
+		}
+	}
+	if err := copyFile(filepath.Join(source, "vault.yaml"), filepath.Join(dest, "vault.yaml"), result); err != nil {
+		return nil, err
+	}
+
+	if err := verify(dest, refs, keys, opts.VerifySample, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// references returns the chunks the live files and snapshots reference, by
+// storage key, and the packs they use
+func references(vaultRoot string) (map[string]config.ChunkRef, []string, error) {
+	dirs := []string{filepath.Join(vaultRoot, ".sietch", "manifests")}
+	snapshots, err := snapshot.List(vaultRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, snap := range snapshots {
+		dirs = append(dirs, snapshot.ManifestDir(vaultRoot, snap.ID))
+	}
+
+	refs := make(map[string]config.ChunkRef)
+	packSet := make(map[string]bool)
+	for _, dir := range dirs {
+		err := config.ScanManifestDir(dir, func(entry *config.ManifestEntry) error {
+			if entry.Manifest.Pack != nil {
+				packSet[entry.Manifest.Pack.ID] = true
+			}
+			for _, ref := range entry.Manifest.Chunks {
+				if !ref.Zero && !ref.Remote {
+					refs[chunker.StorageKey(ref)] = ref
+				}
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to read manifests: %v", err)
+		}
+	}
+
+	packs := make([]string, 0, len(packSet))
+	for id := range packSet {
+		packs = append(packs, id)
+	}
+	sort.Strings(packs)
+	return refs, packs, nil
+}
+
+// copyBlob copies a content-addressed chunk or pack unless the destination
+// already has a file of the same size under its name
+func copyBlob(src layout.ChunkLocation, dst string) (copied bool, size int64, err error) {
+	srcSize, err := src.Size()
+	if err != nil {
+		return false, 0, err
+	}
+	if existing, err := os.Stat(dst); err == nil && existing.Size() == srcSize {
+		return false, 0, nil
+	}
+	data, err := src.Read()
+	if err != nil {
+		return false, 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return false, 0, err
+	}
+	if err := atomic.WriteFile(dst, data, 0o644); err != nil {
+		return false, 0, err
+	}
+	return true, int64(len(data)), nil
+}
+
+// copyMetadata copies everything in .sietch besides the chunks, the packs and
+// the entries in skipped: manifests, snapshots, the dedup index, keys,
+// compression dictionaries and the like
+func copyMetadata(source, dest string, result *Result) error {
+	sourceDir := filepath.Join(source, ".sietch")
+	return filepath.WalkDir(sourceDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		top := strings.Split(filepath.ToSlash(rel), "/")[0]
+		if skipped[top] || top == "chunks" || top == "packs" || top == "chunkpacks" {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, filepath.Join(dest, ".sietch", rel), result)
+	})
+}
+
+// copyFile copies a metadata file unless the destination has the same content
+func copyFile(src, dst string, result *Result) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(dst); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := atomic.WriteFile(dst, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to copy %s: %v", src, err)
+	}
+	result.FilesCopied++
+	result.BytesCopied += int64(len(data))
+	return nil
+}
+
+// removeStale removes the files under dst that src no longer has, so deleted
+// files and snapshots do not come back in the copy
+func removeStale(src, dst string, result *Result) error {
+	err := filepath.WalkDir(dst, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(src, rel)); !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		result.FilesRemoved++
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// verify re-reads a random sample of the chunks at the destination and checks
+// them against their hashes, which needs no key
+func verify(dest string, refs map[string]config.ChunkRef, keys []string, sample int, result *Result) error {
+	if sample == 0 || len(keys) == 0 {
+		return nil
+	}
+	destConfig, err := config.LoadVaultConfig(dest)
+	if err != nil {
+		return fmt.Errorf("failed to load the copied vault configuration: %v", err)
+	}
+	opts, err := chunker.OptionsFromConfig(dest, *destConfig, "")
+	if err != nil {
+		opts = chunker.Options{HashAlgorithm: destConfig.Chunking.HashAlgorithm}
+	}
+
+	keys = append([]string(nil), keys...)
+	if sample > 0 && sample < len(keys) {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		keys = keys[:sample]
+	}
+	for _, key := range keys {
+		loc, ok := layout.LocateChunk(dest, key)
+		if !ok {
+			if slices.Contains(result.Missing, key) {
+				continue
+			}
+			return fmt.Errorf("verification failed: chunk %s is missing from the copy", key)
+		}
+		data, err := loc.Read()
+		if err == nil {
+			err = chunker.CheckStored(refs[key], data, opts)
+		}
+		if err != nil {
+			return fmt.Errorf("verification failed for chunk %s at %s: %v", key, loc.Path, err)
+		}
+		result.Verified++
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package clone
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// newVault returns a vault holding one file per content, each a single
+// unencrypted chunk
+func newVault(t *testing.T, id string, contents ...string) string {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	if err := fs.CreateVaultStructure(vaultRoot); err != nil {
+		t.Fatal(err)
+	}
+	// A current schema, so loading the vault during a copy does not migrate and
+	// rewrite it
+	vaultConfig := &config.VaultConfig{SchemaVersion: constants.VaultSchemaVersion, Name: "src", VaultID: id,
+		Chunking: config.ChunkingConfig{HashAlgorithm: "sha256"}}
+	if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range contents {
+		addFile(t, vaultRoot, fmt.Sprintf("file%d.txt", i), content)
+	}
+	return vaultRoot
+}
+
+func addFile(t *testing.T, vaultRoot, name, content string) {
+	t.Helper()
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	if err := fs.StoreChunk(vaultRoot, hash, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	manifest := config.FileManifest{
+		FilePath:    name,
+		Size:        int64(len(content)),
+		Destination: "docs/",
+		Chunks:      []config.ChunkRef{{Hash: hash, Size: int64(len(content))}},
+	}
+	data, err := yaml.Marshal(&manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultRoot, ".sietch", "manifests", "docs."+name+".yaml"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyIncremental(t *testing.T) {
+	source := newVault(t, "vault-1", "alpha", "beta")
+	dest := filepath.Join(t.TempDir(), "backup")
+
+	result, err := Copy(source, dest, Options{VerifySample: -1})
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if !result.Fresh || result.ChunksCopied != 2 || result.Verified != 2 {
+		t.Errorf("first copy = %+v", result)
+	}
+	if !fs.IsVaultInitialized(dest) {
+		t.Fatal("the copy is not a vault")
+	}
+
+	// An orphan chunk is left behind, and a second copy only writes what changed
+	if err := fs.StoreChunk(source, "orphan", []byte("orphan")); err != nil {
+		t.Fatal(err)
+	}
+	addFile(t, source, "new.txt", "gamma")
+	if err := os.Remove(filepath.Join(source, ".sietch", "manifests", "docs.file0.txt.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = Copy(source, dest, Options{})
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if result.Fresh || result.ChunksCopied != 1 || result.ChunksSkipped != 1 || result.FilesCopied != 1 || result.FilesRemoved != 1 {
+		t.Errorf("second copy = %+v, want 1 chunk and 1 manifest written, 1 chunk skipped, 1 manifest removed", result)
+	}
+	if _, ok := layout.LocateChunk(dest, "orphan"); ok {
+		t.Error("an unreferenced chunk was copied")
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".sietch", "manifests", "docs.file0.txt.yaml")); !os.IsNotExist(err) {
+		t.Errorf("the manifest of a deleted file is still in the copy: %v", err)
+	}
+}
+
+func TestCopyVerifyDetectsCorruption(t *testing.T) {
+	source := newVault(t, "vault-1", "alpha")
+	dest := filepath.Join(t.TempDir(), "backup")
+	if _, err := Copy(source, dest, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A damaged chunk of the right size is not copied again, but verification finds it
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte("alpha")))
+	loc, _ := layout.LocateChunk(dest, hash)
+	if err := os.WriteFile(loc.Path, []byte("ALPHA"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Copy(source, dest, Options{VerifySample: -1}); err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Errorf("Copy() error = %v, want a verification failure", err)
+	}
+}
+
+func TestCheckDestination(t *testing.T) {
+	source := newVault(t, "vault-1")
+	other := newVault(t, "vault-2")
+	notEmpty := t.TempDir()
+	if err := os.WriteFile(filepath.Join(notEmpty, "x"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		dest      string
+		wantFresh bool
+		wantErr   string
+	}{
+		{"absent", filepath.Join(t.TempDir(), "new"), true, ""},
+		{"empty", t.TempDir(), true, ""},
+		{"other vault", other, false, "different vault"},
+		{"not empty", notEmpty, false, "not empty"},
+		{"inside source", filepath.Join(source, "backup"), false, "inside the vault"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fresh, err := CheckDestination(source, tt.dest)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("CheckDestination() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || fresh != tt.wantFresh {
+				t.Errorf("CheckDestination() = %v, %v; want %v", fresh, err, tt.wantFresh)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Package compact converts the metadata of an existing vault between plain and
+// zstd compressed storage. Every manifest, live or in a snapshot, is rewritten
+// byte for byte in the target form and the deduplication index snapshot is
+// rewritten with it. Manifests are converted in batches that each commit in one
+// transaction; since readers accept either form, an interrupted conversion
+// leaves a vault that loads normally and is finished by running it again.
+package compact
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+)
+
+const (
+	// command names compact transactions, so interrupted ones can be found
+	command = "vault compact"
+
+	// A batch commits after this many manifests
+	batchFiles = 1000
+)
+
+// Result summarizes a conversion. In a dry run it describes what would be done.
+type Result struct {
+	Converted   int   // Manifests rewritten in the target form
+	Unchanged   int   // Manifests already in the target form
+	BytesBefore int64 // Size of the converted manifests before conversion
+	BytesAfter  int64 // Size of the converted manifests after conversion
+	IndexBefore int64 // Size of the deduplication index files before conversion
+	IndexAfter  int64 // Size of the deduplication index files after conversion
+	HasIndex    bool  // The vault has a deduplication index on disk
+}
+
+// Run converts the vault's manifests and index snapshot to compressed storage,
+// or back to plain YAML when compress is false, and records the manifest
+// format in vault.yaml
+func Run(vaultRoot string, compress, dryRun bool) (*Result, error) {
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	files, err := manifestFiles(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// The format is recorded first, so manifests written from now on, and by a
+	// run finishing an interrupted one, already use it
+	format := constants.ManifestFormatYAML
+	if compress {
+		format = constants.ManifestFormatZstd
+	}
+	if !dryRun && vaultConfig.ManifestFormat != format {
+		vaultConfig.ManifestFormat = format
+		if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+			return nil, fmt.Errorf("failed to update vault configuration: %v", err)
+		}
+	}
+
+	result := &Result{}
+	for start := 0; start < len(files); start += batchFiles {
+		end := min(start+batchFiles, len(files))
+		if err := convertBatch(vaultRoot, files[start:end], compress, dryRun, result); err != nil {
+			return nil, fmt.Errorf("%v (run 'sietch vault compact' again to finish)", err)
+		}
+	}
+
+	result.IndexBefore, result.HasIndex = indexSize(vaultRoot)
+	result.IndexAfter = result.IndexBefore
+	if result.HasIndex && !dryRun {
+		idx, err := deduplication.NewDeduplicationIndex(vaultRoot)
+		if err != nil {
+			return nil, err
+		}
+		if err := idx.Rewrite(compress); err != nil {
+			return nil, fmt.Errorf("failed to rewrite deduplication index: %v", err)
+		}
+		result.IndexAfter, _ = indexSize(vaultRoot)
+	}
+	return result, nil
+}
+
+// convertBatch rewrites the manifests in rels that are not in the target form,
+// in one transaction
+func convertBatch(vaultRoot string, rels []string, compress, dryRun bool, result *Result) error {
+	var txn *atomic.Transaction
+	committed := false
+	defer func() {
+		if txn != nil && !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	for _, rel := range rels {
+		data, err := os.ReadFile(filepath.Join(vaultRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s: %v", rel, err)
+		}
+		if config.IsCompressedManifest(data) == compress {
+			result.Unchanged++
+			continue
+		}
+		plain, err := config.DecodeManifestData(data)
+		if err != nil {
+			return fmt.Errorf("manifest %s: %v", rel, err)
+		}
+		converted, err := config.EncodeManifestData(plain, compress)
+		if err != nil {
+			return fmt.Errorf("manifest %s: %v", rel, err)
+		}
+		result.Converted++
+		result.BytesBefore += int64(len(data))
+		result.BytesAfter += int64(len(converted))
+		if dryRun {
+			continue
+		}
+
+		if txn == nil {
+			if txn, err = atomic.Begin(vaultRoot, map[string]any{"command": command}); err != nil {
+				return fmt.Errorf("begin transaction: %w", err)
+			}
+		}
+		w, err := txn.StageReplace(rel)
+		if err != nil {
+			return fmt.Errorf("stage %s: %w", rel, err)
+		}
+		if _, err := w.Write(converted); err != nil {
+			_ = w.Close()
+			return fmt.Errorf("write staged %s: %w", rel, err)
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	if txn == nil {
+		return nil
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// manifestFiles lists the manifests of the live vault and of every snapshot,
+// as slash-separated paths relative to vaultRoot
+func manifestFiles(vaultRoot string) ([]string, error) {
+	dirs := []string{filepath.Join(vaultRoot, ".sietch", "manifests")}
+	snapshots, err := snapshot.List(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snapshots {
+		dirs = append(dirs, snapshot.ManifestDir(vaultRoot, snap.ID))
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifests directory: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yaml") {
+				continue
+			}
+			rel, err := filepath.Rel(vaultRoot, filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// indexSize returns the combined size of the deduplication index files, and
+// whether there are any
+func indexSize(vaultRoot string) (int64, bool) {
+	entries, err := os.ReadDir(deduplication.IndexDir(vaultRoot))
+	if err != nil {
+		return 0, false
+	}
+	var size int64
+	found := false
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		size += info.Size()
+		found = true
+	}
+	return size, found
+}
@@ -0,0 +1,148 @@
+package compact
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+)
+
+// newTestVault returns a vault with plain manifests, one snapshot and a
+// compacted deduplication index
+func newTestVault(t *testing.T, files int) string {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	vaultConfig := &config.VaultConfig{Name: "compact"}
+	vaultConfig.Encryption.Type = "none"
+	if err := config.SaveVaultConfig(vaultRoot, vaultConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := deduplication.NewDeduplicationIndex(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range files {
+		ref := config.ChunkRef{Hash: fmt.Sprintf("%064x", i), Size: 1024, Index: 0}
+		data, err := yaml.Marshal(&config.FileManifest{FilePath: fmt.Sprintf("file%d.txt", i), Destination: "docs/", Size: 1024, Chunks: []config.ChunkRef{ref}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(manifestsDir, fmt.Sprintf("docs.file%d.txt.yaml", i)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		idx.AddChunk(ref, ref.Hash)
+	}
+	if err := idx.Rewrite(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snapshot.Create(vaultRoot, "before compact"); err != nil {
+		t.Fatal(err)
+	}
+	return vaultRoot
+}
+
+// readManifests returns the stored bytes of every manifest, live and in snapshots
+func readManifests(t *testing.T, vaultRoot string) map[string][]byte {
+	t.Helper()
+	rels, err := manifestFiles(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte, len(rels))
+	for _, rel := range rels {
+		data, err := os.ReadFile(filepath.Join(vaultRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[rel] = data
+	}
+	return files
+}
+
+func TestRun(t *testing.T) {
+	vaultRoot := newTestVault(t, 20)
+	original := readManifests(t, vaultRoot)
+	if len(original) != 40 {
+		t.Fatalf("test vault has %d manifests, want 40", len(original))
+	}
+
+	// A dry run reports the conversion without changing anything
+	result, err := Run(vaultRoot, true, true)
+	if err != nil {
+		t.Fatalf("Run(dry run) error: %v", err)
+	}
+	if result.Converted != 40 || result.BytesAfter >= result.BytesBefore || !result.HasIndex {
+		t.Errorf("dry run result = %+v, want 40 smaller manifests and an index", result)
+	}
+	if config.ManifestCompression(vaultRoot) {
+		t.Error("dry run changed the manifest format")
+	}
+	for rel, data := range readManifests(t, vaultRoot) {
+		if string(data) != string(original[rel]) {
+			t.Errorf("dry run changed %s", rel)
+		}
+	}
+
+	if _, err := Run(vaultRoot, true, false); err != nil {
+		t.Fatalf("Run(compress) error: %v", err)
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vaultConfig.ManifestFormat != constants.ManifestFormatZstd {
+		t.Errorf("manifest_format = %d, want %d", vaultConfig.ManifestFormat, constants.ManifestFormatZstd)
+	}
+	for rel, data := range readManifests(t, vaultRoot) {
+		if !config.IsCompressedManifest(data) {
+			t.Errorf("%s was not compressed", rel)
+		}
+	}
+	var loaded int
+	err = config.WalkManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(entry *config.ManifestEntry) error {
+		if entry.Manifest.Destination != "docs/" || len(entry.Manifest.Chunks) != 1 {
+			t.Errorf("compressed manifest loaded as %+v", entry.Manifest)
+		}
+		loaded++
+		return nil
+	})
+	if err != nil || loaded != 20 {
+		t.Errorf("loaded %d compressed manifests, error %v; want 20", loaded, err)
+	}
+	idx, err := deduplication.NewDeduplicationIndex(vaultRoot)
+	if err != nil {
+		t.Fatalf("compressed index does not load: %v", err)
+	}
+	if stats := idx.GetStats(); stats.TotalChunks != 20 {
+		t.Errorf("compressed index holds %d chunks, want 20", stats.TotalChunks)
+	}
+
+	// Compressing again has nothing to do; decompressing restores the original bytes
+	result, err = Run(vaultRoot, true, false)
+	if err != nil || result.Converted != 0 || result.Unchanged != 40 {
+		t.Errorf("second Run(compress) = %+v, %v; want every manifest unchanged", result, err)
+	}
+	if _, err := Run(vaultRoot, false, false); err != nil {
+		t.Fatalf("Run(decompress) error: %v", err)
+	}
+	for rel, data := range readManifests(t, vaultRoot) {
+		if string(data) != string(original[rel]) {
+			t.Errorf("%s differs from the original after decompressing", rel)
+		}
+	}
+	if config.ManifestCompression(vaultRoot) {
+		t.Error("vault still compresses manifests after decompressing")
+	}
+}
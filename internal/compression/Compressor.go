@@ -3,21 +3,60 @@ package compression
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
 	"github.com/substantialcattle5/sietch/internal/constants"
 )
 
+// Algorithms lists the supported compression algorithms
+var Algorithms = []string{
+	constants.CompressionTypeNone,
+	constants.CompressionTypeGzip,
+	constants.CompressionTypeZstd,
+	constants.CompressionTypeLZ4,
+	constants.CompressionTypeBrotli,
+}
+
+// ValidateAlgorithm checks that algorithm is one of Algorithms
+func ValidateAlgorithm(algorithm string) error {
+	for _, a := range Algorithms {
+		if algorithm == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported compression %q (supported: %s)", algorithm, strings.Join(Algorithms, ", "))
+}
+
 // CompressData compresses data according to the specified compression algorithm
+// at its default level
 func CompressData(data []byte, algorithm string) ([]byte, error) {
+	return CompressDataLevel(data, algorithm, 0)
+}
+
+// CompressDataLevel compresses data with the given algorithm and level. Level 0
+// selects the algorithm's default; other levels must pass ValidateLevel. The
+// level is not needed to decompress.
+func CompressDataLevel(data []byte, algorithm string, level int) ([]byte, error) {
+	if err := ValidateLevel(algorithm, level); err != nil {
+		return nil, err
+	}
 	switch algorithm {
 	case constants.CompressionTypeNone:
 		return data, nil
 	case constants.CompressionTypeGzip:
+		if level == 0 {
+			level = constants.DefaultGzipLevel
+		}
 		var buf bytes.Buffer
-		writer := gzip.NewWriter(&buf)
+		writer, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+		}
 		if _, err := writer.Write(data); err != nil {
 			return nil, fmt.Errorf("failed to write gzip data: %w", err)
 		}
@@ -26,21 +65,58 @@ func CompressData(data []byte, algorithm string) ([]byte, error) {
 		}
 		return buf.Bytes(), nil
 	case constants.CompressionTypeZstd:
-		encoder, err := zstd.NewWriter(nil)
+		if level == 0 {
+			level = constants.DefaultZstdLevel
+		}
+		// The encoder implements four speeds; zstd levels map onto the nearest one
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
 		}
 		defer encoder.Close()
 		return encoder.EncodeAll(data, nil), nil
+	case constants.CompressionTypeLZ4:
+		return compressLZ4(data), nil
+	case constants.CompressionTypeBrotli:
+		if level == 0 {
+			level = constants.DefaultBrotliLevel
+		}
+		var buf bytes.Buffer
+		writer := brotli.NewWriterLevel(&buf, level)
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to write brotli data: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close brotli writer: %w", err)
+		}
+		return buf.Bytes(), nil
 	default:
 		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
 	}
 }
 
+// ErrDecompressionBomb is returned when data decompresses to more than allowed
+var ErrDecompressionBomb = errors.New("decompressed data exceeds the size limit")
+
+// bombError reports data that decompresses to more than limit bytes
+func bombError(limit int) error {
+	return fmt.Errorf("%w of %d bytes - potential decompression bomb", ErrDecompressionBomb, limit)
+}
+
 // DecompressData decompresses data according to the specified compression algorithm
 func DecompressData(data []byte, algorithm string) ([]byte, error) {
+	return DecompressDataLimit(data, algorithm, constants.MaxDecompressionSize)
+}
+
+// DecompressDataLimit decompresses data, failing with ErrDecompressionBomb once
+// the output exceeds limit bytes. Output is produced in a stream, so input that
+// expands enormously is never decompressed further than the limit.
+func DecompressDataLimit(data []byte, algorithm string, limit int) ([]byte, error) {
 	switch algorithm {
 	case constants.CompressionTypeNone:
+		if len(data) > limit {
+			return nil, bombError(limit)
+		}
 		return data, nil
 	case constants.CompressionTypeGzip:
 		reader, err := gzip.NewReader(bytes.NewReader(data))
@@ -49,41 +125,112 @@ func DecompressData(data []byte, algorithm string) ([]byte, error) {
 		}
 		defer reader.Close()
 
-		var buf bytes.Buffer
-		// Use io.CopyN to limit decompression size and prevent decompression bombs
-		n, err := io.CopyN(&buf, reader, constants.MaxDecompressionSize)
-		if err != nil && err != io.EOF {
+		decompressed, err := readLimited(reader, limit)
+		if err != nil && !errors.Is(err, ErrDecompressionBomb) {
 			return nil, fmt.Errorf("failed to decompress gzip data: %w", err)
 		}
-
-		// Check if we hit the limit (potential decompression bomb)
-		if n == constants.MaxDecompressionSize {
-			// Try to read one more byte to see if there's more data
-			var extraByte [1]byte
-			if _, err := reader.Read(extraByte[:]); err == nil {
-				return nil, fmt.Errorf("decompressed data exceeds maximum size limit (%d bytes) - potential decompression bomb", constants.MaxDecompressionSize)
-			}
-		}
-		return buf.Bytes(), nil
+		return decompressed, err
 	case constants.CompressionTypeZstd:
-		decoder, err := zstd.NewReader(nil)
+		decoder, err := newZstdStreamDecoder(data, limit)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
 		}
 		defer decoder.Close()
 
-		decompressed, err := decoder.DecodeAll(data, nil)
-		if err != nil {
+		decompressed, err := readLimited(decoder, limit)
+		if err != nil && !errors.Is(err, ErrDecompressionBomb) {
 			return nil, fmt.Errorf("failed to decompress zstd data: %w", err)
 		}
-
-		// Check decompressed size to prevent decompression bombs
-		if len(decompressed) > constants.MaxDecompressionSize {
-			return nil, fmt.Errorf("decompressed data exceeds maximum size limit (%d bytes) - potential decompression bomb", constants.MaxDecompressionSize)
+		return decompressed, err
+	case constants.CompressionTypeLZ4:
+		decompressed, err := decompressLZ4(data, limit)
+		if errors.Is(err, ErrDecompressionBomb) {
+			return nil, bombError(limit)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress lz4 data: %w", err)
 		}
-
 		return decompressed, nil
+	case constants.CompressionTypeBrotli:
+		decompressed, err := readLimited(brotli.NewReader(bytes.NewReader(data)), limit)
+		if err != nil && !errors.Is(err, ErrDecompressionBomb) {
+			return nil, fmt.Errorf("failed to decompress brotli data: %w", err)
+		}
+		return decompressed, err
 	default:
 		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
 	}
 }
+
+// zstdEncoderWindow is the window size CompressDataLevel's zstd encoder uses
+const zstdEncoderWindow = 8 << 20
+
+// newZstdStreamDecoder returns a single threaded zstd decoder reading data. The
+// window it may allocate is bounded by the limit, or by the largest window the
+// encoder uses for limits below that, so a forged frame header cannot claim
+// more memory than the data it may produce.
+func newZstdStreamDecoder(data []byte, limit int, opts ...zstd.DOption) (*zstd.Decoder, error) {
+	maxMemory := max(uint64(limit), zstdEncoderWindow)
+	opts = append(opts, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxMemory))
+	return zstd.NewReader(bytes.NewReader(data), opts...)
+}
+
+// readLimited reads r to the end, failing with ErrDecompressionBomb after limit bytes
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, bombError(limit)
+	}
+	return data, nil
+}
+
+// LevelRange returns the levels an algorithm accepts besides 0, the default.
+// ok is false for algorithms without levels.
+func LevelRange(algorithm string) (min, max int, ok bool) {
+	switch algorithm {
+	case constants.CompressionTypeGzip:
+		return constants.MinGzipLevel, constants.MaxGzipLevel, true
+	case constants.CompressionTypeZstd:
+		return constants.MinZstdLevel, constants.MaxZstdLevel, true
+	case constants.CompressionTypeBrotli:
+		return constants.MinBrotliLevel, constants.MaxBrotliLevel, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// ValidateLevel checks that level is valid for algorithm. Level 0 (the
+// algorithm's default) is valid for every algorithm.
+func ValidateLevel(algorithm string, level int) error {
+	if level == 0 {
+		return nil
+	}
+	min, max, ok := LevelRange(algorithm)
+	if !ok {
+		return fmt.Errorf("compression %q does not take a level", algorithm)
+	}
+	if level < min || level > max {
+		return fmt.Errorf("%s compression level must be between %d and %d, got %d", algorithm, min, max, level)
+	}
+	return nil
+}
+
+// Describe names an algorithm and, when it is not the default, its level
+func Describe(algorithm string, level int) string {
+	if level == 0 {
+		return algorithm
+	}
+	return fmt.Sprintf("%s (level %d)", algorithm, level)
+}
+
+// Worthwhile reports whether compressing originalSize bytes to compressedSize
+// saves at least minSavings percent. minSavings 0 selects the default.
+func Worthwhile(originalSize, compressedSize int, minSavings int) bool {
+	if minSavings <= 0 {
+		minSavings = constants.DefaultCompressionMinSavings
+	}
+	return int64(compressedSize)*100 <= int64(originalSize)*int64(100-minSavings)
+}
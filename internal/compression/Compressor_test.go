@@ -0,0 +1,212 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// textCorpus returns size bytes of prose-like text built from a small
+// vocabulary, standing in for documents, logs and source code
+func textCorpus(size int) []byte {
+	words := strings.Fields(`the vault stores each file as chunks that are hashed compressed and
+		encrypted before they are written so that identical data is kept only once while
+		peers exchange the chunks they are missing over an authenticated connection
+		error warning info debug request response user config value time path`)
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.WriteString(words[rng.Intn(len(words))])
+		if rng.Intn(12) == 0 {
+			buf.WriteString(".\n")
+		} else {
+			buf.WriteByte(' ')
+		}
+	}
+	return buf.Bytes()[:size]
+}
+
+// binaryCorpus returns size bytes of structured binary records (counters,
+// measurements and flags with noise), standing in for databases and executables
+func binaryCorpus(size int) []byte {
+	rng := rand.New(rand.NewSource(2))
+	buf := make([]byte, 0, size+32)
+	for i := uint64(0); len(buf) < size; i++ {
+		buf = binary.LittleEndian.AppendUint64(buf, i)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(100+rng.NormFloat64()))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(rng.Intn(16)))
+		buf = append(buf, byte(rng.Intn(256)), 0, 0, 0)
+		buf = binary.LittleEndian.AppendUint64(buf, rng.Uint64()&0xffff)
+	}
+	return buf[:size]
+}
+
+func TestCompressDataLevelRoundTrip(t *testing.T) {
+	data := textCorpus(256 * 1024)
+	tests := []struct {
+		algorithm string
+		level     int
+	}{
+		{constants.CompressionTypeNone, 0},
+		{constants.CompressionTypeGzip, 0},
+		{constants.CompressionTypeGzip, 1},
+		{constants.CompressionTypeGzip, 9},
+		{constants.CompressionTypeZstd, 0},
+		{constants.CompressionTypeZstd, 1},
+		{constants.CompressionTypeZstd, 19},
+		{constants.CompressionTypeLZ4, 0},
+		{constants.CompressionTypeBrotli, 0},
+		{constants.CompressionTypeBrotli, 1},
+		{constants.CompressionTypeBrotli, 11},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s-%d", tt.algorithm, tt.level), func(t *testing.T) {
+			compressed, err := CompressDataLevel(data, tt.algorithm, tt.level)
+			if err != nil {
+				t.Fatalf("CompressDataLevel() error: %v", err)
+			}
+			// Decompression only needs the algorithm recorded with the chunk
+			decompressed, err := DecompressData(compressed, tt.algorithm)
+			if err != nil {
+				t.Fatalf("DecompressData() error: %v", err)
+			}
+			if !bytes.Equal(decompressed, data) {
+				t.Error("round trip changed the data")
+			}
+		})
+	}
+
+	fast, _ := CompressDataLevel(data, constants.CompressionTypeZstd, 1)
+	best, _ := CompressDataLevel(data, constants.CompressionTypeZstd, 19)
+	if len(best) >= len(fast) {
+		t.Errorf("zstd level 19 (%d bytes) is not smaller than level 1 (%d bytes)", len(best), len(fast))
+	}
+}
+
+func TestDecompressDataLimit(t *testing.T) {
+	// 16MB of zeros compresses to a few KB: a bomb for a chunk recorded as 4KB
+	bomb := make([]byte, 16<<20)
+	for _, algorithm := range []string{"gzip", "zstd", "lz4", "brotli", "none"} {
+		t.Run(algorithm, func(t *testing.T) {
+			compressed, err := CompressData(bomb, algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DecompressDataLimit(compressed, algorithm, 4096); !errors.Is(err, ErrDecompressionBomb) {
+				t.Errorf("DecompressDataLimit() over the limit = %v, want ErrDecompressionBomb", err)
+			}
+			got, err := DecompressDataLimit(compressed, algorithm, len(bomb))
+			if err != nil || len(got) != len(bomb) {
+				t.Errorf("DecompressDataLimit() at the limit = %d bytes, %v", len(got), err)
+			}
+		})
+	}
+
+	// A zstd frame whose header claims a huge window is refused without allocating it
+	t.Run("zstd window", func(t *testing.T) {
+		header := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0xa0} // Window descriptor: 1GB
+		header = append(header, 0x01, 0x00, 0x00)            // Last raw block, empty
+		if _, err := DecompressDataLimit(header, "zstd", 4096); err == nil {
+			t.Error("DecompressDataLimit() accepted a frame with a 1GB window")
+		}
+	})
+}
+
+func TestValidateLevel(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		level     int
+		wantErr   bool
+	}{
+		{constants.CompressionTypeNone, 0, false},
+		{constants.CompressionTypeNone, 3, true},
+		{constants.CompressionTypeGzip, 9, false},
+		{constants.CompressionTypeGzip, 10, true},
+		{constants.CompressionTypeZstd, 19, false},
+		{constants.CompressionTypeZstd, 20, true},
+		{constants.CompressionTypeZstd, -1, true},
+		{constants.CompressionTypeLZ4, 0, false},
+		{constants.CompressionTypeLZ4, 1, true},
+		{constants.CompressionTypeBrotli, 11, false},
+		{constants.CompressionTypeBrotli, 12, true},
+	}
+	for _, tt := range tests {
+		err := ValidateLevel(tt.algorithm, tt.level)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateLevel(%s, %d) error = %v, wantErr %v", tt.algorithm, tt.level, err, tt.wantErr)
+		}
+		if _, err := CompressDataLevel([]byte("data"), tt.algorithm, tt.level); (err != nil) != tt.wantErr {
+			t.Errorf("CompressDataLevel(%s, %d) error = %v, wantErr %v", tt.algorithm, tt.level, err, tt.wantErr)
+		}
+	}
+}
+
+// BenchmarkCompress compares speed and ratio (reported as compressed/original)
+// on a text and a binary corpus. Run with:
+//
+//	go test ./internal/compression -run ^$ -bench Compress
+func BenchmarkCompress(b *testing.B) {
+	corpora := []struct {
+		name string
+		data []byte
+	}{
+		{"text", textCorpus(1024 * 1024)},
+		{"binary", binaryCorpus(1024 * 1024)},
+	}
+	codecs := []struct {
+		algorithm string
+		level     int
+	}{
+		{constants.CompressionTypeGzip, 1},
+		{constants.CompressionTypeGzip, constants.DefaultGzipLevel},
+		{constants.CompressionTypeGzip, 9},
+		{constants.CompressionTypeZstd, 1},
+		{constants.CompressionTypeZstd, constants.DefaultZstdLevel},
+		{constants.CompressionTypeZstd, 7},
+		{constants.CompressionTypeZstd, 19},
+		{constants.CompressionTypeLZ4, 0},
+		{constants.CompressionTypeBrotli, 1},
+		{constants.CompressionTypeBrotli, constants.DefaultBrotliLevel},
+		{constants.CompressionTypeBrotli, 11},
+	}
+	for _, corpus := range corpora {
+		for _, codec := range codecs {
+			b.Run(fmt.Sprintf("%s/%s-%d", corpus.name, codec.algorithm, codec.level), func(b *testing.B) {
+				b.SetBytes(int64(len(corpus.data)))
+				var compressed []byte
+				for i := 0; i < b.N; i++ {
+					var err error
+					if compressed, err = CompressDataLevel(corpus.data, codec.algorithm, codec.level); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(compressed))/float64(len(corpus.data)), "ratio")
+			})
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	data := textCorpus(1024 * 1024)
+	for _, algorithm := range []string{constants.CompressionTypeGzip, constants.CompressionTypeZstd, constants.CompressionTypeLZ4, constants.CompressionTypeBrotli} {
+		compressed, err := CompressData(data, algorithm)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(algorithm, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := DecompressData(compressed, algorithm); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package compression
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+const (
+	// MinDictionarySamples is the fewest samples a dictionary is trained from
+	MinDictionarySamples = 8
+
+	dictDmerSize    = 8   // Length of the substrings counted across samples
+	dictSegmentSize = 256 // Length of the sample segments the history is built from
+)
+
+// Dictionary is a trained zstd dictionary and the ID chunks record it by
+type Dictionary struct {
+	ID   string
+	Data []byte
+}
+
+// TrainDictionary builds a zstd dictionary of at most maxSize bytes from
+// samples of similar data. Its history is made of the sample segments whose
+// substrings occur in the most samples, a simplified form of zstd's COVER
+// algorithm.
+func TrainDictionary(samples [][]byte, maxSize int, id uint32) ([]byte, error) {
+	if len(samples) < MinDictionarySamples {
+		return nil, fmt.Errorf("need at least %d samples to train a dictionary, got %d", MinDictionarySamples, len(samples))
+	}
+
+	// Count the samples each d-mer occurs in; d-mers unique to one sample
+	// cannot help compress anything else
+	frequency := make(map[uint64]int)
+	for _, sample := range samples {
+		seen := make(map[uint64]struct{})
+		for i := 0; i+dictDmerSize <= len(sample); i++ {
+			dmer := binary.LittleEndian.Uint64(sample[i:])
+			if _, ok := seen[dmer]; !ok {
+				seen[dmer] = struct{}{}
+				frequency[dmer]++
+			}
+		}
+	}
+
+	score := func(segment []byte) int {
+		total := 0
+		seen := make(map[uint64]struct{})
+		for i := 0; i+dictDmerSize <= len(segment); i++ {
+			dmer := binary.LittleEndian.Uint64(segment[i:])
+			if _, ok := seen[dmer]; ok {
+				continue
+			}
+			seen[dmer] = struct{}{}
+			if f := frequency[dmer]; f > 1 {
+				total += f
+			}
+		}
+		return total
+	}
+
+	candidates := &segmentHeap{}
+	for _, sample := range samples {
+		for start := 0; start+dictDmerSize <= len(sample); start += dictSegmentSize {
+			end := min(start+dictSegmentSize, len(sample))
+			segment := sample[start:end]
+			if s := score(segment); s > 0 {
+				*candidates = append(*candidates, scoredSegment{data: segment, score: s})
+			}
+		}
+	}
+	heap.Init(candidates)
+
+	// Greedily take the best segment, rescoring lazily as the d-mers already
+	// covered stop counting
+	var chosen [][]byte
+	size := 0
+	for candidates.Len() > 0 && size < maxSize {
+		best := heap.Pop(candidates).(scoredSegment)
+		best.score = score(best.data)
+		if best.score == 0 {
+			continue
+		}
+		if candidates.Len() > 0 && best.score < (*candidates)[0].score {
+			heap.Push(candidates, best)
+			continue
+		}
+		segment := best.data
+		if size+len(segment) > maxSize {
+			segment = segment[:maxSize-size]
+		}
+		chosen = append(chosen, segment)
+		size += len(segment)
+		for i := 0; i+dictDmerSize <= len(segment); i++ {
+			delete(frequency, binary.LittleEndian.Uint64(segment[i:]))
+		}
+	}
+
+	// The most useful content goes last, where matches have the shortest offsets
+	history := make([]byte, 0, size)
+	for i := len(chosen) - 1; i >= 0; i-- {
+		history = append(history, chosen[i]...)
+	}
+	if len(history) < dictDmerSize {
+		return nil, fmt.Errorf("the samples have too little in common to train a dictionary")
+	}
+
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+		Level:    zstd.EncoderLevelFromZstd(constants.DefaultZstdLevel),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build zstd dictionary: %w", err)
+	}
+	return dict, nil
+}
+
+// DictionaryID returns the ID stored in a zstd dictionary
+func DictionaryID(dict []byte) (uint32, error) {
+	info, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return 0, fmt.Errorf("invalid zstd dictionary: %w", err)
+	}
+	return info.ID(), nil
+}
+
+// CompressWithDictionary compresses data with zstd at the given level, using dict
+func CompressWithDictionary(data []byte, level int, dict []byte) ([]byte, error) {
+	if err := ValidateLevel(constants.CompressionTypeZstd, level); err != nil {
+		return nil, err
+	}
+	if level == 0 {
+		level = constants.DefaultZstdLevel
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderDict(dict))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(data, nil), nil
+}
+
+// DecompressWithDictionary decompresses zstd data compressed with dict
+func DecompressWithDictionary(data []byte, dict []byte) ([]byte, error) {
+	return DecompressWithDictionaryLimit(data, dict, constants.MaxDecompressionSize)
+}
+
+// DecompressWithDictionaryLimit decompresses zstd data compressed with dict,
+// failing with ErrDecompressionBomb once the output exceeds limit bytes
+func DecompressWithDictionaryLimit(data []byte, dict []byte, limit int) ([]byte, error) {
+	decoder, err := newZstdStreamDecoder(data, limit, zstd.WithDecoderDicts(dict))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer decoder.Close()
+
+	decompressed, err := readLimited(decoder, limit)
+	if err != nil && !errors.Is(err, ErrDecompressionBomb) {
+		return nil, fmt.Errorf("failed to decompress zstd data: %w", err)
+	}
+	return decompressed, err
+}
+
+type scoredSegment struct {
+	data  []byte
+	score int
+}
+
+// segmentHeap orders segments by descending score
+type segmentHeap []scoredSegment
+
+func (h segmentHeap) Len() int           { return len(h) }
+func (h segmentHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h segmentHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x any)        { *h = append(*h, x.(scoredSegment)) }
+func (h *segmentHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,91 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// jsonSamples returns small JSON documents sharing their structure, like the
+// config and metadata files dictionaries are meant for
+func jsonSamples(n int) [][]byte {
+	rng := rand.New(rand.NewSource(3))
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(`{"id": %d, "name": "user-%d", "email": "user%d@example.com", "roles": ["reader", "writer"], "settings": {"theme": "dark", "notifications": %t, "language": "en-US", "timezone": "Europe/Berlin"}, "created_at": "2025-0%d-1%dT10:00:00Z"}`,
+			rng.Intn(100000), rng.Intn(1000), rng.Intn(1000), rng.Intn(2) == 0, 1+rng.Intn(9), rng.Intn(10)))
+	}
+	return samples
+}
+
+func TestTrainDictionary(t *testing.T) {
+	samples := jsonSamples(200)
+	dict, err := TrainDictionary(samples, 16*1024, 0x12345678)
+	if err != nil {
+		t.Fatalf("TrainDictionary() error: %v", err)
+	}
+	if id, err := DictionaryID(dict); err != nil || id != 0x12345678 {
+		t.Fatalf("DictionaryID() = %x, %v", id, err)
+	}
+
+	var plain, withDict int
+	for _, sample := range samples[:20] {
+		compressed, err := CompressWithDictionary(sample, 0, dict)
+		if err != nil {
+			t.Fatalf("CompressWithDictionary() error: %v", err)
+		}
+		got, err := DecompressWithDictionary(compressed, dict)
+		if err != nil {
+			t.Fatalf("DecompressWithDictionary() error: %v", err)
+		}
+		if !bytes.Equal(got, sample) {
+			t.Fatal("DecompressWithDictionary() returned different data")
+		}
+		alone, _ := CompressDataLevel(sample, "zstd", 0)
+		plain += len(alone)
+		withDict += len(compressed)
+	}
+	if withDict*2 > plain {
+		t.Errorf("dictionary compressed to %d bytes, zstd alone to %d; expected at least half", withDict, plain)
+	}
+
+	bomb, err := CompressWithDictionary(make([]byte, 1<<20), 0, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecompressWithDictionaryLimit(bomb, dict, 1024); !errors.Is(err, ErrDecompressionBomb) {
+		t.Errorf("DecompressWithDictionaryLimit() over the limit = %v, want ErrDecompressionBomb", err)
+	}
+}
+
+func TestTrainDictionaryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples [][]byte
+	}{
+		{name: "too few samples", samples: jsonSamples(MinDictionarySamples - 1)},
+		{name: "nothing in common", samples: [][]byte{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := TrainDictionary(tt.samples, 16*1024, 0x12345678); err == nil {
+				t.Error("TrainDictionary() succeeded, want an error")
+			}
+		})
+	}
+
+	dict, err := TrainDictionary(jsonSamples(50), 16*1024, 0x12345678)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := TrainDictionary(jsonSamples(50), 16*1024, 0x23456789)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, _ := CompressWithDictionary([]byte(`{"id": 1, "name": "user-1"}`), 0, dict)
+	if _, err := DecompressWithDictionary(compressed, other); err == nil {
+		t.Error("DecompressWithDictionary() with the wrong dictionary succeeded")
+	}
+}
@@ -0,0 +1,347 @@
+package compression
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// LZ4 frame format (https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md).
+// Frames are written with independent 4MB blocks, the content size and a
+// content checksum, so `lz4 -d` can read a chunk taken out of an unencrypted
+// vault. The block compressor is the greedy single-probe matcher of the
+// reference "fast" mode: it trades ratio for speed, which is the point of lz4.
+const (
+	lz4Magic          = 0x184D2204
+	lz4Version        = 0x40 // FLG version 01
+	lz4FlagBlockIndep = 0x20
+	lz4FlagBlockSum   = 0x10
+	lz4FlagSize       = 0x08
+	lz4FlagSum        = 0x04
+	lz4FlagDictID     = 0x01
+	lz4BlockMaxID     = 7 // 4MB blocks
+	lz4Uncompressed   = 0x80000000
+
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5  // The last five bytes of a block are always literals
+	lz4MFLimit      = 12 // A match cannot start within the last twelve bytes
+	lz4MaxOffset    = 65535
+	lz4HashLog      = 14
+	lz4SkipTrigger  = 6 // Probe less often the longer no match is found
+)
+
+var errLZ4Corrupt = errors.New("corrupt lz4 data")
+
+// lz4BlockSize returns the maximum block size for a BD block size ID
+func lz4BlockSize(id int) int {
+	return 1 << (8 + 2*id)
+}
+
+// compressLZ4 encodes data as a single LZ4 frame
+func compressLZ4(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/255+32)
+	out = binary.LittleEndian.AppendUint32(out, lz4Magic)
+	out = append(out, lz4Version|lz4FlagBlockIndep|lz4FlagSize|lz4FlagSum, lz4BlockMaxID<<4)
+	out = binary.LittleEndian.AppendUint64(out, uint64(len(data)))
+	out = append(out, byte(xxh32(out[4:], 0)>>8))
+
+	blockSize := lz4BlockSize(lz4BlockMaxID)
+	table := make([]int32, 1<<lz4HashLog)
+	for start := 0; start < len(data); start += blockSize {
+		block := data[start:min(len(data), start+blockSize)]
+		sizeAt := len(out)
+		out = append(out, 0, 0, 0, 0)
+		clear(table)
+		out = compressLZ4Block(out, block, table)
+		if n := len(out) - sizeAt - 4; n < len(block) {
+			binary.LittleEndian.PutUint32(out[sizeAt:], uint32(n))
+		} else {
+			out = binary.LittleEndian.AppendUint32(out[:sizeAt], uint32(len(block))|lz4Uncompressed)
+			out = append(out, block...)
+		}
+	}
+	out = binary.LittleEndian.AppendUint32(out, 0) // EndMark
+	return binary.LittleEndian.AppendUint32(out, xxh32(data, 0))
+}
+
+// compressLZ4Block appends the LZ4 block encoding of src to dst. table holds
+// the last position+1 seen for each hash and must be zeroed.
+func compressLZ4Block(dst, src []byte, table []int32) []byte {
+	anchor := 0
+	for i := 0; i+lz4MFLimit <= len(src); {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate > lz4MaxOffset || binary.LittleEndian.Uint32(src[candidate:]) != seq {
+			i += 1 + (i-anchor)>>lz4SkipTrigger
+			continue
+		}
+		for i > anchor && candidate > 0 && src[i-1] == src[candidate-1] {
+			i--
+			candidate--
+		}
+		end := i + lz4MinMatch
+		for limit := len(src) - lz4LastLiterals; end < limit; {
+			if end+8 <= limit {
+				diff := binary.LittleEndian.Uint64(src[end:]) ^ binary.LittleEndian.Uint64(src[candidate+end-i:])
+				if diff == 0 {
+					end += 8
+					continue
+				}
+				end += bits.TrailingZeros64(diff) / 8
+				break
+			}
+			if src[end] != src[candidate+end-i] {
+				break
+			}
+			end++
+		}
+		dst = appendLZ4Sequence(dst, src[anchor:i], i-candidate, end-i)
+		anchor = end
+		i = end
+	}
+	return appendLZ4Sequence(dst, src[anchor:], 0, 0)
+}
+
+// appendLZ4Sequence appends literals followed by a match; the last sequence of
+// a block has no match (matchLen 0)
+func appendLZ4Sequence(dst, literals []byte, offset, matchLen int) []byte {
+	token := byte(min(len(literals), 15)) << 4
+	if matchLen > 0 {
+		token |= byte(min(matchLen-lz4MinMatch, 15))
+	}
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = appendLZ4Length(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if matchLen-lz4MinMatch >= 15 {
+		dst = appendLZ4Length(dst, matchLen-lz4MinMatch-15)
+	}
+	return dst
+}
+
+func appendLZ4Length(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// decompressLZ4 decodes a single LZ4 frame, refusing to produce more than limit
+// bytes. Linked blocks, block checksums and a missing content size or checksum
+// are accepted so frames written by the lz4 tool decode too.
+func decompressLZ4(data []byte, limit int) ([]byte, error) {
+	if len(data) < 7 || binary.LittleEndian.Uint32(data) != lz4Magic {
+		return nil, fmt.Errorf("not an lz4 frame")
+	}
+	flg, bd := data[4], data[5]
+	if flg&0xC0 != lz4Version {
+		return nil, fmt.Errorf("unsupported lz4 frame version")
+	}
+	if flg&lz4FlagDictID != 0 {
+		return nil, fmt.Errorf("lz4 frames with a dictionary are not supported")
+	}
+	blockID := int(bd>>4) & 7
+	if blockID < 4 {
+		return nil, errLZ4Corrupt
+	}
+	blockSize := lz4BlockSize(blockID)
+
+	pos := 6
+	contentSize := -1
+	if flg&lz4FlagSize != 0 {
+		if len(data) < pos+9 {
+			return nil, errLZ4Corrupt
+		}
+		size := binary.LittleEndian.Uint64(data[pos:])
+		if size > uint64(limit) {
+			return nil, ErrDecompressionBomb
+		}
+		contentSize = int(size)
+		pos += 8
+	}
+	if len(data) <= pos || data[pos] != byte(xxh32(data[4:pos], 0)>>8) {
+		return nil, fmt.Errorf("lz4 frame header checksum mismatch")
+	}
+	pos++
+
+	out := make([]byte, 0, max(contentSize, 0))
+	for {
+		if len(data) < pos+4 {
+			return nil, errLZ4Corrupt
+		}
+		word := binary.LittleEndian.Uint32(data[pos:])
+		pos += 4
+		if word == 0 {
+			break
+		}
+		size := int(word &^ lz4Uncompressed)
+		if size > blockSize || len(data) < pos+size {
+			return nil, errLZ4Corrupt
+		}
+		block := data[pos : pos+size]
+		pos += size
+		if flg&lz4FlagBlockSum != 0 {
+			if len(data) < pos+4 || binary.LittleEndian.Uint32(data[pos:]) != xxh32(block, 0) {
+				return nil, fmt.Errorf("lz4 block checksum mismatch")
+			}
+			pos += 4
+		}
+
+		if word&lz4Uncompressed != 0 {
+			if len(out)+size > limit {
+				return nil, ErrDecompressionBomb
+			}
+			out = append(out, block...)
+			continue
+		}
+		blockEnd := len(out) + blockSize
+		decoded, err := decompressLZ4Block(out, block, min(limit, blockEnd))
+		if err == ErrDecompressionBomb && blockEnd < limit {
+			err = errLZ4Corrupt // The block decodes to more than a block
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = decoded
+	}
+	if flg&lz4FlagSum != 0 {
+		if len(data) < pos+4 || binary.LittleEndian.Uint32(data[pos:]) != xxh32(out, 0) {
+			return nil, fmt.Errorf("lz4 content checksum mismatch")
+		}
+		pos += 4
+	}
+	if contentSize >= 0 && len(out) != contentSize {
+		return nil, errLZ4Corrupt
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("unexpected data after lz4 frame")
+	}
+	return out, nil
+}
+
+// decompressLZ4Block appends the decoded block to dst. Matches may reach back
+// into earlier blocks already in dst. limit caps len(dst).
+func decompressLZ4Block(dst, src []byte, limit int) ([]byte, error) {
+	for i := 0; ; {
+		if i >= len(src) {
+			return nil, errLZ4Corrupt
+		}
+		token := src[i]
+		i++
+
+		literals := int(token >> 4)
+		if literals == 15 {
+			n, next, err := readLZ4Length(src, i)
+			if err != nil {
+				return nil, err
+			}
+			literals += n
+			i = next
+		}
+		if literals > len(src)-i {
+			return nil, errLZ4Corrupt
+		}
+		if literals > limit-len(dst) {
+			return nil, ErrDecompressionBomb
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			return dst, nil
+		}
+
+		if len(src)-i < 2 {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZ4Corrupt
+		}
+		matchLen := int(token&15) + lz4MinMatch
+		if token&15 == 15 {
+			n, next, err := readLZ4Length(src, i)
+			if err != nil {
+				return nil, err
+			}
+			matchLen += n
+			i = next
+		}
+		if matchLen > limit-len(dst) {
+			return nil, ErrDecompressionBomb
+		}
+		// An overlapping match repeats its last offset bytes, so it is copied in
+		// pieces that double as the output grows
+		for start := len(dst) - offset; matchLen > 0; {
+			n := min(len(dst)-start, matchLen)
+			dst = append(dst, dst[start:start+n]...)
+			matchLen -= n
+		}
+	}
+}
+
+// readLZ4Length reads the extra bytes of a literal or match length
+func readLZ4Length(src []byte, i int) (int, int, error) {
+	n := 0
+	for {
+		if i >= len(src) {
+			return 0, 0, errLZ4Corrupt
+		}
+		b := src[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return n, i, nil
+		}
+	}
+}
+
+// xxh32 is the 32-bit xxHash the LZ4 frame format uses for its checksums
+func xxh32(data []byte, seed uint32) uint32 {
+	const (
+		prime1 uint32 = 2654435761
+		prime2 uint32 = 2246822519
+		prime3 uint32 = 3266489917
+		prime4 uint32 = 668265263
+		prime5 uint32 = 374761393
+	)
+	round := func(acc, lane uint32) uint32 {
+		return bits.RotateLeft32(acc+lane*prime2, 13) * prime1
+	}
+
+	n := len(data)
+	var h uint32
+	if n >= 16 {
+		v1, v2, v3, v4 := seed+prime1+prime2, seed+prime2, seed, seed-prime1
+		for ; len(data) >= 16; data = data[16:] {
+			v1 = round(v1, binary.LittleEndian.Uint32(data[0:]))
+			v2 = round(v2, binary.LittleEndian.Uint32(data[4:]))
+			v3 = round(v3, binary.LittleEndian.Uint32(data[8:]))
+			v4 = round(v4, binary.LittleEndian.Uint32(data[12:]))
+		}
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) + bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = seed + prime5
+	}
+	h += uint32(n)
+	for ; len(data) >= 4; data = data[4:] {
+		h = bits.RotateLeft32(h+binary.LittleEndian.Uint32(data)*prime3, 17) * prime4
+	}
+	for _, b := range data {
+		h = bits.RotateLeft32(h+uint32(b)*prime5, 11) * prime1
+	}
+	h ^= h >> 15
+	h *= prime2
+	h ^= h >> 13
+	h *= prime3
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,183 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+func TestXXH32(t *testing.T) {
+	tests := []struct {
+		data string
+		seed uint32
+		want uint32
+	}{
+		{"", 0, 0x02CC5D05},
+		{"a", 0, 0x550D7456},
+		{"abc", 0, 0x32D153FF},
+		{"Nobody inspects the spammish repetition", 0, 0xE2293B2F},
+	}
+	for _, tt := range tests {
+		if got := xxh32([]byte(tt.data), tt.seed); got != tt.want {
+			t.Errorf("xxh32(%q) = %08x, want %08x", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestLZ4RoundTrip(t *testing.T) {
+	random := make([]byte, 100*1024)
+	rand.New(rand.NewSource(3)).Read(random)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"shorter than a match", []byte("abcdefghijk")},
+		{"run", bytes.Repeat([]byte{'x'}, 100000)},
+		{"short period", bytes.Repeat([]byte("abc"), 50000)},
+		{"text", textCorpus(300 * 1024)},
+		{"random", random},
+		{"several blocks", textCorpus(9 * 1024 * 1024)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed := compressLZ4(tt.data)
+			decompressed, err := decompressLZ4(compressed, constants.MaxDecompressionSize)
+			if err != nil {
+				t.Fatalf("decompressLZ4() error: %v", err)
+			}
+			if !bytes.Equal(decompressed, tt.data) {
+				t.Fatal("round trip changed the data")
+			}
+			if tt.name == "random" && len(compressed) > len(tt.data)+32 {
+				t.Errorf("incompressible data grew to %d bytes", len(compressed))
+			}
+		})
+	}
+}
+
+func TestLZ4RejectsDamagedFrames(t *testing.T) {
+	data := textCorpus(64 * 1024)
+	frame := compressLZ4(data)
+
+	flipped := bytes.Clone(frame)
+	flipped[len(flipped)/2] ^= 0x01
+	if _, err := decompressLZ4(flipped, constants.MaxDecompressionSize); err == nil {
+		t.Error("decompressLZ4() accepted a damaged frame")
+	}
+	if _, err := decompressLZ4(frame[:len(frame)-6], constants.MaxDecompressionSize); err == nil {
+		t.Error("decompressLZ4() accepted a truncated frame")
+	}
+	if _, err := decompressLZ4(append(bytes.Clone(frame), 0), constants.MaxDecompressionSize); err == nil {
+		t.Error("decompressLZ4() accepted trailing data")
+	}
+
+	// A frame declaring more content than the limit is refused before decoding
+	if _, err := decompressLZ4(frame, len(data)-1); !errors.Is(err, ErrDecompressionBomb) {
+		t.Errorf("decompressLZ4() over the limit = %v, want ErrDecompressionBomb", err)
+	}
+	// Without a declared size the limit applies while decoding
+	bomb := binary.LittleEndian.AppendUint32(nil, lz4Magic)
+	bomb = append(bomb, lz4Version|lz4FlagBlockIndep, lz4BlockMaxID<<4)
+	bomb = append(bomb, byte(xxh32(bomb[4:], 0)>>8))
+	block := appendLZ4Sequence(nil, []byte("x"), 1, 1000000)
+	block = appendLZ4Sequence(block, []byte("xxxxx"), 0, 0)
+	bomb = binary.LittleEndian.AppendUint32(bomb, uint32(len(block)))
+	bomb = append(bomb, block...)
+	bomb = binary.LittleEndian.AppendUint32(bomb, 0)
+	if out, err := decompressLZ4(bomb, constants.MaxDecompressionSize); err != nil || len(out) != 1000006 {
+		t.Fatalf("decompressLZ4() of a hand built frame = %d bytes, %v", len(out), err)
+	}
+	if _, err := decompressLZ4(bomb, 4096); !errors.Is(err, ErrDecompressionBomb) {
+		t.Errorf("decompressLZ4() over the limit = %v, want ErrDecompressionBomb", err)
+	}
+}
+
+// lz4Vector is the text the reference lz4 frames below decode to
+func lz4Vector() []byte {
+	var b bytes.Buffer
+	for i := range 40 {
+		fmt.Fprintf(&b, "line %d of the lz4 reference vector, repeated so the frame has matches\n", i%7)
+	}
+	return b.Bytes()
+}
+
+// TestLZ4DecodesReferenceFrames decodes frames written by the lz4 v1.9.4
+// command line tool
+func TestLZ4DecodesReferenceFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+	}{
+		{
+			// lz4 -c: content size and content checksum
+			name: "default",
+			frame: `BCJNGGxA8AoAAAAAAAD2eQAAAPEgbGluZSAwIG9mIHRoZSBsejQgcmVmZXJlbmNlIHZlY3Rvciwg
+cmVwZWF0ZWQgc28mAPEDZnJhbWUgaGFzIG1hdGNoZXMKRgAfMUYAMh8yRgAyHzNGADIfNEYAMh81
+RgAyHzZGADIP6gH///////////FQY2hlcwoAAAAAC9JpOA==`,
+		},
+		{
+			// lz4 -c -BX: block checksums, no content size
+			name: "block checksums",
+			frame: `BCJNGHRAvXkAAADxIGxpbmUgMCBvZiB0aGUgbHo0IHJlZmVyZW5jZSB2ZWN0b3IsIHJlcGVhdGVk
+IHNvJgDxA2ZyYW1lIGhhcyBtYXRjaGVzCkYAHzFGADIfMkYAMh8zRgAyHzRGADIfNUYAMh82RgAy
+D+oB///////////xUGNoZXMK1Q5uhwAAAAAL0mk4`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(tt.frame, "\n", ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decompressLZ4(frame, constants.MaxDecompressionSize)
+			if err != nil {
+				t.Fatalf("decompressLZ4() error: %v", err)
+			}
+			if !bytes.Equal(got, lz4Vector()) {
+				t.Errorf("decompressLZ4() = %q", got)
+			}
+		})
+	}
+}
+
+// TestLZ4ReferenceDecodes checks that `lz4 -d` reads the frames written
+// here. It needs the lz4 tool on the PATH.
+func TestLZ4ReferenceDecodes(t *testing.T) {
+	lz4CLI, err := exec.LookPath("lz4")
+	if err != nil {
+		t.Skip("lz4 is not installed")
+	}
+	random := make([]byte, 100*1024)
+	rand.New(rand.NewSource(5)).Read(random)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"vector", lz4Vector()},
+		{"random", random},
+		{"several blocks", textCorpus(9 * 1024 * 1024)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(lz4CLI, "-d", "-c")
+			cmd.Stdin = bytes.NewReader(compressLZ4(tt.data))
+			got, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("lz4 -d: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("lz4 -d returned %d bytes, want %d", len(got), len(tt.data))
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/validate"
+)
+
+// warnedSources records the documents already warned about, so a file read
+// several times by one command warns once
+var warnedSources sync.Map
+
+// decodeChecked unmarshals a YAML document into out, a pointer to the struct
+// it holds. When it does not decode, each offending field is reported by its
+// path instead of yaml's own message. With checkUnknown, keys out has no field
+// for are warned about once per source, or refused when validation is strict.
+func decodeChecked(source string, data []byte, out interface{}, checkUnknown bool) error {
+	decodeErr := yaml.Unmarshal(data, out)
+	if decodeErr == nil && !checkUnknown {
+		return nil
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	var issues []validate.Issue
+	for _, issue := range validate.Check(doc, reflect.TypeOf(out).Elem(), "yaml") {
+		if checkUnknown || !issue.Unknown {
+			issues = append(issues, issue)
+		}
+	}
+	errs, warnings := validate.Split(issues)
+	if len(errs) > 0 {
+		return &validate.Error{Source: source, Issues: errs}
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if _, warned := warnedSources.LoadOrStore(source, true); !warned {
+		for _, issue := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", source, issue)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/validate"
+)
+
+func TestDecodeChecked(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		checkUnknown bool
+		strict       bool
+		wantErr      string // Substring of the error; empty for none
+	}{
+		{"valid", "name: v\ncompression: zstd\n", true, false, ""},
+		{"unknown key warns", "name: v\ncompresion: zstd\n", true, false, ""},
+		{"unknown key is refused when strict", "name: v\ncompresion: zstd\n", true, true, `compresion: unknown field (did you mean "compression"?)`},
+		{"unknown keys not looked for", "name: v\ncompresion: zstd\n", false, true, ""},
+		{"wrong type", "compression_level: high\ndeduplication:\n  enabled: maybe\n", false, false,
+			"compression_level: expected a whole number, got \"high\"\n  - deduplication.enabled: expected true or false, got \"maybe\""},
+	}
+	defer validate.SetStrict(false)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validate.SetStrict(tt.strict)
+			var config VaultConfig
+			err := decodeChecked("vault.yaml", []byte(tt.data), &config, tt.checkUnknown)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("decodeChecked() error: %v", err)
+				}
+				return
+			}
+			var invalid *validate.Error
+			if !errors.As(err, &invalid) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("decodeChecked() error = %v, want a validate.Error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFileManifestReportsFieldPaths(t *testing.T) {
+	manifestsDir := filepath.Join(t.TempDir(), ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(manifestsDir, "docs.a.txt.yaml")
+	if err := os.WriteFile(path, []byte("file: a.txt\nsize: big\nchunks:\n  - hash: ab12\n    size: 4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadFileManifest(path)
+	if err == nil || !strings.Contains(err.Error(), `size: expected a whole number, got "big"`) {
+		t.Errorf("loadFileManifest() error = %v, want the size field named", err)
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// How a vault adopts a setting it differs in
+const (
+	MigrateInPlace   = "in-place"  // 'sietch config set' changes it; files added afterwards follow
+	MigrateRechunk   = "rechunk"   // 'sietch vault rechunk' rewrites the stored files under it
+	MigrateReencrypt = "reencrypt" // Only a new vault can have it; the files are moved over
+	MigrateManual    = "manual"    // Edited in vault.yaml; files added afterwards follow
+)
+
+// SettingChange is a setting in which a vault differs from a template or
+// another vault
+type SettingChange struct {
+	Key       string `json:"key"`
+	Section   string `json:"section"`
+	Value     any    `json:"value"` // In this vault
+	Other     any    `json:"other"` // In the template or vault compared with
+	Migration string `json:"migration"`
+	Hint      string `json:"hint,omitempty"` // How to adopt the other value
+}
+
+// TemplateDiffKeys are the settings a template decides
+var TemplateDiffKeys = []string{
+	"chunking.strategy", "chunking.chunk_size", "chunking.hash_algorithm", "chunking.policies",
+	"compression", "compression_level", "compression_policies",
+	"deduplication.enabled", "deduplication.strategy", "deduplication.min_chunk_size",
+	"deduplication.max_chunk_size", "deduplication.gc_threshold", "deduplication.index_enabled",
+	"sync.mode",
+	"encryption.type",
+}
+
+// VaultDiffKeys are the settings compared between two vaults: those of a
+// template and the ones only 'config set' and init options change
+var VaultDiffKeys = append(append([]string{}, TemplateDiffKeys...),
+	"chunking.whole_file", "chunking.max_chunks_per_file",
+	"compression_min_savings",
+	"deduplication.scopes",
+	"packing.enabled", "packing.chunks", "packing.threshold", "packing.max_pack_size",
+	"sync.enabled", "sync.auto_sync", "sync.sync_interval",
+)
+
+// diffSections is the order in which DiffSettings groups the changes
+var diffSections = []string{"chunking", "compression", "deduplication", "packing", "sync", "encryption"}
+
+// rechunkFlags are the 'sietch vault rechunk' flags for the settings it changes
+var rechunkFlags = map[string]string{
+	"chunking.strategy":       "--strategy",
+	"chunking.chunk_size":     "--chunk-size",
+	"chunking.hash_algorithm": "--hash-algorithm",
+}
+
+// sizeSettings are compared by the size they stand for, so 4MB equals 4096KB
+var sizeSettings = map[string]bool{
+	"chunking.chunk_size":          true,
+	"deduplication.min_chunk_size": true,
+	"deduplication.max_chunk_size": true,
+	"packing.threshold":            true,
+	"packing.max_pack_size":        true,
+}
+
+// DiffSettings lists the keys in which vault differs from other, grouped by
+// section, with how vault can adopt other's value
+func DiffSettings(vault, other *VaultConfig, keys []string) ([]SettingChange, error) {
+	var changes []SettingChange
+	for _, key := range keys {
+		value, err := GetSetting(vault, key)
+		if err != nil {
+			return nil, err
+		}
+		otherValue, err := GetSetting(other, key)
+		if err != nil {
+			return nil, err
+		}
+		if sameSetting(key, value, otherValue) {
+			continue
+		}
+		change := SettingChange{Key: key, Section: settingSection(key), Migration: migrationFor(key)}
+		if change.Value, err = GetSettingValue(vault, key); err != nil {
+			return nil, err
+		}
+		if change.Other, err = GetSettingValue(other, key); err != nil {
+			return nil, err
+		}
+		change.Hint = migrationHint(key, change.Migration, otherValue)
+		changes = append(changes, change)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return slices.Index(diffSections, changes[i].Section) < slices.Index(diffSections, changes[j].Section)
+	})
+	return changes, nil
+}
+
+// sameSetting reports whether two formatted values of key mean the same
+func sameSetting(key, a, b string) bool {
+	if a == b {
+		return true
+	}
+	if sizeSettings[key] {
+		sizeA, errA := util.ParseChunkSize(a)
+		sizeB, errB := util.ParseChunkSize(b)
+		return errA == nil && errB == nil && sizeA == sizeB
+	}
+	if key == "deduplication.strategy" {
+		return dedupStrategyOrDefault(a) == dedupStrategyOrDefault(b)
+	}
+	return false
+}
+
+func dedupStrategyOrDefault(strategy string) string {
+	if strategy == "" {
+		return constants.DedupStrategyContent
+	}
+	return strategy
+}
+
+// settingSection groups a key under its vault.yaml section
+func settingSection(key string) string {
+	if strings.HasPrefix(key, "compression") {
+		return "compression"
+	}
+	section, _, _ := strings.Cut(key, ".")
+	return section
+}
+
+// migrationFor returns how a vault holding data adopts another value of key
+func migrationFor(key string) string {
+	if strings.HasPrefix(key, "encryption.") {
+		return MigrateReencrypt
+	}
+	rule, ok := settableSettings[key]
+	switch {
+	case !ok:
+		return MigrateManual
+	case rule.needsEmptyVault != "":
+		return MigrateRechunk
+	default:
+		return MigrateInPlace
+	}
+}
+
+// migrationHint names the command that adopts value for key
+func migrationHint(key, migration, value string) string {
+	switch migration {
+	case MigrateInPlace:
+		hint := fmt.Sprintf("sietch config set %s %s", key, quoteSetting(value))
+		if key == "compression" || key == "compression_level" {
+			hint += ", then 'sietch vault recompress' to rewrite stored chunks"
+		}
+		return hint
+	case MigrateRechunk:
+		return fmt.Sprintf("sietch vault rechunk %s %s", rechunkFlags[key], quoteSetting(value))
+	case MigrateReencrypt:
+		return "create a vault with the other encryption and move the files over with 'sietch sneak'"
+	default:
+		return fmt.Sprintf("edit %s in vault.yaml", key)
+	}
+}
+
+// quoteSetting quotes a value for the shell when it is empty or has spaces
+func quoteSetting(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t'\"*") {
+		return fmt.Sprintf("%q", value)
+	}
+	return value
+}
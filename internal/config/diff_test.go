@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestDiffSettings(t *testing.T) {
+	vault := &VaultConfig{Compression: "none"}
+	vault.Chunking.Strategy = "cdc"
+	vault.Chunking.ChunkSize = "4MB"
+	vault.Chunking.Policies = []ChunkPolicy{{Pattern: "*.mp4", ChunkSize: "16MB"}}
+	vault.Deduplication.MinChunkSize = "1KB"
+	vault.Encryption.Type = "aes"
+
+	other := &VaultConfig{Compression: "gzip", Sync: SyncConfig{Mode: "manual"}}
+	other.Chunking.Strategy = "cdc"
+	other.Chunking.ChunkSize = "8MB"
+	other.Deduplication.MinChunkSize = "1024B"
+	other.Deduplication.Strategy = "content"
+	other.Encryption.Type = "none"
+
+	changes, err := DiffSettings(vault, other, TemplateDiffKeys)
+	if err != nil {
+		t.Fatalf("DiffSettings() error = %v", err)
+	}
+
+	want := []struct {
+		key       string
+		migration string
+		hint      string
+	}{
+		{"chunking.chunk_size", MigrateRechunk, "sietch vault rechunk --chunk-size 8MB"},
+		{"chunking.policies", MigrateManual, "edit chunking.policies in vault.yaml"},
+		{"compression", MigrateInPlace, "sietch config set compression gzip, then 'sietch vault recompress' to rewrite stored chunks"},
+		{"sync.mode", MigrateManual, "edit sync.mode in vault.yaml"},
+		{"encryption.type", MigrateReencrypt, ""},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("DiffSettings() = %+v; want %d changes", changes, len(want))
+	}
+	for i, w := range want {
+		got := changes[i]
+		if got.Key != w.key || got.Migration != w.migration {
+			t.Errorf("change %d = %s (%s); want %s (%s)", i, got.Key, got.Migration, w.key, w.migration)
+		}
+		if w.hint != "" && got.Hint != w.hint {
+			t.Errorf("%s hint = %q; want %q", got.Key, got.Hint, w.hint)
+		}
+	}
+	if changes[0].Section != "chunking" || changes[4].Section != "encryption" {
+		t.Errorf("sections = %q, %q; want chunking, encryption", changes[0].Section, changes[4].Section)
+	}
+}
+
+func TestDiffSettingsSame(t *testing.T) {
+	vault := &VaultConfig{}
+	vault.Chunking.ChunkSize = "4MB"
+	other := &VaultConfig{}
+	other.Chunking.ChunkSize = "4096KB"
+	other.Deduplication.Strategy = "content"
+
+	changes, err := DiffSettings(vault, other, VaultDiffKeys)
+	if err != nil {
+		t.Fatalf("DiffSettings() error = %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("DiffSettings() = %+v; want no changes", changes)
+	}
+}
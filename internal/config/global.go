@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/validate"
+)
+
+// GlobalConfig holds the user's defaults for command flags, kept in
+// ~/.config/sietch/config.yaml. A flag given on the command line wins over its
+// SIETCH_* environment variable, which wins over this file.
+type GlobalConfig struct {
+	Vault            string `yaml:"vault,omitempty"`              // Vault used when --vault is not given
+	PassphraseFile   string `yaml:"passphrase_file,omitempty"`    // File read when --passphrase-file is not given
+	Jobs             int    `yaml:"jobs,omitempty"`               // Default for --jobs
+	DefaultVaultPath string `yaml:"default_vault_path,omitempty"` // Directory new vaults are created in
+	Author           string `yaml:"author,omitempty"`             // Author recorded in new vaults
+	Cipher           string `yaml:"cipher,omitempty"`             // Encryption of new vaults
+	Compression      string `yaml:"compression,omitempty"`        // Compression of new vaults
+}
+
+// globalSettings are the keys of the global config with their validation
+var globalSettings = map[string]func(value string) error{
+	"vault":              nil,
+	"passphrase_file":    nil,
+	"jobs":               positiveInt,
+	"default_vault_path": nil,
+	"author":             nil,
+	"cipher": oneOf(constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20,
+		constants.EncryptionTypeGPG, constants.EncryptionTypeNone),
+	"compression": oneOf(compression.Algorithms...),
+}
+
+// globalPathSettings are the keys of the global config that hold a path
+var globalPathSettings = map[string]bool{
+	"vault":              true,
+	"passphrase_file":    true,
+	"default_vault_path": true,
+}
+
+// GlobalSettingKeys returns the keys of the global config, sorted
+func GlobalSettingKeys() []string {
+	keys := make([]string, 0, len(globalSettings))
+	for key := range globalSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GlobalConfigPath returns the path of the global config file
+func GlobalConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".config", "sietch", "config.yaml"), nil
+}
+
+// LoadGlobalConfig reads the global config; a missing file is an empty config
+func LoadGlobalConfig() (*GlobalConfig, error) {
+	path, err := GlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	config := &GlobalConfig{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// SaveGlobalConfig writes the global config, creating its directory if needed
+func SaveGlobalConfig(config *GlobalConfig) error {
+	path, err := GlobalConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(config); err != nil {
+		return fmt.Errorf("failed to encode global config: %v", err)
+	}
+	return atomic.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// GetGlobalSetting returns a global config value, empty when unset
+func GetGlobalSetting(config *GlobalConfig, key string) (string, error) {
+	key = CanonicalSettingKey(key)
+	if _, ok := globalSettings[key]; !ok {
+		return "", unknownGlobalSetting(key)
+	}
+	field, err := lookupSetting(reflect.ValueOf(config).Elem(), key)
+	if err != nil {
+		return "", err
+	}
+	if field.IsZero() {
+		return "", nil
+	}
+	return formatSetting(field)
+}
+
+// SetGlobalSetting changes a global config value; an empty value unsets it.
+// Relative paths and paths under ~ are made absolute, so they hold from any
+// directory, except a vault given by its registered name. The caller saves the
+// configuration.
+func SetGlobalSetting(config *GlobalConfig, key, value string) error {
+	key = CanonicalSettingKey(key)
+	validate, ok := globalSettings[key]
+	if !ok {
+		return unknownGlobalSetting(key)
+	}
+	field, err := lookupSetting(reflect.ValueOf(config).Elem(), key)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if validate != nil {
+		if err := validate(value); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+	}
+	if globalPathSettings[key] && !registeredVaultName(key, value) {
+		if value, err = absSettingPath(value); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+	}
+	if err := parseSetting(field, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	return nil
+}
+
+// registeredVaultName reports whether value is the registered name of a vault
+// given for the vault key
+func registeredVaultName(key, value string) bool {
+	if key != "vault" || !IsRegistryName(value) {
+		return false
+	}
+	registry, err := LoadRegistry()
+	if err != nil {
+		return false
+	}
+	_, ok := registry.Lookup(value)
+	return ok
+}
+
+// unknownGlobalSetting returns ErrUnknownSetting for a key the global config
+// does not have, with the key it is closest to or else the ones it has
+func unknownGlobalSetting(key string) error {
+	keys := GlobalSettingKeys()
+	if validate.Suggest(key, keys) != "" {
+		return unknownSetting(key, keys)
+	}
+	return fmt.Errorf("%w: %s (global settings: %s)", ErrUnknownSetting, key, strings.Join(keys, ", "))
+}
+
+// absSettingPath makes a path absolute, expanding a leading ~ to the home
+// directory
+func absSettingPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(homeDir, path[1:])
+	}
+	return filepath.Abs(path)
+}
+
+func positiveInt(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 {
+		return fmt.Errorf("expected a whole number of at least 1")
+	}
+	return nil
+}
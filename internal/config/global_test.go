@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobalSettings(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	global, err := LoadGlobalConfig()
+	if err != nil {
+		t.Fatalf("LoadGlobalConfig() without a file: %v", err)
+	}
+
+	if err := SetGlobalSetting(global, "jobs", "4"); err != nil {
+		t.Fatalf("SetGlobalSetting(jobs) error: %v", err)
+	}
+	if err := SetGlobalSetting(global, "passphraseFile", "pass.txt"); err != nil {
+		t.Fatalf("SetGlobalSetting(passphraseFile) error: %v", err)
+	}
+	if err := SetGlobalSetting(global, "jobs", "0"); err == nil {
+		t.Error("SetGlobalSetting(jobs=0) expected an error")
+	}
+	if err := SetGlobalSetting(global, "chunk_size", "4MB"); !errors.Is(err, ErrUnknownSetting) {
+		t.Errorf("SetGlobalSetting(chunk_size) error = %v, want ErrUnknownSetting", err)
+	}
+	if err := SetGlobalSetting(global, "compression", "zstd"); err != nil {
+		t.Fatalf("SetGlobalSetting(compression) error: %v", err)
+	}
+	if err := SetGlobalSetting(global, "cipher", "rot13"); err == nil {
+		t.Error("SetGlobalSetting(cipher=rot13) expected an error")
+	}
+	if err := SetGlobalSetting(global, "author", "Paul Atreides"); err != nil {
+		t.Fatalf("SetGlobalSetting(author) error: %v", err)
+	}
+	if err := SetGlobalSetting(global, "default_vault_path", "~/vaults"); err != nil {
+		t.Fatalf("SetGlobalSetting(default_vault_path) error: %v", err)
+	}
+	if err := SaveGlobalConfig(global); err != nil {
+		t.Fatalf("SaveGlobalConfig() error: %v", err)
+	}
+
+	loaded, err := LoadGlobalConfig()
+	if err != nil {
+		t.Fatalf("LoadGlobalConfig() error: %v", err)
+	}
+	if jobs, _ := GetGlobalSetting(loaded, "jobs"); jobs != "4" {
+		t.Errorf("jobs = %q, want 4", jobs)
+	}
+	// Relative paths are stored absolute
+	if path, _ := GetGlobalSetting(loaded, "passphrase_file"); !filepath.IsAbs(path) || filepath.Base(path) != "pass.txt" {
+		t.Errorf("passphrase_file = %q, want an absolute path to pass.txt", path)
+	}
+
+	// Only paths are made absolute, and ~ is the home directory
+	if author, _ := GetGlobalSetting(loaded, "author"); author != "Paul Atreides" {
+		t.Errorf("author = %q, want Paul Atreides", author)
+	}
+	if path, _ := GetGlobalSetting(loaded, "default_vault_path"); path != filepath.Join(os.Getenv("HOME"), "vaults") {
+		t.Errorf("default_vault_path = %q, want ~/vaults expanded", path)
+	}
+
+	if err := SetGlobalSetting(loaded, "jobs", ""); err != nil {
+		t.Fatalf("unsetting jobs: %v", err)
+	}
+	if jobs, _ := GetGlobalSetting(loaded, "jobs"); jobs != "" {
+		t.Errorf("jobs after unsetting = %q, want empty", jobs)
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Every change to vault.yaml is recorded in .sietch/history.jsonl, one JSON
+// object per line, so 'sietch vault history' can tell when a setting changed,
+// on which host and by which command. Only the newest history_limit entries
+// are kept.
+
+// HistoryCommand is the command recorded with configuration changes; the CLI
+// sets it before running a command
+var HistoryCommand string
+
+// HistoryEntry is one recorded change to the vault configuration
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host,omitempty"`
+	User    string    `json:"user,omitempty"`
+	Version string    `json:"version,omitempty"`
+	Command string    `json:"command,omitempty"`
+	Changes []string  `json:"changes"`
+}
+
+// HistoryPath returns the path of the vault's configuration history
+func HistoryPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "history.jsonl")
+}
+
+// LoadHistory returns the vault's configuration history, oldest first. A vault
+// without one has no history yet.
+func LoadHistory(vaultRoot string) ([]HistoryEntry, error) {
+	data, err := os.ReadFile(HistoryPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading vault history: %w", err)
+	}
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("error parsing vault history line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading vault history: %w", err)
+	}
+	return entries, nil
+}
+
+// AppendHistory records changes, stamped with the time, host, user, sietch
+// version and HistoryCommand, dropping the oldest entries beyond limit (0 =
+// the default limit)
+func AppendHistory(vaultRoot string, limit int, changes ...string) error {
+	if limit <= 0 {
+		limit = constants.DefaultHistoryLimit
+	}
+	entry := HistoryEntry{
+		Time:    time.Now().UTC(),
+		Version: sietchVersion(),
+		Command: HistoryCommand,
+		Changes: changes,
+	}
+	entry.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+
+	entries, err := LoadHistory(vaultRoot)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, entry)
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode vault history: %v", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(HistoryPath(vaultRoot)), constants.StandardDirPerms); err != nil {
+		return fmt.Errorf("failed to create .sietch directory: %v", err)
+	}
+	if err := atomic.WriteFile(HistoryPath(vaultRoot), buf.Bytes(), constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to write vault history: %v", err)
+	}
+	return nil
+}
+
+// RecordConfigChange appends the difference between the vault.yaml being
+// replaced (nil for a new vault) and config to the history. Failing to do so
+// only warns: the configuration itself is already saved.
+func RecordConfigChange(vaultRoot string, previous []byte, config *VaultConfig) {
+	var changes []string
+	if previous == nil {
+		changes = []string{fmt.Sprintf("created vault %s (encryption %s)", config.Name, config.Encryption.Type)}
+	} else {
+		var old VaultConfig
+		if err := yaml.Unmarshal(previous, &old); err != nil {
+			changes = []string{"replaced an unreadable vault.yaml"}
+		} else {
+			changes = ConfigChanges(&old, config)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	if err := AppendHistory(vaultRoot, config.HistoryLimit, changes...); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record the configuration change in the vault history: %v\n", err)
+	}
+}
+
+// ConfigChanges lists the settings that differ between two configurations as
+// "key: old → new". Secrets are left out; lists such as trusted peers are
+// reported by their number of entries.
+func ConfigChanges(old, current *VaultConfig) []string {
+	before, after := flattenConfig(old), flattenConfig(current)
+	keys := make(map[string]bool)
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	var changes []string
+	for key := range keys {
+		b, inBefore := before[key]
+		a, inAfter := after[key]
+		if inBefore && inAfter && b.compare == a.compare {
+			continue
+		}
+		from, to := "(unset)", "(unset)"
+		if inBefore {
+			from = b.display
+		}
+		if inAfter {
+			to = a.display
+		}
+		if from == to {
+			changes = append(changes, key+" changed")
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s → %s", key, from, to))
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// flatValue is a setting as compared and as shown
+type flatValue struct {
+	compare string
+	display string
+}
+
+// flattenConfig maps the dotted keys of config's public settings to their values
+func flattenConfig(config *VaultConfig) map[string]flatValue {
+	public, _ := SplitSecrets(config)
+	flat := make(map[string]flatValue)
+	data, err := yaml.Marshal(&public)
+	if err != nil {
+		return flat
+	}
+	var doc map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return flat
+	}
+	flattenInto(flat, "", doc)
+	return flat
+}
+
+func flattenInto(flat map[string]flatValue, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		for key, child := range v {
+			name := fmt.Sprint(key)
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			flattenInto(flat, name, child)
+		}
+	case []interface{}:
+		encoded, _ := yaml.Marshal(v)
+		display := fmt.Sprintf("%d entries", len(v))
+		if len(v) == 1 {
+			display = "1 entry"
+		}
+		flat[prefix] = flatValue{compare: string(encoded), display: display}
+	default:
+		display := fmt.Sprint(v)
+		if display == "" {
+			display = `""`
+		} else if len(display) > 60 {
+			display = display[:57] + "..."
+		}
+		flat[prefix] = flatValue{compare: fmt.Sprint(v), display: display}
+	}
+}
+
+// sietchVersion returns the version of the running sietch binary
+func sietchVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
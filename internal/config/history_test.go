@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigChanges(t *testing.T) {
+	old := secretVaultConfig()
+	current := secretVaultConfig()
+	current.Deduplication.Enabled = true
+	current.Encryption.AESConfig.Salt = "rotated-salt"
+	current.Sync.RSA.TrustedPeers = []TrustedPeer{{ID: "peer", Fingerprint: "fp", TrustedSince: time.Unix(0, 0)}}
+	current.Metadata.Author = "alice"
+
+	want := []string{
+		"deduplication.enabled: false → true",
+		`metadata.author: "" → alice`,
+		"sync.rsa.trusted_peers: (unset) → 1 entry",
+	}
+	if got := ConfigChanges(old, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigChanges() = %q, want %q", got, want)
+	}
+	if got := ConfigChanges(old, secretVaultConfig()); len(got) != 0 {
+		t.Errorf("ConfigChanges() of equal configurations = %q, want none", got)
+	}
+}
+
+func TestAppendHistoryKeepsNewest(t *testing.T) {
+	vaultRoot := t.TempDir()
+	HistoryCommand = "sietch config set"
+	defer func() { HistoryCommand = "" }()
+
+	for _, change := range []string{"one", "two", "three", "four"} {
+		if err := AppendHistory(vaultRoot, 3, change); err != nil {
+			t.Fatalf("AppendHistory() error: %v", err)
+		}
+	}
+
+	history, err := LoadHistory(vaultRoot)
+	if err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	var got []string
+	for _, entry := range history {
+		got = append(got, entry.Changes...)
+		if entry.Command != "sietch config set" || entry.Time.IsZero() || entry.Version == "" {
+			t.Errorf("entry = %+v, want command, time and version recorded", entry)
+		}
+	}
+	if want := []string{"two", "three", "four"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history changes = %q, want %q", got, want)
+	}
+}
+
+func TestSaveConfigRecordsHistory(t *testing.T) {
+	vaultRoot := t.TempDir()
+	cfg := secretVaultConfig()
+	if err := SaveVaultConfig(vaultRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Saving an unchanged configuration records nothing
+	if err := SaveVaultConfig(vaultRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Compression = "zstd"
+	if err := SaveVaultConfig(vaultRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := LoadHistory(vaultRoot)
+	if err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history = %+v, want creation and one change", history)
+	}
+	if want := []string{"created vault secretive (encryption aes)"}; !reflect.DeepEqual(history[0].Changes, want) {
+		t.Errorf("first entry = %q, want %q", history[0].Changes, want)
+	}
+	if want := []string{`compression: "" → zstd`}; !reflect.DeepEqual(history[1].Changes, want) {
+		t.Errorf("second entry = %q, want %q", history[1].Changes, want)
+	}
+}
@@ -8,8 +8,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-
-	"gopkg.in/yaml.v2"
 )
 
 func LoadVaultConfig(vaultPath string) (*VaultConfig, error) {
@@ -30,11 +28,6 @@ func LoadVaultConfig(vaultPath string) (*VaultConfig, error) {
 		return nil, fmt.Errorf("error reading vault configuration: %w", err)
 	}
 
-	var config VaultConfig
-	err = yaml.Unmarshal(configData, &config)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing vault configuration: %w", err)
-	}
-
-	return &config, nil
+	// Older schemas are migrated, newer ones refused
+	return loadMigratedVaultConfig(vaultPath, configData)
 }
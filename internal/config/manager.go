@@ -2,22 +2,48 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/validate"
 )
 
 // Manager handles operations on a Sietch vault
 type Manager struct {
 	vaultRoot string
+	revealer  PathRevealer
+}
+
+// PathRevealer decrypts the paths of manifests stored with encrypted paths
+type PathRevealer interface {
+	Reveal(m *FileManifest) error
+}
+
+// SetPathRevealer makes the manager decrypt encrypted paths as it loads manifests
+func (m *Manager) SetPathRevealer(revealer PathRevealer) {
+	m.revealer = revealer
+}
+
+// reveal decrypts a manifest's path when a revealer is set
+func (m *Manager) reveal(fileManifest *FileManifest) error {
+	if m.revealer == nil {
+		return nil
+	}
+	return m.revealer.Reveal(fileManifest)
 }
 
 // Manifest represents the content of a vault
 type Manifest struct {
-	Files []FileManifest `json:"files"`
+	Files    []FileManifest  `json:"files"`
+	Metadata *MetadataConfig `json:"metadata,omitempty"` // The vault's tags and metadata, sent to peers
 }
 
 // ManifestEntry represents a manifest file with its path
@@ -63,6 +89,9 @@ func (m *Manager) GetManifest() (*Manifest, error) {
 			fmt.Printf("Warning: Failed to load manifest %s: %v\n", entry.Name(), err)
 			continue
 		}
+		if err := m.reveal(fileManifest); err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", entry.Name(), err)
+		}
 
 		manifest.Files = append(manifest.Files, *fileManifest)
 	}
@@ -72,74 +101,175 @@ func (m *Manager) GetManifest() (*Manifest, error) {
 
 // GetManifestEntries returns all manifest entries with their paths
 func (m *Manager) GetManifestEntries() ([]*ManifestEntry, error) {
-	manifestsDir := filepath.Join(m.vaultRoot, ".sietch", "manifests")
 	var entries []*ManifestEntry
+	err := m.WalkManifestEntries(func(entry *ManifestEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
 
+// WalkManifestEntries loads the file manifests one at a time and calls fn for each,
+// so large vaults can be scanned without holding every manifest in memory.
+// Walking stops at the first error returned by fn.
+func (m *Manager) WalkManifestEntries(fn func(entry *ManifestEntry) error) error {
+	return WalkManifestDir(filepath.Join(m.vaultRoot, ".sietch", "manifests"), func(entry *ManifestEntry) error {
+		if err := m.reveal(&entry.Manifest); err != nil {
+			return fmt.Errorf("manifest %s: %w", filepath.Base(entry.Path), err)
+		}
+		return fn(entry)
+	})
+}
+
+// WalkManifestDir calls fn for every file manifest stored in manifestsDir. It is
+// used for manifest copies kept outside the live manifests directory, such as snapshots.
+func WalkManifestDir(manifestsDir string, fn func(entry *ManifestEntry) error) error {
 	// Ensure directory exists
 	if _, err := os.Stat(manifestsDir); os.IsNotExist(err) {
-		return entries, nil // Return empty if directory doesn't exist
+		return nil // Nothing to walk if directory doesn't exist
 	}
 
 	// Read all manifest files
 	dirEntries, err := os.ReadDir(manifestsDir)
 	if err != nil {
-		return entries, nil // Return empty if error reading directory
+		return nil // Nothing to walk if error reading directory
 	}
 
 	for _, entry := range dirEntries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
-			continue
+		if err := visitManifest(manifestsDir, entry, fn); err != nil {
+			return err
 		}
+	}
 
-		// Load the file manifest
-		filePath := filepath.Join(manifestsDir, entry.Name())
-		fileManifest, err := loadFileManifest(filePath)
+	return nil
+}
+
+// manifestScanBatch is how many directory entries ScanManifestDir lists at a time
+const manifestScanBatch = 256
+
+// ScanManifestDir is WalkManifestDir in directory order instead of sorted by
+// name. The directory is listed in batches, so a caller that stops at the
+// first manifest it needs, by returning an error from fn, does not pay for
+// listing every manifest of a large vault.
+func ScanManifestDir(manifestsDir string, fn func(entry *ManifestEntry) error) error {
+	dir, err := os.Open(manifestsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifests directory: %v", err)
+	}
+	defer dir.Close()
+
+	for {
+		dirEntries, err := dir.ReadDir(manifestScanBatch)
+		for _, entry := range dirEntries {
+			if err := visitManifest(manifestsDir, entry, fn); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			fmt.Printf("Warning: Failed to load manifest %s: %v\n", entry.Name(), err)
-			continue
+			return fmt.Errorf("failed to read manifests directory: %v", err)
 		}
+	}
+}
 
-		entries = append(entries, &ManifestEntry{
-			Path:     filePath,
-			Manifest: *fileManifest,
-		})
+// visitManifest loads one manifest of a manifests directory and calls fn with
+// it; other entries, and manifests that fail to load, are skipped
+func visitManifest(manifestsDir string, entry os.DirEntry, fn func(entry *ManifestEntry) error) error {
+	if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+		return nil
 	}
 
-	return entries, nil
+	// Load the file manifest
+	filePath := filepath.Join(manifestsDir, entry.Name())
+	fileManifest, err := loadFileManifest(filePath)
+	if err != nil {
+		fmt.Printf("Warning: Failed to load manifest %s: %v\n", entry.Name(), err)
+		return nil
+	}
+	return fn(&ManifestEntry{Path: filePath, Manifest: *fileManifest})
 }
 
 // GetChunk retrieves a chunk by its hash
 func (m *Manager) GetChunk(hash string) ([]byte, error) {
-	chunkPath := filepath.Join(m.vaultRoot, ".sietch", "chunks", hash)
-	fmt.Printf("chunk path %v\n", chunkPath) // Added newline here
+	loc, exists := layout.LocateChunk(m.vaultRoot, hash)
+	fmt.Printf("chunk path %v\n", loc.Path) // Added newline here
 
 	// Check if chunk exists
-	if _, err := os.Stat(chunkPath); os.IsNotExist(err) {
+	if !exists {
+		// Packs are transferred over the same protocol as chunks
+		if m.PackExists(hash) {
+			return os.ReadFile(layout.PackPath(m.vaultRoot, hash))
+		}
+		// So are compression dictionaries, requested by file name
+		if id, ok := layout.DictionaryIDFromName(hash); ok && m.DictionaryExists(id) {
+			return os.ReadFile(layout.DictionaryPath(m.vaultRoot, id))
+		}
 		return nil, fmt.Errorf("chunk not found: %s", hash)
 	}
 
 	// Read the chunk data
-	return os.ReadFile(chunkPath)
+	return loc.Read()
+}
+
+// PackExists checks if a small-file pack exists in the vault
+func (m *Manager) PackExists(packID string) bool {
+	if !layout.ValidPackID(packID) {
+		return false
+	}
+	_, err := os.Stat(layout.PackPath(m.vaultRoot, packID))
+	return err == nil
+}
+
+// StorePack stores a small-file pack in the vault
+func (m *Manager) StorePack(packID string, data []byte) error {
+	if !layout.ValidPackID(packID) {
+		return fmt.Errorf("invalid pack ID %q", packID)
+	}
+	if err := os.MkdirAll(layout.PackDirectory(m.vaultRoot), 0o755); err != nil {
+		return fmt.Errorf("failed to create packs directory: %v", err)
+	}
+	return atomic.WriteFile(layout.PackPath(m.vaultRoot, packID), data, 0o644)
+}
+
+// DictionaryExists checks if a compression dictionary exists in the vault
+func (m *Manager) DictionaryExists(id string) bool {
+	_, err := os.Stat(layout.DictionaryPath(m.vaultRoot, id))
+	return err == nil
+}
+
+// StoreDictionary stores a compression dictionary in the vault
+func (m *Manager) StoreDictionary(id string, data []byte) error {
+	if _, ok := layout.DictionaryIDFromName(layout.DictionaryName(id)); !ok {
+		return fmt.Errorf("invalid dictionary ID %q", id)
+	}
+	if err := os.MkdirAll(layout.DictionaryDirectory(m.vaultRoot), 0o755); err != nil {
+		return fmt.Errorf("failed to create compression directory: %v", err)
+	}
+	return atomic.WriteFile(layout.DictionaryPath(m.vaultRoot, id), data, 0o644)
 }
 
 // StoreChunk stores a chunk in the vault
 func (m *Manager) StoreChunk(hash string, data []byte) error {
-	chunkPath := filepath.Join(m.vaultRoot, ".sietch", "chunks", hash)
+	chunkPath := layout.ChunkPath(m.vaultRoot, hash)
 
-	// Ensure chunks directory exists
-	chunksDir := filepath.Join(m.vaultRoot, ".sietch", "chunks")
-	if err := os.MkdirAll(chunksDir, 0o755); err != nil {
+	// Ensure chunks (shard) directory exists
+	if err := os.MkdirAll(filepath.Dir(chunkPath), 0o755); err != nil {
 		return fmt.Errorf("failed to create chunks directory: %v", err)
 	}
 
-	// Write the chunk data
-	return os.WriteFile(chunkPath, data, 0o644)
+	// Write the chunk data; a partially written chunk is never left in place
+	return atomic.WriteFile(chunkPath, data, 0o644)
 }
 
 // ChunkExists checks if a chunk exists in the vault
 func (m *Manager) ChunkExists(hash string) (bool, error) {
-	chunkPath := filepath.Join(m.vaultRoot, ".sietch", "chunks", hash)
-	_, err := os.Stat(chunkPath)
+	loc, _ := layout.LocateChunk(m.vaultRoot, hash)
+	_, err := os.Stat(loc.Path)
 	if err == nil {
 		return true, nil
 	}
@@ -161,41 +291,60 @@ func (m *Manager) RebuildReferences() error {
 	referenced := make(map[string]bool)
 	var missing []string
 	for _, entry := range entries {
-		for _, chunk := range entry.Manifest.Chunks {
+		if pack := entry.Manifest.Pack; pack != nil {
+			referenced[pack.ID] = true
+			if !m.PackExists(pack.ID) {
+				missing = append(missing, pack.ID)
+			}
+		}
+		for i, chunk := range entry.Manifest.Chunks {
+			if chunk.Zero {
+				// Zero chunks are synthetic and always valid
+				continue
+			}
 			referenced[chunk.Hash] = true
 			exists, err := m.ChunkExists(chunk.Hash)
 			if err != nil {
 				return fmt.Errorf("failed to check chunk %s: %v", chunk.Hash, err)
 			}
+			// Chunks of encrypted vaults may be stored under their encrypted hash
+			if chunk.EncryptedHash != "" {
+				referenced[chunk.EncryptedHash] = true
+				if !exists {
+					exists, _ = m.ChunkExists(chunk.EncryptedHash)
+				}
+			}
+			if chunk.Remote {
+				// Chunks recorded from dedup hints are local once a sync fetched them
+				if exists {
+					entry.Manifest.Chunks[i].Remote = false
+				}
+				continue
+			}
 			if !exists {
 				missing = append(missing, chunk.Hash)
 			}
 		}
 	}
 
-	// Check for orphaned chunks
-	chunksDir := filepath.Join(m.vaultRoot, ".sietch", "chunks")
+	// Check for orphaned chunks (in either storage layout)
+	storedHashes, err := layout.ListChunkHashes(m.vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to list stored chunks: %v", err)
+	}
 	var orphaned []string
-	if _, err := os.Stat(chunksDir); !os.IsNotExist(err) {
-		dirEntries, err := os.ReadDir(chunksDir)
-		if err != nil {
-			return fmt.Errorf("failed to read chunks directory: %v", err)
-		}
-		for _, entry := range dirEntries {
-			if !entry.IsDir() {
-				hash := entry.Name()
-				if !referenced[hash] {
-					orphaned = append(orphaned, hash)
-				}
-			}
+	for _, hash := range storedHashes {
+		if !referenced[hash] {
+			orphaned = append(orphaned, hash)
 		}
 	}
 
 	// Update manifest metadata
 	now := time.Now()
+	compress := ManifestCompression(m.vaultRoot)
 	for _, entry := range entries {
 		entry.Manifest.LastVerified = now
-		if err := saveFileManifest(entry.Path, &entry.Manifest); err != nil {
+		if err := saveFileManifest(entry.Path, &entry.Manifest, compress); err != nil {
 			return fmt.Errorf("failed to save manifest %s: %v", entry.Path, err)
 		}
 	}
@@ -228,25 +377,41 @@ func loadFileManifest(path string) (*FileManifest, error) {
 		return nil, fmt.Errorf("failed to read manifest file: %v", err)
 	}
 
-	// Parse YAML content
+	data, err = DecodeManifestData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFileManifest(filepath.Base(path), data)
+}
+
+// ParseFileManifest decodes a file manifest read from source. Manifests are
+// written by sietch itself, so unknown keys are only looked for when
+// validation is strict.
+func ParseFileManifest(source string, data []byte) (*FileManifest, error) {
 	var manifest FileManifest
-	if err := yaml.Unmarshal(data, &manifest); err != nil {
+	if err := decodeChecked(source, data, &manifest, validate.Strict()); err != nil {
 		return nil, fmt.Errorf("failed to parse manifest: %v", err)
 	}
-
+	// Manifests written by Windows builds before vault paths were normalized
+	// may use backslashes
+	manifest.Destination = strings.ReplaceAll(manifest.Destination, `\`, "/")
 	return &manifest, nil
 }
 
-// Helper function to save a file manifest
-func saveFileManifest(path string, manifest *FileManifest) error {
+// Helper function to save a file manifest, compressed when compress is set
+func saveFileManifest(path string, manifest *FileManifest, compress bool) error {
 	// Marshal to YAML
 	data, err := yaml.Marshal(manifest)
 	if err != nil {
 		return fmt.Errorf("failed to marshal manifest: %v", err)
 	}
+	if data, err = EncodeManifestData(data, compress); err != nil {
+		return err
+	}
 
-	// Write to file
-	return os.WriteFile(path, data, 0o644)
+	// Replace the file in one step, so a crash leaves the old manifest or the new one
+	return atomic.WriteFile(path, data, 0o644)
 }
 
 // GetConfig loads and returns the vault configuration
@@ -264,13 +429,8 @@ func (m *Manager) GetConfig() (*VaultConfig, error) {
 		return nil, fmt.Errorf("failed to read configuration file: %v", err)
 	}
 
-	// Parse YAML content
-	var config VaultConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse configuration: %v", err)
-	}
-
-	return &config, nil
+	// Parse YAML content, migrating an older schema
+	return loadMigratedVaultConfig(m.vaultRoot, data)
 }
 
 // SaveConfig writes the vault configuration to disk
@@ -289,7 +449,12 @@ func (m *Manager) SaveConfig(config *VaultConfig) error {
 
 	// Marshal configuration to YAML
 	// log.Printf("Marshaling configuration to YAML")
-	data, err := yaml.Marshal(config)
+	// Secrets go to .sietch/secrets.yaml first, so vault.yaml can be shared
+	public, err := SplitVaultConfig(m.vaultRoot, config)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(public)
 	if err != nil {
 		// log.Printf("ERROR: Failed to marshal configuration: %v", err)
 		return fmt.Errorf("failed to marshal configuration: %v", err)
@@ -302,10 +467,20 @@ func (m *Manager) SaveConfig(config *VaultConfig) error {
 
 	// Write to file
 	// log.Printf("Writing configuration to %s", configPath)
-	if err := os.WriteFile(configPath, data, 0o644); err != nil {
+	// Keep the version being replaced; a crash mid-write must not leave a
+	// truncated vault.yaml behind
+	previous, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read configuration file: %v", err)
+	}
+	if err := rotateConfigBackups(m.vaultRoot); err != nil {
+		return fmt.Errorf("failed to back up configuration file: %v", err)
+	}
+	if err := atomic.WriteFile(configPath, data, 0o644); err != nil {
 		log.Printf("ERROR: Failed to write configuration to %s: %v", configPath, err)
 		return fmt.Errorf("failed to write configuration file: %v", err)
 	}
+	RecordConfigChange(m.vaultRoot, previous, config)
 	// log.Printf("Successfully saved vault configuration to %s", configPath)
 
 	return nil
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStorePackRejectsTraversal ensures a pack ID from a peer or bundle
+// cannot write outside the packs directory
+func TestStorePackRejectsTraversal(t *testing.T) {
+	vaultRoot := filepath.Join(t.TempDir(), "vault")
+	m, _ := NewManager(vaultRoot)
+	for _, id := range []string{"../../escaped", "../escaped", "sub/escaped", `..\escaped`, ".hidden", ""} {
+		if err := m.StorePack(id, []byte("data")); err == nil {
+			t.Errorf("StorePack(%q) succeeded, want an error", id)
+		}
+		if m.PackExists(id) {
+			t.Errorf("PackExists(%q) = true", id)
+		}
+	}
+	for _, path := range []string{filepath.Join(filepath.Dir(vaultRoot), "escaped"), filepath.Join(vaultRoot, ".sietch", "escaped")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was written", path)
+		}
+	}
+
+	if err := m.StorePack("0123456789abcdef", []byte("data")); err != nil {
+		t.Fatalf("StorePack() error: %v", err)
+	}
+	if !m.PackExists("0123456789abcdef") {
+		t.Error("PackExists() = false for a stored pack")
+	}
+}
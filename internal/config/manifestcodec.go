@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Manifests of vaults with manifest_format 2 are stored as a zstd frame holding
+// the YAML. Readers tell the two forms apart by the zstd magic number, so a
+// vault whose manifests are only partly converted still loads.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	manifestCoderOnce sync.Once
+	manifestEncoder   *zstd.Encoder
+	manifestDecoder   *zstd.Decoder
+	manifestCoderErr  error
+)
+
+// manifestCoders returns the zstd encoder and decoder shared by every manifest
+// read and write; EncodeAll and DecodeAll are safe for concurrent use
+func manifestCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	manifestCoderOnce.Do(func() {
+		manifestEncoder, manifestCoderErr = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if manifestCoderErr != nil {
+			return
+		}
+		manifestDecoder, manifestCoderErr = zstd.NewReader(nil,
+			zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(constants.MaxDecompressionSize))
+	})
+	return manifestEncoder, manifestDecoder, manifestCoderErr
+}
+
+// CompressesManifests reports whether new manifests are written compressed
+func (c VaultConfig) CompressesManifests() bool {
+	return c.ManifestFormat >= constants.ManifestFormatZstd
+}
+
+// ManifestCompression reports whether the vault at vaultRoot writes compressed
+// manifests. A vault whose configuration cannot be read writes plain YAML.
+func ManifestCompression(vaultRoot string) bool {
+	cfg, err := LoadVaultConfig(vaultRoot)
+	return err == nil && cfg.CompressesManifests()
+}
+
+// IsCompressedManifest reports whether stored manifest data is compressed
+func IsCompressedManifest(data []byte) bool {
+	return bytes.HasPrefix(data, zstdMagic)
+}
+
+// DecodeManifestData returns the YAML of stored manifest data, decompressing it
+// if it is compressed
+func DecodeManifestData(data []byte) ([]byte, error) {
+	if !IsCompressedManifest(data) {
+		return data, nil
+	}
+	_, decoder, err := manifestCoders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress manifest: %v", err)
+	}
+	return decoded, nil
+}
+
+// EncodeManifestData returns manifest YAML as it is stored: compressed with
+// zstd when compress is set, otherwise unchanged
+func EncodeManifestData(data []byte, compress bool) ([]byte, error) {
+	if !compress {
+		return data, nil
+	}
+	encoder, _, err := manifestCoders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %v", err)
+	}
+	return encoder.EncodeAll(data, nil), nil
+}
+
+// NewManifestWriter returns a writer that stores the manifest YAML written to
+// it in w, compressed when compress is set. Close writes out a compressed
+// manifest; it does not close w.
+func NewManifestWriter(w io.Writer, compress bool) io.WriteCloser {
+	if !compress {
+		return nopWriteCloser{w}
+	}
+	return &manifestWriter{w: w}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// manifestWriter buffers a manifest until Close compresses it as one frame
+type manifestWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (m *manifestWriter) Write(p []byte) (int, error) {
+	return m.buf.Write(p)
+}
+
+func (m *manifestWriter) Close() error {
+	data, err := EncodeManifestData(m.buf.Bytes(), true)
+	if err != nil {
+		return err
+	}
+	_, err = m.w.Write(data)
+	return err
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestManifestCodec(t *testing.T) {
+	plain := []byte("file: notes.txt\ndestination: docs/\nsize: 1024\n")
+
+	stored, err := EncodeManifestData(plain, false)
+	if err != nil || !bytes.Equal(stored, plain) {
+		t.Errorf("EncodeManifestData(plain) = %q, %v; want the data unchanged", stored, err)
+	}
+	if decoded, err := DecodeManifestData(plain); err != nil || !bytes.Equal(decoded, plain) {
+		t.Errorf("DecodeManifestData(plain) = %q, %v; want the data unchanged", decoded, err)
+	}
+
+	var buf bytes.Buffer
+	w := NewManifestWriter(&buf, true)
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !IsCompressedManifest(buf.Bytes()) {
+		t.Fatalf("NewManifestWriter(compress) wrote %q, want a zstd frame", buf.Bytes())
+	}
+	if decoded, err := DecodeManifestData(buf.Bytes()); err != nil || !bytes.Equal(decoded, plain) {
+		t.Errorf("DecodeManifestData(compressed) = %q, %v; want %q", decoded, err, plain)
+	}
+
+	if _, err := DecodeManifestData(append([]byte{0x28, 0xb5, 0x2f, 0xfd}, "garbage"...)); err == nil {
+		t.Error("DecodeManifestData() accepted a damaged zstd frame")
+	}
+}
+
+// writeSyntheticManifests stores n manifests of eight chunks each in dir
+func writeSyntheticManifests(b *testing.B, dir string, n int, compress bool) {
+	b.Helper()
+	for i := range n {
+		manifest := FileManifest{FilePath: fmt.Sprintf("photo%05d.raw", i), Destination: "photos/2025/", Size: 32 << 20}
+		for c := range 8 {
+			manifest.Chunks = append(manifest.Chunks, ChunkRef{
+				Hash:            fmt.Sprintf("%x", sha256.Sum256([]byte{byte(i), byte(i >> 8), byte(c)})),
+				Size:            4 << 20,
+				Index:           c,
+				Compressed:      true,
+				CompressionType: "zstd",
+				CompressedSize:  3 << 20,
+			})
+		}
+		data, err := yaml.Marshal(&manifest)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if data, err = EncodeManifestData(data, compress); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("photos.%05d.yaml", i)), data, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWalkManifestDir loads every manifest of a synthetic 5000 file vault,
+// stored plain and compressed
+func BenchmarkWalkManifestDir(b *testing.B) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "zstd"
+		}
+		b.Run(name, func(b *testing.B) {
+			dir := b.TempDir()
+			writeSyntheticManifests(b, dir, 5000, compress)
+			var stored int64
+			entries, _ := os.ReadDir(dir)
+			for _, entry := range entries {
+				if info, err := entry.Info(); err == nil {
+					stored += info.Size()
+				}
+			}
+
+			b.ResetTimer()
+			for range b.N {
+				loaded := 0
+				err := WalkManifestDir(dir, func(*ManifestEntry) error {
+					loaded++
+					return nil
+				})
+				if err != nil || loaded != 5000 {
+					b.Fatalf("loaded %d manifests, error %v", loaded, err)
+				}
+			}
+			b.ReportMetric(float64(stored)/5000, "bytes/manifest")
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxTagLength is the longest vault tag accepted
+const MaxTagLength = 64
+
+var (
+	tagPattern      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]*$`)
+	metaKeyPattern  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+	reservedMetaKey = map[string]bool{"tags": true, "updated_at": true, "fields": true}
+)
+
+// ValidateTag checks that a vault tag is a single word of letters, digits and
+// . _ : - that starts with a letter or digit
+func ValidateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tag cannot be empty")
+	}
+	if len(tag) > MaxTagLength {
+		return fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+	}
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag %q: use letters, digits and . _ : - and start with a letter or digit", tag)
+	}
+	return nil
+}
+
+// validTags checks a comma separated list of tags, as 'config set' takes them
+func validTags(value string) error {
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag == "" {
+			continue
+		}
+		if err := ValidateTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTags adds the tags the metadata does not have yet and returns those it
+// added. Nothing is added when any tag is invalid.
+func AddTags(metadata *MetadataConfig, tags ...string) ([]string, error) {
+	for _, tag := range tags {
+		if err := ValidateTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	var added []string
+	for _, tag := range tags {
+		if !slices.Contains(metadata.Tags, tag) {
+			metadata.Tags = append(metadata.Tags, tag)
+			added = append(added, tag)
+		}
+	}
+	if len(added) > 0 {
+		metadata.UpdatedAt = time.Now().UTC()
+	}
+	return added, nil
+}
+
+// RemoveTags removes tags from the metadata and returns those it had
+func RemoveTags(metadata *MetadataConfig, tags ...string) []string {
+	var removed []string
+	for _, tag := range tags {
+		if i := slices.Index(metadata.Tags, tag); i >= 0 {
+			metadata.Tags = slices.Delete(metadata.Tags, i, i+1)
+			removed = append(removed, tag)
+		}
+	}
+	if len(removed) > 0 {
+		metadata.UpdatedAt = time.Now().UTC()
+	}
+	return removed
+}
+
+// GetMetadata returns a metadata value: the author, or a freeform field
+func GetMetadata(metadata *MetadataConfig, key string) string {
+	if key == "author" {
+		return metadata.Author
+	}
+	return metadata.Fields[key]
+}
+
+// SetMetadata sets the author or a freeform field; an empty value removes the
+// field. It reports whether anything changed.
+func SetMetadata(metadata *MetadataConfig, key, value string) (bool, error) {
+	if !metaKeyPattern.MatchString(key) {
+		return false, fmt.Errorf("invalid metadata key %q: use letters, digits and . _ - and start with a letter", key)
+	}
+	if reservedMetaKey[key] {
+		return false, fmt.Errorf("%s cannot be set as metadata; use 'sietch vault tag' for tags", key)
+	}
+	if strings.ContainsAny(value, "\n\r") {
+		return false, fmt.Errorf("metadata values must fit on one line")
+	}
+	if GetMetadata(metadata, key) == value {
+		return false, nil
+	}
+	switch {
+	case key == "author":
+		metadata.Author = value
+	case value == "":
+		delete(metadata.Fields, key)
+	default:
+		if metadata.Fields == nil {
+			metadata.Fields = make(map[string]string)
+		}
+		metadata.Fields[key] = value
+	}
+	metadata.UpdatedAt = time.Now().UTC()
+	return true, nil
+}
+
+// MetadataMerge is the outcome of merging a peer's vault metadata
+type MetadataMerge struct {
+	Updated  bool // The peer's metadata replaced ours
+	Conflict bool // Both sides were edited and differ; the newer edit won
+}
+
+// MergeMetadata applies a peer's vault metadata last writer wins: the side
+// edited last is kept. Metadata never edited since init loses to any edit.
+func MergeMetadata(local *MetadataConfig, remote *MetadataConfig) MetadataMerge {
+	if remote == nil || sameMetadata(local, remote) {
+		return MetadataMerge{}
+	}
+	conflict := !local.UpdatedAt.IsZero() && !remote.UpdatedAt.IsZero()
+	if !remote.UpdatedAt.After(local.UpdatedAt) {
+		return MetadataMerge{Conflict: conflict}
+	}
+	*local = MetadataConfig{
+		Author:    remote.Author,
+		Tags:      slices.Clone(remote.Tags),
+		UpdatedAt: remote.UpdatedAt,
+	}
+	for key, value := range remote.Fields {
+		if local.Fields == nil {
+			local.Fields = make(map[string]string)
+		}
+		local.Fields[key] = value
+	}
+	return MetadataMerge{Updated: true, Conflict: conflict}
+}
+
+// sameMetadata reports whether two metadata hold the same values, whenever
+// they were edited
+func sameMetadata(a, b *MetadataConfig) bool {
+	if a.Author != b.Author || !slices.Equal(a.Tags, b.Tags) || len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for key, value := range a.Fields {
+		if other, ok := b.Fields[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// HasAllTags reports whether tags holds every one of want
+func HasAllTags(tags, want []string) bool {
+	for _, tag := range want {
+		if !slices.Contains(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateTag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		wantErr bool
+	}{
+		{"work", false},
+		{"project:dune-2", false},
+		{"v1.0_final", false},
+		{"", true},
+		{"-work", true},
+		{"two words", true},
+		{"a,b", true},
+		{string(make([]byte, MaxTagLength+1)), true},
+	}
+	for _, tt := range tests {
+		if err := ValidateTag(tt.tag); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTag(%q) error = %v, wantErr %v", tt.tag, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEditTags(t *testing.T) {
+	metadata := &MetadataConfig{Tags: []string{"work"}}
+	if _, err := AddTags(metadata, "archive", "bad tag"); err == nil {
+		t.Fatal("AddTags() accepted an invalid tag")
+	}
+	if len(metadata.Tags) != 1 || !metadata.UpdatedAt.IsZero() {
+		t.Fatalf("a failed AddTags() changed the metadata: %+v", metadata)
+	}
+
+	added, err := AddTags(metadata, "work", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(added, []string{"archive"}) || !slices.Equal(metadata.Tags, []string{"work", "archive"}) {
+		t.Errorf("AddTags() = %v, tags %v", added, metadata.Tags)
+	}
+	if metadata.UpdatedAt.IsZero() {
+		t.Error("AddTags() did not record the edit time")
+	}
+
+	if removed := RemoveTags(metadata, "work", "missing"); !slices.Equal(removed, []string{"work"}) {
+		t.Errorf("RemoveTags() = %v, want [work]", removed)
+	}
+	if !slices.Equal(metadata.Tags, []string{"archive"}) {
+		t.Errorf("tags = %v, want [archive]", metadata.Tags)
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	metadata := &MetadataConfig{}
+	if changed, err := SetMetadata(metadata, "owner", "field team"); err != nil || !changed {
+		t.Fatalf("SetMetadata() = %v, %v", changed, err)
+	}
+	if changed, _ := SetMetadata(metadata, "owner", "field team"); changed {
+		t.Error("setting the same value reported a change")
+	}
+	if _, err := SetMetadata(metadata, "author", "Liet"); err != nil || metadata.Author != "Liet" {
+		t.Errorf("author = %q, %v", metadata.Author, err)
+	}
+	if _, err := SetMetadata(metadata, "owner", ""); err != nil || len(metadata.Fields) != 0 {
+		t.Errorf("empty value left fields %v, %v", metadata.Fields, err)
+	}
+	for _, key := range []string{"tags", "9lives", "has space"} {
+		if _, err := SetMetadata(metadata, key, "x"); err == nil {
+			t.Errorf("SetMetadata(%q) succeeded, want an error", key)
+		}
+	}
+	if _, err := SetMetadata(metadata, "note", "two\nlines"); err == nil {
+		t.Error("SetMetadata() accepted a multi-line value")
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	earlier := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	tests := []struct {
+		name     string
+		local    MetadataConfig
+		remote   *MetadataConfig
+		want     MetadataMerge
+		wantTags []string
+	}{
+		{"no peer metadata", MetadataConfig{Tags: []string{"a"}}, nil, MetadataMerge{}, []string{"a"}},
+		{"same values", MetadataConfig{Tags: []string{"a"}, UpdatedAt: earlier}, &MetadataConfig{Tags: []string{"a"}, UpdatedAt: later}, MetadataMerge{}, []string{"a"}},
+		{"unedited loses", MetadataConfig{Tags: []string{"a"}}, &MetadataConfig{Tags: []string{"b"}, UpdatedAt: earlier}, MetadataMerge{Updated: true}, []string{"b"}},
+		{"peer newer", MetadataConfig{Tags: []string{"a"}, UpdatedAt: earlier}, &MetadataConfig{Tags: []string{"b"}, UpdatedAt: later}, MetadataMerge{Updated: true, Conflict: true}, []string{"b"}},
+		{"local newer", MetadataConfig{Tags: []string{"a"}, UpdatedAt: later}, &MetadataConfig{Tags: []string{"b"}, UpdatedAt: earlier}, MetadataMerge{Conflict: true}, []string{"a"}},
+		{"both unedited", MetadataConfig{Tags: []string{"a"}}, &MetadataConfig{Tags: []string{"b"}}, MetadataMerge{}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := tt.local
+			if got := MergeMetadata(&local, tt.remote); got != tt.want {
+				t.Errorf("MergeMetadata() = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(local.Tags, tt.wantTags) {
+				t.Errorf("tags = %v, want %v", local.Tags, tt.wantTags)
+			}
+		})
+	}
+}
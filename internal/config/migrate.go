@@ -0,0 +1,263 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// vault.yaml carries a schema_version. Each migration below upgrades a decoded
+// vault.yaml by one version; loading a vault applies the pending ones, after
+// saving a copy of the original under .sietch/backups/, so the rest of sietch
+// only ever sees the current schema. A vault.yaml newer than this build is
+// refused rather than read with fields it does not know about.
+
+// ErrSchemaTooNew is returned for a vault written by a newer version of sietch
+var ErrSchemaTooNew = errors.New("vault schema is newer than this version of sietch supports")
+
+// backupDirName holds copies of vault.yaml taken before a migration
+const backupDirName = "backups"
+
+// vaultMigration upgrades a decoded vault.yaml from schema version From to From+1
+type vaultMigration struct {
+	From        int
+	Description string
+	Apply       func(doc map[interface{}]interface{})
+}
+
+var vaultMigrations = []vaultMigration{
+	{
+		From:        1,
+		Description: "record the chunk layout, hash algorithm, compression and manifest format older vaults left implicit",
+		Apply:       migrateV1ToV2,
+	},
+	{
+		From:        2,
+		Description: "move key paths, KDF salts and wrapped keys from vault.yaml to .sietch/secrets.yaml",
+		Apply:       func(doc map[interface{}]interface{}) {}, // saveMigrated splits the secrets off
+	},
+}
+
+// migrateV1ToV2 writes out the defaults schema 1 vaults relied on when a
+// setting was missing, so later changes to the defaults leave them as they are
+func migrateV1ToV2(doc map[interface{}]interface{}) {
+	chunking := childMap(doc, "chunking")
+	setDefault(chunking, "layout_version", constants.ChunkLayoutFlat)
+	setDefault(chunking, "hash_algorithm", constants.HashAlgorithmSHA256)
+	setDefault(doc, "compression", constants.CompressionTypeNone)
+	setDefault(doc, "manifest_format", constants.ManifestFormatYAML)
+}
+
+// Migration describes one step of a schema upgrade
+type Migration struct {
+	From        int
+	To          int
+	Description string
+}
+
+// PendingMigrations lists the migrations that take a vault.yaml from schema
+// version from to version to
+func PendingMigrations(from, to int) []Migration {
+	var pending []Migration
+	for _, m := range vaultMigrations {
+		if m.From >= from && m.From < to {
+			pending = append(pending, Migration{From: m.From, To: m.From + 1, Description: m.Description})
+		}
+	}
+	return pending
+}
+
+// CheckMigration reports whether a vault.yaml at schema version from can be
+// migrated to version to
+func CheckMigration(from, to int) error {
+	switch {
+	case from > constants.VaultSchemaVersion:
+		return fmt.Errorf("%w: the vault uses schema version %d, this sietch reads up to %d; upgrade sietch to open it",
+			ErrSchemaTooNew, from, constants.VaultSchemaVersion)
+	case to > constants.VaultSchemaVersion || to < 1:
+		return fmt.Errorf("schema version %d is unknown; this sietch supports versions 1 to %d", to, constants.VaultSchemaVersion)
+	case to < from:
+		return fmt.Errorf("the vault is already at schema version %d; migrations cannot go back to %d", from, to)
+	}
+	return nil
+}
+
+// VaultSchemaVersion returns the schema version of the vault.yaml at vaultRoot
+// without migrating it. Files from before schema versions were recorded are version 1.
+func VaultSchemaVersion(vaultRoot string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml"))
+	if err != nil {
+		return 0, fmt.Errorf("error reading vault configuration: %w", err)
+	}
+	doc, err := decodeVaultDocument(data)
+	if err != nil {
+		return 0, err
+	}
+	return schemaVersionOf(doc), nil
+}
+
+// MigrateVaultConfig upgrades the vault.yaml at vaultRoot to schema version
+// to, saving a copy of the original in .sietch/backups/ first. It returns the
+// version the file had and the backup written, if any.
+func MigrateVaultConfig(vaultRoot string, to int) (from int, backup string, err error) {
+	configPath := filepath.Join(vaultRoot, "vault.yaml")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("error reading vault configuration: %w", err)
+	}
+	migrated, from, err := migrateVaultData(data, to)
+	if err != nil || from == to {
+		return from, "", err
+	}
+	backup, err = saveMigrated(vaultRoot, data, migrated, from)
+	return from, backup, err
+}
+
+// loadMigratedVaultConfig parses vault.yaml data, migrating it to the current
+// schema and saving the result when it is older
+func loadMigratedVaultConfig(vaultRoot string, data []byte) (*VaultConfig, error) {
+	migrated, from, err := migrateVaultData(data, constants.VaultSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	if from != constants.VaultSchemaVersion {
+		if _, err := saveMigrated(vaultRoot, data, migrated, from); err != nil {
+			// A vault on read-only media still opens, migrated in memory only
+			fmt.Fprintf(os.Stderr, "Warning: could not save vault configuration migrated from schema version %d: %v\n", from, err)
+		}
+	}
+
+	var config VaultConfig
+	if err := decodeChecked(filepath.Join(vaultRoot, "vault.yaml"), migrated, &config, true); err != nil {
+		return nil, fmt.Errorf("error parsing vault configuration: %w", err)
+	}
+	secrets, err := LoadSecrets(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	MergeSecrets(&config, secrets)
+	return &config, nil
+}
+
+// migrateVaultData applies the migrations taking vault.yaml data to schema
+// version to and returns the result encoded like SaveConfig writes it, along
+// with the version the data had. Data already at version to is returned as is.
+func migrateVaultData(data []byte, to int) ([]byte, int, error) {
+	doc, err := decodeVaultDocument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	from := schemaVersionOf(doc)
+	if err := CheckMigration(from, to); err != nil {
+		return nil, from, err
+	}
+	if to == from {
+		return data, from, nil
+	}
+
+	for _, m := range vaultMigrations {
+		if m.From >= from && m.From < to {
+			m.Apply(doc)
+		}
+	}
+	doc["schema_version"] = to
+
+	// Round trip through VaultConfig so the file keeps its usual field order
+	intermediate, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, from, fmt.Errorf("failed to encode migrated configuration: %w", err)
+	}
+	var config VaultConfig
+	if err := yaml.Unmarshal(intermediate, &config); err != nil {
+		return nil, from, fmt.Errorf("failed to parse migrated configuration: %w", err)
+	}
+	migrated, err := yaml.Marshal(&config)
+	if err != nil {
+		return nil, from, fmt.Errorf("failed to encode migrated configuration: %w", err)
+	}
+	return migrated, from, nil
+}
+
+// saveMigrated copies the original vault.yaml to .sietch/backups/ and then
+// replaces it with the migrated configuration, its secrets split off when the
+// new schema keeps them apart, returning the backup's path
+func saveMigrated(vaultRoot string, original, migrated []byte, from int) (string, error) {
+	backupDir := filepath.Join(vaultRoot, ".sietch", backupDirName)
+	if err := os.MkdirAll(backupDir, constants.StandardDirPerms); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	backup := filepath.Join(backupDir, fmt.Sprintf("vault-v%d-%s.yaml", from, time.Now().UTC().Format("20060102T150405Z")))
+	if err := atomic.WriteFile(backup, original, constants.StandardFilePerms); err != nil {
+		return "", fmt.Errorf("failed to back up vault configuration: %w", err)
+	}
+	var config VaultConfig
+	if err := yaml.Unmarshal(migrated, &config); err != nil {
+		return "", fmt.Errorf("failed to parse migrated configuration: %w", err)
+	}
+	public, err := SplitVaultConfig(vaultRoot, &config)
+	if err != nil {
+		return "", err
+	}
+	if migrated, err = yaml.Marshal(public); err != nil {
+		return "", fmt.Errorf("failed to encode migrated configuration: %w", err)
+	}
+	if err := atomic.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), migrated, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write migrated vault configuration: %w", err)
+	}
+	if err := AppendHistory(vaultRoot, config.HistoryLimit, fmt.Sprintf("schema_version: %d → %d (migrated)", from, config.SchemaVersion)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record the migration in the vault history: %v\n", err)
+	}
+	return backup, nil
+}
+
+func decodeVaultDocument(data []byte) (map[interface{}]interface{}, error) {
+	doc := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing vault configuration: %w", err)
+	}
+	return doc, nil
+}
+
+// schemaVersionOf returns a decoded vault.yaml's schema version; vaults from
+// before the field was written are version 1
+func schemaVersionOf(doc map[interface{}]interface{}) int {
+	if version, ok := doc["schema_version"].(int); ok && version > 0 {
+		return version
+	}
+	return 1
+}
+
+// childMap returns the mapping under key, adding an empty one if it is missing
+func childMap(doc map[interface{}]interface{}, key string) map[interface{}]interface{} {
+	if child, ok := doc[key].(map[interface{}]interface{}); ok {
+		return child
+	}
+	child := make(map[interface{}]interface{})
+	doc[key] = child
+	return child
+}
+
+// setDefault sets key to value when it is missing or empty
+func setDefault(doc map[interface{}]interface{}, key string, value interface{}) {
+	switch current := doc[key].(type) {
+	case nil:
+	case string:
+		if current != "" {
+			return
+		}
+	case int:
+		if current != 0 {
+			return
+		}
+	default:
+		return
+	}
+	doc[key] = value
+}
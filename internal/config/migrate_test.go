@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+const schemaV1Config = `vault_id: v1
+name: old
+created_at: 2024-01-02T03:04:05Z
+encryption:
+  type: none
+chunking:
+  strategy: fixed
+  chunk_size: 4MB
+  hash_algorithm: sha512
+`
+
+func writeVaultYAML(t *testing.T, data string) string {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return vaultRoot
+}
+
+func TestLoadVaultConfigMigrates(t *testing.T) {
+	vaultRoot := writeVaultYAML(t, schemaV1Config)
+
+	cfg, err := LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatalf("LoadVaultConfig() error: %v", err)
+	}
+	if cfg.SchemaVersion != constants.VaultSchemaVersion || cfg.Name != "old" {
+		t.Errorf("schema_version, name = %d, %q; want %d, old", cfg.SchemaVersion, cfg.Name, constants.VaultSchemaVersion)
+	}
+	if cfg.Chunking.LayoutVersion != constants.ChunkLayoutFlat || cfg.Compression != constants.CompressionTypeNone ||
+		cfg.ManifestFormat != constants.ManifestFormatYAML {
+		t.Errorf("implicit defaults not recorded: layout %d, compression %q, manifest format %d",
+			cfg.Chunking.LayoutVersion, cfg.Compression, cfg.ManifestFormat)
+	}
+	if cfg.Chunking.HashAlgorithm != "sha512" {
+		t.Errorf("hash_algorithm = %q, want the vault's sha512 kept", cfg.Chunking.HashAlgorithm)
+	}
+
+	// The migrated file is saved and the original backed up
+	if version, err := VaultSchemaVersion(vaultRoot); err != nil || version != constants.VaultSchemaVersion {
+		t.Errorf("vault.yaml schema version = %d, %v; want %d", version, err, constants.VaultSchemaVersion)
+	}
+	backups, err := filepath.Glob(filepath.Join(vaultRoot, ".sietch", "backups", "vault-v1-*.yaml"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups = %v, %v; want one", backups, err)
+	}
+	if data, err := os.ReadFile(backups[0]); err != nil || string(data) != schemaV1Config {
+		t.Errorf("backup = %q, %v; want the original vault.yaml", data, err)
+	}
+	want := fmt.Sprintf("schema_version: 1 → %d (migrated)", constants.VaultSchemaVersion)
+	if history, err := LoadHistory(vaultRoot); err != nil || len(history) != 1 || history[0].Changes[0] != want {
+		t.Errorf("history = %+v, %v; want the migration recorded", history, err)
+	}
+}
+
+func TestLoadVaultConfigRejectsNewerSchema(t *testing.T) {
+	newer := "schema_version: 99\nname: future\n"
+	vaultRoot := writeVaultYAML(t, newer)
+
+	_, err := LoadVaultConfig(vaultRoot)
+	if !errors.Is(err, ErrSchemaTooNew) || !strings.Contains(err.Error(), "upgrade sietch") {
+		t.Errorf("LoadVaultConfig() error = %v, want ErrSchemaTooNew asking to upgrade", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml")); string(data) != newer {
+		t.Errorf("vault.yaml was modified: %q", data)
+	}
+}
+
+func TestMigrateVaultConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		to      int
+		want    int
+		wantErr string
+	}{
+		{name: "upgrade", config: schemaV1Config, to: 2, want: 1},
+		{name: "current", config: "schema_version: 3\n", to: 3, want: 3},
+		{name: "downgrade", config: "schema_version: 2\n", to: 1, wantErr: "cannot go back"},
+		{name: "unknown target", config: schemaV1Config, to: 4, wantErr: "is unknown"},
+		{name: "newer vault", config: "schema_version: 4\n", to: 3, wantErr: "upgrade sietch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultRoot := writeVaultYAML(t, tt.config)
+			from, backup, err := MigrateVaultConfig(vaultRoot, tt.to)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("MigrateVaultConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || from != tt.want {
+				t.Fatalf("MigrateVaultConfig() = %d, %v; want %d", from, err, tt.want)
+			}
+			if (backup != "") != (from != tt.to) {
+				t.Errorf("backup = %q for a migration from %d to %d", backup, from, tt.to)
+			}
+		})
+	}
+}
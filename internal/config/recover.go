@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+)
+
+// Every save of vault.yaml first keeps the version it replaces as
+// vault.yaml.bak, shifting older copies to vault.yaml.bak.1 and so on. When
+// vault.yaml no longer parses, RestoreVaultConfig puts the newest backup that
+// does back in its place.
+
+// ErrDamagedConfig is returned for a vault.yaml that is empty or does not parse
+var ErrDamagedConfig = errors.New("vault configuration is damaged")
+
+// configBackups is how many previous versions of vault.yaml are kept
+const configBackups = 3
+
+// damagedSuffix names the copy of a damaged vault.yaml kept by a restore
+const damagedSuffix = ".damaged"
+
+// ConfigBackupPaths returns the backups of vault.yaml, newest first, whether
+// they exist or not
+func ConfigBackupPaths(vaultRoot string) []string {
+	base := filepath.Join(vaultRoot, "vault.yaml.bak")
+	paths := []string{base}
+	for i := 1; i < configBackups; i++ {
+		paths = append(paths, fmt.Sprintf("%s.%d", base, i))
+	}
+	return paths
+}
+
+// CheckVaultConfig reports whether the vault.yaml at vaultRoot parses. A
+// missing file is not damaged; it is reported by whatever loads it.
+func CheckVaultConfig(vaultRoot string) error {
+	data, err := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading vault configuration: %w", err)
+	}
+	return checkConfigData(data)
+}
+
+// RestoreVaultConfig replaces a damaged vault.yaml with the newest backup that
+// parses, keeping the damaged file as vault.yaml.damaged. It returns the
+// backup restored.
+func RestoreVaultConfig(vaultRoot string) (string, error) {
+	configPath := filepath.Join(vaultRoot, "vault.yaml")
+	for _, backup := range ConfigBackupPaths(vaultRoot) {
+		data, err := os.ReadFile(backup)
+		if err != nil || checkConfigData(data) != nil {
+			continue
+		}
+		if damaged, err := os.ReadFile(configPath); err == nil {
+			if err := atomic.WriteFile(configPath+damagedSuffix, damaged, 0o644); err != nil {
+				return "", fmt.Errorf("failed to keep the damaged vault configuration: %w", err)
+			}
+		}
+		if err := atomic.WriteFile(configPath, data, 0o644); err != nil {
+			return "", fmt.Errorf("failed to restore vault configuration: %w", err)
+		}
+		return backup, nil
+	}
+	return "", fmt.Errorf("%w and no backup of it can be read", ErrDamagedConfig)
+}
+
+// rotateConfigBackups keeps the current vault.yaml as the newest backup before
+// it is replaced. A damaged vault.yaml is not kept, so it never pushes out a
+// backup that could restore it.
+func rotateConfigBackups(vaultRoot string) error {
+	data, err := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if checkConfigData(data) != nil {
+		return nil
+	}
+
+	paths := ConfigBackupPaths(vaultRoot)
+	for i := len(paths) - 1; i > 0; i-- {
+		if err := os.Rename(paths[i-1], paths[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return atomic.WriteFile(paths[0], data, 0o644)
+}
+
+func checkConfigData(data []byte) error {
+	if strings.TrimSpace(string(data)) == "" {
+		return fmt.Errorf("%w: vault.yaml is empty", ErrDamagedConfig)
+	}
+	var config VaultConfig
+	if err := decodeChecked("vault.yaml", data, &config, false); err != nil {
+		return fmt.Errorf("%w: %v", ErrDamagedConfig, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSaveConfigRotatesBackups(t *testing.T) {
+	vaultRoot := t.TempDir()
+	for _, name := range []string{"one", "two", "three", "four", "five"} {
+		if err := SaveVaultConfig(vaultRoot, &VaultConfig{Name: name}); err != nil {
+			t.Fatalf("SaveVaultConfig(%s) error: %v", name, err)
+		}
+	}
+
+	// The three versions before the current one are kept, newest first
+	for i, want := range []string{"four", "three", "two"} {
+		data, err := os.ReadFile(ConfigBackupPaths(vaultRoot)[i])
+		if err != nil {
+			t.Fatalf("backup %d: %v", i, err)
+		}
+		if name := parseName(t, data); name != want {
+			t.Errorf("backup %d holds %q, want %q", i, name, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(vaultRoot, "vault.yaml.bak.3")); !os.IsNotExist(err) {
+		t.Errorf("a fourth backup was kept: %v", err)
+	}
+}
+
+func TestRestoreVaultConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		backups []string // contents of vault.yaml.bak, .bak.1, ...
+		want    int      // index of the backup restored, -1 for none
+	}{
+		{name: "newest backup", backups: []string{"name: b0\n", "name: b1\n"}, want: 0},
+		{name: "skips damaged backups", backups: []string{"", "name: [\n", "name: b2\n"}, want: 2},
+		{name: "no usable backup", backups: []string{"name: [\n"}, want: -1},
+		{name: "no backups", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			damaged := "name: [unterminated\n"
+			vaultRoot := writeVaultYAML(t, damaged)
+			for i, data := range tt.backups {
+				if err := os.WriteFile(ConfigBackupPaths(vaultRoot)[i], []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := CheckVaultConfig(vaultRoot); !errors.Is(err, ErrDamagedConfig) {
+				t.Fatalf("CheckVaultConfig() = %v, want ErrDamagedConfig", err)
+			}
+
+			backup, err := RestoreVaultConfig(vaultRoot)
+			if tt.want < 0 {
+				if !errors.Is(err, ErrDamagedConfig) {
+					t.Errorf("RestoreVaultConfig() error = %v, want ErrDamagedConfig", err)
+				}
+				return
+			}
+			if err != nil || backup != ConfigBackupPaths(vaultRoot)[tt.want] {
+				t.Fatalf("RestoreVaultConfig() = %q, %v; want backup %d", backup, err, tt.want)
+			}
+			if err := CheckVaultConfig(vaultRoot); err != nil {
+				t.Errorf("CheckVaultConfig() after restore = %v", err)
+			}
+			if data, err := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml.damaged")); err != nil || string(data) != damaged {
+				t.Errorf("damaged copy = %q, %v; want the damaged vault.yaml", data, err)
+			}
+		})
+	}
+}
+
+func parseName(t *testing.T, data []byte) string {
+	t.Helper()
+	var config VaultConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	return config.Name
+}
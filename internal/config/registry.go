@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+)
+
+// RegisteredVault is a vault known by name in ~/.config/sietch/vaults.yaml
+type RegisteredVault struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"` // Absolute path of the vault root
+	ID   string `yaml:"vault_id,omitempty"`
+}
+
+// Registry lists the vaults 'sietch init' and 'sietch scaffold' created, so
+// --vault can name them from anywhere
+type Registry struct {
+	Vaults []RegisteredVault `yaml:"vaults"`
+}
+
+// RegistryPath returns the path of the vault registry
+func RegistryPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".config", "sietch", "vaults.yaml"), nil
+}
+
+// LoadRegistry reads the vault registry; a missing file is an empty registry
+func LoadRegistry() (*Registry, error) {
+	path, err := RegistryPath()
+	if err != nil {
+		return nil, err
+	}
+	registry := &Registry{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, registry); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return registry, nil
+}
+
+// SaveRegistry writes the vault registry, creating its directory if needed
+func SaveRegistry(registry *Registry) error {
+	path, err := RegistryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(registry); err != nil {
+		return fmt.Errorf("failed to encode vault registry: %v", err)
+	}
+	return atomic.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Lookup returns the vault registered under name
+func (r *Registry) Lookup(name string) (RegisteredVault, bool) {
+	for _, vault := range r.Vaults {
+		if vault.Name == name {
+			return vault, true
+		}
+	}
+	return RegisteredVault{}, false
+}
+
+// Register records a vault and returns the name it was registered under. A
+// vault already registered at path keeps its entry, updated. A name taken by
+// another vault gets the start of the vault ID appended.
+func (r *Registry) Register(name, path, id string) (string, error) {
+	if !IsRegistryName(name) {
+		return "", fmt.Errorf("invalid vault name %q: names cannot contain path separators or start with '.'", name)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for i, vault := range r.Vaults {
+		if vault.Path == path {
+			r.Vaults[i].ID = id
+			return vault.Name, nil
+		}
+	}
+	if _, taken := r.Lookup(name); taken {
+		suffix := id
+		if len(suffix) > 8 {
+			suffix = suffix[:8]
+		}
+		name += "-" + suffix
+		if _, taken := r.Lookup(name); taken || suffix == "" {
+			return "", fmt.Errorf("a vault named %s is already registered", name)
+		}
+	}
+	r.Vaults = append(r.Vaults, RegisteredVault{Name: name, Path: path, ID: id})
+	return name, nil
+}
+
+// Forget removes the vault registered under name, reporting whether it was
+// registered. The vault itself is left alone.
+func (r *Registry) Forget(name string) bool {
+	for i, vault := range r.Vaults {
+		if vault.Name == name {
+			r.Vaults = append(r.Vaults[:i], r.Vaults[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// IsRegistryName reports whether value can name a registered vault rather than
+// only be a path: it is not empty and has no path separators or leading dot
+func IsRegistryName(value string) bool {
+	return value != "" && !strings.ContainsAny(value, `/\`) && !strings.HasPrefix(value, ".") && !filepath.IsAbs(value)
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	registry, err := LoadRegistry()
+	if err != nil || len(registry.Vaults) != 0 {
+		t.Fatalf("LoadRegistry() without a file = %+v, %v", registry, err)
+	}
+
+	photos := filepath.Join(t.TempDir(), "photos")
+	other := filepath.Join(t.TempDir(), "photos")
+	if name, err := registry.Register("photos", photos, "1234567890ab"); err != nil || name != "photos" {
+		t.Fatalf("Register() = %q, %v", name, err)
+	}
+	// Registering the same path again updates the entry
+	if name, err := registry.Register("renamed", photos, "ffff"); err != nil || name != "photos" || len(registry.Vaults) != 1 {
+		t.Errorf("Register() of a registered path = %q, %v with %d vaults", name, err, len(registry.Vaults))
+	}
+	// A taken name gets the start of the vault ID
+	if name, err := registry.Register("photos", other, "abcdef0123456789"); err != nil || name != "photos-abcdef01" {
+		t.Errorf("Register() of a taken name = %q, %v; want photos-abcdef01", name, err)
+	}
+	if _, err := registry.Register("a/b", other, "x"); err == nil {
+		t.Error("Register() accepted a name with a path separator")
+	}
+
+	if err := SaveRegistry(registry); err != nil {
+		t.Fatalf("SaveRegistry() error: %v", err)
+	}
+	registry, err = LoadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vault, ok := registry.Lookup("photos"); !ok || vault.Path != photos || vault.ID != "ffff" {
+		t.Errorf("Lookup(photos) = %+v, %v", vault, ok)
+	}
+	if !registry.Forget("photos") || registry.Forget("photos") {
+		t.Error("Forget() should remove a registered vault once")
+	}
+	if _, ok := registry.Lookup("photos-abcdef01"); !ok || len(registry.Vaults) != 1 {
+		t.Errorf("Forget() removed the wrong vault: %+v", registry.Vaults)
+	}
+
+	// A registered name is kept as the global default vault rather than made a path
+	if err := SaveRegistry(registry); err != nil {
+		t.Fatal(err)
+	}
+	global := &GlobalConfig{}
+	if err := SetGlobalSetting(global, "vault", "photos-abcdef01"); err != nil || global.Vault != "photos-abcdef01" {
+		t.Errorf("SetGlobalSetting(vault, name) = %q, %v", global.Vault, err)
+	}
+}
+
+func TestIsRegistryName(t *testing.T) {
+	for value, want := range map[string]bool{
+		"photos": true, "my vault": true, "": false, ".": false, "./photos": false,
+		"../photos": false, "vaults/photos": false, "/srv/photos": false,
+	} {
+		if got := IsRegistryName(value); got != want {
+			t.Errorf("IsRegistryName(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
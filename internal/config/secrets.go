@@ -0,0 +1,243 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/fs/private"
+)
+
+// From schema version 3 vault.yaml holds only settings that can be shared,
+// e.g. committed to git: where the keys are, KDF salts and key checks, keys
+// wrapped with the vault key and the sync private key are kept apart in
+// .sietch/secrets.yaml. Loading merges the two; saving splits them again.
+
+// secretsSchemaVersion is the first schema keeping secrets out of vault.yaml
+const secretsSchemaVersion = 3
+
+// VaultSecrets are the parts of the vault configuration that stay on the
+// machine holding the vault
+type VaultSecrets struct {
+	Encryption EncryptionSecrets `yaml:"encryption,omitempty"`
+	Sync       SyncSecrets       `yaml:"sync,omitempty"`
+}
+
+// EncryptionSecrets are the secret fields of EncryptionConfig
+type EncryptionSecrets struct {
+	KeyPath          string            `yaml:"key_path,omitempty"`
+	KeyFilePath      string            `yaml:"key_file_path,omitempty"`
+	KeyBackupPath    string            `yaml:"key_backup_path,omitempty"`
+	AES              *KDFSecrets       `yaml:"aes_config,omitempty"`
+	ChaCha           *KDFSecrets       `yaml:"chacha_config,omitempty"`
+	GPGPrivateKey    string            `yaml:"gpg_private_key,omitempty"`
+	AgeIdentityFile  string            `yaml:"age_identity_file,omitempty"`
+	PathKey          string            `yaml:"path_key,omitempty"`
+	IndexKey         string            `yaml:"index_key,omitempty"`
+	ConvergentSecret string            `yaml:"convergent_secret,omitempty"`
+	RecipientKeys    map[string]string `yaml:"recipient_keys,omitempty"` // Wrapped vault key by recipient fingerprint
+}
+
+// KDFSecrets are the secret fields of AESConfig and ChaChaConfig
+type KDFSecrets struct {
+	Key      string `yaml:"key,omitempty"`
+	Salt     string `yaml:"salt,omitempty"`
+	Nonce    string `yaml:"nonce,omitempty"`
+	IV       string `yaml:"iv,omitempty"`
+	KeyCheck string `yaml:"key_check,omitempty"`
+}
+
+// SyncSecrets are the secret fields of SyncConfig
+type SyncSecrets struct {
+	PrivateKeyPath string `yaml:"private_key_path,omitempty"`
+}
+
+// SecretsPath returns the path of the vault's secrets file
+func SecretsPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "secrets.yaml")
+}
+
+// SplitSecrets returns config without its secrets, and the secrets. config
+// itself is left as it is.
+func SplitSecrets(config *VaultConfig) (VaultConfig, VaultSecrets) {
+	public := *config
+	var secrets VaultSecrets
+	enc := &public.Encryption
+
+	secrets.Encryption.KeyPath, enc.KeyPath = enc.KeyPath, ""
+	secrets.Encryption.KeyFilePath, enc.KeyFilePath = enc.KeyFilePath, ""
+	secrets.Encryption.KeyBackupPath, enc.KeyBackupPath = enc.KeyBackupPath, ""
+	secrets.Encryption.PathKey, enc.PathKey = enc.PathKey, ""
+	secrets.Encryption.IndexKey, enc.IndexKey = enc.IndexKey, ""
+	if enc.AESConfig != nil {
+		aes := *enc.AESConfig
+		secrets.Encryption.AES = splitKDF(&aes.Key, &aes.Salt, &aes.Nonce, &aes.IV, &aes.KeyCheck)
+		enc.AESConfig = &aes
+	}
+	if enc.ChaChaConfig != nil {
+		chacha := *enc.ChaChaConfig
+		var iv string
+		secrets.Encryption.ChaCha = splitKDF(&chacha.Key, &chacha.Salt, &chacha.Nonce, &iv, &chacha.KeyCheck)
+		enc.ChaChaConfig = &chacha
+	}
+	if enc.GPGConfig != nil {
+		gpg := *enc.GPGConfig
+		secrets.Encryption.GPGPrivateKey, gpg.PrivateKey = gpg.PrivateKey, ""
+		enc.GPGConfig = &gpg
+	}
+	if enc.AgeConfig != nil {
+		age := *enc.AgeConfig
+		secrets.Encryption.AgeIdentityFile, age.IdentityFile = age.IdentityFile, ""
+		enc.AgeConfig = &age
+	}
+	if enc.Convergent != nil {
+		convergent := *enc.Convergent
+		secrets.Encryption.ConvergentSecret, convergent.Secret = convergent.Secret, ""
+		enc.Convergent = &convergent
+	}
+	if len(enc.Recipients) > 0 {
+		recipients := make([]Recipient, len(enc.Recipients))
+		secrets.Encryption.RecipientKeys = make(map[string]string, len(recipients))
+		for i, recipient := range enc.Recipients {
+			secrets.Encryption.RecipientKeys[recipient.Fingerprint] = recipient.WrappedKey
+			recipient.WrappedKey = ""
+			recipients[i] = recipient
+		}
+		enc.Recipients = recipients
+	}
+
+	if public.Sync.RSA != nil {
+		rsa := *public.Sync.RSA
+		secrets.Sync.PrivateKeyPath, rsa.PrivateKeyPath = rsa.PrivateKeyPath, ""
+		public.Sync.RSA = &rsa
+	}
+	return public, secrets
+}
+
+// splitKDF moves the secret KDF fields into a KDFSecrets, returning nil when
+// they are all empty
+func splitKDF(key, salt, nonce, iv, keyCheck *string) *KDFSecrets {
+	secrets := &KDFSecrets{Key: *key, Salt: *salt, Nonce: *nonce, IV: *iv, KeyCheck: *keyCheck}
+	*key, *salt, *nonce, *iv, *keyCheck = "", "", "", "", ""
+	if *secrets == (KDFSecrets{}) {
+		return nil
+	}
+	return secrets
+}
+
+// MergeSecrets fills config's secret fields from secrets. Fields secrets does
+// not set keep the value vault.yaml gave them, as in a vault.yaml from before
+// the split.
+func MergeSecrets(config *VaultConfig, secrets *VaultSecrets) {
+	enc := &config.Encryption
+	s := secrets.Encryption
+	mergeSecret(&enc.KeyPath, s.KeyPath)
+	mergeSecret(&enc.KeyFilePath, s.KeyFilePath)
+	mergeSecret(&enc.KeyBackupPath, s.KeyBackupPath)
+	mergeSecret(&enc.PathKey, s.PathKey)
+	mergeSecret(&enc.IndexKey, s.IndexKey)
+	if s.AES != nil {
+		if enc.AESConfig == nil {
+			enc.AESConfig = &AESConfig{}
+		}
+		mergeKDF(s.AES, &enc.AESConfig.Key, &enc.AESConfig.Salt, &enc.AESConfig.Nonce, &enc.AESConfig.IV, &enc.AESConfig.KeyCheck)
+	}
+	if s.ChaCha != nil {
+		if enc.ChaChaConfig == nil {
+			enc.ChaChaConfig = &ChaChaConfig{}
+		}
+		var iv string
+		mergeKDF(s.ChaCha, &enc.ChaChaConfig.Key, &enc.ChaChaConfig.Salt, &enc.ChaChaConfig.Nonce, &iv, &enc.ChaChaConfig.KeyCheck)
+	}
+	if s.GPGPrivateKey != "" && enc.GPGConfig != nil {
+		enc.GPGConfig.PrivateKey = s.GPGPrivateKey
+	}
+	if s.AgeIdentityFile != "" && enc.AgeConfig != nil {
+		enc.AgeConfig.IdentityFile = s.AgeIdentityFile
+	}
+	if s.ConvergentSecret != "" && enc.Convergent != nil {
+		enc.Convergent.Secret = s.ConvergentSecret
+	}
+	for i := range enc.Recipients {
+		mergeSecret(&enc.Recipients[i].WrappedKey, s.RecipientKeys[enc.Recipients[i].Fingerprint])
+	}
+	if config.Sync.RSA != nil {
+		mergeSecret(&config.Sync.RSA.PrivateKeyPath, secrets.Sync.PrivateKeyPath)
+	}
+}
+
+func mergeSecret(field *string, secret string) {
+	if secret != "" {
+		*field = secret
+	}
+}
+
+func mergeKDF(secrets *KDFSecrets, key, salt, nonce, iv, keyCheck *string) {
+	mergeSecret(key, secrets.Key)
+	mergeSecret(salt, secrets.Salt)
+	mergeSecret(nonce, secrets.Nonce)
+	mergeSecret(iv, secrets.IV)
+	mergeSecret(keyCheck, secrets.KeyCheck)
+}
+
+// LoadSecrets reads the vault's secrets file. A vault without one, such as a
+// vault from before the split, has no secrets apart from vault.yaml.
+func LoadSecrets(vaultRoot string) (*VaultSecrets, error) {
+	var secrets VaultSecrets
+	data, err := os.ReadFile(SecretsPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return &secrets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading vault secrets: %w", err)
+	}
+	if err := decodeChecked(SecretsPath(vaultRoot), data, &secrets, true); err != nil {
+		return nil, fmt.Errorf("error parsing vault secrets: %w", err)
+	}
+	return &secrets, nil
+}
+
+// saveSecrets writes the vault's secrets file, readable by its owner only
+func saveSecrets(vaultRoot string, secrets *VaultSecrets) error {
+	data, err := yaml.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault secrets: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(SecretsPath(vaultRoot)), 0o755); err != nil {
+		return fmt.Errorf("failed to create .sietch directory: %v", err)
+	}
+	if err := private.WriteFileAtomic(SecretsPath(vaultRoot), data); err != nil {
+		return fmt.Errorf("failed to write vault secrets: %v", err)
+	}
+	return nil
+}
+
+// SplitVaultConfig saves config's secrets to .sietch/secrets.yaml and returns
+// what is left for vault.yaml. Configurations older than the split are
+// returned whole.
+func SplitVaultConfig(vaultRoot string, config *VaultConfig) (*VaultConfig, error) {
+	if config.SchemaVersion < secretsSchemaVersion {
+		return config, nil
+	}
+	public, secrets := SplitSecrets(config)
+	if err := saveSecrets(vaultRoot, &secrets); err != nil {
+		return nil, err
+	}
+	return &public, nil
+}
+
+// ExportVaultConfig encodes config as vault.yaml holds it, without its secrets
+// when sanitized is set, whether or not the vault has split them off yet
+func ExportVaultConfig(config *VaultConfig, sanitized bool) ([]byte, error) {
+	if sanitized {
+		public, _ := SplitSecrets(config)
+		config = &public
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// secretVaultConfig returns a configuration with every kind of secret set
+func secretVaultConfig() *VaultConfig {
+	cfg := &VaultConfig{SchemaVersion: constants.VaultSchemaVersion, VaultID: "v", Name: "secretive"}
+	cfg.Encryption = EncryptionConfig{
+		Type:                "aes",
+		KeyPath:             "/home/me/vault/.sietch/keys/secret.key",
+		KeyHash:             "keyhash",
+		PassphraseProtected: true,
+		AESConfig:           &AESConfig{Key: "s-aeskey", Mode: "gcm", KDF: "scrypt", Salt: "salt", ScryptN: 32768, KeyCheck: "check"},
+		EncryptPaths:        true,
+		PathKey:             "pathkey",
+		EncryptIndex:        true,
+		IndexKey:            "indexkey",
+		Convergent:          &ConvergentConfig{Enabled: true, Secret: "s-convergent", SecretID: "sid"},
+		Recipients:          []Recipient{{Name: "laptop", Fingerprint: "fp1", PublicKey: "pem", WrappedKey: "s-recipient"}},
+	}
+	cfg.Sync.RSA = &RSAConfig{KeySize: 4096, PublicKeyPath: "sync_public.pem", PrivateKeyPath: "sync_private.pem"}
+	return cfg
+}
+
+func TestSplitAndMergeSecrets(t *testing.T) {
+	cfg := secretVaultConfig()
+	original := secretVaultConfig()
+
+	public, secrets := SplitSecrets(cfg)
+	if !reflect.DeepEqual(cfg, original) {
+		t.Fatal("SplitSecrets() changed the configuration it was given")
+	}
+
+	data, err := ExportVaultConfig(&public, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret.key", "s-aeskey", "salt", "check", "pathkey", "indexkey", "s-convergent", "s-recipient", "sync_private"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("public configuration still holds %q:\n%s", secret, data)
+		}
+	}
+	for _, kept := range []string{"keyhash", "scrypt", "sid", "fp1", "sync_public.pem"} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("public configuration lost %q:\n%s", kept, data)
+		}
+	}
+
+	MergeSecrets(&public, &secrets)
+	if !reflect.DeepEqual(&public, original) {
+		t.Errorf("merged configuration = %+v\nwant %+v", public.Encryption, original.Encryption)
+	}
+}
+
+func TestSaveConfigKeepsSecretsApart(t *testing.T) {
+	vaultRoot := t.TempDir()
+	if err := SaveVaultConfig(vaultRoot, secretVaultConfig()); err != nil {
+		t.Fatalf("SaveVaultConfig() error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "salt") || strings.Contains(string(data), "secret.key") {
+		t.Errorf("vault.yaml holds secrets:\n%s", data)
+	}
+	info, err := os.Stat(SecretsPath(vaultRoot))
+	if err != nil {
+		t.Fatalf("secrets file not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 && runtime.GOOS != "windows" {
+		t.Errorf("secrets file mode = %v, want 0600", perm)
+	}
+
+	loaded, err := LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatalf("LoadVaultConfig() error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Encryption, secretVaultConfig().Encryption) {
+		t.Errorf("loaded encryption = %+v, want the saved one", loaded.Encryption)
+	}
+}
+
+func TestLoadVaultConfigSplitsOlderSchema(t *testing.T) {
+	vaultRoot := writeVaultYAML(t, `schema_version: 2
+vault_id: v2
+name: unsplit
+encryption:
+  type: aes
+  key_path: /keys/secret.key
+  passphrase_protected: true
+  aes_config:
+    kdf: scrypt
+    salt: c2FsdA==
+    key_check: Y2hlY2s=
+`)
+
+	cfg, err := LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatalf("LoadVaultConfig() error: %v", err)
+	}
+	if cfg.Encryption.KeyPath != "/keys/secret.key" || cfg.Encryption.AESConfig.Salt != "c2FsdA==" {
+		t.Errorf("loaded key path, salt = %q, %q; want the vault's", cfg.Encryption.KeyPath, cfg.Encryption.AESConfig.Salt)
+	}
+
+	data, err := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "c2FsdA==") || strings.Contains(string(data), "/keys/secret.key") {
+		t.Errorf("migrated vault.yaml holds secrets:\n%s", data)
+	}
+	secrets, err := LoadSecrets(vaultRoot)
+	if err != nil || secrets.Encryption.AES == nil || secrets.Encryption.AES.KeyCheck != "Y2hlY2s=" {
+		t.Errorf("LoadSecrets() = %+v, %v; want the vault's key check", secrets, err)
+	}
+}
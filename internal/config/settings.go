@@ -0,0 +1,516 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/validate"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// ErrUnknownSetting is returned for keys that do not name a vault.yaml setting
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// settingRule describes a setting that `sietch config set` may change
+type settingRule struct {
+	validate func(value string) error
+	// When set, the setting can only change while the vault holds no data, for
+	// the given reason
+	needsEmptyVault string
+}
+
+// settableSettings are the vault.yaml keys that can be changed safely after
+// init. Everything else (vault identity, encryption, layout) is either fixed or
+// has its own migration command.
+var settableSettings = map[string]settingRule{
+	"name":                    {validate: notEmpty},
+	"compression":             {validate: oneOf(compression.Algorithms...)},
+	"compression_level":       {},
+	"compression_min_savings": {validate: intRange(0, 99)},
+	"verify_on_read":          {validate: oneOf("on", "off")},
+	"history_limit":           {validate: intRange(1, 1000000)},
+	"sign_operation_log":      {},
+
+	// Chunk addressing: changing these on a vault with data would orphan
+	// existing chunks or stop new files deduplicating against old ones
+	"chunking.strategy": {
+		validate:        oneOf("fixed", "cdc"),
+		needsEmptyVault: "existing files would no longer deduplicate against files added afterwards",
+	},
+	"chunking.chunk_size": {
+		validate:        positiveSize,
+		needsEmptyVault: "existing files would no longer deduplicate against files added afterwards",
+	},
+	"chunking.hash_algorithm": {
+		validate: oneOf(constants.HashAlgorithmSHA256, constants.HashAlgorithmSHA512,
+			constants.HashAlgorithmSHA1, constants.HashAlgorithmBLAKE3),
+		needsEmptyVault: "existing chunk IDs would become unreachable",
+	},
+	"chunking.whole_file":          {},
+	"chunking.max_chunks_per_file": {validate: intRange(1, 1<<30)},
+
+	"deduplication.enabled":        {},
+	"deduplication.strategy":       {validate: oneOf(constants.DedupStrategies...)},
+	"deduplication.min_chunk_size": {validate: size},
+	"deduplication.max_chunk_size": {validate: positiveSize},
+	"deduplication.gc_threshold":   {},
+	"deduplication.index_enabled":  {},
+
+	"packing.enabled":       {},
+	"packing.chunks":        {},
+	"packing.threshold":     {validate: positiveSize},
+	"packing.max_pack_size": {validate: positiveSize},
+
+	"store_retry.max_retries": {validate: intRange(-1, 100)},
+	"store_retry.base_delay":  {validate: duration},
+	"store_retry.max_delay":   {validate: duration},
+
+	"sync.enabled":       {},
+	"sync.auto_sync":     {},
+	"sync.sync_interval": {validate: duration},
+	"sync.allowed_hours": {validate: timeWindow},
+	"sync.advertise":     {},
+	"sync.conflict":      {validate: oneOf(constants.ConflictStrategies...)},
+
+	"metadata.author": {},
+	"metadata.tags":   {validate: validTags},
+}
+
+// SettableKeys returns the keys accepted by SetSetting, sorted
+func SettableKeys() []string {
+	keys := make([]string, 0, len(settableSettings))
+	for key := range settableSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// settingSectionAliases are shorter names accepted for vault.yaml sections
+var settingSectionAliases = map[string]string{
+	"dedup": "deduplication",
+}
+
+// CanonicalSettingKey returns the vault.yaml key a setting name refers to.
+// Besides the YAML names it accepts camelCase ("dedup.gcThreshold") and the
+// section aliases above.
+func CanonicalSettingKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		var b strings.Builder
+		for j, r := range part {
+			if r >= 'A' && r <= 'Z' {
+				if j > 0 {
+					b.WriteByte('_')
+				}
+				r += 'a' - 'A'
+			}
+			b.WriteRune(r)
+		}
+		parts[i] = b.String()
+	}
+	if alias, ok := settingSectionAliases[parts[0]]; ok {
+		parts[0] = alias
+	}
+	return strings.Join(parts, ".")
+}
+
+// ValidateSetting checks a value for one of the keys accepted by SetSetting
+func ValidateSetting(key, value string) error {
+	key = CanonicalSettingKey(key)
+	rule, ok := settableSettings[key]
+	if !ok {
+		return unknownSetting(key, SettableKeys())
+	}
+	if rule.validate != nil {
+		if err := rule.validate(value); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// GetSetting returns the value of a dotted vault.yaml key such as
+// "deduplication.min_chunk_size". Lists of strings are joined with commas;
+// sections are returned as YAML.
+func GetSetting(config *VaultConfig, key string) (string, error) {
+	field, err := lookupSetting(reflect.ValueOf(config).Elem(), CanonicalSettingKey(key))
+	if err != nil {
+		return "", err
+	}
+	return formatSetting(field)
+}
+
+// GetSettingValue returns the value of a dotted vault.yaml key in a form that
+// encodes to JSON: scalars keep their type, durations and times are strings,
+// and sections are maps keyed by their YAML names.
+func GetSettingValue(config *VaultConfig, key string) (any, error) {
+	field, err := lookupSetting(reflect.ValueOf(config).Elem(), CanonicalSettingKey(key))
+	if err != nil {
+		return nil, err
+	}
+	switch field.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		if d, ok := field.Interface().(time.Duration); ok {
+			return d.String(), nil
+		}
+		return field.Interface(), nil
+	case reflect.Ptr:
+		if field.IsNil() {
+			return nil, nil
+		}
+	case reflect.Struct:
+		if t, ok := field.Interface().(time.Time); ok {
+			return t.Format(time.RFC3339), nil
+		}
+	}
+
+	// Sections and lists go through YAML, so they carry the names vault.yaml uses
+	data, err := yaml.Marshal(field.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format setting: %v", err)
+	}
+	var value any
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to format setting: %v", err)
+	}
+	return jsonValue(value), nil
+}
+
+// jsonValue converts the maps yaml.v2 decodes into ones encoding/json accepts
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	}
+	return v
+}
+
+// SetSetting changes a dotted vault.yaml key on config, after checking that the
+// key may be changed and that the new value is valid. vaultRoot is used to
+// refuse changes that would strand data already in the vault. The caller saves
+// the configuration.
+func SetSetting(vaultRoot string, config *VaultConfig, key, value string) error {
+	key = CanonicalSettingKey(key)
+	rule, ok := settableSettings[key]
+	if !ok {
+		if _, err := lookupSetting(reflect.ValueOf(config).Elem(), key); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s cannot be changed with 'config set'", key)
+	}
+	if err := ValidateSetting(key, value); err != nil {
+		return err
+	}
+
+	updated := *config
+	field, err := lookupSetting(reflect.ValueOf(&updated).Elem(), key)
+	if err != nil {
+		return err
+	}
+	current, _ := formatSetting(field)
+	if current == value {
+		return nil
+	}
+	if err := parseSetting(field, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	if err := validateSettings(&updated); err != nil {
+		return err
+	}
+
+	if rule.needsEmptyVault != "" {
+		hasData, err := VaultHasData(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if hasData {
+			return fmt.Errorf("cannot change %s on a vault that already holds data: %s; "+
+				"'sietch vault rechunk' migrates the stored files to new chunking settings", key, rule.needsEmptyVault)
+		}
+	}
+
+	if strings.HasPrefix(key, "metadata.") {
+		updated.Metadata.UpdatedAt = time.Now().UTC()
+	}
+	*config = updated
+	return nil
+}
+
+// VaultHasData reports whether a vault has any file manifests or stored chunks
+func VaultHasData(vaultRoot string) (bool, error) {
+	errFound := errors.New("found")
+	err := ScanManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(*ManifestEntry) error {
+		return errFound
+	})
+	if err == errFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	hashes, err := layout.ListChunkHashes(vaultRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to list chunks: %v", err)
+	}
+	return len(hashes) > 0, nil
+}
+
+// CheckHashAlgorithm refuses a vault whose configured hash algorithm differs
+// from the one its files were added with, as happens when vault.yaml is edited
+// by hand. Chunks hashed one way cannot be found, verified or deduplicated the
+// other way. Manifests written before the algorithm was recorded are not checked.
+func CheckHashAlgorithm(vaultRoot string, config *VaultConfig) error {
+	var recorded string
+	errFound := errors.New("found")
+	// Runs before every add: any one recorded manifest will do, so the
+	// directory is not listed in full
+	err := ScanManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(entry *ManifestEntry) error {
+		if entry.Manifest.Chunking == nil || entry.Manifest.Chunking.HashAlgorithm == "" {
+			return nil // Packed file, or added before the algorithm was recorded
+		}
+		recorded = entry.Manifest.Chunking.HashAlgorithm
+		return errFound
+	})
+	if err != nil && err != errFound {
+		return err
+	}
+	if recorded == "" {
+		return nil
+	}
+	configured := config.Chunking.HashAlgorithm
+	if configured == "" {
+		configured = constants.HashAlgorithmSHA256
+	}
+	if configured != recorded {
+		return fmt.Errorf("vault.yaml sets chunking.hash_algorithm to %s but the vault's files were added with %s; "+
+			"restore hash_algorithm: %s, as chunks cannot be addressed under a different algorithm, "+
+			"then run 'sietch vault rechunk --hash-algorithm %s' to migrate", configured, recorded, recorded, configured)
+	}
+	return nil
+}
+
+// validateSettings checks the constraints between settings
+func validateSettings(config *VaultConfig) error {
+	if err := compression.ValidateLevel(config.Compression, config.CompressionLevel); err != nil {
+		return fmt.Errorf("compression_level: %v", err)
+	}
+	return ValidateChunkSizes(config.Chunking, config.Deduplication)
+}
+
+// lookupSetting follows a dotted key through the yaml field names of v
+func lookupSetting(v reflect.Value, key string) (reflect.Value, error) {
+	if key == "" {
+		return reflect.Value{}, fmt.Errorf("%w: empty key", ErrUnknownSetting)
+	}
+	names := strings.Split(key, ".")
+	for i, name := range names {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				// Unset sections read as their zero value
+				v = reflect.New(v.Type().Elem())
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%w: %s", ErrUnknownSetting, key)
+		}
+		field, ok := yamlField(v, name)
+		if !ok {
+			// Suggest the key with this part replaced by the nearest field name
+			var known []string
+			for _, sibling := range yamlFieldNames(v.Type()) {
+				known = append(known, strings.Join(append(names[:i:i], sibling), "."))
+			}
+			return reflect.Value{}, unknownSetting(strings.Join(names[:i+1], "."), known)
+		}
+		v = field
+	}
+	return v, nil
+}
+
+// unknownSetting returns ErrUnknownSetting for key, naming the known key it is
+// closest to
+func unknownSetting(key string, known []string) error {
+	if suggestion := validate.Suggest(key, known); suggestion != "" {
+		return fmt.Errorf("%w: %s (did you mean %s?)", ErrUnknownSetting, key, suggestion)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownSetting, key)
+}
+
+// yamlFieldNames returns the yaml names of the fields of struct type t
+func yamlFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]; tag != "" && tag != "-" {
+			names = append(names, tag)
+		}
+	}
+	return names
+}
+
+// yamlField returns the field of struct v whose yaml name is name
+func yamlField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// formatSetting renders a setting value the way SetSetting accepts it
+func formatSetting(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int64:
+		if t, ok := v.Interface().(time.Duration); ok {
+			return t.String(), nil
+		}
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return strings.Join(v.Interface().([]string), ","), nil
+		}
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t.Format(time.RFC3339), nil
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "", nil
+		}
+	}
+	data, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return "", fmt.Errorf("failed to format setting: %v", err)
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+// parseSetting stores value into a scalar setting
+func parseSetting(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("expected a non-negative whole number")
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("lists can only be edited in vault.yaml")
+		}
+		// Rebuilt rather than modified, so the original config keeps its slice
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("not a single value")
+	}
+	return nil
+}
+
+func notEmpty(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("cannot be empty")
+	}
+	return nil
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		if suggestion := validate.Suggest(value, allowed); suggestion != "" {
+			return fmt.Errorf("must be one of %s (did you mean %s?)", strings.Join(allowed, ", "), suggestion)
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+func size(value string) error {
+	if _, err := util.ParseChunkSize(value); err != nil {
+		return fmt.Errorf("%v (expected a number with an optional unit, e.g. 4MB or 512KB)", err)
+	}
+	return nil
+}
+
+func positiveSize(value string) error {
+	n, err := util.ParseChunkSize(value)
+	if err != nil {
+		return fmt.Errorf("%v (expected a number with an optional unit, e.g. 4MB or 512KB)", err)
+	}
+	if n <= 0 {
+		return fmt.Errorf("must be larger than zero")
+	}
+	return nil
+}
+
+func duration(value string) error {
+	if _, err := time.ParseDuration(value); err != nil {
+		return fmt.Errorf("expected a duration such as 30m or 24h")
+	}
+	return nil
+}
+
+// timeWindow accepts HH:MM-HH:MM, or empty to allow any time
+func timeWindow(value string) error {
+	if value == "" {
+		return nil
+	}
+	_, err := util.ParseTimeWindow(value)
+	return err
+}
+
+func intRange(min, max int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("expected a whole number from %d to %d", min, max)
+		}
+		return nil
+	}
+}
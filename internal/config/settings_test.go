@@ -0,0 +1,266 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetSetting(t *testing.T) {
+	cfg := &VaultConfig{Compression: "gzip"}
+	cfg.Deduplication.MinChunkSize = "1KB"
+	cfg.Metadata.Tags = []string{"photos", "archive"}
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr error
+	}{
+		{"compression", "gzip", nil},
+		{"deduplication.min_chunk_size", "1KB", nil},
+		{"deduplication.enabled", "false", nil},
+		{"metadata.tags", "photos,archive", nil},
+		{"dedup.minChunkSize", "1KB", nil},
+		{"encryption.aes_config.mode", "", nil},
+		{"chunking.nope", "", ErrUnknownSetting},
+		{"compression.level", "", ErrUnknownSetting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := GetSetting(cfg, tt.key)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("GetSetting(%q) = %q, %v; want %q, %v", tt.key, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+	if cfg.Encryption.AESConfig != nil {
+		t.Error("GetSetting() filled in an unset section")
+	}
+}
+
+func TestSetSetting(t *testing.T) {
+	emptyVault := t.TempDir()
+	fullVault := t.TempDir()
+	manifests := filepath.Join(fullVault, ".sietch", "manifests")
+	if err := os.MkdirAll(manifests, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(manifests, "a.yaml"), []byte("file: a.txt\nsize: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		vaultRoot string
+		key       string
+		value     string
+		wantErr   bool
+	}{
+		{"compression", fullVault, "compression", "zstd", false},
+		{"bad compression", fullVault, "compression", "lz77", true},
+		{"compression level", fullVault, "compression_level", "0", false},
+		{"level for no compression", fullVault, "compression_level", "3", true},
+		{"min savings", fullVault, "compression_min_savings", "20", false},
+		{"min savings out of range", fullVault, "compression_min_savings", "100", true},
+		{"verify on read", fullVault, "verify_on_read", "off", false},
+		{"verify on read invalid", fullVault, "verify_on_read", "sometimes", true},
+		{"size", fullVault, "deduplication.min_chunk_size", "8KB", false},
+		{"bad size", fullVault, "chunking.chunk_size", "0", true},
+		{"min above max", fullVault, "deduplication.min_chunk_size", "1GB", true},
+		{"min above chunk size", fullVault, "deduplication.min_chunk_size", "8MB", true},
+		{"chunk size above max", emptyVault, "chunking.chunk_size", "128MB", true},
+		{"bool", fullVault, "deduplication.enabled", "false", false},
+		{"bad bool", fullVault, "deduplication.enabled", "maybe", true},
+		{"int", fullVault, "deduplication.gc_threshold", "50", false},
+		{"negative int", fullVault, "deduplication.gc_threshold", "-1", true},
+		{"hash algorithm on empty vault", emptyVault, "chunking.hash_algorithm", "blake3", false},
+		{"hash algorithm on vault with data", fullVault, "chunking.hash_algorithm", "blake3", true},
+		{"unchanged hash algorithm", fullVault, "chunking.hash_algorithm", "sha256", false},
+		{"chunk size on empty vault", emptyVault, "chunking.chunk_size", "8MB", false},
+		{"chunk size on vault with data", fullVault, "chunking.chunk_size", "8MB", true},
+		{"strategy on vault with data", fullVault, "chunking.strategy", "cdc", true},
+		{"encryption", emptyVault, "encryption.type", "none", true},
+		{"vault id", emptyVault, "vault_id", "x", true},
+		{"unknown", emptyVault, "nope", "x", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &VaultConfig{Compression: "none"}
+			cfg.Chunking.HashAlgorithm = "sha256"
+			cfg.Chunking.ChunkSize = "4MB"
+			cfg.Deduplication.Enabled = true
+			cfg.Deduplication.MinChunkSize = "1KB"
+			cfg.Deduplication.MaxChunkSize = "64MB"
+			before := *cfg
+
+			err := SetSetting(tt.vaultRoot, cfg, tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetSetting(%s=%s) error = %v, wantErr %v", tt.key, tt.value, err, tt.wantErr)
+			}
+			got, _ := GetSetting(cfg, tt.key)
+			if tt.wantErr {
+				if !reflect.DeepEqual(cfg, &before) {
+					t.Errorf("rejected SetSetting() changed the config: %+v", cfg)
+				}
+			} else if got != tt.value {
+				t.Errorf("after SetSetting(%s=%s), GetSetting() = %q", tt.key, tt.value, got)
+			}
+		})
+	}
+}
+
+func TestSetSettingTags(t *testing.T) {
+	cfg := &VaultConfig{}
+	original := []string{"old"}
+	cfg.Metadata.Tags = original
+	if err := SetSetting(t.TempDir(), cfg, "metadata.tags", " photos, archive ,"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetSetting(cfg, "metadata.tags"); got != "photos,archive" {
+		t.Errorf("tags = %q, want photos,archive", got)
+	}
+	if original[0] != "old" {
+		t.Error("SetSetting() modified the previous tag slice")
+	}
+}
+
+func TestSettingSuggestions(t *testing.T) {
+	cfg := &VaultConfig{}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"unknown key", SetSetting(t.TempDir(), cfg, "compresion", "zstd"), "unknown setting: compresion (did you mean compression?)"},
+		{"unknown nested key", SetSetting(t.TempDir(), cfg, "chunking.chunk_sise", "1MB"), "unknown setting: chunking.chunk_sise (did you mean chunking.chunk_size?)"},
+		{"aliased section", ValidateSetting("dedup.enabeld", "true"), "unknown setting: deduplication.enabeld (did you mean deduplication.enabled?)"},
+		{"near-miss value", ValidateSetting("compression", "zstdd"), "invalid value for compression: must be one of none, gzip, zstd, lz4, brotli (did you mean zstd?)"},
+		{"no close value", ValidateSetting("chunking.strategy", "rolling"), "invalid value for chunking.strategy: must be one of fixed, cdc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil || tt.err.Error() != tt.want {
+				t.Errorf("error = %v, want %q", tt.err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalSettingKey(t *testing.T) {
+	tests := map[string]string{
+		"compression":                  "compression",
+		"deduplication.gc_threshold":   "deduplication.gc_threshold",
+		"dedup.gcThreshold":            "deduplication.gc_threshold",
+		"storeRetry.maxRetries":        "store_retry.max_retries",
+		"chunking.hash_algorithm":      "chunking.hash_algorithm",
+		"metadata.dedup":               "metadata.dedup",
+		"compressionMinSavings":        "compression_min_savings",
+		"deduplication.min_chunk_size": "deduplication.min_chunk_size",
+	}
+	for key, want := range tests {
+		if got := CanonicalSettingKey(key); got != want {
+			t.Errorf("CanonicalSettingKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestGetSettingValue(t *testing.T) {
+	cfg := &VaultConfig{Compression: "zstd"}
+	cfg.Deduplication.Enabled = true
+	cfg.Deduplication.GCThreshold = 500
+
+	tests := []struct {
+		key  string
+		want any
+	}{
+		{"compression", "zstd"},
+		{"dedup.gcThreshold", 500},
+		{"deduplication.enabled", true},
+		{"encryption.aes_config", nil},
+	}
+	for _, tt := range tests {
+		if got, err := GetSettingValue(cfg, tt.key); err != nil || got != tt.want {
+			t.Errorf("GetSettingValue(%q) = %#v, %v; want %#v", tt.key, got, err, tt.want)
+		}
+	}
+
+	section, err := GetSettingValue(cfg, "deduplication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := section.(map[string]any); !ok || m["gc_threshold"] != 500 || m["enabled"] != true {
+		t.Errorf("GetSettingValue(deduplication) = %#v, want a map keyed by YAML names", section)
+	}
+}
+
+func TestCheckHashAlgorithm(t *testing.T) {
+	writeManifest := func(t *testing.T, vaultRoot, name, content string) {
+		t.Helper()
+		dir := filepath.Join(vaultRoot, ".sietch", "manifests")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorded := t.TempDir()
+	writeManifest(t, recorded, "a.yaml", "file: a.txt\nchunking:\n  strategy: fixed\n  chunk_size: 1024\n  hash_algorithm: blake3\n")
+	legacy := t.TempDir()
+	writeManifest(t, legacy, "a.yaml", "file: a.txt\nchunking:\n  strategy: fixed\n  chunk_size: 1024\n")
+	mixed := t.TempDir()
+	writeManifest(t, mixed, "a.yaml", "file: a.txt\nchunking:\n  strategy: fixed\n  chunk_size: 1024\n")
+	writeManifest(t, mixed, "b.yaml", "file: b.txt\nchunking:\n  strategy: fixed\n  chunk_size: 1024\n  hash_algorithm: blake3\n")
+
+	tests := []struct {
+		name      string
+		vaultRoot string
+		algorithm string
+		wantErr   bool
+	}{
+		{"empty vault", t.TempDir(), "sha512", false},
+		{"matching", recorded, "blake3", false},
+		{"edited", recorded, "sha256", true},
+		{"edited to the default", recorded, "", true},
+		{"not recorded", legacy, "sha512", false},
+		{"mixed", mixed, "sha256", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &VaultConfig{}
+			cfg.Chunking.HashAlgorithm = tt.algorithm
+			if err := CheckHashAlgorithm(tt.vaultRoot, cfg); (err != nil) != tt.wantErr {
+				t.Errorf("CheckHashAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateChunkSizes(t *testing.T) {
+	bounds := DeduplicationConfig{MinChunkSize: "1KB", MaxChunkSize: "64MB"}
+	tests := []struct {
+		name     string
+		chunking ChunkingConfig
+		dedup    DeduplicationConfig
+		wantErr  bool
+	}{
+		{"within bounds", ChunkingConfig{ChunkSize: "4MB"}, bounds, false},
+		{"no bounds", ChunkingConfig{ChunkSize: "1"}, DeduplicationConfig{}, false},
+		{"at the minimum", ChunkingConfig{ChunkSize: "1KB"}, bounds, true},
+		{"above the maximum", ChunkingConfig{ChunkSize: "128MB"}, bounds, true},
+		{"zero minimum", ChunkingConfig{ChunkSize: "4MB"}, DeduplicationConfig{MinChunkSize: "0", MaxChunkSize: "64MB"}, true},
+		{"missing maximum", ChunkingConfig{ChunkSize: "4MB"}, DeduplicationConfig{MinChunkSize: "1KB"}, true},
+		{"minimum above maximum", ChunkingConfig{ChunkSize: "4MB"}, DeduplicationConfig{MinChunkSize: "64MB", MaxChunkSize: "1KB"}, true},
+		{"policy within bounds", ChunkingConfig{ChunkSize: "4MB", Policies: []ChunkPolicy{{Pattern: "*.mp4", ChunkSize: "16MB"}}}, bounds, false},
+		{"policy above the maximum", ChunkingConfig{ChunkSize: "4MB", Policies: []ChunkPolicy{{Pattern: "*.mp4", ChunkSize: "1GB"}}}, bounds, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateChunkSizes(tt.chunking, tt.dedup); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateChunkSizes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
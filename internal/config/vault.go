@@ -3,9 +3,12 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/util"
 )
 
 // VaultConfig represents the structure for vault.yaml
@@ -14,13 +17,42 @@ type VaultConfig struct {
 	VaultID       string    `yaml:"vault_id"`
 	CreatedAt     time.Time `yaml:"created_at"`
 	SchemaVersion int       `yaml:"schema_version"`
+	// How file manifests and the index snapshot are stored; 0 and 1 are plain,
+	// 2 is zstd compressed. Set by 'sietch vault compact'.
+	ManifestFormat int `yaml:"manifest_format,omitempty"`
+
+	Encryption       EncryptionConfig `yaml:"encryption"`
+	Chunking         ChunkingConfig   `yaml:"chunking"`
+	Compression      string           `yaml:"compression"`
+	CompressionLevel int              `yaml:"compression_level,omitempty"` // 0 = the algorithm's default
+	// Chunks that compress by less than this percentage are stored uncompressed; 0 = 5%
+	CompressionMinSavings int `yaml:"compression_min_savings,omitempty"`
+	// Per-pattern compression overrides, evaluated in order; the first match wins
+	CompressionPolicies []CompressionPolicy `yaml:"compression_policies,omitempty"`
+	// zstd dictionary used for small files; set by 'sietch compress train-dict'
+	CompressionDict *CompressionDictConfig `yaml:"compression_dict,omitempty"`
+	Deduplication   DeduplicationConfig    `yaml:"deduplication"`
+	Packing         PackingConfig          `yaml:"packing,omitempty"`
+	SharedStore     SharedStoreConfig      `yaml:"shared_store,omitempty"`
+	StoreRetry      StoreRetryConfig       `yaml:"store_retry,omitempty"`
+	Sync            SyncConfig             `yaml:"sync"`
+	Metadata        MetadataConfig         `yaml:"metadata"`
+	// Whether reads check each chunk against its hash: "on" (the default when
+	// empty) or "off". 'sietch get --verify' overrides it.
+	VerifyOnRead string `yaml:"verify_on_read,omitempty"`
+	// Set by 'sietch vault freeze': commands that change the vault refuse to
+	// run until 'sietch vault thaw' clears it
+	ReadOnly bool `yaml:"read_only,omitempty"`
+	// Number of configuration changes .sietch/history.jsonl keeps; 0 = 1000
+	HistoryLimit int `yaml:"history_limit,omitempty"`
+	// Whether entries of the operation log (.sietch/log) are signed with the
+	// vault's sync key
+	SignOperationLog bool `yaml:"sign_operation_log,omitempty"`
+}
 
-	Encryption    EncryptionConfig    `yaml:"encryption"`
-	Chunking      ChunkingConfig      `yaml:"chunking"`
-	Compression   string              `yaml:"compression"`
-	Deduplication DeduplicationConfig `yaml:"deduplication"`
-	Sync          SyncConfig          `yaml:"sync"`
-	Metadata      MetadataConfig      `yaml:"metadata"`
+// VerifiesOnRead reports whether reads check chunk hashes by default
+func (c *VaultConfig) VerifiesOnRead() bool {
+	return c.VerifyOnRead != "off"
 }
 
 // EncryptionConfig contains encryption settings
@@ -36,6 +68,39 @@ type EncryptionConfig struct {
 	AESConfig           *AESConfig    `yaml:"aes_config,omitempty"`      // AES specific settings
 	GPGConfig           *GPGConfig    `yaml:"gpg_config,omitempty"`      // GPG specific settings
 	ChaChaConfig        *ChaChaConfig `yaml:"chacha_config,omitempty"`   // ChaCha20 specific settings
+	AgeConfig           *AgeConfig    `yaml:"age_config,omitempty"`      // Set when the key file is age-wrapped
+	EncryptPaths        bool          `yaml:"encrypt_paths,omitempty"`   // Whether manifests store file paths encrypted
+	PathKey             string        `yaml:"path_key,omitempty"`        // Path encryption key, wrapped with the vault key
+	EncryptIndex        bool          `yaml:"encrypt_index,omitempty"`   // Whether the dedup index is stored encrypted
+	IndexKey            string        `yaml:"index_key,omitempty"`       // Dedup index key, wrapped with the vault key
+
+	Convergent *ConvergentConfig `yaml:"convergent,omitempty"` // Convergent chunk encryption settings
+	Recipients []Recipient       `yaml:"recipients,omitempty"` // Copies of the vault key wrapped for other keys
+}
+
+// Recipient is a copy of the vault key wrapped with someone's RSA public key, so
+// that the matching private key can open the vault without the key file
+type Recipient struct {
+	Name        string    `yaml:"name"`
+	Fingerprint string    `yaml:"fingerprint"` // Fingerprint of the public key
+	PublicKey   string    `yaml:"public_key"`  // PEM encoded public key
+	WrappedKey  string    `yaml:"wrapped_key"` // RSA-OAEP encrypted vault key, base64
+	AddedAt     time.Time `yaml:"added_at"`
+}
+
+// ConvergentConfig contains the settings for convergent chunk encryption, where
+// identical chunks encrypt identically for every vault sharing the secret
+type ConvergentConfig struct {
+	Enabled  bool   `yaml:"enabled"`             // Whether new chunks are encrypted convergently
+	Secret   string `yaml:"secret"`              // Mixing secret, wrapped with the vault key
+	SecretID string `yaml:"secret_id,omitempty"` // Fingerprint of the secret, safe to compare with peers
+}
+
+// AgeConfig marks a key file holding the data key encrypted to age X25519
+// recipients instead of the raw key
+type AgeConfig struct {
+	Recipients   []string `yaml:"recipients"`              // age1... recipients the key is wrapped for
+	IdentityFile string   `yaml:"identity_file,omitempty"` // age identity file used when SIETCH_IDENTITY is unset
 }
 
 // AESConfig contains AES-specific encryption settings
@@ -81,6 +146,37 @@ type ChunkingConfig struct {
 	Strategy      string `yaml:"strategy"`
 	ChunkSize     string `yaml:"chunk_size"`
 	HashAlgorithm string `yaml:"hash_algorithm"`
+	LayoutVersion int    `yaml:"layout_version,omitempty"` // Chunk storage layout; 0/1 = flat, 2 = sharded by hash prefix, 3 = two shard levels
+	WholeFile     bool   `yaml:"whole_file,omitempty"`     // Store files below the dedup min_chunk_size as one blob, unsplit
+
+	// Files split into more chunks than this are refused by add; 0 = the default
+	MaxChunksPerFile int `yaml:"max_chunks_per_file,omitempty"`
+
+	// Per-pattern overrides evaluated at add time; the first matching policy wins
+	Policies []ChunkPolicy `yaml:"policies,omitempty"`
+}
+
+// ChunkPolicy overrides the chunking settings for files matching a glob pattern.
+// Patterns without a "/" match the file name, otherwise the full vault path.
+type ChunkPolicy struct {
+	Pattern   string `yaml:"pattern"`              // e.g. "*.jpg" or "db/*.sql"
+	Strategy  string `yaml:"strategy,omitempty"`   // Empty keeps the vault strategy
+	ChunkSize string `yaml:"chunk_size,omitempty"` // Chunk size (average size for cdc); empty keeps the vault size
+}
+
+// CompressionPolicy overrides the compression of files matching a glob pattern
+type CompressionPolicy struct {
+	Pattern     string `yaml:"pattern"`         // e.g. "*.csv" or "logs/*.txt"
+	Compression string `yaml:"compression"`     // Algorithm, e.g. "zstd" or "none"
+	Level       int    `yaml:"level,omitempty"` // 0 = the algorithm's default
+}
+
+// CompressionDictConfig selects the zstd dictionary new small files are
+// compressed with. Chunks record the dictionary they used, so older
+// dictionaries stay readable after a new one is trained.
+type CompressionDictConfig struct {
+	ID          string `yaml:"id"`            // Dictionary stored as .sietch/compression/dict-<id>
+	MaxFileSize string `yaml:"max_file_size"` // Files up to this size use the dictionary
 }
 
 // DeduplicationConfig contains settings for chunk deduplication
@@ -92,6 +188,38 @@ type DeduplicationConfig struct {
 	GCThreshold  int    `yaml:"gc_threshold"`   // Unreferenced chunk count before GC suggestion
 	IndexEnabled bool   `yaml:"index_enabled"`  // Enable chunk index for faster lookups
 	// CrossFileDedup bool   `yaml:"cross_file_dedup"` // Enable deduplication across different files
+	Scopes []DedupScope `yaml:"scopes,omitempty"` // Path prefixes whose files only share chunks with each other
+}
+
+// DedupScope puts the files under a vault path prefix in a named dedup scope.
+// Chunks are only reused between files of the same scope; files outside every
+// scope form the default scope.
+type DedupScope struct {
+	Prefix string `yaml:"prefix"` // e.g. "work/"
+	Name   string `yaml:"name"`   // Scopes may share a name to dedup across several prefixes
+}
+
+// PackingConfig contains settings for storing small files in shared pack blobs
+// and small chunks in chunk packs
+type PackingConfig struct {
+	Enabled     bool   `yaml:"enabled"`                 // Pack files below Threshold instead of chunking them
+	Chunks      bool   `yaml:"chunks,omitempty"`        // Move stored chunks below Threshold into chunk packs during 'sietch dedup gc'
+	Threshold   string `yaml:"threshold,omitempty"`     // Files and chunks smaller than this are packed (default 64KB)
+	MaxPackSize string `yaml:"max_pack_size,omitempty"` // Plaintext size at which a pack is sealed (default 8MB)
+}
+
+// SharedStoreConfig points the vault at a chunk store shared with other vaults.
+// Manifests stay in the vault; chunks and the deduplication index live in the store.
+type SharedStoreConfig struct {
+	Path string `yaml:"path,omitempty"` // Absolute path of the shared store; empty when chunks are stored in the vault
+}
+
+// StoreRetryConfig controls how chunk reads and writes that fail with a
+// transient error, e.g. on a flaky network mount, are retried
+type StoreRetryConfig struct {
+	MaxRetries int    `yaml:"max_retries,omitempty"` // Retries after the first attempt (default 3); -1 disables them
+	BaseDelay  string `yaml:"base_delay,omitempty"`  // Delay before the first retry, doubled for each one after it (default 100ms)
+	MaxDelay   string `yaml:"max_delay,omitempty"`   // Longest delay between attempts (default 5s)
 }
 
 // SyncConfig contains synchronization settings
@@ -102,30 +230,52 @@ type SyncConfig struct {
 	Enabled      bool       `yaml:"enabled"`
 	AutoSync     bool       `yaml:"auto_sync,omitempty"`
 	SyncInterval string     `yaml:"sync_interval,omitempty"`
+	AllowedHours string     `yaml:"allowed_hours,omitempty"` // Daily window (22:00-06:00) outside which sync refuses to start
+	Advertise    bool       `yaml:"advertise,omitempty"`     // Announce the vault on the local network while sync runs
+	Conflict     string     `yaml:"conflict,omitempty"`      // Conflict strategy when --conflict is not given; manual by default
 }
 
-// RSAConfig contains RSA key configuration for sync operations
+// RSAConfig contains the sync identity key configuration. Despite the name
+// (kept for compatibility with existing vault.yaml files) the key may be RSA
+// or Ed25519; KeyType is empty for vaults created before Ed25519 support.
 type RSAConfig struct {
-	KeySize        int           `yaml:"key_size"`
+	KeyType        string        `yaml:"key_type,omitempty"` // rsa (default) or ed25519
+	KeySize        int           `yaml:"key_size"`           // RSA modulus size in bits; unused for ed25519
 	PublicKeyPath  string        `yaml:"public_key_path,omitempty"`
 	PrivateKeyPath string        `yaml:"private_key_path,omitempty"`
 	Fingerprint    string        `yaml:"fingerprint,omitempty"`
 	TrustedPeers   []TrustedPeer `yaml:"trusted_peers,omitempty"`
 }
 
+// IdentityKeyType returns the sync identity key type, defaulting to rsa
+func (c *RSAConfig) IdentityKeyType() string {
+	if c == nil || c.KeyType == "" {
+		return constants.SyncKeyTypeRSA
+	}
+	return c.KeyType
+}
+
 // TrustedPeer stores information about a trusted peer
 type TrustedPeer struct {
-	ID           string    `yaml:"id"`
-	Name         string    `yaml:"name,omitempty"`
-	PublicKey    string    `yaml:"public_key"`
-	Fingerprint  string    `yaml:"fingerprint"`
-	TrustedSince time.Time `yaml:"trusted_since"`
+	ID             string    `yaml:"id"`
+	Name           string    `yaml:"name,omitempty"`
+	VaultID        string    `yaml:"vault_id,omitempty"` // ID of the peer's vault, once it authenticated
+	KeyType        string    `yaml:"key_type,omitempty"` // rsa or ed25519; empty means rsa
+	PublicKey      string    `yaml:"public_key"`         // PEM encoded PKIX public key
+	Fingerprint    string    `yaml:"fingerprint"`
+	TrustedSince   time.Time `yaml:"trusted_since"`
+	BandwidthLimit string    `yaml:"bandwidth_limit,omitempty"` // Rate syncs with the peer are limited to, e.g. 500KB/s
+	Verified       bool      `yaml:"verified,omitempty"`        // The fingerprint was checked with the peer's owner
+	Revoked        bool      `yaml:"revoked,omitempty"`         // Syncs with the peer are refused
+	RevokedAt      time.Time `yaml:"revoked_at,omitempty"`
 }
 
 // MetadataConfig contains user metadata
 type MetadataConfig struct {
-	Author string   `yaml:"author"`
-	Tags   []string `yaml:"tags"`
+	Author    string            `yaml:"author" json:"author"`
+	Tags      []string          `yaml:"tags" json:"tags"`
+	Fields    map[string]string `yaml:"fields,omitempty" json:"fields,omitempty"`         // Freeform key/value metadata
+	UpdatedAt time.Time         `yaml:"updated_at,omitempty" json:"updated_at,omitempty"` // Last edit, which wins when peers disagree
 }
 
 // KeyConfig is the internal structure returned by key generation functions
@@ -135,22 +285,72 @@ type KeyConfig struct {
 	AESConfig    *AESConfig    `yaml:"aes_config,omitempty"`
 	ChaChaConfig *ChaChaConfig `yaml:"chacha_config,omitempty"`
 	GPGConfig    *GPGConfig    `yaml:"gpg_config,omitempty"`
+	AgeConfig    *AgeConfig    `yaml:"age_config,omitempty"`
 }
 
 // FileManifest represents the metadata for a stored file
 type FileManifest struct {
-	FilePath     string              `yaml:"file"`
-	Size         int64               `yaml:"size"`
-	ModTime      string              `yaml:"mtime"`
-	Chunks       []ChunkRef          `yaml:"chunks"`
-	Destination  string              `yaml:"destination"`
-	Tags         []string            `yaml:"tags,omitempty"`          // File-specific tags
-	Encryption   *FileEncryptionInfo `yaml:"encryption,omitempty"`    // Per-file encryption settings
-	ContentHash  string              `yaml:"content_hash,omitempty"`  // Hash of entire file content
-	MerkleRoot   string              `yaml:"merkle_root,omitempty"`   // Root hash of chunk Merkle tree
-	AddedAt      time.Time           `yaml:"added_at"`                // When file was added to vault
-	LastSynced   time.Time           `yaml:"last_synced,omitempty"`   // Last successful sync time
-	LastVerified time.Time           `yaml:"last_verified,omitempty"` // Last verification time
+	FilePath      string              `yaml:"file"`
+	PathID        string              `yaml:"path_id,omitempty"`        // Keyed hash of the path, naming the manifest when the path is encrypted
+	EncryptedPath string              `yaml:"encrypted_path,omitempty"` // Destination and file name encrypted with the vault's path key
+	Size          int64               `yaml:"size"`
+	ModTime       string              `yaml:"mtime"`
+	Mode          string              `yaml:"mode,omitempty"`  // Permission bits in octal, e.g. "0644"; empty in older manifests
+	Owner         *FileOwner          `yaml:"owner,omitempty"` // Owner of the source file, where the platform has user and group IDs
+	Inode         uint64              `yaml:"inode,omitempty"` // Source file's inode when added, for add --if-changed
+	Chunks        []ChunkRef          `yaml:"chunks"`
+	Pack          *PackRef            `yaml:"pack,omitempty"`     // Set instead of Chunks for packed small files
+	Chunking      *FileChunking       `yaml:"chunking,omitempty"` // Chunking settings used for this file
+	Destination   string              `yaml:"destination"`
+	Tags          []string            `yaml:"tags,omitempty"`          // File-specific tags
+	Encryption    *FileEncryptionInfo `yaml:"encryption,omitempty"`    // Per-file encryption settings
+	ContentHash   string              `yaml:"content_hash,omitempty"`  // Hash of entire file content
+	MerkleRoot    string              `yaml:"merkle_root,omitempty"`   // Root hash of chunk Merkle tree
+	AddedAt       time.Time           `yaml:"added_at"`                // When file was added to vault
+	LastSynced    time.Time           `yaml:"last_synced,omitempty"`   // Last successful sync time
+	LastVerified  time.Time           `yaml:"last_verified,omitempty"` // Last verification time
+	Damaged       bool                `yaml:"damaged,omitempty"`       // Chunks are missing; set and cleared by 'sietch fsck --repair'
+	Type          string              `yaml:"type,omitempty"`          // FileTypeSymlink or FileTypeDir; empty for regular files
+	LinkTarget    string              `yaml:"link_target,omitempty"`   // Target of a stored symlink, as read from the link
+}
+
+// FileOwner records the user and group that owned a file when it was added
+type FileOwner struct {
+	UID int `yaml:"uid"`
+	GID int `yaml:"gid"`
+}
+
+// Types of manifest entries that record part of a tree rather than file content
+const (
+	FileTypeSymlink = "symlink"
+	FileTypeDir     = "dir" // An empty directory
+)
+
+// IsSymlink reports whether the entry is a symlink stored as its target
+func (f *FileManifest) IsSymlink() bool {
+	return f.Type == FileTypeSymlink
+}
+
+// IsDir reports whether the entry is an empty directory
+func (f *FileManifest) IsDir() bool {
+	return f.Type == FileTypeDir
+}
+
+// Identity returns the key that matches a file between vaults: its path, or its
+// path ID when the path is encrypted
+func (f *FileManifest) Identity() string {
+	if f.PathID != "" {
+		return f.PathID
+	}
+	return f.FilePath
+}
+
+// FileChunking records the chunking settings a file was split with
+type FileChunking struct {
+	Policy        string `yaml:"policy,omitempty"` // Pattern of the matched chunk policy; empty for the vault default
+	Strategy      string `yaml:"strategy"`
+	ChunkSize     int64  `yaml:"chunk_size"`               // Chunk size in bytes
+	HashAlgorithm string `yaml:"hash_algorithm,omitempty"` // Algorithm the chunks were hashed with; empty in older manifests
 }
 
 // FileEncryptionInfo contains per-file encryption details (if different from vault default)
@@ -174,6 +374,55 @@ type ChunkRef struct {
 	CompressionType string `yaml:"compression_type,omitempty"` // Compression algorithm used (e.g., "gzip", "zstd", "none")
 	IV              string `yaml:"iv,omitempty"`               // Per-chunk IV if used
 	Integrity       string `yaml:"integrity,omitempty"`        // Integrity check value (e.g., HMAC)
+	Zero            bool   `yaml:"zero,omitempty"`             // All-zero chunk; nothing is stored and it is restored as a hole
+	Convergent      bool   `yaml:"convergent,omitempty"`       // Encrypted under a key derived from Hash rather than the vault key
+	Scope           string `yaml:"scope,omitempty"`            // Dedup scope the chunk was indexed in; empty for the default scope
+	Remote          bool   `yaml:"remote,omitempty"`           // Not stored locally yet; recorded from dedup hints and fetched by sync
+	Incompressible  bool   `yaml:"incompressible,omitempty"`   // Stored uncompressed because compression did not save enough
+	CompressionDict string `yaml:"compression_dict,omitempty"` // ID of the zstd dictionary the chunk was compressed with
+}
+
+// StoredSize returns the bytes a chunk takes in the chunk store, encryption
+// overhead included. ok is false when the manifest did not record it, as for
+// chunks written by older versions or reused from a copy compressed differently.
+func (c ChunkRef) StoredSize() (size int64, ok bool) {
+	switch {
+	case c.Zero:
+		return 0, true
+	case c.EncryptedSize > 0:
+		return c.EncryptedSize, true
+	case c.EncryptedHash != "":
+		return 0, false
+	case c.CompressedSize > 0:
+		return c.CompressedSize, true
+	case c.Compressed:
+		return 0, false
+	}
+	return c.Size, true
+}
+
+// CompressedBytes returns a chunk's size after compression and before
+// encryption; ok is false when the manifest did not record it
+func (c ChunkRef) CompressedBytes() (size int64, ok bool) {
+	switch {
+	case c.Zero:
+		return 0, true
+	case c.CompressedSize > 0:
+		return c.CompressedSize, true
+	case c.Compressed:
+		return 0, false
+	}
+	return c.Size, true
+}
+
+// PackRef locates a small file stored inside a pack blob
+type PackRef struct {
+	ID              string `yaml:"id"`                         // Pack ID (file name under .sietch/packs)
+	Offset          int64  `yaml:"offset"`                     // Offset of the entry in the decrypted pack
+	Length          int64  `yaml:"length"`                     // Length of the (possibly compressed) entry
+	Hash            string `yaml:"hash"`                       // Hash of the plaintext file content
+	Compressed      bool   `yaml:"compressed,omitempty"`       // Whether the entry was compressed
+	CompressionType string `yaml:"compression_type,omitempty"` // Compression algorithm used for the entry
 }
 
 // BuildVaultConfig creates a complete vault configuration with all necessary fields
@@ -197,6 +446,73 @@ func BuildVaultConfig(
 	)
 }
 
+// ValidateDedupStrategy checks a deduplication.strategy value
+func ValidateDedupStrategy(strategy string) error {
+	if !slices.Contains(constants.DedupStrategies, strategy) {
+		return fmt.Errorf("unsupported deduplication strategy %q (supported: %s)",
+			strategy, strings.Join(constants.DedupStrategies, ", "))
+	}
+	return nil
+}
+
+// ChunkSizeBounds returns the minimum and maximum chunk sizes in bytes, 0 for
+// a bound that is unset or invalid
+func (d DeduplicationConfig) ChunkSizeBounds() (min, max int64) {
+	if size, err := util.ParseChunkSize(d.MinChunkSize); err == nil && size > 0 {
+		min = size
+	}
+	if size, err := util.ParseChunkSize(d.MaxChunkSize); err == nil && size > 0 {
+		max = size
+	}
+	return min, max
+}
+
+// ValidateChunkSizes checks that the minimum and maximum chunk sizes are
+// positive and that the vault chunk size and every policy chunk size lie
+// strictly between them. Vaults without bounds are not checked.
+func ValidateChunkSizes(chunking ChunkingConfig, dedup DeduplicationConfig) error {
+	if dedup.MinChunkSize == "" && dedup.MaxChunkSize == "" {
+		return nil
+	}
+	min, err := util.ParseChunkSize(dedup.MinChunkSize)
+	if err != nil || min <= 0 {
+		return fmt.Errorf("deduplication.min_chunk_size must be a positive size, got %q", dedup.MinChunkSize)
+	}
+	max, err := util.ParseChunkSize(dedup.MaxChunkSize)
+	if err != nil || max <= 0 {
+		return fmt.Errorf("deduplication.max_chunk_size must be a positive size, got %q", dedup.MaxChunkSize)
+	}
+	if min >= max {
+		return fmt.Errorf("deduplication.min_chunk_size (%s) must be smaller than deduplication.max_chunk_size (%s)",
+			dedup.MinChunkSize, dedup.MaxChunkSize)
+	}
+
+	checkSize := func(field, value string) error {
+		size, err := util.ParseChunkSize(value)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("%s must be a positive size, got %q", field, value)
+		}
+		if size <= min || size >= max {
+			return fmt.Errorf("%s (%s) must lie between deduplication.min_chunk_size (%s) and deduplication.max_chunk_size (%s)",
+				field, value, dedup.MinChunkSize, dedup.MaxChunkSize)
+		}
+		return nil
+	}
+	if chunking.ChunkSize != "" {
+		if err := checkSize("chunking.chunk_size", chunking.ChunkSize); err != nil {
+			return err
+		}
+	}
+	for _, policy := range chunking.Policies {
+		if policy.ChunkSize != "" {
+			if err := checkSize(fmt.Sprintf("chunk size of policy %q", policy.Pattern), policy.ChunkSize); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // BuildVaultConfigWithDeduplication creates a complete vault configuration with deduplication settings
 func BuildVaultConfigWithDeduplication(
 	vaultID, vaultName, author, keyType, keyPath string,
@@ -210,11 +526,12 @@ func BuildVaultConfigWithDeduplication(
 	dedupGCThreshold int, dedupIndexEnabled bool,
 ) VaultConfig {
 	config := VaultConfig{
-		VaultID:       vaultID,
-		Name:          vaultName,
-		CreatedAt:     time.Now().UTC(),
-		SchemaVersion: 1, // Set schema version to 1 for initial version
-		Compression:   compression,
+		VaultID:        vaultID,
+		Name:           vaultName,
+		CreatedAt:      time.Now().UTC(),
+		SchemaVersion:  constants.VaultSchemaVersion,
+		ManifestFormat: constants.ManifestFormatYAML,
+		Compression:    compression,
 	}
 
 	// Set encryption configuration
@@ -229,6 +546,7 @@ func BuildVaultConfigWithDeduplication(
 	config.Chunking.Strategy = chunkingStrategy
 	config.Chunking.ChunkSize = chunkSize
 	config.Chunking.HashAlgorithm = hashAlgorithm
+	config.Chunking.LayoutVersion = constants.CurrentChunkLayout
 
 	// Set deduplication configuration
 	config.Deduplication.Enabled = enableDedup
@@ -283,6 +601,11 @@ func BuildVaultConfigWithDeduplication(
 		if keyConfig.GPGConfig != nil && keyType == constants.EncryptionTypeGPG {
 			config.Encryption.GPGConfig = keyConfig.GPGConfig
 		}
+
+		// An age-wrapped key file works for either symmetric cipher
+		if keyConfig.AgeConfig != nil {
+			config.Encryption.AgeConfig = keyConfig.AgeConfig
+		}
 	}
 
 	return config
@@ -51,6 +51,10 @@ const (
 	MinRSAKeySize     = 2048 // Minimum acceptable RSA key size
 	Ed25519KeySize    = 256  // Ed25519 key size
 
+	// Sync identity key types
+	SyncKeyTypeRSA     = "rsa"
+	SyncKeyTypeEd25519 = "ed25519"
+
 	// Key sizes in bytes
 	AESKeySize    = 32 // AES-256 key size
 	AESKeySize128 = 16 // AES-128 key size
@@ -79,15 +83,86 @@ const (
 
 	DefaultChunkSize = 4 * 1024 * 1024 // 4MB
 
+	// Files split into more chunks than this are refused by add, as their
+	// manifests grow too large to use; chunking.max_chunks_per_file overrides it
+	DefaultMaxChunksPerFile = 100000
+	MaxSuggestedChunkSize   = 1024 * 1024 * 1024 // Largest chunk size suggested for a file over the limit
+
+	// Chunk storage layouts (recorded as chunking.layout_version in vault.yaml)
+	ChunkLayoutFlat        = 1                  // .sietch/chunks/<hash>
+	ChunkLayoutSharded     = 2                  // .sietch/chunks/<hash[:2]>/<hash>
+	ChunkLayoutNested      = 3                  // .sietch/chunks/<hash[:2]>/<hash[2:4]>/<hash>, for vaults of millions of chunks
+	CurrentChunkLayout     = ChunkLayoutSharded // Layout of new vaults unless another is chosen
+	ChunkShardPrefixLength = 2                  // Number of hash characters used as the name of each shard directory
+
+	//** Constants for small-file packing
+
+	DefaultPackThreshold = "64KB" // Files smaller than this are appended to pack blobs
+	DefaultMaxPackSize   = "8MB"  // A pack is sealed once its plaintext reaches this size
+	PackRepackWasteRatio = 0.25   // Packs with at least this fraction of dead bytes are repacked during GC
+	PackIDLength         = 16     // Random bytes in a pack ID (hex encoded in file names)
+
+	//** Constants for shared chunk stores
+
+	SharedStoreVersion      = 1
+	SharedStoreKeyShared    = "shared-key" // Every vault encrypts with the same provisioned key
+	SharedStoreKeyNone      = "none"       // Vaults store unencrypted chunks
+	SharedStoreChunksDir    = "chunks"     // Chunk directory inside a shared store (always sharded)
+	SharedStoreGCGraceHours = 24           // GC keeps unreferenced chunks younger than this, since an add may still be writing its manifest
+
+	//** Vault configuration schema (schema_version in vault.yaml)
+	VaultSchemaVersion = 3 // Newest schema this build reads and writes; older vaults are migrated on load
+
+	//** Configuration history (.sietch/history.jsonl)
+	DefaultHistoryLimit = 1000 // Entries kept when history_limit is unset; the oldest are dropped first
+
+	//** Manifest formats (manifest_format in vault.yaml)
+	ManifestFormatYAML = 1 // Plain YAML manifests and index snapshot
+	ManifestFormatZstd = 2 // zstd compressed manifests and index snapshot
+
 	//** Constants for compression
-	CompressionTypeGzip = "gzip"
-	CompressionTypeZstd = "zstd"
-	CompressionTypeNone = "none"
+	CompressionTypeGzip   = "gzip"
+	CompressionTypeZstd   = "zstd"
+	CompressionTypeLZ4    = "lz4"
+	CompressionTypeBrotli = "brotli"
+	CompressionTypeNone   = "none"
+
+	// Compression levels; level 0 in vault.yaml selects the default. The zstd
+	// default trades a little ratio for speed: see BenchmarkCompress in
+	// internal/compression for the measurements behind it.
+	MinGzipLevel     = 1
+	MaxGzipLevel     = 9
+	DefaultGzipLevel = 6
+	MinZstdLevel     = 1
+	MaxZstdLevel     = 19
+	DefaultZstdLevel = 3
+	// Brotli compresses text tighter than zstd but encodes far slower, so its
+	// default sits mid-range; brotli level 0 is not offered since 0 means default
+	MinBrotliLevel     = 1
+	MaxBrotliLevel     = 11
+	DefaultBrotliLevel = 6
+
+	// Chunks whose compressed form is not at least this many percent smaller
+	// are stored uncompressed
+	DefaultCompressionMinSavings = 5
 
 	// Maximum decompression size to prevent decompression bombs
 	// This should be large enough for legitimate chunks but prevent DoS attacks
 	MaxDecompressionSize = 100 * 1024 * 1024 // 100MB max decompressed size
 
+	// Bytes a chunk may decompress to beyond the size its manifest records
+	// before it is refused as a decompression bomb
+	DecompressionSlack = 4 * 1024
+
+	//** Deduplication strategies (deduplication.strategy in vault.yaml)
+	// content reuses identical chunks across all files: the most savings, for
+	// the cost of an index lookup per chunk. file only reuses the chunks of
+	// files whose whole content is identical, which costs one extra read of each
+	// file but keeps the index empty. none stores every file's chunks anew.
+	DedupStrategyContent = "content"
+	DedupStrategyFile    = "file"
+	DedupStrategyNone    = "none"
+
 	//** Constants for hash algorithms
 	HashAlgorithmSHA256 = "sha256"
 	HashAlgorithmSHA512 = "sha512"
@@ -97,3 +172,19 @@ const (
 	//* Regex
 	EmailRegex = `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
 )
+
+// DedupStrategies lists the supported deduplication strategies
+var DedupStrategies = []string{DedupStrategyContent, DedupStrategyFile, DedupStrategyNone}
+
+// Sync conflict strategies, for files both vaults changed since they last
+// synced. manual stops the sync until 'sietch conflicts resolve' decides,
+// newest keeps the version modified last, keep-both keeps the local version
+// and stores the peer's beside it.
+const (
+	ConflictManual   = "manual"
+	ConflictNewest   = "newest"
+	ConflictKeepBoth = "keep-both"
+)
+
+// ConflictStrategies lists the supported sync conflict strategies
+var ConflictStrategies = []string{ConflictManual, ConflictNewest, ConflictKeepBoth}
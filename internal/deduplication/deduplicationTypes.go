@@ -1,6 +1,7 @@
 package deduplication
 
 import (
+	"crypto/cipher"
 	"sync"
 	"time"
 )
@@ -10,26 +11,42 @@ type DeduplicationStats struct {
 	TotalChunks        int   `json:"total_chunks"`
 	TotalSize          int64 `json:"total_size"`
 	UnreferencedChunks int   `json:"unreferenced_chunks"`
+	UnreferencedSize   int64 `json:"unreferenced_size"` // Plaintext bytes of the unreferenced chunks
 	SavedSpace         int64 `json:"saved_space"`
+
+	Scopes map[string]DeduplicationStats `json:"scopes,omitempty"` // Per dedup scope, when the vault has scoped chunks
 }
 
 // ChunkIndexEntry represents metadata about a chunk in the deduplication index
 type ChunkIndexEntry struct {
-	Hash           string    `json:"hash"`
-	Size           int64     `json:"size"`
-	RefCount       int       `json:"ref_count"`
-	StorageHash    string    `json:"storage_hash"` // Hash used for storage (encrypted hash if applicable)
-	FirstSeen      time.Time `json:"first_seen"`
-	LastReferenced time.Time `json:"last_referenced"`
-	Compressed     bool      `json:"compressed"`
-	Encrypted      bool      `json:"encrypted"`
+	Hash            string    `json:"hash"`
+	Size            int64     `json:"size"`
+	RefCount        int       `json:"ref_count"`
+	StorageHash     string    `json:"storage_hash"` // Hash used for storage (encrypted hash if applicable)
+	FirstSeen       time.Time `json:"first_seen"`
+	LastReferenced  time.Time `json:"last_referenced"`
+	Compressed      bool      `json:"compressed"`
+	CompressionType string    `json:"compression_type,omitempty"` // Algorithm of a compressed stored copy; empty in older indexes
+	CompressionDict string    `json:"compression_dict,omitempty"` // Dictionary the stored copy was compressed with
+	Encrypted       bool      `json:"encrypted"`
+	Convergent      bool      `json:"convergent,omitempty"` // Stored copy is convergently encrypted
+	Scope           string    `json:"scope,omitempty"`      // Dedup scope; empty for the default scope
 }
 
 // DeduplicationIndex manages the chunk deduplication index
 type DeduplicationIndex struct {
-	vaultRoot string
-	indexPath string
-	entries   map[string]*ChunkIndexEntry
-	mutex     sync.RWMutex
-	dirty     bool // Track if index needs to be saved
+	vaultRoot      string
+	snapshotPath   string
+	journalPath    string
+	legacyPath     string // dedup_index.json, imported once and then removed
+	entries        map[string]*ChunkIndexEntry
+	changed        map[string]struct{} // Hashes added, updated or removed since the last save
+	baseRefs       map[string]int      // Reference count of each changed hash when it was loaded
+	storePath      string              // Shared chunk store whose index this is; empty for a vault's own index
+	journalRecords int                 // Records in the journal on disk
+	compact        bool                // Next save rewrites the snapshot
+	compressed     bool                // Snapshots are written zstd compressed
+	aead           cipher.AEAD         // Encrypts the index files; nil for a plaintext index
+	mutex          sync.RWMutex
+	dirty          bool // Track if index needs to be saved
 }
@@ -0,0 +1,233 @@
+package deduplication
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// EstimateOptions controls how much of a directory a dedup estimate reads
+type EstimateOptions struct {
+	SamplePercent float64 // Percentage of files chunked in full
+	EveryNth      int     // When set, every file is sampled by hashing every Nth chunk instead
+	Seed          int64   // Seeds the file and chunk selection, so runs are reproducible
+	IncludeHidden bool
+}
+
+// Estimate projects what adding a directory would store, extrapolated from a
+// sample. Chunks are looked up in the default dedup scope.
+type Estimate struct {
+	Path          string  `json:"path"`
+	Seed          int64   `json:"seed"`
+	SamplePercent float64 `json:"sample_percent,omitempty"`
+	EveryNth      int     `json:"every_nth,omitempty"`
+
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+
+	SampledFiles   int   `json:"sampled_files"`
+	SampledBytes   int64 `json:"sampled_bytes"`
+	SampledChunks  int   `json:"sampled_chunks"`
+	KnownChunks    int   `json:"known_chunks"`    // Already in the vault
+	RepeatedChunks int   `json:"repeated_chunks"` // Repeats of a chunk seen earlier in the sample
+	ZeroChunks     int   `json:"zero_chunks"`     // All zero, never stored
+	NewChunks      int   `json:"new_chunks"`
+	NewBytes       int64 `json:"new_bytes"`
+
+	EstimatedChunks       int64   `json:"estimated_chunks"`
+	EstimatedUniqueChunks int64   `json:"estimated_unique_chunks"`
+	EstimatedNewBytes     int64   `json:"estimated_new_bytes"`
+	HashRate              float64 `json:"hash_bytes_per_second"`  // Read, chunk and hash throughput of the sample
+	WriteRate             float64 `json:"write_bytes_per_second"` // Chunk store write throughput, from a probe
+	EstimatedSeconds      float64 `json:"estimated_seconds"`
+}
+
+// estimateFile is a file found under the estimated directory
+type estimateFile struct {
+	path string
+	size int64
+}
+
+// Estimate samples the files under root, chunking them as an add with the given
+// chunking settings would, and looks each chunk up in the index
+func (m *Manager) Estimate(ctx context.Context, root string, chunking config.ChunkingConfig, opts EstimateOptions) (*Estimate, error) {
+	if opts.EveryNth < 0 || (opts.EveryNth == 0 && (opts.SamplePercent <= 0 || opts.SamplePercent > 100)) {
+		return nil, fmt.Errorf("sample must be a percentage between 0 and 100, or every N chunks with N > 0")
+	}
+	files, err := listEstimateFiles(root, opts.IncludeHidden)
+	if err != nil {
+		return nil, err
+	}
+
+	est := &Estimate{Path: root, Seed: opts.Seed, Files: len(files), EveryNth: opts.EveryNth}
+	for _, f := range files {
+		est.Bytes += f.size
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	sample := files
+	if opts.EveryNth == 0 {
+		est.SamplePercent = opts.SamplePercent
+		count := int(math.Ceil(float64(len(files)) * opts.SamplePercent / 100))
+		shuffled := append([]estimateFile(nil), files...)
+		rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		sample = shuffled[:count]
+	}
+
+	seen := make(map[string]bool)
+	start := time.Now()
+	for _, f := range sample {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("operation cancelled")
+		}
+		policy, err := chunk.ResolvePolicy(chunking, f.path)
+		if err != nil {
+			return nil, err
+		}
+		policy.ChunkSize = chunk.BoundChunkSize(m.config, policy.ChunkSize)
+		every, offset := 1, 0
+		if opts.EveryNth > 0 {
+			every, offset = opts.EveryNth, rng.Intn(opts.EveryNth)
+		}
+		err = sampleChunks(f.path, policy.ChunkSize, chunking.HashAlgorithm, every, offset, func(hash string, data []byte) {
+			size := int64(len(data))
+			est.SampledChunks++
+			est.SampledBytes += size
+			switch {
+			case chunk.IsZero(data):
+				est.ZeroChunks++
+			case m.shouldDeduplicateChunk(size) && m.index.HasChunk(hash):
+				est.KnownChunks++
+			case m.shouldDeduplicateChunk(size) && seen[hash]:
+				est.RepeatedChunks++
+			default:
+				seen[hash] = true
+				est.NewChunks++
+				est.NewBytes += size
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.path, err)
+		}
+		est.SampledFiles++
+	}
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		est.HashRate = float64(est.SampledBytes) / elapsed
+	}
+
+	if est.SampledBytes > 0 {
+		scale := float64(est.Bytes) / float64(est.SampledBytes)
+		est.EstimatedChunks = int64(math.Round(float64(est.SampledChunks) * scale))
+		est.EstimatedUniqueChunks = int64(math.Round(float64(est.NewChunks) * scale))
+		est.EstimatedNewBytes = int64(math.Round(float64(est.NewBytes) * scale))
+	}
+	return est, nil
+}
+
+// Project fills in the estimated add duration: every byte is read and hashed,
+// and the new bytes are also written at writeRate bytes per second
+func (e *Estimate) Project(writeRate float64) {
+	e.WriteRate = writeRate
+	e.EstimatedSeconds = 0
+	if e.HashRate > 0 {
+		e.EstimatedSeconds += float64(e.Bytes) / e.HashRate
+	}
+	if writeRate > 0 {
+		e.EstimatedSeconds += float64(e.EstimatedNewBytes) / writeRate
+	}
+}
+
+// ProbeWriteRate times writing and syncing size bytes in dir, the way chunks
+// are written, and returns the throughput in bytes per second
+func ProbeWriteRate(dir string, size int) (float64, error) {
+	file, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create write probe: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	start := time.Now()
+	if _, err := file.Write(data); err != nil {
+		return 0, fmt.Errorf("write probe failed: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("write probe failed: %v", err)
+	}
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return 0, nil
+	}
+	return float64(size) / elapsed, nil
+}
+
+// sampleChunks hashes every chunk of a file whose index is offset modulo every.
+// Chunks are fixed size (cdc falls back to fixed-size chunks), so skipped chunks
+// are never read.
+func sampleChunks(path string, chunkSize int64, hashAlgorithm string, every, offset int, fn func(hash string, data []byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := make([]byte, chunkSize)
+	for index := int64(offset); ; index += int64(every) {
+		n, err := file.ReadAt(buf, index*chunkSize)
+		if n > 0 {
+			hasher, herr := chunk.CreateHasher(hashAlgorithm)
+			if herr != nil {
+				return herr
+			}
+			hasher.Write(buf[:n])
+			fn(fmt.Sprintf("%x", hasher.Sum(nil)), buf[:n])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// listEstimateFiles returns the regular files under root in a stable order
+func listEstimateFiles(root string, includeHidden bool) ([]estimateFile, error) {
+	var files []estimateFile
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && fs.ShouldSkipHidden(d.Name(), includeHidden) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, estimateFile{path: path, size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %v", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
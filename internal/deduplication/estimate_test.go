@@ -0,0 +1,80 @@
+package deduplication
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestEstimate(t *testing.T) {
+	manager, err := NewManager(t.TempDir(), testDedupConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunking := config.ChunkingConfig{Strategy: "fixed", ChunkSize: "1KB", HashAlgorithm: "sha256"}
+
+	// Every file holds one chunk the vault already has, one repeated chunk, one
+	// all-zero chunk and one chunk of its own
+	known := bytes.Repeat([]byte("k"), 1024)
+	if _, _, err := manager.ProcessChunk(config.ChunkRef{Hash: fmt.Sprintf("%x", sha256.Sum256(known)), Size: 1024}, known, ""); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		data := append(append(append(append([]byte{}, known...), bytes.Repeat([]byte("r"), 1024)...), make([]byte, 1024)...),
+			bytes.Repeat([]byte{byte('a' + i)}, 1024)...)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d", i)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	est, err := manager.Estimate(context.Background(), dir, chunking, EstimateOptions{SamplePercent: 100, Seed: 1})
+	if err != nil {
+		t.Fatalf("Estimate() error: %v", err)
+	}
+	if est.Files != 10 || est.SampledChunks != 40 || est.KnownChunks != 10 || est.RepeatedChunks != 9 || est.ZeroChunks != 10 || est.NewChunks != 11 {
+		t.Errorf("Estimate() = %+v, want 10 known, 9 repeated, 10 zero and 11 new chunks", est)
+	}
+	if est.EstimatedNewBytes != 11*1024 || est.EstimatedUniqueChunks != 11 {
+		t.Errorf("full sample projected %d new bytes in %d chunks, want %d in 11", est.EstimatedNewBytes, est.EstimatedUniqueChunks, 11*1024)
+	}
+
+	// A partial sample extrapolates, and the same seed picks the same files
+	first, err := manager.Estimate(context.Background(), dir, chunking, EstimateOptions{SamplePercent: 30, Seed: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := manager.Estimate(context.Background(), dir, chunking, EstimateOptions{SamplePercent: 30, Seed: 42})
+	if first.SampledFiles != 3 || first.EstimatedChunks != 40 {
+		t.Errorf("30%% sample = %+v, want 3 files extrapolated to 40 chunks", first)
+	}
+	if first.NewBytes != second.NewBytes || first.EstimatedNewBytes != second.EstimatedNewBytes {
+		t.Errorf("same seed gave different estimates: %+v and %+v", first, second)
+	}
+
+	every, err := manager.Estimate(context.Background(), dir, chunking, EstimateOptions{EveryNth: 2, Seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if every.SampledFiles != 10 || every.SampledChunks != 20 || every.EstimatedChunks != 40 {
+		t.Errorf("every 2nd chunk sample = %+v, want 20 of 40 chunks", every)
+	}
+
+	if _, err := manager.Estimate(context.Background(), dir, chunking, EstimateOptions{SamplePercent: 0}); err == nil {
+		t.Error("Estimate() accepted an empty sample")
+	}
+}
+
+func TestEstimateProject(t *testing.T) {
+	est := &Estimate{Bytes: 1000, EstimatedNewBytes: 200, HashRate: 100}
+	est.Project(50)
+	if est.EstimatedSeconds != 14 {
+		t.Errorf("Project() = %v seconds, want 14 (10 hashing, 4 writing)", est.EstimatedSeconds)
+	}
+}
@@ -0,0 +1,163 @@
+package deduplication
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Formats written by ExportIndex
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+)
+
+// ExportFormats lists the formats ExportIndex writes
+var ExportFormats = []string{ExportCSV, ExportJSONL}
+
+// ExportRow is one chunk of the index as ExportIndex writes it
+type ExportRow struct {
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	RefCount    int    `json:"ref_count"`
+	Compressed  bool   `json:"compressed"`
+	Compression string `json:"compression,omitempty"` // Algorithm of the stored copy, when known
+	Scope       string `json:"scope,omitempty"`
+}
+
+// exportColumns are the CSV header, in ExportRow order
+var exportColumns = []string{"hash", "size", "ref_count", "compressed", "compression", "scope"}
+
+// ExportSummary counts what ExportIndex wrote
+type ExportSummary struct {
+	Chunks int
+	Bytes  int64 // Sum of the chunks' sizes
+}
+
+// ExportIndex writes every chunk of the vault's deduplication index to w as
+// CSV or JSON lines, one row per chunk, without loading the index into
+// memory: the snapshot is streamed and only the journal of changes since it
+// was written is held.
+func ExportIndex(vaultRoot string, w io.Writer, format string) (ExportSummary, error) {
+	var write func(ExportRow) error
+	var flush func() error
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return ExportSummary{}, err
+		}
+		write = func(row ExportRow) error {
+			return cw.Write([]string{row.Hash, strconv.FormatInt(row.Size, 10), strconv.Itoa(row.RefCount),
+				strconv.FormatBool(row.Compressed), row.Compression, row.Scope})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case ExportJSONL:
+		enc := json.NewEncoder(w)
+		write = func(row ExportRow) error { return enc.Encode(row) }
+		flush = func() error { return nil }
+	default:
+		return ExportSummary{}, fmt.Errorf("unsupported export format %q (expected csv or jsonl)", format)
+	}
+
+	var summary ExportSummary
+	err := WalkIndex(vaultRoot, func(entry *ChunkIndexEntry) error {
+		summary.Chunks++
+		summary.Bytes += entry.Size
+		return write(ExportRow{
+			Hash:        entry.Hash,
+			Size:        entry.Size,
+			RefCount:    entry.RefCount,
+			Compressed:  entry.Compressed,
+			Compression: entry.CompressionType,
+			Scope:       entry.Scope,
+		})
+	})
+	if err != nil {
+		return summary, err
+	}
+	return summary, flush()
+}
+
+// WalkIndex calls fn for every entry of the vault's deduplication index on
+// disk. Snapshot entries are passed on as they are read, with the journal's
+// changes applied; entries only in the journal follow.
+func WalkIndex(vaultRoot string, fn func(*ChunkIndexEntry) error) error {
+	idx, err := newEmptyIndex(vaultRoot)
+	if err != nil {
+		return err
+	}
+
+	// The journal holds at most about as many records as the snapshot has
+	// entries before the two are compacted, and usually far fewer
+	changes := make(map[string]*ChunkIndexEntry)
+	_, _, err = scanJournal(idx.journalPath, idx.aead, func(key string, entry *ChunkIndexEntry) {
+		changes[key] = entry
+	})
+	journalExists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = scanSnapshot(idx.snapshotPath, idx.aead, func(entry *ChunkIndexEntry) error {
+		key := indexKey(entry.Scope, entry.Hash)
+		if changed, ok := changes[key]; ok {
+			delete(changes, key)
+			if changed == nil {
+				return nil // Deleted since the snapshot
+			}
+			entry = changed
+		}
+		return fn(entry)
+	})
+	if os.IsNotExist(err) && !journalExists {
+		return walkLegacyIndex(idx, fn)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		if errors.Is(err, ErrIndexCorrupt) {
+			return fmt.Errorf("%w (run 'sietch index rebuild' to reconstruct it)", err)
+		}
+		return err
+	}
+
+	keys := make([]string, 0, len(changes))
+	for key, entry := range changes {
+		if entry != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(changes[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkLegacyIndex walks a vault still holding a dedup_index.json, which is
+// read whole as it always was
+func walkLegacyIndex(idx *DeduplicationIndex, fn func(*ChunkIndexEntry) error) error {
+	if err := idx.loadLegacy(); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(idx.entries))
+	for key := range idx.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(idx.entries[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package deduplication
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// ChunkLevel reports whether the vault deduplicates individual chunks through
+// the index. Vaults from before strategies were validated may leave the
+// strategy empty, which means content.
+func ChunkLevel(cfg config.DeduplicationConfig) bool {
+	return cfg.Enabled && (cfg.Strategy == constants.DedupStrategyContent || cfg.Strategy == "")
+}
+
+// FileLevel reports whether the vault deduplicates whole files only
+func FileLevel(cfg config.DeduplicationConfig) bool {
+	return cfg.Enabled && cfg.Strategy == constants.DedupStrategyFile
+}
+
+// FileIndex finds stored files by the hash of their content, for the file
+// strategy: a file identical to one already in the vault reuses its chunks
+// instead of being chunked again. Like chunks, files are only reused within
+// their dedup scope.
+type FileIndex struct {
+	scopes []config.DedupScope
+	files  map[fileKey]*config.FileManifest
+}
+
+type fileKey struct {
+	scope string
+	hash  string
+}
+
+// LoadFileIndex indexes the files of the vault whose manifests record a
+// content hash. Vaults that encrypt paths need revealer to tell the scope of
+// each file.
+func LoadFileIndex(vaultRoot string, scopes []config.DedupScope, revealer config.PathRevealer) (*FileIndex, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	if revealer != nil {
+		manager.SetPathRevealer(revealer)
+	}
+	idx := &FileIndex{scopes: scopes, files: make(map[fileKey]*config.FileManifest)}
+	err = manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		manifest := entry.Manifest
+		idx.Add(manifest.Destination+manifest.FilePath, &manifest)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index stored files: %w", err)
+	}
+	return idx, nil
+}
+
+// Add records a file stored at vaultPath. Packed files and files without a
+// content hash are left out.
+func (idx *FileIndex) Add(vaultPath string, manifest *config.FileManifest) {
+	if manifest.ContentHash == "" || manifest.Pack != nil || len(manifest.Chunks) == 0 {
+		return
+	}
+	idx.files[fileKey{scope: ResolveScope(idx.scopes, vaultPath), hash: manifest.ContentHash}] = manifest
+}
+
+// Lookup returns a stored file with the given content hash that a file at
+// vaultPath may reuse the chunks of, or nil
+func (idx *FileIndex) Lookup(vaultPath, contentHash string) *config.FileManifest {
+	return idx.files[fileKey{scope: ResolveScope(idx.scopes, vaultPath), hash: contentHash}]
+}
+
+// ReuseChunks returns a copy of a stored file's chunk references for an
+// identical file, marked as deduplicated
+func ReuseChunks(chunks []config.ChunkRef) []config.ChunkRef {
+	reused := make([]config.ChunkRef, len(chunks))
+	for i, ref := range chunks {
+		if !ref.Zero && !ref.Remote {
+			ref.Deduplicated = true
+		}
+		reused[i] = ref
+	}
+	return reused
+}
+
+// HashFile returns the hex encoded hash of a file's content under the vault's
+// hash algorithm
+func HashFile(path, algorithm string) (string, error) {
+	hasher, err := chunk.CreateHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
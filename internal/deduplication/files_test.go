@@ -0,0 +1,101 @@
+package deduplication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+)
+
+func TestStrategyLevels(t *testing.T) {
+	tests := []struct {
+		strategy      string
+		enabled       bool
+		chunks, files bool
+	}{
+		{strategy: constants.DedupStrategyContent, enabled: true, chunks: true},
+		{strategy: "", enabled: true, chunks: true},
+		{strategy: constants.DedupStrategyFile, enabled: true, files: true},
+		{strategy: constants.DedupStrategyNone, enabled: true},
+		{strategy: constants.DedupStrategyContent},
+	}
+	for _, tt := range tests {
+		cfg := config.DeduplicationConfig{Enabled: tt.enabled, Strategy: tt.strategy}
+		if ChunkLevel(cfg) != tt.chunks || FileLevel(cfg) != tt.files {
+			t.Errorf("strategy %q (enabled %v): ChunkLevel %v, FileLevel %v; want %v, %v",
+				tt.strategy, tt.enabled, ChunkLevel(cfg), FileLevel(cfg), tt.chunks, tt.files)
+		}
+	}
+}
+
+func TestFileStrategyIndexesNoChunks(t *testing.T) {
+	cfg := testDedupConfig
+	cfg.Strategy = constants.DedupStrategyFile
+	manager, err := NewManager(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("chunk shared by two different files")
+	ref := config.ChunkRef{Hash: "bbbb", Size: int64(len(data))}
+	for i := 0; i < 2; i++ {
+		if _, dedup, err := manager.ProcessChunk(ref, data, "bbbb"); err != nil || dedup {
+			t.Fatalf("ProcessChunk() dedup %v, err %v; want the chunk stored without the index", dedup, err)
+		}
+	}
+	if stats := manager.GetStats(); stats.TotalChunks != 0 {
+		t.Errorf("index holds %d chunks, want none", stats.TotalChunks)
+	}
+}
+
+func TestFileIndex(t *testing.T) {
+	vaultRoot := t.TempDir()
+	scopes := []config.DedupScope{{Prefix: "work/", Name: "work"}}
+	chunks := []config.ChunkRef{{Hash: "c1", Size: 4}, {Hash: "c2", Size: 4, Zero: true}}
+	stored := &config.FileManifest{FilePath: "a.txt", Destination: "docs/", ContentHash: "h1", Chunks: chunks}
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch", "manifests"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.StoreFileManifest(vaultRoot, "a.txt", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := LoadFileIndex(vaultRoot, scopes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := idx.Lookup("other/b.txt", "h1")
+	if found == nil || len(found.Chunks) != 2 {
+		t.Fatalf("Lookup() = %+v, want the stored file", found)
+	}
+	if idx.Lookup("work/b.txt", "h1") != nil {
+		t.Error("a file was reused across dedup scopes")
+	}
+	if idx.Lookup("other/b.txt", "h2") != nil {
+		t.Error("a file with other content was reused")
+	}
+
+	// Files added during the same run are found too
+	idx.Add("work/c.txt", &config.FileManifest{ContentHash: "h1", Chunks: chunks})
+	if idx.Lookup("work/d.txt", "h1") == nil {
+		t.Error("file added to the index was not found in its scope")
+	}
+
+	reused := ReuseChunks(found.Chunks)
+	if !reused[0].Deduplicated || reused[1].Deduplicated || found.Chunks[0].Deduplicated {
+		t.Errorf("ReuseChunks() = %+v; want stored chunks marked deduplicated, zero chunks and the original untouched", reused)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := HashFile(path, constants.HashAlgorithmSHA256)
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; err != nil || got != want {
+		t.Errorf("HashFile() = %s, %v; want %s", got, err, want)
+	}
+}
@@ -0,0 +1,257 @@
+package deduplication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// Dedup hints list the chunks another vault (or a shared store) already holds, so
+// a vault seeded from the same data can record references to those chunks instead
+// of storing them again. The referenced chunks are marked Remote until a sync
+// fetches them.
+//
+// File: magic "SIETCHHT", uint32 version, hash algorithm, encryption type, uint64
+// entry count, entries (hash, storage key or "" when it is the hash, size, flags,
+// compression type when compressed), CRC-32 of everything before it.
+const (
+	HintsVersion = 1
+
+	hintsMagic = "SIETCHHT"
+
+	hintCompressed byte = 1
+	hintConvergent byte = 2
+)
+
+// ErrHintsCorrupt is returned when a hints file cannot be read
+var ErrHintsCorrupt = errors.New("dedup hints file is corrupt")
+
+// Hint describes one chunk held elsewhere
+type Hint struct {
+	Hash            string
+	StorageKey      string // Name the chunk is stored under: its encrypted hash, or Hash
+	Size            int64
+	Compressed      bool
+	CompressionType string
+	Convergent      bool
+}
+
+// Hints is a set of chunks held by another vault, keyed by plaintext hash
+type Hints struct {
+	HashAlgorithm string
+	Encryption    string
+	chunks        map[string]Hint
+}
+
+// NewHints returns an empty hint set for chunks hashed and encrypted as given
+func NewHints(hashAlgorithm, encryption string) *Hints {
+	return &Hints{HashAlgorithm: hashAlgorithm, Encryption: encryption, chunks: make(map[string]Hint)}
+}
+
+// Add records a chunk. The first hint for a hash wins.
+func (h *Hints) Add(hint Hint) {
+	if hint.StorageKey == "" {
+		hint.StorageKey = hint.Hash
+	}
+	if _, ok := h.chunks[hint.Hash]; !ok {
+		h.chunks[hint.Hash] = hint
+	}
+}
+
+// Lookup returns the hint for a chunk of the given hash and size
+func (h *Hints) Lookup(hash string, size int64) (Hint, bool) {
+	hint, ok := h.chunks[hash]
+	return hint, ok && hint.Size == size
+}
+
+// Len returns the number of chunks hinted
+func (h *Hints) Len() int {
+	return len(h.chunks)
+}
+
+// TotalSize returns the plaintext size of every hinted chunk
+func (h *Hints) TotalSize() int64 {
+	var total int64
+	for _, hint := range h.chunks {
+		total += hint.Size
+	}
+	return total
+}
+
+// CheckCompatible reports why hints cannot be used by a vault. Chunks are only
+// interchangeable between vaults hashing and encrypting them the same way; the
+// vaults must also share the encryption key, as they must for sync.
+func (h *Hints) CheckCompatible(vaultConfig *config.VaultConfig) error {
+	if h.HashAlgorithm != vaultConfig.Chunking.HashAlgorithm {
+		return fmt.Errorf("hints use hash algorithm %q but the vault uses %q", h.HashAlgorithm, vaultConfig.Chunking.HashAlgorithm)
+	}
+	if h.Encryption != vaultConfig.Encryption.Type {
+		return fmt.Errorf("hints are for %q encryption but the vault uses %q", h.Encryption, vaultConfig.Encryption.Type)
+	}
+	return nil
+}
+
+// RemoteRef returns ref rewritten to reference the hinted chunk instead of a
+// local copy. Its content is not stored; a sync fetches it later.
+func (hint Hint) RemoteRef(ref config.ChunkRef) config.ChunkRef {
+	ref.Remote = true
+	ref.EncryptedHash = ""
+	if hint.StorageKey != hint.Hash {
+		ref.EncryptedHash = hint.StorageKey
+	}
+	ref.Compressed = hint.Compressed
+	ref.CompressionType = hint.CompressionType
+	ref.Convergent = hint.Convergent
+	ref.CompressedSize = 0
+	ref.EncryptedSize = 0
+	ref.Deduplicated = false
+	ref.Scope = ""
+	return ref
+}
+
+// ExportHints lists every chunk stored in a vault, as referenced by its live
+// manifests. Remote references and missing chunks are left out.
+func ExportHints(vaultRoot string, vaultConfig *config.VaultConfig) (*Hints, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	hints := NewHints(vaultConfig.Chunking.HashAlgorithm, vaultConfig.Encryption.Type)
+	err = manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		for _, ref := range entry.Manifest.Chunks {
+			// Dictionary compressed chunks are left out; the vault using
+			// the hints may not have the dictionary to read them with
+			if ref.Zero || ref.Remote || ref.CompressionDict != "" {
+				continue
+			}
+			if _, ok := hints.chunks[ref.Hash]; ok {
+				continue
+			}
+			if _, exists := layout.LocateChunk(vaultRoot, storageKey(ref)); !exists {
+				continue
+			}
+			hints.Add(Hint{
+				Hash:            ref.Hash,
+				StorageKey:      storageKey(ref),
+				Size:            ref.Size,
+				Compressed:      ref.Compressed,
+				CompressionType: ref.CompressionType,
+				Convergent:      ref.Convergent,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hints, nil
+}
+
+// WriteHints writes hints to w in the binary hints format
+func WriteHints(w io.Writer, hints *Hints) error {
+	crc := crc32.NewIEEE()
+	buf := bufio.NewWriter(io.MultiWriter(w, crc))
+	iw := &indexWriter{w: buf}
+	iw.raw([]byte(hintsMagic))
+	iw.uint32(HintsVersion)
+	iw.string(hints.HashAlgorithm)
+	iw.string(hints.Encryption)
+
+	// Sorted, so the same vault always exports the same file
+	hashes := make([]string, 0, len(hints.chunks))
+	for hash := range hints.chunks {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	iw.uint64(uint64(len(hashes)))
+	for _, hash := range hashes {
+		hint := hints.chunks[hash]
+		iw.string(hint.Hash)
+		if hint.StorageKey == hint.Hash {
+			iw.string("")
+		} else {
+			iw.string(hint.StorageKey)
+		}
+		iw.varint(hint.Size)
+		var flags byte
+		if hint.Compressed {
+			flags |= hintCompressed
+		}
+		if hint.Convergent {
+			flags |= hintConvergent
+		}
+		iw.byte(flags)
+		if hint.Compressed {
+			iw.string(hint.CompressionType)
+		}
+	}
+	if iw.err == nil {
+		iw.err = buf.Flush()
+	}
+	if iw.err != nil {
+		return fmt.Errorf("failed to write dedup hints: %w", iw.err)
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc.Sum32())
+	if _, err := w.Write(sum[:]); err != nil {
+		return fmt.Errorf("failed to write dedup hints: %w", err)
+	}
+	return nil
+}
+
+// ReadHints loads a hints file written by WriteHints
+func ReadHints(path string) (*Hints, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedup hints: %w", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	crc := crc32.NewIEEE()
+	r := &indexReader{r: io.TeeReader(buffered, crc)}
+	magic := make([]byte, len(hintsMagic))
+	r.raw(magic)
+	version := r.uint32()
+	if r.err != nil || string(magic) != hintsMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrHintsCorrupt)
+	}
+	if version > HintsVersion {
+		return nil, fmt.Errorf("dedup hints version %d is newer than supported version %d", version, HintsVersion)
+	}
+	hints := NewHints(r.string(), r.string())
+	count := r.uint64()
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		hint := Hint{Hash: r.string(), StorageKey: r.string(), Size: r.varint()}
+		flags := r.byte()
+		hint.Compressed = flags&hintCompressed != 0
+		hint.Convergent = flags&hintConvergent != 0
+		if hint.Compressed {
+			hint.CompressionType = r.string()
+		}
+		if r.err == nil {
+			hints.Add(hint)
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHintsCorrupt, r.err)
+	}
+
+	want := crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(buffered, sum[:]); err != nil {
+		return nil, fmt.Errorf("%w: missing checksum", ErrHintsCorrupt)
+	}
+	if binary.LittleEndian.Uint32(sum[:]) != want {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrHintsCorrupt)
+	}
+	return hints, nil
+}
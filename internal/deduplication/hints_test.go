@@ -0,0 +1,126 @@
+package deduplication
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestHintsRoundTrip(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "a.txt", Size: 300,
+		Chunks: []config.ChunkRef{
+			{Hash: "aaaa", Size: 100},
+			{Hash: "bbbb", EncryptedHash: "bbbb-enc", Size: 100, Compressed: true, CompressionType: "zstd", Convergent: true},
+			{Hash: "cccc", Size: 100, Remote: true},
+		},
+	})
+	// writeSavingsManifest stores chunks under their plaintext hash
+	if err := os.Rename(filepath.Join(vaultRoot, ".sietch", "chunks", "bbbb"), filepath.Join(vaultRoot, ".sietch", "chunks", "bbbb-enc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(vaultRoot, ".sietch", "chunks", "cccc")); err != nil {
+		t.Fatal(err)
+	}
+
+	vaultConfig := &config.VaultConfig{}
+	vaultConfig.Chunking.HashAlgorithm = "sha256"
+	vaultConfig.Encryption.Type = "aes"
+	hints, err := ExportHints(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatalf("ExportHints() error: %v", err)
+	}
+	if hints.Len() != 2 {
+		t.Fatalf("ExportHints() found %d chunks, want 2 (remote chunks are left out)", hints.Len())
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHints(&buf, hints); err != nil {
+		t.Fatalf("WriteHints() error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "hints.bin")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadHints(path)
+	if err != nil {
+		t.Fatalf("ReadHints() error: %v", err)
+	}
+	if err := loaded.CheckCompatible(vaultConfig); err != nil {
+		t.Errorf("CheckCompatible() error: %v", err)
+	}
+	want := Hint{Hash: "bbbb", StorageKey: "bbbb-enc", Size: 100, Compressed: true, CompressionType: "zstd", Convergent: true}
+	if got, ok := loaded.Lookup("bbbb", 100); !ok || got != want {
+		t.Errorf("Lookup(bbbb) = %+v, %v; want %+v", got, ok, want)
+	}
+	if _, ok := loaded.Lookup("aaaa", 99); ok {
+		t.Error("Lookup() matched a chunk of a different size")
+	}
+
+	other := &config.VaultConfig{}
+	other.Chunking.HashAlgorithm = "blake3"
+	other.Encryption.Type = "aes"
+	if err := loaded.CheckCompatible(other); err == nil {
+		t.Error("CheckCompatible() accepted hints for another hash algorithm")
+	}
+
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-6] ^= 0xff
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHints(path); !errors.Is(err, ErrHintsCorrupt) {
+		t.Errorf("ReadHints() of a corrupt file = %v, want ErrHintsCorrupt", err)
+	}
+}
+
+func TestTxnStoreRecordsHintedChunksAsRemote(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manager, err := NewManager(vaultRoot, testDedupConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn, err := atomic.Begin(vaultRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Rollback()
+
+	// The vault already holds "local", so only "elsewhere" is taken from the hints
+	local := []byte("already in this vault")
+	store := manager.TransactionalStore(txn)
+	if _, err := store.Put(config.ChunkRef{Hash: "local", Size: int64(len(local))}, local); err != nil {
+		t.Fatal(err)
+	}
+
+	hints := NewHints("sha256", "aes")
+	hints.Add(Hint{Hash: "local", Size: int64(len(local))})
+	hints.Add(Hint{Hash: "elsewhere", StorageKey: "elsewhere-enc", Size: 5, Compressed: true, CompressionType: "gzip"})
+	store = store.WithScope("work").WithHints(hints)
+
+	ref, err := store.Put(config.ChunkRef{Hash: "elsewhere", EncryptedHash: "mine", Size: 5, CompressedSize: 4}, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config.ChunkRef{Hash: "elsewhere", EncryptedHash: "elsewhere-enc", Size: 5, Compressed: true, CompressionType: "gzip", Remote: true}
+	if ref != want {
+		t.Errorf("Put() = %+v, want %+v", ref, want)
+	}
+	if manager.index.HasChunk(indexKey("work", "elsewhere")) || manager.index.HasChunk("elsewhere") {
+		t.Error("remote chunk was indexed")
+	}
+
+	// Scoped chunks only count as held locally within their scope
+	if ref, _ := store.Put(config.ChunkRef{Hash: "local", Size: int64(len(local))}, local); !ref.Remote {
+		t.Error("a chunk held only by another scope was stored instead of recorded as remote")
+	}
+	if ref, _ := store.WithScope("").Put(config.ChunkRef{Hash: "local", Size: int64(len(local))}, local); ref.Remote || !ref.Deduplicated {
+		t.Errorf("locally held chunk = %+v, want it deduplicated", ref)
+	}
+}
@@ -2,6 +2,7 @@ package deduplication
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,45 +10,145 @@ import (
 
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
-	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/sharedstore"
 )
 
-// NewDeduplicationIndex creates a new deduplication index
+// NewDeduplicationIndex opens the vault's deduplication index, converting a
+// legacy dedup_index.json on first use
 func NewDeduplicationIndex(vaultRoot string) (*DeduplicationIndex, error) {
-	indexPath := filepath.Join(vaultRoot, ".sietch", "dedup_index.json")
-
-	idx := &DeduplicationIndex{
-		vaultRoot: vaultRoot,
-		indexPath: indexPath,
-		entries:   make(map[string]*ChunkIndexEntry),
-		dirty:     false,
+	idx, err := newEmptyIndex(vaultRoot)
+	if err != nil {
+		return nil, err
 	}
 
 	// Load existing index if it exists
 	if err := idx.Load(); err != nil {
-		// If file doesn't exist, that's okay - we'll create it when we save
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("failed to load deduplication index: %w", err)
+		if errors.Is(err, ErrIndexCorrupt) {
+			return nil, fmt.Errorf("%w (run 'sietch index rebuild' to reconstruct it)", err)
 		}
+		return nil, fmt.Errorf("failed to load deduplication index: %w", err)
 	}
 
 	return idx, nil
 }
 
-// Load loads the deduplication index from disk
+// newEmptyIndex returns an index for vaultRoot without reading anything from
+// disk, unlocking the index key if the vault encrypts its index
+func newEmptyIndex(vaultRoot string) (*DeduplicationIndex, error) {
+	aead, err := indexCipher(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	indexDir := IndexDir(vaultRoot)
+	idx := &DeduplicationIndex{
+		vaultRoot:    vaultRoot,
+		snapshotPath: filepath.Join(indexDir, snapshotFileName),
+		journalPath:  filepath.Join(indexDir, journalFileName),
+		legacyPath:   filepath.Join(vaultRoot, ".sietch", legacyIndexName),
+		entries:      make(map[string]*ChunkIndexEntry),
+		changed:      make(map[string]struct{}),
+		baseRefs:     make(map[string]int),
+		storePath:    layout.SharedStore(vaultRoot),
+		compressed:   config.ManifestCompression(vaultRoot),
+		aead:         aead,
+		dirty:        false,
+	}
+	if idx.storePath != "" {
+		idx.legacyPath = "" // A vault's old index does not describe the shared store
+	}
+	return idx, nil
+}
+
+// Load reads the index snapshot and replays the journal. A vault without an
+// index starts empty; a legacy JSON index is imported and rewritten on Save.
 func (idx *DeduplicationIndex) Load() error {
 	idx.mutex.Lock()
 	defer idx.mutex.Unlock()
 
-	data, err := os.ReadFile(idx.indexPath)
+	entries := make(map[string]*ChunkIndexEntry)
+	records, torn, err := idx.readDisk(entries)
+	if errors.Is(err, errNoIndex) {
+		return idx.loadLegacy()
+	}
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, &idx.entries)
+	idx.entries = entries
+	idx.changed = make(map[string]struct{})
+	idx.baseRefs = make(map[string]int)
+	idx.journalRecords = records
+	// Rewrite the snapshot so nothing is appended after a damaged record, and
+	// so an index written before encryption was turned on gets encrypted
+	idx.compact = torn || idx.needsSealing()
+	idx.dirty = idx.compact
+	return nil
+}
+
+// needsSealing reports whether the vault encrypts its index but the snapshot
+// or journal on disk is still plaintext
+func (idx *DeduplicationIndex) needsSealing() bool {
+	if idx.aead == nil {
+		return false
+	}
+	for _, path := range []string{idx.snapshotPath, idx.journalPath} {
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 && !isSealed(path) {
+			return true
+		}
+	}
+	return false
 }
 
-// Save saves the deduplication index to disk
+// errNoIndex is returned by readDisk when neither a snapshot nor a journal exists
+var errNoIndex = errors.New("no index on disk")
+
+// readDisk loads the snapshot and replays the journal into entries
+func (idx *DeduplicationIndex) readDisk(entries map[string]*ChunkIndexEntry) (records int, torn bool, err error) {
+	err = readSnapshot(idx.snapshotPath, idx.aead, entries)
+	if os.IsNotExist(err) {
+		if _, jerr := os.Stat(idx.journalPath); jerr != nil {
+			return 0, false, errNoIndex
+		}
+		err = nil // Journal written before the first compaction
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	records, torn, err = replayJournal(idx.journalPath, idx.aead, entries)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, false, err
+	}
+	return records, torn, nil
+}
+
+// loadLegacy imports dedup_index.json, the format used before .sietch/index/
+func (idx *DeduplicationIndex) loadLegacy() error {
+	if idx.legacyPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(idx.legacyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]*ChunkIndexEntry)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrIndexCorrupt, legacyIndexName, err)
+	}
+	idx.entries = entries
+	idx.compact = true
+	idx.dirty = true
+	return nil
+}
+
+// Save persists changes made since the last save. Changed entries are appended to
+// the journal; the snapshot is only rewritten when the journal has grown larger
+// than the index or after a legacy import or damaged journal.
 func (idx *DeduplicationIndex) Save() error {
 	idx.mutex.Lock()
 	defer idx.mutex.Unlock()
@@ -57,24 +158,117 @@ func (idx *DeduplicationIndex) Save() error {
 	}
 
 	// Ensure the directory exists
-	dir := filepath.Dir(idx.indexPath)
-	if err := os.MkdirAll(dir, constants.StandardDirPerms); err != nil {
+	if err := os.MkdirAll(filepath.Dir(idx.snapshotPath), constants.StandardDirPerms); err != nil {
 		return fmt.Errorf("failed to create index directory: %w", err)
 	}
 
-	data, err := json.MarshalIndent(idx.entries, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal index: %w", err)
+	// Other vaults may have updated a shared index since it was loaded
+	if idx.storePath != "" {
+		unlock, err := sharedstore.Lock(idx.storePath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := idx.mergeLocked(); err != nil {
+			return err
+		}
 	}
 
-	if err := os.WriteFile(idx.indexPath, data, constants.StandardFilePerms); err != nil {
-		return fmt.Errorf("failed to write index file: %w", err)
+	records := idx.journalRecords + len(idx.changed)
+	if idx.compact || (records > minCompactRecords && records > len(idx.entries)) {
+		if err := idx.compactLocked(); err != nil {
+			return err
+		}
+	} else {
+		if err := appendJournal(idx.journalPath, idx.aead, idx.entries, idx.changed); err != nil {
+			return err
+		}
+		idx.journalRecords = records
 	}
 
+	idx.changed = make(map[string]struct{})
+	idx.baseRefs = make(map[string]int)
 	idx.dirty = false
 	return nil
 }
 
+// mergeLocked rereads the index from disk and applies this process's changes to it
+// as reference count deltas, so concurrent updates from other vaults are kept.
+// The caller holds the shared store lock.
+func (idx *DeduplicationIndex) mergeLocked() error {
+	disk := make(map[string]*ChunkIndexEntry)
+	records, torn, err := idx.readDisk(disk)
+	if err != nil && !errors.Is(err, errNoIndex) {
+		return err
+	}
+
+	for hash := range idx.changed {
+		mine := idx.entries[hash]
+		delta := -idx.baseRefs[hash]
+		if mine != nil {
+			delta += mine.RefCount
+		}
+
+		current, exists := disk[hash]
+		switch {
+		case exists:
+			current.RefCount += delta
+			if mine != nil && mine.LastReferenced.After(current.LastReferenced) {
+				current.LastReferenced = mine.LastReferenced
+			}
+			if current.RefCount <= 0 {
+				delete(disk, hash)
+			}
+		case mine != nil && delta > 0:
+			entry := *mine
+			entry.RefCount = delta
+			disk[hash] = &entry
+		}
+	}
+
+	idx.entries = disk
+	idx.journalRecords = records
+	idx.compact = idx.compact || torn
+	return nil
+}
+
+// compactLocked writes every entry to a new snapshot and starts an empty journal
+func (idx *DeduplicationIndex) compactLocked() error {
+	if err := writeSnapshot(idx.snapshotPath, idx.entries, idx.compressed, idx.aead); err != nil {
+		return err
+	}
+	if err := os.Remove(idx.journalPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to reset index journal: %w", err)
+	}
+	if err := os.Remove(idx.legacyPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove legacy index: %w", err)
+	}
+	idx.journalRecords = 0
+	idx.compact = false
+	return nil
+}
+
+// Rewrite replaces the snapshot with one holding every entry, compressed when
+// compress is set, and empties the journal. Later snapshots keep the same form.
+func (idx *DeduplicationIndex) Rewrite(compress bool) error {
+	idx.mutex.Lock()
+	idx.compressed = compress
+	idx.compact = true
+	idx.dirty = true
+	idx.mutex.Unlock()
+	return idx.Save()
+}
+
+// markChanged records that hash must be written by the next Save. prevRefs is the
+// reference count before this change, remembered for merging into a shared index.
+func (idx *DeduplicationIndex) markChanged(hash string, prevRefs int) {
+	if _, seen := idx.changed[hash]; !seen {
+		idx.baseRefs[hash] = prevRefs
+	}
+	idx.changed[hash] = struct{}{}
+	idx.dirty = true
+}
+
 // HasChunk checks if a chunk exists in the index
 func (idx *DeduplicationIndex) HasChunk(hash string) bool {
 	idx.mutex.RLock()
@@ -105,13 +299,14 @@ func (idx *DeduplicationIndex) AddChunk(chunkRef config.ChunkRef, storageHash st
 	defer idx.mutex.Unlock()
 
 	now := time.Now()
+	key := refKey(chunkRef)
 
-	// Check if chunk already exists
-	if entry, exists := idx.entries[chunkRef.Hash]; exists {
+	// Check if chunk already exists in the chunk's scope
+	if entry, exists := idx.entries[key]; exists {
 		// Increment reference count
+		idx.markChanged(key, entry.RefCount)
 		entry.RefCount++
 		entry.LastReferenced = now
-		idx.dirty = true
 
 		// Create a copy to return
 		entryCopy := *entry
@@ -120,25 +315,30 @@ func (idx *DeduplicationIndex) AddChunk(chunkRef config.ChunkRef, storageHash st
 
 	// Create new entry
 	entry := &ChunkIndexEntry{
-		Hash:           chunkRef.Hash,
-		Size:           chunkRef.Size,
-		RefCount:       1,
-		StorageHash:    storageHash,
-		FirstSeen:      now,
-		LastReferenced: now,
-		Compressed:     chunkRef.Compressed,
-		Encrypted:      chunkRef.EncryptedHash != "",
+		Hash:            chunkRef.Hash,
+		Size:            chunkRef.Size,
+		RefCount:        1,
+		StorageHash:     storageHash,
+		FirstSeen:       now,
+		LastReferenced:  now,
+		Compressed:      chunkRef.Compressed,
+		Encrypted:       chunkRef.EncryptedHash != "",
+		CompressionType: compressionTypeOf(chunkRef),
+		CompressionDict: chunkRef.CompressionDict,
+		Convergent:      chunkRef.Convergent,
+		Scope:           chunkRef.Scope,
 	}
 
-	idx.entries[chunkRef.Hash] = entry
-	idx.dirty = true
+	idx.entries[key] = entry
+	idx.markChanged(key, 0)
 
 	// Create a copy to return
 	entryCopy := *entry
 	return &entryCopy, false // false indicates new chunk
 }
 
-// RemoveChunk decrements the reference count of a chunk and removes it if ref count reaches 0
+// RemoveChunk decrements the reference count of a chunk and removes it if ref count reaches 0.
+// Chunks in a dedup scope are identified by their index key (see refKey).
 func (idx *DeduplicationIndex) RemoveChunk(hash string) error {
 	idx.mutex.Lock()
 	defer idx.mutex.Unlock()
@@ -148,23 +348,41 @@ func (idx *DeduplicationIndex) RemoveChunk(hash string) error {
 		return fmt.Errorf("chunk not found in index: %s", hash)
 	}
 
+	idx.markChanged(hash, entry.RefCount)
 	entry.RefCount--
 	if entry.RefCount <= 0 {
 		delete(idx.entries, hash)
-		idx.dirty = true
 
-		// Also remove the actual chunk file
+		// Also remove the actual chunk file, unless another scope stores the same data
+		if idx.storageInUse(entry.StorageHash) {
+			return nil
+		}
 		return idx.removeChunkFile(entry.StorageHash)
 	}
 
-	idx.dirty = true
 	return nil
 }
 
-// removeChunkFile removes the physical chunk file from storage
+// storageInUse reports whether a referenced entry is stored under storageHash.
+// Identical plaintext indexed in two scopes has one storage key in unencrypted
+// and convergent vaults, so the chunk file is only removed with the last one.
+func (idx *DeduplicationIndex) storageInUse(storageHash string) bool {
+	for _, entry := range idx.entries {
+		if entry.StorageHash == storageHash && entry.RefCount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// removeChunkFile removes the physical chunk file from storage. A chunk in a
+// chunk pack is left to 'sietch dedup gc', which drops it when it repacks.
 func (idx *DeduplicationIndex) removeChunkFile(storageHash string) error {
-	chunkPath := filepath.Join(fs.GetChunkDirectory(idx.vaultRoot), storageHash)
-	if err := os.Remove(chunkPath); err != nil && !os.IsNotExist(err) {
+	loc, _ := layout.LocateChunk(idx.vaultRoot, storageHash)
+	if loc.Packed() {
+		return nil
+	}
+	if err := os.Remove(loc.Path); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove chunk file %s: %w", storageHash, err)
 	}
 	return nil
@@ -182,42 +400,73 @@ func (idx *DeduplicationIndex) GetStats() DeduplicationStats {
 		SavedSpace:         0,
 	}
 
+	scopes := make(map[string]DeduplicationStats)
+	scoped := false
 	for _, entry := range idx.entries {
-		stats.TotalSize += entry.Size
-		if entry.RefCount == 0 {
-			stats.UnreferencedChunks++
-		}
-		if entry.RefCount > 1 {
-			stats.SavedSpace += entry.Size * int64(entry.RefCount-1)
-		}
+		addEntryStats(&stats, entry)
+		scope := scopes[ScopeName(entry.Scope)]
+		scope.TotalChunks++
+		addEntryStats(&scope, entry)
+		scopes[ScopeName(entry.Scope)] = scope
+		scoped = scoped || entry.Scope != ""
+	}
+	if scoped {
+		stats.Scopes = scopes
 	}
 
 	return stats
 }
 
+// addEntryStats adds an entry's size and savings to stats
+func addEntryStats(stats *DeduplicationStats, entry *ChunkIndexEntry) {
+	stats.TotalSize += entry.Size
+	if entry.RefCount == 0 {
+		stats.UnreferencedChunks++
+		stats.UnreferencedSize += entry.Size
+	}
+	if entry.RefCount > 1 {
+		stats.SavedSpace += entry.Size * int64(entry.RefCount-1)
+	}
+}
+
 // GarbageCollect removes unreferenced chunks
 func (idx *DeduplicationIndex) GarbageCollect() (int, error) {
+	removed, err := idx.GarbageCollectScopes()
+	total := 0
+	for _, count := range removed {
+		total += count
+	}
+	return total, err
+}
+
+// GarbageCollectScopes removes unreferenced chunks and returns how many were
+// removed from each dedup scope. A chunk file another scope still uses is kept.
+func (idx *DeduplicationIndex) GarbageCollectScopes() (map[string]int, error) {
 	idx.mutex.Lock()
 	defer idx.mutex.Unlock()
 
 	var toRemove []string
+	inUse := make(map[string]bool)
 	for hash, entry := range idx.entries {
 		if entry.RefCount <= 0 {
 			toRemove = append(toRemove, hash)
+		} else {
+			inUse[entry.StorageHash] = true
 		}
 	}
 
+	removed := make(map[string]int)
 	for _, hash := range toRemove {
 		entry := idx.entries[hash]
-		if err := idx.removeChunkFile(entry.StorageHash); err != nil {
-			fmt.Printf("Warning: failed to remove chunk file for %s: %v\n", hash, err)
+		if !inUse[entry.StorageHash] {
+			if err := idx.removeChunkFile(entry.StorageHash); err != nil {
+				fmt.Printf("Warning: failed to remove chunk file for %s: %v\n", hash, err)
+			}
 		}
+		idx.markChanged(hash, entry.RefCount)
 		delete(idx.entries, hash)
+		removed[ScopeName(entry.Scope)]++
 	}
 
-	if len(toRemove) > 0 {
-		idx.dirty = true
-	}
-
-	return len(toRemove), nil
+	return removed, nil
 }
@@ -0,0 +1,346 @@
+package deduplication
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+var testDedupConfig = config.DeduplicationConfig{
+	Enabled:      true,
+	Strategy:     "content",
+	MinChunkSize: "0",
+	MaxChunkSize: "64MB",
+}
+
+func openTestIndex(t *testing.T, vaultRoot string) *DeduplicationIndex {
+	t.Helper()
+	idx, err := NewDeduplicationIndex(vaultRoot)
+	if err != nil {
+		t.Fatalf("NewDeduplicationIndex() error: %v", err)
+	}
+	return idx
+}
+
+func TestIndexJournalPersistsIncrementally(t *testing.T) {
+	vaultRoot := t.TempDir()
+	idx := openTestIndex(t, vaultRoot)
+
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	idx.AddChunk(config.ChunkRef{Hash: "bbbb", Size: 20}, "bbbb")
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// Small updates only append to the journal
+	if _, err := os.Stat(idx.snapshotPath); !os.IsNotExist(err) {
+		t.Errorf("expected no snapshot before compaction, stat error: %v", err)
+	}
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	if err := idx.RemoveChunk("bbbb"); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	reloaded := openTestIndex(t, vaultRoot)
+	if entry, ok := reloaded.GetChunk("aaaa"); !ok || entry.RefCount != 2 {
+		t.Errorf("aaaa = %+v, %v; want ref count 2", entry, ok)
+	}
+	if reloaded.HasChunk("bbbb") {
+		t.Error("removed chunk bbbb is still indexed")
+	}
+	if reloaded.journalRecords != 4 {
+		t.Errorf("journal records = %d, want 4", reloaded.journalRecords)
+	}
+}
+
+func TestIndexCompaction(t *testing.T) {
+	vaultRoot := t.TempDir()
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	idx.compact = true
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	if _, err := os.Stat(idx.snapshotPath); err != nil {
+		t.Errorf("expected snapshot after compaction: %v", err)
+	}
+	if _, err := os.Stat(idx.journalPath); !os.IsNotExist(err) {
+		t.Errorf("expected journal to be reset, stat error: %v", err)
+	}
+
+	// Journal records on top of the snapshot
+	idx.AddChunk(config.ChunkRef{Hash: "bbbb", Size: 20, EncryptedHash: "cccc", Convergent: true}, "cccc")
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := openTestIndex(t, vaultRoot)
+	if !reloaded.HasChunk("aaaa") || !reloaded.HasChunk("bbbb") {
+		t.Error("expected both snapshot and journal entries after reload")
+	}
+	if entry, _ := reloaded.GetChunk("bbbb"); entry == nil || !entry.Encrypted || !entry.Convergent {
+		t.Errorf("bbbb = %+v, want encrypted convergent entry", entry)
+	}
+}
+
+func TestIndexRewriteCompressed(t *testing.T) {
+	vaultRoot := t.TempDir()
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	idx.AddChunk(config.ChunkRef{Hash: "bbbb", Size: 20, Compressed: true, CompressionType: "zstd"}, "bbbb")
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compress := range []bool{true, false} {
+		if err := idx.Rewrite(compress); err != nil {
+			t.Fatalf("Rewrite(%v) error: %v", compress, err)
+		}
+		data, err := os.ReadFile(idx.snapshotPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.IsCompressedManifest(data) != compress {
+			t.Errorf("Rewrite(%v) left snapshot compressed = %v", compress, !compress)
+		}
+		reloaded := openTestIndex(t, vaultRoot)
+		if entry, ok := reloaded.GetChunk("bbbb"); !ok || entry.CompressionType != "zstd" || !reloaded.HasChunk("aaaa") {
+			t.Errorf("after Rewrite(%v): bbbb = %+v, %v; want both entries", compress, entry, ok)
+		}
+	}
+}
+
+func TestIndexTornJournalTail(t *testing.T) {
+	vaultRoot := t.TempDir()
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash halfway through appending a record
+	file, err := os.OpenFile(idx.journalPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{200, 0, 0, 0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	reloaded := openTestIndex(t, vaultRoot)
+	if !reloaded.HasChunk("aaaa") {
+		t.Fatal("records before the torn tail were lost")
+	}
+	if !reloaded.compact {
+		t.Error("expected a torn journal to schedule compaction")
+	}
+	reloaded.AddChunk(config.ChunkRef{Hash: "bbbb", Size: 20}, "bbbb")
+	if err := reloaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if again := openTestIndex(t, vaultRoot); !again.HasChunk("aaaa") || !again.HasChunk("bbbb") || again.compact {
+		t.Error("expected a clean index after compaction")
+	}
+}
+
+func TestIndexCorruptSnapshot(t *testing.T) {
+	vaultRoot := t.TempDir()
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	idx.compact = true
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(idx.snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-6] ^= 0xff
+	if err := os.WriteFile(idx.snapshotPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDeduplicationIndex(vaultRoot); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("NewDeduplicationIndex() error = %v, want ErrIndexCorrupt", err)
+	}
+}
+
+func TestIndexRejectsNewerVersion(t *testing.T) {
+	vaultRoot := t.TempDir()
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(idx.journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(data[len(journalMagic):], IndexVersion+1)
+	if err := os.WriteFile(idx.journalPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDeduplicationIndex(vaultRoot); err == nil {
+		t.Error("expected an index from a newer version to be rejected")
+	}
+}
+
+func TestIndexImportsLegacyJSON(t *testing.T) {
+	vaultRoot := t.TempDir()
+	legacy := filepath.Join(vaultRoot, ".sietch", legacyIndexName)
+	if err := os.MkdirAll(filepath.Dir(legacy), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"aaaa": {"hash": "aaaa", "size": 10, "ref_count": 3, "storage_hash": "enc-aaaa"}}`
+	if err := os.WriteFile(legacy, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := openTestIndex(t, vaultRoot)
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("expected the legacy index to be removed after conversion")
+	}
+
+	entry, ok := openTestIndex(t, vaultRoot).GetChunk("aaaa")
+	if !ok || entry.RefCount != 3 || entry.StorageHash != "enc-aaaa" {
+		t.Errorf("converted entry = %+v, %v", entry, ok)
+	}
+}
+
+func TestRebuildAndCheckIndex(t *testing.T) {
+	vaultRoot := t.TempDir()
+	added := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	shared := config.ChunkRef{Hash: "aaaa", Size: 100}
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "a.bin", Size: 300, AddedAt: added,
+		Chunks: []config.ChunkRef{shared, {Hash: "bbbb", Size: 100}, {Hash: "zero", Size: 100, Zero: true}},
+	})
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "b.bin", Size: 200, AddedAt: added.Add(time.Hour),
+		Chunks: []config.ChunkRef{shared, shared},
+	})
+
+	// Drift: one reference too few, one stale entry, one chunk not indexed
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(shared, "aaaa")
+	idx.AddChunk(config.ChunkRef{Hash: "gone", Size: 5}, "gone")
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewManager(vaultRoot, testDedupConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err := manager.CheckIndex()
+	if err != nil {
+		t.Fatalf("CheckIndex() error: %v", err)
+	}
+	kinds := map[string]string{}
+	for _, problem := range check.Problems {
+		kinds[problem.Hash+"/"+problem.Kind] = problem.Kind
+	}
+	for _, want := range []string{"aaaa/refcount", "bbbb/missing", "gone/stale", "gone/missing-chunk"} {
+		if _, ok := kinds[want]; !ok {
+			t.Errorf("expected problem %s, got %+v", want, check.Problems)
+		}
+	}
+
+	result, err := RebuildIndex(vaultRoot, testDedupConfig)
+	if err != nil {
+		t.Fatalf("RebuildIndex() error: %v", err)
+	}
+	if result.Files != 2 || result.Chunks != 2 || result.References != 4 {
+		t.Errorf("RebuildIndex() = %+v", result)
+	}
+
+	manager, err = NewManager(vaultRoot, testDedupConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check, err := manager.CheckIndex(); err != nil || !check.OK() {
+		t.Errorf("CheckIndex() after rebuild = %+v, %v", check, err)
+	}
+	if entry, _ := manager.index.GetChunk("aaaa"); entry.RefCount != 3 || !entry.FirstSeen.Equal(added) {
+		t.Errorf("rebuilt entry = %+v", entry)
+	}
+}
+
+func TestRebuildIndexReplacesCorruptIndex(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "a.bin", Size: 100, Chunks: []config.ChunkRef{{Hash: "aaaa", Size: 100}},
+	})
+	if err := os.MkdirAll(IndexDir(vaultRoot), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(IndexDir(vaultRoot), snapshotFileName), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RebuildIndex(vaultRoot, testDedupConfig); err != nil {
+		t.Fatalf("RebuildIndex() error: %v", err)
+	}
+	if !openTestIndex(t, vaultRoot).HasChunk("aaaa") {
+		t.Error("expected rebuilt index to contain aaaa")
+	}
+}
+
+func TestSharedIndexMergesConcurrentUpdates(t *testing.T) {
+	storePath := t.TempDir()
+	openMember := func() *DeduplicationIndex {
+		vaultRoot := t.TempDir()
+		content := "name: member\nshared_store:\n  path: " + storePath + "\n"
+		if err := os.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return openTestIndex(t, vaultRoot)
+	}
+
+	// Both vaults load the index before either saves, as concurrent adds would
+	a := openMember()
+	b := openMember()
+	a.AddChunk(config.ChunkRef{Hash: "shared", Size: 10}, "shared")
+	a.AddChunk(config.ChunkRef{Hash: "onlya", Size: 10}, "onlya")
+	b.AddChunk(config.ChunkRef{Hash: "shared", Size: 10}, "shared")
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	reloaded := openMember()
+	if entry, ok := reloaded.GetChunk("shared"); !ok || entry.RefCount != 2 {
+		t.Errorf("shared = %+v, %v; want ref count 2 from both vaults", entry, ok)
+	}
+	if !reloaded.HasChunk("onlya") {
+		t.Error("chunk added by the first vault was lost by the second save")
+	}
+
+	// Releasing a reference keeps the other vault's
+	if err := reloaded.RemoveChunk("shared"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := openMember().GetChunk("shared"); !ok || entry.RefCount != 1 {
+		t.Errorf("shared after release = %+v, %v; want ref count 1", entry, ok)
+	}
+}
@@ -0,0 +1,168 @@
+package deduplication
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+)
+
+// A vault with encryption.encrypt_index set keeps a random index key, wrapped
+// with the vault key, in its secrets. The snapshot is then sealed as a whole with
+// AES-256-GCM under a key derived from it, and each journal record on its own, so
+// the index files reveal neither chunk hashes nor sizes until the vault is
+// unlocked. An unlocked index is read into memory as before.
+
+const indexKeySize = 32
+
+// Encrypted index files start with their own magic so they are told apart from
+// plaintext ones without the key
+const (
+	sealedSnapshotMagic = "SIETCHIE"
+	sealedJournalMagic  = "SIETCHJE"
+)
+
+// ErrIndexLocked is returned when an encrypted index is opened without its key
+var ErrIndexLocked = errors.New("deduplication index is encrypted and the vault is not unlocked")
+
+// IndexPassphrase is asked for the passphrase of a vault whose encrypted index
+// is opened before UnlockIndex was called for it. Commands set it to prompt; nil
+// opens the vault key without a passphrase.
+var IndexPassphrase func(vaultConfig *config.VaultConfig) (string, error)
+
+var (
+	unlockedMutex   sync.Mutex
+	unlockedIndexes = make(map[string]cipher.AEAD) // Index ciphers by vault root
+)
+
+// NewIndexKey generates an index key and returns it wrapped with the vault key,
+// for storing as encryption.index_key
+func NewIndexKey(vaultConfig *config.VaultConfig, passphrase string) (string, error) {
+	if vaultConfig.Encryption.Type == "" || vaultConfig.Encryption.Type == "none" {
+		return "", fmt.Errorf("index encryption requires an encrypted vault")
+	}
+	key := make([]byte, indexKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate index key: %w", err)
+	}
+	wrapped, err := encryption.EncryptDataWithPassphrase(hex.EncodeToString(key), *vaultConfig, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap index key: %w", err)
+	}
+	return wrapped, nil
+}
+
+// UnlockIndex unwraps the vault's index key for the indexes this process opens
+// afterwards. It does nothing for a vault whose index is stored in plaintext.
+func UnlockIndex(vaultRoot string, vaultConfig *config.VaultConfig, passphrase string) error {
+	if !vaultConfig.Encryption.EncryptIndex {
+		return nil
+	}
+	if vaultConfig.Encryption.IndexKey == "" {
+		return fmt.Errorf("vault encrypts its index but has no index key")
+	}
+	unwrapped, err := encryption.DecryptDataWithPassphrase(vaultConfig.Encryption.IndexKey, vaultRoot, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to unlock index key: %w", err)
+	}
+	key, err := hex.DecodeString(unwrapped)
+	if err != nil || len(key) != indexKeySize {
+		return fmt.Errorf("index key is corrupt")
+	}
+	aead, err := newIndexCipher(key)
+	if err != nil {
+		return err
+	}
+
+	unlockedMutex.Lock()
+	unlockedIndexes[filepath.Clean(vaultRoot)] = aead
+	unlockedMutex.Unlock()
+	return nil
+}
+
+// indexCipher returns the cipher for the vault's index, unlocking it through
+// IndexPassphrase if needed, or nil when the index is stored in plaintext
+func indexCipher(vaultRoot string) (cipher.AEAD, error) {
+	unlockedMutex.Lock()
+	aead := unlockedIndexes[filepath.Clean(vaultRoot)]
+	unlockedMutex.Unlock()
+	if aead != nil {
+		return aead, nil
+	}
+
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil || !vaultConfig.Encryption.EncryptIndex {
+		return nil, nil // Indexes of vaults without a configuration stay readable as before
+	}
+	passphrase := ""
+	if IndexPassphrase != nil {
+		if passphrase, err = IndexPassphrase(vaultConfig); err != nil {
+			return nil, err
+		}
+	}
+	if err := UnlockIndex(vaultRoot, vaultConfig, passphrase); err != nil {
+		return nil, err
+	}
+	unlockedMutex.Lock()
+	defer unlockedMutex.Unlock()
+	return unlockedIndexes[filepath.Clean(vaultRoot)], nil
+}
+
+func newIndexCipher(key []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("sietch dedup index"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data with a random nonce prepended; ad binds it to the kind of
+// file it belongs in
+func seal(aead cipher.AEAD, data []byte, ad string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, data, []byte(ad)), nil
+}
+
+// open decrypts what seal produced
+func open(aead cipher.AEAD, sealed []byte, ad string) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(ad))
+	if err != nil {
+		return nil, errors.New("decryption failed: wrong key or damaged data")
+	}
+	return plaintext, nil
+}
+
+// isSealed reports whether the index file at path is encrypted. A missing or
+// empty file is not.
+func isSealed(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(sealedSnapshotMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return string(magic) == sealedSnapshotMagic || string(magic) == sealedJournalMagic
+}
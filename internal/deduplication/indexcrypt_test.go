@@ -0,0 +1,108 @@
+package deduplication
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// unlockTestIndex registers an index key for vaultRoot, as UnlockIndex does
+func unlockTestIndex(t *testing.T, vaultRoot string) {
+	t.Helper()
+	aead, err := newIndexCipher(bytes.Repeat([]byte{7}, indexKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockedMutex.Lock()
+	unlockedIndexes[filepath.Clean(vaultRoot)] = aead
+	unlockedMutex.Unlock()
+	t.Cleanup(func() { lockTestIndex(vaultRoot) })
+}
+
+func lockTestIndex(vaultRoot string) {
+	unlockedMutex.Lock()
+	delete(unlockedIndexes, filepath.Clean(vaultRoot))
+	unlockedMutex.Unlock()
+}
+
+func TestEncryptedIndex(t *testing.T) {
+	vaultRoot := t.TempDir()
+	const hash = "0123456789abcdef0123456789abcdef"
+
+	// A plaintext index is encrypted on the first save after unlocking
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(config.ChunkRef{Hash: hash, Size: 10}, hash)
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	unlockTestIndex(t, vaultRoot)
+	idx = openTestIndex(t, vaultRoot)
+	if !idx.compact {
+		t.Fatal("plaintext index was not scheduled for encryption")
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if !isSealed(idx.snapshotPath) {
+		t.Error("snapshot is not encrypted")
+	}
+
+	// Journal records appended afterwards are encrypted too
+	idx.AddChunk(config.ChunkRef{Hash: hash, Size: 10}, hash)
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	for _, path := range []string{idx.snapshotPath, idx.journalPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(hash)) {
+			t.Errorf("%s reveals the chunk hash", filepath.Base(path))
+		}
+	}
+
+	reloaded := openTestIndex(t, vaultRoot)
+	if entry, ok := reloaded.GetChunk(hash); !ok || entry.RefCount != 2 || entry.Size != 10 {
+		t.Errorf("chunk = %+v, %v; want ref count 2 and size 10", entry, ok)
+	}
+	if reloaded.compact {
+		t.Error("encrypted index was scheduled for rewriting")
+	}
+
+	// Without the key the index does not open
+	lockTestIndex(vaultRoot)
+	if _, err := NewDeduplicationIndex(vaultRoot); !errors.Is(err, ErrIndexLocked) {
+		t.Errorf("NewDeduplicationIndex() without key error = %v, want ErrIndexLocked", err)
+	}
+	if err := WalkIndex(vaultRoot, func(*ChunkIndexEntry) error { return nil }); !errors.Is(err, ErrIndexLocked) {
+		t.Errorf("WalkIndex() without key error = %v, want ErrIndexLocked", err)
+	}
+}
+
+func TestEncryptedIndexDetectsTampering(t *testing.T) {
+	vaultRoot := t.TempDir()
+	unlockTestIndex(t, vaultRoot)
+	idx := openTestIndex(t, vaultRoot)
+	idx.AddChunk(config.ChunkRef{Hash: "aaaa", Size: 10}, "aaaa")
+	idx.compact = true
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	data, err := os.ReadFile(idx.snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(idx.snapshotPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDeduplicationIndex(vaultRoot); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("NewDeduplicationIndex() error = %v, want ErrIndexCorrupt", err)
+	}
+}
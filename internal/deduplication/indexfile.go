@@ -0,0 +1,545 @@
+package deduplication
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/sharedstore"
+)
+
+// The index lives in .sietch/index/ as a snapshot plus an append-only journal.
+// Saving appends one journal record per changed chunk instead of rewriting the
+// whole index; once the journal outgrows the snapshot the two are compacted into
+// a new snapshot. Journal records carry the full entry state, so replaying a
+// journal over a snapshot that already contains it is harmless.
+//
+// Snapshot: magic "SIETCHIX", uint32 version, uint64 entry count, entries, CRC-32
+// of everything before it. Vaults with compressed manifests store the snapshot
+// as a zstd stream of the same bytes.
+// Journal: magic "SIETCHJL", uint32 version, then records of uint32 length,
+// uint32 CRC-32 and payload (op byte followed by an entry or a hash).
+//
+// Encrypted indexes (see indexcrypt.go) store the snapshot as magic "SIETCHIE"
+// followed by the sealed bytes above, and the journal with magic "SIETCHJE" and
+// each record's payload sealed, the CRC covering the sealed payload.
+const (
+	IndexVersion = 1
+
+	indexDirName     = "index"
+	snapshotFileName = "dedup.idx"
+	journalFileName  = "dedup.journal"
+	legacyIndexName  = "dedup_index.json"
+
+	snapshotMagic = "SIETCHIX"
+	journalMagic  = "SIETCHJL"
+
+	journalOpPut    byte = 1
+	journalOpDelete byte = 2
+
+	// Compact once the journal has more records than this and than the index has entries
+	minCompactRecords = 4096
+
+	maxRecordSize = 1 << 20
+)
+
+// ErrIndexCorrupt is returned when the on-disk index cannot be read.
+// 'sietch index rebuild' reconstructs it from the file manifests.
+var ErrIndexCorrupt = errors.New("deduplication index is corrupt")
+
+// IndexDir returns the directory holding the deduplication index. Vaults using a
+// shared chunk store share the store's index.
+func IndexDir(vaultRoot string) string {
+	if store := layout.SharedStore(vaultRoot); store != "" {
+		return sharedstore.IndexDir(store)
+	}
+	return filepath.Join(vaultRoot, ".sietch", indexDirName)
+}
+
+// readSnapshot loads a snapshot into entries. A missing snapshot is not an error.
+func readSnapshot(path string, aead cipher.AEAD, entries map[string]*ChunkIndexEntry) error {
+	return scanSnapshot(path, aead, func(entry *ChunkIndexEntry) error {
+		entries[indexKey(entry.Scope, entry.Hash)] = entry
+		return nil
+	})
+}
+
+// scanSnapshot calls fn for each entry of a snapshot as it is read. The
+// checksum covers the whole file, so a damaged snapshot is only reported after
+// fn has seen the entries before the damage. An encrypted snapshot is
+// decrypted into memory first, which needs aead.
+func scanSnapshot(path string, aead cipher.AEAD, fn func(*ChunkIndexEntry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	if magic, err := buffered.Peek(len(sealedSnapshotMagic)); err == nil && string(magic) == sealedSnapshotMagic {
+		if aead == nil {
+			return ErrIndexLocked
+		}
+		sealed, err := io.ReadAll(buffered)
+		if err != nil {
+			return err
+		}
+		plaintext, err := open(aead, sealed[len(sealedSnapshotMagic):], sealedSnapshotMagic)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrIndexCorrupt, filepath.Base(path), err)
+		}
+		buffered = bufio.NewReader(bytes.NewReader(plaintext))
+	}
+	if magic, err := buffered.Peek(4); err == nil && config.IsCompressedManifest(magic) {
+		zr, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		defer zr.Close()
+		buffered = bufio.NewReader(zr)
+	}
+
+	// Only bytes consumed through the tee are checksummed
+	crc := crc32.NewIEEE()
+	r := &indexReader{r: io.TeeReader(buffered, crc)}
+	if err := readHeader(r, snapshotMagic); err != nil {
+		return err
+	}
+	count := r.uint64()
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		entry := r.entry()
+		if r.err == nil {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrIndexCorrupt, filepath.Base(path), r.err)
+	}
+
+	// The checksum itself is not part of the checksummed data
+	want := crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(buffered, sum[:]); err != nil {
+		return fmt.Errorf("%w: %s: missing checksum", ErrIndexCorrupt, filepath.Base(path))
+	}
+	if binary.LittleEndian.Uint32(sum[:]) != want {
+		return fmt.Errorf("%w: %s: checksum mismatch", ErrIndexCorrupt, filepath.Base(path))
+	}
+	return nil
+}
+
+// writeSnapshot atomically replaces the snapshot with entries, zstd compressed
+// when compress is set and encrypted when aead is not nil
+func writeSnapshot(path string, entries map[string]*ChunkIndexEntry, compress bool, aead cipher.AEAD) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), snapshotFileName+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create index snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// An encrypted snapshot is built in memory and sealed as a whole
+	var sink io.Writer = tmp
+	var plaintext *bytes.Buffer
+	if aead != nil {
+		plaintext = &bytes.Buffer{}
+		sink = plaintext
+	}
+	out := sink
+	var zw *zstd.Encoder
+	if compress {
+		if zw, err = zstd.NewWriter(sink, zstd.WithEncoderConcurrency(1)); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		out = zw
+	}
+
+	crc := crc32.NewIEEE()
+	buf := bufio.NewWriter(io.MultiWriter(out, crc))
+	w := &indexWriter{w: buf}
+	writeHeader(w, snapshotMagic)
+	w.uint64(uint64(len(entries)))
+	for _, entry := range entries {
+		w.entry(entry)
+	}
+	if w.err == nil {
+		w.err = buf.Flush()
+	}
+	if w.err == nil {
+		w.err = binary.Write(out, binary.LittleEndian, crc.Sum32())
+	}
+	if zw != nil {
+		if err := zw.Close(); w.err == nil {
+			w.err = err
+		}
+	}
+	if w.err == nil && plaintext != nil {
+		var sealed []byte
+		if sealed, w.err = seal(aead, plaintext.Bytes(), sealedSnapshotMagic); w.err == nil {
+			_, w.err = tmp.Write(append([]byte(sealedSnapshotMagic), sealed...))
+		}
+	}
+	if w.err == nil {
+		w.err = tmp.Sync()
+	}
+	if err := tmp.Close(); w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		return fmt.Errorf("failed to write index snapshot: %w", w.err)
+	}
+	if err := os.Chmod(tmp.Name(), constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to write index snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace index snapshot: %w", err)
+	}
+	return nil
+}
+
+// replayJournal applies journal records to entries and returns how many were
+// applied. Replay stops at the first incomplete or damaged record, which is what
+// an interrupted append leaves behind; torn is true in that case.
+func replayJournal(path string, aead cipher.AEAD, entries map[string]*ChunkIndexEntry) (records int, torn bool, err error) {
+	return scanJournal(path, aead, func(key string, entry *ChunkIndexEntry) {
+		if entry == nil {
+			delete(entries, key)
+		} else {
+			entries[key] = entry
+		}
+	})
+}
+
+// scanJournal calls fn for each journal record with the index key it changes
+// and the entry it stores, nil for a deletion. It stops like replayJournal. An
+// encrypted journal needs aead.
+func scanJournal(path string, aead cipher.AEAD, fn func(key string, entry *ChunkIndexEntry)) (records int, torn bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	// A crash while creating the journal can leave a partial header
+	if info, err := file.Stat(); err == nil && info.Size() < int64(len(journalMagic)+4) {
+		return 0, info.Size() > 0, nil
+	}
+
+	br := bufio.NewReader(file)
+	magic := journalMagic
+	if peek, err := br.Peek(len(sealedJournalMagic)); err == nil && string(peek) == sealedJournalMagic {
+		if aead == nil {
+			return 0, false, ErrIndexLocked
+		}
+		magic = sealedJournalMagic
+	} else {
+		aead = nil // A plaintext journal written before the index was encrypted
+	}
+	if err := readHeader(&indexReader{r: br}, magic); err != nil {
+		return 0, false, err
+	}
+
+	var head [8]byte
+	for {
+		if _, err := io.ReadFull(br, head[:]); err != nil {
+			return records, err != io.EOF, nil
+		}
+		size := binary.LittleEndian.Uint32(head[:4])
+		if size == 0 || size > maxRecordSize {
+			return records, true, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return records, true, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(head[4:]) {
+			return records, true, nil
+		}
+		if aead != nil {
+			// The checksum matched, so a record that does not decrypt was altered
+			if payload, err = open(aead, payload, sealedJournalMagic); err != nil {
+				return records, false, fmt.Errorf("%w: %s: %v", ErrIndexCorrupt, filepath.Base(path), err)
+			}
+			if len(payload) == 0 {
+				return records, true, nil
+			}
+		}
+
+		r := &indexReader{r: bytes.NewReader(payload[1:])}
+		switch payload[0] {
+		case journalOpPut:
+			entry := r.entry()
+			if r.err != nil {
+				return records, true, nil
+			}
+			fn(indexKey(entry.Scope, entry.Hash), entry)
+		case journalOpDelete:
+			hash := r.string()
+			if r.err != nil {
+				return records, true, nil
+			}
+			fn(hash, nil)
+		default:
+			return records, true, nil
+		}
+		records++
+	}
+}
+
+// appendJournal appends a record for every changed hash and syncs the journal.
+// Hashes no longer present in entries are recorded as deletions. Records are
+// encrypted when aead is not nil.
+func appendJournal(path string, aead cipher.AEAD, entries map[string]*ChunkIndexEntry, changed map[string]struct{}) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, constants.StandardFilePerms)
+	if err != nil {
+		return fmt.Errorf("failed to open index journal: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open index journal: %w", err)
+	}
+	buf := bufio.NewWriter(file)
+	if info.Size() == 0 {
+		w := &indexWriter{w: buf}
+		if aead != nil {
+			writeHeader(w, sealedJournalMagic)
+		} else {
+			writeHeader(w, journalMagic)
+		}
+		if w.err != nil {
+			return fmt.Errorf("failed to write index journal: %w", w.err)
+		}
+	}
+
+	for hash := range changed {
+		payload := &bytes.Buffer{}
+		w := &indexWriter{w: payload}
+		if entry, ok := entries[hash]; ok {
+			w.byte(journalOpPut)
+			w.entry(entry)
+		} else {
+			w.byte(journalOpDelete)
+			w.string(hash)
+		}
+		record := payload.Bytes()
+		if aead != nil {
+			if record, err = seal(aead, record, sealedJournalMagic); err != nil {
+				return fmt.Errorf("failed to write index journal: %w", err)
+			}
+		}
+
+		var head [8]byte
+		binary.LittleEndian.PutUint32(head[:4], uint32(len(record)))
+		binary.LittleEndian.PutUint32(head[4:], crc32.ChecksumIEEE(record))
+		if _, err := buf.Write(head[:]); err != nil {
+			return fmt.Errorf("failed to write index journal: %w", err)
+		}
+		if _, err := buf.Write(record); err != nil {
+			return fmt.Errorf("failed to write index journal: %w", err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write index journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync index journal: %w", err)
+	}
+	return nil
+}
+
+func writeHeader(w *indexWriter, magic string) {
+	w.raw([]byte(magic))
+	w.uint32(IndexVersion)
+}
+
+func readHeader(r *indexReader, magic string) error {
+	got := make([]byte, len(magic))
+	r.raw(got)
+	version := r.uint32()
+	if r.err != nil || string(got) != magic {
+		return fmt.Errorf("%w: bad header", ErrIndexCorrupt)
+	}
+	if version > IndexVersion {
+		return fmt.Errorf("deduplication index version %d is newer than supported version %d", version, IndexVersion)
+	}
+	return nil
+}
+
+// indexWriter encodes index values, remembering the first error
+type indexWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *indexWriter) raw(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *indexWriter) byte(b byte) { w.raw([]byte{b}) }
+
+func (w *indexWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.raw(b[:])
+}
+
+func (w *indexWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.raw(b[:])
+}
+
+func (w *indexWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.raw(b[:binary.PutVarint(b[:], v)])
+}
+
+func (w *indexWriter) string(s string) {
+	w.varint(int64(len(s)))
+	w.raw([]byte(s))
+}
+
+func (w *indexWriter) entry(e *ChunkIndexEntry) {
+	w.string(e.Hash)
+	w.string(e.StorageHash)
+	w.varint(e.Size)
+	w.varint(int64(e.RefCount))
+	w.varint(e.FirstSeen.UnixNano())
+	w.varint(e.LastReferenced.UnixNano())
+	var flags byte
+	if e.Compressed {
+		flags |= 1
+	}
+	if e.Encrypted {
+		flags |= 2
+	}
+	if e.Convergent {
+		flags |= 4
+	}
+	if e.Scope != "" {
+		flags |= 8
+	}
+	if e.CompressionType != "" {
+		flags |= 16
+	}
+	if e.CompressionDict != "" {
+		flags |= 32
+	}
+	w.byte(flags)
+	if e.Scope != "" {
+		w.string(e.Scope)
+	}
+	if e.CompressionType != "" {
+		w.string(e.CompressionType)
+	}
+	if e.CompressionDict != "" {
+		w.string(e.CompressionDict)
+	}
+}
+
+// indexReader decodes index values, remembering the first error
+type indexReader struct {
+	r   io.Reader
+	err error
+}
+
+// ReadByte lets binary.ReadVarint read through the reader
+func (r *indexReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.r, b[:])
+	return b[0], err
+}
+
+func (r *indexReader) raw(b []byte) {
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, b)
+	}
+}
+
+func (r *indexReader) byte() byte {
+	var b [1]byte
+	r.raw(b[:])
+	return b[0]
+}
+
+func (r *indexReader) uint32() uint32 {
+	var b [4]byte
+	r.raw(b[:])
+	return binary.LittleEndian.Uint32(b[:])
+}
+
+func (r *indexReader) uint64() uint64 {
+	var b [8]byte
+	r.raw(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (r *indexReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r)
+	r.err = err
+	return v
+}
+
+func (r *indexReader) string() string {
+	n := r.varint()
+	if r.err != nil {
+		return ""
+	}
+	if n < 0 || n > maxRecordSize {
+		r.err = fmt.Errorf("invalid string length %d", n)
+		return ""
+	}
+	b := make([]byte, n)
+	r.raw(b)
+	return string(b)
+}
+
+func (r *indexReader) entry() *ChunkIndexEntry {
+	e := &ChunkIndexEntry{
+		Hash:        r.string(),
+		StorageHash: r.string(),
+		Size:        r.varint(),
+		RefCount:    int(r.varint()),
+	}
+	e.FirstSeen = time.Unix(0, r.varint()).UTC()
+	e.LastReferenced = time.Unix(0, r.varint()).UTC()
+	flags := r.byte()
+	e.Compressed = flags&1 != 0
+	e.Encrypted = flags&2 != 0
+	e.Convergent = flags&4 != 0
+	if flags&8 != 0 {
+		e.Scope = r.string()
+	}
+	if flags&16 != 0 {
+		e.CompressionType = r.string()
+	}
+	if flags&32 != 0 {
+		e.CompressionDict = r.string()
+	}
+	if r.err == nil && e.Hash == "" {
+		r.err = fmt.Errorf("entry without hash")
+	}
+	return e
+}
@@ -2,11 +2,12 @@ package deduplication
 
 import (
 	"fmt"
-	"path/filepath"
 
 	"github.com/substantialcattle5/sietch/internal/atomic"
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
 	"github.com/substantialcattle5/sietch/util"
 )
 
@@ -46,17 +47,8 @@ func (m *Manager) SetProgressManager(pm ProgressManager) {
 // ProcessChunk processes a chunk for deduplication
 // Returns: (chunkRef, deduplicated, error)
 func (m *Manager) ProcessChunk(chunkRef config.ChunkRef, chunkData []byte, storageHash string) (config.ChunkRef, bool, error) {
-	if !m.config.Enabled {
-		// Deduplication disabled, store chunk normally
-		if err := m.storeChunk(storageHash, chunkData); err != nil {
-			return chunkRef, false, err
-		}
-		return chunkRef, false, nil
-	}
-
-	// Check if we should deduplicate this chunk based on size constraints
-	if !m.shouldDeduplicateChunk(chunkRef.Size) {
-		// Store chunk normally without deduplication
+	if !m.indexes(&chunkRef) {
+		// Deduplication disabled or chunk outside the size limits, store it normally
 		if err := m.storeChunk(storageHash, chunkData); err != nil {
 			return chunkRef, false, err
 		}
@@ -69,6 +61,7 @@ func (m *Manager) ProcessChunk(chunkRef config.ChunkRef, chunkData []byte, stora
 	if deduplicated {
 		// Chunk already exists, no need to store it again
 		chunkRef.Deduplicated = true
+		pointAtStoredChunk(&chunkRef, entry)
 		if m.progressMgr != nil {
 			m.progressMgr.PrintVerbose("  └─ Deduplicated chunk %s (ref count: %d)\n",
 				chunkRef.Hash[:12], entry.RefCount)
@@ -77,7 +70,7 @@ func (m *Manager) ProcessChunk(chunkRef config.ChunkRef, chunkData []byte, stora
 		// New chunk, store it
 		if err := m.storeChunk(storageHash, chunkData); err != nil {
 			// Remove from index if storage failed
-			if m.index.RemoveChunk(chunkRef.Hash) != nil {
+			if m.index.RemoveChunk(refKey(chunkRef)) != nil {
 				fmt.Printf("Warning: failed to remove chunk %s from index: %v\n", chunkRef.Hash, err)
 			}
 			return chunkRef, false, err
@@ -88,9 +81,19 @@ func (m *Manager) ProcessChunk(chunkRef config.ChunkRef, chunkData []byte, stora
 	return chunkRef, deduplicated, nil
 }
 
+// indexes reports whether a chunk goes through the index. Chunks that are not
+// indexed are not deduplicated either, so their dedup scope is not recorded.
+func (m *Manager) indexes(chunkRef *config.ChunkRef) bool {
+	if m.shouldDeduplicateChunk(chunkRef.Size) {
+		return true
+	}
+	chunkRef.Scope = ""
+	return false
+}
+
 // shouldDeduplicateChunk checks if a chunk should be deduplicated based on configuration
 func (m *Manager) shouldDeduplicateChunk(chunkSize int64) bool {
-	if !m.config.Enabled {
+	if !ChunkLevel(m.config) {
 		return false
 	}
 
@@ -113,8 +116,13 @@ func (m *Manager) storeChunk(storageHash string, chunkData []byte) error {
 }
 
 // storeChunkTransactional stages a chunk into the active transaction instead of writing directly.
+// Chunks in a shared store live outside the vault and are written straight to the store; a
+// chunk left behind by a rolled back add is unreferenced and removed by the store's GC.
 func (m *Manager) storeChunkTransactional(txn *atomic.Transaction, storageHash string, chunkData []byte) error {
-	rel := filepath.ToSlash(filepath.Join(".sietch", "chunks", storageHash))
+	if layout.SharedStore(m.vaultRoot) != "" {
+		return m.storeChunk(storageHash, chunkData)
+	}
+	rel := layout.ChunkRelPath(m.vaultRoot, storageHash)
 	w, err := txn.StageCreate(rel)
 	if err != nil {
 		return fmt.Errorf("stage chunk %s: %w", storageHash, err)
@@ -131,13 +139,7 @@ func (m *Manager) storeChunkTransactional(txn *atomic.Transaction, storageHash s
 
 // ProcessChunkTransactional mirrors ProcessChunk but stores new chunk content via the transaction staging area.
 func (m *Manager) ProcessChunkTransactional(txn *atomic.Transaction, chunkRef config.ChunkRef, chunkData []byte, storageHash string) (config.ChunkRef, bool, error) {
-	if !m.config.Enabled {
-		if err := m.storeChunkTransactional(txn, storageHash, chunkData); err != nil {
-			return chunkRef, false, err
-		}
-		return chunkRef, false, nil
-	}
-	if !m.shouldDeduplicateChunk(chunkRef.Size) {
+	if !m.indexes(&chunkRef) {
 		if err := m.storeChunkTransactional(txn, storageHash, chunkData); err != nil {
 			return chunkRef, false, err
 		}
@@ -146,13 +148,14 @@ func (m *Manager) ProcessChunkTransactional(txn *atomic.Transaction, chunkRef co
 	entry, deduplicated := m.index.AddChunk(chunkRef, storageHash)
 	if deduplicated {
 		chunkRef.Deduplicated = true
+		pointAtStoredChunk(&chunkRef, entry)
 		if m.progressMgr != nil {
 			m.progressMgr.PrintVerbose("  └─ Deduplicated chunk %s (ref count: %d)\n", chunkRef.Hash[:12], entry.RefCount)
 		}
 		return chunkRef, true, nil
 	}
 	if err := m.storeChunkTransactional(txn, storageHash, chunkData); err != nil {
-		if m.index.RemoveChunk(chunkRef.Hash) != nil {
+		if m.index.RemoveChunk(refKey(chunkRef)) != nil {
 			fmt.Printf("Warning: failed to remove chunk %s from index after transactional store failure\n", chunkRef.Hash)
 		}
 		return chunkRef, false, err
@@ -161,6 +164,50 @@ func (m *Manager) ProcessChunkTransactional(txn *atomic.Transaction, chunkRef co
 	return chunkRef, false, nil
 }
 
+// pointAtStoredChunk makes a deduplicated encrypted chunk reference the copy that is
+// already stored. Encryption is randomised, so the new ciphertext (and its hash) was
+// never written and must not be recorded in the manifest. The stored copy may also
+// predate (or postdate) convergent encryption, so its mode is taken over as well.
+//
+// The stored copy may also have been compressed differently, e.g. stored raw as
+// incompressible under another threshold or compressed before the vault's
+// compression setting changed, so its compression is taken over when known. That
+// includes the dictionary it was compressed with, if any.
+func pointAtStoredChunk(chunkRef *config.ChunkRef, entry *ChunkIndexEntry) {
+	if chunkRef.EncryptedHash != "" && entry.StorageHash != "" {
+		chunkRef.EncryptedHash = entry.StorageHash
+		chunkRef.Convergent = entry.Convergent
+	}
+	switch {
+	case !entry.Compressed && chunkRef.Compressed:
+		chunkRef.Compressed = false
+		chunkRef.CompressionType = constants.CompressionTypeNone
+		chunkRef.CompressionDict = ""
+		chunkRef.CompressedSize = chunkRef.Size
+		chunkRef.EncryptedSize = 0 // Unknown for the stored copy
+	case entry.Compressed && !chunkRef.Compressed,
+		entry.Compressed && entry.CompressionType != "" && chunkRef.CompressionType != entry.CompressionType,
+		entry.Compressed && chunkRef.CompressionDict != entry.CompressionDict:
+		chunkRef.Compressed = true
+		// Empty for indexes that predate recording it; reads then assume the
+		// vault's compression setting, as they do for old manifests
+		chunkRef.CompressionType = entry.CompressionType
+		chunkRef.CompressionDict = entry.CompressionDict
+		chunkRef.CompressedSize = 0 // Unknown for the stored copy
+		chunkRef.EncryptedSize = 0
+		chunkRef.Incompressible = false
+	}
+}
+
+// compressionTypeOf returns the algorithm a chunk was compressed with, or "" for
+// chunks stored uncompressed
+func compressionTypeOf(ref config.ChunkRef) string {
+	if !ref.Compressed {
+		return ""
+	}
+	return ref.CompressionType
+}
+
 // GetStats returns deduplication statistics
 func (m *Manager) GetStats() DeduplicationStats {
 	return m.index.GetStats()
@@ -171,6 +218,11 @@ func (m *Manager) GarbageCollect() (int, error) {
 	return m.index.GarbageCollect()
 }
 
+// GarbageCollectScopes removes unreferenced chunks, counting them per dedup scope
+func (m *Manager) GarbageCollectScopes() (map[string]int, error) {
+	return m.index.GarbageCollectScopes()
+}
+
 // Save saves the deduplication index
 func (m *Manager) Save() error {
 	return m.index.Save()
@@ -179,13 +231,77 @@ func (m *Manager) Save() error {
 // RemoveFileChunks removes all chunks associated with a file
 func (m *Manager) RemoveFileChunks(chunks []config.ChunkRef) error {
 	for _, chunk := range chunks {
-		if err := m.index.RemoveChunk(chunk.Hash); err != nil {
+		if err := m.index.RemoveChunk(refKey(chunk)); err != nil {
 			return fmt.Errorf("failed to remove chunk %s: %w", chunk.Hash, err)
 		}
 	}
 	return nil
 }
 
+// ReleaseChunks drops one index reference for each chunk of a deleted file.
+// Unlike RemoveFileChunks it never deletes chunk files; callers remove orphaned
+// chunks themselves. Chunks that were never indexed are ignored.
+func (m *Manager) ReleaseChunks(chunks []config.ChunkRef) {
+	idx := m.index
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	for _, chunk := range chunks {
+		key := refKey(chunk)
+		entry, exists := idx.entries[key]
+		if !exists {
+			continue
+		}
+		idx.markChanged(key, entry.RefCount)
+		entry.RefCount--
+		if entry.RefCount <= 0 {
+			delete(idx.entries, key)
+		}
+	}
+}
+
+// ResumeChunks indexes chunks an interrupted add stored before the index was
+// saved, as if they had just been processed. A chunk the index meanwhile holds
+// another copy of is pointed at that copy.
+func (m *Manager) ResumeChunks(chunks []config.ChunkRef) {
+	for i := range chunks {
+		ref := &chunks[i]
+		if ref.Zero || ref.Remote || !m.indexes(ref) {
+			continue
+		}
+		key := storageKey(*ref)
+		if entry, deduplicated := m.index.AddChunk(*ref, key); deduplicated && entry.StorageHash != key {
+			ref.Deduplicated = true
+			pointAtStoredChunk(ref, entry)
+		}
+	}
+}
+
+// Recompressed records chunks rewritten with another compression, mapping the
+// key each was stored under to its new reference. Every index entry stored under
+// an old key, whatever its scope, is pointed at the new copy.
+func (m *Manager) Recompressed(rewritten map[string]config.ChunkRef) {
+	idx := m.index
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	for key, entry := range idx.entries {
+		ref, ok := rewritten[entry.StorageHash]
+		if !ok {
+			continue
+		}
+		idx.markChanged(key, entry.RefCount)
+		entry.StorageHash = ref.Hash
+		if ref.EncryptedHash != "" {
+			entry.StorageHash = ref.EncryptedHash
+		}
+		entry.Compressed = ref.Compressed
+		entry.CompressionType = compressionTypeOf(ref)
+		entry.CompressionDict = ref.CompressionDict
+		entry.Convergent = ref.Convergent
+	}
+}
+
 // OptimizeStorage performs optimization operations
 func (m *Manager) OptimizeStorage() (*OptimizationResult, error) {
 	stats := m.GetStats()
@@ -136,6 +136,22 @@ func TestDeduplicationManager(t *testing.T) {
 			t.Errorf("Expected 1 total chunk after reload, got %d", stats.TotalChunks)
 		}
 	})
+
+	t.Run("DuplicateEncryptedChunkUsesStoredCopy", func(t *testing.T) {
+		// Encryption is randomised, so a duplicate arrives with a different encrypted hash
+		encryptedRef := chunkRef
+		encryptedRef.EncryptedHash = "fresh_ciphertext_hash"
+		updatedRef, deduplicated, err := manager.ProcessChunk(encryptedRef, testData, "fresh_ciphertext_hash")
+		if err != nil {
+			t.Fatalf("Failed to process duplicate chunk: %v", err)
+		}
+		if !deduplicated {
+			t.Fatal("Duplicate chunk should be marked as deduplicated")
+		}
+		if updatedRef.EncryptedHash != storageHash {
+			t.Errorf("Expected deduplicated chunk to point at %s, got %s", storageHash, updatedRef.EncryptedHash)
+		}
+	})
 }
 
 func TestDeduplicationIndex(t *testing.T) {
@@ -240,3 +256,63 @@ func TestDeduplicationIndex(t *testing.T) {
 		}
 	})
 }
+
+func TestDeduplicatedChunksTakeOverStoredCompression(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored config.ChunkRef
+		added  config.ChunkRef
+		want   config.ChunkRef
+	}{
+		{
+			name:   "stored raw, added compressed",
+			stored: config.ChunkRef{Hash: "aaaa", Size: 100, CompressionType: "none", CompressedSize: 100, Incompressible: true},
+			added:  config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "gzip", CompressedSize: 90},
+			want:   config.ChunkRef{Hash: "aaaa", Size: 100, CompressionType: "none", CompressedSize: 100, Deduplicated: true},
+		},
+		{
+			name:   "stored compressed, added raw",
+			stored: config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "zstd", CompressedSize: 50},
+			added:  config.ChunkRef{Hash: "aaaa", Size: 100, CompressionType: "none", CompressedSize: 100, Incompressible: true},
+			want:   config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "zstd", Deduplicated: true},
+		},
+		{
+			name:   "compression setting changed",
+			stored: config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "gzip", CompressedSize: 60},
+			added:  config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "zstd", CompressedSize: 50},
+			want:   config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "gzip", Deduplicated: true},
+		},
+		{
+			name:   "same compression",
+			stored: config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "gzip", CompressedSize: 60},
+			added:  config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "gzip", CompressedSize: 60},
+			want:   config.ChunkRef{Hash: "aaaa", Size: 100, Compressed: true, CompressionType: "gzip", CompressedSize: 60, Deduplicated: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultRoot := t.TempDir()
+			manager, err := NewManager(vaultRoot, testDedupConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := manager.ProcessChunk(tt.stored, []byte("stored"), ""); err != nil {
+				t.Fatal(err)
+			}
+			// The compression type survives a reload of the index
+			if err := manager.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if manager, err = NewManager(vaultRoot, testDedupConfig); err != nil {
+				t.Fatal(err)
+			}
+			got, dedup, err := manager.ProcessChunk(tt.added, []byte("stored"), "")
+			if err != nil || !dedup {
+				t.Fatalf("ProcessChunk() dedup = %v, err = %v", dedup, err)
+			}
+			if got != tt.want {
+				t.Errorf("ProcessChunk() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/manifoldco/promptui"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
 )
 
 // PromptDeduplicationConfig asks for deduplication settings interactively
@@ -47,15 +48,16 @@ func PromptDeduplicationConfig(configuration *config.VaultConfig) error {
 	// Strategy prompt
 	strategyPrompt := promptui.Select{
 		Label: "Deduplication strategy",
-		Items: []string{"content", "fingerprint"},
+		Items: constants.DedupStrategies,
 		Templates: &promptui.SelectTemplates{
 			Selected: "Strategy: {{ . }}",
 			Active:   "▸ {{ . }} {{ if eq . \"content\" }}(recommended){{ end }}",
 			Inactive: "  {{ . }} {{ if eq . \"content\" }}(recommended){{ end }}",
 			Details: `
 {{ "Details:" | faint }}
-{{ if eq . "content" }}Content-based deduplication using full chunk hashing (recommended)
-{{ else if eq . "fingerprint" }}Fingerprint-based deduplication using sampling (faster but less accurate){{ end }}
+{{ if eq . "content" }}Reuse identical chunks across all files: the most savings, one index lookup per chunk (recommended)
+{{ else if eq . "file" }}Reuse chunks only between files with identical content: no chunk index, one extra read per file
+{{ else if eq . "none" }}Store every file's chunks anew{{ end }}
 `,
 		},
 	}
@@ -0,0 +1,228 @@
+package deduplication
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/sharedstore"
+)
+
+// RebuildResult summarises an index rebuild
+type RebuildResult struct {
+	Files      int `json:"files"`
+	Chunks     int `json:"chunks"`
+	References int `json:"references"`
+}
+
+// IndexProblem is one disagreement between the index and the file manifests
+type IndexProblem struct {
+	Hash         string `json:"hash"`
+	Scope        string `json:"scope,omitempty"` // Dedup scope of the chunk; empty for the default scope
+	Kind         string `json:"kind"`            // missing, stale, refcount or missing-chunk
+	IndexRefs    int    `json:"index_refs"`
+	ManifestRefs int    `json:"manifest_refs"`
+	StorageHash  string `json:"storage_hash,omitempty"`
+}
+
+// Index problem kinds
+const (
+	IndexProblemMissing      = "missing"       // Referenced by manifests but not indexed
+	IndexProblemStale        = "stale"         // Indexed but no longer referenced
+	IndexProblemRefCount     = "refcount"      // Reference counts disagree
+	IndexProblemMissingChunk = "missing-chunk" // Indexed chunk file is not on disk
+)
+
+// IndexCheck is the result of comparing the index against the file manifests
+type IndexCheck struct {
+	IndexedChunks int            `json:"indexed_chunks"`
+	Problems      []IndexProblem `json:"problems"`
+}
+
+// OK reports whether the index matches the manifests
+func (c *IndexCheck) OK() bool {
+	return len(c.Problems) == 0
+}
+
+// RebuildIndex reconstructs the deduplication index from the file manifests and
+// replaces whatever is on disk, including an index that no longer loads. The index
+// of a shared chunk store is rebuilt from the manifests of every registered vault.
+func RebuildIndex(vaultRoot string, dedupConfig config.DeduplicationConfig) (*RebuildResult, error) {
+	index, err := newEmptyIndex(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{vaultRoot: vaultRoot, config: dedupConfig, index: index}
+
+	idx := m.index
+	if idx.storePath != "" {
+		unlock, err := sharedstore.Lock(idx.storePath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	entries, result, err := m.expectedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.entries = entries
+	if err := os.MkdirAll(IndexDir(vaultRoot), constants.StandardDirPerms); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %w", err)
+	}
+	if err := idx.compactLocked(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CheckIndex compares reference counts in the index with the references found in
+// the file manifests, and checks that every indexed chunk is still on disk
+func (m *Manager) CheckIndex() (*IndexCheck, error) {
+	expected, _, err := m.expectedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	m.index.mutex.RLock()
+	defer m.index.mutex.RUnlock()
+
+	check := &IndexCheck{IndexedChunks: len(m.index.entries), Problems: []IndexProblem{}}
+	for key, want := range expected {
+		got, ok := m.index.entries[key]
+		switch {
+		case !ok:
+			check.Problems = append(check.Problems, IndexProblem{
+				Hash: want.Hash, Scope: want.Scope, Kind: IndexProblemMissing, ManifestRefs: want.RefCount, StorageHash: want.StorageHash,
+			})
+		case got.RefCount != want.RefCount:
+			check.Problems = append(check.Problems, IndexProblem{
+				Hash: want.Hash, Scope: want.Scope, Kind: IndexProblemRefCount, IndexRefs: got.RefCount, ManifestRefs: want.RefCount,
+			})
+		}
+	}
+	for key, got := range m.index.entries {
+		if _, ok := expected[key]; !ok && got.RefCount > 0 {
+			check.Problems = append(check.Problems, IndexProblem{
+				Hash: got.Hash, Scope: got.Scope, Kind: IndexProblemStale, IndexRefs: got.RefCount,
+			})
+		}
+		if _, exists := layout.LocateChunk(m.vaultRoot, got.StorageHash); !exists {
+			check.Problems = append(check.Problems, IndexProblem{
+				Hash: got.Hash, Scope: got.Scope, Kind: IndexProblemMissingChunk, IndexRefs: got.RefCount, StorageHash: got.StorageHash,
+			})
+		}
+	}
+
+	sort.Slice(check.Problems, func(i, j int) bool {
+		if check.Problems[i].Kind != check.Problems[j].Kind {
+			return check.Problems[i].Kind < check.Problems[j].Kind
+		}
+		if check.Problems[i].Hash != check.Problems[j].Hash {
+			return check.Problems[i].Hash < check.Problems[j].Hash
+		}
+		return check.Problems[i].Scope < check.Problems[j].Scope
+	})
+	return check, nil
+}
+
+// indexedVaults returns the vaults whose manifests the index covers: the vault
+// itself, or every vault registered with its shared store
+func (m *Manager) indexedVaults() ([]string, error) {
+	store, err := sharedstore.ForVault(m.vaultRoot)
+	if err != nil || store == nil {
+		return []string{m.vaultRoot}, err
+	}
+	vaults, err := store.Vaults()
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]string, 0, len(vaults))
+	for _, vault := range vaults {
+		if err := store.CheckMember(vault); err != nil {
+			return nil, err
+		}
+		roots = append(roots, vault.Path)
+	}
+	return roots, nil
+}
+
+// expectedEntries walks the file manifests and builds the entries the index should
+// hold: one per chunk that ProcessChunk would have indexed, counting every reference
+func (m *Manager) expectedEntries() (map[string]*ChunkIndexEntry, *RebuildResult, error) {
+	entries := make(map[string]*ChunkIndexEntry)
+	result := &RebuildResult{}
+	if !m.config.Enabled {
+		return entries, result, nil
+	}
+
+	vaultRoots, err := m.indexedVaults()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, vaultRoot := range vaultRoots {
+		if err := m.addExpectedEntries(vaultRoot, entries, result); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	result.Chunks = len(entries)
+	return entries, result, nil
+}
+
+// addExpectedEntries adds the chunk references of one vault's manifests to entries
+func (m *Manager) addExpectedEntries(vaultRoot string, entries map[string]*ChunkIndexEntry, result *RebuildResult) error {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	return manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		result.Files++
+		added := entry.Manifest.AddedAt
+		for _, ref := range entry.Manifest.Chunks {
+			if ref.Zero || ref.Remote || !m.shouldDeduplicateChunk(ref.Size) {
+				continue
+			}
+			result.References++
+			key := refKey(ref)
+			e, ok := entries[key]
+			if !ok {
+				e = &ChunkIndexEntry{
+					Hash:            ref.Hash,
+					Size:            ref.Size,
+					StorageHash:     storageKey(ref),
+					FirstSeen:       added,
+					LastReferenced:  added,
+					Compressed:      ref.Compressed,
+					CompressionType: compressionTypeOf(ref),
+					CompressionDict: ref.CompressionDict,
+					Encrypted:       ref.EncryptedHash != "",
+					Convergent:      ref.Convergent,
+					Scope:           ref.Scope,
+				}
+				entries[key] = e
+			}
+			e.RefCount++
+			if added.Before(e.FirstSeen) {
+				e.FirstSeen = added
+			}
+			if added.After(e.LastReferenced) {
+				e.LastReferenced = added
+			}
+			// Older manifests may name several ciphertexts for one chunk; keep one that exists
+			if key := storageKey(ref); key != e.StorageHash {
+				if _, exists := layout.LocateChunk(m.vaultRoot, e.StorageHash); !exists {
+					e.StorageHash = key
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,214 @@
+package deduplication
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// TopSavingsFiles is the number of files listed in a savings report
+const TopSavingsFiles = 20
+
+// SavingsReport describes what deduplication actually saves, computed from the
+// file manifests and the chunk store rather than the deduplication index
+type SavingsReport struct {
+	Since        *time.Time      `json:"since,omitempty"`
+	Files        int             `json:"files"`
+	LogicalBytes int64           `json:"logical_bytes"` // Sum of file sizes
+	ZeroBytes    int64           `json:"zero_bytes"`    // All-zero chunks, never stored
+	UniqueBytes  int64           `json:"unique_bytes"`  // Plaintext size of each distinct chunk, counted once
+	StoredBytes  int64           `json:"stored_bytes"`  // On-disk size of each distinct chunk (after compression/encryption)
+	SavedBytes   int64           `json:"saved_bytes"`   // Bytes not stored thanks to deduplication
+	DedupRatio   float64         `json:"dedup_ratio"`   // Non-zero logical bytes / unique bytes
+	References   int             `json:"chunk_references"`
+	UniqueChunks int             `json:"unique_chunks"`
+	TopFiles     []FileSavings   `json:"top_files"`
+	Sharing      []SharingBucket `json:"sharing"`
+}
+
+// FileSavings is one file's share of the deduplication savings. A chunk referenced
+// n times contributes size*(n-1)/n to every file referencing it, so the savings of
+// all files add up to the vault total.
+type FileSavings struct {
+	File         string `json:"file"`
+	Size         int64  `json:"size"`
+	SharedChunks int    `json:"shared_chunks"`
+	SavedBytes   int64  `json:"saved_bytes"`
+}
+
+// SharingBucket counts the distinct chunks referenced by exactly Files files
+type SharingBucket struct {
+	Files  int `json:"files"`
+	Chunks int `json:"chunks"`
+}
+
+// chunkUsage is what a savings scan keeps per distinct chunk
+type chunkUsage struct {
+	size       int64
+	storageKey string // Chunk file name; empty for pack entries
+	packed     int64  // Length of a pack entry
+	refs       int
+	files      int
+	lastFile   int // Index of the last file counted in files
+}
+
+// ComputeSavings scans the vault's file manifests and reports deduplication savings.
+// Only files added at or after since are counted when since is non-nil. Manifests
+// are streamed twice; memory use grows with the number of distinct chunks and not
+// with the number of files.
+func ComputeSavings(vaultRoot string, since *time.Time) (*SavingsReport, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	include := func(manifest *config.FileManifest) bool {
+		return since == nil || !manifest.AddedAt.Before(*since)
+	}
+
+	report := &SavingsReport{Since: since, TopFiles: []FileSavings{}, Sharing: []SharingBucket{}}
+	usage := make(map[string]*chunkUsage)
+
+	// First pass: count references and referencing files for every chunk
+	fileIndex := 0
+	err = manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		if !include(&entry.Manifest) {
+			return nil
+		}
+		fileIndex++
+		report.Files++
+		report.LogicalBytes += entry.Manifest.Size
+		for _, ref := range savingsChunks(&entry.Manifest) {
+			if ref.Zero {
+				report.ZeroBytes += ref.Size
+				continue
+			}
+			report.References++
+			u, ok := usage[refKey(ref)]
+			if !ok {
+				u = &chunkUsage{size: ref.Size}
+				switch {
+				case entry.Manifest.Pack != nil:
+					u.packed = entry.Manifest.Pack.Length
+				case ref.EncryptedHash != "":
+					u.storageKey = ref.EncryptedHash
+				default:
+					u.storageKey = ref.Hash
+				}
+				usage[refKey(ref)] = u
+			}
+			u.refs++
+			if u.lastFile != fileIndex {
+				u.lastFile = fileIndex
+				u.files++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sharing := make(map[int]int)
+	for _, u := range usage {
+		report.UniqueChunks++
+		report.UniqueBytes += u.size
+		report.StoredBytes += storedChunkSize(vaultRoot, u)
+		sharing[u.files]++
+	}
+	report.SavedBytes = report.LogicalBytes - report.ZeroBytes - report.UniqueBytes
+	if report.UniqueBytes > 0 {
+		report.DedupRatio = float64(report.LogicalBytes-report.ZeroBytes) / float64(report.UniqueBytes)
+	}
+	for files, chunks := range sharing {
+		report.Sharing = append(report.Sharing, SharingBucket{Files: files, Chunks: chunks})
+	}
+	sort.Slice(report.Sharing, func(i, j int) bool { return report.Sharing[i].Files < report.Sharing[j].Files })
+
+	// Second pass: attribute savings to files, keeping only the top entries
+	top := &savingsHeap{}
+	err = manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		if !include(&entry.Manifest) {
+			return nil
+		}
+		file := FileSavings{File: entry.Manifest.Destination + entry.Manifest.FilePath, Size: entry.Manifest.Size}
+		for _, ref := range savingsChunks(&entry.Manifest) {
+			u, ok := usage[refKey(ref)]
+			if ref.Zero || !ok || u.refs < 2 {
+				continue
+			}
+			file.SharedChunks++
+			file.SavedBytes += u.size * int64(u.refs-1) / int64(u.refs)
+		}
+		if file.SavedBytes == 0 {
+			return nil
+		}
+		heap.Push(top, file)
+		if top.Len() > TopSavingsFiles {
+			heap.Pop(top)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for top.Len() > 0 {
+		report.TopFiles = append(report.TopFiles, heap.Pop(top).(FileSavings))
+	}
+	// The heap pops smallest first
+	for i, j := 0, len(report.TopFiles)-1; i < j; i, j = i+1, j-1 {
+		report.TopFiles[i], report.TopFiles[j] = report.TopFiles[j], report.TopFiles[i]
+	}
+
+	return report, nil
+}
+
+// savingsChunks returns the chunks a file occupies. A packed file is treated as a
+// single chunk identified by its pack entry, since entries can be shared too.
+func savingsChunks(manifest *config.FileManifest) []config.ChunkRef {
+	if manifest.Pack == nil {
+		return manifest.Chunks
+	}
+	key := fmt.Sprintf("pack:%s:%d", manifest.Pack.ID, manifest.Pack.Offset)
+	return []config.ChunkRef{{Hash: key, Size: manifest.Size}}
+}
+
+// storedChunkSize returns a chunk's size on disk, or zero when it is missing.
+// Pack entries are counted at their length within the pack.
+func storedChunkSize(vaultRoot string, u *chunkUsage) int64 {
+	if u.storageKey == "" {
+		return u.packed
+	}
+	loc, exists := layout.LocateChunk(vaultRoot, u.storageKey)
+	if !exists {
+		return 0
+	}
+	size, err := loc.Size()
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// savingsHeap is a min-heap of files by saved bytes, used to keep the top entries
+type savingsHeap []FileSavings
+
+func (h savingsHeap) Len() int { return len(h) }
+func (h savingsHeap) Less(i, j int) bool {
+	if h[i].SavedBytes != h[j].SavedBytes {
+		return h[i].SavedBytes < h[j].SavedBytes
+	}
+	return h[i].File > h[j].File
+}
+func (h savingsHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *savingsHeap) Push(x any)   { *h = append(*h, x.(FileSavings)) }
+func (h *savingsHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
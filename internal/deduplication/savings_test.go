@@ -0,0 +1,106 @@
+package deduplication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// writeSavingsManifest stores a file manifest and any of its chunks not yet in the vault
+func writeSavingsManifest(t *testing.T, vaultRoot string, manifest config.FileManifest) {
+	t.Helper()
+	for _, ref := range manifest.Chunks {
+		if !ref.Zero && !fs.ChunkExists(vaultRoot, ref.Hash) {
+			if err := fs.StoreChunk(vaultRoot, ref.Hash, make([]byte, ref.Size/2)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(&manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(manifestsDir, manifest.FilePath+".yaml"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComputeSavings(t *testing.T) {
+	vaultRoot := t.TempDir()
+	day1 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	shared := config.ChunkRef{Hash: "aaaa", Size: 100}
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "a.bin", Destination: "docs/", Size: 300, AddedAt: day1,
+		Chunks: []config.ChunkRef{shared, {Hash: "bbbb", Size: 100}, {Hash: "zero", Size: 100, Zero: true}},
+	})
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "b.bin", Destination: "docs/", Size: 200, AddedAt: day2,
+		Chunks: []config.ChunkRef{shared, shared},
+	})
+
+	report, err := ComputeSavings(vaultRoot, nil)
+	if err != nil {
+		t.Fatalf("ComputeSavings() error: %v", err)
+	}
+
+	if report.Files != 2 || report.LogicalBytes != 500 || report.ZeroBytes != 100 {
+		t.Errorf("unexpected totals: %+v", report)
+	}
+	if report.UniqueChunks != 2 || report.UniqueBytes != 200 || report.References != 4 {
+		t.Errorf("unexpected chunk counts: %+v", report)
+	}
+	if report.StoredBytes != 100 {
+		t.Errorf("StoredBytes = %d, want on-disk size 100", report.StoredBytes)
+	}
+	if report.SavedBytes != 200 || report.DedupRatio != 2 {
+		t.Errorf("SavedBytes = %d, DedupRatio = %.2f; want 200, 2.00", report.SavedBytes, report.DedupRatio)
+	}
+
+	// "aaaa" is referenced 3 times: each reference saves 2/3 of its 100 bytes
+	if len(report.TopFiles) != 2 || report.TopFiles[0].File != "docs/b.bin" || report.TopFiles[0].SavedBytes != 132 {
+		t.Errorf("unexpected top files: %+v", report.TopFiles)
+	}
+	wantSharing := []SharingBucket{{Files: 1, Chunks: 1}, {Files: 2, Chunks: 1}}
+	if len(report.Sharing) != 2 || report.Sharing[0] != wantSharing[0] || report.Sharing[1] != wantSharing[1] {
+		t.Errorf("Sharing = %+v, want %+v", report.Sharing, wantSharing)
+	}
+
+	// Only b.bin was added on day 2
+	report, err = ComputeSavings(vaultRoot, &day2)
+	if err != nil {
+		t.Fatalf("ComputeSavings(since) error: %v", err)
+	}
+	if report.Files != 1 || report.UniqueBytes != 100 || report.SavedBytes != 100 {
+		t.Errorf("unexpected report for files since day 2: %+v", report)
+	}
+}
+
+func TestComputeSavingsTopFilesLimit(t *testing.T) {
+	vaultRoot := t.TempDir()
+	for i := 0; i < TopSavingsFiles+5; i++ {
+		writeSavingsManifest(t, vaultRoot, config.FileManifest{
+			FilePath: filepath.Base(t.Name()) + string(rune('a'+i)), Size: 10,
+			Chunks: []config.ChunkRef{{Hash: "shared", Size: 10}},
+		})
+	}
+
+	report, err := ComputeSavings(vaultRoot, nil)
+	if err != nil {
+		t.Fatalf("ComputeSavings() error: %v", err)
+	}
+	if len(report.TopFiles) != TopSavingsFiles {
+		t.Errorf("expected %d top files, got %d", TopSavingsFiles, len(report.TopFiles))
+	}
+}
@@ -0,0 +1,71 @@
+package deduplication
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// DefaultScope names the scope of files outside every configured prefix
+const DefaultScope = "default"
+
+// ResolveScope returns the dedup scope of a vault path: the scope with the
+// longest prefix containing it, or "" for the default scope. A prefix matches
+// whole path components, so "work" covers "work/a.txt" but not "workshop/".
+func ResolveScope(scopes []config.DedupScope, vaultPath string) string {
+	vaultPath = strings.TrimPrefix(vaultPath, "/")
+	name, longest := "", -1
+	for _, scope := range scopes {
+		prefix := strings.Trim(scope.Prefix, "/")
+		if prefix != "" && vaultPath != prefix && !strings.HasPrefix(vaultPath, prefix+"/") {
+			continue
+		}
+		if len(prefix) > longest {
+			name, longest = scope.Name, len(prefix)
+		}
+	}
+	return name
+}
+
+// ValidateScopes checks the dedup scopes configured for a vault
+func ValidateScopes(scopes []config.DedupScope) error {
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		prefix := strings.Trim(scope.Prefix, "/")
+		switch {
+		case scope.Name == "":
+			return fmt.Errorf("dedup scope for prefix %q has no name", scope.Prefix)
+		case scope.Name == DefaultScope:
+			return fmt.Errorf("dedup scope name %q is reserved", DefaultScope)
+		case strings.Contains(scope.Name, ":"):
+			return fmt.Errorf("dedup scope name %q must not contain ':'", scope.Name)
+		case seen[prefix]:
+			return fmt.Errorf("dedup scope prefix %q is listed twice", scope.Prefix)
+		}
+		seen[prefix] = true
+	}
+	return nil
+}
+
+// ScopeName returns the display name of a scope, naming the default scope
+func ScopeName(scope string) string {
+	if scope == "" {
+		return DefaultScope
+	}
+	return scope
+}
+
+// indexKey returns the key a chunk is indexed under. The default scope uses the
+// plain chunk hash, so vaults without scopes keep the index they always had.
+func indexKey(scope, hash string) string {
+	if scope == "" {
+		return hash
+	}
+	return scope + ":" + hash
+}
+
+// refKey returns the index key of a chunk reference
+func refKey(ref config.ChunkRef) string {
+	return indexKey(ref.Scope, ref.Hash)
+}
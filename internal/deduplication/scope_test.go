@@ -0,0 +1,144 @@
+package deduplication
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+func TestResolveScope(t *testing.T) {
+	scopes := []config.DedupScope{
+		{Prefix: "work/", Name: "work"},
+		{Prefix: "personal", Name: "personal"},
+		{Prefix: "personal/shared/", Name: "work"},
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"work/report.pdf", "work"},
+		{"/work/deep/report.pdf", "work"},
+		{"workshop/plan.txt", ""},
+		{"personal/diary.txt", "personal"},
+		{"personal/shared/budget.xls", "work"},
+		{"photos/beach.jpg", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ResolveScope(scopes, tt.path); got != tt.want {
+				t.Errorf("ResolveScope(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []config.DedupScope
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"valid", []config.DedupScope{{Prefix: "work/", Name: "work"}, {Prefix: "notes/", Name: "work"}}, false},
+		{"missing name", []config.DedupScope{{Prefix: "work/"}}, true},
+		{"reserved name", []config.DedupScope{{Prefix: "work/", Name: DefaultScope}}, true},
+		{"colon in name", []config.DedupScope{{Prefix: "work/", Name: "a:b"}}, true},
+		{"duplicate prefix", []config.DedupScope{{Prefix: "work/", Name: "a"}, {Prefix: "work", Name: "b"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateScopes(tt.scopes); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScopedDeduplication(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manager, err := NewManager(vaultRoot, testDedupConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unencrypted chunks are stored under their plaintext hash, so both scopes
+	// index the same chunk file
+	data := []byte("the same data in two compartments")
+	ref := config.ChunkRef{Hash: "aaaa", Size: int64(len(data))}
+	work, personal := ref, ref
+	work.Scope, personal.Scope = "work", "personal"
+
+	if _, dedup, err := manager.ProcessChunk(work, data, "aaaa"); err != nil || dedup {
+		t.Fatalf("first work chunk: dedup %v, err %v", dedup, err)
+	}
+	if _, dedup, err := manager.ProcessChunk(personal, data, "aaaa"); err != nil || dedup {
+		t.Errorf("chunk was reused across scopes: dedup %v, err %v", dedup, err)
+	}
+	if _, dedup, _ := manager.ProcessChunk(work, data, "aaaa"); !dedup {
+		t.Error("chunk was not reused within its scope")
+	}
+	if _, dedup, _ := manager.ProcessChunk(ref, data, "aaaa"); dedup {
+		t.Error("chunk was reused by the default scope")
+	}
+
+	if err := manager.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewManager(vaultRoot, testDedupConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := reloaded.GetStats()
+	if stats.TotalChunks != 3 || stats.Scopes["work"].SavedSpace != int64(len(data)) || stats.Scopes[DefaultScope].TotalChunks != 1 {
+		t.Errorf("GetStats() = %+v, want 3 chunks with work saving one copy", stats)
+	}
+
+	// Releasing every personal and default reference leaves the file for work
+	reloaded.ReleaseChunks([]config.ChunkRef{personal, ref})
+	if err := reloaded.index.RemoveChunk(refKey(work)); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := layout.LocateChunk(vaultRoot, "aaaa"); !exists {
+		t.Error("chunk file still used by the work scope was removed")
+	}
+	if err := reloaded.index.RemoveChunk(refKey(work)); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := layout.LocateChunk(vaultRoot, "aaaa"); exists {
+		t.Error("chunk file was kept after its last scope released it")
+	}
+
+	removed, err := reloaded.GarbageCollectScopes()
+	if err != nil || len(removed) != 0 {
+		t.Errorf("GarbageCollectScopes() = %v, %v; want nothing left to collect", removed, err)
+	}
+}
+
+func TestRebuildIndexKeepsScopes(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "a.txt", Destination: "work/", Size: 200,
+		Chunks: []config.ChunkRef{{Hash: "aaaa", Size: 100, Scope: "work"}, {Hash: "aaaa", Size: 100, Scope: "work"}},
+	})
+	writeSavingsManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "b.txt", Size: 100,
+		Chunks: []config.ChunkRef{{Hash: "aaaa", Size: 100}},
+	})
+
+	result, err := RebuildIndex(vaultRoot, testDedupConfig)
+	if err != nil {
+		t.Fatalf("RebuildIndex() error: %v", err)
+	}
+	if result.Chunks != 2 || result.References != 3 {
+		t.Errorf("RebuildIndex() = %+v, want 2 chunks and 3 references", result)
+	}
+	idx := openTestIndex(t, vaultRoot)
+	if entry, ok := idx.GetChunk(indexKey("work", "aaaa")); !ok || entry.RefCount != 2 || entry.Scope != "work" {
+		t.Errorf("work entry = %+v, %v", entry, ok)
+	}
+	if entry, ok := idx.GetChunk("aaaa"); !ok || entry.RefCount != 1 || entry.Scope != "" {
+		t.Errorf("default entry = %+v, %v", entry, ok)
+	}
+}
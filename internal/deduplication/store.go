@@ -0,0 +1,69 @@
+package deduplication
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// TxnStore stores chunks through the deduplication manager, staging new chunk
+// content in a transaction. It satisfies the chunker.ChunkStore interface.
+type TxnStore struct {
+	manager *Manager
+	txn     *atomic.Transaction
+	scope   string
+	hints   *Hints
+}
+
+// TransactionalStore returns a chunk store that deduplicates against the vault
+// index and stages new chunks through txn
+func (m *Manager) TransactionalStore(txn *atomic.Transaction) *TxnStore {
+	return &TxnStore{manager: m, txn: txn}
+}
+
+// WithScope returns a store that only reuses chunks of the given dedup scope
+func (s *TxnStore) WithScope(scope string) *TxnStore {
+	return &TxnStore{manager: s.manager, txn: s.txn, scope: scope, hints: s.hints}
+}
+
+// WithHints returns a store that records chunks listed in hints as remote
+// references instead of storing them, unless the vault already holds them
+func (s *TxnStore) WithHints(hints *Hints) *TxnStore {
+	return &TxnStore{manager: s.manager, txn: s.txn, scope: s.scope, hints: hints}
+}
+
+// Put deduplicates or stages a chunk and returns the reference to record
+func (s *TxnStore) Put(ref config.ChunkRef, data []byte) (config.ChunkRef, error) {
+	ref.Scope = s.scope
+	if s.hints != nil {
+		if hint, ok := s.hints.Lookup(ref.Hash, ref.Size); ok && !s.manager.index.HasChunk(refKey(ref)) {
+			return hint.RemoteRef(ref), nil
+		}
+	}
+	updated, _, err := s.manager.ProcessChunkTransactional(s.txn, ref, data, storageKey(ref))
+	return updated, err
+}
+
+// Get reads a chunk, including one staged in the open transaction
+func (s *TxnStore) Get(ref config.ChunkRef) ([]byte, error) {
+	key := storageKey(ref)
+	if staged, ok := s.txn.StagedPath(layout.ChunkRelPath(s.manager.vaultRoot, key)); ok {
+		data, err := os.ReadFile(staged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read staged chunk %s: %w", key, err)
+		}
+		return data, nil
+	}
+	return fs.GetChunk(s.manager.vaultRoot, key)
+}
+
+func storageKey(ref config.ChunkRef) string {
+	if ref.EncryptedHash != "" {
+		return ref.EncryptedHash
+	}
+	return ref.Hash
+}
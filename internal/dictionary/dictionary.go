@@ -0,0 +1,205 @@
+// Package dictionary trains the zstd dictionaries a vault compresses small
+// files with and tracks which chunks still need them. A dictionary is never
+// changed once written: chunks record the ID of the dictionary they were
+// compressed with, so training a new one leaves older chunks readable.
+package dictionary
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/pack"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+const (
+	DefaultMaxFileSize = "64KB"  // Files up to this size are sampled and use the dictionary
+	DefaultSize        = "110KB" // zstd's own default dictionary size
+	DefaultSamples     = 2000    // Most files sampled for training
+
+	maxSampleBytes = 64 << 20 // Most sample data read for training
+)
+
+// Info describes a dictionary stored in a vault
+type Info struct {
+	ID         string
+	Size       int64
+	Active     bool // New small files are compressed with it
+	References int  // Chunks compressed with it, in live manifests and snapshots
+}
+
+// NewID returns a random dictionary ID. zstd reserves IDs below 32768 and from
+// 2^31 upwards, so IDs are drawn from the range in between.
+func NewID() (uint32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("failed to generate dictionary ID: %v", err)
+	}
+	return 32768 + binary.LittleEndian.Uint32(b[:])%(1<<31-32768), nil
+}
+
+// FormatID returns the string form chunks and file names use for a dictionary ID
+func FormatID(id uint32) string {
+	return fmt.Sprintf("%08x", id)
+}
+
+// Train builds a new dictionary of at most size bytes from samples
+func Train(samples [][]byte, size int) (compression.Dictionary, error) {
+	id, err := NewID()
+	if err != nil {
+		return compression.Dictionary{}, err
+	}
+	data, err := compression.TrainDictionary(samples, size, id)
+	if err != nil {
+		return compression.Dictionary{}, err
+	}
+	return compression.Dictionary{ID: FormatID(id), Data: data}, nil
+}
+
+// CollectSamples reads back up to maxSamples random files of the vault no
+// larger than maxFileSize, for training a dictionary on. Empty files are
+// skipped, as they have nothing to learn from.
+func CollectSamples(vaultRoot string, vaultConfig config.VaultConfig, passphrase string, opts chunker.Options, maxFileSize int64, maxSamples int) ([][]byte, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	var candidates []*config.FileManifest
+	err = manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		if entry.Manifest.Size > 0 && entry.Manifest.Size <= maxFileSize {
+			candidates = append(candidates, &entry.Manifest)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %v", err)
+	}
+	mathrand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	store := chunker.NewVaultStore(vaultRoot)
+	var samples [][]byte
+	total := 0
+	for _, file := range candidates {
+		if len(samples) >= maxSamples || total >= maxSampleBytes {
+			break
+		}
+		data, err := readFile(vaultRoot, vaultConfig, passphrase, store, opts, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file.FilePath, err)
+		}
+		samples = append(samples, data)
+		total += len(data)
+	}
+	return samples, nil
+}
+
+func readFile(vaultRoot string, vaultConfig config.VaultConfig, passphrase string, store chunker.ChunkStore, opts chunker.Options, file *config.FileManifest) ([]byte, error) {
+	if file.Pack != nil {
+		return pack.ReadFile(vaultRoot, vaultConfig, passphrase, file.Pack)
+	}
+	return io.ReadAll(chunker.NewReader(store, file.Chunks, opts))
+}
+
+// ReferenceCounts returns the number of chunks compressed with each
+// dictionary, across the live manifests and every snapshot
+func ReferenceCounts(vaultRoot string) (map[string]int, error) {
+	counts := make(map[string]int)
+	count := func(entry *config.ManifestEntry) error {
+		for _, ref := range entry.Manifest.Chunks {
+			if ref.CompressionDict != "" {
+				counts[ref.CompressionDict]++
+			}
+		}
+		return nil
+	}
+
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	if err := manager.WalkManifestEntries(count); err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %v", err)
+	}
+	snapshots, err := snapshot.List(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snapshots {
+		if err := config.WalkManifestDir(snapshot.ManifestDir(vaultRoot, snap.ID), count); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot %s: %v", snap.ID, err)
+		}
+	}
+	return counts, nil
+}
+
+// List describes every dictionary stored in the vault, and any that chunks
+// reference but the vault does not have yet
+func List(vaultRoot string, vaultConfig config.VaultConfig) ([]Info, error) {
+	ids, err := layout.ListDictionaryIDs(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := ReferenceCounts(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	active := ""
+	if vaultConfig.CompressionDict != nil {
+		active = vaultConfig.CompressionDict.ID
+	}
+	seen := make(map[string]bool)
+	var infos []Info
+	for _, id := range ids {
+		seen[id] = true
+		info := Info{ID: id, Size: -1, Active: id == active, References: counts[id]}
+		if stat, err := os.Stat(layout.DictionaryPath(vaultRoot, id)); err == nil {
+			info.Size = stat.Size()
+		}
+		infos = append(infos, info)
+	}
+	for id, n := range counts {
+		if !seen[id] {
+			infos = append(infos, Info{ID: id, Size: -1, Active: id == active, References: n})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+// Delete removes a dictionary from the vault. It refuses to remove the active
+// dictionary or one that chunks, live or in snapshots, were compressed with.
+func Delete(vaultRoot string, vaultConfig config.VaultConfig, id string) error {
+	if _, ok := layout.DictionaryIDFromName(layout.DictionaryName(id)); !ok {
+		return fmt.Errorf("invalid dictionary ID %q", id)
+	}
+	path := layout.DictionaryPath(vaultRoot, id)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("dictionary %s not found", id)
+	}
+	if vaultConfig.CompressionDict != nil && vaultConfig.CompressionDict.ID == id {
+		return fmt.Errorf("dictionary %s is the vault's active dictionary; train a new one first", id)
+	}
+	counts, err := ReferenceCounts(vaultRoot)
+	if err != nil {
+		return err
+	}
+	if n := counts[id]; n > 0 {
+		return fmt.Errorf("dictionary %s is still used by %d chunks; re-add or delete the files that use it, and delete snapshots that keep them, first", id, n)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete dictionary %s: %v", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package dictionary
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+)
+
+func writeManifest(t *testing.T, vaultRoot string, manifest config.FileManifest) string {
+	t.Helper()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(&manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(manifestsDir, manifest.FilePath+".yaml")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDeleteRefusesDictionariesInUse(t *testing.T) {
+	vaultRoot := t.TempDir()
+	if err := os.MkdirAll(layout.DictionaryDirectory(vaultRoot), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"0000a001", "0000b002", "0000c003", "0000d004"} {
+		if err := os.WriteFile(layout.DictionaryPath(vaultRoot, id), []byte(id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One dictionary is used by a live file, another only by a snapshot
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "live.json", Size: 10, Chunks: []config.ChunkRef{
+		{Hash: "aaaa", Size: 10, Compressed: true, CompressionType: "zstd", CompressionDict: "0000a001"},
+	}})
+	old := writeManifest(t, vaultRoot, config.FileManifest{FilePath: "old.json", Size: 10, Chunks: []config.ChunkRef{
+		{Hash: "bbbb", Size: 10, Compressed: true, CompressionType: "zstd", CompressionDict: "0000b002"},
+	}})
+	if _, err := snapshot.Create(vaultRoot, "before cleanup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(old); err != nil {
+		t.Fatal(err)
+	}
+
+	vaultConfig := config.VaultConfig{CompressionDict: &config.CompressionDictConfig{ID: "0000c003", MaxFileSize: "64KB"}}
+	tests := []struct {
+		id      string
+		wantErr string
+	}{
+		{id: "0000a001", wantErr: "still used by 2 chunks"}, // Live and in the snapshot
+		{id: "0000b002", wantErr: "still used by 1 chunks"},
+		{id: "0000c003", wantErr: "active dictionary"},
+		{id: "0000e005", wantErr: "not found"},
+		{id: "../vault", wantErr: "invalid dictionary ID"},
+		{id: "0000d004"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			err := Delete(vaultRoot, vaultConfig, tt.id)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Delete() error: %v", err)
+				}
+				if _, err := os.Stat(layout.DictionaryPath(vaultRoot, tt.id)); !os.IsNotExist(err) {
+					t.Error("Delete() left the dictionary in place")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Delete() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	infos, err := List(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 || !infos[2].Active || infos[0].References != 2 {
+		t.Errorf("List() = %+v", infos)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id, err := NewID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id < 32768 || id >= 1<<31 {
+			t.Fatalf("NewID() = %d, outside zstd's user range", id)
+		}
+	}
+	if got := FormatID(0x8001); got != "00008001" {
+		t.Errorf("FormatID() = %s", got)
+	}
+}
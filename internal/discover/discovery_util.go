@@ -3,6 +3,7 @@ package discover
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/host"
@@ -19,9 +20,9 @@ func CreateSyncService(h host.Host, vaultMgr *config.Manager, vaultConfig *confi
 	var err error
 
 	if vaultConfig.Sync.Enabled && vaultConfig.Sync.RSA != nil {
-		privateKey, publicKey, rsaConfig, err := keys.LoadRSAKeys(vaultPath, vaultConfig.Sync.RSA)
+		privateKey, publicKey, rsaConfig, err := keys.LoadSyncKeys(vaultPath, vaultConfig.Sync.RSA)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load RSA keys: %v", err)
+			return nil, fmt.Errorf("failed to load sync keys: %v", err)
 		}
 
 		syncService, err = p2p.NewSecureSyncService(h, vaultMgr, privateKey, publicKey, rsaConfig)
@@ -29,7 +30,7 @@ func CreateSyncService(h host.Host, vaultMgr *config.Manager, vaultConfig *confi
 			return nil, fmt.Errorf("failed to create sync service: %v", err)
 		}
 
-		fmt.Println("🔐 RSA key exchange enabled with fingerprint:", rsaConfig.Fingerprint)
+		fmt.Printf("🔐 %s key exchange enabled with fingerprint: %s\n", strings.ToUpper(rsaConfig.KeyType), rsaConfig.Fingerprint)
 	} else {
 		syncService, err = p2p.NewSyncService(h, vaultMgr)
 		if err != nil {
@@ -168,6 +169,9 @@ func handleDiscoveredPeer(ctx context.Context, h host.Host, syncService *p2p.Syn
 			fmt.Println("Peer added to trusted list")
 		}
 	} else {
+		fingerprint, _ := syncService.GetPeerFingerprint(p.ID)
 		fmt.Println("peer not trusted")
+		fmt.Printf("   Fingerprint: %s\n", fingerprint)
+		fmt.Println("   Sync with it or run 'sietch peer add' to trust it once its owner confirmed the fingerprint")
 	}
 }
@@ -28,7 +28,7 @@ func AesEncryption(data string, vaultConfig config.VaultConfig) (string, error)
 	}
 
 	// Load encryption key from the specified path
-	keyData, err := loadEncryptionKey(vaultConfig.Encryption.KeyPath)
+	keyData, err := loadEncryptionKey(vaultConfig.Encryption)
 	if err != nil {
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
@@ -155,7 +155,7 @@ func AesDecryption(encryptedData string, vaultPath string) (string, error) {
 	}
 
 	// Load encryption key
-	keyData, err := loadEncryptionKey(vaultConfig.Encryption.KeyPath)
+	keyData, err := loadEncryptionKey(vaultConfig.Encryption)
 	if err != nil {
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
@@ -286,24 +286,44 @@ func AesDecryptionWithPassphrase(encryptedData string, vaultPath string, passphr
 	return "", fmt.Errorf("unsupported encryption mode: %s", mode)
 }
 
-func loadEncryptionKey(keyPath string) ([]byte, error) {
+func loadEncryptionKey(encConfig config.EncryptionConfig) ([]byte, error) {
+	keyData, _, err := readKeyFile(encConfig.KeyPath, encConfig)
+	return keyData, err
+}
+
+// readKeyFile reads the vault key file. Age-wrapped key files are opened with an
+// age identity. When the file is missing, the key is unwrapped for the recipient
+// identity named by SIETCH_IDENTITY, if any. Keys opened either way are returned
+// unwrapped and never need the passphrase.
+func readKeyFile(keyPath string, encConfig config.EncryptionConfig) ([]byte, bool, error) {
 	keyData, err := os.ReadFile(keyPath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading key file: %w", err)
+	if err == nil {
+		if encConfig.AgeConfig != nil {
+			keyData, err = unwrapAgeKey(keyData, encConfig.AgeConfig)
+			return keyData, err == nil, err
+		}
+		return keyData, false, nil
+	}
+	if os.IsNotExist(err) && UnlocksWithIdentity(encConfig) {
+		keyData, err := unwrapWithIdentity(encConfig)
+		if err != nil {
+			return nil, false, err
+		}
+		return keyData, true, nil
 	}
-	return keyData, nil
+	return nil, false, fmt.Errorf("error reading key file: %w", err)
 }
 
 // loadEncryptionKeyWithPassphrase loads and decrypts the encryption key if needed
 func loadEncryptionKeyWithPassphrase(keyPath string, passphrase string, encConfig config.EncryptionConfig) ([]byte, error) {
 	// Read the key file
-	encryptedKey, err := os.ReadFile(keyPath)
+	encryptedKey, unwrapped, err := readKeyFile(keyPath, encConfig)
 	if err != nil {
-		return nil, fmt.Errorf("error reading key file: %w", err)
+		return nil, err
 	}
 
 	// If not passphrase protected, return the key as-is
-	if !encConfig.PassphraseProtected {
+	if !encConfig.PassphraseProtected || unwrapped {
 		return encryptedKey, nil
 	}
 
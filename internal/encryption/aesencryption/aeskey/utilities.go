@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 
 	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
 )
 
 // Random generation utilities
@@ -54,12 +55,11 @@ func generateRandomKey() ([]byte, error) {
 // backupKeyToFile creates a backup of the key at the specified path
 func backupKeyToFile(key []byte, path string) error {
 	// Create directory if it doesn't exist
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, constants.SecureDirPerms); err != nil {
+	if err := private.Mkdir(filepath.Dir(path)); err != nil {
 		return err
 	}
 	// Write file with restrictive permissions
-	return os.WriteFile(path, key, constants.SecureFilePerms)
+	return private.WriteFileAtomic(path, key)
 }
 
 // expandPath expands ~ to home directory in file paths
@@ -85,8 +85,7 @@ func calculateKeyHash(key []byte) string {
 
 // ensureKeyDirectoryExists creates the directory structure for key storage
 func ensureKeyDirectoryExists(keyPath string) error {
-	keyDir := filepath.Dir(keyPath)
-	return os.MkdirAll(keyDir, constants.SecureDirPerms)
+	return private.Mkdir(filepath.Dir(keyPath))
 }
 
 // writeKeyToFile writes the key material to file with secure permissions
@@ -95,7 +94,7 @@ func writeKeyToFile(keyMaterial []byte, keyPath string) error {
 		return fmt.Errorf("failed to create key directory: %w", err)
 	}
 
-	if err := os.WriteFile(keyPath, keyMaterial, constants.SecureFilePerms); err != nil {
+	if err := private.WriteFileAtomic(keyPath, keyMaterial); err != nil {
 		return fmt.Errorf("failed to write key to %s: %w", keyPath, err)
 	}
 
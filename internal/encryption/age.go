@@ -0,0 +1,49 @@
+package encryption
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption/agekey"
+)
+
+// unwrapAgeKey opens an age-wrapped key file with the age identities named by
+// SIETCH_IDENTITY or, failing that, by the vault's identity_file
+func unwrapAgeKey(wrapped []byte, ageConfig *config.AgeConfig) ([]byte, error) {
+	var identities []*agekey.Identity
+	for _, path := range []string{os.Getenv(IdentityEnv), ageConfig.IdentityFile} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if path == ageConfig.IdentityFile && os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read age identity %s: %w", path, err)
+		}
+		if !agekey.IsKeyFile(data) {
+			continue // An RSA identity for a recipient, not an age one
+		}
+		keyFile, err := agekey.ParseKeyFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age identity %s: %w", path, err)
+		}
+		identities = append(identities, keyFile.Identities...)
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("the vault key is wrapped with age; set %s to an age identity file for one of: %v",
+			IdentityEnv, ageConfig.Recipients)
+	}
+
+	dataKey, err := agekey.Decrypt(wrapped, identities)
+	if errors.Is(err, agekey.ErrNoIdentityMatched) {
+		return nil, fmt.Errorf("none of the age identities can open the vault key (wrapped for %v)", ageConfig.Recipients)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap age key file: %w", err)
+	}
+	return dataKey, nil
+}
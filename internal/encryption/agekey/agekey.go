@@ -0,0 +1,178 @@
+// Package agekey wraps a vault's data key in the age file format
+// (https://age-encryption.org/v1), using age's X25519 recipients, so that
+// vault keys can be managed with existing age identities. The files are
+// written and read by filippo.io/age, the reference implementation, so a
+// wrapped key file is an ordinary age file: `age -d -i key.txt secret.key`
+// recovers the raw key.
+package agekey
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// ErrNoIdentityMatched is returned when none of the identities can open a file
+var ErrNoIdentityMatched = errors.New("no age identity matched the key file")
+
+// Identity is an age X25519 private key
+type Identity struct {
+	identity *age.X25519Identity
+}
+
+// Recipient is an age X25519 public key
+type Recipient struct {
+	recipient *age.X25519Recipient
+}
+
+// GenerateIdentity creates a new random identity
+func GenerateIdentity() (*Identity, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate age identity: %w", err)
+	}
+	return &Identity{identity: identity}, nil
+}
+
+// ParseIdentity parses an AGE-SECRET-KEY-1... string
+func ParseIdentity(s string) (*Identity, error) {
+	identity, err := age.ParseX25519Identity(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed age identity: %v", err)
+	}
+	return &Identity{identity: identity}, nil
+}
+
+// Recipient returns the public key of the identity
+func (i *Identity) Recipient() *Recipient {
+	return &Recipient{recipient: i.identity.Recipient()}
+}
+
+// String returns the identity in AGE-SECRET-KEY-1... form
+func (i *Identity) String() string {
+	return i.identity.String()
+}
+
+// ParseRecipient parses an age1... string
+func ParseRecipient(s string) (*Recipient, error) {
+	recipient, err := age.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed age recipient %q: %v", s, err)
+	}
+	return &Recipient{recipient: recipient}, nil
+}
+
+// String returns the recipient in age1... form
+func (r *Recipient) String() string {
+	return r.recipient.String()
+}
+
+// Encrypt writes plaintext as an age file readable by each of the recipients
+func Encrypt(plaintext []byte, recipients []*Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no age recipients")
+	}
+	ageRecipients := make([]age.Recipient, len(recipients))
+	for i, recipient := range recipients {
+		ageRecipients[i] = recipient.recipient
+	}
+
+	var out bytes.Buffer
+	w, err := age.Encrypt(&out, ageRecipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt age file: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt age file: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt age file: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// Decrypt opens an age file with the first identity that matches one of its
+// X25519 stanzas
+func Decrypt(data []byte, identities []*Identity) ([]byte, error) {
+	ageIdentities := make([]age.Identity, len(identities))
+	for i, identity := range identities {
+		ageIdentities[i] = identity.identity
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), ageIdentities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, ErrNoIdentityMatched
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age file: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age file: %w", err)
+	}
+	return plaintext, nil
+}
+
+// KeyFile is the content of an age identity or recipients file
+type KeyFile struct {
+	Identities []*Identity
+	Recipients []*Recipient // Listed recipients, followed by those of the identities
+}
+
+// IsKeyFile reports whether data looks like an age identity or recipients file
+// rather than raw key material
+func IsKeyFile(data []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return strings.HasPrefix(line, "AGE-SECRET-KEY-1") || strings.HasPrefix(line, "age1")
+	}
+	return false
+}
+
+// ParseKeyFile parses a file of age identities and recipients, one per line,
+// as written by age-keygen. Blank lines and # comments are ignored.
+func ParseKeyFile(data []byte) (*KeyFile, error) {
+	keyFile := &KeyFile{}
+	var identityRecipients []*Recipient
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "AGE-SECRET-KEY-1"):
+			identity, err := ParseIdentity(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			keyFile.Identities = append(keyFile.Identities, identity)
+			identityRecipients = append(identityRecipients, identity.Recipient())
+		case strings.HasPrefix(line, "age1"):
+			recipient, err := ParseRecipient(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			keyFile.Recipients = append(keyFile.Recipients, recipient)
+		default:
+			return nil, fmt.Errorf("line %d: not an age X25519 identity or recipient", n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read age key file: %w", err)
+	}
+	keyFile.Recipients = append(keyFile.Recipients, identityRecipients...)
+	if len(keyFile.Recipients) == 0 {
+		return nil, fmt.Errorf("no age identities or recipients found")
+	}
+	return keyFile, nil
+}
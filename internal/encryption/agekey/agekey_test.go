@@ -0,0 +1,229 @@
+package agekey
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The age test kit identity with a scalar of 32 0x42 bytes
+const (
+	testIdentity  = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+	testRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+)
+
+// ageCLIFile is "vault data key from age -r\n" encrypted by the age v1.2.1
+// command line tool with `age -r ` + testRecipient
+const ageCLIFile = `YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSBrMWg3K3pXeWR6UFdvZUhMQmxNUjhUend3
+T3plaTR2RUVpNDFjMjhpTlJvCjY1SVdiUU53NExhY3hhL21uVWdUcmZhZFBwNDdBWVh4d1I1bjRQ
+Y0NsVlUKLS0tIFEySkwwV3FqYnF3TUNQVW4vS2lxWG1mOVJ5OUZTYksycE9vTXgvUGxyRWcKZADK
+V8PDJsxCwNRXf0im9K3Lcl1vdDkX7dEDbdTPAK78kQjD1osLOEpf3QOQXTUuu2CAVtbKm9T6iwI=`
+
+// chunkSize is the size of an age payload chunk
+const chunkSize = 64 * 1024
+
+func TestParseKeys(t *testing.T) {
+	identity, err := ParseIdentity(testIdentity)
+	if err != nil {
+		t.Fatalf("ParseIdentity() error: %v", err)
+	}
+	if got := identity.String(); got != testIdentity {
+		t.Errorf("Identity.String() = %s", got)
+	}
+	if got := identity.Recipient().String(); got != testRecipient {
+		t.Errorf("Identity.Recipient() = %s, want %s", got, testRecipient)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "recipient", input: testRecipient},
+		{name: "example recipient", input: "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"},
+		{name: "bad checksum", input: testRecipient[:len(testRecipient)-1] + "q", wantErr: true},
+		{name: "mixed case", input: "Age1" + testRecipient[4:], wantErr: true},
+		{name: "identity as recipient", input: testIdentity, wantErr: true},
+		{name: "truncated", input: "age1qqqqqq", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipient, err := ParseRecipient(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRecipient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && recipient.String() != tt.input {
+				t.Errorf("Recipient.String() = %s, want %s", recipient.String(), tt.input)
+			}
+		})
+	}
+}
+
+func TestParseKeyFile(t *testing.T) {
+	other, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "# created: 2025-01-01T00:00:00Z\n# public key: " + testRecipient + "\n" + testIdentity + "\n\n" + other.Recipient().String() + "\n"
+	keyFile, err := ParseKeyFile([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseKeyFile() error: %v", err)
+	}
+	if len(keyFile.Identities) != 1 || len(keyFile.Recipients) != 2 {
+		t.Fatalf("ParseKeyFile() found %d identities and %d recipients, want 1 and 2", len(keyFile.Identities), len(keyFile.Recipients))
+	}
+	if keyFile.Recipients[1].String() != testRecipient {
+		t.Errorf("identity recipient = %s, want %s", keyFile.Recipients[1], testRecipient)
+	}
+
+	if !IsKeyFile([]byte(data)) || IsKeyFile(bytes.Repeat([]byte{0x42}, 32)) {
+		t.Error("IsKeyFile() misclassified a file")
+	}
+	if _, err := ParseKeyFile([]byte(testIdentity + "\nssh-ed25519 AAAA\n")); err == nil {
+		t.Error("ParseKeyFile() accepted an unsupported key")
+	}
+	if _, err := ParseKeyFile([]byte("# nothing here\n")); err == nil {
+		t.Error("ParseKeyFile() accepted a file without keys")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	alice, _ := ParseIdentity(testIdentity)
+	bob, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := make([]byte, 3*chunkSize+100)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		plaintext []byte
+	}{
+		{name: "empty", plaintext: []byte{}},
+		{name: "data key", plaintext: bytes.Repeat([]byte{7}, 32)},
+		{name: "exactly one chunk", plaintext: large[:chunkSize]},
+		{name: "several chunks", plaintext: large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped, err := Encrypt(tt.plaintext, []*Recipient{alice.Recipient(), bob.Recipient()})
+			if err != nil {
+				t.Fatalf("Encrypt() error: %v", err)
+			}
+			if !bytes.HasPrefix(wrapped, []byte("age-encryption.org/v1\n-> X25519 ")) {
+				t.Fatalf("Encrypt() header = %q", wrapped[:40])
+			}
+			for _, identity := range []*Identity{alice, bob} {
+				got, err := Decrypt(wrapped, []*Identity{eve, identity})
+				if err != nil {
+					t.Fatalf("Decrypt() error: %v", err)
+				}
+				if !bytes.Equal(got, tt.plaintext) {
+					t.Fatal("Decrypt() returned different data")
+				}
+			}
+			if _, err := Decrypt(wrapped, []*Identity{eve}); !errors.Is(err, ErrNoIdentityMatched) {
+				t.Errorf("Decrypt() with a stranger's identity error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDecryptRejectsDamage(t *testing.T) {
+	identity, _ := ParseIdentity(testIdentity)
+	wrapped, err := Encrypt(bytes.Repeat([]byte{1}, 32), []*Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerEnd := bytes.Index(wrapped, []byte("\n--- ")) + 1
+
+	damaged := func(f func([]byte) []byte) []byte {
+		return f(append([]byte{}, wrapped...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "not age", data: []byte("hello\n"), want: "unexpected intro"},
+		{name: "truncated header", data: wrapped[:headerEnd], want: "failed to read header"},
+		{name: "truncated payload", data: wrapped[:len(wrapped)-1], want: "authenticate"},
+		{name: "missing payload", data: wrapped[:bytes.IndexByte(wrapped[headerEnd:], '\n')+headerEnd+1], want: "failed to read nonce"},
+		{name: "changed header", data: damaged(func(b []byte) []byte {
+			return bytes.Replace(b, []byte("age-encryption.org/v1\n"), []byte("age-encryption.org/v1\n-> grease\n\n"), 1)
+		}), want: "MAC"},
+		{name: "flipped payload bit", data: damaged(func(b []byte) []byte {
+			b[len(b)-20] ^= 1
+			return b
+		}), want: "authenticate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(tt.data, []*Identity{identity})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decrypt() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestDecryptAgeCLIFile ensures a key file written by the age tool opens here
+func TestDecryptAgeCLIFile(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(ageCLIFile, "\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := ParseIdentity(testIdentity)
+	got, err := Decrypt(data, []*Identity{identity})
+	if err != nil {
+		t.Fatalf("Decrypt() error: %v", err)
+	}
+	if string(got) != "vault data key from age -r\n" {
+		t.Errorf("Decrypt() = %q", got)
+	}
+}
+
+// TestAgeCLIDecrypts ensures `age -d` opens the key files written here. It
+// needs the age tool on the PATH.
+func TestAgeCLIDecrypts(t *testing.T) {
+	ageCLI, err := exec.LookPath("age")
+	if err != nil {
+		t.Skip("age is not installed")
+	}
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(keyPath, []byte(testIdentity+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := ParseIdentity(testIdentity)
+	plaintext := bytes.Repeat([]byte{7}, 32)
+	wrapped, err := Encrypt(plaintext, []*Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappedPath := filepath.Join(dir, "secret.key")
+	if err := os.WriteFile(wrappedPath, wrapped, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := exec.Command(ageCLI, "-d", "-i", keyPath, wrappedPath).Output()
+	if err != nil {
+		t.Fatalf("age -d: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("age -d = %x, want %x", got, plaintext)
+	}
+}
@@ -21,7 +21,7 @@ func ChaCha20Encryption(data string, vaultConfig config.VaultConfig) (string, er
 	}
 
 	// Load encryption key from the specified path
-	keyData, err := loadEncryptionKey(vaultConfig.Encryption.KeyPath)
+	keyData, err := loadEncryptionKey(vaultConfig.Encryption)
 	if err != nil {
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
@@ -102,7 +102,7 @@ func ChaCha20Decryption(encryptedData string, vaultPath string) (string, error)
 	}
 
 	// Load encryption key
-	keyData, err := loadEncryptionKey(vaultConfig.Encryption.KeyPath)
+	keyData, err := loadEncryptionKey(vaultConfig.Encryption)
 	if err != nil {
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
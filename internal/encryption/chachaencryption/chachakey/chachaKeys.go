@@ -6,7 +6,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 
 	"golang.org/x/crypto/chacha20poly1305"
@@ -14,6 +13,7 @@ import (
 
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
 )
 
 // GenerateChaCha20Key creates a key configuration for ChaCha20 encryption
@@ -117,12 +117,12 @@ func GenerateChaCha20Key(cfg *config.VaultConfig, passphrase string) (*config.Ke
 func writeKeyToFile(keyPath string, keyMaterial []byte) error {
 	// Create directory structure for the key if it doesn't exist
 	keyDir := filepath.Dir(keyPath)
-	if err := os.MkdirAll(keyDir, constants.SecureDirPerms); err != nil {
+	if err := private.Mkdir(keyDir); err != nil {
 		return fmt.Errorf("failed to create key directory %s: %w", keyDir, err)
 	}
 
 	// Write the key with secure permissions (only owner can read/write)
-	if err := os.WriteFile(keyPath, keyMaterial, constants.SecureFilePerms); err != nil {
+	if err := private.WriteFileAtomic(keyPath, keyMaterial); err != nil {
 		return fmt.Errorf("failed to write key to %s: %w", keyPath, err)
 	}
 
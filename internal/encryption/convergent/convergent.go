@@ -0,0 +1,208 @@
+// Package convergent implements opt-in convergent chunk encryption.
+//
+// A chunk is normally encrypted under the vault key with a random nonce, so the
+// same data stored in two vaults encrypts to two different blobs. In convergent
+// mode each chunk is encrypted under a key derived from its plaintext hash and a
+// mixing secret, with a nonce derived from the data itself: identical chunks
+// encrypt identically, and vaults (or peers) holding the same secret can tell
+// which chunks they already share without decrypting them.
+//
+// The secret keeps outsiders from confirming that a vault holds a known file by
+// encrypting it themselves. Anyone who has the secret can still do that, which
+// is why it is only handed to trusted peers, sealed to their sync key.
+package convergent
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+)
+
+const secretSize = 32
+
+// PrivacyWarning explains what a vault gives up by enabling convergent encryption
+const PrivacyWarning = `Convergent encryption makes identical chunks encrypt to identical data.
+Anyone holding the vault's convergence secret (every peer you share it with) can
+check whether this vault stores a given file by encrypting that file themselves,
+and chunk hashes reveal which chunks two vaults have in common. Only share the
+secret with peers you would trust with that knowledge.`
+
+// NewSecret generates a mixing secret
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate convergence secret: %w", err)
+	}
+	return secret, nil
+}
+
+// SecretID returns a short fingerprint of a secret. Vaults with the same ID encrypt
+// chunks identically; the ID reveals nothing about the secret itself.
+func SecretID(secret []byte) string {
+	return hex.EncodeToString(deriveKey(secret, "sietch convergent id")[:8])
+}
+
+// Wrap encrypts a secret with the vault key for storing in vault.yaml
+func Wrap(secret []byte, vaultConfig *config.VaultConfig, passphrase string) (string, error) {
+	if vaultConfig.Encryption.Type == "" || vaultConfig.Encryption.Type == "none" {
+		return "", fmt.Errorf("convergent encryption requires an encrypted vault")
+	}
+	wrapped, err := encryption.EncryptDataWithPassphrase(hex.EncodeToString(secret), *vaultConfig, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap convergence secret: %w", err)
+	}
+	return wrapped, nil
+}
+
+// UnwrapSecret returns the vault's mixing secret
+func UnwrapSecret(vaultRoot string, vaultConfig *config.VaultConfig, passphrase string) ([]byte, error) {
+	settings := vaultConfig.Encryption.Convergent
+	if settings == nil || settings.Secret == "" {
+		return nil, fmt.Errorf("vault has no convergence secret")
+	}
+	unwrapped, err := encryption.DecryptDataWithPassphrase(settings.Secret, vaultRoot, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock convergence secret: %w", err)
+	}
+	secret, err := hex.DecodeString(unwrapped)
+	if err != nil || len(secret) != secretSize {
+		return nil, fmt.Errorf("convergence secret is corrupt")
+	}
+	return secret, nil
+}
+
+// Unlock returns the cipher for the vault's mixing secret, or nil when the vault
+// has never had one. A vault that turned convergent mode off keeps its secret so
+// chunks written in that mode stay readable.
+func Unlock(vaultRoot string, vaultConfig *config.VaultConfig, passphrase string) (*Cipher, error) {
+	if settings := vaultConfig.Encryption.Convergent; settings == nil || settings.Secret == "" {
+		return nil, nil
+	}
+	secret, err := UnwrapSecret(vaultRoot, vaultConfig, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(secret), nil
+}
+
+// Cipher encrypts chunks convergently with an unlocked mixing secret
+type Cipher struct {
+	chunkKey []byte
+}
+
+// NewCipher returns a cipher for a raw mixing secret
+func NewCipher(secret []byte) *Cipher {
+	return &Cipher{chunkKey: deriveKey(secret, "sietch convergent chunk key")}
+}
+
+// EncryptChunk encrypts data under the key for the chunk with plaintext hash hash.
+// The nonce is derived from the data, so the same input always gives the same
+// output and different inputs never share a nonce under one key.
+func (c *Cipher) EncryptChunk(hash string, data []byte) ([]byte, error) {
+	key := deriveKey(c.chunkKey, hash)
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := deriveKey(key, string(data))[:aead.NonceSize()]
+	return aead.Seal(nonce, nonce, data, []byte(hash)), nil
+}
+
+// DecryptChunk reverses EncryptChunk
+func (c *Cipher) DecryptChunk(hash string, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(deriveKey(c.chunkKey, hash))
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("convergent ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, sealed, []byte(hash))
+	if err != nil {
+		return nil, errors.New("failed to decrypt chunk: wrong convergence secret or corrupt data")
+	}
+	return data, nil
+}
+
+// SecretBundle is a mixing secret sealed to one trusted peer's sync key
+type SecretBundle struct {
+	SecretID  string `yaml:"secret_id"`
+	Recipient string `yaml:"recipient"` // Fingerprint of the peer's sync key
+	Secret    string `yaml:"secret"`    // RSA-OAEP encrypted secret, base64
+}
+
+// SealFor seals a secret so that only the given trusted peer can open it. The
+// peer must have an RSA sync key; Ed25519 keys can only sign.
+func SealFor(secret []byte, peer config.TrustedPeer) ([]byte, error) {
+	publicKey, err := keys.ParseSyncPublicKeyPEM([]byte(peer.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key of peer %s: %w", peer.ID, err)
+	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("peer %s has an %s sync key, which cannot receive secrets; it needs an RSA key", peer.ID, peer.KeyType)
+	}
+	sealed, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaKey, secret, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal convergence secret: %w", err)
+	}
+	return yaml.Marshal(&SecretBundle{
+		SecretID:  SecretID(secret),
+		Recipient: peer.Fingerprint,
+		Secret:    base64.StdEncoding.EncodeToString(sealed),
+	})
+}
+
+// OpenBundle opens a bundle sealed to this vault with its sync private key
+func OpenBundle(data []byte, privateKey crypto.Signer) ([]byte, error) {
+	var bundle SecretBundle
+	if err := yaml.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse secret bundle: %w", err)
+	}
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("secret bundles can only be opened with an RSA sync key")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(bundle.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("secret bundle is corrupt")
+	}
+	secret, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, rsaKey, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("secret bundle was not sealed to this vault's sync key")
+	}
+	if len(secret) != secretSize || SecretID(secret) != bundle.SecretID {
+		return nil, fmt.Errorf("secret bundle is corrupt")
+	}
+	return secret, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives an independent subkey for one purpose
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
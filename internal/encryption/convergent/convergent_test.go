@@ -0,0 +1,75 @@
+package convergent
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+)
+
+func TestEncryptChunk(t *testing.T) {
+	c := NewCipher(bytes.Repeat([]byte{1}, secretSize))
+	data := []byte("the same chunk in two vaults")
+
+	first, err := c.EncryptChunk("abc123", data)
+	if err != nil {
+		t.Fatalf("EncryptChunk() error: %v", err)
+	}
+	again, _ := NewCipher(bytes.Repeat([]byte{1}, secretSize)).EncryptChunk("abc123", data)
+	if !bytes.Equal(first, again) {
+		t.Error("the same chunk and secret produced different ciphertexts")
+	}
+	if other, _ := NewCipher(bytes.Repeat([]byte{2}, secretSize)).EncryptChunk("abc123", data); bytes.Equal(first, other) {
+		t.Error("different secrets produced the same ciphertext")
+	}
+
+	got, err := c.DecryptChunk("abc123", first)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("DecryptChunk() = %q, %v", got, err)
+	}
+	// The hash is bound to the ciphertext
+	if _, err := c.DecryptChunk("def456", first); err == nil {
+		t.Error("DecryptChunk() with another chunk's hash succeeded")
+	}
+}
+
+func TestSecretBundle(t *testing.T) {
+	privateKey, publicKey, err := keys.GenerateTestRSAKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM, err := keys.EncodeSyncPublicKeyPEM(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := SealFor(secret, config.TrustedPeer{ID: "peer", PublicKey: string(publicPEM)})
+	if err != nil {
+		t.Fatalf("SealFor() error: %v", err)
+	}
+	if bytes.Contains(bundle, secret) {
+		t.Error("bundle contains the raw secret")
+	}
+	opened, err := OpenBundle(bundle, privateKey)
+	if err != nil || !bytes.Equal(opened, secret) {
+		t.Errorf("OpenBundle() = %x, %v", opened, err)
+	}
+
+	otherKey, _, _ := keys.GenerateTestRSAKeyPair(2048)
+	if _, err := OpenBundle(bundle, otherKey); err == nil {
+		t.Error("OpenBundle() with another peer's key succeeded")
+	}
+
+	edPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	edPEM, _ := keys.EncodeSyncPublicKeyPEM(edPublic)
+	if _, err := SealFor(secret, config.TrustedPeer{ID: "ed", KeyType: "ed25519", PublicKey: string(edPEM)}); err == nil {
+		t.Error("SealFor() an Ed25519 peer succeeded")
+	}
+}
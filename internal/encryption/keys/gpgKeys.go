@@ -2,7 +2,8 @@ package keys
 
 import (
 	"fmt"
-	"os"
+
+	"github.com/substantialcattle5/sietch/internal/fs/private"
 )
 
 func GenerateGPGKey(keyPath string) error {
@@ -11,7 +12,7 @@ func GenerateGPGKey(keyPath string) error {
 	gpgKey := []byte("-----BEGIN PGP PUBLIC KEY-----\nExampleGPGKeyData\n-----END PGP PUBLIC KEY-----")
 
 	// Write the GPG key to the specified file path
-	if err := os.WriteFile(keyPath, gpgKey, 0o600); err != nil {
+	if err := private.WriteFileAtomic(keyPath, gpgKey); err != nil {
 		return fmt.Errorf("failed to write key file: %w", err)
 	}
 
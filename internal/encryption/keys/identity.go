@@ -0,0 +1,264 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
+)
+
+// SupportedRSAKeySizes lists the RSA key sizes accepted for sync identities
+var SupportedRSAKeySizes = []int{2048, 3072, 4096}
+
+// ValidateSyncKeyOptions checks a sync identity key type and RSA key size.
+// The key size is ignored for Ed25519 keys.
+func ValidateSyncKeyOptions(keyType string, keySize int) error {
+	switch keyType {
+	case "", constants.SyncKeyTypeRSA:
+		for _, size := range SupportedRSAKeySizes {
+			if keySize == size {
+				return nil
+			}
+		}
+		return fmt.Errorf("unsupported RSA key size %d (supported: 2048, 3072, 4096)", keySize)
+	case constants.SyncKeyTypeEd25519:
+		return nil
+	default:
+		return fmt.Errorf("unsupported sync key type %q (supported: %s, %s)",
+			keyType, constants.SyncKeyTypeRSA, constants.SyncKeyTypeEd25519)
+	}
+}
+
+// GenerateSyncKeyPair generates the vault's sync identity key pair according
+// to cfg.Sync.RSA.KeyType and records its paths and fingerprint in cfg
+func GenerateSyncKeyPair(vaultRoot string, cfg *config.VaultConfig) error {
+	switch cfg.Sync.RSA.IdentityKeyType() {
+	case constants.SyncKeyTypeRSA:
+		return GenerateRSAKeyPair(vaultRoot, cfg)
+	case constants.SyncKeyTypeEd25519:
+		return generateEd25519KeyPair(vaultRoot, cfg)
+	default:
+		return fmt.Errorf("unsupported sync key type %q", cfg.Sync.RSA.KeyType)
+	}
+}
+
+// generateEd25519KeyPair writes an Ed25519 sync identity to the same paths used for RSA keys
+func generateEd25519KeyPair(vaultRoot string, cfg *config.VaultConfig) error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate Ed25519 key: %w", err)
+	}
+
+	syncDir := filepath.Join(vaultRoot, ".sietch", "sync")
+	if err = private.Mkdir(syncDir); err != nil {
+		return fmt.Errorf("failed to create sync key directory: %w", err)
+	}
+
+	relPrivateKeyPath := filepath.Join(".sietch", "sync", "sync_private.pem")
+	relPublicKeyPath := filepath.Join(".sietch", "sync", "sync_public.pem")
+	privateKeyPath := filepath.Join(vaultRoot, relPrivateKeyPath)
+	publicKeyPath := filepath.Join(vaultRoot, relPublicKeyPath)
+
+	// Save private key (PKCS#8 format)
+	privateKeyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyDER})
+	if err = private.WriteFileAtomic(privateKeyPath, privateKeyPEM); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	publicKeyPEM, err := EncodeSyncPublicKeyPEM(publicKey)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(publicKeyPath, publicKeyPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	fingerprint, err := SyncKeyFingerprint(publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+
+	cfg.Sync.RSA.KeyType = constants.SyncKeyTypeEd25519
+	cfg.Sync.RSA.KeySize = 0
+	cfg.Sync.RSA.PublicKeyPath = relPublicKeyPath
+	cfg.Sync.RSA.PrivateKeyPath = relPrivateKeyPath
+	cfg.Sync.RSA.Fingerprint = fingerprint
+
+	fmt.Printf("Ed25519 key pair generated for sync operations:\n")
+	fmt.Printf("  - Private key: %s\n", privateKeyPath)
+	fmt.Printf("  - Public key: %s\n", publicKeyPath)
+	fmt.Printf("  - Fingerprint: %s\n", fingerprint)
+
+	return nil
+}
+
+// LoadSyncKeys loads the vault's sync identity, which may be an RSA or Ed25519 key
+func LoadSyncKeys(vaultPath string, syncConfig *config.RSAConfig) (crypto.Signer, crypto.PublicKey, *config.RSAConfig, error) {
+	privateKeyData, err := os.ReadFile(filepath.Join(vaultPath, syncConfig.PrivateKeyPath))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	privateKey, err := ParseSyncPrivateKeyPEM(privateKeyData)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	publicKeyData, err := os.ReadFile(filepath.Join(vaultPath, syncConfig.PublicKeyPath))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	publicKey, err := ParseSyncPublicKeyPEM(publicKeyData)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	keyType, err := SyncKeyType(publicKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ownType, _ := SyncKeyType(privateKey.Public()); ownType != keyType {
+		return nil, nil, nil, fmt.Errorf("private key (%s) and public key (%s) types do not match", ownType, keyType)
+	}
+
+	newConfig := *syncConfig
+	newConfig.KeyType = keyType
+	return privateKey, publicKey, &newConfig, nil
+}
+
+// ParseSyncPrivateKeyPEM parses an RSA (PKCS#1 or PKCS#8) or Ed25519 (PKCS#8) private key
+func ParseSyncPrivateKeyPEM(pemData []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing private key")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// ParseSyncPublicKeyPEM parses an RSA or Ed25519 public key. PKIX ("PUBLIC KEY")
+// is used for both; PKCS#1 ("RSA PUBLIC KEY") is accepted from older peers.
+func ParseSyncPublicKeyPEM(pemData []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing public key")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		if _, err := SyncKeyType(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// EncodeSyncPublicKeyPEM encodes an RSA or Ed25519 public key in PKIX PEM format
+func EncodeSyncPublicKeyPEM(publicKey crypto.PublicKey) ([]byte, error) {
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}), nil
+}
+
+// SyncKeyFingerprint returns the base64 SHA-256 of a public key's PKIX encoding.
+// For RSA keys this matches GetRSAPublicKeyFingerprint.
+func SyncKeyFingerprint(publicKey crypto.PublicKey) (string, error) {
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	hash := sha256.Sum256(publicKeyDER)
+	return base64.StdEncoding.EncodeToString(hash[:]), nil
+}
+
+// SyncKeyType returns "rsa" or "ed25519" for a supported public key
+func SyncKeyType(publicKey crypto.PublicKey) (string, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return constants.SyncKeyTypeRSA, nil
+	case ed25519.PublicKey:
+		return constants.SyncKeyTypeEd25519, nil
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// SignChallenge signs an authentication challenge. RSA keys sign the SHA-256
+// digest with PKCS#1 v1.5, as before; Ed25519 keys sign the challenge itself.
+func SignChallenge(privateKey crypto.Signer, challenge []byte) ([]byte, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(challenge)
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, challenge), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+}
+
+// VerifyChallenge verifies a signature produced by SignChallenge
+func VerifyChallenge(publicKey crypto.PublicKey, challenge, signature []byte) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(challenge)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, challenge, signature) {
+			return fmt.Errorf("ed25519: invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
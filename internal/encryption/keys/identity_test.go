@@ -0,0 +1,131 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func TestValidateSyncKeyOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType string
+		keySize int
+		wantErr bool
+	}{
+		{name: "default type", keyType: "", keySize: 4096},
+		{name: "rsa 2048", keyType: "rsa", keySize: 2048},
+		{name: "rsa 3072", keyType: "rsa", keySize: 3072},
+		{name: "rsa 1024", keyType: "rsa", keySize: 1024, wantErr: true},
+		{name: "rsa 5000", keyType: "rsa", keySize: 5000, wantErr: true},
+		{name: "ed25519 ignores size", keyType: "ed25519", keySize: 0},
+		{name: "unknown type", keyType: "dsa", keySize: 2048, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSyncKeyOptions(tt.keyType, tt.keySize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSyncKeyOptions(%q, %d) error = %v, wantErr %v", tt.keyType, tt.keySize, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateAndLoadSyncKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyType  string
+		keySize  int
+		wantType string
+	}{
+		{name: "legacy rsa", keyType: "", keySize: 2048, wantType: constants.SyncKeyTypeRSA},
+		{name: "rsa", keyType: constants.SyncKeyTypeRSA, keySize: 2048, wantType: constants.SyncKeyTypeRSA},
+		{name: "ed25519", keyType: constants.SyncKeyTypeEd25519, wantType: constants.SyncKeyTypeEd25519},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultRoot := testutil.TempDir(t, "sync-identity")
+			cfg := &config.VaultConfig{
+				Sync: config.SyncConfig{
+					RSA: &config.RSAConfig{KeyType: tt.keyType, KeySize: tt.keySize},
+				},
+			}
+			if err := GenerateSyncKeyPair(vaultRoot, cfg); err != nil {
+				t.Fatalf("GenerateSyncKeyPair() error: %v", err)
+			}
+
+			privateKey, publicKey, loaded, err := LoadSyncKeys(vaultRoot, cfg.Sync.RSA)
+			if err != nil {
+				t.Fatalf("LoadSyncKeys() error: %v", err)
+			}
+			if loaded.KeyType != tt.wantType {
+				t.Errorf("KeyType = %q, want %q", loaded.KeyType, tt.wantType)
+			}
+			switch tt.wantType {
+			case constants.SyncKeyTypeRSA:
+				if _, ok := privateKey.(*rsa.PrivateKey); !ok {
+					t.Errorf("private key type = %T, want *rsa.PrivateKey", privateKey)
+				}
+			case constants.SyncKeyTypeEd25519:
+				if _, ok := privateKey.(ed25519.PrivateKey); !ok {
+					t.Errorf("private key type = %T, want ed25519.PrivateKey", privateKey)
+				}
+			}
+
+			fingerprint, err := SyncKeyFingerprint(publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fingerprint != cfg.Sync.RSA.Fingerprint {
+				t.Errorf("fingerprint = %s, want %s", fingerprint, cfg.Sync.RSA.Fingerprint)
+			}
+
+			// Round trip the public key as it is stored for trusted peers
+			publicKeyPEM, err := EncodeSyncPublicKeyPEM(publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseSyncPublicKeyPEM(publicKeyPEM)
+			if err != nil {
+				t.Fatalf("ParseSyncPublicKeyPEM() error: %v", err)
+			}
+
+			challenge := []byte("sietch authentication challenge")
+			signature, err := SignChallenge(privateKey, challenge)
+			if err != nil {
+				t.Fatalf("SignChallenge() error: %v", err)
+			}
+			if err := VerifyChallenge(parsed, challenge, signature); err != nil {
+				t.Errorf("VerifyChallenge() error: %v", err)
+			}
+			if err := VerifyChallenge(parsed, []byte("other challenge"), signature); err == nil {
+				t.Error("VerifyChallenge() accepted a signature over a different challenge")
+			}
+		})
+	}
+}
+
+func TestParseSyncPrivateKeyPEMAcceptsPKCS1(t *testing.T) {
+	privateKey, _, err := GenerateTestRSAKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseSyncPrivateKeyPEM(EncodeRSAPrivateKeyToPEM(privateKey))
+	if err != nil {
+		t.Fatalf("ParseSyncPrivateKeyPEM() error: %v", err)
+	}
+	if !privateKey.Equal(parsed) {
+		t.Error("parsed key does not match the original")
+	}
+
+	if _, err := ParseSyncPrivateKeyPEM([]byte("not a key")); err == nil {
+		t.Error("expected an error for invalid PEM data")
+	}
+}
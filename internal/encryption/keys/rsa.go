@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
 )
 
 // GenerateRSAKeyPair generates an RSA key pair and saves it to the specified directory
@@ -34,7 +35,7 @@ func GenerateRSAKeyPair(vaultRoot string, cfg *config.VaultConfig) error {
 
 	// Create sync key directory
 	syncDir := filepath.Join(vaultRoot, ".sietch", "sync")
-	if err = os.MkdirAll(syncDir, 0o700); err != nil {
+	if err = private.Mkdir(syncDir); err != nil {
 		return fmt.Errorf("failed to create sync key directory: %w", err)
 	}
 
@@ -53,13 +54,7 @@ func GenerateRSAKeyPair(vaultRoot string, cfg *config.VaultConfig) error {
 		Bytes: privateKeyDER,
 	}
 
-	privateKeyFile, err := os.OpenFile(privateKeyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
-	if err != nil {
-		return fmt.Errorf("failed to create private key file: %w", err)
-	}
-	defer privateKeyFile.Close()
-
-	if err = pem.Encode(privateKeyFile, privateKeyBlock); err != nil {
+	if err = private.WriteFileAtomic(privateKeyPath, pem.EncodeToMemory(privateKeyBlock)); err != nil {
 		return fmt.Errorf("failed to write private key: %w", err)
 	}
 
@@ -133,6 +128,7 @@ func LoadRSAKeys(vaultPath string, rsaConfig *config.RSAConfig) (*rsa.PrivateKey
 
 	// Create RSA config
 	newRsaConfig := &config.RSAConfig{
+		KeyType:        rsaConfig.KeyType,
 		KeySize:        rsaConfig.KeySize,
 		TrustedPeers:   rsaConfig.TrustedPeers,
 		PublicKeyPath:  rsaConfig.PublicKeyPath,
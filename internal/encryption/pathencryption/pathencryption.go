@@ -0,0 +1,151 @@
+// Package pathencryption hides file paths in manifests from anyone without the vault key.
+//
+// A vault with encryption.encrypt_paths set keeps a random path key, wrapped with
+// the vault key, in vault.yaml. Each manifest then stores its path AES-256-GCM
+// encrypted under that key instead of in plaintext, and is named after a keyed
+// hash of the path (its path ID) so a file can still be looked up by name once the
+// vault is unlocked. Chunk hashes, sizes and timestamps are not hidden.
+package pathencryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+)
+
+const keySize = 32
+
+// pathSeparator joins destination and file name before encryption; neither contains it
+const pathSeparator = "\x00"
+
+// Cipher encrypts and decrypts manifest paths with an unlocked path key
+type Cipher struct {
+	idKey []byte
+	aead  cipher.AEAD
+}
+
+// NewKey generates a path key and returns it wrapped with the vault key, for
+// storing as encryption.path_key
+func NewKey(vaultConfig *config.VaultConfig, passphrase string) (string, error) {
+	if vaultConfig.Encryption.Type == "" || vaultConfig.Encryption.Type == "none" {
+		return "", fmt.Errorf("path encryption requires an encrypted vault")
+	}
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate path key: %w", err)
+	}
+	wrapped, err := encryption.EncryptDataWithPassphrase(hex.EncodeToString(key), *vaultConfig, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap path key: %w", err)
+	}
+	return wrapped, nil
+}
+
+// Unlock unwraps the vault's path key. It returns nil when the vault stores
+// paths in plaintext.
+func Unlock(vaultRoot string, vaultConfig *config.VaultConfig, passphrase string) (*Cipher, error) {
+	if !vaultConfig.Encryption.EncryptPaths {
+		return nil, nil
+	}
+	if vaultConfig.Encryption.PathKey == "" {
+		return nil, fmt.Errorf("vault encrypts paths but has no path key")
+	}
+	unwrapped, err := encryption.DecryptDataWithPassphrase(vaultConfig.Encryption.PathKey, vaultRoot, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock path key: %w", err)
+	}
+	key, err := hex.DecodeString(unwrapped)
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("path key is corrupt")
+	}
+	return NewCipher(key)
+}
+
+// NewCipher returns a cipher for a raw path key
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(deriveKey(key, "sietch path encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{idKey: deriveKey(key, "sietch path id"), aead: aead}, nil
+}
+
+// PathID returns the keyed hash naming the manifest of the file at vaultPath
+// (destination followed by file name)
+func (c *Cipher) PathID(vaultPath string) string {
+	mac := hmac.New(sha256.New, c.idKey)
+	mac.Write([]byte(vaultPath))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Seal encrypts a manifest's path, and a symlink's target, in place, clearing
+// the plaintext fields
+func (c *Cipher) Seal(m *config.FileManifest) error {
+	if m.EncryptedPath != "" && m.FilePath == "" {
+		return nil // Already sealed
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	plaintext := m.Destination + pathSeparator + m.FilePath
+	if m.LinkTarget != "" {
+		plaintext += pathSeparator + m.LinkTarget
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	m.PathID = c.PathID(m.Destination + m.FilePath)
+	m.EncryptedPath = base64.StdEncoding.EncodeToString(sealed)
+	m.Destination = ""
+	m.FilePath = ""
+	m.LinkTarget = ""
+	return nil
+}
+
+// Reveal decrypts a sealed manifest's path into FilePath and Destination.
+// Manifests stored in plaintext are left unchanged.
+func (c *Cipher) Reveal(m *config.FileManifest) error {
+	if m.EncryptedPath == "" {
+		return nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(m.EncryptedPath)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return errors.New("encrypted path is corrupt")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return errors.New("failed to decrypt path: wrong key or corrupt manifest")
+	}
+	fields := strings.SplitN(string(plaintext), pathSeparator, 3)
+	if len(fields) < 2 {
+		return errors.New("encrypted path is corrupt")
+	}
+	m.Destination = fields[0]
+	m.FilePath = fields[1]
+	if len(fields) == 3 {
+		m.LinkTarget = fields[2]
+	}
+	return nil
+}
+
+// deriveKey derives an independent subkey for one purpose
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,76 @@
+package pathencryption
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestSealAndReveal(t *testing.T) {
+	paths, err := NewCipher(bytes.Repeat([]byte{1}, keySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &config.FileManifest{FilePath: "tax-return.pdf", Destination: "finance/2024/", Size: 42}
+	if err := paths.Seal(m); err != nil {
+		t.Fatalf("Seal() error: %v", err)
+	}
+	if m.FilePath != "" || m.Destination != "" {
+		t.Errorf("Seal() left plaintext path %q%q", m.Destination, m.FilePath)
+	}
+	if strings.Contains(m.EncryptedPath, "tax") || m.PathID != paths.PathID("finance/2024/tax-return.pdf") {
+		t.Errorf("Seal() = path ID %q, encrypted path %q", m.PathID, m.EncryptedPath)
+	}
+
+	// Sealing the same path twice gives the same ID but a different ciphertext
+	again := &config.FileManifest{FilePath: "tax-return.pdf", Destination: "finance/2024/"}
+	if err := paths.Seal(again); err != nil {
+		t.Fatal(err)
+	}
+	if again.PathID != m.PathID || again.EncryptedPath == m.EncryptedPath {
+		t.Errorf("second Seal() = %q/%q, first %q/%q", again.PathID, again.EncryptedPath, m.PathID, m.EncryptedPath)
+	}
+
+	if err := paths.Reveal(m); err != nil {
+		t.Fatalf("Reveal() error: %v", err)
+	}
+	if m.Destination != "finance/2024/" || m.FilePath != "tax-return.pdf" {
+		t.Errorf("Reveal() = %q%q", m.Destination, m.FilePath)
+	}
+
+	// Another key can neither decrypt the path nor derive the same ID
+	other, _ := NewCipher(bytes.Repeat([]byte{2}, keySize))
+	if other.PathID("finance/2024/tax-return.pdf") == m.PathID {
+		t.Error("different keys produced the same path ID")
+	}
+	if err := other.Reveal(again); err == nil {
+		t.Error("Reveal() with the wrong key succeeded")
+	}
+
+	link := &config.FileManifest{FilePath: "latest", Destination: "finance/", Type: config.FileTypeSymlink, LinkTarget: "2024/tax-return.pdf"}
+	if err := paths.Seal(link); err != nil {
+		t.Fatal(err)
+	}
+	if link.LinkTarget != "" {
+		t.Errorf("Seal() left plaintext link target %q", link.LinkTarget)
+	}
+	if err := paths.Reveal(link); err != nil || link.FilePath != "latest" || link.LinkTarget != "2024/tax-return.pdf" {
+		t.Errorf("Reveal() of a symlink = %q -> %q, %v", link.FilePath, link.LinkTarget, err)
+	}
+
+	plain := &config.FileManifest{FilePath: "notes.txt"}
+	if err := paths.Reveal(plain); err != nil || plain.FilePath != "notes.txt" {
+		t.Errorf("Reveal() of a plaintext manifest = %q, %v", plain.FilePath, err)
+	}
+}
+
+func TestNewKeyRequiresEncryptedVault(t *testing.T) {
+	vaultConfig := &config.VaultConfig{}
+	vaultConfig.Encryption.Type = "none"
+	if _, err := NewKey(vaultConfig, ""); err == nil {
+		t.Error("NewKey() for an unencrypted vault succeeded")
+	}
+}
@@ -0,0 +1,165 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+)
+
+// IdentityEnv names the environment variable holding the path of a recipient's
+// PEM private key. It is used to open a vault whose key file is not present.
+const IdentityEnv = "SIETCH_IDENTITY"
+
+// recipientLabel binds wrapped vault keys to their purpose, so a wrapped key
+// cannot be passed off as any other RSA-OAEP message
+var recipientLabel = []byte("sietch vault key")
+
+// UnlocksWithIdentity reports whether the vault key will be unwrapped with the
+// SIETCH_IDENTITY private key: the vault has recipients, the variable is set and
+// the key file itself is missing
+func UnlocksWithIdentity(encConfig config.EncryptionConfig) bool {
+	if len(encConfig.Recipients) == 0 || os.Getenv(IdentityEnv) == "" {
+		return false
+	}
+	_, err := os.Stat(encConfig.KeyPath)
+	return os.IsNotExist(err)
+}
+
+// LoadDataKey returns the vault's unwrapped data key, from the key file or from
+// the SIETCH_IDENTITY recipient
+func LoadDataKey(vaultConfig config.VaultConfig, passphrase string) ([]byte, error) {
+	if err := checkRecipientSupport(vaultConfig.Encryption); err != nil {
+		return nil, err
+	}
+	dataKey, err := loadEncryptionKeyWithPassphrase(vaultConfig.Encryption.KeyPath, passphrase, vaultConfig.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// NewRecipient wraps dataKey with an RSA public key. Ed25519 keys can only sign,
+// so they cannot be recipients.
+func NewRecipient(name string, publicKeyPEM []byte, dataKey []byte) (config.Recipient, error) {
+	publicKey, err := keys.ParseSyncPublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return config.Recipient{}, err
+	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return config.Recipient{}, fmt.Errorf("recipients need an RSA public key; Ed25519 keys can only sign")
+	}
+	fingerprint, err := keys.SyncKeyFingerprint(rsaKey)
+	if err != nil {
+		return config.Recipient{}, err
+	}
+	encoded, err := keys.EncodeSyncPublicKeyPEM(rsaKey)
+	if err != nil {
+		return config.Recipient{}, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaKey, dataKey, recipientLabel)
+	if err != nil {
+		return config.Recipient{}, fmt.Errorf("failed to wrap vault key: %w", err)
+	}
+	return config.Recipient{
+		Name:        name,
+		Fingerprint: fingerprint,
+		PublicKey:   string(encoded),
+		WrappedKey:  base64.StdEncoding.EncodeToString(wrapped),
+		AddedAt:     time.Now().UTC(),
+	}, nil
+}
+
+// AddRecipient wraps the vault key for another public key and records it in
+// the vault configuration. The caller saves the configuration.
+func AddRecipient(vaultConfig *config.VaultConfig, passphrase, name string, publicKeyPEM []byte) (*config.Recipient, error) {
+	if name == "" {
+		return nil, fmt.Errorf("recipient name is required")
+	}
+	dataKey, err := LoadDataKey(*vaultConfig, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := NewRecipient(name, publicKeyPEM, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range vaultConfig.Encryption.Recipients {
+		if existing.Name == name {
+			return nil, fmt.Errorf("a recipient named %s already exists", name)
+		}
+		if existing.Fingerprint == recipient.Fingerprint {
+			return nil, fmt.Errorf("that key is already recipient %s", existing.Name)
+		}
+	}
+	vaultConfig.Encryption.Recipients = append(vaultConfig.Encryption.Recipients, recipient)
+	return &vaultConfig.Encryption.Recipients[len(vaultConfig.Encryption.Recipients)-1], nil
+}
+
+// RemoveRecipient drops the recipient with the given name or key fingerprint.
+// The caller saves the configuration.
+func RemoveRecipient(vaultConfig *config.VaultConfig, nameOrFingerprint string) (config.Recipient, error) {
+	recipients := vaultConfig.Encryption.Recipients
+	for i, recipient := range recipients {
+		if recipient.Name == nameOrFingerprint || recipient.Fingerprint == nameOrFingerprint {
+			vaultConfig.Encryption.Recipients = append(recipients[:i:i], recipients[i+1:]...)
+			return recipient, nil
+		}
+	}
+	return config.Recipient{}, fmt.Errorf("no recipient named %s", nameOrFingerprint)
+}
+
+// unwrapWithIdentity opens the vault key with the private key named by
+// SIETCH_IDENTITY
+func unwrapWithIdentity(encConfig config.EncryptionConfig) ([]byte, error) {
+	identityPath := os.Getenv(IdentityEnv)
+	pemData, err := os.ReadFile(identityPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s identity: %w", IdentityEnv, err)
+	}
+	privateKey, err := keys.ParseSyncPrivateKeyPEM(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s identity: %w", IdentityEnv, err)
+	}
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s identity is not an RSA key", IdentityEnv)
+	}
+	fingerprint, err := keys.SyncKeyFingerprint(&rsaKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, recipient := range encConfig.Recipients {
+		if recipient.Fingerprint != fingerprint {
+			continue
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(recipient.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("wrapped key of recipient %s is corrupt", recipient.Name)
+		}
+		dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, rsaKey, wrapped, recipientLabel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap vault key for recipient %s: %w", recipient.Name, err)
+		}
+		return dataKey, nil
+	}
+	return nil, fmt.Errorf("key file not found and the %s identity (%s) is not a recipient of this vault", IdentityEnv, identityPath)
+}
+
+func checkRecipientSupport(encConfig config.EncryptionConfig) error {
+	switch encConfig.Type {
+	case constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20:
+		return nil
+	default:
+		return fmt.Errorf("recipients are only supported for aes and chacha20 vaults (this vault uses %s)", encConfig.Type)
+	}
+}
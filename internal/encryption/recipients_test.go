@@ -0,0 +1,145 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+)
+
+// newRecipientIdentity writes an RSA private key to a file and returns its path
+// and PEM public key
+func newRecipientIdentity(t *testing.T, dir, name string) (string, []byte) {
+	t.Helper()
+	privateKey, publicKey, err := keys.GenerateTestRSAKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityPath := filepath.Join(dir, name+".pem")
+	if err := os.WriteFile(identityPath, keys.EncodeRSAPrivateKeyToPEM(privateKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM, err := keys.EncodeSyncPublicKeyPEM(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identityPath, publicKeyPEM
+}
+
+func TestRecipientsOpenVaultWithoutKeyFile(t *testing.T) {
+	vaultRoot := t.TempDir()
+	keyPath := filepath.Join(vaultRoot, ".sietch", "keys", "secret.key")
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	vaultConfig := &config.VaultConfig{
+		Encryption: config.EncryptionConfig{Type: constants.EncryptionTypeAES, KeyPath: keyPath},
+	}
+
+	aliceIdentity, alicePublic := newRecipientIdentity(t, t.TempDir(), "alice")
+	bobIdentity, bobPublic := newRecipientIdentity(t, t.TempDir(), "bob")
+	if _, err := AddRecipient(vaultConfig, "", "alice", alicePublic); err != nil {
+		t.Fatalf("AddRecipient(alice) error: %v", err)
+	}
+	if _, err := AddRecipient(vaultConfig, "", "alice-again", alicePublic); err == nil {
+		t.Error("AddRecipient() accepted the same key twice")
+	}
+	if _, err := AddRecipient(vaultConfig, "", "bob", bobPublic); err != nil {
+		t.Fatalf("AddRecipient(bob) error: %v", err)
+	}
+
+	configData, err := yaml.Marshal(vaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), configData, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := AesEncryptWithPassphrase("sealed for several keys", *vaultConfig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoveRecipient(vaultConfig, "bob"); err != nil {
+		t.Fatalf("RemoveRecipient(bob) error: %v", err)
+	}
+	if _, err := RemoveRecipient(vaultConfig, "carol"); err == nil {
+		t.Error("RemoveRecipient() removed a recipient that does not exist")
+	}
+	configData, err = yaml.Marshal(vaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), configData, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		identity  string
+		wantError string
+	}{
+		{name: "recipient identity", identity: aliceIdentity},
+		{name: "removed recipient", identity: bobIdentity, wantError: "not a recipient"},
+		{name: "no identity", identity: "", wantError: "error reading key file"},
+		{name: "missing identity file", identity: filepath.Join(vaultRoot, "nobody.pem"), wantError: "failed to read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(IdentityEnv, tt.identity)
+			plaintext, err := DecryptDataWithPassphrase(ciphertext, vaultRoot, "")
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("DecryptDataWithPassphrase() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecryptDataWithPassphrase() error: %v", err)
+			}
+			if plaintext != "sealed for several keys" {
+				t.Errorf("DecryptDataWithPassphrase() = %q", plaintext)
+			}
+		})
+	}
+}
+
+func TestNewRecipientRejectsUnsupportedKeys(t *testing.T) {
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPEM, err := keys.EncodeSyncPublicKeyPEM(edPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRecipient("ed", edPEM, make([]byte, 32)); err == nil {
+		t.Error("NewRecipient() accepted an Ed25519 key")
+	}
+	if _, err := NewRecipient("junk", []byte("not a key"), make([]byte, 32)); err == nil {
+		t.Error("NewRecipient() accepted a malformed key")
+	}
+
+	_, rsaPEM := newRecipientIdentity(t, t.TempDir(), "gpg")
+	gpgVault := &config.VaultConfig{Encryption: config.EncryptionConfig{Type: constants.EncryptionTypeGPG}}
+	if _, err := AddRecipient(gpgVault, "", "gpg", rsaPEM); err == nil {
+		t.Error("AddRecipient() accepted a GPG vault")
+	}
+}
@@ -4,10 +4,39 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
 )
 
+// VaultOptions configures the structure of a new vault
+type VaultOptions struct {
+	// ChunkLayout is how chunks are sharded in .sietch/chunks, one of the
+	// constants.ChunkLayout values; 0 picks constants.CurrentChunkLayout
+	ChunkLayout int
+}
+
+// Layout returns the chunk layout the options give, which the caller records
+// as chunking.layout_version in the vault's vault.yaml
+func (o VaultOptions) Layout() int {
+	if o.ChunkLayout == 0 {
+		return constants.CurrentChunkLayout
+	}
+	return o.ChunkLayout
+}
+
 // creates the basic vault structure
 func CreateVaultStructure(basePath string) error {
+	return CreateVaultStructureWith(basePath, VaultOptions{})
+}
+
+// CreateVaultStructureWith creates the basic vault structure for a vault
+// configured by opts
+func CreateVaultStructureWith(basePath string, opts VaultOptions) error {
+	if !layout.Valid(opts.Layout()) {
+		return fmt.Errorf("unknown chunk layout %d", opts.ChunkLayout)
+	}
+
 	// Define the required directories
 	dirs := []string{
 		filepath.Join(basePath, ".sietch", "keys"),
@@ -40,8 +40,23 @@ func GetManifestDirectory(basePath string) string {
 	return filepath.Join(basePath, ".sietch", "manifests")
 }
 
-// findVaultRoot traverses up the directory tree to find a vault root
+// vaultSearchStart is where FindVaultRoot starts looking instead of the
+// working directory, when set
+var vaultSearchStart string
+
+// SetVaultSearchStart makes FindVaultRoot look for the vault from path (a
+// vault root or any directory inside one) instead of the working directory.
+// An empty path restores the default.
+func SetVaultSearchStart(path string) {
+	vaultSearchStart = path
+}
+
+// FindVaultRoot traverses up the directory tree to find a vault root, like git
+// does, starting from the working directory or the path SetVaultSearchStart gave
 func FindVaultRoot() (string, error) {
+	if vaultSearchStart != "" {
+		return findVaultRootFrom(vaultSearchStart)
+	}
 	// Start from current directory
 	currentDir, err := os.Getwd()
 	if err != nil {
@@ -64,6 +79,31 @@ func FindVaultRoot() (string, error) {
 	}
 }
 
+// findVaultRootFrom finds the vault path belongs to
+func findVaultRootFrom(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("vault path %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("vault path %s is not a directory", path)
+	}
+	for {
+		if IsVaultInitialized(dir) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no vault found at %s or its parent directories", path)
+		}
+		dir = parent
+	}
+}
+
 func VerifyFileAndReturnFileInfo(filePath string) (os.FileInfo, error) {
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -1,10 +1,13 @@
 package fs
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
 	"github.com/substantialcattle5/sietch/testutil"
 )
 
@@ -660,3 +663,83 @@ func TestShouldSkipHidden(t *testing.T) {
 		})
 	}
 }
+
+func TestFindVaultRootFromSearchStart(t *testing.T) {
+	vaultRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch", "manifests"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultRoot, "vault.yaml"), []byte("name: test\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	defer SetVaultSearchStart("")
+
+	tests := []struct {
+		name    string
+		start   string
+		wantErr bool
+	}{
+		{"vault root", vaultRoot, false},
+		{"inside the vault", filepath.Join(vaultRoot, ".sietch", "manifests"), false},
+		{"not a vault", outside, true},
+		{"missing", filepath.Join(outside, "missing"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetVaultSearchStart(tt.start)
+			got, err := FindVaultRoot()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("FindVaultRoot() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != vaultRoot {
+				t.Errorf("FindVaultRoot() = %s, %v; want %s", got, err, vaultRoot)
+			}
+		})
+	}
+}
+
+// TestCreateVaultStructureWithLayout ensures the chunk layout chosen for a new
+// vault, once recorded in vault.yaml, decides where its chunks are written
+func TestCreateVaultStructureWithLayout(t *testing.T) {
+	hash := "abcdef0123456789"
+	tests := []struct {
+		name    string
+		layout  int
+		wantRel string
+		wantErr bool
+	}{
+		{name: "default", layout: 0, wantRel: "ab/abcdef0123456789"},
+		{name: "sharded", layout: constants.ChunkLayoutSharded, wantRel: "ab/abcdef0123456789"},
+		{name: "nested", layout: constants.ChunkLayoutNested, wantRel: "ab/cd/abcdef0123456789"},
+		{name: "unknown", layout: 7, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultPath := t.TempDir()
+			opts := VaultOptions{ChunkLayout: tt.layout}
+			err := CreateVaultStructureWith(vaultPath, opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("CreateVaultStructureWith() accepted an unknown layout")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateVaultStructureWith() unexpected error: %v", err)
+			}
+
+			vaultYAML := fmt.Sprintf("name: test\nchunking:\n  layout_version: %d\n", opts.Layout())
+			if err := os.WriteFile(filepath.Join(vaultPath, "vault.yaml"), []byte(vaultYAML), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			want := filepath.Join(vaultPath, ".sietch", "chunks", filepath.FromSlash(tt.wantRel))
+			if got := layout.ChunkPath(vaultPath, hash); got != want {
+				t.Errorf("ChunkPath() = %q, want %q", got, want)
+			}
+		})
+	}
+}
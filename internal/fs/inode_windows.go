@@ -0,0 +1,11 @@
+//go:build windows
+
+package fs
+
+import "os"
+
+// Inode returns 0: os.FileInfo does not expose a file index on Windows, so
+// changes are detected from size and modification time alone
+func Inode(info os.FileInfo) uint64 {
+	return 0
+}
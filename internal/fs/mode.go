@@ -0,0 +1,42 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FormatMode returns the permission bits of mode, setuid, setgid and sticky
+// included, in octal as chmod takes them, e.g. "0644"
+func FormatMode(mode os.FileMode) string {
+	value := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		value |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		value |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		value |= 0o1000
+	}
+	return fmt.Sprintf("%04o", value)
+}
+
+// ParseMode parses a mode written by FormatMode
+func ParseMode(mode string) (os.FileMode, error) {
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 0o7777 {
+		return 0, fmt.Errorf("invalid file mode %q", mode)
+	}
+	parsed := os.FileMode(value & 0o777)
+	if value&0o4000 != 0 {
+		parsed |= os.ModeSetuid
+	}
+	if value&0o2000 != 0 {
+		parsed |= os.ModeSetgid
+	}
+	if value&0o1000 != 0 {
+		parsed |= os.ModeSticky
+	}
+	return parsed, nil
+}
@@ -0,0 +1,34 @@
+package fs
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormatAndParseMode(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0o644, "0644"},
+		{0o755 | os.ModeDir, "0755"},
+		{0o750 | os.ModeSetuid, "4750"},
+		{0o775 | os.ModeSetgid | os.ModeSticky, "3775"},
+	}
+	for _, tt := range tests {
+		got := FormatMode(tt.mode)
+		if got != tt.want {
+			t.Errorf("FormatMode(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+		parsed, err := ParseMode(got)
+		if err != nil || parsed != tt.mode&^os.ModeDir {
+			t.Errorf("ParseMode(%q) = %v, %v; want %v", got, parsed, err, tt.mode&^os.ModeDir)
+		}
+	}
+
+	for _, bad := range []string{"", "0999", "17777", "rwx"} {
+		if _, err := ParseMode(bad); err == nil {
+			t.Errorf("ParseMode(%q) succeeded", bad)
+		}
+	}
+}
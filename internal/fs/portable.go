@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// maxNameLength is the longest file name, in bytes, common filesystems accept
+const maxNameLength = 255
+
+// windowsReserved are device names Windows refuses as file names, with or
+// without an extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// CheckWindowsName returns why Windows cannot create a file or directory
+// called name, or nil when it can
+func CheckWindowsName(name string) error {
+	base := strings.ToUpper(name)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReserved[strings.TrimRight(base, " ")] {
+		return fmt.Errorf("%q is a reserved device name on Windows", name)
+	}
+	if i := strings.IndexAny(name, `<>:"|?*`); i >= 0 {
+		return fmt.Errorf("%q contains %q, which Windows does not allow in file names", name, name[i])
+	}
+	for _, r := range name {
+		if r < 0x20 {
+			return fmt.Errorf("%q contains a control character, which Windows does not allow in file names", name)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("%q ends in a dot or space, which Windows drops from file names", name)
+	}
+	return nil
+}
+
+// CheckRestorePath returns why a file restored from the vault cannot be
+// created at path on this system, so it fails with a clear error rather than
+// an obscure one from the filesystem, or nil when it can
+func CheckRestorePath(path string) error {
+	return checkRestorePath(path, runtime.GOOS == "windows")
+}
+
+func checkRestorePath(path string, windows bool) error {
+	path = filepath.Clean(path)
+	path = path[len(filepath.VolumeName(path)):]
+	for _, name := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if name == "." || name == ".." {
+			continue
+		}
+		if len(name) > maxNameLength {
+			return fmt.Errorf("file name %q is %d bytes long; filesystems accept at most %d", name, len(name), maxNameLength)
+		}
+		if windows {
+			if err := CheckWindowsName(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
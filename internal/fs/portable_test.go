@@ -0,0 +1,55 @@
+package fs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckWindowsName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"report.txt", false},
+		{"console.log", false},
+		{"CON", true},
+		{"nul.txt", true},
+		{"Com1.tar.gz", true},
+		{"lpt9", true},
+		{"LPT0", false},
+		{"a:b", true},
+		{"what?.txt", true},
+		{"trailing.", true},
+		{"trailing ", true},
+		{"tab\there", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckWindowsName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("CheckWindowsName(%q) = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckRestorePath(t *testing.T) {
+	long := strings.Repeat("x", maxNameLength+1)
+	tests := []struct {
+		path    string
+		windows bool
+		wantErr bool
+	}{
+		{"out/docs/report.txt", false, false},
+		{"out/docs/report.txt", true, false},
+		{"out/" + long, false, true},
+		{"out/NUL", false, false},
+		{"out/NUL", true, true},
+		{"out/aux/file.txt", true, true},
+		{"out/a:b", false, false},
+	}
+	for _, tt := range tests {
+		if err := checkRestorePath(tt.path, tt.windows); (err != nil) != tt.wantErr {
+			t.Errorf("checkRestorePath(%q, windows=%v) = %v, wantErr %v", tt.path, tt.windows, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package private writes key material that only the user owning the vault may
+// read. File modes say so on Unix; Windows ignores them, so there the ACL is
+// replaced instead.
+package private
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// Mkdir creates dir and any missing parents, restricting dir itself to
+// its owner
+func Mkdir(dir string) error {
+	if err := os.MkdirAll(dir, constants.SecureDirPerms); err != nil {
+		return err
+	}
+	if err := RestrictToOwner(dir); err != nil {
+		return fmt.Errorf("failed to restrict %s to its owner: %v", dir, err)
+	}
+	return nil
+}
+
+// WriteFileAtomic writes data to path, readable and writable by its owner
+// only. Like atomic.WriteFile it goes through a temporary file that is
+// fsynced and renamed into place, but the temporary file is restricted before
+// any data is written to it: on Windows it would otherwise inherit the ACL of
+// its directory until the rename.
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, layout.TempFilePrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if err := RestrictToOwner(tmpPath); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to restrict %s to its owner: %v", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return atomic.SyncDir(dir)
+}
+
+// RestrictToOwner gives only the current user access to path: mode 0600 for
+// files and 0700 for directories, or on Windows an ACL granting the current
+// user (and SYSTEM) full control that inherits nothing from the parent
+func RestrictToOwner(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return restrictToOwner(path, info.IsDir())
+}
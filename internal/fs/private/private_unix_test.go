@@ -0,0 +1,48 @@
+//go:build !windows
+
+package private
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicModes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "secret.key")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both already exist with looser modes, which are tightened
+	if err := Mkdir(dir); err != nil {
+		t.Fatalf("Mkdir() error: %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte("key")); err != nil {
+		t.Fatalf("WriteFileAtomic() error: %v", err)
+	}
+	for p, want := range map[string]os.FileMode{dir: 0o700, path: 0o600} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, want %v", p, info.Mode().Perm(), want)
+		}
+	}
+	// The temporary file was renamed over the old key
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("key directory holds %d entries, want only secret.key", len(entries))
+	}
+	if data, _ := os.ReadFile(path); string(data) != "key" {
+		t.Errorf("key file = %q, want %q", data, "key")
+	}
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package private
+
+import (
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestWriteFileAtomicACL(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	if err := Mkdir(dir); err != nil {
+		t.Fatalf("Mkdir() error: %v", err)
+	}
+	path := filepath.Join(dir, "secret.key")
+	if err := WriteFileAtomic(path, []byte("key")); err != nil {
+		t.Fatalf("WriteFileAtomic() error: %v", err)
+	}
+
+	for _, p := range []string{dir, path} {
+		sd, err := windows.GetNamedSecurityInfo(p, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+		if err != nil {
+			t.Fatal(err)
+		}
+		control, _, err := sd.Control()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if control&windows.SE_DACL_PROTECTED == 0 {
+			t.Errorf("%s: DACL still inherits from its parent", p)
+		}
+		dacl, _, err := sd.DACL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The current user and SYSTEM, nobody else
+		if dacl.AceCount != 2 {
+			t.Errorf("%s: DACL has %d entries, want 2", p, dacl.AceCount)
+		}
+	}
+}
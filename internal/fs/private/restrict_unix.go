@@ -0,0 +1,17 @@
+//go:build !windows
+
+package private
+
+import (
+	"os"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+func restrictToOwner(path string, isDir bool) error {
+	if isDir {
+		return os.Chmod(path, constants.SecureDirPerms)
+	}
+	// WriteFile leaves the mode of an existing file as it was
+	return os.Chmod(path, constants.SecureFilePerms)
+}
@@ -0,0 +1,39 @@
+package fs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SetTreeWritable removes the write permission from dir, the directories under
+// it and their files, or gives it back to the owner. A missing dir is left
+// alone. On Windows only files become read-only; directories ignore the mode.
+func SetTreeWritable(dir string, writable bool) error {
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode().Perm()
+		if writable {
+			mode |= 0o200
+		} else {
+			mode &^= 0o222
+		}
+		if mode == info.Mode().Perm() {
+			return nil
+		}
+		return os.Chmod(path, mode)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
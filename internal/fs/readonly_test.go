@@ -0,0 +1,53 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSetTreeWritable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory modes are not enforced on Windows")
+	}
+	root := filepath.Join(t.TempDir(), "chunks")
+	shard := filepath.Join(root, "ab")
+	chunk := filepath.Join(shard, "abcdef")
+	if err := os.MkdirAll(shard, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(chunk, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	modes := func() []os.FileMode {
+		var got []os.FileMode
+		for _, path := range []string{root, shard, chunk} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, info.Mode().Perm())
+		}
+		return got
+	}
+
+	if err := SetTreeWritable(root, false); err != nil {
+		t.Fatalf("SetTreeWritable(false) error: %v", err)
+	}
+	if got := modes(); got[0] != 0o555 || got[1] != 0o555 || got[2] != 0o444 {
+		t.Errorf("read-only modes = %v, want [0555 0555 0444]", got)
+	}
+
+	if err := SetTreeWritable(root, true); err != nil {
+		t.Fatalf("SetTreeWritable(true) error: %v", err)
+	}
+	if got := modes(); got[0] != 0o755 || got[1] != 0o755 || got[2] != 0o644 {
+		t.Errorf("restored modes = %v, want [0755 0755 0644]", got)
+	}
+
+	if err := SetTreeWritable(filepath.Join(root, "missing"), false); err != nil {
+		t.Errorf("SetTreeWritable() on a missing dir error: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package fs
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// sparseZeroBufSize is the size of the buffer used when holes cannot be created
+const sparseZeroBufSize = 64 * 1024
+
+// SparseWriter writes a file front to back, leaving holes for zero regions.
+// Holes are made by seeking past the region; on filesystems without sparse file
+// support the kernel fills the gap with zeros, and outputs that cannot seek get
+// the zeros written explicitly. Call Finish once all data has been written.
+type SparseWriter struct {
+	file   *os.File
+	offset int64
+	sparse bool
+}
+
+// NewSparseWriter wraps an output file opened for writing at offset zero
+func NewSparseWriter(file *os.File) *SparseWriter {
+	return &SparseWriter{file: file, sparse: true}
+}
+
+// Write writes data at the current offset
+func (w *SparseWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.offset += int64(n)
+	return n, err
+}
+
+// WriteZeros appends n zero bytes, as a hole where possible
+func (w *SparseWriter) WriteZeros(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	if w.sparse {
+		if _, err := w.file.Seek(n, io.SeekCurrent); err == nil {
+			w.offset += n
+			return nil
+		}
+		// Pipes and similar outputs cannot seek; write zeros from now on
+		w.sparse = false
+	}
+
+	zeros := make([]byte, min(n, sparseZeroBufSize))
+	for n > 0 {
+		written, err := w.Write(zeros[:min(n, int64(len(zeros)))])
+		if err != nil {
+			return fmt.Errorf("failed to write zero region: %w", err)
+		}
+		n -= int64(written)
+	}
+	return nil
+}
+
+// Finish sets the file length so a trailing hole is not lost
+func (w *SparseWriter) Finish() error {
+	if !w.sparse {
+		return nil
+	}
+	if err := w.file.Truncate(w.offset); err != nil {
+		return fmt.Errorf("failed to set file size: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSparseWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *SparseWriter) error
+		want  []byte
+	}{
+		{
+			name: "hole between data",
+			write: func(w *SparseWriter) error {
+				if _, err := w.Write([]byte("ab")); err != nil {
+					return err
+				}
+				if err := w.WriteZeros(3); err != nil {
+					return err
+				}
+				_, err := w.Write([]byte("c"))
+				return err
+			},
+			want: []byte{'a', 'b', 0, 0, 0, 'c'},
+		},
+		{
+			name: "trailing hole",
+			write: func(w *SparseWriter) error {
+				if _, err := w.Write([]byte("x")); err != nil {
+					return err
+				}
+				return w.WriteZeros(4)
+			},
+			want: []byte{'x', 0, 0, 0, 0},
+		},
+		{
+			name:  "only zeros",
+			write: func(w *SparseWriter) error { return w.WriteZeros(1 << 20) },
+			want:  make([]byte, 1<<20),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out")
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := NewSparseWriter(file)
+			if err := tt.write(w); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+			if err := w.Finish(); err != nil {
+				t.Fatalf("Finish() error: %v", err)
+			}
+			file.Close()
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("file content mismatch: got %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSparseWriterFallsBackToZeros(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	sw := NewSparseWriter(w)
+	if err := sw.WriteZeros(3); err != nil {
+		t.Fatalf("WriteZeros() error: %v", err)
+	}
+	if err := sw.Finish(); err != nil {
+		t.Fatalf("Finish() error: %v", err)
+	}
+	w.Close()
+
+	got := make([]byte, 8)
+	n, _ := r.Read(got)
+	if !bytes.Equal(got[:n], []byte{0, 0, 0}) {
+		t.Errorf("expected zeros written to pipe, got %v", got[:n])
+	}
+}
@@ -4,14 +4,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/layout"
 )
 
 // StoreChunk writes a chunk to the chunk storage with the given hash as filename
 func StoreChunk(basePath string, chunkHash string, data []byte) error {
-	chunkPath := filepath.Join(GetChunkDirectory(basePath), chunkHash)
+	chunkPath := layout.ChunkPath(basePath, chunkHash)
+
+	// Make sure the shard directory exists
+	if err := os.MkdirAll(filepath.Dir(chunkPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create chunk directory for %s: %w", chunkHash, err)
+	}
 
-	// Write the chunk data to file
-	if err := os.WriteFile(chunkPath, data, 0o644); err != nil {
+	// A chunk file either holds the whole chunk or does not exist
+	if err := atomic.WriteFile(chunkPath, data, 0o644); err != nil {
 		return fmt.Errorf("failed to write chunk %s: %w", chunkHash, err)
 	}
 
@@ -20,16 +28,15 @@ func StoreChunk(basePath string, chunkHash string, data []byte) error {
 
 // ChunkExists checks if a chunk with the given hash exists
 func ChunkExists(basePath string, chunkHash string) bool {
-	chunkPath := filepath.Join(GetChunkDirectory(basePath), chunkHash)
-	_, err := os.Stat(chunkPath)
-	return err == nil
+	_, exists := layout.LocateChunk(basePath, chunkHash)
+	return exists
 }
 
 // GetChunk retrieves a chunk by its hash
 func GetChunk(basePath string, chunkHash string) ([]byte, error) {
-	chunkPath := filepath.Join(GetChunkDirectory(basePath), chunkHash)
+	loc, _ := layout.LocateChunk(basePath, chunkHash)
 
-	data, err := os.ReadFile(chunkPath)
+	data, err := loc.Read()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read chunk %s: %w", chunkHash, err)
 	}
@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+func TestStoreChunkIsAtomic(t *testing.T) {
+	vaultRoot := t.TempDir()
+	hash := "abcdef0123456789"
+	if err := StoreChunk(vaultRoot, hash, []byte("first")); err != nil {
+		t.Fatalf("StoreChunk() error: %v", err)
+	}
+	if err := StoreChunk(vaultRoot, hash, []byte("second version")); err != nil {
+		t.Fatalf("StoreChunk() overwrite error: %v", err)
+	}
+	data, err := GetChunk(vaultRoot, hash)
+	if err != nil || !bytes.Equal(data, []byte("second version")) {
+		t.Errorf("GetChunk() = %q, %v", data, err)
+	}
+
+	// Only the chunk itself is left in its shard directory
+	chunkPath := layout.ChunkPath(vaultRoot, hash)
+	entries, err := os.ReadDir(filepath.Dir(chunkPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(chunkPath) {
+		t.Errorf("shard directory holds %v, want only the chunk", entries)
+	}
+
+	// A write interrupted before its rename is not mistaken for a chunk
+	leftover := filepath.Join(filepath.Dir(chunkPath), layout.TempFilePrefix+hash+"-123")
+	if err := os.WriteFile(leftover, []byte("fir"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := layout.ListChunkHashes(vaultRoot)
+	if err != nil || len(hashes) != 1 || hashes[0] != hash {
+		t.Errorf("ListChunkHashes() = %v, %v; want only %s", hashes, err, hash)
+	}
+}
@@ -0,0 +1,91 @@
+package fsck
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// BadChunk is a chunk the manifests reference that is missing from the store
+// or whose stored bytes fail their hash check
+type BadChunk struct {
+	Ref     config.ChunkRef
+	Files   []string // Files of the live vault and its snapshots that use it
+	Corrupt bool     // Stored but failing its hash check, rather than missing
+}
+
+// ScanChunks reads every chunk the live vault and its snapshots reference and
+// returns those that are missing or corrupt, along with the number checked.
+// Encrypted chunks are checked against the hash of their ciphertext, so no key
+// is needed. Zero and remote chunks, and files kept in packs, are skipped.
+func ScanChunks(vaultRoot string, opts chunker.Options) ([]BadChunk, int, error) {
+	entries, err := readManifests(filepath.Join(vaultRoot, ".sietch", "manifests"))
+	if err != nil {
+		return nil, 0, err
+	}
+	snapshots, err := snapshot.List(vaultRoot)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, snap := range snapshots {
+		snapEntries, err := readManifests(snapshot.ManifestDir(vaultRoot, snap.ID))
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, snapEntries...)
+	}
+
+	checked := make(map[string]*BadChunk)
+	var bad []*BadChunk
+	for _, entry := range entries {
+		manifest := &entry.Manifest
+		if manifest.Pack != nil {
+			continue
+		}
+		name := displayName(manifest)
+		for _, ref := range manifest.Chunks {
+			if ref.Zero || ref.Remote {
+				continue
+			}
+			key := storageKey(ref)
+			result, seen := checked[key]
+			if !seen {
+				result = checkChunk(vaultRoot, ref, opts)
+				checked[key] = result
+				if result != nil {
+					bad = append(bad, result)
+				}
+			}
+			if result != nil && (len(result.Files) == 0 || result.Files[len(result.Files)-1] != name) {
+				result.Files = append(result.Files, name)
+			}
+		}
+	}
+
+	chunks := make([]BadChunk, 0, len(bad))
+	for _, chunk := range bad {
+		chunks = append(chunks, *chunk)
+	}
+	sort.Slice(chunks, func(i, j int) bool { return storageKey(chunks[i].Ref) < storageKey(chunks[j].Ref) })
+	return chunks, len(checked), nil
+}
+
+// checkChunk returns nil when the stored copy of ref is intact
+func checkChunk(vaultRoot string, ref config.ChunkRef, opts chunker.Options) *BadChunk {
+	loc, ok := layout.LocateChunk(vaultRoot, storageKey(ref))
+	if !ok {
+		return &BadChunk{Ref: ref}
+	}
+	data, err := loc.Read()
+	if err != nil {
+		return &BadChunk{Ref: ref, Corrupt: true}
+	}
+	if err := chunker.CheckStored(ref, data, opts); err != nil {
+		return &BadChunk{Ref: ref, Corrupt: true}
+	}
+	return nil
+}
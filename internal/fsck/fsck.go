@@ -0,0 +1,458 @@
+// Package fsck checks a vault's chunk store against its manifests and repairs
+// what an interrupted operation can leave behind: chunks and packs that no
+// manifest references, files whose chunks are missing, and dedup index
+// reference counts that disagree with the manifests.
+//
+// Every decision is made from the manifests of the live vault and of all its
+// snapshots, never from the index: a chunk any manifest references is kept even
+// when the index counts no references to it.
+package fsck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/ingest"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/sharedstore"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+)
+
+// Report is the result of checking a vault
+type Report struct {
+	Files         int                       `json:"files"`
+	SnapshotFiles int                       `json:"snapshot_files"`
+	StoredChunks  int                       `json:"stored_chunks"`
+	Orphans       []Orphan                  `json:"orphans"`
+	OrphanPacks   []Orphan                  `json:"orphan_packs"`
+	Damaged       []DamagedFile             `json:"damaged"`
+	Recovered     []string                  `json:"recovered"`               // Files marked damaged whose chunks are all present again
+	RemoteChunks  int                       `json:"remote_chunks,omitempty"` // Chunks recorded from dedup hints and not fetched yet
+	SharedStore   string                    `json:"shared_store,omitempty"`  // Orphans are not scanned in a shared store
+	Index         *deduplication.IndexCheck `json:"index,omitempty"`
+	IndexError    string                    `json:"index_error,omitempty"`
+
+	vaultRoot   string
+	dedupConfig config.DeduplicationConfig
+	live        []*config.ManifestEntry
+	copies      map[string]config.ChunkRef // Plaintext hash to a stored copy of the chunk
+}
+
+// Orphan is a chunk or pack on disk that no manifest references
+type Orphan struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// DamagedFile is a file whose manifest references chunks that are not on disk
+type DamagedFile struct {
+	File      string `json:"file"`
+	Snapshot  string `json:"snapshot,omitempty"` // Empty for the live vault
+	Missing   int    `json:"missing"`
+	Adoptable int    `json:"adoptable"` // Missing chunks another manifest has a stored copy of
+	Marked    bool   `json:"marked"`    // Whether the manifest is already marked damaged
+}
+
+// OK reports whether the check found nothing to repair
+func (r *Report) OK() bool {
+	return len(r.Orphans) == 0 && len(r.OrphanPacks) == 0 && len(r.Damaged) == 0 && len(r.Recovered) == 0 &&
+		r.IndexError == "" && (r.Index == nil || r.Index.OK())
+}
+
+// OrphanBytes returns the disk space held by orphaned chunks and packs
+func (r *Report) OrphanBytes() int64 {
+	var total int64
+	for _, orphan := range r.Orphans {
+		total += orphan.Size
+	}
+	for _, orphan := range r.OrphanPacks {
+		total += orphan.Size
+	}
+	return total
+}
+
+// RepairOptions selects what Repair changes
+type RepairOptions struct {
+	DeleteOrphans bool
+}
+
+// RepairResult summarises a repair
+type RepairResult struct {
+	Adopted        int                          `json:"adopted"`         // Chunk references pointed at a surviving copy
+	MarkedDamaged  int                          `json:"marked_damaged"`  // Manifests newly marked damaged
+	Cleared        int                          `json:"cleared"`         // Manifests no longer damaged
+	Index          *deduplication.RebuildResult `json:"index,omitempty"` // Set when the index was rebuilt
+	OrphansDeleted int                          `json:"orphans_deleted"`
+	BytesFreed     int64                        `json:"bytes_freed"`
+}
+
+// Check scans the vault without changing anything
+func Check(vaultRoot string, vaultConfig *config.VaultConfig) (*Report, error) {
+	report := &Report{
+		Orphans:     []Orphan{},
+		OrphanPacks: []Orphan{},
+		Damaged:     []DamagedFile{},
+		Recovered:   []string{},
+		vaultRoot:   vaultRoot,
+		dedupConfig: vaultConfig.Deduplication,
+		copies:      make(map[string]config.ChunkRef),
+	}
+
+	// Collect every manifest first: a chunk missing from one file may have a
+	// stored copy recorded in another
+	live, err := readManifests(filepath.Join(vaultRoot, ".sietch", "manifests"))
+	if err != nil {
+		return nil, err
+	}
+	report.live = live
+	report.Files = len(live)
+	snapshots, err := snapshot.List(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	snapshotEntries := make(map[string][]*config.ManifestEntry, len(snapshots))
+	for _, snap := range snapshots {
+		entries, err := readManifests(snapshot.ManifestDir(vaultRoot, snap.ID))
+		if err != nil {
+			return nil, err
+		}
+		snapshotEntries[snap.ID] = entries
+		report.SnapshotFiles += len(entries)
+	}
+
+	referenced := make(map[string]bool)
+	referencedPacks := make(map[string]bool)
+	stored := make(map[string]bool)
+	exists := func(key string) bool {
+		present, ok := stored[key]
+		if !ok {
+			_, present = layout.LocateChunk(vaultRoot, key)
+			stored[key] = present
+		}
+		return present
+	}
+	collect := func(entries []*config.ManifestEntry) {
+		for _, entry := range entries {
+			if entry.Manifest.Pack != nil {
+				referencedPacks[entry.Manifest.Pack.ID] = true
+			}
+			for _, ref := range entry.Manifest.Chunks {
+				if ref.Zero {
+					continue
+				}
+				// Keep files named by either hash; older vaults stored some chunks
+				// under their plaintext hash
+				referenced[ref.Hash] = true
+				if ref.EncryptedHash != "" {
+					referenced[ref.EncryptedHash] = true
+				}
+				if _, ok := report.copies[ref.Hash]; !ok && exists(storageKey(ref)) {
+					report.copies[ref.Hash] = ref
+				}
+			}
+		}
+	}
+	collect(live)
+	for _, entries := range snapshotEntries {
+		collect(entries)
+	}
+	// Chunks an interrupted add committed are kept for it to resume from
+	pending, err := ingest.Pending(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range pending {
+		if !ref.Zero {
+			referenced[storageKey(ref)] = true
+		}
+	}
+
+	for _, entry := range live {
+		report.checkFile(entry, "", exists)
+	}
+	for _, snap := range snapshots {
+		for _, entry := range snapshotEntries[snap.ID] {
+			report.checkFile(entry, snap.ID, exists)
+		}
+	}
+
+	if err := report.findOrphans(referenced, referencedPacks); err != nil {
+		return nil, err
+	}
+
+	if vaultConfig.Deduplication.Enabled {
+		dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			report.IndexError = err.Error()
+		} else if report.Index, err = dedupManager.CheckIndex(); err != nil {
+			return nil, fmt.Errorf("failed to check deduplication index: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// checkFile records a file with missing data, or a damaged one that recovered
+func (r *Report) checkFile(entry *config.ManifestEntry, snapshotID string, exists func(string) bool) {
+	manifest := &entry.Manifest
+	damaged := DamagedFile{File: displayName(manifest), Snapshot: snapshotID, Marked: manifest.Damaged}
+	if manifest.Pack != nil {
+		if _, err := os.Stat(layout.PackPath(r.vaultRoot, manifest.Pack.ID)); err != nil {
+			damaged.Missing++
+		}
+	}
+	for _, ref := range manifest.Chunks {
+		if ref.Zero || exists(storageKey(ref)) {
+			continue
+		}
+		if ref.Remote {
+			// Held by another vault until a sync fetches it
+			if snapshotID == "" {
+				r.RemoteChunks++
+			}
+			continue
+		}
+		damaged.Missing++
+		if _, ok := r.copies[ref.Hash]; ok {
+			damaged.Adoptable++
+		}
+	}
+
+	switch {
+	case damaged.Missing > 0:
+		r.Damaged = append(r.Damaged, damaged)
+	case manifest.Damaged && snapshotID == "":
+		r.Recovered = append(r.Recovered, damaged.File)
+	}
+}
+
+// findOrphans lists stored chunks and packs that no manifest references
+func (r *Report) findOrphans(referenced, referencedPacks map[string]bool) error {
+	store, err := sharedstore.ForVault(r.vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to open shared store: %v", err)
+	}
+	if store != nil {
+		// Other vaults reference chunks in the store too; 'sietch dedup gc' handles them
+		r.SharedStore = store.Path
+	} else {
+		keys, err := layout.ListChunkHashes(r.vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to list chunks: %v", err)
+		}
+		r.StoredChunks = len(keys)
+		for _, key := range keys {
+			if referenced[key] {
+				continue
+			}
+			orphan := Orphan{Key: key}
+			if loc, ok := layout.LocateChunk(r.vaultRoot, key); ok {
+				if size, err := loc.Size(); err == nil {
+					orphan.Size = size
+				}
+			}
+			r.Orphans = append(r.Orphans, orphan)
+		}
+	}
+
+	packIDs, err := layout.ListPackIDs(r.vaultRoot)
+	if err != nil {
+		return err
+	}
+	for _, id := range packIDs {
+		if referencedPacks[id] {
+			continue
+		}
+		orphan := Orphan{Key: id}
+		if info, err := os.Stat(layout.PackPath(r.vaultRoot, id)); err == nil {
+			orphan.Size = info.Size()
+		}
+		r.OrphanPacks = append(r.OrphanPacks, orphan)
+	}
+
+	sort.Slice(r.Orphans, func(i, j int) bool { return r.Orphans[i].Key < r.Orphans[j].Key })
+	sort.Slice(r.OrphanPacks, func(i, j int) bool { return r.OrphanPacks[i].Key < r.OrphanPacks[j].Key })
+	return nil
+}
+
+// Repair fixes what Check found. Missing chunks that another manifest has a
+// stored copy of are adopted; live files still missing data are marked damaged
+// and files that recovered are unmarked, in one transaction. The dedup index is
+// then rebuilt from the manifests. Orphans are only deleted when requested.
+// Snapshots are never modified.
+func Repair(report *Report, opts RepairOptions) (*RepairResult, error) {
+	result := &RepairResult{}
+	if err := report.repairManifests(result); err != nil {
+		return nil, err
+	}
+
+	if report.dedupConfig.Enabled && (report.IndexError != "" || report.Index == nil || !report.Index.OK() || result.Adopted > 0) {
+		rebuilt, err := deduplication.RebuildIndex(report.vaultRoot, report.dedupConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild deduplication index: %v", err)
+		}
+		result.Index = rebuilt
+	}
+
+	if opts.DeleteOrphans {
+		for _, orphan := range report.Orphans {
+			// Chunk packs are never modified; 'sietch dedup gc' drops packed orphans
+			loc, ok := layout.LocateChunk(report.vaultRoot, orphan.Key)
+			if !ok || loc.Packed() {
+				continue
+			}
+			if err := os.Remove(loc.Path); err != nil {
+				return nil, fmt.Errorf("failed to delete orphaned chunk %s: %v", orphan.Key, err)
+			}
+			result.OrphansDeleted++
+			result.BytesFreed += orphan.Size
+		}
+		for _, orphan := range report.OrphanPacks {
+			if err := os.Remove(layout.PackPath(report.vaultRoot, orphan.Key)); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to delete orphaned pack %s: %v", orphan.Key, err)
+			}
+			result.OrphansDeleted++
+			result.BytesFreed += orphan.Size
+		}
+	}
+	return result, nil
+}
+
+// repairManifests adopts stored copies of missing chunks and updates the damaged
+// mark of every live manifest that needs it
+func (r *Report) repairManifests(result *RepairResult) error {
+	txn, err := atomic.Begin(r.vaultRoot, map[string]any{"command": "fsck --repair"})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	compress := config.ManifestCompression(r.vaultRoot)
+	for _, entry := range r.live {
+		manifest := entry.Manifest
+		changed := false
+		missing := 0
+		if manifest.Pack != nil {
+			if _, err := os.Stat(layout.PackPath(r.vaultRoot, manifest.Pack.ID)); err != nil {
+				missing++
+			}
+		}
+		for i, ref := range manifest.Chunks {
+			if ref.Zero {
+				continue
+			}
+			if _, ok := layout.LocateChunk(r.vaultRoot, storageKey(ref)); ok {
+				continue
+			}
+			stored, ok := r.copies[ref.Hash]
+			if !ok {
+				if !ref.Remote {
+					missing++
+				}
+				continue
+			}
+			manifest.Chunks[i] = adopt(ref, stored)
+			result.Adopted++
+			changed = true
+		}
+
+		switch {
+		case missing > 0 && !manifest.Damaged:
+			manifest.Damaged = true
+			result.MarkedDamaged++
+			changed = true
+		case missing == 0 && manifest.Damaged:
+			manifest.Damaged = false
+			result.Cleared++
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		rel, err := filepath.Rel(r.vaultRoot, entry.Path)
+		if err != nil {
+			return err
+		}
+		w, err := txn.StageReplace(filepath.ToSlash(rel))
+		if err != nil {
+			return fmt.Errorf("stage manifest %s: %w", filepath.Base(entry.Path), err)
+		}
+		mw := config.NewManifestWriter(w, compress)
+		enc := yaml.NewEncoder(mw)
+		enc.SetIndent(2)
+		if err := enc.Encode(&manifest); err != nil {
+			_ = w.Close()
+			return fmt.Errorf("encode manifest: %w", err)
+		}
+		if err := mw.Close(); err != nil {
+			_ = w.Close()
+			return fmt.Errorf("encode manifest: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// adopt points a chunk reference at a stored copy of the same plaintext. The copy
+// may have been compressed or encrypted differently, so its encoding is taken over
+// with its storage key.
+func adopt(ref, stored config.ChunkRef) config.ChunkRef {
+	ref.EncryptedHash = stored.EncryptedHash
+	ref.EncryptedSize = stored.EncryptedSize
+	ref.CompressedSize = stored.CompressedSize
+	ref.Compressed = stored.Compressed
+	ref.CompressionType = stored.CompressionType
+	ref.Incompressible = stored.Incompressible
+	ref.Convergent = stored.Convergent
+	ref.Deduplicated = true
+	ref.Remote = false
+	return ref
+}
+
+// readManifests loads the manifests in a directory without decrypting paths, so
+// they can be written back unchanged
+func readManifests(dir string) ([]*config.ManifestEntry, error) {
+	var entries []*config.ManifestEntry
+	err := config.WalkManifestDir(dir, func(entry *config.ManifestEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %v", err)
+	}
+	return entries, nil
+}
+
+// displayName names a file in the report; encrypted paths are shown by path ID
+func displayName(manifest *config.FileManifest) string {
+	if manifest.EncryptedPath != "" && manifest.FilePath == "" {
+		return "path-id:" + manifest.PathID
+	}
+	return manifest.Destination + manifest.FilePath
+}
+
+func storageKey(ref config.ChunkRef) string {
+	if ref.EncryptedHash != "" {
+		return ref.EncryptedHash
+	}
+	return ref.Hash
+}
@@ -0,0 +1,202 @@
+package fsck
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+func writeManifest(t *testing.T, vaultRoot string, manifest config.FileManifest) {
+	t.Helper()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(&manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(manifestsDir, manifest.FilePath+".yaml"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func storeChunks(t *testing.T, vaultRoot string, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := fs.StoreChunk(vaultRoot, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func damagedFiles(report *Report) map[string]DamagedFile {
+	files := make(map[string]DamagedFile)
+	for _, damaged := range report.Damaged {
+		files[damaged.File] = damaged
+	}
+	return files
+}
+
+func TestCheckAndRepair(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := &config.VaultConfig{}
+
+	// e.txt is only kept alive by a snapshot
+	storeChunks(t, vaultRoot, "e1", "a1", "dddd")
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "e.txt", Chunks: []config.ChunkRef{{Hash: "eeee", EncryptedHash: "e1"}}})
+	if _, err := snapshot.Create(vaultRoot, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(vaultRoot, ".sietch", "manifests", "e.txt.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "a.txt", Chunks: []config.ChunkRef{{Hash: "aaaa", EncryptedHash: "a1", Compressed: true, CompressionType: "gzip"}}})
+	// b.txt was deduplicated against a ciphertext that was never written, but a.txt has a copy
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "b.txt", Chunks: []config.ChunkRef{{Hash: "aaaa", EncryptedHash: "b1"}, {Hash: "zero", Zero: true}}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "c.txt", Chunks: []config.ChunkRef{{Hash: "cccc"}}})
+
+	report, err := Check(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if report.Files != 3 || report.SnapshotFiles != 1 {
+		t.Errorf("Check() counted %d files and %d snapshot files", report.Files, report.SnapshotFiles)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0].Key != "dddd" || report.Orphans[0].Size != 4 {
+		t.Errorf("Orphans = %+v, want only dddd", report.Orphans)
+	}
+	damaged := damagedFiles(report)
+	if len(damaged) != 2 || damaged["b.txt"].Adoptable != 1 || damaged["c.txt"].Missing != 1 || damaged["c.txt"].Adoptable != 0 {
+		t.Errorf("Damaged = %+v", report.Damaged)
+	}
+	if report.OK() {
+		t.Error("OK() = true for a vault with problems")
+	}
+
+	result, err := Repair(report, RepairOptions{DeleteOrphans: true})
+	if err != nil {
+		t.Fatalf("Repair() error: %v", err)
+	}
+	if result.Adopted != 1 || result.MarkedDamaged != 1 || result.OrphansDeleted != 1 || result.BytesFreed != 4 {
+		t.Errorf("Repair() = %+v", result)
+	}
+	if fs.ChunkExists(vaultRoot, "dddd") || !fs.ChunkExists(vaultRoot, "e1") {
+		t.Error("Repair() deleted the wrong chunks")
+	}
+
+	report, err = Check(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged = damagedFiles(report)
+	if len(damaged) != 1 || !damaged["c.txt"].Marked || len(report.Orphans) != 0 {
+		t.Errorf("after repair: damaged %+v, orphans %+v", report.Damaged, report.Orphans)
+	}
+	adopted := report.live[1].Manifest.Chunks[0]
+	if report.live[1].Manifest.FilePath != "b.txt" || adopted.EncryptedHash != "a1" || adopted.CompressionType != "gzip" {
+		t.Errorf("b.txt chunk after adoption = %+v", adopted)
+	}
+
+	// Once the chunk is back the damaged mark is cleared
+	storeChunks(t, vaultRoot, "cccc")
+	report, err = Check(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Damaged) != 0 || len(report.Recovered) != 1 {
+		t.Errorf("after restoring c.txt: damaged %+v, recovered %v", report.Damaged, report.Recovered)
+	}
+	if result, err := Repair(report, RepairOptions{}); err != nil || result.Cleared != 1 {
+		t.Errorf("Repair() = %+v, %v; want one cleared", result, err)
+	}
+	if report, _ := Check(vaultRoot, vaultConfig); !report.OK() {
+		t.Errorf("Check() after repairs = %+v", report)
+	}
+}
+
+func TestRemoteChunksAreNotDamage(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := &config.VaultConfig{}
+	storeChunks(t, vaultRoot, "a1")
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "a.txt", Chunks: []config.ChunkRef{{Hash: "aaaa", EncryptedHash: "a1"}}})
+	// b.txt was added with dedup hints: one chunk another vault holds, one a.txt has a copy of
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "b.txt", Chunks: []config.ChunkRef{
+		{Hash: "bbbb", EncryptedHash: "b1", Remote: true},
+		{Hash: "aaaa", EncryptedHash: "x1", Remote: true},
+	}})
+
+	report, err := Check(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if !report.OK() || report.RemoteChunks != 2 {
+		t.Errorf("Check() = %+v, want OK with 2 remote chunks", report)
+	}
+
+	result, err := Repair(report, RepairOptions{})
+	if err != nil || result.Adopted != 1 || result.MarkedDamaged != 0 {
+		t.Errorf("Repair() = %+v, %v; want one adopted and nothing damaged", result, err)
+	}
+	report, _ = Check(vaultRoot, vaultConfig)
+	if chunks := report.live[1].Manifest.Chunks; !chunks[0].Remote || chunks[1].Remote || chunks[1].EncryptedHash != "a1" {
+		t.Errorf("b.txt chunks after repair = %+v", chunks)
+	}
+}
+
+func TestScanChunks(t *testing.T) {
+	vaultRoot := t.TempDir()
+	hash := func(data string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(data))) }
+	// plain stores data unencrypted and returns its chunk ref
+	plain := func(data string) config.ChunkRef {
+		if err := fs.StoreChunk(vaultRoot, hash(data), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		return config.ChunkRef{Hash: hash(data), Size: int64(len(data))}
+	}
+
+	intact, corrupt := plain("intact"), plain("corrupt")
+	if err := fs.StoreChunk(vaultRoot, corrupt.Hash, []byte("c0rrupt")); err != nil {
+		t.Fatal(err)
+	}
+	// Encrypted chunks are checked against the hash of what is stored
+	sealed := config.ChunkRef{Hash: hash("plaintext"), EncryptedHash: hash("ciphertext")}
+	if err := fs.StoreChunk(vaultRoot, sealed.EncryptedHash, []byte("ciphertext")); err != nil {
+		t.Fatal(err)
+	}
+	missing := config.ChunkRef{Hash: hash("missing")}
+
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "a.txt", Chunks: []config.ChunkRef{intact, corrupt, sealed}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "b.txt", Chunks: []config.ChunkRef{missing, corrupt, {Hash: "zero", Zero: true}, {Hash: "remote", Remote: true}}})
+
+	bad, checked, err := ScanChunks(vaultRoot, chunker.Options{HashAlgorithm: "sha256"})
+	if err != nil {
+		t.Fatalf("ScanChunks() error: %v", err)
+	}
+	if checked != 4 {
+		t.Errorf("ScanChunks() checked %d chunks, want 4", checked)
+	}
+	found := make(map[string]BadChunk)
+	for _, chunk := range bad {
+		found[chunk.Ref.Hash] = chunk
+	}
+	if len(found) != 2 {
+		t.Fatalf("ScanChunks() = %+v, want the corrupt and the missing chunk", bad)
+	}
+	if c := found[corrupt.Hash]; !c.Corrupt || len(c.Files) != 2 {
+		t.Errorf("corrupt chunk = %+v, want corrupt and used by both files", c)
+	}
+	if c, ok := found[missing.Hash]; !ok || c.Corrupt || len(c.Files) != 1 || c.Files[0] != "b.txt" {
+		t.Errorf("missing chunk = %+v, want missing and used by b.txt", c)
+	}
+}
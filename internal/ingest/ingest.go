@@ -0,0 +1,330 @@
+// Package ingest makes adding a large file resumable. The chunks of the file
+// are committed in checkpoints: every checkpoint stores the chunks written
+// since the previous one in its own transaction, together with a segment of
+// progress listing their references, under .sietch/ingest/<manifest>/. When an
+// add is interrupted, adding the same file again reads the committed segments
+// back and continues splitting the file after the last checkpointed chunk.
+// The file's manifest is only written by the add once every chunk is stored,
+// after which the progress is removed.
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+const (
+	// command names checkpoint transactions, so interrupted ones can be found
+	command = "add ingest"
+
+	sourceFile = "source.yaml"
+)
+
+// checkpointBytes is how much file data a checkpoint commits; smaller files
+// are added in one go (lowered in tests)
+var checkpointBytes int64 = 256 << 20
+
+// Source identifies the file being ingested and the settings it is stored
+// under. Progress recorded for a different Source is discarded.
+type Source struct {
+	Path     string `yaml:"path"`     // Absolute path of the source file
+	Size     int64  `yaml:"size"`     // Size of the source file
+	ModTime  string `yaml:"mod_time"` // Modification time, RFC 3339 with nanoseconds
+	Inode    uint64 `yaml:"inode,omitempty"`
+	Settings string `yaml:"settings"` // Chunking, compression and encryption settings
+}
+
+// segment lists the chunks committed by one checkpoint
+type segment struct {
+	Chunks []config.ChunkRef `yaml:"chunks"`
+}
+
+// Resumable reports whether a file of the given size is ingested with checkpoints
+func Resumable(size int64) bool {
+	return size > checkpointBytes
+}
+
+// Dir returns where the progress of ingesting the file stored under the
+// given manifest name is kept, relative to the vault root
+func Dir(manifestName string) string {
+	return filepath.ToSlash(filepath.Join(".sietch", "ingest", manifestName))
+}
+
+// Ingest stores the chunks of one file through checkpoint transactions. It
+// satisfies chunker.ChunkStore; Record must be called with every chunk
+// reference in order, including the zero chunks that are never stored.
+type Ingest struct {
+	vaultRoot string
+	dir       string
+	source    Source
+	newStore  func(*atomic.Transaction) chunker.ChunkStore
+
+	refs       []config.ChunkRef // Every chunk so far, resumed ones first
+	resumed    int               // Chunks committed by an earlier add
+	offset     int64             // Bytes of the file covered by the resumed chunks
+	segments   int               // Segments written so far
+	pending    int               // Chunks in refs not checkpointed yet
+	pendingLen int64             // Bytes covered by the pending chunks
+	hasSource  bool              // source.yaml has been committed
+
+	txn   *atomic.Transaction
+	store chunker.ChunkStore
+}
+
+// Start prepares ingesting source into the manifest manifestName. Progress an
+// interrupted add of the same file under the same settings left behind is
+// picked up; progress for anything else, or whose chunks are no longer all in
+// the vault, is discarded. newStore returns the store chunks of a checkpoint
+// are deduplicated and staged through.
+func Start(vaultRoot, manifestName string, source Source, newStore func(*atomic.Transaction) chunker.ChunkStore) (*Ingest, error) {
+	// A checkpoint that was still being staged is dropped; its chunks are
+	// after the last committed segment and are stored again
+	recovered, err := atomic.FinishInterrupted(vaultRoot, command)
+	if err != nil {
+		return nil, err
+	}
+	if len(recovered.Errors) > 0 {
+		return nil, fmt.Errorf("failed to recover an interrupted add: %v", recovered.Errors[0])
+	}
+
+	ing := &Ingest{vaultRoot: vaultRoot, dir: Dir(manifestName), source: source, newStore: newStore}
+	refs, recorded, segments, err := load(vaultRoot, ing.dir)
+	if err != nil {
+		return nil, err
+	}
+	if recorded == nil || *recorded != source || !allStored(vaultRoot, refs) {
+		if err := os.RemoveAll(filepath.Join(vaultRoot, filepath.FromSlash(ing.dir))); err != nil {
+			return nil, fmt.Errorf("failed to discard stale add progress: %v", err)
+		}
+		return ing, nil
+	}
+
+	ing.refs = refs
+	ing.resumed = len(refs)
+	ing.segments = segments
+	ing.hasSource = true
+	for _, ref := range refs {
+		ing.offset += ref.Size
+	}
+	return ing, nil
+}
+
+// Offset returns the byte offset in the file to continue splitting at
+func (ing *Ingest) Offset() int64 {
+	return ing.offset
+}
+
+// Resumed returns how many chunks an earlier add already committed
+func (ing *Ingest) Resumed() int {
+	return ing.resumed
+}
+
+// Put stages a chunk in the current checkpoint, committing the previous
+// checkpoint first when it is full
+func (ing *Ingest) Put(ref config.ChunkRef, data []byte) (config.ChunkRef, error) {
+	if ing.pendingLen >= checkpointBytes {
+		if err := ing.checkpoint(); err != nil {
+			return ref, err
+		}
+	}
+	if ing.txn == nil {
+		if err := ing.begin(); err != nil {
+			return ref, err
+		}
+	}
+	return ing.store.Put(ref, data)
+}
+
+// Get reads a chunk, staged in the open checkpoint or already committed
+func (ing *Ingest) Get(ref config.ChunkRef) ([]byte, error) {
+	if ing.store != nil {
+		return ing.store.Get(ref)
+	}
+	return fs.GetChunk(ing.vaultRoot, chunker.StorageKey(ref))
+}
+
+// Record adds the reference of the next chunk of the file. Chunks are
+// numbered after the resumed ones.
+func (ing *Ingest) Record(ref config.ChunkRef) {
+	ref.Index = len(ing.refs)
+	ing.refs = append(ing.refs, ref)
+	ing.pending++
+	ing.pendingLen += ref.Size
+}
+
+// Finish commits the last checkpoint and returns the references of every
+// chunk of the file, resumed ones included
+func (ing *Ingest) Finish() ([]config.ChunkRef, error) {
+	if ing.pending > 0 || ing.txn != nil {
+		if err := ing.checkpoint(); err != nil {
+			return nil, err
+		}
+	}
+	return ing.refs, nil
+}
+
+// Abort drops the checkpoint being staged; committed ones are kept for the
+// next add to resume from
+func (ing *Ingest) Abort() {
+	if ing.txn != nil {
+		_ = ing.txn.Rollback()
+		ing.txn, ing.store = nil, nil
+	}
+}
+
+// Done removes the progress once the file's manifest has been committed
+func (ing *Ingest) Done() error {
+	return os.RemoveAll(filepath.Join(ing.vaultRoot, filepath.FromSlash(ing.dir)))
+}
+
+func (ing *Ingest) begin() error {
+	txn, err := atomic.Begin(ing.vaultRoot, map[string]any{"command": command, "file": ing.source.Path})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	ing.txn = txn
+	ing.store = ing.newStore(txn)
+	return nil
+}
+
+// checkpoint commits the staged chunks together with the segment listing them
+func (ing *Ingest) checkpoint() error {
+	if ing.txn == nil {
+		// Zero and remote chunks since the last checkpoint staged nothing
+		if err := ing.begin(); err != nil {
+			return err
+		}
+	}
+	if !ing.hasSource {
+		if err := stageYAML(ing.txn, ing.dir+"/"+sourceFile, &ing.source); err != nil {
+			ing.Abort()
+			return err
+		}
+	}
+	name := fmt.Sprintf("%s/%08d.yaml", ing.dir, ing.segments+1)
+	seg := segment{Chunks: ing.refs[len(ing.refs)-ing.pending:]}
+	if err := stageYAML(ing.txn, name, &seg); err != nil {
+		ing.Abort()
+		return err
+	}
+	if err := ing.txn.Commit(); err != nil {
+		ing.Abort()
+		return fmt.Errorf("commit checkpoint: %w", err)
+	}
+	ing.txn, ing.store = nil, nil
+	ing.hasSource = true
+	ing.segments++
+	ing.pending, ing.pendingLen = 0, 0
+	return nil
+}
+
+// Pending returns the chunks committed by every add that has not finished,
+// which no manifest references yet
+func Pending(vaultRoot string) ([]config.ChunkRef, error) {
+	root := filepath.Join(vaultRoot, ".sietch", "ingest")
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read add progress: %v", err)
+	}
+	var refs []config.ChunkRef
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		chunks, _, _, err := load(vaultRoot, Dir(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, chunks...)
+	}
+	return refs, nil
+}
+
+// load reads the progress in dir: the source it was recorded for (nil when
+// there is none), the chunks of its segments in order and how many segments
+// there are
+func load(vaultRoot, dir string) ([]config.ChunkRef, *Source, int, error) {
+	absDir := filepath.Join(vaultRoot, filepath.FromSlash(dir))
+	data, err := os.ReadFile(filepath.Join(absDir, sourceFile))
+	if os.IsNotExist(err) {
+		return nil, nil, 0, nil
+	}
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read add progress: %v", err)
+	}
+	var source Source
+	if err := yaml.Unmarshal(data, &source); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to parse add progress %s: %v", dir, err)
+	}
+
+	entries, err := os.ReadDir(absDir)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read add progress: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() != sourceFile && strings.HasSuffix(entry.Name(), ".yaml") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var refs []config.ChunkRef
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(absDir, name))
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to read add progress: %v", err)
+		}
+		var seg segment
+		if err := yaml.Unmarshal(data, &seg); err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to parse add progress %s/%s: %v", dir, name, err)
+		}
+		refs = append(refs, seg.Chunks...)
+	}
+	return refs, &source, len(names), nil
+}
+
+// allStored reports whether every stored chunk in refs is still in the vault;
+// an fsck repair in the meantime may have removed them
+func allStored(vaultRoot string, refs []config.ChunkRef) bool {
+	for _, ref := range refs {
+		if ref.Zero || ref.Remote {
+			continue
+		}
+		if !fs.ChunkExists(vaultRoot, chunker.StorageKey(ref)) {
+			return false
+		}
+	}
+	return true
+}
+
+func stageYAML(txn *atomic.Transaction, relPath string, v any) error {
+	w, err := txn.StageCreate(relPath)
+	if err != nil {
+		return fmt.Errorf("stage %s: %w", relPath, err)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode %s: %w", relPath, err)
+	}
+	if err := enc.Close(); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode %s: %w", relPath, err)
+	}
+	return w.Close()
+}
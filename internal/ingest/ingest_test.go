@@ -0,0 +1,131 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// failingReader fails once n bytes have been read, like a killed add
+type failingReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, errors.New("interrupted")
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+// ingestData splits data into 10 byte chunks through a new ingest of source.
+// With failAfter set, reading fails after that many bytes.
+func ingestData(t *testing.T, vaultRoot string, source Source, data []byte, failAfter int) (*Ingest, []config.ChunkRef, error) {
+	t.Helper()
+	dedup, err := deduplication.NewManager(vaultRoot, config.DeduplicationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ing, err := Start(vaultRoot, "big.bin", source, func(txn *atomic.Transaction) chunker.ChunkStore {
+		return dedup.TransactionalStore(txn)
+	})
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	var r io.Reader = bytes.NewReader(data[ing.Offset():])
+	if failAfter > 0 {
+		r = &failingReader{r: r, n: failAfter}
+	}
+	opts := chunker.Options{Strategy: "fixed", ChunkSize: 10, HashAlgorithm: "sha256", OnChunk: ing.Record}
+	if _, err := chunker.Split(context.Background(), r, ing, opts); err != nil {
+		ing.Abort()
+		return ing, nil, err
+	}
+	refs, err := ing.Finish()
+	return ing, refs, err
+}
+
+func TestIngestResumes(t *testing.T) {
+	defer func(size int64) { checkpointBytes = size }(checkpointBytes)
+	checkpointBytes = 10
+
+	vaultRoot := t.TempDir()
+	data := []byte("aaaaaaaaaabbbbbbbbbbccccccccccdddddddddd")
+	source := Source{Path: "/data/big.bin", Size: int64(len(data)), ModTime: "2025-01-01T00:00:00Z", Settings: "fixed 10"}
+
+	// The add dies reading the third chunk: the first checkpoint holds the
+	// first chunk, the second chunk was still being staged
+	if _, _, err := ingestData(t, vaultRoot, source, data, 25); err == nil {
+		t.Fatal("interrupted ingest succeeded")
+	}
+	if pending, err := Pending(vaultRoot); err != nil || len(pending) != 1 {
+		t.Fatalf("Pending() = %d chunks, %v; want the one checkpointed", len(pending), err)
+	}
+
+	ing, refs, err := ingestData(t, vaultRoot, source, data, 0)
+	if err != nil {
+		t.Fatalf("resumed ingest error: %v", err)
+	}
+	if ing.Resumed() != 1 || ing.Offset() != 10 {
+		t.Errorf("resumed %d chunks at offset %d, want 1 at 10", ing.Resumed(), ing.Offset())
+	}
+	want, err := chunker.Split(context.Background(), bytes.NewReader(data), chunker.NewMemoryStore(),
+		chunker.Options{Strategy: "fixed", ChunkSize: 10, HashAlgorithm: "sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("ingest returned %d chunks, want %d", len(refs), len(want))
+	}
+	for i, ref := range refs {
+		if ref.Hash != want[i].Hash || ref.Index != i {
+			t.Errorf("chunk %d = %s (index %d), want %s", i, ref.Hash, ref.Index, want[i].Hash)
+		}
+		if !fs.ChunkExists(vaultRoot, ref.Hash) {
+			t.Errorf("chunk %d was not committed", i)
+		}
+	}
+
+	if err := ing.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := Pending(vaultRoot); err != nil || len(pending) != 0 {
+		t.Errorf("Pending() after Done = %d chunks, %v; want none", len(pending), err)
+	}
+}
+
+func TestIngestDiscardsOtherSource(t *testing.T) {
+	defer func(size int64) { checkpointBytes = size }(checkpointBytes)
+	checkpointBytes = 10
+
+	vaultRoot := t.TempDir()
+	data := []byte("aaaaaaaaaabbbbbbbbbbcccccccccc")
+	source := Source{Path: "/data/big.bin", Size: int64(len(data)), ModTime: "2025-01-01T00:00:00Z", Settings: "fixed 10"}
+	if _, _, err := ingestData(t, vaultRoot, source, data, 25); err == nil {
+		t.Fatal("interrupted ingest succeeded")
+	}
+
+	// The file changed since: its progress no longer applies
+	source.ModTime = "2025-02-01T00:00:00Z"
+	ing, refs, err := ingestData(t, vaultRoot, source, data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ing.Resumed() != 0 || len(refs) != 3 {
+		t.Errorf("resumed %d chunks and returned %d, want a fresh ingest of 3", ing.Resumed(), len(refs))
+	}
+}
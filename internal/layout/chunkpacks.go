@@ -0,0 +1,203 @@
+package layout
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Chunk packs hold many small chunks in one file, so a vault of small chunks
+// does not spend an inode and a partly used filesystem block on each. A pack is
+// the concatenation of chunks exactly as they would be stored in chunk files;
+// its index, written after it, maps each chunk hash to its offset and length.
+// Both are written once and never modified: garbage collection moves live
+// chunks into new packs and removes the old ones.
+const (
+	chunkPackExt      = ".pack"
+	chunkPackIndexExt = ".idx"
+)
+
+// ChunkPackDirectory returns the directory holding chunk packs and their indexes
+func ChunkPackDirectory(basePath string) string {
+	return filepath.Join(basePath, ".sietch", "chunkpacks")
+}
+
+// ChunkPackPath returns the absolute path of a chunk pack
+func ChunkPackPath(basePath string, packID string) string {
+	return filepath.Join(ChunkPackDirectory(basePath), packID+chunkPackExt)
+}
+
+// ChunkPackIndexPath returns the absolute path of a chunk pack's index
+func ChunkPackIndexPath(basePath string, packID string) string {
+	return filepath.Join(ChunkPackDirectory(basePath), packID+chunkPackIndexExt)
+}
+
+// ChunkPackRelPath returns the slash-separated path of a chunk pack relative to
+// the vault root, suitable for staging through an atomic transaction
+func ChunkPackRelPath(packID string) string {
+	return filepath.ToSlash(filepath.Join(".sietch", "chunkpacks", packID+chunkPackExt))
+}
+
+// ChunkPackIndexRelPath is ChunkPackRelPath for the pack's index
+func ChunkPackIndexRelPath(packID string) string {
+	return filepath.ToSlash(filepath.Join(".sietch", "chunkpacks", packID+chunkPackIndexExt))
+}
+
+// ChunkPackEntry locates one chunk in a chunk pack
+type ChunkPackEntry struct {
+	Hash   string `yaml:"hash"`   // Storage key of the chunk
+	Offset int64  `yaml:"offset"` // Offset of the chunk in the pack
+	Length int64  `yaml:"length"` // Length of the stored chunk
+}
+
+// chunkPackIndex is the content of a chunk pack's index file
+type chunkPackIndex struct {
+	Chunks []ChunkPackEntry `yaml:"chunks"`
+}
+
+// EncodeChunkPackIndex returns the index file content for a pack's entries
+func EncodeChunkPackIndex(entries []ChunkPackEntry) ([]byte, error) {
+	return yaml.Marshal(&chunkPackIndex{Chunks: entries})
+}
+
+// ReadChunkPackIndex returns the entries of a chunk pack
+func ReadChunkPackIndex(basePath string, packID string) ([]ChunkPackEntry, error) {
+	data, err := os.ReadFile(ChunkPackIndexPath(basePath, packID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index of chunk pack %s: %w", packID, err)
+	}
+	var index chunkPackIndex
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index of chunk pack %s: %w", packID, err)
+	}
+	return index.Chunks, nil
+}
+
+// ListChunkPackIDs returns the IDs of the chunk packs of the vault. A pack only
+// counts once its index is written.
+func ListChunkPackIDs(basePath string) ([]string, error) {
+	entries, err := os.ReadDir(ChunkPackDirectory(basePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read chunk packs directory: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), chunkPackIndexExt); ok && !entry.IsDir() && !isTempFile(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// chunkPackCacheEntry remembers the chunks of a vault's packs together with the
+// pack IDs they were read from. Packs are never modified, so the same IDs mean
+// the same chunks.
+type chunkPackCacheEntry struct {
+	ids    string
+	chunks map[string]ChunkLocation
+}
+
+var chunkPackCache sync.Map // vault root -> chunkPackCacheEntry
+
+// packedChunks returns where each chunk in the vault's chunk packs is, reading
+// the indexes again only when packs were added or removed. Packs whose index
+// cannot be read are skipped; fsck reports them.
+func packedChunks(basePath string) map[string]ChunkLocation {
+	ids, err := ListChunkPackIDs(basePath)
+	if err != nil || len(ids) == 0 {
+		return nil
+	}
+	key := strings.Join(ids, ",")
+	if cached, ok := chunkPackCache.Load(basePath); ok {
+		if entry := cached.(chunkPackCacheEntry); entry.ids == key {
+			return entry.chunks
+		}
+	}
+
+	chunks := make(map[string]ChunkLocation)
+	for _, id := range ids {
+		entries, err := ReadChunkPackIndex(basePath, id)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			// A chunk packed twice is read from the first pack listing it
+			if _, ok := chunks[e.Hash]; !ok {
+				chunks[e.Hash] = ChunkLocation{Path: ChunkPackPath(basePath, id), Pack: id, Offset: e.Offset, Length: e.Length}
+			}
+		}
+	}
+	chunkPackCache.Store(basePath, chunkPackCacheEntry{ids: key, chunks: chunks})
+	return chunks
+}
+
+// PackedChunkHashes returns the hashes of the chunks held in chunk packs
+func PackedChunkHashes(basePath string) []string {
+	chunks := packedChunks(basePath)
+	hashes := make([]string, 0, len(chunks))
+	for hash := range chunks {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// ChunkLocation is where a stored chunk is: a chunk file of its own, or a range
+// of a chunk pack
+type ChunkLocation struct {
+	Path   string // The chunk file, or the chunk pack holding the chunk
+	Pack   string // ID of the chunk pack, or "" for a chunk file
+	Offset int64  // Offset of the chunk in its pack
+	Length int64  // Length of the chunk in its pack
+}
+
+// Packed reports whether the chunk is held in a chunk pack
+func (l ChunkLocation) Packed() bool {
+	return l.Pack != ""
+}
+
+// Read returns the stored chunk
+func (l ChunkLocation) Read() ([]byte, error) {
+	if !l.Packed() {
+		return os.ReadFile(l.Path)
+	}
+	if l.Offset < 0 || l.Length < 0 {
+		return nil, fmt.Errorf("chunk pack %s: entry at offset %d (length %d) is out of range", l.Pack, l.Offset, l.Length)
+	}
+	f, err := os.Open(l.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, l.Length)
+	if _, err := f.ReadAt(data, l.Offset); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("chunk pack %s is truncated", l.Pack)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Size returns the stored size of the chunk
+func (l ChunkLocation) Size() (int64, error) {
+	if l.Packed() {
+		return l.Length, nil
+	}
+	info, err := os.Stat(l.Path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,55 @@
+package layout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dictionaryPrefix starts the file name of every compression dictionary. Sync
+// requests a dictionary by its file name, which cannot be mistaken for a chunk
+// hash or pack ID.
+const dictionaryPrefix = "dict-"
+
+// DictionaryDirectory returns the directory holding compression dictionaries
+func DictionaryDirectory(basePath string) string {
+	return filepath.Join(basePath, ".sietch", "compression")
+}
+
+// DictionaryName returns the file name of a compression dictionary
+func DictionaryName(id string) string {
+	return dictionaryPrefix + id
+}
+
+// DictionaryIDFromName returns the dictionary ID a file name stands for
+func DictionaryIDFromName(name string) (string, bool) {
+	id, ok := strings.CutPrefix(name, dictionaryPrefix)
+	return id, ok && id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+// DictionaryPath returns the absolute path of a compression dictionary
+func DictionaryPath(basePath string, id string) string {
+	return filepath.Join(DictionaryDirectory(basePath), DictionaryName(id))
+}
+
+// ListDictionaryIDs returns the IDs of all compression dictionaries stored in the vault
+func ListDictionaryIDs(basePath string) ([]string, error) {
+	entries, err := os.ReadDir(DictionaryDirectory(basePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read compression directory: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if id, ok := DictionaryIDFromName(entry.Name()); ok && !entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
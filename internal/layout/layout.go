@@ -0,0 +1,408 @@
+// Package layout resolves where chunks live on disk for the vault's chunk storage layout.
+package layout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// TempFilePrefix starts the name of a file still being written into the chunk
+// store. Such files are renamed to their final name once complete, and are never
+// listed as chunks.
+const TempFilePrefix = ".tmp-"
+
+// layoutCacheEntry remembers the layout read from vault.yaml together with
+// the file's modification time so that edits (e.g. after a migration) are seen
+type layoutCacheEntry struct {
+	modTime     time.Time
+	layout      int
+	sharedStore string
+}
+
+var layoutCache sync.Map // vault root -> layoutCacheEntry
+
+// Version returns the chunk storage layout recorded in the vault's vault.yaml.
+// Vaults created before layouts were versioned (or without a vault.yaml) use the flat layout.
+func Version(basePath string) int {
+	return readVaultLayout(basePath).layout
+}
+
+// SharedStore returns the shared chunk store configured in the vault's vault.yaml,
+// or "" when the vault keeps its chunks in .sietch/chunks
+func SharedStore(basePath string) string {
+	return readVaultLayout(basePath).sharedStore
+}
+
+// readVaultLayout reads the storage settings from vault.yaml, caching them until the file changes
+func readVaultLayout(basePath string) layoutCacheEntry {
+	configPath := filepath.Join(basePath, "vault.yaml")
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return layoutCacheEntry{layout: constants.ChunkLayoutFlat}
+	}
+
+	if cached, ok := layoutCache.Load(basePath); ok {
+		entry := cached.(layoutCacheEntry)
+		if entry.modTime.Equal(info.ModTime()) {
+			return entry
+		}
+	}
+
+	entry := layoutCacheEntry{modTime: info.ModTime(), layout: constants.ChunkLayoutFlat}
+	data, err := os.ReadFile(configPath)
+	if err == nil {
+		var partial struct {
+			Chunking struct {
+				LayoutVersion int `yaml:"layout_version"`
+			} `yaml:"chunking"`
+			SharedStore struct {
+				Path string `yaml:"path"`
+			} `yaml:"shared_store"`
+		}
+		if yaml.Unmarshal(data, &partial) == nil {
+			if v := partial.Chunking.LayoutVersion; v == constants.ChunkLayoutSharded || v == constants.ChunkLayoutNested {
+				entry.layout = v
+			}
+			entry.sharedStore = partial.SharedStore.Path
+		}
+	}
+
+	layoutCache.Store(basePath, entry)
+	return entry
+}
+
+// chunkDirectory returns the root of the chunk store: the vault's own chunk
+// directory, or the chunk directory of its shared store
+func chunkDirectory(basePath string) string {
+	if store := SharedStore(basePath); store != "" {
+		return SharedChunkDirectory(store)
+	}
+	return LocalChunkDirectory(basePath)
+}
+
+// LocalChunkDirectory returns the vault's own chunk directory, ignoring any shared store
+func LocalChunkDirectory(basePath string) string {
+	return filepath.Join(basePath, ".sietch", "chunks")
+}
+
+// SharedChunkDirectory returns the chunk directory of a shared store
+func SharedChunkDirectory(storePath string) string {
+	return filepath.Join(storePath, constants.SharedStoreChunksDir)
+}
+
+// SharedChunkPath returns where a chunk lives in a shared store, which always uses the sharded layout
+func SharedChunkPath(storePath string, chunkHash string) string {
+	return filepath.Join(SharedChunkDirectory(storePath), chunkRelPathForLayout(chunkHash, constants.ChunkLayoutSharded))
+}
+
+// storageLayout returns the layout new chunks are written in
+func storageLayout(basePath string) int {
+	entry := readVaultLayout(basePath)
+	if entry.sharedStore != "" {
+		return constants.ChunkLayoutSharded
+	}
+	return entry.layout
+}
+
+// layouts lists every chunk layout, in the order LocateChunk falls back through them
+var layouts = []int{constants.ChunkLayoutFlat, constants.ChunkLayoutSharded, constants.ChunkLayoutNested}
+
+// layoutNames names the chunk layouts, as given to 'sietch init --chunk-layout'
+var layoutNames = map[string]int{
+	"flat":    constants.ChunkLayoutFlat,
+	"sharded": constants.ChunkLayoutSharded,
+	"nested":  constants.ChunkLayoutNested,
+}
+
+// Parse returns the layout a name stands for
+func Parse(name string) (int, error) {
+	if layout, ok := layoutNames[name]; ok {
+		return layout, nil
+	}
+	return 0, fmt.Errorf("unknown chunk layout %q (use flat, sharded or nested)", name)
+}
+
+// Name returns the name of a layout, as Parse reads it
+func Name(layout int) string {
+	for name, l := range layoutNames {
+		if l == layout {
+			return name
+		}
+	}
+	return fmt.Sprintf("layout %d", layout)
+}
+
+// Valid reports whether layout is one chunks can be stored in
+func Valid(layout int) bool {
+	return slices.Contains(layouts, layout)
+}
+
+// chunkRelPathForLayout returns the chunk location relative to the chunks directory
+func chunkRelPathForLayout(chunkHash string, layout int) string {
+	n := constants.ChunkShardPrefixLength
+	switch {
+	case layout == constants.ChunkLayoutNested && len(chunkHash) > 2*n:
+		return filepath.Join(chunkHash[:n], chunkHash[n:2*n], chunkHash)
+	case layout >= constants.ChunkLayoutSharded && len(chunkHash) > n:
+		return filepath.Join(chunkHash[:n], chunkHash)
+	}
+	return chunkHash
+}
+
+// ChunkPath returns the absolute path where a chunk is written under the vault's current layout.
+// All chunk path construction should go through this helper (or ChunkRelPath/LocateChunk).
+func ChunkPath(basePath string, chunkHash string) string {
+	return filepath.Join(chunkDirectory(basePath), chunkRelPathForLayout(chunkHash, storageLayout(basePath)))
+}
+
+// ChunkRelPath returns the slash-separated chunk path relative to the vault root,
+// suitable for staging through an atomic transaction. Chunks in a shared store live
+// outside the vault and are written directly instead.
+func ChunkRelPath(basePath string, chunkHash string) string {
+	rel := filepath.Join(".sietch", "chunks", chunkRelPathForLayout(chunkHash, Version(basePath)))
+	return filepath.ToSlash(rel)
+}
+
+// LocateChunk finds an existing chunk, checking the vault's current layout first and
+// falling back to the other layouts so partially migrated vaults remain readable,
+// then to the vault's chunk packs. A missing chunk is located where it would be written.
+func LocateChunk(basePath string, chunkHash string) (ChunkLocation, bool) {
+	path, ok := locateIn(chunkDirectory(basePath), chunkHash, storageLayout(basePath))
+	if ok {
+		return ChunkLocation{Path: path}, true
+	}
+	if loc, ok := packedChunks(basePath)[chunkHash]; ok {
+		return loc, true
+	}
+	return ChunkLocation{Path: path}, false
+}
+
+// LocalChunkPath returns where a chunk is written in the vault's own chunk
+// directory under its layout, ignoring any shared store
+func LocalChunkPath(basePath string, chunkHash string) string {
+	return filepath.Join(LocalChunkDirectory(basePath), chunkRelPathForLayout(chunkHash, Version(basePath)))
+}
+
+// LocateLocalChunk is LocateChunk in the vault's own chunk directory, ignoring
+// any shared store
+func LocateLocalChunk(basePath string, chunkHash string) (string, bool) {
+	return locateIn(LocalChunkDirectory(basePath), chunkHash, Version(basePath))
+}
+
+// locateIn finds a chunk in a chunk directory, in layout first and then in the others
+func locateIn(chunksDir string, chunkHash string, layout int) (string, bool) {
+	primary := filepath.Join(chunksDir, chunkRelPathForLayout(chunkHash, layout))
+	if _, err := os.Stat(primary); err == nil {
+		return primary, true
+	}
+
+	for _, other := range layouts {
+		candidate := filepath.Join(chunksDir, chunkRelPathForLayout(chunkHash, other))
+		if candidate == primary {
+			continue
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+
+	return primary, false
+}
+
+// ListChunkHashes returns the hashes of all chunks stored in the vault, in any
+// layout or in chunk packs
+func ListChunkHashes(basePath string) ([]string, error) {
+	hashes, err := ListChunkHashesIn(chunkDirectory(basePath))
+	if err != nil {
+		return nil, err
+	}
+	if packed := PackedChunkHashes(basePath); len(packed) > 0 {
+		hashes = append(hashes, packed...)
+		sort.Strings(hashes)
+		hashes = slices.Compact(hashes)
+	}
+	return hashes, nil
+}
+
+// ListChunkHashesIn returns the hashes of all chunks in a chunk directory, in any layout
+func ListChunkHashesIn(chunksDir string) ([]string, error) {
+	stored, err := storedChunks(chunksDir)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(stored))
+	for _, chunk := range stored {
+		hashes = append(hashes, chunk.hash)
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// storedChunk is a chunk file found in a chunk directory
+type storedChunk struct {
+	hash string
+	rel  string // Path relative to the chunk directory
+}
+
+// storedChunks lists the chunk files of a chunk directory and of its shard
+// directories, down to the depth of the nested layout
+func storedChunks(chunksDir string) ([]storedChunk, error) {
+	var stored []storedChunk
+	var walk func(rel string, depth int) error
+	walk = func(rel string, depth int) error {
+		entries, err := os.ReadDir(filepath.Join(chunksDir, rel))
+		if err != nil {
+			if rel == "" && os.IsNotExist(err) {
+				return nil
+			}
+			if rel == "" {
+				return fmt.Errorf("failed to read chunks directory: %w", err)
+			}
+			return fmt.Errorf("failed to read shard directory %s: %w", filepath.ToSlash(rel), err)
+		}
+		for _, entry := range entries {
+			entryRel := filepath.Join(rel, entry.Name())
+			switch {
+			case entry.IsDir():
+				if depth < 2 {
+					if err := walk(entryRel, depth+1); err != nil {
+						return err
+					}
+				}
+			case !isTempFile(entry.Name()):
+				stored = append(stored, storedChunk{hash: entry.Name(), rel: entryRel})
+			}
+		}
+		return nil
+	}
+	if err := walk("", 0); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// MisplacedChunks returns the hashes of the chunks of the vault that are not
+// where the layout puts them, as left by a vault created in another layout
+func MisplacedChunks(basePath string, layout int) ([]string, error) {
+	stored, err := storedChunks(chunkDirectory(basePath))
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, chunk := range stored {
+		if chunk.rel != chunkRelPathForLayout(chunk.hash, layout) {
+			hashes = append(hashes, chunk.hash)
+		}
+	}
+	sort.Strings(hashes)
+	return slices.Compact(hashes), nil
+}
+
+// ChunkRelPathIn returns where the layout puts a chunk, relative to the chunk directory
+func ChunkRelPathIn(chunkHash string, layout int) string {
+	return filepath.ToSlash(chunkRelPathForLayout(chunkHash, layout))
+}
+
+// FlatChunkHashes returns the hashes of chunks still stored in the legacy flat layout
+func FlatChunkHashes(basePath string) ([]string, error) {
+	entries, err := os.ReadDir(chunkDirectory(basePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read chunks directory: %w", err)
+	}
+
+	var hashes []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !isTempFile(entry.Name()) {
+			hashes = append(hashes, entry.Name())
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// isTempFile reports whether a file in the chunk store is an incomplete write
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, TempFilePrefix)
+}
+
+// ShardChunk moves a chunk stored in the flat layout into its shard directory
+func ShardChunk(basePath string, chunkHash string) error {
+	chunksDir := chunkDirectory(basePath)
+	return moveChunk(chunksDir, chunkHash, chunkHash, constants.ChunkLayoutSharded)
+}
+
+// MoveChunk moves a chunk of the vault, wherever it is stored, to where the
+// layout puts it
+func MoveChunk(basePath string, chunkHash string, layout int) error {
+	chunksDir := chunkDirectory(basePath)
+	dst := filepath.Join(chunksDir, chunkRelPathForLayout(chunkHash, layout))
+	for _, other := range layouts {
+		src := chunkRelPathForLayout(chunkHash, other)
+		if filepath.Join(chunksDir, src) == dst {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(chunksDir, src)); err == nil {
+			if err := moveChunk(chunksDir, chunkHash, src, layout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveChunk moves the chunk stored at src, relative to the chunk directory, to
+// where the layout puts it
+func moveChunk(chunksDir string, chunkHash string, src string, layout int) error {
+	from := filepath.Join(chunksDir, src)
+	dst := filepath.Join(chunksDir, chunkRelPathForLayout(chunkHash, layout))
+	if from == dst {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), constants.StandardDirPerms); err != nil {
+		return fmt.Errorf("failed to create shard directory for %s: %w", chunkHash, err)
+	}
+
+	// If the chunk already exists in its shard (e.g. an interrupted migration), drop the other copy
+	if _, err := os.Stat(dst); err == nil {
+		return os.Remove(from)
+	}
+
+	if err := os.Rename(from, dst); err != nil {
+		return fmt.Errorf("failed to move chunk %s: %w", chunkHash, err)
+	}
+	return nil
+}
+
+// RemoveEmptyShards removes the shard directories of a chunk directory that
+// moving chunks out of them left empty
+func RemoveEmptyShards(chunksDir string) {
+	entries, _ := os.ReadDir(chunksDir)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		shard := filepath.Join(chunksDir, entry.Name())
+		inner, _ := os.ReadDir(shard)
+		for _, sub := range inner {
+			if sub.IsDir() {
+				_ = os.Remove(filepath.Join(shard, sub.Name()))
+			}
+		}
+		// Non-empty directories fail to remove
+		_ = os.Remove(shard)
+	}
+}
@@ -0,0 +1,286 @@
+package layout
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+func writeVaultYAML(t *testing.T, root string, layoutVersion int) {
+	t.Helper()
+	content := "name: test\nchunking:\n  strategy: fixed\n"
+	if layoutVersion > 0 {
+		content += "  layout_version: " + string(rune('0'+layoutVersion)) + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(root, "vault.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write vault.yaml: %v", err)
+	}
+	if err := os.MkdirAll(chunkDirectory(root), 0o755); err != nil {
+		t.Fatalf("failed to create chunks dir: %v", err)
+	}
+}
+
+func TestChunkPath(t *testing.T) {
+	hash := "abcdef0123456789"
+
+	tests := []struct {
+		name          string
+		layoutVersion int
+		wantRel       string
+	}{
+		{"legacy vault without layout version", 0, ".sietch/chunks/abcdef0123456789"},
+		{"flat layout", 1, ".sietch/chunks/abcdef0123456789"},
+		{"sharded layout", 2, ".sietch/chunks/ab/abcdef0123456789"},
+		{"nested layout", 3, ".sietch/chunks/ab/cd/abcdef0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeVaultYAML(t, root, tt.layoutVersion)
+
+			if got := ChunkRelPath(root, hash); got != tt.wantRel {
+				t.Errorf("ChunkRelPath() = %q, want %q", got, tt.wantRel)
+			}
+			if got, want := ChunkPath(root, hash), filepath.Join(root, filepath.FromSlash(tt.wantRel)); got != want {
+				t.Errorf("ChunkPath() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLocateChunkAndMigration(t *testing.T) {
+	root := t.TempDir()
+	writeVaultYAML(t, root, 2)
+
+	// A chunk left over in the flat layout must still be found
+	flatHash := "ff00aa11"
+	if err := os.WriteFile(filepath.Join(chunkDirectory(root), flatHash), []byte("flat"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	shardedHash := "0b1c2d3e"
+	if err := os.MkdirAll(filepath.Dir(ChunkPath(root, shardedHash)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ChunkPath(root, shardedHash), []byte("sharded"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range []string{flatHash, shardedHash} {
+		if _, ok := LocateChunk(root, hash); !ok {
+			t.Errorf("LocateChunk(%s) did not find chunk", hash)
+		}
+	}
+	if _, ok := LocateChunk(root, "deadbeef"); ok {
+		t.Errorf("LocateChunk() found a chunk that does not exist")
+	}
+
+	hashes, err := ListChunkHashes(root)
+	if err != nil {
+		t.Fatalf("ListChunkHashes() error: %v", err)
+	}
+	if len(hashes) != 2 {
+		t.Errorf("ListChunkHashes() = %v, want 2 hashes", hashes)
+	}
+
+	flat, err := FlatChunkHashes(root)
+	if err != nil || len(flat) != 1 || flat[0] != flatHash {
+		t.Fatalf("FlatChunkHashes() = %v, %v; want [%s]", flat, err, flatHash)
+	}
+
+	if err := ShardChunk(root, flatHash); err != nil {
+		t.Fatalf("ShardChunk() error: %v", err)
+	}
+	loc, ok := LocateChunk(root, flatHash)
+	if !ok || loc.Path != filepath.Join(chunkDirectory(root), "ff", flatHash) {
+		t.Errorf("after ShardChunk, LocateChunk() = %q, %v", loc.Path, ok)
+	}
+	if flat, _ := FlatChunkHashes(root); len(flat) != 0 {
+		t.Errorf("FlatChunkHashes() after migration = %v, want none", flat)
+	}
+}
+
+func TestSharedStoreChunkPath(t *testing.T) {
+	root := t.TempDir()
+	store := t.TempDir()
+	content := "name: test\nchunking:\n  layout_version: 1\nshared_store:\n  path: " + store + "\n"
+	if err := os.WriteFile(filepath.Join(root, "vault.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := SharedStore(root); got != store {
+		t.Fatalf("SharedStore() = %q, want %q", got, store)
+	}
+	// Shared chunks are always sharded, whatever the vault's own layout
+	want := filepath.Join(store, "chunks", "ab", "abcdef0123456789")
+	if got := ChunkPath(root, "abcdef0123456789"); got != want {
+		t.Errorf("ChunkPath() = %q, want %q", got, want)
+	}
+	if got := LocalChunkDirectory(root); got != filepath.Join(root, ".sietch", "chunks") {
+		t.Errorf("LocalChunkDirectory() = %q", got)
+	}
+}
+
+// TestMigrateToNestedLayout ensures chunks left flat or in one shard level are
+// found, listed and moved into the nested layout, and that the migration can
+// go back to the sharded one
+func TestMigrateToNestedLayout(t *testing.T) {
+	root := t.TempDir()
+	writeVaultYAML(t, root, 2)
+	chunksDir := chunkDirectory(root)
+
+	stored := map[string]string{
+		"ff00aa11": "ff00aa11",              // flat
+		"0b1c2d3e": "0b/0b1c2d3e",           // sharded
+		"9a8b7c6d": "9a/8b/9a8b7c6d",        // already nested
+		"7e":       "7e",                    // too short to shard
+		"abcd5555": "ab/.tmp-abcd5555.1234", // still being written
+	}
+	for hash, rel := range stored {
+		path := filepath.Join(chunksDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(hash), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hashes, err := ListChunkHashes(root)
+	if err != nil {
+		t.Fatalf("ListChunkHashes() error: %v", err)
+	}
+	if want := []string{"0b1c2d3e", "7e", "9a8b7c6d", "ff00aa11"}; !slices.Equal(hashes, want) {
+		t.Errorf("ListChunkHashes() = %v, want %v", hashes, want)
+	}
+	for _, hash := range hashes {
+		if _, ok := LocateChunk(root, hash); !ok {
+			t.Errorf("LocateChunk(%s) did not find the chunk", hash)
+		}
+	}
+
+	misplaced, err := MisplacedChunks(root, constants.ChunkLayoutNested)
+	if err != nil {
+		t.Fatalf("MisplacedChunks() error: %v", err)
+	}
+	if want := []string{"0b1c2d3e", "ff00aa11"}; !slices.Equal(misplaced, want) {
+		t.Fatalf("MisplacedChunks(nested) = %v, want %v", misplaced, want)
+	}
+	for _, hash := range misplaced {
+		if err := MoveChunk(root, hash, constants.ChunkLayoutNested); err != nil {
+			t.Fatalf("MoveChunk(%s) error: %v", hash, err)
+		}
+	}
+	writeVaultYAML(t, root, 3)
+	for _, hash := range hashes {
+		loc, ok := LocateChunk(root, hash)
+		if want := filepath.Join(chunksDir, ChunkRelPathIn(hash, constants.ChunkLayoutNested)); !ok || loc.Path != want {
+			t.Errorf("after migrating, LocateChunk(%s) = %q, %v; want %q", hash, loc.Path, ok, want)
+		}
+	}
+	if misplaced, _ := MisplacedChunks(root, constants.ChunkLayoutNested); len(misplaced) != 0 {
+		t.Errorf("MisplacedChunks() after migrating = %v, want none", misplaced)
+	}
+
+	// Back to one shard level; the emptied second level directories go
+	misplaced, _ = MisplacedChunks(root, constants.ChunkLayoutSharded)
+	for _, hash := range misplaced {
+		if err := MoveChunk(root, hash, constants.ChunkLayoutSharded); err != nil {
+			t.Fatalf("MoveChunk(%s) error: %v", hash, err)
+		}
+	}
+	RemoveEmptyShards(chunksDir)
+	if _, err := os.Stat(filepath.Join(chunksDir, "9a", "8b")); !os.IsNotExist(err) {
+		t.Errorf("emptied shard directory 9a/8b was kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chunksDir, "9a", "9a8b7c6d")); err != nil {
+		t.Errorf("chunk not moved back to the sharded layout: %v", err)
+	}
+}
+
+// writeChunkPack writes a chunk pack holding the given chunks in order
+func writeChunkPack(t *testing.T, root, id string, chunks map[string]string, order ...string) {
+	t.Helper()
+	var pack []byte
+	var entries []ChunkPackEntry
+	for _, hash := range order {
+		entries = append(entries, ChunkPackEntry{Hash: hash, Offset: int64(len(pack)), Length: int64(len(chunks[hash]))})
+		pack = append(pack, chunks[hash]...)
+	}
+	index, err := EncodeChunkPackIndex(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(ChunkPackDirectory(root), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ChunkPackPath(root, id), pack, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ChunkPackIndexPath(root, id), index, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLocatePackedChunk ensures chunks in chunk packs are found, read and
+// listed, that a chunk file wins over a packed copy, and that adding or
+// removing packs is noticed
+func TestLocatePackedChunk(t *testing.T) {
+	root := t.TempDir()
+	writeVaultYAML(t, root, 2)
+	chunks := map[string]string{"aa01": "first chunk", "bb02": "second", "cc03": "third chunk"}
+	writeChunkPack(t, root, "pack1", chunks, "aa01", "bb02")
+
+	loc, ok := LocateChunk(root, "bb02")
+	if !ok || !loc.Packed() || loc.Pack != "pack1" || loc.Offset != int64(len(chunks["aa01"])) {
+		t.Fatalf("LocateChunk(bb02) = %+v, %v", loc, ok)
+	}
+	if data, err := loc.Read(); err != nil || string(data) != chunks["bb02"] {
+		t.Errorf("Read() = %q, %v; want %q", data, err, chunks["bb02"])
+	}
+	if size, err := loc.Size(); err != nil || size != int64(len(chunks["bb02"])) {
+		t.Errorf("Size() = %d, %v", size, err)
+	}
+
+	// A chunk file is found before the packed copy
+	if err := os.MkdirAll(filepath.Dir(ChunkPath(root, "aa01")), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ChunkPath(root, "aa01"), []byte(chunks["aa01"]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if loc, ok := LocateChunk(root, "aa01"); !ok || loc.Packed() || loc.Path != ChunkPath(root, "aa01") {
+		t.Errorf("LocateChunk(aa01) = %+v, %v; want the chunk file", loc, ok)
+	}
+
+	// A new pack is picked up, and the packed and loose copies are listed once
+	writeChunkPack(t, root, "pack2", chunks, "cc03")
+	hashes, err := ListChunkHashes(root)
+	if err != nil {
+		t.Fatalf("ListChunkHashes() error: %v", err)
+	}
+	if want := []string{"aa01", "bb02", "cc03"}; !slices.Equal(hashes, want) {
+		t.Errorf("ListChunkHashes() = %v, want %v", hashes, want)
+	}
+
+	// Removing a pack removes its chunks
+	if err := os.Remove(ChunkPackIndexPath(root, "pack1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := LocateChunk(root, "bb02"); ok {
+		t.Error("LocateChunk() found a chunk of a removed pack")
+	}
+
+	// A truncated pack is reported rather than read short
+	if err := os.Truncate(ChunkPackPath(root, "pack2"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if loc, ok := LocateChunk(root, "cc03"); !ok {
+		t.Fatal("LocateChunk(cc03) did not find chunk")
+	} else if _, err := loc.Read(); err == nil {
+		t.Error("Read() of a truncated pack succeeded")
+	}
+}
@@ -0,0 +1,51 @@
+package layout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackDirectory returns the directory holding small-file pack blobs
+func PackDirectory(basePath string) string {
+	return filepath.Join(basePath, ".sietch", "packs")
+}
+
+// PackPath returns the absolute path of a pack blob
+func PackPath(basePath string, packID string) string {
+	return filepath.Join(PackDirectory(basePath), packID)
+}
+
+// ValidPackID reports whether a pack ID is a plain file name, so its pack
+// stays in the packs directory. Pack IDs come from peers and bundles too.
+func ValidPackID(packID string) bool {
+	return packID != "" && !strings.HasPrefix(packID, ".") && !strings.ContainsAny(packID, `/\:`)
+}
+
+// PackRelPath returns the slash-separated pack path relative to the vault root,
+// suitable for staging through an atomic transaction
+func PackRelPath(packID string) string {
+	return filepath.ToSlash(filepath.Join(".sietch", "packs", packID))
+}
+
+// ListPackIDs returns the IDs of all pack blobs stored in the vault
+func ListPackIDs(basePath string) ([]string, error) {
+	entries, err := os.ReadDir(PackDirectory(basePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read packs directory: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
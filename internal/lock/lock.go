@@ -0,0 +1,188 @@
+// Package lock keeps sietch processes from changing a vault at the same time.
+//
+// Every command that writes to a vault locks .sietch/lock exclusively, so no
+// two writers run at once. Commands that only read do not lock and run next to
+// a writer; the shared mode is for checking, without waiting, whether a writer
+// holds the vault. The lock is an advisory file lock held through an open
+// file, so the operating system drops it when the process exits, however it
+// exits.
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Mode is how a vault is locked
+type Mode int
+
+const (
+	// Shared lets other shared holders hold the lock at the same time
+	Shared Mode = iota + 1
+	// Exclusive keeps every other process out
+	Exclusive
+)
+
+// ErrLocked is returned when another process holds the lock in a conflicting mode
+var ErrLocked = errors.New("vault is in use by another sietch process")
+
+var (
+	errWouldBlock  = errors.New("lock held elsewhere")
+	errUnsupported = errors.New("file locks not supported")
+)
+
+// pollInterval is how often AcquireWait tries the lock again
+var pollInterval = 100 * time.Millisecond
+
+// Record is what the lock file says about the process holding the vault
+// exclusively
+type Record struct {
+	Command string
+	PID     int
+	Host    string
+	Since   time.Time
+}
+
+// Lock is a held vault lock
+type Lock struct {
+	file *os.File
+	mode Mode
+}
+
+// Path returns the vault's lock file
+func Path(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "lock")
+}
+
+// Acquire locks the vault in mode without waiting. If another process holds a
+// conflicting lock it returns an error wrapping ErrLocked that names the
+// holder when it is known. holder describes this process to others while it
+// holds the lock exclusively, e.g. "sietch add". On filesystems that do not
+// support file locks the vault is not locked and a Lock that does nothing is
+// returned.
+func Acquire(vaultRoot string, mode Mode, holder string) (*Lock, error) {
+	file, err := os.OpenFile(Path(vaultRoot), os.O_RDWR|os.O_CREATE, constants.StandardFilePerms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vault lock: %v", err)
+	}
+	switch err := lockFile(file, mode); {
+	case errors.Is(err, errWouldBlock):
+		file.Close()
+		if who := Holder(vaultRoot); who != "" {
+			return nil, fmt.Errorf("%w (%s)", ErrLocked, who)
+		}
+		return nil, ErrLocked
+	case errors.Is(err, errUnsupported):
+		file.Close()
+		return &Lock{}, nil
+	case err != nil:
+		file.Close()
+		return nil, fmt.Errorf("failed to lock vault: %v", err)
+	}
+
+	if mode == Exclusive {
+		// Readers never write the file, so what it says is about the writer
+		host, _ := os.Hostname()
+		if err := file.Truncate(0); err == nil {
+			record := fmt.Sprintf("%s, pid %d on %s since %s\n", holder, os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))
+			_, _ = file.WriteAt([]byte(record), 0)
+		}
+	}
+	return &Lock{file: file, mode: mode}, nil
+}
+
+// AcquireWait is Acquire, but while another process holds a conflicting lock
+// it keeps trying for up to timeout before giving up
+func AcquireWait(vaultRoot string, mode Mode, holder string, timeout time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		l, err := Acquire(vaultRoot, mode, holder)
+		if !errors.Is(err, ErrLocked) || !time.Now().Before(deadline) {
+			return l, err
+		}
+		time.Sleep(min(pollInterval, time.Until(deadline)))
+	}
+}
+
+// Holder describes the process that last held the vault exclusively, or
+// returns "" when unknown
+func Holder(vaultRoot string) string {
+	data, err := os.ReadFile(Path(vaultRoot))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ReadRecord parses the lock file. It returns false when no process has
+// recorded itself, or the record is not one Acquire wrote.
+func ReadRecord(vaultRoot string) (Record, bool) {
+	holder := Holder(vaultRoot)
+	i := strings.LastIndex(holder, ", pid ")
+	if i < 0 {
+		return Record{}, false
+	}
+	record := Record{Command: holder[:i]}
+	var since string
+	if _, err := fmt.Sscanf(holder[i:], ", pid %d on %s since %s", &record.PID, &record.Host, &since); err != nil {
+		return Record{}, false
+	}
+	record.Since, _ = time.Parse(time.RFC3339, since)
+	return record, true
+}
+
+// Release unlocks the vault. It is safe to call more than once.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	if l.mode == Exclusive {
+		_ = l.file.Truncate(0)
+	}
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// Break removes the lock file, so the next Acquire succeeds whatever process
+// holds the lock now. It is meant for locks left behind by a process that
+// hangs or runs on another host sharing the vault.
+func Break(vaultRoot string) error {
+	if err := os.Remove(Path(vaultRoot)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove vault lock: %v", err)
+	}
+	return nil
+}
+
+// BreakStale breaks the vault lock only when the process recorded as holding
+// it is known to be gone: it ran on this host and no process with its PID is
+// left. A free lock is left alone. It returns the record of the holder.
+func BreakStale(vaultRoot string) (Record, error) {
+	if l, err := Acquire(vaultRoot, Exclusive, "sietch vault unlock"); err == nil {
+		return Record{}, l.Release()
+	} else if !errors.Is(err, ErrLocked) {
+		return Record{}, err
+	}
+
+	record, ok := ReadRecord(vaultRoot)
+	if !ok {
+		return record, fmt.Errorf("%w by readers or a process that did not record itself", ErrLocked)
+	}
+	if host, _ := os.Hostname(); record.Host != host {
+		return record, fmt.Errorf("%w (%s, pid %d on %s): cannot tell whether a process on another host is still running",
+			ErrLocked, record.Command, record.PID, record.Host)
+	}
+	if processAlive(record.PID) {
+		return record, fmt.Errorf("%w (%s, pid %d is still running)", ErrLocked, record.Command, record.PID)
+	}
+	return record, Break(vaultRoot)
+}
@@ -0,0 +1,174 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newVault(t *testing.T) string {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return vaultRoot
+}
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name       string
+		held, want Mode
+		wantErr    bool
+	}{
+		{name: "readers share", held: Shared, want: Shared},
+		{name: "writer waits for readers", held: Shared, want: Exclusive, wantErr: true},
+		{name: "reader waits for writer", held: Exclusive, want: Shared, wantErr: true},
+		{name: "one writer at a time", held: Exclusive, want: Exclusive, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultRoot := newVault(t)
+			held, err := Acquire(vaultRoot, tt.held, "sietch add")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer held.Release()
+
+			l, err := Acquire(vaultRoot, tt.want, "sietch get")
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Acquire() error: %v", err)
+				}
+				l.Release()
+				return
+			}
+			if !errors.Is(err, ErrLocked) {
+				t.Fatalf("Acquire() error = %v, want ErrLocked", err)
+			}
+			if tt.held == Exclusive && !strings.Contains(err.Error(), "sietch add, pid") {
+				t.Errorf("Acquire() error = %v, want it to name the holder", err)
+			}
+
+			// Released, the lock is free again
+			if err := held.Release(); err != nil {
+				t.Fatal(err)
+			}
+			if l, err = Acquire(vaultRoot, tt.want, "sietch get"); err != nil {
+				t.Fatalf("Acquire() after Release() error: %v", err)
+			}
+			l.Release()
+		})
+	}
+}
+
+func TestBreak(t *testing.T) {
+	vaultRoot := newVault(t)
+	stale, err := Acquire(vaultRoot, Exclusive, "sietch add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stale.Release()
+
+	if err := Break(vaultRoot); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Acquire(vaultRoot, Exclusive, "sietch delete")
+	if err != nil {
+		t.Fatalf("Acquire() after Break() error: %v", err)
+	}
+	if holder := Holder(vaultRoot); !strings.HasPrefix(holder, "sietch delete") {
+		t.Errorf("Holder() = %q", holder)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if holder := Holder(vaultRoot); holder != "" {
+		t.Errorf("Holder() after Release() = %q, want empty", holder)
+	}
+}
+
+func TestAcquireWait(t *testing.T) {
+	vaultRoot := newVault(t)
+	held, err := Acquire(vaultRoot, Exclusive, "sietch add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	if _, err := AcquireWait(vaultRoot, Exclusive, "sietch delete", 50*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("AcquireWait() on a held lock = %v, want ErrLocked after the timeout", err)
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		held.Release()
+	}()
+	l, err := AcquireWait(vaultRoot, Exclusive, "sietch delete", 10*time.Second)
+	if err != nil {
+		t.Fatalf("AcquireWait() error: %v, want the lock once released", err)
+	}
+	l.Release()
+}
+
+func TestBreakStale(t *testing.T) {
+	host, _ := os.Hostname()
+	tests := []struct {
+		name      string
+		record    string // written over the holder's record; empty keeps it
+		wantBreak bool
+	}{
+		{name: "holder running", wantBreak: false},
+		{name: "holder gone", record: "sietch add, pid 99999999 on " + host + " since 2025-01-01T00:00:00Z\n", wantBreak: true},
+		{name: "other host", record: "sietch add, pid 99999999 on elsewhere since 2025-01-01T00:00:00Z\n", wantBreak: false},
+		{name: "no record", record: "\n", wantBreak: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultRoot := newVault(t)
+			held, err := Acquire(vaultRoot, Exclusive, "sietch add")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer held.Release()
+			if tt.record != "" {
+				if err := os.WriteFile(Path(vaultRoot), []byte(tt.record), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err = BreakStale(vaultRoot)
+			if !tt.wantBreak {
+				if !errors.Is(err, ErrLocked) {
+					t.Fatalf("BreakStale() error = %v, want ErrLocked", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BreakStale() error: %v", err)
+			}
+			l, err := Acquire(vaultRoot, Exclusive, "sietch delete")
+			if err != nil {
+				t.Fatalf("Acquire() after BreakStale() error: %v", err)
+			}
+			l.Release()
+		})
+	}
+}
+
+func TestReadRecord(t *testing.T) {
+	vaultRoot := newVault(t)
+	l, err := Acquire(vaultRoot, Exclusive, "sietch vault rechunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+
+	record, ok := ReadRecord(vaultRoot)
+	if !ok || record.Command != "sietch vault rechunk" || record.PID != os.Getpid() || record.Since.IsZero() {
+		t.Errorf("ReadRecord() = %+v, %v", record, ok)
+	}
+}
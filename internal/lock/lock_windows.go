@@ -0,0 +1,50 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows locks are mandatory, so a byte far beyond the holder description is
+// locked rather than the description itself, which others still need to read
+var lockRange = windows.Overlapped{OffsetHigh: 1}
+
+func lockFile(file *os.File, mode Mode) error {
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if mode == Exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	overlapped := lockRange
+	err := windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) || errors.Is(err, windows.ERROR_IO_PENDING) {
+		return errWouldBlock
+	}
+	return err
+}
+
+// processAlive reports whether a process with the given PID is running
+func processAlive(pid int) bool {
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// Access is denied to processes of other users, which do exist
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+	defer windows.CloseHandle(process)
+	var code uint32
+	if err := windows.GetExitCodeProcess(process, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
+
+// stillActive is the exit code of a process that has not exited (STILL_ACTIVE)
+const stillActive = 259
+
+func unlockFile(file *os.File) error {
+	overlapped := lockRange
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &overlapped)
+}
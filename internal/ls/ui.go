@@ -21,11 +21,24 @@ func FormatSharedWith(list []string, limit int) string {
 	return fmt.Sprintf("%s (+%d more)", strings.Join(visible, ", "), len(list)-limit)
 }
 
+// DisplayPath returns the path shown for a file, flagging files whose chunks are missing
+func DisplayPath(file config.FileManifest) string {
+	switch {
+	case file.Damaged:
+		return file.Destination + file.FilePath + " (damaged)"
+	case file.IsSymlink():
+		return file.Destination + file.FilePath + " -> " + file.LinkTarget
+	case file.IsDir():
+		return file.Destination + file.FilePath + "/"
+	}
+	return file.Destination + file.FilePath
+}
+
 // DisplayShortFormat prints the short listing for files and optionally shows dedup stats.
 // This mirrors the previous displayShortFormat that lived in cmd/ls.go.
 func DisplayShortFormat(files []config.FileManifest, showTags, showDedup bool, chunkRefs map[string][]string) {
 	for _, file := range files {
-		path := file.Destination + file.FilePath
+		path := DisplayPath(file)
 		if showTags && len(file.Tags) > 0 {
 			tags := strings.Join(file.Tags, ", ")
 			// Print file and tags
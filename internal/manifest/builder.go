@@ -1,6 +1,7 @@
 package manifest
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,12 +9,14 @@ import (
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/substantialcattle5/sietch/internal/atomic"
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
 	"github.com/substantialcattle5/sietch/util"
 )
 
-// WriteManifest writes the vault configuration to vault.yaml
-// ensuring that any encryption keys in the config are properly stored
+// WriteManifest writes the vault configuration to vault.yaml, with its
+// encryption keys, salts and key paths in .sietch/secrets.yaml
 func WriteManifest(basePath string, cfg config.VaultConfig) error {
 	manifestPath := filepath.Join(basePath, "vault.yaml")
 
@@ -27,41 +30,44 @@ func WriteManifest(basePath string, cfg config.VaultConfig) error {
 		}
 	}
 
-	// Create manifest file with restricted permissions (0600) to secure the key
-	// Only owner can read/write the file since it will contain sensitive key material
-	manifestFile, err := os.OpenFile(manifestPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	public, err := config.SplitVaultConfig(basePath, &cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create manifest file: %w", err)
+		return err
 	}
-	defer manifestFile.Close()
 
 	// Encode the config with proper indentation
-	encoder := yaml.NewEncoder(manifestFile)
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
 	encoder.SetIndent(2)
 
-	if err := encoder.Encode(cfg); err != nil {
+	if err := encoder.Encode(public); err != nil {
 		return fmt.Errorf("failed to encode vault configuration: %w", err)
 	}
 
+	previous, err := os.ReadFile(manifestPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read manifest file: %w", err)
+	}
+	// The key material is in the secrets file (0600), so vault.yaml can be
+	// readable like the rest of the vault
+	if err := atomic.WriteFile(manifestPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	config.RecordConfigChange(basePath, previous, &cfg)
+
 	fmt.Printf("Vault configuration written to: %s\n", manifestPath)
 	return nil
 }
 
 // StoreFileManifest saves a file manifest to the vault
 func StoreFileManifest(vaultRoot string, fileName string, manifest *config.FileManifest) error {
-	// Ensure manifests directory exists
-	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
-	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
-		return fmt.Errorf("failed to create manifests directory: %v", err)
+	manifestPath, err := fileManifestPath(vaultRoot, fileName, manifest)
+	if err != nil {
+		return err
 	}
 
-	// Create manifest file path
-	destination := strings.ReplaceAll(manifest.Destination, "/", ".")
-	uniqueFileIdentifier := destination + fileName + ".yaml"
-	manifestPath := filepath.Join(manifestsDir, uniqueFileIdentifier)
-
 	// Check if file exists
-	_, err := os.Stat(manifestPath)
+	_, err = os.Stat(manifestPath)
 	if err == nil {
 		message := fmt.Sprintf("'%s' exists. Overwrite? ", manifest.Destination+fileName)
 		response, err := util.ConfirmOverwrite(message, os.Stdin, os.Stdout)
@@ -69,20 +75,56 @@ func StoreFileManifest(vaultRoot string, fileName string, manifest *config.FileM
 			return fmt.Errorf("skipped")
 		}
 	}
+	return writeFileManifest(vaultRoot, manifestPath, manifest)
+}
 
-	// Create/Overwrite the file
-	file, err := os.Create(manifestPath)
+// ReplaceFileManifest saves a file manifest to the vault, replacing the one
+// stored for the file without asking
+func ReplaceFileManifest(vaultRoot string, fileName string, manifest *config.FileManifest) error {
+	manifestPath, err := fileManifestPath(vaultRoot, fileName, manifest)
 	if err != nil {
-		return fmt.Errorf("failed to create manifest file: %v", err)
+		return err
 	}
-	defer file.Close()
+	return writeFileManifest(vaultRoot, manifestPath, manifest)
+}
 
-	// Encode the manifest to YAML
-	encoder := yaml.NewEncoder(file)
+// fileManifestPath returns the path a file's manifest is stored at, creating
+// the manifests directory if needed
+func fileManifestPath(vaultRoot string, fileName string, manifest *config.FileManifest) (string, error) {
+	// Ensure manifests directory exists
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create manifests directory: %v", err)
+	}
+
+	// Create manifest file path
+	destination := strings.ReplaceAll(manifest.Destination, "/", ".")
+	uniqueFileIdentifier := destination + fileName + ".yaml"
+	if manifest.PathID != "" {
+		// Manifests with encrypted paths are named after the keyed path hash
+		uniqueFileIdentifier = manifest.PathID + ".yaml"
+	}
+	return filepath.Join(manifestsDir, uniqueFileIdentifier), nil
+}
+
+// writeFileManifest encodes a file manifest to manifestPath
+func writeFileManifest(vaultRoot, manifestPath string, manifest *config.FileManifest) error {
+	// Encode the manifest to YAML, compressed if the vault's manifest format asks for it
+	var buf bytes.Buffer
+	w := config.NewManifestWriter(&buf, config.ManifestCompression(vaultRoot))
+	encoder := yaml.NewEncoder(w)
 	encoder.SetIndent(2)
 	if err := encoder.Encode(manifest); err != nil {
 		return fmt.Errorf("failed to encode manifest: %v", err)
 	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+
+	// Replace the file in one step, so a crash leaves the old manifest or the new one
+	if err := atomic.WriteFile(manifestPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
 
 	return nil
 }
@@ -95,13 +137,11 @@ func LoadFileManifest(vaultRoot string, fileName string) (*config.FileManifest,
 	if err != nil {
 		return nil, fmt.Errorf("failed to read manifest file: %v", err)
 	}
-
-	var manifest config.FileManifest
-	if err := yaml.Unmarshal(data, &manifest); err != nil {
-		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	if data, err = config.DecodeManifestData(data); err != nil {
+		return nil, err
 	}
 
-	return &manifest, nil
+	return config.ParseFileManifest(fileName+".yaml", data)
 }
 
 // ListFileManifests returns a list of all file manifests in the vault
@@ -143,6 +183,11 @@ func LoadVaultConfig(vaultRoot string) (*config.VaultConfig, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse vault configuration: %w", err)
 	}
+	secrets, err := config.LoadSecrets(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	config.MergeSecrets(&cfg, secrets)
 
 	// Check if encryption key is present
 	if cfg.Encryption.Type == "aes" && cfg.Encryption.AESConfig != nil {
@@ -157,12 +202,12 @@ func LoadVaultConfig(vaultRoot string) (*config.VaultConfig, error) {
 func WriteKeyToFile(keyMaterial []byte, keyPath string) error {
 	// Create directory structure for the key if it doesn't exist
 	keyDir := filepath.Dir(keyPath)
-	if err := os.MkdirAll(keyDir, 0o700); err != nil {
+	if err := private.Mkdir(keyDir); err != nil {
 		return fmt.Errorf("failed to create key directory %s: %w", keyDir, err)
 	}
 
 	// Write the key with secure permissions (only owner can read/write)
-	if err := os.WriteFile(keyPath, keyMaterial, 0o600); err != nil {
+	if err := private.WriteFileAtomic(keyPath, keyMaterial); err != nil {
 		return fmt.Errorf("failed to write key to %s: %w", keyPath, err)
 	}
 
@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// StatMatches reports whether a source file's size, modification time, inode
+// and mode are those recorded in its manifest. Manifests written before
+// sub-second times were recorded are compared to the second; an inode is only
+// compared when both sides have one, and a mode when the manifest has one.
+func StatMatches(m *config.FileManifest, info os.FileInfo) bool {
+	if m.Size != info.Size() {
+		return false
+	}
+	recorded, err := time.Parse(time.RFC3339Nano, m.ModTime)
+	if err != nil {
+		return false
+	}
+	modTime := info.ModTime()
+	if recorded.Nanosecond() == 0 {
+		modTime = modTime.Truncate(time.Second)
+	}
+	if !recorded.Equal(modTime) {
+		return false
+	}
+	if inode := fs.Inode(info); m.Inode != 0 && inode != 0 && m.Inode != inode {
+		return false
+	}
+	// A chmod leaves the mtime alone but changes what a restore applies
+	if m.Mode != "" && m.Mode != fs.FormatMode(info.Mode()) {
+		return false
+	}
+	return true
+}
+
+// ContentMatches re-hashes a source file with the settings it was stored with and
+// reports whether it still has the content recorded in its manifest
+func ContentMatches(path string, m *config.FileManifest, vaultConfig config.VaultConfig) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	// Packed and whole files are hashed in one piece
+	var wholeHash string
+	switch {
+	case m.Pack != nil:
+		wholeHash = m.Pack.Hash
+	case m.Chunking != nil && m.Chunking.Strategy == chunk.StrategyWhole:
+		if len(m.Chunks) != 1 {
+			return false, nil
+		}
+		wholeHash = m.Chunks[0].Hash
+	}
+	if wholeHash != "" {
+		hasher, err := chunk.CreateHasher(vaultConfig.Chunking.HashAlgorithm)
+		if err != nil {
+			return false, err
+		}
+		if _, err := io.Copy(hasher, file); err != nil {
+			return false, fmt.Errorf("failed to read file: %v", err)
+		}
+		return fmt.Sprintf("%x", hasher.Sum(nil)) == wholeHash, nil
+	}
+
+	strategy, chunkSize := "", int64(0)
+	if m.Chunking != nil {
+		strategy, chunkSize = m.Chunking.Strategy, m.Chunking.ChunkSize
+	} else {
+		policy, err := chunk.ResolvePolicyForVault(vaultConfig, m.Destination+m.FilePath)
+		if err != nil {
+			return false, err
+		}
+		strategy, chunkSize = policy.Strategy, policy.ChunkSize
+	}
+	chunker, err := chunk.NewChunker(file, strategy, chunkSize, vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; ; i++ {
+		next, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			return i == len(m.Chunks), nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read file: %v", err)
+		}
+		if i >= len(m.Chunks) || m.Chunks[i].Hash != next.Hash {
+			return false, nil
+		}
+	}
+}
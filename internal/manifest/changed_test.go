@@ -0,0 +1,96 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+func TestStatAndContentMatches(t *testing.T) {
+	vaultConfig := config.VaultConfig{}
+	vaultConfig.Chunking.HashAlgorithm = "sha256"
+
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, []byte("0123456789abcdef"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &config.FileManifest{
+		FilePath: "photo.jpg",
+		Size:     info.Size(),
+		ModTime:  info.ModTime().Format(time.RFC3339Nano),
+		Inode:    fs.Inode(info),
+		Mode:     fs.FormatMode(info.Mode()),
+		Chunking: &config.FileChunking{Strategy: "fixed", ChunkSize: 8},
+	}
+	for _, part := range []string{"01234567", "89abcdef"} {
+		hasher, _ := chunk.CreateHasher("sha256")
+		hasher.Write([]byte(part))
+		m.Chunks = append(m.Chunks, config.ChunkRef{Hash: fmt.Sprintf("%x", hasher.Sum(nil))})
+	}
+
+	if !StatMatches(m, info) {
+		t.Error("StatMatches() = false for an untouched file")
+	}
+	if same, err := ContentMatches(path, m, vaultConfig); err != nil || !same {
+		t.Errorf("ContentMatches() = %v, %v; want true", same, err)
+	}
+
+	// Older manifests only recorded whole seconds
+	legacy := *m
+	legacy.ModTime = info.ModTime().Format(time.RFC3339)
+	legacy.Inode = 0
+	if !StatMatches(&legacy, info) {
+		t.Error("StatMatches() = false for a manifest with second precision")
+	}
+
+	// A chmod does not touch the mtime, but the recorded mode no longer holds
+	chmodded := *m
+	chmodded.Mode = "0600"
+	if StatMatches(&chmodded, info) {
+		t.Error("StatMatches() = true for a file whose mode changed")
+	}
+
+	// Files stored whole are hashed in one piece
+	whole := *m
+	hasher, _ := chunk.CreateHasher("sha256")
+	hasher.Write([]byte("0123456789abcdef"))
+	whole.Chunking = &config.FileChunking{Strategy: chunk.StrategyWhole, ChunkSize: 16}
+	whole.Chunks = []config.ChunkRef{{Hash: fmt.Sprintf("%x", hasher.Sum(nil))}}
+	if same, err := ContentMatches(path, &whole, vaultConfig); err != nil || !same {
+		t.Errorf("ContentMatches(whole) = %v, %v; want true", same, err)
+	}
+
+	// Same size and mtime but different content is only caught by re-hashing
+	if err := os.WriteFile(path, []byte("0123456789ABCDEF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	touched, _ := os.Stat(path)
+	if !StatMatches(m, touched) {
+		t.Error("StatMatches() = false after restoring the mtime")
+	}
+	if same, err := ContentMatches(path, m, vaultConfig); err != nil || same {
+		t.Errorf("ContentMatches() = %v, %v; want false", same, err)
+	}
+
+	if err := os.Chtimes(path, info.ModTime().Add(time.Minute), info.ModTime().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	moved, _ := os.Stat(path)
+	if StatMatches(m, moved) {
+		t.Error("StatMatches() = true after the mtime changed")
+	}
+}
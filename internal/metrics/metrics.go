@@ -0,0 +1,109 @@
+// Package metrics collects what a sietch command did and writes it in the
+// Prometheus text exposition format, for backup jobs whose results are scraped
+// through node_exporter's textfile collector or a similar exporter.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Run holds the counters of one command. Commands add to them as they go;
+// fields a command does not count stay zero.
+type Run struct {
+	ChunksWritten  int64 // Chunks stored, locally added or received from a peer
+	DedupHits      int64 // Chunks already in the vault, not stored again
+	DedupMisses    int64 // Chunks that were new to the vault
+	BytesIn        int64 // Bytes read into the vault: file content added, chunk data received
+	BytesOut       int64 // Bytes written out: chunk data stored, file content retrieved
+	PlainBytes     int64 // Plaintext size of the chunks written
+	CompressedSize int64 // Size of the same chunks after compression
+}
+
+// AddChunks counts the chunks a file was split into. All-zero chunks and
+// remote references store nothing and are not counted.
+func (r *Run) AddChunks(refs []config.ChunkRef) {
+	for _, ref := range refs {
+		if ref.Zero || ref.Remote {
+			continue
+		}
+		if ref.Deduplicated {
+			r.DedupHits++
+			continue
+		}
+		r.DedupMisses++
+		r.ChunksWritten++
+		compressed, ok := ref.CompressedBytes()
+		if !ok {
+			compressed = ref.Size
+		}
+		r.PlainBytes += ref.Size
+		r.CompressedSize += compressed
+		if stored, ok := ref.StoredSize(); ok {
+			r.BytesOut += stored
+		} else {
+			r.BytesOut += compressed
+		}
+	}
+}
+
+// CompressionRatio returns the plaintext size of the chunks written divided by
+// their compressed size. ok is false when no chunk was written.
+func (r *Run) CompressionRatio() (ratio float64, ok bool) {
+	if r.CompressedSize == 0 {
+		return 0, false
+	}
+	return float64(r.PlainBytes) / float64(r.CompressedSize), true
+}
+
+// Write writes the counters of a run of command that ended at end after
+// taking duration, failed or not, in the Prometheus text format
+func (r *Run) Write(w io.Writer, command string, duration time.Duration, failed bool, end time.Time) error {
+	labels := fmt.Sprintf(`{command="%s"}`, escapeLabel(command))
+	gauge := func(name, help string, value any) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s%s %v\n", name, help, name, name, labels, value)
+	}
+	success := 1
+	if failed {
+		success = 0
+	}
+
+	gauge("sietch_chunks_written", "Chunks stored by the run.", r.ChunksWritten)
+	gauge("sietch_dedup_hits", "Chunks the vault already held.", r.DedupHits)
+	gauge("sietch_dedup_misses", "Chunks that were new to the vault.", r.DedupMisses)
+	gauge("sietch_bytes_in", "Bytes read into the vault.", r.BytesIn)
+	gauge("sietch_bytes_out", "Bytes written out of the run.", r.BytesOut)
+	if ratio, ok := r.CompressionRatio(); ok {
+		gauge("sietch_compression_ratio", "Plaintext size of the chunks written divided by their compressed size.", fmt.Sprintf("%.4f", ratio))
+	}
+	gauge("sietch_operation_duration_seconds", "How long the run took.", fmt.Sprintf("%.3f", duration.Seconds()))
+	gauge("sietch_operation_success", "1 if the run succeeded, 0 if it failed.", success)
+	_, err := fmt.Fprintf(w, "# HELP sietch_operation_end_timestamp_seconds When the run ended.\n# TYPE sietch_operation_end_timestamp_seconds gauge\nsietch_operation_end_timestamp_seconds%s %d\n", labels, end.Unix())
+	return err
+}
+
+// WriteFile writes the counters to path, replacing it in one step so a
+// scraper never reads half of them
+func (r *Run) WriteFile(path, command string, duration time.Duration, failed bool, end time.Time) error {
+	var buf bytes.Buffer
+	if err := r.Write(&buf, command, duration, failed, end); err != nil {
+		return err
+	}
+	if err := atomic.WriteFile(path, buf.Bytes(), constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to write metrics to %s: %w", path, err)
+	}
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	var run Run
+	run.BytesIn = 4096
+	run.AddChunks([]config.ChunkRef{
+		{Hash: "a", Size: 2048, Compressed: true, CompressedSize: 512, EncryptedSize: 540},
+		{Hash: "b", Size: 1024, Compressed: true, CompressedSize: 512},
+		{Hash: "a", Size: 2048, Deduplicated: true},
+		{Hash: "z", Size: 4096, Zero: true},
+		{Hash: "r", Size: 4096, Remote: true},
+	})
+	if run.ChunksWritten != 2 || run.DedupHits != 1 || run.DedupMisses != 2 || run.BytesOut != 1052 {
+		t.Fatalf("AddChunks() = %+v", run)
+	}
+	if ratio, ok := run.CompressionRatio(); !ok || ratio != 3 {
+		t.Errorf("CompressionRatio() = %v, %v, want 3", ratio, ok)
+	}
+	if _, ok := (&Run{}).CompressionRatio(); ok {
+		t.Error("CompressionRatio() of a run that wrote nothing is ok")
+	}
+
+	path := filepath.Join(t.TempDir(), "sietch.prom")
+	end := time.Unix(1700000000, 0)
+	if err := run.WriteFile(path, `vault "x"`, 1500*time.Millisecond, true, end); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE sietch_chunks_written gauge\n",
+		`sietch_chunks_written{command="vault \"x\""} 2` + "\n",
+		`sietch_bytes_in{command="vault \"x\""} 4096` + "\n",
+		`sietch_compression_ratio{command="vault \"x\""} 3.0000` + "\n",
+		`sietch_operation_duration_seconds{command="vault \"x\""} 1.500` + "\n",
+		`sietch_operation_success{command="vault \"x\""} 0` + "\n",
+		`sietch_operation_end_timestamp_seconds{command="vault \"x\""} 1700000000` + "\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics file lacks %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package oplog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+)
+
+// The operation log records each command that changed the vault, one JSON
+// object per line in .sietch/log. Lines are only ever appended. With
+// sign_operation_log set in vault.yaml each entry carries a signature made
+// with the vault's sync key, which 'sietch log --verify' checks.
+
+// Counts are what an operation did
+type Counts struct {
+	Files  int   `json:"files,omitempty"`
+	Chunks int   `json:"chunks,omitempty"`
+	Bytes  int64 `json:"bytes,omitempty"`
+}
+
+// Entry is one logged operation
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Author  string    `json:"author,omitempty"` // user@host that ran the command
+	Command string    `json:"command"`
+	Args    []string  `json:"args,omitempty"`
+	Counts
+	Notes     []string `json:"notes,omitempty"`     // What the command changed that counts do not tell, e.g. a peer trusted
+	Error     string   `json:"error,omitempty"`     // Set when the command failed
+	Signature string   `json:"signature,omitempty"` // Base64 signature over the entry without it
+}
+
+// Path returns the path of the vault's operation log
+func Path(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "log")
+}
+
+// Append adds entry to the log, signed with signer unless it is nil
+func Append(vaultRoot string, entry Entry, signer crypto.Signer) error {
+	// Times read back from the log are in UTC; signing the same form keeps
+	// the signature valid
+	entry.Time = entry.Time.UTC()
+	entry.Signature = ""
+	if signer != nil {
+		signature, err := keys.SignChallenge(signer, entry.signedBytes())
+		if err != nil {
+			return fmt.Errorf("failed to sign operation log entry: %v", err)
+		}
+		entry.Signature = base64.StdEncoding.EncodeToString(signature)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode operation log entry: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(Path(vaultRoot)), constants.StandardDirPerms); err != nil {
+		return fmt.Errorf("failed to create .sietch directory: %v", err)
+	}
+	// One write per entry, so entries of concurrent writers never interleave
+	file, err := os.OpenFile(Path(vaultRoot), os.O_WRONLY|os.O_APPEND|os.O_CREATE, constants.StandardFilePerms)
+	if err != nil {
+		return fmt.Errorf("failed to open operation log: %v", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write operation log: %v", err)
+	}
+	return file.Close()
+}
+
+// Load returns the logged operations, oldest first. A vault without a log has
+// no operations logged yet.
+func Load(vaultRoot string) ([]Entry, error) {
+	data, err := os.ReadFile(Path(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading operation log: %w", err)
+	}
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("error parsing operation log line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading operation log: %w", err)
+	}
+	return entries, nil
+}
+
+// Verify checks entry's signature against publicKey
+func (e Entry) Verify(publicKey crypto.PublicKey) error {
+	if e.Signature == "" {
+		return fmt.Errorf("entry is not signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(e.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	return keys.VerifyChallenge(publicKey, e.signedBytes(), signature)
+}
+
+// signedBytes is what an entry's signature covers: the entry without it
+func (e Entry) signedBytes() []byte {
+	e.Signature = ""
+	data, _ := json.Marshal(e)
+	return data
+}
+
+// Filter selects log entries; zero fields match everything
+type Filter struct {
+	Command string    // Matches commands containing it, e.g. "add" or "dedup gc"
+	Author  string    // Matches authors containing it
+	Since   time.Time // Matches entries at or after it
+	Failed  bool      // Matches only failed commands
+}
+
+// Match reports whether entry passes the filter
+func (f Filter) Match(entry Entry) bool {
+	if f.Command != "" && !strings.Contains(entry.Command, f.Command) {
+		return false
+	}
+	if f.Author != "" && !strings.Contains(entry.Author, f.Author) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	return !f.Failed || entry.Error != ""
+}
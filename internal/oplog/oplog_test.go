@@ -0,0 +1,83 @@
+package oplog
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendSignedAndLoad(t *testing.T) {
+	vaultRoot := t.TempDir()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2025, 3, 1, 14, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	if err := Append(vaultRoot, Entry{Time: at, Author: "alice@laptop", Command: "sietch add", Args: []string{"a.txt", "docs/"},
+		Counts: Counts{Files: 1, Chunks: 2, Bytes: 42}}, privateKey); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if err := Append(vaultRoot, Entry{Time: at.Add(time.Hour), Author: "bob@desk", Command: "sietch delete", Error: "not found"}, nil); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+
+	entries, err := Load(vaultRoot)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Bytes != 42 || entries[1].Error != "not found" {
+		t.Fatalf("Load() = %+v", entries)
+	}
+	if err := entries[0].Verify(publicKey); err != nil {
+		t.Errorf("Verify() of the signed entry: %v", err)
+	}
+	if err := entries[1].Verify(publicKey); err == nil {
+		t.Error("Verify() accepted an unsigned entry")
+	}
+
+	// Editing a logged entry breaks its signature
+	data, err := os.ReadFile(Path(vaultRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(Path(vaultRoot), []byte(strings.Replace(string(data), `"bytes":42`, `"bytes":1`, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = Load(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entries[0].Verify(publicKey); err == nil {
+		t.Error("Verify() accepted an edited entry")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := Entry{Time: at, Author: "alice@laptop", Command: "sietch dedup gc"}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"command", Filter{Command: "dedup gc"}, true},
+		{"other command", Filter{Command: "add"}, false},
+		{"author", Filter{Author: "alice"}, true},
+		{"other author", Filter{Author: "bob"}, false},
+		{"since before", Filter{Since: at.Add(-time.Hour)}, true},
+		{"since after", Filter{Since: at.Add(time.Hour)}, false},
+		{"failed only", Filter{Failed: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(entry); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/zeroconf/v2"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// AdvertiseService is the DNS-SD service vaults announce their sync endpoint
+// under when sync.advertise is set. Unlike the anonymous libp2p mDNS
+// announcement of 'sietch sync', it names the vault and its sync key.
+const AdvertiseService = "_sietch-sync._udp"
+
+const (
+	advertiseDomain = "local"
+	txtMaxValue     = 200 // TXT strings hold 255 bytes, key included
+)
+
+// Advertisement is what a vault announces about its sync endpoint
+type Advertisement struct {
+	PeerID      peer.ID
+	VaultID     string
+	VaultName   string
+	Fingerprint string                // Fingerprint of the vault's sync public key
+	Addrs       []multiaddr.Multiaddr // Addresses of the sync endpoint, without /p2p
+}
+
+// InstanceName returns the DNS-SD instance name of the advertisement, made of
+// the vault ID prefix and the fingerprint prefix
+func (a Advertisement) InstanceName() string {
+	return "sietch-" + namePart(a.VaultID) + "-" + namePart(a.Fingerprint)
+}
+
+// namePart keeps the first 8 letters and digits of s, for a DNS label
+func namePart(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			if b.Len() == 8 {
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// text encodes the advertisement as TXT strings
+func (a Advertisement) text() []string {
+	txt := []string{
+		"peer=" + a.PeerID.String(),
+		"vault=" + a.VaultID,
+		"name=" + truncate(a.VaultName, txtMaxValue),
+		"fp=" + a.Fingerprint,
+	}
+	for _, addr := range a.Addrs {
+		txt = append(txt, "addr="+addr.String())
+	}
+	return txt
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// parseAdvertisement decodes TXT strings written by text; ok is false for
+// entries that lack a peer ID or an address
+func parseAdvertisement(txt []string) (a Advertisement, ok bool) {
+	for _, entry := range txt {
+		key, value, _ := strings.Cut(entry, "=")
+		switch key {
+		case "peer":
+			id, err := peer.Decode(value)
+			if err != nil {
+				return a, false
+			}
+			a.PeerID = id
+		case "vault":
+			a.VaultID = value
+		case "name":
+			a.VaultName = value
+		case "fp":
+			a.Fingerprint = value
+		case "addr":
+			if addr, err := multiaddr.NewMultiaddr(value); err == nil {
+				a.Addrs = append(a.Addrs, addr)
+			}
+		}
+	}
+	return a, a.PeerID != "" && len(a.Addrs) > 0
+}
+
+// Advertise announces the sync endpoint of h on the local network as the
+// vault described by a, until the returned stop is called
+func Advertise(h host.Host, a Advertisement) (stop func(), err error) {
+	listenAddrs, err := h.Network().InterfaceListenAddresses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listen addresses: %w", err)
+	}
+	a.PeerID = h.ID()
+	a.Addrs = nil
+	var ips []string
+	port := 0
+	for _, addr := range listenAddrs {
+		if !manet.IsThinWaist(addr) || manet.IsIPLoopback(addr) {
+			continue
+		}
+		a.Addrs = append(a.Addrs, addr)
+		ip, err := manet.ToIP(addr)
+		if err != nil {
+			continue
+		}
+		ips = append(ips, ip.String())
+		if tcp, err := addr.ValueForProtocol(multiaddr.P_TCP); err == nil && port == 0 {
+			fmt.Sscan(tcp, &port)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no network address to advertise")
+	}
+
+	instance := a.InstanceName()
+	server, err := zeroconf.RegisterProxy(instance, AdvertiseService, advertiseDomain, port, instance, ips, a.text(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to advertise on the local network: %w", err)
+	}
+	return server.Shutdown, nil
+}
+
+// Browse reports the vaults advertising their sync endpoint on the local
+// network to found, until ctx ends. A vault is reported once.
+func Browse(ctx context.Context, found func(Advertisement)) error {
+	entries := make(chan *zeroconf.ServiceEntry, 32)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		seen := make(map[peer.ID]bool)
+		for entry := range entries {
+			a, ok := parseAdvertisement(entry.Text)
+			if !ok || seen[a.PeerID] {
+				continue
+			}
+			seen[a.PeerID] = true
+			found(a)
+		}
+	}()
+	err := zeroconf.Browse(ctx, AdvertiseService, advertiseDomain, entries)
+	<-done
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to browse the local network: %w", err)
+	}
+	return nil
+}
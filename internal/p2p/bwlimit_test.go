@@ -0,0 +1,42 @@
+package p2p
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLimiterSharedAcrossStreams ensures concurrent transfers together stay under the rate
+func TestLimiterSharedAcrossStreams(t *testing.T) {
+	const rate = 4 << 20
+	limiter := NewLimiter(rate)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 8 {
+				limiter.Wait(64 << 10)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// 2MB at 4MB/s, less the burst the bucket starts with
+	want := time.Duration(float64((2<<20)-limiter.burst) / rate * float64(time.Second))
+	if elapsed < want-50*time.Millisecond {
+		t.Errorf("4 streams passed 2MB in %v, want at least %v", elapsed, want)
+	}
+	if elapsed > want+time.Second {
+		t.Errorf("4 streams passed 2MB in %v, want about %v", elapsed, want)
+	}
+
+	if NewLimiter(0) != nil {
+		t.Error("NewLimiter(0) limits")
+	}
+	var unlimited *Limiter
+	unlimited.Wait(1 << 30) // must not block
+}
@@ -0,0 +1,442 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// A file both vaults hold in different versions is only a conflict when both
+// changed it since they last synced; otherwise the side that changed it wins.
+// What each file held when the vault last synced with a peer is kept in
+// .sietch/sync-checkpoints/<peer ID>.json. Conflicts sync could not resolve
+// are kept in .sietch/sync-conflicts.json until 'sietch conflicts resolve'
+// picks a version, which the next sync with the peer applies.
+
+// How a conflict was or is to be resolved
+const (
+	ResolveLocal = "local" // Keep the local version
+	ResolvePeer  = "peer"  // Take the peer's version
+	ResolveBoth  = "both"  // Keep the local version and store the peer's beside it
+)
+
+// Resolutions lists the ways a conflict can be resolved
+var Resolutions = []string{ResolveLocal, ResolvePeer, ResolveBoth}
+
+// Conflict is a file both the vault and a peer changed since they last synced
+type Conflict struct {
+	Peer       string          `json:"peer"`
+	PeerName   string          `json:"peer_name,omitempty"`
+	Path       string          `json:"path,omitempty"` // Vault path; empty when the path is encrypted
+	Identity   string          `json:"identity"`       // Vault path, or its keyed hash when the path is encrypted
+	Detected   time.Time       `json:"detected"`
+	Local      ConflictVersion `json:"local"`
+	Remote     ConflictVersion `json:"remote"`
+	Resolution string          `json:"resolution,omitempty"` // One of the Resolve constants; empty while unresolved
+	CopyPath   string          `json:"copy_path,omitempty"`  // Where the peer's version was stored beside the local one
+}
+
+// ConflictVersion is one side's version of a conflicting file
+type ConflictVersion struct {
+	Content string `json:"content"` // ContentFingerprint of the version
+	Size    int64  `json:"size"`
+	ModTime string `json:"mtime,omitempty"`
+}
+
+// DisplayPath returns the file's vault path, or its identity when the path
+// is encrypted
+func (c Conflict) DisplayPath() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return displayIdentity(c.Identity)
+}
+
+// DisplayPeer returns the peer's name, or its ID when unnamed
+func (c Conflict) DisplayPeer() string {
+	if c.PeerName != "" {
+		return c.PeerName
+	}
+	return c.Peer
+}
+
+// ConflictError stops a sync that found conflicts it could not resolve
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%d files were changed both here and on the peer since the last sync; "+
+		"resolve them with 'sietch conflicts resolve' or sync with --conflict newest or keep-both", len(e.Conflicts))
+}
+
+// ConflictsPath returns the path of the vault's unresolved sync conflicts
+func ConflictsPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync-conflicts.json")
+}
+
+// LoadConflicts reads the vault's unresolved sync conflicts, sorted by path
+func LoadConflicts(vaultRoot string) ([]Conflict, error) {
+	data, err := os.ReadFile(ConflictsPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync conflicts: %w", err)
+	}
+	var conflicts []Conflict
+	if err := json.Unmarshal(data, &conflicts); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ConflictsPath(vaultRoot), err)
+	}
+	sortConflicts(conflicts)
+	return conflicts, nil
+}
+
+// SaveConflicts replaces the vault's unresolved sync conflicts; with none
+// left the file is removed
+func SaveConflicts(vaultRoot string, conflicts []Conflict) error {
+	path := ConflictsPath(vaultRoot)
+	if len(conflicts) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove sync conflicts: %w", err)
+		}
+		return nil
+	}
+	sortConflicts(conflicts)
+	data, err := json.MarshalIndent(conflicts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync conflicts: %w", err)
+	}
+	if err := atomic.WriteFile(path, append(data, '\n'), constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to save sync conflicts: %w", err)
+	}
+	return nil
+}
+
+func sortConflicts(conflicts []Conflict) {
+	sort.Slice(conflicts, func(i, j int) bool {
+		if a, b := conflicts[i].DisplayPath(), conflicts[j].DisplayPath(); a != b {
+			return a < b
+		}
+		return conflicts[i].Peer < conflicts[j].Peer
+	})
+}
+
+// syncCheckpoint is the content each file had on both sides when the vault
+// last synced with a peer
+type syncCheckpoint struct {
+	Synced time.Time                 `json:"synced"`
+	Files  map[string]syncedVersions `json:"files"` // By syncKey
+}
+
+// syncedVersions is the ContentFingerprint of a file's version in the vault
+// and on the peer after a sync; they differ when the vault kept its own
+type syncedVersions struct {
+	Local string `json:"local"`
+	Peer  string `json:"peer"`
+}
+
+// CheckpointPath returns the path of the checkpoint of syncs with peerID
+func CheckpointPath(vaultRoot string, peerID peer.ID) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync-checkpoints", peerID.String()+".json")
+}
+
+// loadCheckpoint reads the checkpoint of syncs with peerID; before the first
+// sync it is empty
+func loadCheckpoint(vaultRoot string, peerID peer.ID) (*syncCheckpoint, error) {
+	checkpoint := &syncCheckpoint{Files: make(map[string]syncedVersions)}
+	data, err := os.ReadFile(CheckpointPath(vaultRoot, peerID))
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse sync checkpoint: %w", err)
+	}
+	if checkpoint.Files == nil {
+		checkpoint.Files = make(map[string]syncedVersions)
+	}
+	return checkpoint, nil
+}
+
+// advance records what both sides hold after a sync that applied merge
+func (c *syncCheckpoint) advance(local, remote *config.Manifest, merge *fileMerge) {
+	kept := make(map[string]string, len(local.Files))
+	for i := range local.Files {
+		kept[syncKey(&local.Files[i])] = ContentFingerprint(&local.Files[i])
+	}
+	for i := range merge.update {
+		delete(kept, syncKey(&merge.update[i]))
+	}
+	for i := range remote.Files {
+		key, peerContent := syncKey(&remote.Files[i]), ContentFingerprint(&remote.Files[i])
+		localContent, ok := kept[key]
+		if !ok {
+			localContent = peerContent
+		}
+		c.Files[key] = syncedVersions{Local: localContent, Peer: peerContent}
+	}
+	c.Synced = time.Now().UTC()
+}
+
+// save writes the checkpoint of syncs with peerID
+func (c *syncCheckpoint) save(vaultRoot string, peerID peer.ID) error {
+	path := CheckpointPath(vaultRoot, peerID)
+	if err := os.MkdirAll(filepath.Dir(path), constants.StandardDirPerms); err != nil {
+		return fmt.Errorf("failed to create sync checkpoint directory: %w", err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode sync checkpoint: %w", err)
+	}
+	if err := atomic.WriteFile(path, data, constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to save sync checkpoint: %w", err)
+	}
+	return nil
+}
+
+// mergeWithCheckpoint works out what the vault does with a peer's files,
+// from the checkpoint of the last exchange with it and the conflicts
+// recorded since
+func mergeWithCheckpoint(vaultRoot string, peerID peer.ID, peerName, strategy string, local, remote *config.Manifest) (*fileMerge, *syncCheckpoint, error) {
+	checkpoint, err := loadCheckpoint(vaultRoot, peerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	recorded, err := LoadConflicts(vaultRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := mergeOptions{
+		peer:     peerID.String(),
+		peerName: peerName,
+		strategy: strategy,
+		recorded: recorded,
+		base:     checkpoint,
+		now:      time.Now(),
+	}
+	return mergeFiles(local, remote, opts), checkpoint, nil
+}
+
+// recordPeerConflicts replaces the recorded conflicts with a peer by
+// unresolved: those of the files of examined, or all of them when nil
+func recordPeerConflicts(vaultRoot string, peerID peer.ID, examined *config.Manifest, unresolved []Conflict) error {
+	recorded, err := LoadConflicts(vaultRoot)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]bool)
+	if examined != nil {
+		for i := range examined.Files {
+			keys[syncKey(&examined.Files[i])] = true
+		}
+	}
+	kept := unresolved
+	for _, c := range recorded {
+		if c.Peer != peerID.String() || (examined != nil && !keys[c.Identity]) {
+			kept = append(kept, c)
+		}
+	}
+	return SaveConflicts(vaultRoot, kept)
+}
+
+// PeerFiles is what the vault does with versions of files a peer sent
+// outside a sync, in a bundle for instance
+type PeerFiles struct {
+	Add       []config.FileManifest // Files the vault lacks
+	Update    []config.FileManifest // Versions replacing the local one
+	Copies    []config.FileManifest // Versions stored beside the local one
+	Conflicts []Conflict            // Files both sides changed since the last exchange, as resolved
+
+	vaultRoot  string
+	peerID     peer.ID
+	local      *config.Manifest
+	sent       *config.Manifest
+	merge      *fileMerge
+	checkpoint *syncCheckpoint
+}
+
+// MergePeerFiles decides what the vault does with versions of files a peer
+// sent, as a sync with the peer would. Conflicts that no strategy or
+// recorded resolution decides are recorded for 'sietch conflicts resolve'
+// and returned in a *ConflictError.
+func MergePeerFiles(vaultRoot string, peerID peer.ID, peerName, strategy string, local *config.Manifest, files []config.FileManifest) (*PeerFiles, error) {
+	sent := &config.Manifest{Files: files}
+	merge, checkpoint, err := mergeWithCheckpoint(vaultRoot, peerID, peerName, strategy, local, sent)
+	if err != nil {
+		return nil, err
+	}
+	if unresolved := merge.unresolved(); len(unresolved) > 0 {
+		if err := recordPeerConflicts(vaultRoot, peerID, sent, unresolved); err != nil {
+			return nil, err
+		}
+		return nil, &ConflictError{Conflicts: unresolved}
+	}
+	return &PeerFiles{
+		Add:        merge.add,
+		Update:     merge.update,
+		Copies:     merge.copies,
+		Conflicts:  merge.conflicts,
+		vaultRoot:  vaultRoot,
+		peerID:     peerID,
+		local:      local,
+		sent:       sent,
+		merge:      merge,
+		checkpoint: checkpoint,
+	}, nil
+}
+
+// Stored records that the vault holds what was merged, once it is: the
+// checkpoint of exchanges with the peer advances and the conflicts recorded
+// for the files it sent are cleared
+func (p *PeerFiles) Stored() error {
+	p.checkpoint.advance(p.local, p.sent, p.merge)
+	if err := p.checkpoint.save(p.vaultRoot, p.peerID); err != nil {
+		return err
+	}
+	return recordPeerConflicts(p.vaultRoot, p.peerID, p.sent, nil)
+}
+
+// fileMerge is what a sync does with the peer's files
+type fileMerge struct {
+	add       []config.FileManifest // Files the vault lacks
+	update    []config.FileManifest // Peer versions replacing the local one
+	copies    []config.FileManifest // Peer versions stored beside the local one
+	conflicts []Conflict            // Files both sides changed; unresolved ones stop the sync
+}
+
+// unresolved returns the conflicts no strategy or recorded resolution decided
+func (m *fileMerge) unresolved() []Conflict {
+	var unresolved []Conflict
+	for _, c := range m.conflicts {
+		if c.Resolution == "" {
+			unresolved = append(unresolved, c)
+		}
+	}
+	return unresolved
+}
+
+// mergeOptions are the parameters of mergeFiles
+type mergeOptions struct {
+	peer     string // Peer ID
+	peerName string
+	strategy string     // One of constants.ConflictStrategies; empty is manual
+	recorded []Conflict // Conflicts with the peer kept from earlier syncs
+	base     *syncCheckpoint
+	now      time.Time
+}
+
+// mergeFiles decides what a sync does with each of the peer's files: a file
+// the vault lacks is added, one only the peer changed since the last sync
+// replaces the local version, one only the vault changed is kept, and one
+// both changed is a conflict, resolved by a resolution recorded for the same
+// two versions or else by the strategy
+func mergeFiles(local, remote *config.Manifest, opts mergeOptions) *fileMerge {
+	merge := &fileMerge{}
+	localFiles := make(map[string]*config.FileManifest, len(local.Files))
+	for i := range local.Files {
+		localFiles[syncKey(&local.Files[i])] = &local.Files[i]
+	}
+	recorded := make(map[string]Conflict)
+	for _, c := range opts.recorded {
+		if c.Peer == opts.peer {
+			recorded[c.Identity] = c
+		}
+	}
+
+	for _, remoteFile := range remote.Files {
+		localFile, ok := localFiles[syncKey(&remoteFile)]
+		if !ok {
+			merge.add = append(merge.add, remoteFile)
+			continue
+		}
+		localContent, remoteContent := ContentFingerprint(localFile), ContentFingerprint(&remoteFile)
+		base, synced := opts.base.Files[syncKey(&remoteFile)]
+		switch {
+		case localContent == remoteContent, synced && base.Peer == remoteContent:
+			continue // The same, or changed only here
+		case synced && base.Local == localContent:
+			merge.update = append(merge.update, remoteFile)
+			continue
+		}
+
+		conflict := Conflict{
+			Peer:     opts.peer,
+			PeerName: opts.peerName,
+			Path:     filePath(localFile),
+			Identity: syncKey(&remoteFile),
+			Detected: opts.now,
+			Local:    ConflictVersion{Content: localContent, Size: localFile.Size, ModTime: localFile.ModTime},
+			Remote:   ConflictVersion{Content: remoteContent, Size: remoteFile.Size, ModTime: remoteFile.ModTime},
+		}
+		if earlier, ok := recorded[conflict.Identity]; ok && earlier.Local == conflict.Local && earlier.Remote == conflict.Remote {
+			conflict.Detected, conflict.Resolution = earlier.Detected, earlier.Resolution
+		}
+		if conflict.Resolution == "" {
+			conflict.Resolution = strategyResolution(opts.strategy, localFile, &remoteFile)
+		}
+
+		switch conflict.Resolution {
+		case ResolvePeer:
+			merge.update = append(merge.update, remoteFile)
+		case ResolveBoth:
+			if remoteFile.FilePath == "" {
+				// An encrypted path cannot be renamed without the path key
+				conflict.Resolution = ""
+				break
+			}
+			copied := remoteFile
+			copied.FilePath = conflictCopyName(&remoteFile, opts, localFiles)
+			localFiles[syncKey(&copied)] = &copied
+			conflict.CopyPath = filePath(&copied)
+			merge.copies = append(merge.copies, copied)
+		}
+		merge.conflicts = append(merge.conflicts, conflict)
+	}
+	return merge
+}
+
+// strategyResolution resolves a conflict by strategy, empty for manual
+func strategyResolution(strategy string, local, remote *config.FileManifest) string {
+	switch strategy {
+	case constants.ConflictKeepBoth:
+		return ResolveBoth
+	case constants.ConflictNewest:
+		localTime, localErr := time.Parse(time.RFC3339Nano, local.ModTime)
+		remoteTime, remoteErr := time.Parse(time.RFC3339Nano, remote.ModTime)
+		if localErr == nil && remoteErr == nil && remoteTime.After(localTime) {
+			return ResolvePeer
+		}
+		// On a tie, or without both times, the local version stays
+		return ResolveLocal
+	}
+	return ""
+}
+
+// conflictCopyName returns the name the peer's version of a conflicting file
+// is stored under: name.conflict-<peer>-<date>, numbered when taken
+func conflictCopyName(file *config.FileManifest, opts mergeOptions, taken map[string]*config.FileManifest) string {
+	label := opts.peerName
+	if label == "" {
+		// Peer IDs share their first characters; the end tells them apart
+		label = opts.peer[max(0, len(opts.peer)-8):]
+	}
+	label = strings.NewReplacer("/", "_", `\`, "_", " ", "_").Replace(label)
+	copyName := fmt.Sprintf("%s.conflict-%s-%s", file.FilePath, label, opts.now.Format("2006-01-02"))
+	for n := 2; taken[file.Destination+copyName] != nil; n++ {
+		copyName = fmt.Sprintf("%s.conflict-%s-%s-%d", file.FilePath, label, opts.now.Format("2006-01-02"), n)
+	}
+	return copyName
+}
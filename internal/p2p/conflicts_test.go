@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+func version(name, hash, modTime string) config.FileManifest {
+	return config.FileManifest{FilePath: name, Destination: "docs/", Size: 1, ModTime: modTime,
+		Chunks: []config.ChunkRef{{Hash: hash, Size: 1}}}
+}
+
+// TestMergeFiles ensures only files both sides changed since the last sync
+// are conflicts, resolved by a recorded resolution or the strategy
+func TestMergeFiles(t *testing.T) {
+	older, newer := "2026-01-01T10:00:00Z", "2026-01-02T10:00:00Z"
+	base := version("notes.txt", "base", older)
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		local      config.FileManifest
+		remote     config.FileManifest
+		synced     bool // A checkpoint holds base
+		kept       bool // The last sync kept a different local version over base
+		strategy   string
+		recorded   string // Resolution recorded for these two versions
+		wantAdd    int
+		wantUpdate int
+		wantCopy   string
+		wantResult string // Resolution of the conflict; "-" for no conflict
+	}{
+		{"unchanged", base, base, true, false, "", "", 0, 0, "", "-"},
+		{"changed only here", version("notes.txt", "mine", newer), base, true, false, "", "", 0, 0, "", "-"},
+		{"changed only on the peer", base, version("notes.txt", "theirs", newer), true, false, "", "", 0, 1, "", "-"},
+		{"manual", version("notes.txt", "mine", older), version("notes.txt", "theirs", newer), true, false, constants.ConflictManual, "", 0, 0, "", ""},
+		{"never synced", base, version("notes.txt", "theirs", newer), false, false, "", "", 0, 0, "", ""},
+		{"newest takes the peer's", version("notes.txt", "mine", older), version("notes.txt", "theirs", newer), true, false, constants.ConflictNewest, "", 0, 1, "", ResolvePeer},
+		{"newest keeps the local", version("notes.txt", "mine", newer), version("notes.txt", "theirs", older), true, false, constants.ConflictNewest, "", 0, 0, "", ResolveLocal},
+		{"keep both", version("notes.txt", "mine", older), version("notes.txt", "theirs", newer), true, false, constants.ConflictKeepBoth, "", 0, 0, "notes.txt.conflict-laptop-2026-03-04", ResolveBoth},
+		{"recorded resolution", version("notes.txt", "mine", older), version("notes.txt", "theirs", newer), true, false, constants.ConflictManual, ResolvePeer, 0, 1, "", ResolvePeer},
+		{"changed on the peer after keeping the local", version("notes.txt", "mine", older), version("notes.txt", "theirs", newer), true, true, "", "", 0, 1, "", "-"},
+		{"unchanged after keeping the local", version("notes.txt", "mine", older), base, true, true, "", "", 0, 0, "", "-"},
+		{"new file", version("other.txt", "x", older), base, true, false, "", "", 1, 0, "", "-"},
+		{"same name elsewhere", config.FileManifest{FilePath: "notes.txt", Destination: "old/"}, base, true, false, "", "", 1, 0, "", "-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint := &syncCheckpoint{Files: map[string]syncedVersions{}}
+			if tt.synced {
+				checkpoint.Files[syncKey(&base)] = syncedVersions{Local: ContentFingerprint(&base), Peer: ContentFingerprint(&base)}
+			}
+			if tt.kept {
+				checkpoint.Files[syncKey(&base)] = syncedVersions{Local: ContentFingerprint(&tt.local), Peer: ContentFingerprint(&base)}
+			}
+			opts := mergeOptions{peer: "peer-a", peerName: "laptop", strategy: tt.strategy, base: checkpoint, now: now}
+			if tt.recorded != "" {
+				opts.recorded = []Conflict{{
+					Peer:       "peer-a",
+					Identity:   syncKey(&tt.local),
+					Local:      ConflictVersion{Content: ContentFingerprint(&tt.local), Size: 1, ModTime: tt.local.ModTime},
+					Remote:     ConflictVersion{Content: ContentFingerprint(&tt.remote), Size: 1, ModTime: tt.remote.ModTime},
+					Resolution: tt.recorded,
+				}}
+			}
+			local := &config.Manifest{Files: []config.FileManifest{tt.local}}
+			remote := &config.Manifest{Files: []config.FileManifest{tt.remote}}
+
+			merge := mergeFiles(local, remote, opts)
+			if len(merge.add) != tt.wantAdd || len(merge.update) != tt.wantUpdate {
+				t.Errorf("added %d, updated %d; want %d, %d", len(merge.add), len(merge.update), tt.wantAdd, tt.wantUpdate)
+			}
+			if tt.wantCopy == "" && len(merge.copies) > 0 || tt.wantCopy != "" && (len(merge.copies) != 1 || merge.copies[0].FilePath != tt.wantCopy) {
+				t.Errorf("copies = %+v, want %q", merge.copies, tt.wantCopy)
+			}
+			if tt.wantResult == "-" {
+				if len(merge.conflicts) != 0 {
+					t.Errorf("conflicts = %+v, want none", merge.conflicts)
+				}
+				return
+			}
+			if len(merge.conflicts) != 1 || merge.conflicts[0].Resolution != tt.wantResult {
+				t.Fatalf("conflicts = %+v, want one resolved %q", merge.conflicts, tt.wantResult)
+			}
+			if unresolved := merge.unresolved(); (tt.wantResult == "") != (len(unresolved) == 1) {
+				t.Errorf("unresolved() = %+v", unresolved)
+			}
+		})
+	}
+}
+
+// TestSyncStateFiles ensures checkpoints and conflicts survive a save
+func TestSyncStateFiles(t *testing.T) {
+	vaultRoot := t.TempDir()
+	peerID := peer.ID("peer-a")
+
+	checkpoint, err := loadCheckpoint(vaultRoot, peerID)
+	if err != nil || len(checkpoint.Files) != 0 {
+		t.Fatalf("loadCheckpoint() before a sync = %+v, %v", checkpoint, err)
+	}
+	checkpoint.Files["notes.txt"] = syncedVersions{Local: "abc", Peer: "def"}
+	if err := checkpoint.save(vaultRoot, peerID); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := loadCheckpoint(vaultRoot, peerID); err != nil || loaded.Files["notes.txt"].Peer != "def" {
+		t.Errorf("loadCheckpoint() = %+v, %v", loaded, err)
+	}
+
+	conflicts := []Conflict{{Peer: "peer-a", Path: "docs/b.txt"}, {Peer: "peer-a", Path: "docs/a.txt", Resolution: ResolveBoth}}
+	if err := SaveConflicts(vaultRoot, conflicts); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConflicts(vaultRoot)
+	if err != nil || len(loaded) != 2 || loaded[0].Path != "docs/a.txt" || loaded[0].Resolution != ResolveBoth {
+		t.Errorf("LoadConflicts() = %+v, %v", loaded, err)
+	}
+	if err := SaveConflicts(vaultRoot, nil); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := LoadConflicts(vaultRoot); err != nil || len(loaded) != 0 {
+		t.Errorf("LoadConflicts() after clearing = %+v, %v", loaded, err)
+	}
+}
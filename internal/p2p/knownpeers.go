@@ -0,0 +1,141 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Like SSH's known_hosts, .sietch/known-peers.json keeps the sync key each
+// vault was first seen with, by vault ID. Entries are added when a peer is
+// trusted or syncs while trusted, and stay when the peer is removed from the
+// trust list or revoked, so a vault coming back with another key is caught
+// as a possible man-in-the-middle rather than trusted anew.
+
+// KnownPeer is the sync key a vault was first seen with
+type KnownPeer struct {
+	VaultID     string    `json:"vault_id"`
+	Name        string    `json:"name,omitempty"`
+	PeerID      string    `json:"peer_id"`
+	Fingerprint string    `json:"fingerprint"`
+	FirstSeen   time.Time `json:"first_seen"`
+}
+
+// KeyMismatchError is a vault presenting another sync key than the one it
+// was first seen with
+type KeyMismatchError struct {
+	VaultID   string
+	Name      string
+	Known     KnownPeer
+	Presented string // Fingerprint of the key presented
+}
+
+func (e *KeyMismatchError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = e.Known.Name
+	}
+	return fmt.Sprintf("POSSIBLE MITM ATTACK: vault %s (%s) presented sync key %s, but was first seen on %s with key %s. "+
+		"Someone may be impersonating it. If its sync key was replaced on purpose, check the new fingerprint with its owner, "+
+		"then run 'sietch peer remove --forget %s' and sync again",
+		name, e.VaultID, e.Presented, e.Known.FirstSeen.Local().Format("2006-01-02"), e.Known.Fingerprint, e.VaultID)
+}
+
+// KnownPeersPath returns the path of the vault's first-seen peer keys
+func KnownPeersPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "known-peers.json")
+}
+
+// LoadKnownPeers returns the keys vaults were first seen with. A vault that
+// never saw a peer has none.
+func LoadKnownPeers(vaultRoot string) ([]KnownPeer, error) {
+	data, err := os.ReadFile(KnownPeersPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known peers: %w", err)
+	}
+	var known []KnownPeer
+	if err := json.Unmarshal(data, &known); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", KnownPeersPath(vaultRoot), err)
+	}
+	return known, nil
+}
+
+// SaveKnownPeers replaces the vault's first-seen peer keys
+func SaveKnownPeers(vaultRoot string, known []KnownPeer) error {
+	data, err := json.MarshalIndent(known, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode known peers: %w", err)
+	}
+	path := KnownPeersPath(vaultRoot)
+	if err := os.MkdirAll(filepath.Dir(path), constants.StandardDirPerms); err != nil {
+		return fmt.Errorf("failed to create .sietch directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to write known peers: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write known peers: %w", err)
+	}
+	return nil
+}
+
+// CheckKnownPeer checks the key a vault presents against the one it was
+// first seen with. A vault not seen before passes.
+func CheckKnownPeer(known []KnownPeer, vaultID, name, fingerprint string) error {
+	for _, k := range known {
+		if k.VaultID == vaultID && k.Fingerprint != fingerprint {
+			return &KeyMismatchError{VaultID: vaultID, Name: name, Known: k, Presented: fingerprint}
+		}
+	}
+	return nil
+}
+
+// RememberPeer records the key a vault was first seen with, unless the vault
+// was seen before
+func RememberPeer(vaultRoot string, peer KnownPeer) error {
+	if peer.VaultID == "" {
+		return nil
+	}
+	known, err := LoadKnownPeers(vaultRoot)
+	if err != nil {
+		return err
+	}
+	for _, k := range known {
+		if k.VaultID == peer.VaultID {
+			return nil
+		}
+	}
+	if peer.FirstSeen.IsZero() {
+		peer.FirstSeen = time.Now().UTC()
+	}
+	return SaveKnownPeers(vaultRoot, append(known, peer))
+}
+
+// ForgetPeer drops what was recorded of the vault with vaultID, or of the
+// peer with that peer ID, so its next key is taken as first seen. It
+// reports whether there was anything to forget.
+func ForgetPeer(vaultRoot, id string) (bool, error) {
+	known, err := LoadKnownPeers(vaultRoot)
+	if err != nil {
+		return false, err
+	}
+	kept := known[:0]
+	for _, k := range known {
+		if k.VaultID != id && k.PeerID != id {
+			kept = append(kept, k)
+		}
+	}
+	if len(kept) == len(known) {
+		return false, nil
+	}
+	return true, SaveKnownPeers(vaultRoot, kept)
+}
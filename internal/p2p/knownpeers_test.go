@@ -0,0 +1,94 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// TestCheckKnownPeer ensures only a known vault with another key fails
+func TestCheckKnownPeer(t *testing.T) {
+	known := []KnownPeer{{VaultID: "vault-a", Name: "laptop", PeerID: testPeerID, Fingerprint: "fp-a", FirstSeen: time.Now()}}
+	tests := []struct {
+		name        string
+		vaultID     string
+		fingerprint string
+		wantErr     bool
+	}{
+		{"same key", "vault-a", "fp-a", false},
+		{"changed key", "vault-a", "fp-mitm", true},
+		{"unknown vault", "vault-b", "fp-b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckKnownPeer(known, tt.vaultID, "", tt.fingerprint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckKnownPeer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var mismatch *KeyMismatchError
+			if err != nil && (!errors.As(err, &mismatch) || !strings.Contains(err.Error(), "POSSIBLE MITM")) {
+				t.Errorf("CheckKnownPeer() error = %v, want a loud KeyMismatchError", err)
+			}
+		})
+	}
+}
+
+// TestRememberPeer ensures the first key a vault was seen with is kept
+// until it is forgotten
+func TestRememberPeer(t *testing.T) {
+	vaultRoot := t.TempDir()
+	if err := RememberPeer(vaultRoot, KnownPeer{VaultID: "vault-a", PeerID: testPeerID, Fingerprint: "fp-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RememberPeer(vaultRoot, KnownPeer{VaultID: "vault-a", PeerID: testPeerID, Fingerprint: "fp-b"}); err != nil {
+		t.Fatal(err)
+	}
+	known, err := LoadKnownPeers(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(known) != 1 || known[0].Fingerprint != "fp-a" || known[0].FirstSeen.IsZero() {
+		t.Fatalf("known peers = %+v, want only the first key of vault-a", known)
+	}
+
+	if forgotten, err := ForgetPeer(vaultRoot, testPeerID); err != nil || !forgotten {
+		t.Fatalf("ForgetPeer() = %v, %v; want true", forgotten, err)
+	}
+	if known, _ := LoadKnownPeers(vaultRoot); len(known) != 0 {
+		t.Errorf("known peers = %+v after forgetting, want none", known)
+	}
+	if forgotten, err := ForgetPeer(vaultRoot, "vault-a"); err != nil || forgotten {
+		t.Errorf("ForgetPeer() = %v, %v for a forgotten vault; want false", forgotten, err)
+	}
+}
+
+// TestVerifyRevokedPeer ensures a revoked peer is refused before any key
+// exchange
+func TestVerifyRevokedPeer(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.Decode(testPeerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SyncService{
+		privateKey:   privateKey,
+		trustedPeers: make(map[peer.ID]*PeerInfo),
+		revokedPeers: map[peer.ID]config.TrustedPeer{id: {ID: testPeerID, Name: "laptop", Revoked: true}},
+	}
+	trusted, err := s.VerifyAndExchangeKeys(context.Background(), id)
+	var revoked *RevokedPeerError
+	if trusted || !errors.As(err, &revoked) {
+		t.Errorf("VerifyAndExchangeKeys() = %v, %v; want a RevokedPeerError", trusted, err)
+	}
+}
@@ -0,0 +1,425 @@
+package p2p
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+)
+
+// PlanVersion is the format version of saved sync plans
+const PlanVersion = 1
+
+// SyncPlan is what a sync with a peer would transfer, worked out from both
+// vaults' manifests without moving any data. Saved, it restricts a later sync
+// to the files it lists.
+type SyncPlan struct {
+	Version   int            `json:"version"`
+	VaultID   string         `json:"vault_id"`
+	Peer      string         `json:"peer"`
+	Created   time.Time      `json:"created"`
+	Receive   PlanDirection  `json:"receive"` // What this vault fetches from the peer
+	Send      PlanDirection  `json:"send"`    // What the peer lacks, fetched when it syncs with this vault
+	Conflicts []PlanConflict `json:"conflicts"`
+	Metadata  bool           `json:"metadata"` // The peer's vault tags and metadata are newer and would be taken
+}
+
+// PlanDirection is what one side of a sync is missing of the other's files
+type PlanDirection struct {
+	Files              []PlannedFile `json:"files"`
+	Chunks             []string      `json:"chunks"` // Hashes of the chunks to transfer
+	Packs              []string      `json:"packs"`
+	Dicts              []string      `json:"dicts"`
+	Bytes              int64         `json:"bytes"`               // Chunks and packs to transfer, as stored
+	FileBytes          int64         `json:"file_bytes"`          // Size of the files, before deduplication
+	ChunksDeduplicated int           `json:"chunks_deduplicated"` // Chunks of the files the receiving vault already holds
+}
+
+// PlannedFile is a file a plan transfers
+type PlannedFile struct {
+	Path     string `json:"path,omitempty"` // Vault path; empty when the path is encrypted
+	Identity string `json:"identity"`
+	Size     int64  `json:"size"`
+	Content  string `json:"content"`          // Fingerprint of the file's content when planned
+	Update   bool   `json:"update,omitempty"` // Replaces a version the receiving vault has not changed since the last sync
+}
+
+// PlanConflict is a file both vaults changed since they last synced, or hold
+// in different versions before their first sync
+type PlanConflict struct {
+	Path        string `json:"path,omitempty"`
+	Identity    string `json:"identity"`
+	LocalSize   int64  `json:"local_size"`
+	PeerSize    int64  `json:"peer_size"`
+	PeerContent string `json:"peer_content"`
+	Resolution  string `json:"resolution,omitempty"` // How sync resolves it; empty when it stops the sync
+}
+
+// PlanSync exchanges manifests with a trusted peer and returns what a sync
+// with it would transfer, without fetching anything else
+func (s *SyncService) PlanSync(ctx context.Context, peerID peer.ID) (*SyncPlan, error) {
+	trusted, err := s.VerifyAndExchangeKeys(ctx, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	if !trusted {
+		return nil, fmt.Errorf("peer %s is not trusted", peerID.String())
+	}
+	remote, err := s.getRemoteManifest(ctx, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote manifest: %v", err)
+	}
+	local, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+
+	plan := NewSyncPlan(local, remote)
+	plan.Peer = peerID.String()
+	if s.vaultConfig != nil {
+		plan.VaultID = s.vaultConfig.VaultID
+	}
+	merge, _, err := s.mergeWithPeer(peerID, local, remote)
+	if err != nil {
+		return nil, err
+	}
+	plan.applyMerge(merge)
+
+	// The vault may hold chunks, packs and dictionaries its manifests no
+	// longer mention; sync reuses them instead of fetching
+	receive := &plan.Receive
+	chunks := receive.Chunks[:0]
+	for _, hash := range receive.Chunks {
+		if exists, _ := s.vaultMgr.ChunkExists(hash); exists {
+			receive.ChunksDeduplicated++
+			receive.Bytes -= storedChunkSize(remote, hash)
+			continue
+		}
+		chunks = append(chunks, hash)
+	}
+	receive.Chunks = chunks
+	packs := receive.Packs[:0]
+	for _, id := range receive.Packs {
+		if s.vaultMgr.PackExists(id) {
+			receive.Bytes -= packSize(remote, id)
+			continue
+		}
+		packs = append(packs, id)
+	}
+	receive.Packs = packs
+	dicts := receive.Dicts[:0]
+	for _, id := range receive.Dicts {
+		if !s.vaultMgr.DictionaryExists(id) {
+			dicts = append(dicts, id)
+		}
+	}
+	receive.Dicts = dicts
+
+	if remote.Metadata != nil {
+		if vaultConfig, err := s.vaultMgr.GetConfig(); err == nil {
+			metadata := vaultConfig.Metadata
+			plan.Metadata = config.MergeMetadata(&metadata, remote.Metadata).Updated
+		}
+	}
+	return plan, nil
+}
+
+// NewSyncPlan compares the manifests of the local vault and a peer
+func NewSyncPlan(local, remote *config.Manifest) *SyncPlan {
+	plan := &SyncPlan{
+		Version:   PlanVersion,
+		Created:   time.Now().UTC(),
+		Receive:   planDirection(remote, local),
+		Send:      planDirection(local, remote),
+		Conflicts: []PlanConflict{},
+	}
+
+	localFiles := make(map[string]*config.FileManifest, len(local.Files))
+	for i := range local.Files {
+		localFiles[syncKey(&local.Files[i])] = &local.Files[i]
+	}
+	for i := range remote.Files {
+		remoteFile := &remote.Files[i]
+		localFile, ok := localFiles[syncKey(remoteFile)]
+		if ok && !snapshot.SameContent(localFile, remoteFile) {
+			plan.Conflicts = append(plan.Conflicts, PlanConflict{
+				Path:        filePath(localFile),
+				Identity:    syncKey(remoteFile),
+				LocalSize:   localFile.Size,
+				PeerSize:    remoteFile.Size,
+				PeerContent: ContentFingerprint(remoteFile),
+			})
+		}
+	}
+	sort.Slice(plan.Conflicts, func(i, j int) bool {
+		return plan.Conflicts[i].Identity < plan.Conflicts[j].Identity
+	})
+	return plan
+}
+
+// applyMerge narrows the plan's conflicts to the files both vaults changed
+// since they last synced, with how sync resolves each, and receives the
+// versions only the peer changed
+func (p *SyncPlan) applyMerge(merge *fileMerge) {
+	resolutions := make(map[string]string, len(merge.conflicts))
+	for _, c := range merge.conflicts {
+		resolutions[c.Identity] = c.Resolution
+	}
+	updates := make(map[string]bool, len(merge.update))
+	for _, file := range merge.update {
+		updates[syncKey(&file)] = true
+	}
+
+	conflicts := p.Conflicts[:0]
+	for _, c := range p.Conflicts {
+		if resolution, ok := resolutions[c.Identity]; ok {
+			c.Resolution = resolution
+			conflicts = append(conflicts, c)
+		}
+		if updates[c.Identity] {
+			p.Receive.Files = append(p.Receive.Files, PlannedFile{
+				Path:     c.Path,
+				Identity: c.Identity,
+				Size:     c.PeerSize,
+				Content:  c.PeerContent,
+				Update:   true,
+			})
+			p.Receive.FileBytes += c.PeerSize
+		}
+	}
+	p.Conflicts = conflicts
+}
+
+// planDirection lists what the vault holding to is missing of from: the
+// files it lacks, and the chunks, packs and dictionaries of all of from's
+// files it lacks, as a sync fetches them
+func planDirection(from, to *config.Manifest) PlanDirection {
+	held := make(map[string]bool)
+	heldPacks := make(map[string]bool)
+	heldDicts := make(map[string]bool)
+	files := make(map[string]bool, len(to.Files))
+	for _, file := range to.Files {
+		files[syncKey(&file)] = true
+		if file.Pack != nil {
+			heldPacks[file.Pack.ID] = true
+		}
+		for _, chunk := range file.Chunks {
+			if chunk.Remote {
+				continue
+			}
+			held[chunk.Hash] = true
+			if chunk.EncryptedHash != "" {
+				held[chunk.EncryptedHash] = true
+			}
+			if chunk.CompressionDict != "" {
+				heldDicts[chunk.CompressionDict] = true
+			}
+		}
+	}
+
+	dir := PlanDirection{Files: []PlannedFile{}, Chunks: []string{}, Packs: []string{}, Dicts: []string{}}
+	planned := make(map[string]bool)
+	deduplicated := make(map[string]bool)
+	for i := range from.Files {
+		file := &from.Files[i]
+		newFile := !files[syncKey(file)]
+		if newFile {
+			dir.Files = append(dir.Files, PlannedFile{
+				Path:     filePath(file),
+				Identity: syncKey(file),
+				Size:     file.Size,
+				Content:  ContentFingerprint(file),
+			})
+			dir.FileBytes += file.Size
+		}
+		if file.Pack != nil && !heldPacks[file.Pack.ID] {
+			heldPacks[file.Pack.ID] = true
+			dir.Packs = append(dir.Packs, file.Pack.ID)
+			dir.Bytes += packSize(from, file.Pack.ID)
+		}
+		for _, chunk := range file.Chunks {
+			if chunk.Zero || chunk.Remote {
+				continue
+			}
+			if dict := chunk.CompressionDict; dict != "" && !heldDicts[dict] {
+				heldDicts[dict] = true
+				dir.Dicts = append(dir.Dicts, dict)
+			}
+			if held[chunk.Hash] || (chunk.EncryptedHash != "" && held[chunk.EncryptedHash]) {
+				if newFile && !deduplicated[chunk.Hash] {
+					deduplicated[chunk.Hash] = true
+					dir.ChunksDeduplicated++
+				}
+				continue
+			}
+			if !planned[chunk.Hash] {
+				planned[chunk.Hash] = true
+				dir.Chunks = append(dir.Chunks, chunk.Hash)
+				dir.Bytes += storedSize(chunk)
+			}
+		}
+	}
+	return dir
+}
+
+// ContentFingerprint identifies the content of a file by what its manifest
+// records of it, so a file changed since a plan was made is noticed
+func ContentFingerprint(file *config.FileManifest) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00", file.Type, file.LinkTarget, file.Size, file.ContentHash)
+	if file.Pack != nil {
+		fmt.Fprintf(h, "pack\x00%s\x00", file.Pack.Hash)
+	}
+	for _, chunk := range file.Chunks {
+		fmt.Fprintf(h, "%s\x00", chunk.Hash)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Restrict limits the remote manifest to the files the plan receives and
+// its conflicts, which sync resolves again. A file the peer changed or
+// removed since the plan was made is left out, and the paths of those are
+// returned.
+func (p *SyncPlan) Restrict(remote *config.Manifest) (*config.Manifest, []string) {
+	byContent := make(map[string]*config.FileManifest, len(remote.Files))
+	for i := range remote.Files {
+		byContent[syncKey(&remote.Files[i])+"\x00"+ContentFingerprint(&remote.Files[i])] = &remote.Files[i]
+	}
+	restricted := &config.Manifest{Metadata: remote.Metadata}
+	var changed []string
+	included := make(map[string]bool)
+	include := func(identity, content, displayPath string) {
+		if included[identity] {
+			return
+		}
+		included[identity] = true
+		file, ok := byContent[identity+"\x00"+content]
+		if !ok {
+			changed = append(changed, displayPath)
+			return
+		}
+		restricted.Files = append(restricted.Files, *file)
+	}
+	for _, planned := range p.Receive.Files {
+		include(planned.Identity, planned.Content, planned.DisplayPath())
+	}
+	for _, c := range p.Conflicts {
+		if c.PeerContent != "" { // Missing from plans saved by earlier versions
+			include(c.Identity, c.PeerContent, c.DisplayPath())
+		}
+	}
+	return restricted, changed
+}
+
+// DisplayPath returns the file's vault path, or its identity when the path
+// is encrypted
+func (f PlannedFile) DisplayPath() string {
+	if f.Path != "" {
+		return f.Path
+	}
+	return displayIdentity(f.Identity)
+}
+
+// DisplayPath returns the file's vault path, or its identity when the path
+// is encrypted
+func (c PlanConflict) DisplayPath() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return displayIdentity(c.Identity)
+}
+
+func displayIdentity(identity string) string {
+	if len(identity) > 16 {
+		identity = identity[:16]
+	}
+	return "(encrypted path " + identity + ")"
+}
+
+// syncKey identifies a file across vaults: its vault path, or the keyed hash
+// of the path when it is encrypted. Unlike Identity it tells apart files of
+// the same name in different directories.
+func syncKey(file *config.FileManifest) string {
+	if file.PathID != "" {
+		return file.PathID
+	}
+	return file.Destination + file.FilePath
+}
+
+// filePath returns a file's vault path, empty when it is encrypted
+func filePath(file *config.FileManifest) string {
+	if file.FilePath == "" {
+		return ""
+	}
+	return file.Destination + file.FilePath
+}
+
+// storedSize returns the size of a chunk as it is stored and transferred
+func storedSize(chunk config.ChunkRef) int64 {
+	switch {
+	case chunk.EncryptedSize > 0:
+		return chunk.EncryptedSize
+	case chunk.CompressedSize > 0:
+		return chunk.CompressedSize
+	}
+	return chunk.Size
+}
+
+// storedChunkSize returns the stored size of the chunk with the given hash
+// in m, or 0 if it holds none
+func storedChunkSize(m *config.Manifest, hash string) int64 {
+	for _, file := range m.Files {
+		for _, chunk := range file.Chunks {
+			if chunk.Hash == hash {
+				return storedSize(chunk)
+			}
+		}
+	}
+	return 0
+}
+
+// packSize estimates the size of a pack from the entries m records in it
+func packSize(m *config.Manifest, id string) int64 {
+	var size int64
+	for _, file := range m.Files {
+		if file.Pack != nil && file.Pack.ID == id {
+			size += file.Pack.Length
+		}
+	}
+	return size
+}
+
+// LoadSyncPlan reads a plan saved with Save
+func LoadSyncPlan(path string) (*SyncPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan SyncPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("invalid sync plan %s: %w", path, err)
+	}
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("sync plan %s has unsupported version %d", path, plan.Version)
+	}
+	return &plan, nil
+}
+
+// Save writes the plan to path as JSON
+func (p *SyncPlan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(path, append(data, '\n'), constants.StandardFilePerms)
+}
@@ -0,0 +1,58 @@
+package p2p
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// TestNewSyncPlan ensures a plan lists what each side lacks and the conflicts
+func TestNewSyncPlan(t *testing.T) {
+	local := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+		{FilePath: "notes.txt", Destination: "docs/", Size: 5, Chunks: []config.ChunkRef{{Hash: "h2", Size: 5}}},
+	}}
+	remote := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+		{FilePath: "notes.txt", Destination: "docs/", Size: 6, Chunks: []config.ChunkRef{{Hash: "h3", Size: 6}}},
+		{FilePath: "copy.txt", Destination: "docs/", Size: 20, Chunks: []config.ChunkRef{
+			{Hash: "h1", Size: 10}, {Hash: "h4", Size: 10, EncryptedSize: 38},
+		}},
+	}}
+
+	plan := NewSyncPlan(local, remote)
+	receive := plan.Receive
+	if len(receive.Files) != 1 || receive.Files[0].Path != "docs/copy.txt" {
+		t.Errorf("receive files = %+v, want docs/copy.txt", receive.Files)
+	}
+	// h3 belongs to the conflicting notes.txt; sync fetches it all the same
+	if len(receive.Chunks) != 2 || receive.Bytes != 6+38 || receive.ChunksDeduplicated != 1 || receive.FileBytes != 20 {
+		t.Errorf("receive = %+v", receive)
+	}
+	if len(plan.Send.Files) != 0 || len(plan.Send.Chunks) != 1 {
+		t.Errorf("send = %+v, want only chunk h2", plan.Send)
+	}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Path != "docs/notes.txt" || plan.Conflicts[0].PeerSize != 6 {
+		t.Errorf("conflicts = %+v", plan.Conflicts)
+	}
+
+	// A saved plan restricts a later sync to its files and conflicts, as they were
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := plan.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSyncPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.Files = append(remote.Files, config.FileManifest{FilePath: "new.txt", Size: 1})
+	restricted, changed := loaded.Restrict(remote)
+	if len(restricted.Files) != 2 || restricted.Files[0].FilePath != "copy.txt" || restricted.Files[1].FilePath != "notes.txt" || len(changed) != 0 {
+		t.Errorf("Restrict() = %+v, changed %v", restricted.Files, changed)
+	}
+	remote.Files[2].Chunks[1].Hash = "h5"
+	if restricted, changed := loaded.Restrict(remote); len(restricted.Files) != 1 || len(changed) != 1 {
+		t.Errorf("Restrict() of a changed file = %+v, changed %v", restricted.Files, changed)
+	}
+}
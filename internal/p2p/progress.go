@@ -0,0 +1,145 @@
+package p2p
+
+import (
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Progress event types, in the order a sync emits them
+const (
+	EventSessionStarted = "session_started"
+	EventDiffComputed   = "diff_computed"  // Totals are known
+	EventChunkReceived  = "chunk_received" // A chunk or pack was fetched and stored
+	EventFileCompleted  = "file_completed" // All of a file's data is in the vault
+	EventSessionDone    = "session_done"
+
+	// Emitted by the vault serving a sync for each chunk or pack it sends
+	EventChunkSent = "chunk_sent"
+)
+
+// ProgressEvent reports how far a sync with a peer has got. From
+// diff_computed on it carries the session's totals and what of them is done.
+type ProgressEvent struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Peer  string    `json:"peer"`
+	File  string    `json:"file,omitempty"`  // The file completed, or the chunk was fetched for
+	Chunk string    `json:"chunk,omitempty"` // Hash of the chunk, or ID of the pack
+	Bytes int64     `json:"bytes,omitempty"` // Size of the chunk as stored
+
+	Files      int   `json:"files"`       // Files the peer's versions are taken of
+	Chunks     int   `json:"chunks"`      // Chunks and packs to fetch, not counting those already here
+	TotalBytes int64 `json:"total_bytes"` // Their size as stored, estimated from the peer's manifest
+	FilesDone  int   `json:"files_done"`
+	ChunksDone int   `json:"chunks_done"`
+	BytesDone  int64 `json:"bytes_done"`
+
+	Error string `json:"error,omitempty"` // Why the session failed, in session_done
+}
+
+// syncProgress follows a session and emits its progress events. A nil
+// emit makes it do nothing.
+type syncProgress struct {
+	emit    func(ProgressEvent)
+	state   ProgressEvent // Totals and counts done
+	paths   []string      // Display path of each file
+	missing []int         // Chunks and packs each file still waits for
+	waiting map[string][]int
+}
+
+func newSyncProgress(emit func(ProgressEvent), peerID peer.ID) *syncProgress {
+	return &syncProgress{emit: emit, state: ProgressEvent{Peer: peerID.String()}}
+}
+
+// send emits an event of the given type with the session's state
+func (p *syncProgress) send(event ProgressEvent) {
+	if p.emit == nil {
+		return
+	}
+	state := p.state
+	state.Type, state.Time = event.Type, time.Now().UTC()
+	state.File, state.Chunk, state.Bytes, state.Error = event.File, event.Chunk, event.Bytes, event.Error
+	p.emit(state)
+}
+
+func (p *syncProgress) started() {
+	p.send(ProgressEvent{Type: EventSessionStarted})
+}
+
+// planned records the files a session takes from the peer and the stored
+// size of each chunk and pack it fetches, then emits the totals. Files with
+// nothing left to fetch are complete at once.
+func (p *syncProgress) planned(files []config.FileManifest, fetch map[string]int64) {
+	p.paths = make([]string, len(files))
+	p.missing = make([]int, len(files))
+	p.waiting = make(map[string][]int)
+	for i := range files {
+		file := &files[i]
+		p.paths[i] = filePath(file)
+		if p.paths[i] == "" {
+			p.paths[i] = displayIdentity(syncKey(file))
+		}
+		var needs []string
+		for _, chunk := range file.Chunks {
+			needs = append(needs, chunk.Hash)
+		}
+		if file.Pack != nil {
+			needs = append(needs, file.Pack.ID)
+		}
+		for _, id := range needs {
+			if _, ok := fetch[id]; ok && !slices.Contains(p.waiting[id], i) {
+				p.waiting[id] = append(p.waiting[id], i)
+				p.missing[i]++
+			}
+		}
+	}
+	p.state.Files, p.state.Chunks = len(files), len(fetch)
+	for _, size := range fetch {
+		p.state.TotalBytes += size
+	}
+	p.send(ProgressEvent{Type: EventDiffComputed})
+
+	for i, missing := range p.missing {
+		if missing == 0 {
+			p.fileDone(i)
+		}
+	}
+}
+
+// received counts a fetched chunk or pack and completes the files that
+// waited only for it
+func (p *syncProgress) received(id string, size int64) {
+	p.state.ChunksDone++
+	p.state.BytesDone += size
+	event := ProgressEvent{Type: EventChunkReceived, Chunk: id, Bytes: size}
+	files := p.waiting[id]
+	if len(files) > 0 {
+		event.File = p.paths[files[0]]
+	}
+	p.send(event)
+
+	for _, i := range files {
+		if p.missing[i]--; p.missing[i] == 0 {
+			p.fileDone(i)
+		}
+	}
+	delete(p.waiting, id)
+}
+
+func (p *syncProgress) fileDone(i int) {
+	p.state.FilesDone++
+	p.send(ProgressEvent{Type: EventFileCompleted, File: p.paths[i]})
+}
+
+// done ends the session, with the error that stopped it if any
+func (p *syncProgress) done(err error) {
+	event := ProgressEvent{Type: EventSessionDone}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	p.send(event)
+}
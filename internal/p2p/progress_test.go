@@ -0,0 +1,62 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// TestSyncProgress ensures a file completes once the last chunk or pack it
+// waits for arrives, and the events carry the running totals
+func TestSyncProgress(t *testing.T) {
+	chunks := func(hashes ...string) []config.ChunkRef {
+		var refs []config.ChunkRef
+		for _, hash := range hashes {
+			refs = append(refs, config.ChunkRef{Hash: hash})
+		}
+		return refs
+	}
+	files := []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Chunks: chunks("c1", "c2")},
+		{FilePath: "b.txt", Destination: "docs/", Chunks: chunks("c2", "here")},
+		{FilePath: "small.txt", Destination: "docs/", Pack: &config.PackRef{ID: "pack1"}},
+		{FilePath: "dedup.txt", Destination: "docs/", Chunks: chunks("here")},
+	}
+
+	var events []string
+	progress := newSyncProgress(func(e ProgressEvent) {
+		events = append(events, fmt.Sprintf("%s %s %d/%d %d/%d %d/%d %s", e.Type, e.File,
+			e.FilesDone, e.Files, e.ChunksDone, e.Chunks, e.BytesDone, e.TotalBytes, e.Error))
+	}, "peer-a")
+	progress.started()
+	progress.planned(files, map[string]int64{"c1": 10, "c2": 20, "pack1": 5})
+	progress.received("c1", 10)
+	progress.received("c2", 20)
+	progress.received("pack1", 6)
+	progress.done(errors.New("interrupted"))
+
+	want := []string{
+		"session_started  0/0 0/0 0/0 ",
+		"diff_computed  0/4 0/3 0/35 ",
+		"file_completed docs/dedup.txt 1/4 0/3 0/35 ",
+		"chunk_received docs/a.txt 1/4 1/3 10/35 ",
+		"chunk_received docs/a.txt 1/4 2/3 30/35 ",
+		"file_completed docs/a.txt 2/4 2/3 30/35 ",
+		"file_completed docs/b.txt 3/4 2/3 30/35 ",
+		"chunk_received docs/small.txt 3/4 3/3 36/35 ",
+		"file_completed docs/small.txt 4/4 3/3 36/35 ",
+		"session_done  4/4 3/3 36/35 interrupted",
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Without a receiver nothing is tracked or emitted
+	quiet := newSyncProgress(nil, "peer-a")
+	quiet.planned(files, map[string]int64{"c1": 10})
+	quiet.received("c1", 10)
+	quiet.done(nil)
+}
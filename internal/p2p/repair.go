@@ -0,0 +1,69 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// RepairResult contains statistics about a repair from a peer
+type RepairResult struct {
+	Healed           int      // Chunks fetched, verified and stored
+	Missing          []string // Storage keys of chunks the peer could not supply intact
+	BytesTransferred int64
+}
+
+// RepairChunks asks a trusted peer for exactly the chunks in refs. Each one is
+// checked against its recorded hash before it replaces the local copy, so a
+// peer can only ever restore the bytes the manifests describe. opts supplies
+// the hash algorithm and dictionaries; no key is needed.
+func (s *SyncService) RepairChunks(ctx context.Context, peerID peer.ID, refs []config.ChunkRef, opts chunker.Options) (*RepairResult, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	trusted, err := s.VerifyAndExchangeKeys(timeoutCtx, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	if !trusted {
+		return nil, fmt.Errorf("peer %s is not trusted; sync with it once to trust it", peerID.String())
+	}
+
+	result := &RepairResult{}
+	vaultRoot := s.vaultMgr.VaultRoot()
+	for _, ref := range refs {
+		key := chunker.StorageKey(ref)
+		data, _, err := s.fetchChunk(timeoutCtx, peerID, ref.Hash, ref.EncryptedHash)
+		if err == nil {
+			err = chunker.CheckStored(ref, data, opts)
+		}
+		if err != nil {
+			if s.Verbose {
+				fmt.Printf("Could not repair chunk %s: %v\n", key, err)
+			}
+			result.Missing = append(result.Missing, key)
+			continue
+		}
+
+		// A corrupt copy under an older layout would otherwise still be found first
+		// A packed copy is not, since chunk files are found before chunk packs
+		if loc, ok := layout.LocateChunk(vaultRoot, key); ok && !loc.Packed() && loc.Path != layout.ChunkPath(vaultRoot, key) {
+			if err := os.Remove(loc.Path); err != nil {
+				return result, fmt.Errorf("failed to remove corrupt chunk %s: %v", loc.Path, err)
+			}
+		}
+		if err := s.vaultMgr.StoreChunk(key, data); err != nil {
+			return result, fmt.Errorf("failed to store chunk %s: %w", key, err)
+		}
+		result.Healed++
+		result.BytesTransferred += int64(len(data))
+	}
+	return result, nil
+}
@@ -0,0 +1,365 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Peers only reachable over SSH are synced with like git does: ssh runs
+// 'sietch sync --serve-stdio' on the host, which starts a node on its
+// loopback interface, prints StdioHello and its peer ID, and then relays its
+// stdin and stdout to the node. Locally the ssh process is bridged to a
+// loopback port the host dials, so the usual libp2p handshake, sync
+// protocols and peer trust checks run unchanged over the SSH connection.
+
+// StdioHello starts the line 'sync --serve-stdio' prints before relaying
+const StdioHello = "sietch-stdio/1"
+
+// helloLimit is how much output the remote shell may print before the hello,
+// e.g. a message of the day
+const helloLimit = 64 * 1024
+
+// SSHAddress is a peer reached over SSH: ssh://[user@]host[:port]/path
+type SSHAddress struct {
+	User string
+	Host string
+	Port string
+	Path string // Vault path on the host; relative to the home directory when given as /~/path
+}
+
+// IsSSHAddress reports whether a peer address is an ssh:// URL
+func IsSSHAddress(addr string) bool {
+	return strings.HasPrefix(addr, "ssh://")
+}
+
+// ParseSSHAddress parses an ssh://[user@]host[:port]/path peer address
+func ParseSSHAddress(addr string) (*SSHAddress, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH peer address %q: %v", addr, err)
+	}
+	if u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid SSH peer address %q (expected ssh://[user@]host[:port]/path/to/vault)", addr)
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return nil, fmt.Errorf("invalid SSH peer address %q: passwords are not accepted in the address; ssh asks for them", addr)
+	}
+	// ssh would take either for an option, e.g. ssh://-oProxyCommand=.../
+	if strings.HasPrefix(u.Hostname(), "-") || strings.HasPrefix(u.User.Username(), "-") {
+		return nil, fmt.Errorf("invalid SSH peer address %q: host and user cannot start with '-'", addr)
+	}
+	path := u.Path
+	switch {
+	case path == "" || path == "/":
+		return nil, fmt.Errorf("SSH peer address %q names no vault path", addr)
+	case path == "/~":
+		path = "."
+	case strings.HasPrefix(path, "/~/"):
+		path = strings.TrimPrefix(path, "/~/")
+	}
+	return &SSHAddress{User: u.User.Username(), Host: u.Hostname(), Port: u.Port(), Path: path}, nil
+}
+
+// SSHOptions are how DialSSH runs sietch on the host
+type SSHOptions struct {
+	Command      []string  // ssh and its options; "ssh" when empty
+	RemoteSietch string    // Command running sietch on the host; "sietch" when empty
+	Stderr       io.Writer // Also receives what the host writes to stderr when set
+}
+
+// SSHTunnel is a running 'sietch sync --serve-stdio' on an SSH host, reached
+// by dialing Addr
+type SSHTunnel struct {
+	PeerID peer.ID             // Peer ID of the node on the host
+	Addr   multiaddr.Multiaddr // Loopback address bridged to the node
+
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	listener net.Listener
+	done     chan struct{} // Closed once the ssh process exited
+	closing  sync.Once
+}
+
+// DialSSH runs sietch on the host of addr over ssh and bridges it to a
+// loopback address, waiting until the host's node is up. ssh authenticates
+// with the user's usual keys, agent and configuration. Canceling ctx kills
+// the ssh process.
+func DialSSH(ctx context.Context, addr *SSHAddress, opts SSHOptions) (*SSHTunnel, error) {
+	command := opts.Command
+	if len(command) == 0 {
+		command = []string{"ssh"}
+	}
+	remoteSietch := opts.RemoteSietch
+	if remoteSietch == "" {
+		remoteSietch = "sietch"
+	}
+	args := append([]string{}, command[1:]...)
+	if addr.Port != "" {
+		args = append(args, "-p", addr.Port)
+	}
+	destination := addr.Host
+	if addr.User != "" {
+		destination = addr.User + "@" + addr.Host
+	}
+	// Past "--" ssh takes nothing for an option, whatever the destination
+	// starts with. It hands the command to the remote shell, which would
+	// split the path.
+	args = append(args, "--", destination, remoteSietch+" --vault "+shellQuote(addr.Path)+" sync --serve-stdio")
+
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &tailBuffer{limit: 4096}
+	cmd.Stderr = stderr
+	if opts.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(stderr, opts.Stderr)
+	}
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%s not found; install an OpenSSH client or set SIETCH_SSH_COMMAND", command[0])
+		}
+		return nil, fmt.Errorf("failed to run %s: %v", command[0], err)
+	}
+
+	reader := bufio.NewReader(stdout)
+	peerID, helloErr := readHello(reader)
+	if helloErr != nil {
+		_ = stdin.Close()
+		if errors.Is(helloErr, errTooMuchOutput) {
+			_ = cmd.Process.Kill()
+		}
+		waitErr := cmd.Wait()
+		return nil, sshSetupError(addr, remoteSietch, helloErr, waitErr, stderr.String())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("failed to open a loopback port for the SSH connection: %v", err)
+	}
+	maddr, err := manet.FromNetAddr(listener.Addr())
+	if err != nil {
+		_ = listener.Close()
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+
+	t := &SSHTunnel{PeerID: peerID, Addr: maddr, cmd: cmd, stdin: stdin, listener: listener, done: make(chan struct{})}
+	go func() {
+		_ = cmd.Wait()
+		close(t.done)
+	}()
+	go func() {
+		// Only the node's own dial is bridged, once
+		conn, err := listener.Accept()
+		_ = listener.Close()
+		if err != nil {
+			_ = stdin.Close()
+			return
+		}
+		splice(conn, reader, stdin)
+	}()
+	return t, nil
+}
+
+// Close ends the SSH connection, letting sietch on the host exit on its own
+// for a few seconds before killing ssh
+func (t *SSHTunnel) Close() error {
+	t.closing.Do(func() {
+		_ = t.listener.Close()
+		_ = t.stdin.Close()
+		select {
+		case <-t.done:
+		case <-time.After(5 * time.Second):
+			_ = t.cmd.Process.Kill()
+			<-t.done
+		}
+	})
+	return nil
+}
+
+// ServeStdio announces the node peerID on out, then relays in and out to the
+// node listening at nodeAddr until either side closes
+func ServeStdio(ctx context.Context, nodeAddr multiaddr.Multiaddr, peerID peer.ID, in io.Reader, out io.WriteCloser) error {
+	var dialer manet.Dialer
+	conn, err := dialer.DialContext(ctx, nodeAddr)
+	if err != nil {
+		return fmt.Errorf("failed to reach the sync node: %v", err)
+	}
+	if _, err := fmt.Fprintf(out, "%s %s\n", StdioHello, peerID); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to announce the sync node: %v", err)
+	}
+	splice(conn, in, out)
+	return nil
+}
+
+// splice copies between conn and the in/out pair until either direction
+// ends, then closes both
+func splice(conn net.Conn, in io.Reader, out io.WriteCloser) {
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			_ = conn.Close()
+			_ = out.Close()
+		})
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(out, conn)
+		closeBoth()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(conn, in)
+		closeBoth()
+	}()
+	wg.Wait()
+}
+
+var errTooMuchOutput = errors.New("too much output before the sync node started")
+
+// helloError is output from the host that is not a hello sietch understands
+type helloError struct {
+	output string
+}
+
+func (e *helloError) Error() string {
+	return fmt.Sprintf("unexpected output %q", e.output)
+}
+
+// readHello skips what the remote shell prints until the hello of 'sync
+// --serve-stdio' and returns the peer ID it announces
+func readHello(r *bufio.Reader) (peer.ID, error) {
+	read := 0
+	for read < helloLimit {
+		line, err := r.ReadString('\n')
+		read += len(line)
+		line = strings.TrimRight(line, "\r\n")
+		if rest, ok := strings.CutPrefix(line, StdioHello+" "); ok {
+			peerID, err := peer.Decode(strings.TrimSpace(rest))
+			if err != nil {
+				return "", &helloError{output: line}
+			}
+			return peerID, nil
+		}
+		if strings.HasPrefix(line, "sietch-stdio/") {
+			// A version of the relay this sietch does not speak
+			return "", &helloError{output: line}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+	}
+	return "", errTooMuchOutput
+}
+
+// sshSetupError explains why sietch on the host did not start serving,
+// from ssh's exit status and what the host wrote to stderr
+func sshSetupError(addr *SSHAddress, remoteSietch string, helloErr, waitErr error, stderr string) error {
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	lastLine := lastLine(stderr)
+
+	var hello *helloError
+	switch {
+	case errors.As(helloErr, &hello):
+		return fmt.Errorf("sietch on %s speaks another sync protocol (%s); install the same sietch version on both machines", addr.Host, hello.output)
+	case errors.Is(helloErr, errTooMuchOutput):
+		return fmt.Errorf("sietch on %s did not start: %v; check what the remote shell prints at login", addr.Host, helloErr)
+	case exitCode == 255:
+		// ssh itself failed: unknown host, refused connection or authentication
+		if lastLine == "" {
+			return fmt.Errorf("failed to connect to %s over SSH", addr.Host)
+		}
+		return fmt.Errorf("failed to connect to %s over SSH: %s", addr.Host, lastLine)
+	case exitCode == 127 || strings.Contains(stderr, "command not found"):
+		return fmt.Errorf("%s is not installed on %s, or not on the PATH of non-interactive SSH sessions; give its full path with --remote-sietch", remoteSietch, addr.Host)
+	case strings.Contains(stderr, "unknown flag: --serve-stdio"):
+		return fmt.Errorf("sietch on %s is too old to sync over SSH; upgrade it there", addr.Host)
+	}
+	if errorLine := errorLine(stderr); errorLine != "" {
+		return fmt.Errorf("sietch on %s cannot serve %s: %s", addr.Host, addr.Path, errorLine)
+	}
+	if lastLine != "" {
+		return fmt.Errorf("sietch on %s exited before serving %s: %s", addr.Host, addr.Path, lastLine)
+	}
+	if waitErr != nil {
+		return fmt.Errorf("sietch on %s exited before serving %s: %v", addr.Host, addr.Path, waitErr)
+	}
+	return fmt.Errorf("sietch on %s exited before serving %s", addr.Host, addr.Path)
+}
+
+// errorLine returns the message of the last "Error: " line sietch printed
+func errorLine(output string) string {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if msg, ok := strings.CutPrefix(strings.TrimSpace(lines[i]), "Error: "); ok {
+			return msg
+		}
+	}
+	return ""
+}
+
+// lastLine returns the last non-empty line of output
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	data  []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = b.data[len(b.data)-b.limit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
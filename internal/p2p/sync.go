@@ -5,14 +5,14 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/host"
@@ -21,7 +21,10 @@ import (
 	"github.com/libp2p/go-libp2p/core/protocol"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/layout"
 	"github.com/substantialcattle5/sietch/internal/manifest" //golangci-lint error
+	"github.com/substantialcattle5/sietch/pkg/chunker"
 )
 
 const (
@@ -40,30 +43,71 @@ const (
 type SyncService struct {
 	host          host.Host
 	vaultMgr      *config.Manager
-	privateKey    *rsa.PrivateKey
-	publicKey     *rsa.PublicKey
+	privateKey    crypto.Signer    // *rsa.PrivateKey or ed25519.PrivateKey
+	publicKey     crypto.PublicKey // *rsa.PublicKey or ed25519.PublicKey
 	rsaConfig     *config.RSAConfig
 	trustedPeers  map[peer.ID]*PeerInfo
+	revokedPeers  map[peer.ID]config.TrustedPeer // Trust list entries revoked; neither synced with nor served
 	vaultConfig   *config.VaultConfig
-	trustAllPeers bool // New flag to automatically trust all peers
+	trustAllPeers bool // Serve peers that are not in the trust list
 	Verbose       bool // Enable verbose debug output
+
+	// ConflictStrategy resolves files both vaults changed since they last
+	// synced: one of constants.ConflictStrategies, empty for manual
+	ConflictStrategy string
+
+	// ChunkOptions decode received chunks before they are stored, so a chunk
+	// that decompresses past its recorded size is refused. Nil skips the check,
+	// as when the vault key needs a passphrase; reads still enforce the limit.
+	ChunkOptions *chunker.Options
+
+	// Progress receives the events of syncs with peers and of the chunks sent
+	// to them; nil emits none. Chunks are served on their own goroutines, so
+	// it must be safe for concurrent use.
+	Progress func(ProgressEvent)
+
+	bandwidth atomic.Pointer[bandwidthLimits] // Set by SetBandwidthLimit; nil is unlimited
+	plan      *SyncPlan                       // Set by SetPlan; nil syncs everything
 }
 
 // PeerInfo contains information about a trusted peer
 type PeerInfo struct {
 	ID           peer.ID
-	PublicKey    *rsa.PublicKey
+	PublicKey    crypto.PublicKey // *rsa.PublicKey or ed25519.PublicKey
 	Fingerprint  string
 	Name         string
+	VaultID      string // Set once the peer authenticated
 	TrustedSince time.Time
 }
 
+// RevokedPeerError is a sync refused because the peer was revoked
+type RevokedPeerError struct {
+	Peer config.TrustedPeer
+}
+
+func (e *RevokedPeerError) Error() string {
+	name := e.Peer.Name
+	if name == "" {
+		name = e.Peer.ID
+	}
+	return fmt.Sprintf("peer %s was revoked on %s and is not synced with; 'sietch peer revoke --undo %s' trusts it again",
+		name, e.Peer.RevokedAt.Local().Format("2006-01-02"), name)
+}
+
 // SyncResult contains statistics about a sync operation
 type SyncResult struct {
 	FileCount          int
 	ChunksTransferred  int
 	ChunksDeduplicated int
+	ChunksResumed      int // Received by an earlier, interrupted sync with the peer
+	PacksTransferred   int
+	DictsTransferred   int
 	BytesTransferred   int64
+	MetadataUpdated    bool       // The peer's newer vault tags and metadata were taken
+	MetadataConflict   bool       // Both sides edited them; the newer edit won
+	PlanSkipped        int        // Files of the sync plan the peer changed since it was made
+	FilesUpdated       int        // Files replaced by the peer's version
+	Conflicts          []Conflict // Files both sides changed since the last sync, as resolved
 	Duration           time.Duration
 }
 
@@ -85,12 +129,13 @@ func NewSyncService(h host.Host, vm *config.Manager) (*SyncService, error) {
 	return s, nil
 }
 
-// NewSecureSyncService creates a new secure sync service with RSA key support
+// NewSecureSyncService creates a new secure sync service using the vault's
+// sync identity, which may be an RSA or Ed25519 key pair
 func NewSecureSyncService(
 	h host.Host,
 	vm *config.Manager,
-	privateKey *rsa.PrivateKey,
-	publicKey *rsa.PublicKey,
+	privateKey crypto.Signer,
+	publicKey crypto.PublicKey,
 	rsaConfig *config.RSAConfig,
 ) (*SyncService, error) {
 	// Load vault configuration
@@ -106,6 +151,7 @@ func NewSecureSyncService(
 		publicKey:     publicKey,
 		rsaConfig:     rsaConfig,
 		trustedPeers:  make(map[peer.ID]*PeerInfo),
+		revokedPeers:  make(map[peer.ID]config.TrustedPeer),
 		vaultConfig:   vaultConfig,
 		trustAllPeers: true, // Trust all peers by default
 	}
@@ -119,32 +165,25 @@ func NewSecureSyncService(
 				fmt.Printf("Warning: Failed to decode peer ID %s: %v\n", trustedPeer.ID, err)
 				continue
 			}
-
-			// Parse the public key
-			block, _ := pem.Decode([]byte(trustedPeer.PublicKey))
-			if block == nil {
-				fmt.Printf("Warning: Failed to decode public key for peer %s\n", trustedPeer.ID)
+			if trustedPeer.Revoked {
+				s.revokedPeers[peerID] = trustedPeer
 				continue
 			}
 
-			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			// Parse the public key
+			publicKey, err := keys.ParseSyncPublicKeyPEM([]byte(trustedPeer.PublicKey))
 			if err != nil {
 				fmt.Printf("Warning: Failed to parse public key for peer %s: %v\n", trustedPeer.ID, err)
 				continue
 			}
 
-			rsaPublicKey, ok := pub.(*rsa.PublicKey)
-			if !ok {
-				fmt.Printf("Warning: Public key for peer %s is not an RSA key\n", trustedPeer.ID)
-				continue
-			}
-
 			// Add to trusted peers map
 			s.trustedPeers[peerID] = &PeerInfo{
 				ID:           peerID,
-				PublicKey:    rsaPublicKey,
+				PublicKey:    publicKey,
 				Fingerprint:  trustedPeer.Fingerprint,
 				Name:         trustedPeer.Name,
+				VaultID:      trustedPeer.VaultID,
 				TrustedSince: trustedPeer.TrustedSince,
 			}
 		}
@@ -210,67 +249,27 @@ func (s *SyncService) handleKeyExchange(stream network.Stream) {
 		}
 	}
 
-	// Parse peer's public key
-	block, _ := pem.Decode(pemData)
-	if block == nil {
-		fmt.Println("Failed to decode peer's public key: empty block")
-		return
-	}
-
-	// Support different key formats
-	var peerPubKey *rsa.PublicKey
-	var err error
-
-	switch block.Type {
-	case "RSA PUBLIC KEY":
-		// Try PKCS1 format
-		directKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
-		if err != nil {
-			fmt.Printf("Failed to parse as PKCS1: %v\n", err)
-		} else {
-			peerPubKey = directKey
-		}
-	case "PUBLIC KEY":
-		// Try PKIX format
-		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
-		if err != nil {
-			fmt.Printf("Failed to parse peer's public key: %v\n", err)
-			return
-		}
-		var ok bool
-		peerPubKey, ok = pub.(*rsa.PublicKey)
-		if !ok {
-			fmt.Println("Peer's key is not an RSA public key")
-			return
-		}
-	default:
-		fmt.Printf("Unknown key format: %s\n", block.Type)
+	// Parse peer's public key (RSA or Ed25519)
+	peerPubKey, err := keys.ParseSyncPublicKeyPEM(pemData)
+	if err != nil {
+		fmt.Printf("Failed to parse peer's public key: %v\n", err)
 		return
 	}
 
 	// Calculate fingerprint
-	publicKeyDER, err := x509.MarshalPKIXPublicKey(peerPubKey)
+	fingerprint, err := keys.SyncKeyFingerprint(peerPubKey)
 	if err != nil {
 		fmt.Printf("Failed to marshal peer's public key: %v\n", err)
 		return
 	}
 
-	hash := sha256.Sum256(publicKeyDER)
-	fingerprint := base64.StdEncoding.EncodeToString(hash[:])
-
 	// Send our public key in response
-	ourPublicKeyDER, err := x509.MarshalPKIXPublicKey(s.publicKey)
+	ourPubKeyPEM, err := keys.EncodeSyncPublicKeyPEM(s.publicKey)
 	if err != nil {
 		fmt.Printf("Failed to marshal our public key: %v\n", err)
 		return
 	}
 
-	ourPublicKeyBlock := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: ourPublicKeyDER,
-	}
-
-	ourPubKeyPEM := pem.EncodeToMemory(ourPublicKeyBlock)
 	_, err = stream.Write(ourPubKeyPEM)
 	if err != nil {
 		fmt.Printf("Failed to send our public key: %v\n", err)
@@ -306,8 +305,7 @@ func (s *SyncService) handleAuthentication(stream network.Stream) {
 	}
 
 	// Sign the challenge with our private key
-	challengeHash := sha256.Sum256(challenge.Challenge)
-	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, challengeHash[:])
+	signature, err := keys.SignChallenge(s.privateKey, challenge.Challenge)
 	if err != nil {
 		fmt.Printf("Error signing challenge: %v\n", err)
 		return
@@ -330,11 +328,30 @@ func (s *SyncService) handleAuthentication(stream network.Stream) {
 	}
 }
 
+// rejectRevoked answers a request from a revoked peer with an error,
+// reporting whether it did
+func (s *SyncService) rejectRevoked(stream network.Stream, peerID peer.ID) bool {
+	if _, ok := s.revokedPeers[peerID]; !ok {
+		return false
+	}
+	fmt.Printf("Rejecting request from revoked peer: %s\n", peerID.String())
+	errorResponse := struct {
+		Error string `json:"error"`
+	}{
+		Error: "Unauthorized: Peer revoked",
+	}
+	_ = json.NewEncoder(stream).Encode(errorResponse)
+	return true
+}
+
 // handleManifestRequest processes requests for vault manifests
 func (s *SyncService) handleManifestRequest(stream network.Stream) {
 	defer stream.Close()
 
 	peerID := stream.Conn().RemotePeer()
+	if s.rejectRevoked(stream, peerID) {
+		return
+	}
 
 	// If we have RSA keys and not trusting all peers, verify the peer is trusted
 	if s.privateKey != nil && !s.trustAllPeers {
@@ -368,11 +385,15 @@ func (s *SyncService) handleManifestRequest(stream network.Stream) {
 
 	// Prepare response with correct structure
 	response := struct {
-		Files []*config.FileManifest `json:"files"`
-		Error string                 `json:"error,omitempty"`
+		Files    []*config.FileManifest `json:"files"`
+		Metadata *config.MetadataConfig `json:"metadata,omitempty"`
+		Error    string                 `json:"error,omitempty"`
 	}{
 		Files: make([]*config.FileManifest, len(manifest.Files)),
 	}
+	if vaultConfig, err := s.vaultMgr.GetConfig(); err == nil {
+		response.Metadata = &vaultConfig.Metadata
+	}
 
 	// Convert from value to pointer slices
 	for i := range manifest.Files {
@@ -382,7 +403,7 @@ func (s *SyncService) handleManifestRequest(stream network.Stream) {
 
 	// Encode and send the manifest with timeout
 	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
-	if err := json.NewEncoder(stream).Encode(response); err != nil {
+	if err := json.NewEncoder(s.throttle(stream)).Encode(response); err != nil {
 		fmt.Printf("Error sending manifest: %v\n", err)
 	}
 }
@@ -392,6 +413,9 @@ func (s *SyncService) handleChunkRequest(stream network.Stream) {
 	defer stream.Close()
 
 	peerID := stream.Conn().RemotePeer()
+	if s.rejectRevoked(stream, peerID) {
+		return
+	}
 
 	// If we have RSA keys and not trusting all peers, verify the peer is trusted
 	var peerInfo *PeerInfo
@@ -420,7 +444,7 @@ func (s *SyncService) handleChunkRequest(stream network.Stream) {
 		IsEncrypted   bool   `json:"is_encrypted"`
 	}
 
-	if err := json.NewDecoder(stream).Decode(&chunkRequest); err != nil {
+	if err := json.NewDecoder(s.throttle(stream)).Decode(&chunkRequest); err != nil {
 		fmt.Printf("Error reading chunk request: %v\n", err)
 		return
 	}
@@ -459,10 +483,15 @@ func (s *SyncService) handleChunkRequest(stream network.Stream) {
 		return
 	}
 
-	// If using RSA encryption, encrypt the chunk for the recipient
+	// If both sides have RSA identities, encrypt the chunk for the recipient.
+	// Ed25519 keys can only sign, so those transfers rely on the libp2p
+	// transport encryption alone.
 	var encryptedData []byte
-	if s.privateKey != nil && peerInfo != nil && peerInfo.PublicKey != nil {
-		encryptedData = s.encryptLargeData(chunkData, peerInfo.PublicKey)
+	peerRSAKey, peerHasRSA := peerPublicRSAKey(peerInfo)
+	_, weHaveRSA := s.privateKey.(*rsa.PrivateKey)
+	encrypted := weHaveRSA && peerHasRSA
+	if encrypted {
+		encryptedData = s.encryptLargeData(chunkData, peerRSAKey)
 	} else {
 		encryptedData = chunkData
 	}
@@ -476,14 +505,28 @@ func (s *SyncService) handleChunkRequest(stream network.Stream) {
 	}{
 		Size:      len(chunkData),
 		Data:      encryptedData,
-		Encrypted: (s.privateKey != nil && peerInfo != nil),
+		Encrypted: encrypted,
 	}
 
-	if err := json.NewEncoder(stream).Encode(response); err != nil {
+	if err := json.NewEncoder(s.throttle(stream)).Encode(response); err != nil {
 		fmt.Printf("Error sending chunk: %v\n", err)
+		return
+	}
+	if s.Progress != nil {
+		s.Progress(ProgressEvent{Type: EventChunkSent, Time: time.Now().UTC(), Peer: peerID.String(),
+			Chunk: chunkRequest.Hash, Bytes: int64(len(chunkData))})
 	}
 }
 
+// peerPublicRSAKey returns the peer's public key when it is an RSA key
+func peerPublicRSAKey(peerInfo *PeerInfo) (*rsa.PublicKey, bool) {
+	if peerInfo == nil {
+		return nil, false
+	}
+	publicKey, ok := peerInfo.PublicKey.(*rsa.PublicKey)
+	return publicKey, ok
+}
+
 // encryptLargeData encrypts data that may be larger than RSA can handle in one block
 func (s *SyncService) encryptLargeData(data []byte, publicKey *rsa.PublicKey) []byte {
 	result := []byte{}
@@ -516,8 +559,14 @@ func (s *SyncService) encryptLargeData(data []byte, publicKey *rsa.PublicKey) []
 func (s *SyncService) decryptLargeData(data []byte) []byte {
 	result := []byte{}
 
+	privateKey, ok := s.privateKey.(*rsa.PrivateKey)
+	if !ok {
+		fmt.Println("Warning: cannot decrypt chunk data without an RSA private key")
+		return result
+	}
+
 	// Process data in chunks based on key size
-	chunkSize := s.privateKey.Size()
+	chunkSize := privateKey.Size()
 
 	for i := 0; i < len(data); i += chunkSize {
 		end := min(i+chunkSize, len(data))
@@ -528,7 +577,7 @@ func (s *SyncService) decryptLargeData(data []byte) []byte {
 			continue
 		}
 
-		decryptedChunk, err := rsa.DecryptPKCS1v15(rand.Reader, s.privateKey, chunk)
+		decryptedChunk, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, chunk)
 		if err != nil {
 			fmt.Printf("Error decrypting chunk: %v\n", err)
 			continue
@@ -541,157 +590,133 @@ func (s *SyncService) decryptLargeData(data []byte) []byte {
 	return result
 }
 
-// VerifyAndExchangeKeys performs key exchange with a peer
+// VerifyAndExchangeKeys exchanges sync keys with a peer, has it prove it
+// holds its key and checks the key against the one its vault was first seen
+// with. It reports whether the peer is in the vault's trust list; a peer that
+// is not is for the caller to trust on first use. A revoked peer or a vault
+// presenting another key is an error.
 func (s *SyncService) VerifyAndExchangeKeys(ctx context.Context, peerID peer.ID) (bool, error) {
-	// Don't return early with trustAllPeers, just mark for later
-	needsKeyExchange := true
-	autoTrust := s.trustAllPeers
-
-	// Check if already trusted
-	if _, ok := s.trustedPeers[peerID]; ok {
-		autoTrust = true
-		// We might still need to exchange keys if fingerprint is missing
-		if s.trustedPeers[peerID].Fingerprint != "" && s.trustedPeers[peerID].PublicKey != nil {
-			needsKeyExchange = false
-		}
-	}
-
 	// If no RSA keys, return true (no verification needed)
 	if s.privateKey == nil {
 		return true, nil
 	}
+	if revoked, ok := s.revokedPeers[peerID]; ok {
+		return false, &RevokedPeerError{Peer: revoked}
+	}
 
-	// Do key exchange if needed
-	if needsKeyExchange {
-		// Create stream and exchange keys as in original code
-		timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-		defer cancel()
-
-		stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(KeyExchangeProtocol))
-		if err != nil {
-			// Check if we already have peer info from reverse connection
-			if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
-				fmt.Printf("Failed to open stream, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
-				return true, nil
-			}
-			return false, fmt.Errorf("failed to open key exchange stream: %w", err)
+	peerInfo, ok := s.trustedPeers[peerID]
+	if !ok || peerInfo.Fingerprint == "" || peerInfo.PublicKey == nil {
+		if err := s.exchangeKeys(ctx, peerID); err != nil {
+			return false, err
 		}
-		defer stream.Close()
+		peerInfo = s.trustedPeers[peerID]
+	}
 
-		// Use connection deadline instead of separate read/write deadlines
-		_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
-		_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
-		// Send our public key
-		publicKeyDER, err := x509.MarshalPKIXPublicKey(s.publicKey)
-		if err != nil {
-			return false, fmt.Errorf("failed to marshal public key: %w", err)
+	// Authenticating tells the peer's vault ID, which its key is checked by
+	if peerInfo.VaultID == "" {
+		if err := s.authenticatePeer(ctx, peerID); err != nil {
+			delete(s.trustedPeers, peerID)
+			return false, fmt.Errorf("authentication failed: %w", err)
 		}
+	}
+	if err := CheckKnownPeer(s.knownPeers(), peerInfo.VaultID, peerInfo.Name, peerInfo.Fingerprint); err != nil {
+		return false, err
+	}
+	if !s.IsTrusted(peerID) {
+		return false, nil
+	}
+	// Peers trusted before first-seen keys were kept are recorded now
+	s.rememberPeer(peerInfo)
+	return true, nil
+}
 
-		publicKeyBlock := &pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: publicKeyDER,
-		}
+// exchangeKeys sends the vault's sync public key to a peer and records the
+// one it answers with
+func (s *SyncService) exchangeKeys(ctx context.Context, peerID peer.ID) error {
+	// Create stream and exchange keys
+	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-		publicKeyPEM := pem.EncodeToMemory(publicKeyBlock)
-		_, err = stream.Write(publicKeyPEM)
-		if err != nil {
-			return false, fmt.Errorf("failed to send public key: %w", err)
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(KeyExchangeProtocol))
+	if err != nil {
+		// Check if we already have peer info from reverse connection
+		if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
+			fmt.Printf("Failed to open stream, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
+			return nil
 		}
+		return fmt.Errorf("failed to open key exchange stream: %w", err)
+	}
+	defer stream.Close()
 
-		// Read peer's public key in chunks
-		var pemData []byte
-		buffer := make([]byte, 1024)
-		for {
-			n, err := stream.Read(buffer)
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				// Check if we already have peer info from reverse connection
-				if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
-					fmt.Printf("Read error, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
-					return true, nil
-				}
-				return false, fmt.Errorf("failed reading key data: %w", err)
-			}
-			pemData = append(pemData, buffer[:n]...)
+	// Use connection deadline instead of separate read/write deadlines
+	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
+	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	// Send our public key
+	publicKeyPEM, err := keys.EncodeSyncPublicKeyPEM(s.publicKey)
+	if err != nil {
+		return err
+	}
 
-			// Check if we have a complete PEM block
-			if block, _ := pem.Decode(pemData); block != nil {
-				// If we got a complete block, we can stop reading
-				break
-			}
-		}
+	_, err = stream.Write(publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to send public key: %w", err)
+	}
 
-		// Parse peer's public key
-		block, _ := pem.Decode(pemData)
-		if block == nil {
+	// Read peer's public key in chunks
+	var pemData []byte
+	buffer := make([]byte, 1024)
+	for {
+		n, err := stream.Read(buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
 			// Check if we already have peer info from reverse connection
 			if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
-				fmt.Printf("Failed to decode PEM block, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
-				return true, nil
-			}
-			return false, fmt.Errorf("failed to decode peer's public key: empty block")
-		}
-
-		// Support different key formats
-		var peerPubKey *rsa.PublicKey
-		var pub interface{}
-
-		switch block.Type {
-		case "RSA PUBLIC KEY":
-			// Try PKCS1 format
-			directKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
-			if err != nil {
-				fmt.Printf("Failed to parse as PKCS1: %v\n", err)
-			} else {
-				peerPubKey = directKey
-			}
-		case "PUBLIC KEY":
-			// Try PKIX format
-			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
-			if err != nil {
-				return false, fmt.Errorf("failed to parse PKIX public key: %w", err)
+				fmt.Printf("Read error, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
+				return nil
 			}
-			var ok bool
-			peerPubKey, ok = pub.(*rsa.PublicKey)
-			if !ok {
-				return false, fmt.Errorf("peer's key is not an RSA public key")
-			}
-		default:
-			return false, fmt.Errorf("unknown key format: %s", block.Type)
+			return fmt.Errorf("failed reading key data: %w", err)
 		}
+		pemData = append(pemData, buffer[:n]...)
 
-		// Calculate fingerprint
-		peerKeyDER, err := x509.MarshalPKIXPublicKey(peerPubKey)
-		if err != nil {
-			return false, fmt.Errorf("failed to marshal peer's public key: %w", err)
+		// Check if we have a complete PEM block
+		if block, _ := pem.Decode(pemData); block != nil {
+			// If we got a complete block, we can stop reading
+			break
 		}
+	}
 
-		hash := sha256.Sum256(peerKeyDER)
-		fingerprint := base64.StdEncoding.EncodeToString(hash[:])
-
-		// Store peer info
-		s.trustedPeers[peerID] = &PeerInfo{
-			ID:           peerID,
-			PublicKey:    peerPubKey,
-			Fingerprint:  fingerprint,
-			TrustedSince: time.Now(),
+	// Parse peer's public key
+	if block, _ := pem.Decode(pemData); block == nil {
+		// Check if we already have peer info from reverse connection
+		if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
+			fmt.Printf("Failed to decode PEM block, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
+			return nil
 		}
+		return fmt.Errorf("failed to decode peer's public key: empty block")
 	}
 
-	// Auto-trust if configured to do so
-	if autoTrust {
-		return true, nil
+	// Peers may use RSA or Ed25519 identities
+	peerPubKey, err := keys.ParseSyncPublicKeyPEM(pemData)
+	if err != nil {
+		return fmt.Errorf("failed to parse peer's public key: %w", err)
 	}
 
-	// Perform authentication challenge
-	if err := s.authenticatePeer(ctx, peerID); err != nil {
-		delete(s.trustedPeers, peerID)
-		return false, fmt.Errorf("authentication failed: %w", err)
+	// Calculate fingerprint
+	fingerprint, err := keys.SyncKeyFingerprint(peerPubKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal peer's public key: %w", err)
 	}
 
-	return true, nil
+	// Store peer info
+	s.trustedPeers[peerID] = &PeerInfo{
+		ID:           peerID,
+		PublicKey:    peerPubKey,
+		Fingerprint:  fingerprint,
+		TrustedSince: time.Now(),
+	}
+	return nil
 }
 
 // authenticatePeer sends an authentication challenge to verify peer identity
@@ -746,18 +771,84 @@ func (s *SyncService) authenticatePeer(ctx context.Context, peerID peer.ID) erro
 	}
 
 	// Verify signature
-	challengeHash := sha256.Sum256(challenge)
-	err = rsa.VerifyPKCS1v15(peerInfo.PublicKey, crypto.SHA256, challengeHash[:], response.Signature)
+	err = keys.VerifyChallenge(peerInfo.PublicKey, challenge, response.Signature)
 	if err != nil {
 		return fmt.Errorf("signature verification failed: %w", err)
 	}
 
 	// Update peer info with vault details
 	peerInfo.Name = response.Name
+	peerInfo.VaultID = response.VaultID
 
 	return nil
 }
 
+// IsTrusted reports whether a peer is in the vault's trust list and not revoked
+func (s *SyncService) IsTrusted(peerID peer.ID) bool {
+	if s.rsaConfig == nil {
+		return false
+	}
+	for _, trusted := range s.rsaConfig.TrustedPeers {
+		if trusted.ID == peerID.String() && !trusted.Revoked {
+			return true
+		}
+	}
+	return false
+}
+
+// knownPeers returns the keys vaults were first seen with, including those
+// of the trust list
+func (s *SyncService) knownPeers() []KnownPeer {
+	known, err := LoadKnownPeers(s.vaultMgr.VaultRoot())
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if s.rsaConfig != nil {
+		for _, trusted := range s.rsaConfig.TrustedPeers {
+			if trusted.VaultID != "" {
+				known = append(known, KnownPeer{VaultID: trusted.VaultID, Name: trusted.Name, PeerID: trusted.ID,
+					Fingerprint: trusted.Fingerprint, FirstSeen: trusted.TrustedSince})
+			}
+		}
+	}
+	return known
+}
+
+// rememberPeer records the key of an authenticated peer's vault, unless
+// the vault was seen before
+func (s *SyncService) rememberPeer(peerInfo *PeerInfo) {
+	err := RememberPeer(s.vaultMgr.VaultRoot(), KnownPeer{VaultID: peerInfo.VaultID, Name: peerInfo.Name,
+		PeerID: peerInfo.ID.String(), Fingerprint: peerInfo.Fingerprint})
+	if err != nil {
+		fmt.Printf("Warning: failed to record the key of peer %s: %v\n", peerInfo.ID, err)
+	}
+}
+
+// Fingerprint returns the fingerprint of the vault's own sync public key
+func (s *SyncService) Fingerprint() (string, error) {
+	if s.publicKey == nil {
+		return "", fmt.Errorf("the vault has no sync key")
+	}
+	return keys.SyncKeyFingerprint(s.publicKey)
+}
+
+// NamePeer records the vault name of a peer whose key was exchanged, unless
+// the peer authenticated with one
+func (s *SyncService) NamePeer(peerID peer.ID, name string) {
+	if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Name == "" {
+		peerInfo.Name = name
+	}
+}
+
+// Peer returns what is known of a peer whose key was exchanged
+func (s *SyncService) Peer(peerID peer.ID) (PeerInfo, bool) {
+	peerInfo, ok := s.trustedPeers[peerID]
+	if !ok {
+		return PeerInfo{}, false
+	}
+	return *peerInfo, true
+}
+
 // GetPeerFingerprint returns the fingerprint of a peer's public key
 func (s *SyncService) GetPeerFingerprint(peerID peer.ID) (string, error) {
 	peerInfo, ok := s.trustedPeers[peerID]
@@ -799,22 +890,22 @@ func (s *SyncService) AddTrustedPeer(ctx context.Context, peerID peer.ID) error
 		}
 
 		// Convert public key to PEM
-		publicKeyDER, err := x509.MarshalPKIXPublicKey(peerInfo.PublicKey)
+		publicKeyPEM, err := keys.EncodeSyncPublicKeyPEM(peerInfo.PublicKey)
 		if err != nil {
-			return fmt.Errorf("failed to marshal public key: %w", err)
+			return err
 		}
-
-		publicKeyBlock := &pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: publicKeyDER,
+		keyType, err := keys.SyncKeyType(peerInfo.PublicKey)
+		if err != nil {
+			return err
 		}
-		publicKeyPEM := string(pem.EncodeToMemory(publicKeyBlock))
 
 		// Create trusted peer entry
 		trustedPeer := config.TrustedPeer{
 			ID:           peerID.String(),
 			Name:         peerInfo.Name,
-			PublicKey:    publicKeyPEM,
+			VaultID:      peerInfo.VaultID,
+			KeyType:      keyType,
+			PublicKey:    string(publicKeyPEM),
 			Fingerprint:  peerInfo.Fingerprint,
 			TrustedSince: time.Now(),
 		}
@@ -831,6 +922,7 @@ func (s *SyncService) AddTrustedPeer(ctx context.Context, peerID peer.ID) error
 		if err := s.vaultMgr.SaveConfig(s.vaultConfig); err != nil {
 			return fmt.Errorf("failed to save updated config: %w", err)
 		}
+		s.rememberPeer(peerInfo)
 
 		// // Pretty print newly trusted peer
 		// data, err := yaml.Marshal(trustedPeer)
@@ -846,8 +938,22 @@ func (s *SyncService) AddTrustedPeer(ctx context.Context, peerID peer.ID) error
 	return nil
 }
 
+// SetPlan limits the following syncs to the files of a plan made by
+// PlanSync; nil lifts the limit
+func (s *SyncService) SetPlan(plan *SyncPlan) {
+	s.plan = plan
+}
+
 // SyncWithPeer performs a sync operation with a specific peer
 func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncResult, error) {
+	progress := newSyncProgress(s.Progress, peerID)
+	progress.started()
+	result, err := s.syncWithPeer(ctx, peerID, progress)
+	progress.done(err)
+	return result, err
+}
+
+func (s *SyncService) syncWithPeer(ctx context.Context, peerID peer.ID, progress *syncProgress) (*SyncResult, error) {
 	// Create a context with timeout for the entire operation
 	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
@@ -855,7 +961,7 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 	startTime := time.Now()
 	result := &SyncResult{}
 
-	// First verify and exchange keys with peer (will auto-trust if trustAllPeers is true)
+	// First verify and exchange keys with peer
 	if s.Verbose {
 		fmt.Printf("Starting key verification with peer %s...\n", peerID.String())
 	}
@@ -889,19 +995,92 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 		return nil, fmt.Errorf("failed to get local manifest: %v", err)
 	}
 
+	// A saved plan limits the sync to the files it lists, as they were when planned
+	if s.plan != nil {
+		if s.plan.Peer != peerID.String() {
+			return nil, fmt.Errorf("the sync plan was made for peer %s, not %s", s.plan.Peer, peerID.String())
+		}
+		var changed []string
+		remoteManifest, changed = s.plan.Restrict(remoteManifest)
+		for _, path := range changed {
+			fmt.Printf("Warning: %s changed on the peer since the plan was made; not syncing it\n", path)
+		}
+		result.PlanSkipped = len(changed)
+	}
+
+	// Decide what to do with each of the peer's files, and stop before
+	// transferring anything when conflicts are left to the user
+	merge, checkpoint, err := s.mergeWithPeer(peerID, localManifest, remoteManifest)
+	if err != nil {
+		return nil, err
+	}
+	if unresolved := merge.unresolved(); len(unresolved) > 0 {
+		if err := s.recordConflicts(peerID, remoteManifest, unresolved); err != nil {
+			return nil, err
+		}
+		return nil, &ConflictError{Conflicts: unresolved}
+	}
+
 	// Step 3: Find missing chunks
 	missingChunks := s.findMissingChunks(localManifest, remoteManifest)
 	if s.Verbose {
 		fmt.Printf("Found %d missing chunks to fetch\n", len(missingChunks))
 	}
 
-	// Step 4: Fetch missing chunks
+	// Step 4a: Fetch the compression dictionaries the new chunks were compressed
+	// with first, so the chunks can be checked as they arrive
+	for _, id := range s.findMissingDictionaries(remoteManifest) {
+		dictData, size, err := s.fetchChunk(timeoutCtx, peerID, layout.DictionaryName(id), "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch compression dictionary %s: %v", id, err)
+		}
+		if err := s.vaultMgr.StoreDictionary(id, dictData); err != nil {
+			return nil, fmt.Errorf("failed to store compression dictionary %s: %v", id, err)
+		}
+		result.DictsTransferred++
+		result.BytesTransferred += int64(size)
+	}
+
+	// Step 4b: Fetch missing chunks, skipping those an interrupted sync with
+	// this peer already received
+	state, err := openTransferState(s.vaultMgr.VaultRoot(), peerID)
+	if err != nil {
+		return nil, err
+	}
+	defer state.close()
+	resumed := 0
+	fetch := make(map[string]int64) // Stored size of each chunk and pack to fetch
+	for _, chunkHash := range missingChunks {
+		exists, _ := s.vaultMgr.ChunkExists(chunkHash)
+		if exists && state.acknowledged(chunkHash) {
+			resumed++
+		}
+		if !exists {
+			fetch[chunkHash] = storedChunkSize(remoteManifest, chunkHash)
+		}
+	}
+	if resumed > 0 {
+		fmt.Printf("Resuming, %d of %d chunks already transferred\n", resumed, len(missingChunks))
+	}
+	missingPacks, err := s.findMissingPacks(remoteManifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, packID := range missingPacks {
+		fetch[packID] = packSize(remoteManifest, packID)
+	}
+	progress.planned(slices.Concat(merge.add, merge.copies, merge.update), fetch)
+
 	for i, chunkHash := range missingChunks {
 		if s.Verbose && i%10 == 0 {
 			fmt.Printf("Fetching chunk %d of %d...\n", i+1, len(missingChunks))
 		}
 
 		exists, _ := s.vaultMgr.ChunkExists(chunkHash)
+		if exists && state.acknowledged(chunkHash) {
+			result.ChunksResumed++
+			continue
+		}
 		if exists {
 			result.ChunksDeduplicated++
 			continue
@@ -909,10 +1088,15 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 
 		// Find associated encrypted hash if any
 		var encryptedHash string
+		var remoteRef *config.ChunkRef
 		for _, file := range remoteManifest.Files {
-			for _, chunk := range file.Chunks {
+			for i, chunk := range file.Chunks {
+				if chunk.Hash == chunkHash && remoteRef == nil {
+					remoteRef = &file.Chunks[i]
+				}
 				if chunk.Hash == chunkHash && chunk.EncryptedHash != "" {
 					encryptedHash = chunk.EncryptedHash
+					remoteRef = &file.Chunks[i]
 					break
 				}
 			}
@@ -926,60 +1110,106 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch chunk %s: %v", chunkHash, err)
 		}
+		if err := s.checkReceivedChunk(remoteRef, chunkData); err != nil {
+			return nil, err
+		}
+		if err := s.verifyReceivedChunk(remoteRef, chunkData); err != nil {
+			return nil, err
+		}
 
 		// Store the chunk with both hashes if needed
 		if err := s.StoreChunk(chunkHash, chunkData, encryptedHash); err != nil {
 			return nil, fmt.Errorf("failed to store chunk %s: %v", chunkHash, err)
 		}
+		if err := state.acknowledge(chunkHash); err != nil {
+			return nil, err
+		}
+		progress.received(chunkHash, int64(len(chunkData)))
 
 		result.ChunksTransferred++
 		result.BytesTransferred += int64(size)
 	}
 
+	// Step 4c: Fetch packs holding small files we don't have yet
+	if s.Verbose && len(missingPacks) > 0 {
+		fmt.Printf("Found %d missing packs to fetch\n", len(missingPacks))
+	}
+	for _, packID := range missingPacks {
+		packData, size, err := s.fetchChunk(timeoutCtx, peerID, packID, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch pack %s: %v", packID, err)
+		}
+		if err := s.vaultMgr.StorePack(packID, packData); err != nil {
+			return nil, fmt.Errorf("failed to store pack %s: %v", packID, err)
+		}
+		progress.received(packID, int64(len(packData)))
+		result.PacksTransferred++
+		result.BytesTransferred += int64(size)
+	}
+
 	// Step 5: Save file manifests for synced files
 	if s.Verbose {
 		fmt.Println("Saving file manifests...")
 	}
 	savedCount := 0
-	for _, remoteFile := range remoteManifest.Files {
-		// Check if this file already exists locally
-		exists := false
-		for _, localFile := range localManifest.Files {
-			if localFile.FilePath == remoteFile.FilePath {
-				exists = true
-				break
-			}
+	for _, fileManifest := range slices.Concat(merge.add, merge.copies) {
+		err := manifest.StoreFileManifest(
+			s.vaultMgr.VaultRoot(),
+			fileManifest.FilePath,
+			&fileManifest,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save manifest for %s: %v",
+				fileManifest.FilePath, err)
 		}
-
-		if !exists {
-			// Create a copy of the file manifest to avoid pointer issues
-			fileManifest := remoteFile
-
-			err := manifest.StoreFileManifest(
-				s.vaultMgr.VaultRoot(),
-				fileManifest.FilePath,
-				&fileManifest,
-			)
-			if err != nil {
-				return nil, fmt.Errorf("failed to save manifest for %s: %v",
-					fileManifest.FilePath, err)
-			}
-			if s.Verbose {
-				fmt.Printf("Saved manifest for: %s\n", fileManifest.FilePath)
-			}
-			savedCount++
+		if s.Verbose {
+			fmt.Printf("Saved manifest for: %s\n", fileManifest.FilePath)
+		}
+		savedCount++
+	}
+	// The local versions of these were not changed since the last sync, or
+	// lost a conflict
+	for _, fileManifest := range merge.update {
+		if err := manifest.ReplaceFileManifest(s.vaultMgr.VaultRoot(), fileManifest.FilePath, &fileManifest); err != nil {
+			return nil, fmt.Errorf("failed to update manifest for %s: %v", fileManifest.FilePath, err)
+		}
+		if s.Verbose {
+			fmt.Printf("Updated manifest for: %s\n", fileManifest.FilePath)
 		}
 	}
 	if s.Verbose {
-		fmt.Printf("Saved %d file manifests\n", savedCount)
+		fmt.Printf("Saved %d file manifests, updated %d\n", savedCount, len(merge.update))
 	}
 	result.FileCount = savedCount
+	result.FilesUpdated = len(merge.update)
+	result.Conflicts = merge.conflicts
+
+	// Both vaults now hold the peer's versions, or knowingly kept their own
+	checkpoint.advance(localManifest, remoteManifest, merge)
+	if err := checkpoint.save(s.vaultMgr.VaultRoot(), peerID); err != nil {
+		return nil, err
+	}
+	if err := s.recordConflicts(peerID, remoteManifest, nil); err != nil {
+		return nil, err
+	}
+
+	// Step 6: Take the peer's vault tags and metadata if they were edited last
+	if s.plan == nil || s.plan.Metadata {
+		if err := s.mergeVaultMetadata(peerID, remoteManifest.Metadata, result); err != nil {
+			return nil, err
+		}
+	}
 
-	// Step 6: Rebuild references
+	// Step 7: Rebuild references
 	if err := s.vaultMgr.RebuildReferences(); err != nil {
 		return nil, fmt.Errorf("failed to rebuild references: %v", err)
 	}
 
+	// The session completed, so nothing is left to resume
+	if err := state.remove(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
 	result.Duration = time.Since(startTime)
 	if s.Verbose {
 		fmt.Printf("Sync completed in %v: %d files, %d chunks transferred, %d chunks reused\n",
@@ -989,6 +1219,55 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 	return result, nil
 }
 
+// mergeWithPeer works out what a sync does with the peer's files, from the
+// checkpoint of the last sync with it and the conflicts recorded since
+func (s *SyncService) mergeWithPeer(peerID peer.ID, local, remote *config.Manifest) (*fileMerge, *syncCheckpoint, error) {
+	var peerName string
+	if info, ok := s.trustedPeers[peerID]; ok {
+		peerName = info.Name
+	}
+	return mergeWithCheckpoint(s.vaultMgr.VaultRoot(), peerID, peerName, s.ConflictStrategy, local, remote)
+}
+
+// recordConflicts replaces the recorded conflicts with a peer by unresolved.
+// A sync limited by a plan only replaces those of the files it examined.
+func (s *SyncService) recordConflicts(peerID peer.ID, remote *config.Manifest, unresolved []Conflict) error {
+	if s.plan == nil {
+		remote = nil
+	}
+	return recordPeerConflicts(s.vaultMgr.VaultRoot(), peerID, remote, unresolved)
+}
+
+// mergeVaultMetadata applies a peer's vault tags and metadata last writer
+// wins, warning when both sides were edited
+func (s *SyncService) mergeVaultMetadata(peerID peer.ID, remote *config.MetadataConfig, result *SyncResult) error {
+	if remote == nil {
+		return nil
+	}
+	vaultConfig, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	local := vaultConfig.Metadata
+	merge := config.MergeMetadata(&vaultConfig.Metadata, remote)
+	result.MetadataUpdated, result.MetadataConflict = merge.Updated, merge.Conflict
+	if merge.Conflict {
+		kept, keptAt := "local", local.UpdatedAt
+		if merge.Updated {
+			kept, keptAt = "peer's", remote.UpdatedAt
+		}
+		fmt.Fprintf(os.Stderr, "Warning: vault tags and metadata were edited here and on peer %s; keeping the %s, edited last at %s\n",
+			peerID.String(), kept, keptAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	if !merge.Updated {
+		return nil
+	}
+	if err := s.vaultMgr.SaveConfig(vaultConfig); err != nil {
+		return fmt.Errorf("failed to save vault metadata from peer: %v", err)
+	}
+	return nil
+}
+
 // getRemoteManifest fetches the manifest from a remote peer
 func (s *SyncService) getRemoteManifest(ctx context.Context, peerID peer.ID) (*config.Manifest, error) {
 	// Create a context with timeout
@@ -1011,11 +1290,12 @@ func (s *SyncService) getRemoteManifest(ctx context.Context, peerID peer.ID) (*c
 
 	// Read the manifest
 	var response struct {
-		Error string                 `json:"error,omitempty"`
-		Files []*config.FileManifest `json:"files,omitempty"`
+		Error    string                 `json:"error,omitempty"`
+		Files    []*config.FileManifest `json:"files,omitempty"`
+		Metadata *config.MetadataConfig `json:"metadata,omitempty"` // Absent from older peers
 	}
 
-	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+	if err := json.NewDecoder(s.throttle(stream)).Decode(&response); err != nil {
 		return nil, fmt.Errorf("failed to decode manifest: %w", err)
 	}
 
@@ -1030,7 +1310,8 @@ func (s *SyncService) getRemoteManifest(ctx context.Context, peerID peer.ID) (*c
 		}
 	}
 	manifest := &config.Manifest{
-		Files: valueFiles,
+		Files:    valueFiles,
+		Metadata: response.Metadata,
 	}
 
 	return manifest, nil
@@ -1050,6 +1331,10 @@ func (s *SyncService) findMissingChunks(local, remote *config.Manifest) []string
 	}
 	for _, file := range local.Files {
 		for _, chunk := range file.Chunks {
+			if chunk.Remote {
+				// Recorded from dedup hints; fetched when the peer has it
+				continue
+			}
 			localChunks[chunk.Hash] = true
 			if s.Verbose {
 				fmt.Printf("  - Regular hash: %s\n", chunk.Hash)
@@ -1072,6 +1357,10 @@ func (s *SyncService) findMissingChunks(local, remote *config.Manifest) []string
 	}
 	for _, file := range remote.Files {
 		for _, chunk := range file.Chunks {
+			if chunk.Zero {
+				// Zero chunks are not stored and never need fetching
+				continue
+			}
 			if s.Verbose {
 				fmt.Printf("  - Checking remote chunk: %s\n", chunk.Hash)
 				if chunk.EncryptedHash != "" {
@@ -1100,6 +1389,41 @@ func (s *SyncService) findMissingChunks(local, remote *config.Manifest) []string
 	return missingChunks
 }
 
+// findMissingPacks returns the IDs of packs referenced by the remote manifest that are not stored locally,
+// refusing pack IDs that would name a file outside the packs directory
+func (s *SyncService) findMissingPacks(remote *config.Manifest) ([]string, error) {
+	missingPacks := []string{}
+	for _, file := range remote.Files {
+		if file.Pack == nil || slices.Contains(missingPacks, file.Pack.ID) {
+			continue
+		}
+		if !layout.ValidPackID(file.Pack.ID) {
+			return nil, fmt.Errorf("peer sent an invalid pack ID %q for %s", file.Pack.ID, file.FilePath)
+		}
+		if !s.vaultMgr.PackExists(file.Pack.ID) {
+			missingPacks = append(missingPacks, file.Pack.ID)
+		}
+	}
+	return missingPacks, nil
+}
+
+// findMissingDictionaries returns the IDs of compression dictionaries that chunks
+// in the remote manifest were compressed with and that are not stored locally
+func (s *SyncService) findMissingDictionaries(remote *config.Manifest) []string {
+	missing := []string{}
+	for _, file := range remote.Files {
+		for _, chunk := range file.Chunks {
+			if chunk.CompressionDict == "" || slices.Contains(missing, chunk.CompressionDict) {
+				continue
+			}
+			if !s.vaultMgr.DictionaryExists(chunk.CompressionDict) {
+				missing = append(missing, chunk.CompressionDict)
+			}
+		}
+	}
+	return missing
+}
+
 // fetchChunk downloads a chunk from a remote peer
 func (s *SyncService) fetchChunk(ctx context.Context, peerID peer.ID, hash string, encryptedHash string) ([]byte, int, error) {
 	// Create a context with timeout
@@ -1133,7 +1457,7 @@ func (s *SyncService) fetchChunk(ctx context.Context, peerID peer.ID, hash strin
 	if s.Verbose {
 		fmt.Printf("Requesting chunk with hash: %s, encrypted hash: %s\n", hash, encryptedHash)
 	}
-	if err := json.NewEncoder(stream).Encode(request); err != nil {
+	if err := json.NewEncoder(s.throttle(stream)).Encode(request); err != nil {
 		return nil, 0, fmt.Errorf("failed to send chunk request: %w", err)
 	}
 
@@ -1148,7 +1472,7 @@ func (s *SyncService) fetchChunk(ctx context.Context, peerID peer.ID, hash strin
 		Encrypted bool   `json:"encrypted"`
 	}
 
-	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+	if err := json.NewDecoder(s.throttle(stream)).Decode(&response); err != nil {
 		return nil, 0, fmt.Errorf("failed to decode chunk response: %w", err)
 	}
 
@@ -1167,6 +1491,39 @@ func (s *SyncService) fetchChunk(ctx context.Context, peerID peer.ID, hash strin
 	return chunkData, response.Size, nil
 }
 
+// checkReceivedChunk decodes a chunk received for ref, refusing it when it
+// decompresses past its recorded size. Other decoding failures are left to
+// 'sietch verify': the vault may lack what decoding needs, such as a
+// convergence secret, without the chunk being harmful.
+func (s *SyncService) checkReceivedChunk(ref *config.ChunkRef, data []byte) error {
+	if s.ChunkOptions == nil || ref == nil {
+		return nil
+	}
+	if _, err := chunker.Decode(*ref, data, *s.ChunkOptions); errors.Is(err, chunker.ErrChunkTooLarge) {
+		return fmt.Errorf("refusing chunk from peer: %w", err)
+	}
+	return nil
+}
+
+// verifyReceivedChunk checks a received chunk against its hash before it is
+// stored and acknowledged, so a chunk damaged in transit is never counted as
+// transferred
+func (s *SyncService) verifyReceivedChunk(ref *config.ChunkRef, data []byte) error {
+	if ref == nil {
+		return nil
+	}
+	var opts chunker.Options
+	if s.ChunkOptions != nil {
+		opts = *s.ChunkOptions
+	} else if s.vaultConfig != nil {
+		opts.HashAlgorithm = s.vaultConfig.Chunking.HashAlgorithm
+	}
+	if err := chunker.CheckStored(*ref, data, opts); err != nil {
+		return fmt.Errorf("chunk %s received from peer failed verification: %w", ref.Hash, err)
+	}
+	return nil
+}
+
 // StoreChunk stores a chunk and handles the relationship between regular and encrypted hashes
 func (s *SyncService) StoreChunk(hash string, data []byte, encryptedHash string) error {
 	// Store the chunk with the primary hash
@@ -1,9 +1,15 @@
 package p2p
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
 )
 
 // TestHasPeer ensures HasPeer returns false for unknown peer and true after insertion
@@ -27,3 +33,58 @@ func TestHasPeer(t *testing.T) {
 		t.Fatalf("expected HasPeer to return true after insertion")
 	}
 }
+
+// TestCheckReceivedChunk ensures chunks decompressing past their recorded size are refused
+func TestCheckReceivedChunk(t *testing.T) {
+	opts := chunker.Options{ChunkSize: 4096, Compression: "zstd"}
+	store := chunker.NewMemoryStore()
+	refs, err := chunker.Split(context.Background(), bytes.NewReader(bytes.Repeat([]byte("dune "), 800)), store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := store.Get(refs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bomb, err := compression.CompressData(make([]byte, 32<<20), "zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &SyncService{ChunkOptions: &opts}
+	if err := s.checkReceivedChunk(&refs[0], good); err != nil {
+		t.Errorf("checkReceivedChunk() refused a valid chunk: %v", err)
+	}
+	if err := s.checkReceivedChunk(&refs[0], bomb); !errors.Is(err, chunker.ErrChunkTooLarge) {
+		t.Errorf("checkReceivedChunk() = %v, want ErrChunkTooLarge", err)
+	}
+	if err := (&SyncService{}).checkReceivedChunk(&refs[0], bomb); err != nil {
+		t.Errorf("checkReceivedChunk() without chunk options = %v, want no check", err)
+	}
+}
+
+// TestVerifyReceivedChunk ensures a chunk that does not match its hash is refused
+func TestVerifyReceivedChunk(t *testing.T) {
+	opts := chunker.Options{ChunkSize: 4096, Compression: "zstd"}
+	store := chunker.NewMemoryStore()
+	refs, err := chunker.Split(context.Background(), bytes.NewReader(bytes.Repeat([]byte("arrakis "), 800)), store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := store.Get(refs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged, err := compression.CompressData(bytes.Repeat([]byte("caladan "), 800), "zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &SyncService{ChunkOptions: &opts}
+	if err := s.verifyReceivedChunk(&refs[0], good); err != nil {
+		t.Errorf("verifyReceivedChunk() refused a valid chunk: %v", err)
+	}
+	if err := s.verifyReceivedChunk(&refs[0], damaged); err == nil {
+		t.Error("verifyReceivedChunk() accepted a chunk that does not match its hash")
+	}
+}
@@ -0,0 +1,96 @@
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// A sync that is interrupted keeps the chunks it already received. Which ones
+// is recorded in .sietch/sync-state/<peer ID>, one chunk hash per line appended
+// once the chunk was checked against its hash and stored, so a retry with the
+// same peer does not request them again. The file is removed when a sync with
+// the peer completes.
+
+// SyncStatePath returns the path of the transfer state of syncs with peerID
+func SyncStatePath(vaultRoot string, peerID peer.ID) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync-state", peerID.String())
+}
+
+// transferState is the set of chunks acknowledged during earlier, interrupted
+// syncs with a peer, and the journal new acknowledgements are appended to
+type transferState struct {
+	path  string
+	acked map[string]bool
+	file  *os.File
+}
+
+// openTransferState loads the chunks acknowledged in earlier syncs with peerID
+func openTransferState(vaultRoot string, peerID peer.ID) (*transferState, error) {
+	state := &transferState{path: SyncStatePath(vaultRoot, peerID), acked: make(map[string]bool)}
+	data, err := os.ReadFile(state.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	// A line without its newline was cut off while being appended
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		scanner := bufio.NewScanner(bytes.NewReader(data[:i+1]))
+		for scanner.Scan() {
+			if hash := string(bytes.TrimSpace(scanner.Bytes())); hash != "" {
+				state.acked[hash] = true
+			}
+		}
+	}
+	return state, nil
+}
+
+// acknowledged reports whether hash was received in an earlier sync
+func (t *transferState) acknowledged(hash string) bool {
+	return t.acked[hash]
+}
+
+// acknowledge records that hash was received, checked and stored
+func (t *transferState) acknowledge(hash string) error {
+	if t.file == nil {
+		if err := os.MkdirAll(filepath.Dir(t.path), constants.StandardDirPerms); err != nil {
+			return fmt.Errorf("failed to create sync state directory: %w", err)
+		}
+		file, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, constants.StandardFilePerms)
+		if err != nil {
+			return fmt.Errorf("failed to open sync state: %w", err)
+		}
+		t.file = file
+	}
+	if _, err := t.file.WriteString(hash + "\n"); err != nil {
+		return fmt.Errorf("failed to record chunk in sync state: %w", err)
+	}
+	t.acked[hash] = true
+	return nil
+}
+
+// close closes the journal, keeping it for the next sync
+func (t *transferState) close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// remove discards the state once a sync completed
+func (t *transferState) remove() error {
+	if err := t.close(); err != nil {
+		return err
+	}
+	if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove sync state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestTransferState(t *testing.T) {
+	vaultRoot := t.TempDir()
+	peerID := peer.ID("peer-a")
+
+	state, err := openTransferState(vaultRoot, peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{"aaaa", "bbbb"} {
+		if err := state.acknowledge(hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := state.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A hash cut off while being appended was never acknowledged
+	file, err := os.OpenFile(SyncStatePath(vaultRoot, peerID), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString("cc")
+	file.Close()
+
+	state, err = openTransferState(vaultRoot, peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hash, want := range map[string]bool{"aaaa": true, "bbbb": true, "cc": false, "dddd": false} {
+		if got := state.acknowledged(hash); got != want {
+			t.Errorf("acknowledged(%q) = %v, want %v", hash, got, want)
+		}
+	}
+	if other, err := openTransferState(vaultRoot, peer.ID("peer-b")); err != nil || other.acknowledged("aaaa") {
+		t.Errorf("state of another peer = %v, %v; want empty", other, err)
+	}
+
+	if err := state.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(SyncStatePath(vaultRoot, peerID)); !os.IsNotExist(err) {
+		t.Errorf("sync state still exists after remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultRoot, ".sietch", "sync-state")); err != nil {
+		t.Errorf("sync state directory: %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/ingest"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/sharedstore"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// ChunkThreshold returns the stored size below which chunk files are moved into
+// chunk packs, or 0 if chunk packing is disabled
+func ChunkThreshold(vaultConfig config.VaultConfig) int64 {
+	if !vaultConfig.Packing.Chunks {
+		return 0
+	}
+	return packThreshold(vaultConfig)
+}
+
+// ChunkRepackResult summarises a garbage collection pass over the vault's chunk packs
+type ChunkRepackResult struct {
+	ChunksPacked   int   // Chunk files moved into chunk packs
+	PacksRemoved   int   // Chunk packs with no live chunks that were deleted
+	PacksRewritten int   // Chunk packs whose live chunks were moved into new packs
+	ChunksMoved    int   // Live chunks copied out of rewritten packs
+	BytesReclaimed int64 // Bytes freed by removed packs plus dead chunks dropped from rewritten packs
+}
+
+// RepackChunks moves chunk files smaller than ChunkThreshold into chunk packs and
+// reclaims the space of chunks no manifest, snapshot or unfinished add
+// references any more. Packs without live chunks are removed; packs with at
+// least PackRepackWasteRatio dead bytes, and small packs when several of them
+// exist, have their live chunks moved into fresh packs. A chunk also stored as a
+// chunk file is dead in its pack, since the file is found first.
+// Chunks are copied as stored, so no passphrase is needed. New packs and all
+// removals are applied in a single transaction.
+func RepackChunks(vaultRoot string, vaultConfig config.VaultConfig) (*ChunkRepackResult, error) {
+	result := &ChunkRepackResult{}
+
+	ids, err := layout.ListChunkPackIDs(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	// Chunks in a shared store are not packed: the store is shared with other vaults
+	threshold := ChunkThreshold(vaultConfig)
+	if layout.SharedStore(vaultRoot) != "" {
+		threshold = 0
+	}
+	if len(ids) == 0 && threshold == 0 {
+		return result, nil
+	}
+
+	live, err := liveChunks(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "repack-chunks"})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+	writer := &chunkPackWriter{txn: txn, maxSize: maxPackSize(vaultConfig)}
+
+	// Chunk files are found before chunk packs, so a chunk file makes any packed copy dead
+	loose := make(map[string]string)
+	var looseHashes []string
+	if layout.SharedStore(vaultRoot) == "" {
+		hashes, err := layout.ListChunkHashesIn(layout.LocalChunkDirectory(vaultRoot))
+		if err != nil {
+			return nil, err
+		}
+		for _, hash := range hashes {
+			if path, ok := layout.LocateLocalChunk(vaultRoot, hash); ok {
+				loose[hash] = path
+				looseHashes = append(looseHashes, hash)
+			}
+		}
+	}
+
+	var packedLoose []string
+	for _, hash := range looseHashes {
+		// Unreferenced chunk files are left to 'sietch dedup gc' and 'sietch fsck'
+		if threshold == 0 || !live[hash] {
+			continue
+		}
+		path := loose[hash]
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat chunk %s: %v", hash, err)
+		}
+		if info.Size() >= threshold {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk %s: %v", hash, err)
+		}
+		if err := writer.add(hash, data); err != nil {
+			return nil, err
+		}
+		packedLoose = append(packedLoose, hash)
+	}
+
+	type packInfo struct {
+		size    int64
+		entries []layout.ChunkPackEntry // Live entries
+	}
+	packs := make(map[string]*packInfo, len(ids))
+	seen := make(map[string]bool)
+	var smallPacks int
+	for _, id := range ids {
+		entries, err := layout.ReadChunkPackIndex(vaultRoot, id)
+		if err != nil {
+			return nil, err
+		}
+		stat, err := os.Stat(layout.ChunkPackPath(vaultRoot, id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat chunk pack %s: %v", id, err)
+		}
+		info := &packInfo{size: stat.Size()}
+		for _, e := range entries {
+			// A chunk packed twice is read from the first pack listing it
+			if live[e.Hash] && loose[e.Hash] == "" && !seen[e.Hash] {
+				info.entries = append(info.entries, e)
+			}
+			seen[e.Hash] = true
+		}
+		packs[id] = info
+		if len(info.entries) > 0 && isSmallPack(info.size, writer.maxSize) {
+			smallPacks++
+		}
+	}
+	// Merging a lone small pack would only rewrite it, so small packs are merged in groups
+	mergeSmall := smallPacks > 1
+
+	for _, id := range ids {
+		info := packs[id]
+		liveBytes := int64(0)
+		for _, e := range info.entries {
+			liveBytes += e.Length
+		}
+		deadBytes := info.size - liveBytes
+		if len(info.entries) > 0 {
+			wasteful := info.size > 0 && float64(deadBytes)/float64(info.size) >= constants.PackRepackWasteRatio
+			if !wasteful && !(mergeSmall && isSmallPack(info.size, writer.maxSize)) {
+				continue
+			}
+			data, err := os.ReadFile(layout.ChunkPackPath(vaultRoot, id))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read chunk pack %s: %v", id, err)
+			}
+			for _, e := range info.entries {
+				if e.Offset < 0 || e.Length < 0 || e.Offset+e.Length > int64(len(data)) {
+					return nil, fmt.Errorf("chunk pack %s: chunk %s is out of range", id, e.Hash)
+				}
+				if err := writer.add(e.Hash, data[e.Offset:e.Offset+e.Length]); err != nil {
+					return nil, err
+				}
+				result.ChunksMoved++
+			}
+			result.PacksRewritten++
+		} else {
+			result.PacksRemoved++
+		}
+		// The index goes first, so an interrupted removal never leaves an index without its pack
+		for _, rel := range []string{layout.ChunkPackIndexRelPath(id), layout.ChunkPackRelPath(id)} {
+			if err := txn.StageDelete(rel); err != nil {
+				return nil, fmt.Errorf("failed to stage removal of chunk pack %s: %v", id, err)
+			}
+		}
+		result.BytesReclaimed += deadBytes
+	}
+
+	if err := writer.flush(); err != nil {
+		return nil, err
+	}
+	for _, hash := range packedLoose {
+		rel, err := filepath.Rel(vaultRoot, loose[hash])
+		if err != nil {
+			return nil, err
+		}
+		if err := txn.StageDelete(filepath.ToSlash(rel)); err != nil {
+			return nil, fmt.Errorf("failed to stage removal of chunk %s: %v", hash, err)
+		}
+		result.ChunksPacked++
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("commit chunk repack: %w", err)
+	}
+	committed = true
+	layout.RemoveEmptyShards(layout.LocalChunkDirectory(vaultRoot))
+	return result, nil
+}
+
+// liveChunks returns the storage keys of the chunks the live files, the
+// snapshots and unfinished adds reference
+func liveChunks(vaultRoot string) (map[string]bool, error) {
+	live, err := sharedstore.ReferencedBy(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect chunk references: %v", err)
+	}
+	pending, err := ingest.Pending(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range pending {
+		live[chunker.StorageKey(ref)] = true
+	}
+	return live, nil
+}
+
+// chunkPackWriter appends chunks to chunk packs staged through a transaction
+type chunkPackWriter struct {
+	txn     *atomic.Transaction
+	maxSize int64
+
+	buf     bytes.Buffer
+	entries []layout.ChunkPackEntry
+}
+
+// add appends a stored chunk to the current pack, writing the pack first if it is full
+func (w *chunkPackWriter) add(hash string, data []byte) error {
+	if w.buf.Len() > 0 && int64(w.buf.Len()+len(data)) > w.maxSize {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.entries = append(w.entries, layout.ChunkPackEntry{Hash: hash, Offset: int64(w.buf.Len()), Length: int64(len(data))})
+	w.buf.Write(data)
+	return nil
+}
+
+// flush stages the current pack and then its index, if the pack has any chunks
+func (w *chunkPackWriter) flush() error {
+	if len(w.entries) == 0 {
+		return nil
+	}
+	id, err := newPackID()
+	if err != nil {
+		return err
+	}
+	index, err := layout.EncodeChunkPackIndex(w.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode index of chunk pack %s: %v", id, err)
+	}
+	for _, file := range []struct {
+		rel  string
+		data []byte
+	}{{layout.ChunkPackRelPath(id), w.buf.Bytes()}, {layout.ChunkPackIndexRelPath(id), index}} {
+		staged, err := w.txn.StageCreate(file.rel)
+		if err != nil {
+			return fmt.Errorf("stage chunk pack %s: %w", id, err)
+		}
+		if _, err := staged.Write(file.data); err != nil {
+			_ = staged.Close()
+			return fmt.Errorf("write staged chunk pack %s: %w", id, err)
+		}
+		if err := staged.Close(); err != nil {
+			return fmt.Errorf("close staged chunk pack %s: %w", id, err)
+		}
+	}
+	w.buf.Reset()
+	w.entries = nil
+	return nil
+}
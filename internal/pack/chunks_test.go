@@ -0,0 +1,163 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+// storeChunkFile writes data as a chunk file and returns its hash
+func storeChunkFile(t *testing.T, vaultRoot string, data []byte) string {
+	t.Helper()
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	path := layout.ChunkPath(vaultRoot, hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// writeChunkManifest writes a manifest for a file made of the given chunks
+func writeChunkManifest(t *testing.T, vaultRoot, name string, hashes ...string) {
+	t.Helper()
+	manifest := config.FileManifest{FilePath: name}
+	for i, hash := range hashes {
+		manifest.Chunks = append(manifest.Chunks, config.ChunkRef{Hash: hash, Index: i})
+	}
+	data, err := yaml.Marshal(&manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(manifestsDir, name+".yaml"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepackChunks(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+	vaultConfig.Packing = config.PackingConfig{Chunks: true, Threshold: "1KB"}
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+
+	chunks := map[string][]byte{
+		"small-a": bytes.Repeat([]byte{'a'}, 100),
+		"small-b": bytes.Repeat([]byte{'b'}, 200),
+		"large":   bytes.Repeat([]byte{'c'}, 2048),
+		"dead":    bytes.Repeat([]byte{'d'}, 50),
+	}
+	hashes := make(map[string]string)
+	for name, data := range chunks {
+		hashes[name] = storeChunkFile(t, vaultRoot, data)
+	}
+	writeChunkManifest(t, vaultRoot, "file1", hashes["small-a"], hashes["large"])
+	writeChunkManifest(t, vaultRoot, "file2", hashes["small-b"])
+
+	result, err := RepackChunks(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatalf("RepackChunks() error: %v", err)
+	}
+	if result.ChunksPacked != 2 || result.PacksRewritten != 0 || result.PacksRemoved != 0 {
+		t.Errorf("unexpected repack result: %+v", result)
+	}
+	// Live small chunks are packed; the large chunk and the unreferenced one stay chunk files
+	for name, wantPacked := range map[string]bool{"small-a": true, "small-b": true, "large": false, "dead": false} {
+		loc, ok := layout.LocateChunk(vaultRoot, hashes[name])
+		if !ok || loc.Packed() != wantPacked {
+			t.Errorf("%s: LocateChunk() = %+v, %v; want packed %v", name, loc, ok, wantPacked)
+			continue
+		}
+		got, err := loc.Read()
+		if err != nil {
+			t.Fatalf("%s: Read() error: %v", name, err)
+		}
+		testutil.CompareBytes(t, chunks[name], got, name)
+	}
+	if _, err := os.Stat(filepath.Join(layout.LocalChunkDirectory(vaultRoot), hashes["small-a"])); !os.IsNotExist(err) {
+		t.Errorf("packed chunk file was not removed: %v", err)
+	}
+
+	// Deleting file2 leaves two thirds of the pack dead, so it is rewritten
+	if err := os.Remove(filepath.Join(manifestsDir, "file2.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	oldIDs, _ := layout.ListChunkPackIDs(vaultRoot)
+	result, err = RepackChunks(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatalf("RepackChunks() error: %v", err)
+	}
+	if result.PacksRewritten != 1 || result.ChunksMoved != 1 || result.BytesReclaimed != 200 {
+		t.Errorf("unexpected repack result: %+v", result)
+	}
+	newIDs, _ := layout.ListChunkPackIDs(vaultRoot)
+	if len(newIDs) != 1 || newIDs[0] == oldIDs[0] {
+		t.Fatalf("expected the old chunk pack to be replaced, before %v after %v", oldIDs, newIDs)
+	}
+	if _, ok := layout.LocateChunk(vaultRoot, hashes["small-b"]); ok {
+		t.Error("dead chunk is still in a chunk pack")
+	}
+	if loc, ok := layout.LocateChunk(vaultRoot, hashes["small-a"]); !ok || loc.Pack != newIDs[0] {
+		t.Errorf("LocateChunk(small-a) = %+v, %v; want it in pack %s", loc, ok, newIDs[0])
+	}
+
+	// Once no file uses the pack it is removed outright
+	if err := os.Remove(filepath.Join(manifestsDir, "file1.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = RepackChunks(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatalf("RepackChunks() error: %v", err)
+	}
+	if result.PacksRemoved != 1 || result.BytesReclaimed != 100 {
+		t.Errorf("unexpected repack result: %+v", result)
+	}
+	if ids, _ := layout.ListChunkPackIDs(vaultRoot); len(ids) != 0 {
+		t.Errorf("expected no chunk packs left, got %v", ids)
+	}
+}
+
+func TestRepackChunksPrefersChunkFiles(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+	vaultConfig.Packing = config.PackingConfig{Chunks: true, Threshold: "1KB"}
+
+	data := bytes.Repeat([]byte{'a'}, 100)
+	hash := storeChunkFile(t, vaultRoot, data)
+	writeChunkManifest(t, vaultRoot, "file1", hash)
+	if _, err := RepackChunks(vaultRoot, vaultConfig); err != nil {
+		t.Fatalf("RepackChunks() error: %v", err)
+	}
+
+	// A chunk written again as a chunk file, e.g. by a repair, is read from the
+	// file; with packing off the packed copy is dropped rather than repacked
+	storeChunkFile(t, vaultRoot, data)
+	if loc, ok := layout.LocateChunk(vaultRoot, hash); !ok || loc.Packed() {
+		t.Fatalf("LocateChunk() = %+v, %v; want the chunk file", loc, ok)
+	}
+	vaultConfig.Packing.Chunks = false
+	result, err := RepackChunks(vaultRoot, vaultConfig)
+	if err != nil {
+		t.Fatalf("RepackChunks() error: %v", err)
+	}
+	if result.PacksRemoved != 1 || result.ChunksPacked != 0 {
+		t.Errorf("unexpected repack result: %+v", result)
+	}
+	if loc, ok := layout.LocateChunk(vaultRoot, hash); !ok || loc.Packed() {
+		t.Errorf("LocateChunk() = %+v, %v; want the chunk file", loc, ok)
+	}
+}
@@ -0,0 +1,329 @@
+// Package pack stores small files in shared, encrypted pack blobs instead of
+// giving every file its own chunk, and moves small chunks into chunk packs.
+//
+// A pack is the concatenation of (optionally compressed) file entries. The whole
+// pack is encrypted as one unit and written once to .sietch/packs/<id>; packs are
+// never modified in place. Each file manifest records its entry as a PackRef
+// (pack ID, offset, length). Dead entries left behind by deletions are reclaimed
+// by Repack during garbage collection.
+package pack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// Threshold returns the size below which files are packed, or 0 if packing is disabled
+func Threshold(vaultConfig config.VaultConfig) int64 {
+	if !vaultConfig.Packing.Enabled {
+		return 0
+	}
+	return packThreshold(vaultConfig)
+}
+
+// packThreshold returns the configured packing threshold
+func packThreshold(vaultConfig config.VaultConfig) int64 {
+	threshold, err := util.ParseChunkSize(vaultConfig.Packing.Threshold)
+	if err != nil || threshold <= 0 {
+		threshold, _ = util.ParseChunkSize(constants.DefaultPackThreshold)
+	}
+	return threshold
+}
+
+// ShouldPack reports whether a file of the given size is stored in a pack
+func ShouldPack(vaultConfig config.VaultConfig, size int64) bool {
+	return size < Threshold(vaultConfig)
+}
+
+// maxPackSize returns the plaintext size at which a pack is sealed
+func maxPackSize(vaultConfig config.VaultConfig) int64 {
+	size, err := util.ParseChunkSize(vaultConfig.Packing.MaxPackSize)
+	if err != nil || size <= 0 {
+		size, _ = util.ParseChunkSize(constants.DefaultMaxPackSize)
+	}
+	return size
+}
+
+// ErrVerifyFailed is returned by Flush when a pack read back after writing does
+// not match what was packed
+var ErrVerifyFailed = errors.New("read-back verification failed")
+
+// Writer accumulates small files into packs. Call Flush before committing the
+// transaction so the final, partially filled pack is written.
+type Writer struct {
+	vaultRoot   string
+	vaultConfig config.VaultConfig
+	passphrase  string
+	txn         *atomic.Transaction
+	maxSize     int64
+
+	id      string
+	buf     bytes.Buffer
+	entries []*config.PackRef // Entries of the current pack, for verifying it once written
+	verify  bool
+}
+
+// NewWriter creates a pack writer that stages packs through the given transaction
+func NewWriter(vaultRoot string, vaultConfig config.VaultConfig, passphrase string, txn *atomic.Transaction) (*Writer, error) {
+	if txn == nil {
+		return nil, fmt.Errorf("transaction required")
+	}
+	if vaultConfig.Encryption.Type == constants.EncryptionTypeAES && vaultConfig.Encryption.PassphraseProtected && passphrase == "" {
+		return nil, fmt.Errorf("passphrase required for encrypted vault but not provided")
+	}
+	return &Writer{
+		vaultRoot:   vaultRoot,
+		vaultConfig: vaultConfig,
+		passphrase:  passphrase,
+		txn:         txn,
+		maxSize:     maxPackSize(vaultConfig),
+	}, nil
+}
+
+// SetVerifyAfterWrite makes Flush read every pack back from the transaction and
+// check each entry against its hash before returning
+func (w *Writer) SetVerifyAfterWrite(verify bool) {
+	w.verify = verify
+}
+
+// Add appends a file's content to the current pack and returns its pack reference
+func (w *Writer) Add(data []byte) (*config.PackRef, error) {
+	hasher, err := chunk.CreateHasher(w.vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(data)
+
+	compressed, err := compression.CompressDataLevel(data, w.vaultConfig.Compression, w.vaultConfig.CompressionLevel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress packed file: %v", err)
+	}
+
+	ref, err := w.appendEntry(compressed)
+	if err != nil {
+		return nil, err
+	}
+	ref.Hash = fmt.Sprintf("%x", hasher.Sum(nil))
+	ref.Compressed = w.vaultConfig.Compression != constants.CompressionTypeNone && w.vaultConfig.Compression != ""
+	ref.CompressionType = w.vaultConfig.Compression
+	return ref, nil
+}
+
+// appendEntry appends an already-encoded entry, sealing the current pack first if it is full
+func (w *Writer) appendEntry(entry []byte) (*config.PackRef, error) {
+	if w.buf.Len() > 0 && int64(w.buf.Len()+len(entry)) > w.maxSize {
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	if w.id == "" {
+		id, err := newPackID()
+		if err != nil {
+			return nil, err
+		}
+		w.id = id
+	}
+
+	ref := &config.PackRef{ID: w.id, Offset: int64(w.buf.Len()), Length: int64(len(entry))}
+	w.buf.Write(entry)
+	w.entries = append(w.entries, ref)
+	return ref, nil
+}
+
+// Flush encrypts and stages the current pack, if it has any entries
+func (w *Writer) Flush() error {
+	if w.id == "" {
+		return nil
+	}
+
+	sealed, err := seal(w.buf.Bytes(), w.vaultConfig, w.passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt pack %s: %v", w.id, err)
+	}
+
+	staged, err := w.txn.StageCreate(layout.PackRelPath(w.id))
+	if err != nil {
+		return fmt.Errorf("stage pack %s: %w", w.id, err)
+	}
+	if _, err := staged.Write(sealed); err != nil {
+		_ = staged.Close()
+		return fmt.Errorf("write staged pack %s: %w", w.id, err)
+	}
+	if err := staged.Close(); err != nil {
+		return fmt.Errorf("close staged pack %s: %w", w.id, err)
+	}
+	if w.verify {
+		if err := w.verifyStaged(); err != nil {
+			return err
+		}
+	}
+
+	w.id = ""
+	w.buf.Reset()
+	w.entries = nil
+	return nil
+}
+
+// verifyStaged reads the current pack back from the transaction, decrypts it and
+// checks every entry against the hash of the file it came from
+func (w *Writer) verifyStaged() error {
+	path, ok := w.txn.StagedPath(layout.PackRelPath(w.id))
+	if !ok {
+		return fmt.Errorf("pack %s was not staged", w.id)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read back pack %s: %v", w.id, err)
+	}
+	plain, err := openPack(data, w.vaultRoot, w.vaultConfig, w.passphrase, w.id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerifyFailed, err)
+	}
+	for _, ref := range w.entries {
+		if _, err := extractEntry(plain, ref, w.vaultConfig); err != nil {
+			return fmt.Errorf("%w: %v", ErrVerifyFailed, err)
+		}
+	}
+	return nil
+}
+
+// ReadFile returns the plaintext content of a packed file, verifying its hash
+func ReadFile(vaultRoot string, vaultConfig config.VaultConfig, passphrase string, ref *config.PackRef) ([]byte, error) {
+	plain, err := readPack(vaultRoot, vaultConfig, passphrase, ref.ID)
+	if err != nil {
+		return nil, err
+	}
+	return extractEntry(plain, ref, vaultConfig)
+}
+
+// Exists reports whether a pack blob is present in the vault
+func Exists(vaultRoot string, packID string) bool {
+	_, err := os.Stat(layout.PackPath(vaultRoot, packID))
+	return err == nil
+}
+
+// extractEntry slices an entry out of a decrypted pack, decompresses and verifies it
+func extractEntry(plain []byte, ref *config.PackRef, vaultConfig config.VaultConfig) ([]byte, error) {
+	if ref.Offset < 0 || ref.Length < 0 || ref.Offset+ref.Length > int64(len(plain)) {
+		return nil, fmt.Errorf("pack %s: entry at offset %d (length %d) is out of range", ref.ID, ref.Offset, ref.Length)
+	}
+	data := plain[ref.Offset : ref.Offset+ref.Length]
+
+	if ref.Compressed {
+		compressionType := ref.CompressionType
+		if compressionType == "" {
+			compressionType = vaultConfig.Compression
+		}
+		decompressed, err := compression.DecompressData(data, compressionType)
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: failed to decompress entry: %v", ref.ID, err)
+		}
+		data = decompressed
+	}
+
+	if ref.Hash != "" {
+		hasher, err := chunk.CreateHasher(vaultConfig.Chunking.HashAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		hasher.Write(data)
+		if actual := fmt.Sprintf("%x", hasher.Sum(nil)); actual != ref.Hash {
+			return nil, fmt.Errorf("pack %s: integrity check failed for entry at offset %d", ref.ID, ref.Offset)
+		}
+	}
+
+	return data, nil
+}
+
+// readPack reads and decrypts a whole pack
+func readPack(vaultRoot string, vaultConfig config.VaultConfig, passphrase string, packID string) ([]byte, error) {
+	data, err := os.ReadFile(layout.PackPath(vaultRoot, packID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("pack %s not found", packID)
+		}
+		return nil, fmt.Errorf("failed to read pack %s: %v", packID, err)
+	}
+	return openPack(data, vaultRoot, vaultConfig, passphrase, packID)
+}
+
+// openPack decrypts a pack blob
+func openPack(data []byte, vaultRoot string, vaultConfig config.VaultConfig, passphrase string, packID string) ([]byte, error) {
+	if !isEncrypted(vaultConfig) {
+		return data, nil
+	}
+
+	var decrypted string
+	var err error
+	if vaultConfig.Encryption.PassphraseProtected {
+		decrypted, err = encryption.DecryptDataWithPassphrase(string(data), vaultRoot, passphrase)
+	} else {
+		decrypted, err = encryption.DecryptData(string(data), vaultRoot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt pack %s: %v", packID, err)
+	}
+
+	plain, err := base64.StdEncoding.DecodeString(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pack %s: %v", packID, err)
+	}
+	return plain, nil
+}
+
+// seal encrypts a pack's plaintext the same way individual chunks are encrypted
+func seal(plain []byte, vaultConfig config.VaultConfig, passphrase string) ([]byte, error) {
+	if !isEncrypted(vaultConfig) {
+		return append([]byte(nil), plain...), nil
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(plain)
+	var encrypted string
+	var err error
+	if vaultConfig.Encryption.PassphraseProtected {
+		encrypted, err = encryption.EncryptDataWithPassphrase(encoded, vaultConfig, passphrase)
+	} else {
+		encrypted, err = encryption.EncryptData(encoded, vaultConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encrypted), nil
+}
+
+func isEncrypted(vaultConfig config.VaultConfig) bool {
+	return vaultConfig.Encryption.Type != "" && vaultConfig.Encryption.Type != constants.EncryptionTypeNone
+}
+
+// newPackID returns a random hex pack ID
+func newPackID() (string, error) {
+	id := make([]byte, constants.PackIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate pack ID: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// manifestRelPath returns a manifest's path relative to the vault root for transactional staging
+func manifestRelPath(vaultRoot string, manifestPath string) (string, error) {
+	rel, err := filepath.Rel(vaultRoot, manifestPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,302 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func packTestConfig(t *testing.T, maxPackSize string) config.VaultConfig {
+	t.Helper()
+	vaultConfig := testutil.CreateTestVaultConfig(t, "packs")
+	vaultConfig.Encryption = config.EncryptionConfig{Type: "none"}
+	vaultConfig.Compression = "gzip"
+	vaultConfig.Packing = config.PackingConfig{Enabled: true, Threshold: "1KB", MaxPackSize: maxPackSize}
+	return *vaultConfig
+}
+
+// writePackedFiles packs the given contents in one transaction and writes a manifest for each
+func writePackedFiles(t *testing.T, vaultRoot string, vaultConfig config.VaultConfig, contents map[string][]byte) map[string]*config.PackRef {
+	t.Helper()
+	txn, err := atomic.Begin(vaultRoot, nil)
+	if err != nil {
+		t.Fatalf("Begin() error: %v", err)
+	}
+	writer, err := NewWriter(vaultRoot, vaultConfig, "", txn)
+	if err != nil {
+		t.Fatalf("NewWriter() error: %v", err)
+	}
+
+	refs := make(map[string]*config.PackRef)
+	for _, name := range sortedKeys(contents) {
+		ref, err := writer.Add(contents[name])
+		if err != nil {
+			t.Fatalf("Add(%s) error: %v", name, err)
+		}
+		refs[name] = ref
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit() error: %v", err)
+	}
+
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, ref := range refs {
+		data, err := yaml.Marshal(&config.FileManifest{FilePath: name, Size: int64(len(contents[name])), Pack: ref})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(manifestsDir, name+".yaml"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return refs
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func noteContents(n int, size int) map[string][]byte {
+	contents := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		contents[fmt.Sprintf("file%d.txt", i)] = bytes.Repeat([]byte{byte('a' + i)}, size)
+	}
+	return contents
+}
+
+func TestShouldPack(t *testing.T) {
+	vaultConfig := packTestConfig(t, "8MB")
+	if !ShouldPack(vaultConfig, 100) {
+		t.Error("expected a 100 byte file to be packed")
+	}
+	if ShouldPack(vaultConfig, 4096) {
+		t.Error("expected a 4KB file not to be packed with a 1KB threshold")
+	}
+	vaultConfig.Packing.Enabled = false
+	if ShouldPack(vaultConfig, 100) {
+		t.Error("expected no packing when packing is disabled")
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+	contents := noteContents(3, 200)
+	contents["file3.txt"] = []byte{} // empty files are packed too
+
+	refs := writePackedFiles(t, vaultRoot, vaultConfig, contents)
+
+	ids, err := layout.ListPackIDs(vaultRoot)
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("expected 1 pack, got %v (err %v)", ids, err)
+	}
+	for name, ref := range refs {
+		got, err := ReadFile(vaultRoot, vaultConfig, "", ref)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error: %v", name, err)
+		}
+		testutil.CompareBytes(t, contents[name], got, name)
+	}
+}
+
+func TestWriterSealsFullPacks(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "100B")
+	vaultConfig.Compression = "none"
+
+	writePackedFiles(t, vaultRoot, vaultConfig, noteContents(3, 60))
+
+	ids, _ := layout.ListPackIDs(vaultRoot)
+	if len(ids) != 3 {
+		t.Errorf("expected each 60 byte file to start a new 100 byte pack, got %d packs", len(ids))
+	}
+}
+
+func TestFlushVerifiesAfterWrite(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+	txn, err := atomic.Begin(vaultRoot, nil)
+	if err != nil {
+		t.Fatalf("Begin() error: %v", err)
+	}
+	defer func() { _ = txn.Rollback() }()
+	writer, err := NewWriter(vaultRoot, vaultConfig, "", txn)
+	if err != nil {
+		t.Fatalf("NewWriter() error: %v", err)
+	}
+	writer.SetVerifyAfterWrite(true)
+
+	if _, err := writer.Add([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Errorf("Flush() of an intact pack error: %v", err)
+	}
+
+	// A recorded hash that does not match what was written fails the flush
+	ref, err := writer.Add([]byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Hash = "0000"
+	if err := writer.Flush(); err == nil {
+		t.Error("Flush() accepted a pack entry that does not match its hash")
+	}
+}
+
+func TestReadFileDetectsCorruption(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+	vaultConfig.Compression = "none"
+
+	refs := writePackedFiles(t, vaultRoot, vaultConfig, noteContents(1, 50))
+	ref := refs["file0.txt"]
+
+	packPath := layout.PackPath(vaultRoot, ref.ID)
+	data, _ := os.ReadFile(packPath)
+	data[ref.Offset] ^= 0xff
+	if err := os.WriteFile(packPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadFile(vaultRoot, vaultConfig, "", ref); err == nil {
+		t.Error("expected integrity error for corrupted pack entry")
+	}
+}
+
+func TestRepack(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+	vaultConfig.Compression = "none"
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+
+	contents := noteContents(4, 100)
+	writePackedFiles(t, vaultRoot, vaultConfig, contents)
+	oldIDs, _ := layout.ListPackIDs(vaultRoot)
+
+	// Delete half of the packed files, leaving the pack 50% dead
+	for _, name := range []string{"file0.txt", "file2.txt"} {
+		if err := os.Remove(filepath.Join(manifestsDir, name+".yaml")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := Repack(vaultRoot, vaultConfig, "")
+	if err != nil {
+		t.Fatalf("Repack() error: %v", err)
+	}
+	if result.PacksRewritten != 1 || result.EntriesMoved != 2 || result.BytesReclaimed != 200 {
+		t.Errorf("unexpected repack result: %+v", result)
+	}
+
+	newIDs, _ := layout.ListPackIDs(vaultRoot)
+	if len(newIDs) != 1 || newIDs[0] == oldIDs[0] {
+		t.Fatalf("expected the old pack to be replaced, before %v after %v", oldIDs, newIDs)
+	}
+
+	manager, _ := config.NewManager(vaultRoot)
+	entries, err := manager.GetManifestEntries()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 manifests after repack, got %d (err %v)", len(entries), err)
+	}
+	for _, entry := range entries {
+		if entry.Manifest.Pack.ID != newIDs[0] {
+			t.Errorf("%s still points at pack %s", entry.Manifest.FilePath, entry.Manifest.Pack.ID)
+		}
+		got, err := ReadFile(vaultRoot, vaultConfig, "", entry.Manifest.Pack)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) after repack error: %v", entry.Manifest.FilePath, err)
+		}
+		testutil.CompareBytes(t, contents[entry.Manifest.FilePath], got, entry.Manifest.FilePath)
+	}
+
+	// Once every file is deleted the pack is removed outright
+	for _, entry := range entries {
+		if err := os.Remove(entry.Path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err = Repack(vaultRoot, vaultConfig, "")
+	if err != nil {
+		t.Fatalf("Repack() error: %v", err)
+	}
+	if result.PacksRemoved != 1 {
+		t.Errorf("expected 1 pack removed, got %+v", result)
+	}
+	if ids, _ := layout.ListPackIDs(vaultRoot); len(ids) != 0 {
+		t.Errorf("expected no packs left, got %v", ids)
+	}
+}
+
+func TestRepackMergesSmallPacks(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+
+	// Two separate adds produce two small packs
+	writePackedFiles(t, vaultRoot, vaultConfig, noteContents(1, 100))
+	writePackedFiles(t, vaultRoot, vaultConfig, map[string][]byte{"other.txt": []byte("other")})
+
+	result, err := Repack(vaultRoot, vaultConfig, "")
+	if err != nil {
+		t.Fatalf("Repack() error: %v", err)
+	}
+	if result.PacksRewritten != 2 {
+		t.Errorf("expected both small packs to be merged, got %+v", result)
+	}
+	if ids, _ := layout.ListPackIDs(vaultRoot); len(ids) != 1 {
+		t.Errorf("expected a single merged pack, got %v", ids)
+	}
+}
+
+func TestRepackKeepsSnapshotPacks(t *testing.T) {
+	vaultRoot := t.TempDir()
+	vaultConfig := packTestConfig(t, "8MB")
+	vaultConfig.Compression = "none"
+
+	writePackedFiles(t, vaultRoot, vaultConfig, noteContents(2, 100))
+	if _, err := snapshot.Create(vaultRoot, ""); err != nil {
+		t.Fatal(err)
+	}
+	oldIDs, _ := layout.ListPackIDs(vaultRoot)
+
+	// Every file is deleted, but the snapshot still points into the pack
+	manifests, _ := filepath.Glob(filepath.Join(vaultRoot, ".sietch", "manifests", "*.yaml"))
+	for _, path := range manifests {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := Repack(vaultRoot, vaultConfig, "")
+	if err != nil {
+		t.Fatalf("Repack() error: %v", err)
+	}
+	if result.PacksRemoved != 0 || result.PacksRewritten != 0 {
+		t.Errorf("expected the snapshot's pack to be kept, got %+v", result)
+	}
+	if ids, _ := layout.ListPackIDs(vaultRoot); len(ids) != 1 || ids[0] != oldIDs[0] {
+		t.Errorf("packs after repack = %v, want %v", ids, oldIDs)
+	}
+}
@@ -0,0 +1,201 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+)
+
+// RepackResult summarises a garbage collection pass over the vault's packs
+type RepackResult struct {
+	PacksRemoved   int   // Packs with no live entries that were deleted
+	PacksRewritten int   // Packs whose live entries were moved into new packs
+	EntriesMoved   int   // Live entries copied into new packs
+	BytesReclaimed int64 // Bytes freed by removed packs plus dead bytes dropped from rewritten packs
+}
+
+// Repack reclaims space held by deleted packed files. Packs no longer referenced by any
+// manifest or snapshot are removed; packs with at least PackRepackWasteRatio dead bytes,
+// and small packs when several of them exist, have their live entries moved into fresh
+// packs. Packs referenced by a snapshot are never rewritten.
+// New packs, updated manifests and removals are applied in a single transaction.
+func Repack(vaultRoot string, vaultConfig config.VaultConfig, passphrase string) (*RepackResult, error) {
+	result := &RepackResult{}
+
+	ids, err := layout.ListPackIDs(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	entries, err := manager.GetManifestEntries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifests: %v", err)
+	}
+	live := make(map[string][]*config.ManifestEntry)
+	for _, entry := range entries {
+		if entry.Manifest.Pack != nil {
+			live[entry.Manifest.Pack.ID] = append(live[entry.Manifest.Pack.ID], entry)
+		}
+	}
+	// Snapshot manifests point at packs by ID and offset, so their packs stay as they are
+	snapshotRefs, err := snapshot.CollectReferences(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "repack"})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	writer, err := NewWriter(vaultRoot, vaultConfig, passphrase, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(ids))
+	var smallPacks int
+	for _, id := range ids {
+		info, err := os.Stat(layout.PackPath(vaultRoot, id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat pack %s: %v", id, err)
+		}
+		sizes[id] = info.Size()
+		if len(live[id]) > 0 && !snapshotRefs.Packs[id] && isSmallPack(info.Size(), writer.maxSize) {
+			smallPacks++
+		}
+	}
+	// Merging a lone small pack would only rewrite it, so small packs are merged in groups
+	mergeSmall := smallPacks > 1
+
+	var rewritten []*config.ManifestEntry
+	for _, id := range ids {
+		if snapshotRefs.Packs[id] {
+			continue
+		}
+		refs := live[id]
+		if len(refs) == 0 {
+			if err := txn.StageDelete(layout.PackRelPath(id)); err != nil {
+				return nil, fmt.Errorf("failed to stage removal of pack %s: %v", id, err)
+			}
+			result.PacksRemoved++
+			result.BytesReclaimed += sizes[id]
+			continue
+		}
+
+		plain, err := readPack(vaultRoot, vaultConfig, passphrase, id)
+		if err != nil {
+			return nil, err
+		}
+
+		// Several manifests may point at the same entry; count and move it once
+		liveBytes := int64(0)
+		seen := make(map[int64]bool)
+		for _, entry := range refs {
+			if !seen[entry.Manifest.Pack.Offset] {
+				seen[entry.Manifest.Pack.Offset] = true
+				liveBytes += entry.Manifest.Pack.Length
+			}
+		}
+		deadBytes := int64(len(plain)) - liveBytes
+		wasteful := len(plain) > 0 && float64(deadBytes)/float64(len(plain)) >= constants.PackRepackWasteRatio
+		if !wasteful && !(mergeSmall && isSmallPack(sizes[id], writer.maxSize)) {
+			continue
+		}
+
+		moved := make(map[int64]*config.PackRef)
+		for _, entry := range refs {
+			old := entry.Manifest.Pack
+			newRef, ok := moved[old.Offset]
+			if !ok {
+				if old.Offset < 0 || old.Length < 0 || old.Offset+old.Length > int64(len(plain)) {
+					return nil, fmt.Errorf("pack %s: entry for %s is out of range", id, entry.Manifest.FilePath)
+				}
+				newRef, err = writer.appendEntry(plain[old.Offset : old.Offset+old.Length])
+				if err != nil {
+					return nil, err
+				}
+				newRef.Hash = old.Hash
+				newRef.Compressed = old.Compressed
+				newRef.CompressionType = old.CompressionType
+				moved[old.Offset] = newRef
+				result.EntriesMoved++
+			}
+			refCopy := *newRef
+			entry.Manifest.Pack = &refCopy
+			rewritten = append(rewritten, entry)
+		}
+
+		if err := txn.StageDelete(layout.PackRelPath(id)); err != nil {
+			return nil, fmt.Errorf("failed to stage removal of pack %s: %v", id, err)
+		}
+		result.PacksRewritten++
+		result.BytesReclaimed += deadBytes
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	compress := config.ManifestCompression(vaultRoot)
+	for _, entry := range rewritten {
+		if err := stageManifest(txn, vaultRoot, entry, compress); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("commit repack: %w", err)
+	}
+	committed = true
+	return result, nil
+}
+
+// isSmallPack reports whether a pack is small enough to be worth merging with others
+func isSmallPack(onDiskSize int64, maxSize int64) bool {
+	return onDiskSize < maxSize/4
+}
+
+// stageManifest rewrites a file manifest through the transaction
+func stageManifest(txn *atomic.Transaction, vaultRoot string, entry *config.ManifestEntry, compress bool) error {
+	rel, err := manifestRelPath(vaultRoot, entry.Path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve manifest path %s: %v", entry.Path, err)
+	}
+	w, err := txn.StageReplace(rel)
+	if err != nil {
+		return fmt.Errorf("stage manifest %s: %w", rel, err)
+	}
+	mw := config.NewManifestWriter(w, compress)
+	enc := yaml.NewEncoder(mw)
+	enc.SetIndent(2)
+	if err := enc.Encode(&entry.Manifest); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode manifest %s: %w", rel, err)
+	}
+	if err := mw.Close(); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode manifest %s: %w", rel, err)
+	}
+	return w.Close()
+}
@@ -0,0 +1,575 @@
+// Package rechunk re-ingests every file of a vault under new chunking, hashing
+// or compression settings. Files are read back from the existing chunk store,
+// split and hashed again, and their manifests rewritten in batches; each batch
+// commits in one transaction together with the progress made, so an interrupted
+// rechunk resumes after the last batch it committed. Once every file has been
+// rewritten, vault.yaml is switched to the new settings and chunks and packs no
+// file or snapshot references any more are removed.
+package rechunk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/encryption/pathencryption"
+	"github.com/substantialcattle5/sietch/internal/fsck"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+	"github.com/substantialcattle5/sietch/internal/pack"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+const (
+	// command names rechunk transactions, so interrupted ones can be found
+	command = "vault rechunk"
+
+	// A batch commits after this many files or bytes, whichever comes first
+	batchFiles = 100
+	batchBytes = 256 << 20
+)
+
+// stateRelPath is where the progress of a rechunk is kept while it runs
+var stateRelPath = filepath.ToSlash(filepath.Join(".sietch", "rechunk.yaml"))
+
+// ErrUnchanged is returned by Start when the vault already uses the settings
+var ErrUnchanged = errors.New("vault already uses these settings")
+
+// Settings are the vault.yaml settings a rechunk changes
+type Settings struct {
+	Strategy         string `yaml:"strategy"`
+	ChunkSize        string `yaml:"chunk_size"`
+	HashAlgorithm    string `yaml:"hash_algorithm"`
+	Compression      string `yaml:"compression"`
+	CompressionLevel int    `yaml:"compression_level,omitempty"`
+}
+
+// SettingsOf returns the settings a vault is configured with
+func SettingsOf(vaultConfig *config.VaultConfig) Settings {
+	s := Settings{
+		Strategy:         vaultConfig.Chunking.Strategy,
+		ChunkSize:        vaultConfig.Chunking.ChunkSize,
+		HashAlgorithm:    vaultConfig.Chunking.HashAlgorithm,
+		Compression:      vaultConfig.Compression,
+		CompressionLevel: vaultConfig.CompressionLevel,
+	}
+	if s.HashAlgorithm == "" {
+		s.HashAlgorithm = constants.HashAlgorithmSHA256
+	}
+	if s.Compression == "" {
+		s.Compression = constants.CompressionTypeNone
+	}
+	return s
+}
+
+// Apply returns a copy of vaultConfig using s
+func (s Settings) Apply(vaultConfig config.VaultConfig) config.VaultConfig {
+	vaultConfig.Chunking.Strategy = s.Strategy
+	vaultConfig.Chunking.ChunkSize = s.ChunkSize
+	vaultConfig.Chunking.HashAlgorithm = s.HashAlgorithm
+	vaultConfig.Compression = s.Compression
+	vaultConfig.CompressionLevel = s.CompressionLevel
+	return vaultConfig
+}
+
+// Validate checks every setting as 'sietch config set' would
+func (s Settings) Validate() error {
+	values := []struct{ key, value string }{
+		{"chunking.strategy", s.Strategy},
+		{"chunking.chunk_size", s.ChunkSize},
+		{"chunking.hash_algorithm", s.HashAlgorithm},
+		{"compression", s.Compression},
+	}
+	for _, v := range values {
+		if err := config.ValidateSetting(v.key, v.value); err != nil {
+			return err
+		}
+	}
+	if err := compression.ValidateLevel(s.Compression, s.CompressionLevel); err != nil {
+		return fmt.Errorf("compression_level: %v", err)
+	}
+	return nil
+}
+
+// String describes the settings, e.g. "fixed 4MB chunks, sha256, zstd (level 3)"
+func (s Settings) String() string {
+	return fmt.Sprintf("%s %s chunks, %s, %s", s.Strategy, s.ChunkSize, s.HashAlgorithm, compression.Describe(s.Compression, s.CompressionLevel))
+}
+
+// State is the progress of a rechunk, kept in .sietch/rechunk.yaml until it finishes
+type State struct {
+	StartedAt time.Time `yaml:"started_at"`
+	From      Settings  `yaml:"from"`
+	To        Settings  `yaml:"to"`
+	Cursor    string    `yaml:"cursor,omitempty"` // Manifest file the last committed batch ended with
+	Files     int       `yaml:"files"`            // Files rewritten so far
+}
+
+// InProgress reports whether a rechunk of the vault was started and has not finished
+func InProgress(vaultRoot string) bool {
+	_, err := os.Stat(filepath.Join(vaultRoot, stateRelPath))
+	return err == nil
+}
+
+// LoadState returns the progress of an unfinished rechunk, or nil when none is in progress
+func LoadState(vaultRoot string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(vaultRoot, stateRelPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rechunk progress: %v", err)
+	}
+	var state State
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse rechunk progress: %v", err)
+	}
+	return &state, nil
+}
+
+// Resume settles a batch a previous run was interrupted in and returns the
+// progress of the unfinished rechunk, or nil when none is in progress. A batch
+// that was still being staged is dropped: its files come after the saved cursor
+// and are rewritten again. One that had started committing is completed.
+func Resume(vaultRoot string) (*State, error) {
+	recovered, err := atomic.FinishInterrupted(vaultRoot, command)
+	if err != nil {
+		return nil, err
+	}
+	if len(recovered.Errors) > 0 {
+		return nil, fmt.Errorf("failed to recover an interrupted rechunk batch: %v", recovered.Errors[0])
+	}
+	return LoadState(vaultRoot)
+}
+
+// Start records a rechunk of the vault from its current settings to to. Nothing
+// is rewritten until Run.
+func Start(vaultRoot string, vaultConfig *config.VaultConfig, to Settings) (*State, error) {
+	if InProgress(vaultRoot) {
+		return nil, fmt.Errorf("a rechunk is already in progress")
+	}
+	if err := to.Validate(); err != nil {
+		return nil, err
+	}
+	target := to.Apply(*vaultConfig)
+	if err := config.ValidateChunkSizes(target.Chunking, target.Deduplication); err != nil {
+		return nil, err
+	}
+	from := SettingsOf(vaultConfig)
+	if from == to {
+		return nil, ErrUnchanged
+	}
+	// Other vaults registered with the store still reference the old chunks
+	if layout.SharedStore(vaultRoot) != "" {
+		return nil, fmt.Errorf("vaults using a shared chunk store cannot be rechunked")
+	}
+	if from.HashAlgorithm != to.HashAlgorithm {
+		// Snapshot manifests keep referencing chunks hashed the old way, which
+		// could no longer be read once the vault hashes differently
+		snapshots, err := snapshot.List(vaultRoot)
+		if err != nil {
+			return nil, err
+		}
+		if len(snapshots) > 0 {
+			return nil, fmt.Errorf("the vault has %d snapshot(s) whose files were hashed with %s; delete them before changing the hash algorithm",
+				len(snapshots), from.HashAlgorithm)
+		}
+	}
+
+	state := &State{StartedAt: time.Now().UTC(), From: from, To: to}
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rechunk progress: %v", err)
+	}
+	if err := atomic.WriteFile(filepath.Join(vaultRoot, stateRelPath), data, constants.StandardFilePerms); err != nil {
+		return nil, fmt.Errorf("failed to save rechunk progress: %v", err)
+	}
+	return state, nil
+}
+
+// Plan lists the files a rechunk still has to rewrite
+type Plan struct {
+	Manifests []string // Manifest file names, in the order they are rewritten
+	Bytes     int64
+}
+
+// PlanFor lists the manifests after the state's cursor. Files that cannot be
+// read back are refused up front rather than left behind half way through.
+func PlanFor(vaultRoot string, state *State) (*Plan, error) {
+	plan := &Plan{}
+	err := config.WalkManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(entry *config.ManifestEntry) error {
+		name := filepath.Base(entry.Path)
+		if name <= state.Cursor {
+			return nil
+		}
+		file := &entry.Manifest
+		if file.Damaged {
+			return fmt.Errorf("%s is damaged; run 'sietch fsck --repair' or delete it before rechunking", name)
+		}
+		for _, ref := range file.Chunks {
+			if _, exists := layout.LocateChunk(vaultRoot, chunker.StorageKey(ref)); ref.Remote && !exists {
+				return fmt.Errorf("%s has chunks that are not local yet; run 'sietch sync' before rechunking", name)
+			}
+		}
+		plan.Manifests = append(plan.Manifests, name)
+		plan.Bytes += file.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Options configures Run
+type Options struct {
+	Passphrase string
+	Retry      chunker.RetryPolicy // Retries of failed chunk reads and writes; the zero value disables them
+	// OnFile, if set, is called after each file has been rewritten
+	OnFile func(done, total int)
+}
+
+// Result summarises a rechunk run
+type Result struct {
+	Files          int   // Files rewritten by this run
+	Bytes          int64 // Their total size
+	NewChunks      int   // Chunks stored under the new settings
+	ReusedChunks   int   // Chunks that were already stored
+	OrphansDeleted int   // Old chunks and packs removed
+	BytesFreed     int64
+}
+
+// Run rewrites the files the state has not reached yet, then switches the vault
+// to the new settings and removes the old chunks. vaultConfig is updated to the
+// new settings when Run succeeds. After Run fails or is cancelled, or the process
+// dies, Resume returns the state to call it with again.
+func Run(ctx context.Context, vaultRoot string, vaultConfig *config.VaultConfig, state *State, opts Options) (*Result, error) {
+	result := &Result{}
+	plan, err := PlanFor(vaultRoot, state)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRewriter(vaultRoot, vaultConfig, state, opts)
+	if err != nil {
+		return nil, err
+	}
+	for done := 0; done < len(plan.Manifests); {
+		n, err := r.batch(ctx, plan.Manifests[done:], done, len(plan.Manifests))
+		if err != nil {
+			return nil, err
+		}
+		done += n
+	}
+	result.Files = r.files
+	result.Bytes = r.bytes
+	result.NewChunks = r.newChunks
+	result.ReusedChunks = r.reusedChunks
+
+	if err := finish(vaultRoot, vaultConfig, state, opts.Passphrase, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// finish switches vault.yaml to the new settings, removes what only the old
+// files used, and drops the progress file
+func finish(vaultRoot string, vaultConfig *config.VaultConfig, state *State, passphrase string, result *Result) error {
+	updated := state.To.Apply(*vaultConfig)
+	if err := config.SaveVaultConfig(vaultRoot, &updated); err != nil {
+		return fmt.Errorf("failed to update vault configuration: %v", err)
+	}
+	*vaultConfig = updated
+
+	report, err := fsck.Check(vaultRoot, vaultConfig)
+	if err != nil {
+		return fmt.Errorf("failed to find old chunks: %v", err)
+	}
+	repaired, err := fsck.Repair(report, fsck.RepairOptions{DeleteOrphans: true})
+	if err != nil {
+		return fmt.Errorf("failed to remove old chunks: %v", err)
+	}
+	result.OrphansDeleted = repaired.OrphansDeleted
+	result.BytesFreed = repaired.BytesFreed
+
+	// Small files were packed again batch by batch; merge the small packs
+	if ids, err := layout.ListPackIDs(vaultRoot); err == nil && len(ids) > 0 {
+		repacked, err := pack.Repack(vaultRoot, *vaultConfig, passphrase)
+		if err != nil {
+			return fmt.Errorf("repack failed: %v", err)
+		}
+		result.BytesFreed += repacked.BytesReclaimed
+	}
+
+	if err := os.Remove(filepath.Join(vaultRoot, stateRelPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove rechunk progress: %v", err)
+	}
+	return nil
+}
+
+// rewriter reads files with the old settings and stores them with the new ones
+type rewriter struct {
+	vaultRoot  string
+	state      *State
+	opts       Options
+	toConfig   config.VaultConfig
+	fromConfig config.VaultConfig
+	read       chunker.Options
+	write      chunker.Options
+	paths      *pathencryption.Cipher
+	dedup      *deduplication.Manager
+
+	files, newChunks, reusedChunks int
+	bytes                          int64
+}
+
+func newRewriter(vaultRoot string, vaultConfig *config.VaultConfig, state *State, opts Options) (*rewriter, error) {
+	if err := chunk.ValidateCompressionPolicies(vaultConfig.CompressionPolicies); err != nil {
+		return nil, fmt.Errorf("invalid compression policy in vault configuration: %v", err)
+	}
+	r := &rewriter{
+		vaultRoot:  vaultRoot,
+		state:      state,
+		opts:       opts,
+		toConfig:   state.To.Apply(*vaultConfig),
+		fromConfig: state.From.Apply(*vaultConfig),
+	}
+	var err error
+	if r.read, err = chunker.OptionsFromConfig(vaultRoot, r.fromConfig, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	if r.write, err = chunker.OptionsFromConfig(vaultRoot, r.toConfig, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	if r.paths, err = pathencryption.Unlock(vaultRoot, vaultConfig, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	if err = deduplication.UnlockIndex(vaultRoot, vaultConfig, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	if r.dedup, err = deduplication.NewManager(vaultRoot, r.toConfig.Deduplication); err != nil {
+		return nil, fmt.Errorf("failed to initialize deduplication manager: %v", err)
+	}
+	return r, nil
+}
+
+// batch rewrites the first files of names in one transaction, together with the
+// new cursor, and returns how many it rewrote
+func (r *rewriter) batch(ctx context.Context, names []string, done, total int) (int, error) {
+	txn, err := atomic.Begin(r.vaultRoot, map[string]any{"command": command})
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var packWriter *pack.Writer
+	if r.toConfig.Packing.Enabled {
+		if packWriter, err = pack.NewWriter(r.vaultRoot, r.toConfig, r.opts.Passphrase, txn); err != nil {
+			return 0, err
+		}
+	}
+	store := r.dedup.TransactionalStore(txn)
+
+	n := 0
+	var size int64
+	var newChunks, reusedChunks int
+	for n < len(names) && n < batchFiles && size < batchBytes {
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("rechunk interrupted; run it again to resume")
+		}
+		name := names[n]
+		file, err := manifest.LoadFileManifest(r.vaultRoot, strings.TrimSuffix(name, ".yaml"))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", name, err)
+		}
+		rewritten, err := r.rewrite(ctx, file, store, packWriter)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", name, err)
+		}
+		if err := stageYAML(txn, filepath.ToSlash(filepath.Join(".sietch", "manifests", name)), rewritten, r.toConfig.CompressesManifests()); err != nil {
+			return 0, err
+		}
+		// The old chunks lose the references the file held; those left unused are
+		// removed once every file has been rewritten
+		r.dedup.ReleaseChunks(file.Chunks)
+		for _, ref := range rewritten.Chunks {
+			switch {
+			case ref.Zero:
+			case ref.Deduplicated:
+				reusedChunks++
+			default:
+				newChunks++
+			}
+		}
+		size += file.Size
+		n++
+	}
+
+	next := *r.state
+	next.Cursor = names[n-1]
+	next.Files += n
+	if err := stageYAML(txn, stateRelPath, &next, false); err != nil {
+		return 0, err
+	}
+	if packWriter != nil {
+		if err := packWriter.Flush(); err != nil {
+			return 0, fmt.Errorf("failed to write pack: %w", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	committed = true
+	*r.state = next
+	if err := r.dedup.Save(); err != nil {
+		return 0, fmt.Errorf("failed to save deduplication index (run 'sietch index rebuild'): %v", err)
+	}
+
+	r.files += n
+	r.bytes += size
+	r.newChunks += newChunks
+	r.reusedChunks += reusedChunks
+	if r.opts.OnFile != nil {
+		for i := 1; i <= n; i++ {
+			r.opts.OnFile(done+i, total)
+		}
+	}
+	return n, nil
+}
+
+// rewrite reads a file back and stores it again under the new settings. It
+// returns the file's new manifest; the path, tags and timestamps are kept.
+func (r *rewriter) rewrite(ctx context.Context, file *config.FileManifest, store *deduplication.TxnStore, packWriter *pack.Writer) (*config.FileManifest, error) {
+	// Chunking policies and dedup scopes are matched against the vault path
+	vaultPath := file.Destination + file.FilePath
+	if r.paths != nil && file.EncryptedPath != "" {
+		revealed := *file
+		if err := r.paths.Reveal(&revealed); err != nil {
+			return nil, err
+		}
+		vaultPath = revealed.Destination + revealed.FilePath
+	}
+
+	content, err := r.open(file)
+	if err != nil {
+		return nil, err
+	}
+	counted := &countingReader{r: content}
+
+	rewritten := *file
+	if packWriter != nil && pack.ShouldPack(r.toConfig, file.Size) {
+		data, err := io.ReadAll(counted)
+		if err != nil {
+			return nil, err
+		}
+		if rewritten.Pack, err = packWriter.Add(data); err != nil {
+			return nil, fmt.Errorf("packing failed: %v", err)
+		}
+		rewritten.Chunks = nil
+		rewritten.Chunking = nil
+	} else {
+		storedWhole := file.Chunking != nil && file.Chunking.Strategy == chunk.StrategyWhole
+		policy := chunk.WholePolicy(file.Size)
+		if !chunk.StoresWhole(r.toConfig, file.Size, storedWhole) {
+			if policy, err = chunk.ResolvePolicyForVault(r.toConfig, vaultPath); err != nil {
+				return nil, err
+			}
+		}
+		fileCompression := chunk.ResolveCompression(r.toConfig, vaultPath, file.Size)
+		opts := r.write
+		opts.Strategy = policy.Strategy
+		opts.ChunkSize = policy.ChunkSize
+		opts.Compression = fileCompression.Algorithm
+		opts.Level = fileCompression.Level
+		if err := opts.UseDictionary(fileCompression.Dictionary); err != nil {
+			return nil, err
+		}
+		scoped := chunker.NewRetryStore(store.WithScope(deduplication.ResolveScope(r.toConfig.Deduplication.Scopes, vaultPath)), r.opts.Retry)
+		if policy.Strategy == chunk.StrategyWhole {
+			rewritten.Chunks, err = chunker.StoreWhole(counted, scoped, opts)
+		} else {
+			rewritten.Chunks, err = chunker.Split(ctx, counted, scoped, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rewritten.Pack = nil
+		rewritten.Chunking = policy.ManifestInfo()
+		rewritten.Chunking.HashAlgorithm = r.state.To.HashAlgorithm
+	}
+	if counted.n != file.Size {
+		return nil, fmt.Errorf("read %s back but the manifest records %s",
+			util.HumanReadableSize(counted.n), util.HumanReadableSize(file.Size))
+	}
+	return &rewritten, nil
+}
+
+// open returns the content of a file as it is stored now. Every chunk is
+// verified against its hash on the way.
+func (r *rewriter) open(file *config.FileManifest) (io.Reader, error) {
+	if file.Pack != nil {
+		data, err := pack.ReadFile(r.vaultRoot, r.fromConfig, r.opts.Passphrase, file.Pack)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+	opts := r.read
+	if file.Chunking != nil && file.Chunking.HashAlgorithm != "" {
+		opts.HashAlgorithm = file.Chunking.HashAlgorithm
+	}
+	return chunker.NewReader(chunker.NewRetryStore(chunker.NewVaultStore(r.vaultRoot), r.opts.Retry), file.Chunks, opts), nil
+}
+
+// stageYAML writes v to relPath through the transaction, compressed like a
+// manifest when compress is set
+func stageYAML(txn *atomic.Transaction, relPath string, v any, compress bool) error {
+	w, err := txn.StageReplace(relPath)
+	if err != nil {
+		return fmt.Errorf("stage %s: %w", relPath, err)
+	}
+	mw := config.NewManifestWriter(w, compress)
+	enc := yaml.NewEncoder(mw)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode %s: %w", relPath, err)
+	}
+	if err := mw.Close(); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode %s: %w", relPath, err)
+	}
+	return w.Close()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,185 @@
+package rechunk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// newTestVault returns an unencrypted vault holding one file per entry of
+// files, chunked into 4KB chunks
+func newTestVault(t *testing.T, files map[string][]byte) (string, *config.VaultConfig) {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	vaultConfig := &config.VaultConfig{}
+	vaultConfig.Encryption.Type = "none"
+	vaultConfig.Chunking.Strategy = "fixed"
+	vaultConfig.Chunking.ChunkSize = "4KB"
+	vaultConfig.Chunking.HashAlgorithm = "sha256"
+	vaultConfig.Compression = "none"
+
+	opts, err := chunker.OptionsFromConfig(vaultRoot, *vaultConfig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		refs, err := chunker.Split(context.Background(), bytes.NewReader(content), chunker.NewVaultStore(vaultRoot), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := yaml.Marshal(&config.FileManifest{FilePath: name, Size: int64(len(content)), Chunks: refs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(manifestsDir, name+".yaml"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vaultRoot, vaultConfig
+}
+
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// readBack reassembles a file from its manifest
+func readBack(t *testing.T, vaultRoot string, vaultConfig *config.VaultConfig, name string) ([]byte, *config.FileManifest) {
+	t.Helper()
+	file, err := manifest.LoadFileManifest(vaultRoot, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := chunker.OptionsFromConfig(vaultRoot, *vaultConfig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(chunker.NewReader(chunker.NewVaultStore(vaultRoot), file.Chunks, opts))
+	if err != nil {
+		t.Fatalf("reading %s back: %v", name, err)
+	}
+	return data, file
+}
+
+func TestRechunk(t *testing.T) {
+	files := map[string][]byte{
+		"a.bin": randomBytes(1, 20000),
+		"b.bin": randomBytes(2, 9000),
+	}
+	vaultRoot, vaultConfig := newTestVault(t, files)
+
+	to := SettingsOf(vaultConfig)
+	if _, err := Start(vaultRoot, vaultConfig, to); !errors.Is(err, ErrUnchanged) {
+		t.Fatalf("Start() with the current settings = %v, want ErrUnchanged", err)
+	}
+
+	to.ChunkSize = "8KB"
+	to.HashAlgorithm = "blake3"
+	state, err := Start(vaultRoot, vaultConfig, to)
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if !InProgress(vaultRoot) {
+		t.Fatal("InProgress() = false after Start()")
+	}
+	if _, err := Start(vaultRoot, vaultConfig, to); err == nil {
+		t.Error("Start() accepted a second rechunk")
+	}
+
+	result, err := Run(context.Background(), vaultRoot, vaultConfig, state, Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if result.Files != 2 || result.NewChunks != 5 {
+		t.Errorf("Run() rewrote %d files into %d new chunks, want 2 and 5", result.Files, result.NewChunks)
+	}
+	if result.OrphansDeleted != 8 {
+		t.Errorf("Run() removed %d old chunks, want 8", result.OrphansDeleted)
+	}
+	if InProgress(vaultRoot) {
+		t.Error("InProgress() = true after Run()")
+	}
+	if vaultConfig.Chunking.ChunkSize != "8KB" || vaultConfig.Chunking.HashAlgorithm != "blake3" {
+		t.Errorf("vault config not switched: %+v", vaultConfig.Chunking)
+	}
+	saved, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Chunking.ChunkSize != "8KB" {
+		t.Errorf("saved chunk size = %q, want 8KB", saved.Chunking.ChunkSize)
+	}
+
+	for name, want := range files {
+		got, file := readBack(t, vaultRoot, vaultConfig, name)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs after rechunking", name)
+		}
+		if file.Chunking == nil || file.Chunking.HashAlgorithm != "blake3" {
+			t.Errorf("%s manifest chunking = %+v, want blake3 recorded", name, file.Chunking)
+		}
+	}
+}
+
+func TestResumeRollsBackInterruptedBatch(t *testing.T) {
+	content := randomBytes(3, 10000)
+	vaultRoot, vaultConfig := newTestVault(t, map[string][]byte{"a.bin": content})
+
+	to := SettingsOf(vaultConfig)
+	to.ChunkSize = "2KB"
+	if _, err := Start(vaultRoot, vaultConfig, to); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	// A batch that staged its manifest but died before committing
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": command})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := txn.StageReplace(".sietch/manifests/a.bin.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("file: half written\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := Resume(vaultRoot)
+	if err != nil {
+		t.Fatalf("Resume() error: %v", err)
+	}
+	if state == nil || state.Cursor != "" || state.To != to {
+		t.Fatalf("Resume() = %+v, want the started rechunk with no progress", state)
+	}
+	if got, _ := readBack(t, vaultRoot, vaultConfig, "a.bin"); !bytes.Equal(got, content) {
+		t.Fatal("the interrupted batch was not rolled back")
+	}
+
+	if _, err := Run(context.Background(), vaultRoot, vaultConfig, state, Options{}); err != nil {
+		t.Fatalf("Run() after Resume() error: %v", err)
+	}
+	got, file := readBack(t, vaultRoot, vaultConfig, "a.bin")
+	if !bytes.Equal(got, content) || len(file.Chunks) != 5 {
+		t.Errorf("after resuming a.bin has %d chunks and matches=%v, want 5 chunks", len(file.Chunks), bytes.Equal(got, content))
+	}
+}
@@ -0,0 +1,583 @@
+// Package recompress rewrites the chunks a vault already stores with another
+// compression algorithm or level. Each chunk is decrypted, decompressed,
+// compressed again and encrypted again; its content hash does not change, so
+// only the stored copy and the refs describing it do. Chunks are rewritten in
+// batches that commit in one transaction together with every manifest, live or
+// in a snapshot, that references them and the progress made, so an interrupted
+// recompress resumes after the last batch it committed.
+package recompress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/encryption/pathencryption"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+const (
+	// command names recompress transactions, so interrupted ones can be found
+	command = "vault recompress"
+
+	// A batch commits after this many chunks or stored bytes, whichever comes first
+	batchChunks = 1000
+	batchBytes  = 256 << 20
+)
+
+// stateRelPath is where the progress of a recompress is kept while it runs
+var stateRelPath = filepath.ToSlash(filepath.Join(".sietch", "recompress.yaml"))
+
+// Target is the compression chunks are rewritten with
+type Target struct {
+	Algorithm string   `yaml:"algorithm"`
+	Level     int      `yaml:"level,omitempty"`
+	Paths     []string `yaml:"paths,omitempty"` // Vault paths to restrict the rewrite to; empty for the whole vault
+	Force     bool     `yaml:"force,omitempty"` // Also rewrite chunks already stored with Algorithm, e.g. to change the level
+}
+
+// Validate checks the algorithm and level as 'sietch config set' would
+func (t Target) Validate() error {
+	if err := config.ValidateSetting("compression", t.Algorithm); err != nil {
+		return err
+	}
+	if err := compression.ValidateLevel(t.Algorithm, t.Level); err != nil {
+		return fmt.Errorf("level: %v", err)
+	}
+	return nil
+}
+
+// String describes the target compression, e.g. "zstd (level 6)"
+func (t Target) String() string {
+	return compression.Describe(t.Algorithm, t.Level)
+}
+
+// SatisfiedBy reports whether a chunk is already stored the way the target
+// asks. The level a chunk was compressed at is not recorded, so unless Force
+// is set any chunk stored with the target algorithm is. So are chunks stored
+// uncompressed because compression did not save enough.
+func (t Target) SatisfiedBy(ref config.ChunkRef) bool {
+	if t.Force {
+		return false
+	}
+	if ref.Incompressible {
+		return true
+	}
+	if !ref.Compressed {
+		return t.Algorithm == constants.CompressionTypeNone
+	}
+	return ref.CompressionType == t.Algorithm
+}
+
+// includes reports whether a file at vaultPath is within the target's paths
+func (t Target) includes(vaultPath string) bool {
+	if len(t.Paths) == 0 {
+		return true
+	}
+	vaultPath = strings.TrimPrefix(vaultPath, "/")
+	for _, p := range t.Paths {
+		p = strings.Trim(p, "/")
+		if p == "" || vaultPath == p || strings.HasPrefix(vaultPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// State is the progress of a recompress, kept in .sietch/recompress.yaml until it finishes
+type State struct {
+	StartedAt   time.Time `yaml:"started_at"`
+	Target      Target    `yaml:"target"`
+	Cursor      string    `yaml:"cursor,omitempty"` // Hash of the last chunk the last committed batch rewrote
+	Chunks      int       `yaml:"chunks"`           // Chunks rewritten so far
+	BytesBefore int64     `yaml:"bytes_before"`     // Their stored size before and after
+	BytesAfter  int64     `yaml:"bytes_after"`
+}
+
+// InProgress reports whether a recompress of the vault was started and has not finished
+func InProgress(vaultRoot string) bool {
+	_, err := os.Stat(filepath.Join(vaultRoot, stateRelPath))
+	return err == nil
+}
+
+// LoadState returns the progress of an unfinished recompress, or nil when none is in progress
+func LoadState(vaultRoot string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(vaultRoot, stateRelPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recompress progress: %v", err)
+	}
+	var state State
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse recompress progress: %v", err)
+	}
+	return &state, nil
+}
+
+// Resume settles a batch a previous run was interrupted in and returns the
+// progress of the unfinished recompress, or nil when none is in progress
+func Resume(vaultRoot string) (*State, error) {
+	recovered, err := atomic.FinishInterrupted(vaultRoot, command)
+	if err != nil {
+		return nil, err
+	}
+	if len(recovered.Errors) > 0 {
+		return nil, fmt.Errorf("failed to recover an interrupted recompress batch: %v", recovered.Errors[0])
+	}
+	return LoadState(vaultRoot)
+}
+
+// Start records a recompress of the vault to target. Nothing is rewritten until Run.
+func Start(vaultRoot string, target Target) (*State, error) {
+	if InProgress(vaultRoot) {
+		return nil, fmt.Errorf("a recompress is already in progress")
+	}
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+	// Other vaults registered with the store read the same chunks
+	if layout.SharedStore(vaultRoot) != "" {
+		return nil, fmt.Errorf("vaults using a shared chunk store cannot be recompressed")
+	}
+
+	state := &State{StartedAt: time.Now().UTC(), Target: target}
+	if err := saveState(vaultRoot, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveState(vaultRoot string, state *State) error {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode recompress progress: %v", err)
+	}
+	if err := atomic.WriteFile(filepath.Join(vaultRoot, stateRelPath), data, constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to save recompress progress: %v", err)
+	}
+	return nil
+}
+
+// Chunk is a stored chunk a recompress rewrites
+type Chunk struct {
+	Ref           config.ChunkRef // As recorded by the first manifest found referencing it
+	HashAlgorithm string          // Algorithm its hash was computed with
+	StoredSize    int64
+}
+
+// Plan lists the chunks a recompress still has to rewrite
+type Plan struct {
+	Chunks   []Chunk // Ordered by hash; copies of one hash are rewritten in the same batch
+	Bytes    int64   // Stored size of Chunks
+	Skipped  int     // Chunks already stored with the target compression
+	NotLocal int     // Chunks that are not in the vault yet and cannot be read
+	Packed   int     // Files stored in packs, which are compressed with their pack
+
+	// referencedBy lists the manifests referencing each storage key, as paths
+	// relative to the vault root
+	referencedBy map[string][]string
+}
+
+// PlanFor lists the chunks of the files within the target's paths that come
+// after the state's cursor and are not stored with the target compression yet.
+// Without paths, chunks only snapshots reference are included too. passphrase
+// is needed to match paths in vaults that encrypt them.
+func PlanFor(vaultRoot string, vaultConfig *config.VaultConfig, state *State, passphrase string) (*Plan, error) {
+	var paths *pathencryption.Cipher
+	if len(state.Target.Paths) > 0 {
+		var err error
+		if paths, err = pathencryption.Unlock(vaultRoot, vaultConfig, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	hashAlgorithm := vaultConfig.Chunking.HashAlgorithm
+	if hashAlgorithm == "" {
+		hashAlgorithm = constants.HashAlgorithmSHA256
+	}
+
+	plan := &Plan{referencedBy: make(map[string][]string)}
+	candidates := make(map[string]Chunk)
+	visit := func(rel string, file *config.FileManifest, selected bool) {
+		if selected && file.Pack != nil {
+			plan.Packed++
+		}
+		algorithm := hashAlgorithm
+		if file.Chunking != nil && file.Chunking.HashAlgorithm != "" {
+			algorithm = file.Chunking.HashAlgorithm
+		}
+		for _, ref := range file.Chunks {
+			if ref.Zero {
+				continue
+			}
+			key := chunker.StorageKey(ref)
+			if refs := plan.referencedBy[key]; len(refs) == 0 || refs[len(refs)-1] != rel {
+				plan.referencedBy[key] = append(refs, rel)
+			}
+			if _, seen := candidates[key]; selected && !seen {
+				candidates[key] = Chunk{Ref: ref, HashAlgorithm: algorithm}
+			}
+		}
+	}
+
+	err := config.WalkManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(entry *config.ManifestEntry) error {
+		file := &entry.Manifest
+		vaultPath := file.Destination + file.FilePath
+		if file.EncryptedPath != "" && len(state.Target.Paths) > 0 {
+			revealed := *file
+			if err := paths.Reveal(&revealed); err != nil {
+				return err
+			}
+			vaultPath = revealed.Destination + revealed.FilePath
+		}
+		visit(vaultRel(vaultRoot, entry.Path), file, state.Target.includes(vaultPath))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := snapshot.List(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snapshots {
+		err := config.WalkManifestDir(snapshot.ManifestDir(vaultRoot, snap.ID), func(entry *config.ManifestEntry) error {
+			visit(vaultRel(vaultRoot, entry.Path), &entry.Manifest, len(state.Target.Paths) == 0)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for key, c := range candidates {
+		switch {
+		case state.Cursor != "" && c.Ref.Hash <= state.Cursor:
+			continue
+		case state.Target.SatisfiedBy(c.Ref):
+			plan.Skipped++
+			continue
+		}
+		loc, exists := layout.LocateChunk(vaultRoot, key)
+		if !exists {
+			plan.NotLocal++
+			continue
+		}
+		size, err := loc.Size()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat chunk %s: %v", key, err)
+		}
+		c.StoredSize = size
+		plan.Chunks = append(plan.Chunks, c)
+		plan.Bytes += c.StoredSize
+	}
+	sort.Slice(plan.Chunks, func(i, j int) bool {
+		a, b := plan.Chunks[i].Ref, plan.Chunks[j].Ref
+		if a.Hash != b.Hash {
+			return a.Hash < b.Hash
+		}
+		return chunker.StorageKey(a) < chunker.StorageKey(b)
+	})
+	return plan, nil
+}
+
+// vaultRel returns path relative to the vault root, slash separated
+func vaultRel(vaultRoot, path string) string {
+	rel, err := filepath.Rel(vaultRoot, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Options configures Run
+type Options struct {
+	Passphrase string
+	Retry      chunker.RetryPolicy // Retries of failed chunk reads; the zero value disables them
+	// OnChunk, if set, is called with the stored size of each chunk after its batch commits
+	OnChunk func(storedSize int64)
+}
+
+// Result summarises a recompress, including batches earlier interrupted runs committed
+type Result struct {
+	Chunks      int   // Chunks rewritten
+	BytesBefore int64 // Their stored size before
+	BytesAfter  int64 // and after
+}
+
+// Saved returns the space the recompress saved; negative when chunks grew
+func (r *Result) Saved() int64 {
+	return r.BytesBefore - r.BytesAfter
+}
+
+// Run rewrites the chunks of plan and drops the progress file. After Run fails
+// or is cancelled, or the process dies, Resume returns the state to call
+// PlanFor and Run with again.
+func Run(ctx context.Context, vaultRoot string, vaultConfig *config.VaultConfig, state *State, plan *Plan, opts Options) (*Result, error) {
+	r, err := newRewriter(vaultRoot, vaultConfig, state, plan, opts)
+	if err != nil {
+		return nil, err
+	}
+	for done := 0; done < len(plan.Chunks); {
+		n, err := r.batch(ctx, plan.Chunks[done:])
+		if err != nil {
+			return nil, err
+		}
+		done += n
+	}
+
+	if err := os.Remove(filepath.Join(vaultRoot, stateRelPath)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove recompress progress: %v", err)
+	}
+	return &Result{Chunks: state.Chunks, BytesBefore: state.BytesBefore, BytesAfter: state.BytesAfter}, nil
+}
+
+// rewriter reads chunks with the compression they were stored with and stores
+// them again with the target's
+type rewriter struct {
+	vaultRoot string
+	state     *State
+	plan      *Plan
+	opts      Options
+	read      chunker.Options
+	write     chunker.Options
+	store     chunker.ChunkStore
+	dedup     *deduplication.Manager
+}
+
+func newRewriter(vaultRoot string, vaultConfig *config.VaultConfig, state *State, plan *Plan, opts Options) (*rewriter, error) {
+	r := &rewriter{vaultRoot: vaultRoot, state: state, plan: plan, opts: opts}
+	var err error
+	if r.read, err = chunker.OptionsFromConfig(vaultRoot, *vaultConfig, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	r.write = r.read
+	r.write.Compression = state.Target.Algorithm
+	r.write.Level = state.Target.Level
+	r.write.Dictionary = nil
+	r.store = chunker.NewRetryStore(chunker.NewVaultStore(vaultRoot), opts.Retry)
+	if err = deduplication.UnlockIndex(vaultRoot, vaultConfig, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	if r.dedup, err = deduplication.NewManager(vaultRoot, vaultConfig.Deduplication); err != nil {
+		return nil, fmt.Errorf("failed to initialize deduplication manager: %v", err)
+	}
+	return r, nil
+}
+
+// batch rewrites the first chunks in one transaction, together with the
+// manifests referencing them and the new cursor, and returns how many it
+// rewrote. Copies of one hash are never split across batches, as the cursor is
+// a hash.
+func (r *rewriter) batch(ctx context.Context, chunks []Chunk) (int, error) {
+	txn, err := atomic.Begin(r.vaultRoot, map[string]any{"command": command})
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	rewritten := make(map[string]config.ChunkRef) // Old storage key -> new ref
+	staged := make(map[string]bool)               // New storage keys written by this batch
+	n := 0
+	var size, before, after int64
+	for n < len(chunks) && (n == 0 || chunks[n].Ref.Hash == chunks[n-1].Ref.Hash || (n < batchChunks && size < batchBytes)) {
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("recompress interrupted; run it again to resume")
+		}
+		c := chunks[n]
+		ref, written, err := r.rewrite(txn, c, staged)
+		if err != nil {
+			return 0, fmt.Errorf("chunk %s: %v", chunker.StorageKey(c.Ref), err)
+		}
+		rewritten[chunker.StorageKey(c.Ref)] = ref
+		size += c.StoredSize
+		before += c.StoredSize
+		after += written
+		n++
+	}
+
+	manifests := make(map[string]bool)
+	for key := range rewritten {
+		for _, rel := range r.plan.referencedBy[key] {
+			manifests[rel] = true
+		}
+	}
+	for rel := range manifests {
+		if err := updateManifest(r.vaultRoot, txn, rel, rewritten); err != nil {
+			return 0, err
+		}
+	}
+
+	next := *r.state
+	next.Cursor = chunks[n-1].Ref.Hash
+	next.Chunks += n
+	next.BytesBefore += before
+	next.BytesAfter += after
+	if err := stageYAML(txn, stateRelPath, &next, false); err != nil {
+		return 0, err
+	}
+	if err := txn.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	committed = true
+	*r.state = next
+
+	r.dedup.Recompressed(rewritten)
+	if err := r.dedup.Save(); err != nil {
+		return 0, fmt.Errorf("failed to save deduplication index (run 'sietch index rebuild'): %v", err)
+	}
+	if r.opts.OnChunk != nil {
+		for _, c := range chunks[:n] {
+			r.opts.OnChunk(c.StoredSize)
+		}
+	}
+	return n, nil
+}
+
+// rewrite stages a chunk compressed with the target's settings in place of
+// its stored copy and returns its new ref and the bytes written. Unencrypted
+// chunks are stored under their plaintext hash and replaced in place; encrypted
+// ones get a new storage key and the old copy is deleted.
+func (r *rewriter) rewrite(txn *atomic.Transaction, c Chunk, staged map[string]bool) (config.ChunkRef, int64, error) {
+	oldKey := chunker.StorageKey(c.Ref)
+	encoded, err := r.store.Get(c.Ref)
+	if err != nil {
+		return config.ChunkRef{}, 0, err
+	}
+	read := r.read
+	read.HashAlgorithm = c.HashAlgorithm
+	data, err := chunker.Decode(c.Ref, encoded, read)
+	if err != nil {
+		return config.ChunkRef{}, 0, err
+	}
+	write := r.write
+	write.HashAlgorithm = c.HashAlgorithm
+	ref, reencoded, err := chunker.Encode(data, c.Ref.Index, write)
+	if err != nil {
+		return config.ChunkRef{}, 0, err
+	}
+	if ref.Hash != c.Ref.Hash {
+		return config.ChunkRef{}, 0, fmt.Errorf("hash changed from %s to %s", c.Ref.Hash, ref.Hash)
+	}
+
+	oldLoc, exists := layout.LocateChunk(r.vaultRoot, oldKey)
+	if !exists {
+		return config.ChunkRef{}, 0, fmt.Errorf("%w: %s", chunker.ErrChunkNotFound, oldKey)
+	}
+	oldRel := vaultRel(r.vaultRoot, oldLoc.Path)
+	newKey := chunker.StorageKey(ref)
+	if newKey == oldKey && !oldLoc.Packed() {
+		return ref, int64(len(reencoded)), stageChunk(txn.StageReplace, oldRel, reencoded)
+	}
+
+	var written int64
+	// Convergently encrypted copies of the same chunk encrypt to the same data.
+	// Chunk packs are never modified, so a packed chunk is rewritten as a chunk
+	// file, which is found first; 'sietch dedup gc' drops the packed copy.
+	if _, exists := layout.LocateChunk(r.vaultRoot, newKey); (!exists || newKey == oldKey) && !staged[newKey] {
+		if err := stageChunk(txn.StageCreate, layout.ChunkRelPath(r.vaultRoot, newKey), reencoded); err != nil {
+			return config.ChunkRef{}, 0, err
+		}
+		staged[newKey] = true
+		written = int64(len(reencoded))
+	}
+	if oldLoc.Packed() {
+		return ref, written, nil
+	}
+	if err := txn.StageDelete(oldRel); err != nil {
+		return config.ChunkRef{}, 0, fmt.Errorf("stage delete %s: %w", oldRel, err)
+	}
+	return ref, written, nil
+}
+
+// stageChunk writes data to relPath through one of the transaction's Stage methods
+func stageChunk(stage func(string) (io.WriteCloser, error), relPath string, data []byte) error {
+	w, err := stage(relPath)
+	if err != nil {
+		return fmt.Errorf("stage %s: %w", relPath, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("write staged %s: %w", relPath, err)
+	}
+	return w.Close()
+}
+
+// updateManifest points the refs of one manifest at the rewritten chunks. The
+// stored encoding changes while the content stays the same, so snapshot
+// copies are updated as well.
+func updateManifest(vaultRoot string, txn *atomic.Transaction, rel string, rewritten map[string]config.ChunkRef) error {
+	data, err := os.ReadFile(filepath.Join(vaultRoot, filepath.FromSlash(rel)))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest %s: %v", rel, err)
+	}
+	// Each copy keeps the form it was written in
+	compress := config.IsCompressedManifest(data)
+	if data, err = config.DecodeManifestData(data); err != nil {
+		return fmt.Errorf("failed to read manifest %s: %v", rel, err)
+	}
+	var file config.FileManifest
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %v", rel, err)
+	}
+	for i := range file.Chunks {
+		ref := &file.Chunks[i]
+		if ref.Zero {
+			continue
+		}
+		updated, ok := rewritten[chunker.StorageKey(*ref)]
+		if !ok {
+			continue
+		}
+		ref.EncryptedHash = updated.EncryptedHash
+		ref.EncryptedSize = updated.EncryptedSize
+		ref.Convergent = updated.Convergent
+		ref.Compressed = updated.Compressed
+		ref.CompressionType = updated.CompressionType
+		ref.CompressionDict = updated.CompressionDict
+		ref.CompressedSize = updated.CompressedSize
+		ref.Incompressible = updated.Incompressible
+	}
+	return stageYAML(txn, rel, &file, compress)
+}
+
+// stageYAML writes v to relPath through the transaction, compressed like a
+// manifest when compress is set
+func stageYAML(txn *atomic.Transaction, relPath string, v any, compress bool) error {
+	w, err := txn.StageReplace(relPath)
+	if err != nil {
+		return fmt.Errorf("stage %s: %w", relPath, err)
+	}
+	mw := config.NewManifestWriter(w, compress)
+	enc := yaml.NewEncoder(mw)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode %s: %w", relPath, err)
+	}
+	if err := mw.Close(); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("encode %s: %w", relPath, err)
+	}
+	return w.Close()
+}
@@ -0,0 +1,217 @@
+package recompress
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// textFile returns n bytes of compressible text
+func textFile(seed, n int) []byte {
+	var b strings.Builder
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, "line %d of file %d: the quick brown fox jumps over the lazy dog\n", i, seed)
+	}
+	return []byte(b.String()[:n])
+}
+
+// newTestVault returns an unencrypted gzip vault holding files, keyed by
+// destination directory and name, chunked into 4KB chunks
+func newTestVault(t *testing.T, files map[string][]byte) (string, *config.VaultConfig) {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	vaultConfig := &config.VaultConfig{}
+	vaultConfig.Encryption.Type = "none"
+	vaultConfig.Chunking.Strategy = "fixed"
+	vaultConfig.Chunking.ChunkSize = "4KB"
+	vaultConfig.Chunking.HashAlgorithm = "sha256"
+	vaultConfig.Compression = "gzip"
+
+	opts, err := chunker.OptionsFromConfig(vaultRoot, *vaultConfig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range files {
+		refs, err := chunker.Split(context.Background(), bytes.NewReader(content), chunker.NewVaultStore(vaultRoot), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir, name := filepath.Split(path)
+		data, err := yaml.Marshal(&config.FileManifest{FilePath: name, Destination: dir, Size: int64(len(content)), Chunks: refs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(manifestsDir, name+".yaml"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vaultRoot, vaultConfig
+}
+
+// readBack reassembles a file from a manifest, live or in a snapshot
+func readBack(t *testing.T, vaultRoot string, vaultConfig *config.VaultConfig, manifestPath string) ([]byte, *config.FileManifest) {
+	t.Helper()
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file config.FileManifest
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := chunker.OptionsFromConfig(vaultRoot, *vaultConfig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(chunker.NewReader(chunker.NewVaultStore(vaultRoot), file.Chunks, opts))
+	if err != nil {
+		t.Fatalf("reading %s back: %v", filepath.Base(manifestPath), err)
+	}
+	return content, &file
+}
+
+func recompress(t *testing.T, vaultRoot string, vaultConfig *config.VaultConfig, target Target) (*Plan, *Result) {
+	t.Helper()
+	state, err := Start(vaultRoot, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanFor(vaultRoot, vaultConfig, state, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Run(context.Background(), vaultRoot, vaultConfig, state, plan, Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if InProgress(vaultRoot) {
+		t.Error("Run() left its progress file behind")
+	}
+	return plan, result
+}
+
+func TestRecompress(t *testing.T) {
+	files := map[string][]byte{
+		"docs/a.txt":  textFile(1, 10000),
+		"docs/b.txt":  textFile(2, 6000),
+		"other/c.txt": textFile(3, 9000),
+	}
+	vaultRoot, vaultConfig := newTestVault(t, files)
+	snap, err := snapshot.Create(vaultRoot, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := func(name string) string { return filepath.Join(vaultRoot, ".sietch", "manifests", name+".yaml") }
+
+	// Only the chunks of files under docs/ are rewritten
+	plan, result := recompress(t, vaultRoot, vaultConfig, Target{Algorithm: "zstd", Paths: []string{"docs/"}})
+	if len(plan.Chunks) != 5 || result.Chunks != 5 || result.BytesBefore == 0 {
+		t.Errorf("recompressed %d of %d planned chunks (%d bytes before), want 5", result.Chunks, len(plan.Chunks), result.BytesBefore)
+	}
+	for path, content := range files {
+		name := filepath.Base(path)
+		want := "gzip"
+		if strings.HasPrefix(path, "docs/") {
+			want = "zstd"
+		}
+		for _, p := range []string{manifestPath(name), filepath.Join(snapshot.ManifestDir(vaultRoot, snap.ID), name+".yaml")} {
+			got, file := readBack(t, vaultRoot, vaultConfig, p)
+			if !bytes.Equal(got, content) {
+				t.Errorf("%s: content changed", p)
+			}
+			for _, ref := range file.Chunks {
+				if ref.CompressionType != want {
+					t.Errorf("%s: chunk %d compressed with %s, want %s", p, ref.Index, ref.CompressionType, want)
+				}
+			}
+		}
+	}
+
+	// The rest of the vault; chunks already in zstd are skipped
+	plan, result = recompress(t, vaultRoot, vaultConfig, Target{Algorithm: "zstd"})
+	if plan.Skipped != 5 || result.Chunks != 3 {
+		t.Errorf("recompressed %d chunks and skipped %d, want 3 and 5", result.Chunks, plan.Skipped)
+	}
+	if got, _ := readBack(t, vaultRoot, vaultConfig, manifestPath("c.txt")); !bytes.Equal(got, files["other/c.txt"]) {
+		t.Error("c.txt: content changed")
+	}
+}
+
+func TestResumeSkipsCommittedChunks(t *testing.T) {
+	vaultRoot, vaultConfig := newTestVault(t, map[string][]byte{"a.txt": textFile(1, 12000)})
+	state, err := Start(vaultRoot, Target{Algorithm: "zstd", Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanFor(vaultRoot, vaultConfig, state, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Chunks) != 3 {
+		t.Fatalf("planned %d chunks, want 3", len(plan.Chunks))
+	}
+
+	// Commit the first chunk as an interrupted run would have
+	r, err := newRewriter(vaultRoot, vaultConfig, state, plan, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.batch(context.Background(), plan.Chunks[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := Resume(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed == nil || resumed.Chunks != 1 || resumed.Cursor != plan.Chunks[0].Ref.Hash {
+		t.Fatalf("Resume() = %+v, want one chunk done", resumed)
+	}
+	// Forced, so only the cursor keeps the rewritten chunk out of the plan
+	plan, err = PlanFor(vaultRoot, vaultConfig, resumed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Chunks) != 2 {
+		t.Errorf("planned %d chunks after resuming, want 2", len(plan.Chunks))
+	}
+}
+
+func TestTargetSatisfiedBy(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		ref    config.ChunkRef
+		want   bool
+	}{
+		{name: "same algorithm", target: Target{Algorithm: "zstd"}, ref: config.ChunkRef{Compressed: true, CompressionType: "zstd"}, want: true},
+		{name: "other algorithm", target: Target{Algorithm: "zstd"}, ref: config.ChunkRef{Compressed: true, CompressionType: "gzip"}},
+		{name: "uncompressed", target: Target{Algorithm: "zstd"}, ref: config.ChunkRef{}},
+		{name: "incompressible", target: Target{Algorithm: "zstd"}, ref: config.ChunkRef{Incompressible: true}, want: true},
+		{name: "to none", target: Target{Algorithm: "none"}, ref: config.ChunkRef{}, want: true},
+		{name: "forced", target: Target{Algorithm: "zstd", Force: true}, ref: config.ChunkRef{Compressed: true, CompressionType: "zstd"}},
+		{name: "unknown algorithm", target: Target{Algorithm: "gzip"}, ref: config.ChunkRef{Compressed: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.SatisfiedBy(tt.ref); got != tt.want {
+				t.Errorf("SatisfiedBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
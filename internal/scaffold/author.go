@@ -0,0 +1,27 @@
+package scaffold
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultAuthor returns the author to record for a scaffolded vault when none
+// is given: $GIT_AUTHOR_NAME, then git's user.name, then the login name.
+// It returns an empty string when none of them is set.
+func DefaultAuthor() string {
+	if author := strings.TrimSpace(os.Getenv("GIT_AUTHOR_NAME")); author != "" {
+		return author
+	}
+	if out, err := exec.Command("git", "config", "--get", "user.name").Output(); err == nil {
+		if author := strings.TrimSpace(string(out)); author != "" {
+			return author
+		}
+	}
+	for _, env := range []string{"USER", "USERNAME"} {
+		if author := strings.TrimSpace(os.Getenv(env)); author != "" {
+			return author
+		}
+	}
+	return ""
+}
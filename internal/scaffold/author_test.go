@@ -0,0 +1,34 @@
+package scaffold
+
+import "testing"
+
+func TestDefaultAuthor(t *testing.T) {
+	// Keep the developer's git configuration, including this repository's, out of the test
+	t.Chdir(t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", "")
+
+	tests := []struct {
+		name          string
+		gitAuthorName string
+		user          string
+		want          string
+	}{
+		{name: "git author env wins", gitAuthorName: "Paul Atreides", user: "paul", want: "Paul Atreides"},
+		{name: "falls back to login name", user: "chani", want: "chani"},
+		{name: "nothing set", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GIT_AUTHOR_NAME", tt.gitAuthorName)
+			t.Setenv("USER", tt.user)
+			t.Setenv("USERNAME", "")
+			if got := DefaultAuthor(); got != tt.want {
+				t.Errorf("DefaultAuthor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
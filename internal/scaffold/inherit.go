@@ -0,0 +1,156 @@
+package scaffold
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// loadRawTemplate reads a template from the user templates directory without
+// interpreting it, so merging can tell fields that are unset from zero values
+func loadRawTemplate(templateName string) (map[string]interface{}, error) {
+	templatesDir, err := GetTemplatesDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	templatePath := filepath.Join(templatesDir, templateName+".json")
+	if _, err := os.Stat(templatePath); err != nil {
+		return nil, fmt.Errorf("template '%s' not found in user config directory (%s)", templateName, templatesDir)
+	}
+
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template file: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse template file: %v", err)
+	}
+	return raw, nil
+}
+
+// resolveTemplate merges a template with the templates it extends, base first.
+// chain holds the names of the templates being resolved, to detect cycles.
+func resolveTemplate(raw map[string]interface{}, chain []string) (map[string]interface{}, error) {
+	extends, ok := raw["extends"]
+	if !ok || extends == "" {
+		return raw, nil
+	}
+	baseName, ok := extends.(string)
+	if !ok {
+		return nil, fmt.Errorf("extends must be a template name")
+	}
+	if slices.Contains(chain, baseName) {
+		return nil, fmt.Errorf("template inheritance cycle: %s", strings.Join(append(chain, baseName), " -> "))
+	}
+
+	base, err := loadRawTemplate(baseName)
+	if err != nil {
+		return nil, fmt.Errorf("base template %s: %v", baseName, err)
+	}
+	base, err = resolveTemplate(base, append(chain, baseName))
+	if err != nil {
+		return nil, err
+	}
+	return mergeTemplates(base, raw), nil
+}
+
+// mergeTemplates applies a child template's fields over its base. Config
+// settings and variables are merged key by key, directories and tags are combined, and files
+// are replaced by path; any other field the child sets replaces the base's.
+func mergeTemplates(base, child map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(child))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range child {
+		switch key {
+		case "config", "variables":
+			merged[key] = mergeObjects(base[key], value)
+		case "directories", "tags":
+			merged[key] = unionLists(base[key], value)
+		case "files":
+			merged[key] = mergeFiles(base[key], value)
+		default:
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// mergeObjects merges two JSON objects recursively, child values winning. A
+// child value that is not an object, lists included, replaces the base value.
+func mergeObjects(base, child interface{}) interface{} {
+	baseObject, ok := base.(map[string]interface{})
+	childObject, childOK := child.(map[string]interface{})
+	if !ok || !childOK {
+		return child
+	}
+	merged := make(map[string]interface{}, len(baseObject)+len(childObject))
+	for key, value := range baseObject {
+		merged[key] = value
+	}
+	for key, value := range childObject {
+		merged[key] = mergeObjects(baseObject[key], value)
+	}
+	return merged
+}
+
+// unionLists appends the child's entries missing from the base list
+func unionLists(base, child interface{}) interface{} {
+	baseList, ok := base.([]interface{})
+	childList, childOK := child.([]interface{})
+	if !ok || !childOK {
+		return child
+	}
+	merged := slices.Clone(baseList)
+	for _, entry := range childList {
+		if !slices.Contains(merged, entry) {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// mergeFiles replaces base file entries with child entries of the same path
+// and appends the others
+func mergeFiles(base, child interface{}) interface{} {
+	baseList, ok := base.([]interface{})
+	childList, childOK := child.([]interface{})
+	if !ok || !childOK {
+		return child
+	}
+	merged := slices.Clone(baseList)
+	for _, entry := range childList {
+		i := slices.IndexFunc(merged, func(existing interface{}) bool {
+			return filePath(existing) != "" && filePath(existing) == filePath(entry)
+		})
+		if i >= 0 {
+			merged[i] = entry
+		} else {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// filePath returns the cleaned path of a raw file entry
+func filePath(entry interface{}) string {
+	file, ok := entry.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	p, _ := file["path"].(string)
+	if p == "" {
+		return ""
+	}
+	if clean, err := SanitizeTemplatePath(p); err == nil {
+		return clean
+	}
+	return p
+}
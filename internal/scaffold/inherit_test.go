@@ -0,0 +1,130 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const photoBase = `{"name": "photoVault", "description": "Photos", "version": "1.0.0", "tags": ["photos", "media"],
+	"config": {"chunking_strategy": "cdc", "chunk_size": "4MB", "hash_algorithm": "sha256", "compression": "zstd",
+		"compression_level": 3, "enable_dedup": true, "dedup_strategy": "content", "dedup_min_size": "1KB", "dedup_max_size": "64MB",
+		"chunk_policies": [{"pattern": "*.raw", "chunk_size": "8MB"}]},
+	"directories": ["photos", "exports"],
+	"files": [{"path": "README.md", "content": "base"}, {"path": "exports/.keep", "content": ""}]}`
+
+// writeTemplates stores templates in the user templates directory under a temporary HOME
+func writeTemplates(t *testing.T, templates map[string]string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if err := EnsureConfigDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	templatesDir, err := GetTemplatesDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range templates {
+		if err := os.WriteFile(filepath.Join(templatesDir, name+".json"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadTemplateExtends(t *testing.T) {
+	writeTemplates(t, map[string]string{
+		"photoVault": photoBase,
+		"photoVault-4k": `{"name": "photoVault-4k", "extends": "photoVault", "version": "1.1.0", "tags": ["4k"],
+			"config": {"chunk_size": "16MB", "enable_dedup": false, "chunk_policies": []},
+			"directories": ["photos", "4k"],
+			"files": [{"path": "./README.md", "content": "child"}]}`,
+		"photoVault-4k-archive": `{"name": "photoVault-4k-archive", "extends": "photoVault-4k", "config": {"compression_level": 19}}`,
+	})
+
+	template, err := LoadTemplate("photoVault-4k-archive")
+	if err != nil {
+		t.Fatalf("LoadTemplate() error: %v", err)
+	}
+	cfg := template.Config
+	if template.Name != "photoVault-4k-archive" || template.Description != "Photos" || template.Version != "1.1.0" {
+		t.Errorf("name, description, version = %q, %q, %q", template.Name, template.Description, template.Version)
+	}
+	if cfg.ChunkSize != "16MB" || cfg.CompressionLevel != 19 || cfg.Compression != "zstd" || cfg.HashAlgorithm != "sha256" {
+		t.Errorf("config not merged field by field: %+v", cfg)
+	}
+	if cfg.EnableDedup || len(cfg.ChunkPolicies) != 0 {
+		t.Errorf("child could not turn off dedup or clear chunk policies: %+v", cfg)
+	}
+	if want := []string{"photos", "media", "4k"}; !reflect.DeepEqual(template.Tags, want) {
+		t.Errorf("Tags = %v, want %v", template.Tags, want)
+	}
+	if want := []string{"photos", "exports", "4k"}; !reflect.DeepEqual(template.Directories, want) {
+		t.Errorf("Directories = %v, want %v", template.Directories, want)
+	}
+	if len(template.Files) != 2 || template.Files[0].Content != "child" || template.Files[1].Path != "exports/.keep" {
+		t.Errorf("Files = %+v, want README.md replaced and exports/.keep kept", template.Files)
+	}
+}
+
+func TestLoadTemplateExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]string
+		load      string
+		wantErr   string
+	}{
+		{
+			name:      "missing base",
+			templates: map[string]string{"child": `{"name": "child", "extends": "nowhere"}`},
+			load:      "child",
+			wantErr:   "base template nowhere",
+		},
+		{
+			name:      "self",
+			templates: map[string]string{"loop": `{"name": "loop", "extends": "loop"}`},
+			load:      "loop",
+			wantErr:   "cycle: loop -> loop",
+		},
+		{
+			name: "cycle",
+			templates: map[string]string{
+				"a": `{"name": "a", "extends": "b"}`,
+				"b": `{"name": "b", "extends": "c"}`,
+				"c": `{"name": "c", "extends": "a"}`,
+			},
+			load:    "a",
+			wantErr: "cycle: a -> b -> c -> a",
+		},
+		{
+			name:      "not a name",
+			templates: map[string]string{"child": `{"name": "child", "extends": ["a"]}`},
+			load:      "child",
+			wantErr:   "extends must be a template name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTemplates(t, tt.templates)
+			if _, err := LoadTemplate(tt.load); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadTemplate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLintTemplateDataExtends(t *testing.T) {
+	writeTemplates(t, map[string]string{"photoVault": photoBase})
+
+	// Required settings come from the base
+	issues, err := LintTemplateData([]byte(`{"name": "photoVault-4k", "extends": "photoVault", "config": {"chunk_size": "16MB"}}`))
+	if err != nil || len(issues) != 0 {
+		t.Errorf("LintTemplateData() = %v, %v; want no issues", issues, err)
+	}
+
+	issues, err = LintTemplateData([]byte(`{"name": "orphan", "extends": "missing"}`))
+	if err != nil || len(issues) != 1 || issues[0].Field != "extends" {
+		t.Errorf("LintTemplateData() = %v, %v; want one extends issue", issues, err)
+	}
+}
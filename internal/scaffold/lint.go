@@ -0,0 +1,269 @@
+package scaffold
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/validate"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// TemplateIssue is a single problem found while linting a template. Its Field
+// is the JSON path of the offending field, e.g. "config.chunk_size"; unknown
+// fields are only warnings unless validation is strict.
+type TemplateIssue = validate.Issue
+
+var (
+	supportedChunkingStrategies = []string{"fixed", "cdc"}
+	supportedHashAlgorithms     = []string{constants.HashAlgorithmSHA256, constants.HashAlgorithmSHA512, constants.HashAlgorithmSHA1, constants.HashAlgorithmBLAKE3}
+	supportedCompression        = compression.Algorithms
+	supportedSyncModes          = []string{"manual", "auto"}
+	supportedDedupStrategies    = constants.DedupStrategies
+)
+
+// sizeFormat describes the sizes chunk_size and the dedup bounds accept
+const sizeFormat = "expected a number with an optional unit, e.g. 4MB or 512KB"
+
+// LintTemplateFile checks a template file and reports every problem found.
+// The returned error is only set when the file cannot be read or parsed at all.
+func LintTemplateFile(templatePath string) ([]TemplateIssue, error) {
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template file: %v", err)
+	}
+
+	ext := strings.ToLower(path.Ext(templatePath))
+	if ext == ".yaml" || ext == ".yml" {
+		if data, err = normalizeTemplateData(data, templatePath); err != nil {
+			return nil, err
+		}
+	}
+
+	return LintTemplateData(data)
+}
+
+// LintTemplateData checks raw template JSON, including fields the Template struct
+// does not know about. Templates it extends are read from the user templates directory.
+func LintTemplateData(data []byte) ([]TemplateIssue, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse template file: %v", err)
+	}
+
+	issues := validate.Check(raw, reflect.TypeOf(Template{}), "json")
+	typeErrors := false
+	for _, issue := range issues {
+		typeErrors = typeErrors || !issue.Unknown
+	}
+
+	// A template extending another is checked with the base's settings merged in
+	if _, ok := raw["extends"]; ok {
+		resolved, err := resolveTemplate(raw, nil)
+		if err != nil {
+			return append(issues, TemplateIssue{Field: "extends", Message: err.Error()}), nil
+		}
+		if data, err = json.Marshal(resolved); err != nil {
+			return nil, fmt.Errorf("failed to merge template: %v", err)
+		}
+	}
+
+	var template Template
+	if err := json.Unmarshal(data, &template); err != nil {
+		// Type mismatches (e.g. a number where a string is expected) are reported, not fatal
+		if !typeErrors {
+			issues = append(issues, TemplateIssue{Message: fmt.Sprintf("invalid field type: %v", err)})
+		}
+		return issues, nil
+	}
+
+	return append(issues, LintTemplate(&template)...), nil
+}
+
+// LintTemplate validates the values of a parsed template
+func LintTemplate(template *Template) []TemplateIssue {
+	var issues []TemplateIssue
+	add := func(field, format string, args ...interface{}) {
+		issues = append(issues, TemplateIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	// choice reports a value outside allowed, with the allowed value it is closest to
+	choice := func(field, what, value string, allowed []string) {
+		if issue := validate.Choice(field, what, value, allowed); issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+
+	if strings.TrimSpace(template.Name) == "" {
+		add("name", "is required")
+	}
+	if strings.TrimSpace(template.Description) == "" {
+		add("description", "is required")
+	}
+	if strings.TrimSpace(template.Version) == "" {
+		add("version", "is required")
+	}
+
+	cfg := template.Config
+	// Chunk sizes must lie strictly between the dedup bounds, once both are valid
+	var minSize, maxSize int64
+	checkBounds := func(field, value string, size int64) {
+		if minSize > 0 && maxSize > minSize && size > 0 && (size <= minSize || size >= maxSize) {
+			add(field, "%s must lie between dedup_min_size %s and dedup_max_size %s", value, cfg.DedupMinSize, cfg.DedupMaxSize)
+		}
+	}
+	if cfg.EnableDedup {
+		minSize, _ = util.ParseChunkSize(cfg.DedupMinSize)
+		maxSize, _ = util.ParseChunkSize(cfg.DedupMaxSize)
+	}
+	if cfg.ChunkingStrategy != "" {
+		choice("config.chunking_strategy", "strategy", cfg.ChunkingStrategy, supportedChunkingStrategies)
+	}
+	if cfg.ChunkSize == "" {
+		add("config.chunk_size", "is required")
+	} else if size, err := util.ParseChunkSize(cfg.ChunkSize); err != nil {
+		add("config.chunk_size", "invalid size %q (%s)", cfg.ChunkSize, sizeFormat)
+	} else if size == 0 {
+		add("config.chunk_size", "must be greater than zero")
+	} else {
+		checkBounds("config.chunk_size", cfg.ChunkSize, size)
+	}
+	if cfg.HashAlgorithm != "" {
+		choice("config.hash_algorithm", "algorithm", cfg.HashAlgorithm, supportedHashAlgorithms)
+	}
+	if !contains(supportedCompression, cfg.Compression) {
+		choice("config.compression", "compression", cfg.Compression, supportedCompression)
+	} else if err := compression.ValidateLevel(cfg.Compression, cfg.CompressionLevel); err != nil {
+		add("config.compression_level", "%v", err)
+	}
+	if cfg.SyncMode != "" {
+		choice("config.sync_mode", "sync mode", cfg.SyncMode, supportedSyncModes)
+	}
+
+	if cfg.EnableDedup {
+		choice("config.dedup_strategy", "strategy", cfg.DedupStrategy, supportedDedupStrategies)
+		if _, err := util.ParseChunkSize(cfg.DedupMinSize); err != nil {
+			add("config.dedup_min_size", "invalid size %q (%s)", cfg.DedupMinSize, sizeFormat)
+		} else if minSize == 0 {
+			add("config.dedup_min_size", "must be greater than zero")
+		}
+		if _, err := util.ParseChunkSize(cfg.DedupMaxSize); err != nil {
+			add("config.dedup_max_size", "invalid size %q (%s)", cfg.DedupMaxSize, sizeFormat)
+		} else if maxSize == 0 {
+			add("config.dedup_max_size", "must be greater than zero")
+		}
+		if minSize > 0 && maxSize > 0 && minSize >= maxSize {
+			add("config.dedup_min_size", "%s must be smaller than dedup_max_size %s", cfg.DedupMinSize, cfg.DedupMaxSize)
+		}
+	}
+	if cfg.DedupGCThreshold < 0 {
+		add("config.dedup_gc_threshold", "must not be negative")
+	}
+
+	for i, policy := range cfg.ChunkPolicies {
+		field := fmt.Sprintf("config.chunk_policies[%d]", i)
+		if policy.Pattern == "" {
+			add(field+".pattern", "is required")
+		} else if _, err := path.Match(policy.Pattern, ""); err != nil {
+			add(field+".pattern", "invalid pattern %q: %v", policy.Pattern, err)
+		}
+		if policy.Strategy != "" {
+			choice(field+".strategy", "strategy", policy.Strategy, supportedChunkingStrategies)
+		}
+		if policy.ChunkSize != "" {
+			if size, err := util.ParseChunkSize(policy.ChunkSize); err != nil {
+				add(field+".chunk_size", "invalid size %q (%s)", policy.ChunkSize, sizeFormat)
+			} else if size == 0 {
+				add(field+".chunk_size", "must be greater than zero")
+			} else {
+				checkBounds(field+".chunk_size", policy.ChunkSize, size)
+			}
+		}
+	}
+
+	for i, policy := range cfg.CompressionPolicies {
+		field := fmt.Sprintf("config.compression_policies[%d]", i)
+		if policy.Pattern == "" {
+			add(field+".pattern", "is required")
+		} else if _, err := path.Match(policy.Pattern, ""); err != nil {
+			add(field+".pattern", "invalid pattern %q: %v", policy.Pattern, err)
+		}
+		if !contains(supportedCompression, policy.Compression) {
+			choice(field+".compression", "compression", policy.Compression, supportedCompression)
+		} else if err := compression.ValidateLevel(policy.Compression, policy.Level); err != nil {
+			add(field+".level", "%v", err)
+		}
+	}
+
+	for i, dir := range template.Directories {
+		if _, err := SanitizeTemplatePath(dir); err != nil {
+			add(fmt.Sprintf("directories[%d]", i), "%v", err)
+		}
+	}
+
+	for i, file := range template.Files {
+		field := fmt.Sprintf("files[%d]", i)
+		if strings.TrimSpace(file.Path) == "" {
+			add(field+".path", "is required")
+		} else if _, err := SanitizeTemplatePath(file.Path); err != nil {
+			add(field+".path", "%v", err)
+		}
+		if _, err := parseContent(file.Path, file.Content); err != nil {
+			add(field+".content", "invalid template: %v", err)
+		}
+		if file.Mode != "" {
+			if mode, err := ParseFileMode(file.Mode); err != nil {
+				add(field+".mode", "%v", err)
+			} else if HasSpecialBits(mode) {
+				add(field+".mode", "mode %s sets setuid, setgid or sticky bits; scaffold requires --allow-special-modes", file.Mode)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(template.Variables))
+	for name := range template.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := validateVariableName(name); err != nil {
+			add("variables."+name, "%v", err)
+		} else if contains(builtinVariables, name) {
+			add("variables."+name, "%s is set by scaffold and cannot have a default", name)
+		}
+	}
+
+	return issues
+}
+
+// ParseFileMode parses an octal permission string such as "0644"
+func ParseFileMode(mode string) (os.FileMode, error) {
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q: must be octal, e.g. \"0644\"", mode)
+	}
+	if value > 0o7777 {
+		return 0, fmt.Errorf("invalid file mode %q: exceeds 07777", mode)
+	}
+	return os.FileMode(value), nil
+}
+
+// HasSpecialBits reports whether a parsed template mode sets setuid, setgid or sticky bits
+func HasSpecialBits(mode os.FileMode) bool {
+	return mode&0o7000 != 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
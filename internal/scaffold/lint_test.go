@@ -0,0 +1,208 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validLintTemplate = `{
+  "name": "Photo Vault",
+  "description": "Photos",
+  "version": "1.0.0",
+  "config": {"chunking_strategy": "fixed", "chunk_size": "4MB", "hash_algorithm": "sha256", "compression": "gzip", "sync_mode": "manual"},
+  "directories": ["raw"],
+  "files": [{"path": "README.md", "content": "hi", "mode": "0644"}]
+}`
+
+func issueFields(issues []TemplateIssue) []string {
+	fields := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		fields = append(fields, issue.Field)
+	}
+	return fields
+}
+
+func TestLintTemplateData(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantFields []string
+	}{
+		{
+			name: "valid template",
+			data: validLintTemplate,
+		},
+		{
+			name: "unknown fields",
+			data: `{"name": "x", "description": "x", "version": "1", "colour": "red",
+				"config": {"chunk_size": "4MB", "compression": "none", "cipher": "des"},
+				"files": [{"path": "a", "content": "", "owner": "root"}]}`,
+			wantFields: []string{"colour", "config.cipher", "files[0].owner"},
+		},
+		{
+			name:       "invalid chunk size",
+			data:       `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "lots", "compression": "none"}}`,
+			wantFields: []string{"config.chunk_size"},
+		},
+		{
+			name:       "unsupported compression and hash",
+			data:       `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "snappy", "hash_algorithm": "md5"}}`,
+			wantFields: []string{"config.hash_algorithm", "config.compression"},
+		},
+		{
+			name:       "bad file mode",
+			data:       `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "none"}, "files": [{"path": "a", "content": "", "mode": "rwx"}]}`,
+			wantFields: []string{"files[0].mode"},
+		},
+		{
+			name: "bad chunk policies",
+			data: `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "none",
+				"chunk_policies": [{"pattern": "*.jpg", "chunk_size": "8MB"}, {"pattern": "[", "strategy": "rolling", "chunk_size": "big"}]}}`,
+			wantFields: []string{"config.chunk_policies[1].pattern", "config.chunk_policies[1].strategy", "config.chunk_policies[1].chunk_size"},
+		},
+		{
+			name: "bad compression policies",
+			data: `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "none",
+				"compression_policies": [{"pattern": "*.csv", "compression": "zstd", "level": 9}, {"pattern": "*.jpg", "compression": "jpeg"}, {"pattern": "", "compression": "gzip", "level": 12}]}}`,
+			wantFields: []string{"config.compression_policies[1].compression", "config.compression_policies[2].pattern", "config.compression_policies[2].level"},
+		},
+		{
+			name: "path traversal",
+			data: `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "none"},
+				"directories": ["ok", "/abs"], "files": [{"path": "../x", "content": ""}]}`,
+			wantFields: []string{"directories[1]", "files[0].path"},
+		},
+		{
+			name:       "setuid file mode",
+			data:       `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "none"}, "files": [{"path": "a", "content": "", "mode": "4755"}]}`,
+			wantFields: []string{"files[0].mode"},
+		},
+		{
+			name: "template variables",
+			data: `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "none"},
+				"variables": {"project": "", "VaultName": "x", "my-team": "y"},
+				"files": [{"path": "a", "content": "{{.project}} {{.team}}"}, {"path": "b", "content": "{{.project"}]}`,
+			wantFields: []string{"files[1].content", "variables.VaultName", "variables.my-team"},
+		},
+		{
+			name: "chunk sizes outside the dedup bounds",
+			data: `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "16MB", "compression": "none",
+				"enable_dedup": true, "dedup_strategy": "content", "dedup_min_size": "1MB", "dedup_max_size": "8MB",
+				"chunk_policies": [{"pattern": "*.db", "chunk_size": "1MB"}, {"pattern": "*.jpg", "chunk_size": "2MB"}]}}`,
+			wantFields: []string{"config.chunk_size", "config.chunk_policies[0].chunk_size"},
+		},
+		{
+			name:       "dedup bounds out of order",
+			data:       `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": "4MB", "compression": "none", "enable_dedup": true, "dedup_strategy": "content", "dedup_min_size": "8MB", "dedup_max_size": "8MB"}}`,
+			wantFields: []string{"config.dedup_min_size"},
+		},
+		{
+			name:       "values of the wrong type",
+			data:       `{"name": "x", "description": "x", "version": "1", "config": {"chunk_size": 4, "compression": "none", "compression_level": "high"}}`,
+			wantFields: []string{"config.chunk_size", "config.compression_level"},
+		},
+		{
+			name:       "every problem is reported",
+			data:       `{"extra": 1, "config": {"chunk_size": "0", "compression": "snappy"}, "files": [{"content": "", "mode": "999"}]}`,
+			wantFields: []string{"extra", "name", "description", "version", "config.chunk_size", "config.compression", "files[0].path", "files[0].mode"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := LintTemplateData([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("LintTemplateData() unexpected error: %v", err)
+			}
+			got := issueFields(issues)
+			if strings.Join(got, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("issue fields = %v, want %v (issues: %v)", got, tt.wantFields, issues)
+			}
+		})
+	}
+}
+
+func TestLintTemplateDataInvalidJSON(t *testing.T) {
+	if _, err := LintTemplateData([]byte("{not json")); err == nil {
+		t.Error("expected error for unparseable template")
+	}
+}
+
+func TestLintTemplateFileYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "team.yaml")
+	yamlTemplate := "name: Team\ndescription: From YAML\nversion: 1.0.0\nconfig:\n  chunk_size: 4MB\n  compression: xz\n"
+	if err := os.WriteFile(path, []byte(yamlTemplate), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := LintTemplateFile(path)
+	if err != nil {
+		t.Fatalf("LintTemplateFile() error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Field != "config.compression" {
+		t.Errorf("expected a single compression issue, got %v", issues)
+	}
+}
+
+func TestBuiltinTemplatesLint(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "template", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Skip("built-in templates not found")
+	}
+	for _, path := range paths {
+		if _, err := LintTemplateFile(path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{"0644", 0o644, false},
+		{"755", 0o755, false},
+		{"rwx", 0, true},
+		{"0899", 0, true},
+		{"17777", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := ParseFileMode(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFileMode(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFileMode(%q) = %o, want %o", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintTemplateDataSuggestions(t *testing.T) {
+	issues, err := LintTemplateData([]byte(`{"name": "x", "description": "x", "version": "1",
+		"config": {"chunk_size": "4MB", "chunkSize": "4mb", "compresion": "zstd", "compression": "zstdd"}}`))
+	if err != nil {
+		t.Fatalf("LintTemplateData() unexpected error: %v", err)
+	}
+	want := []string{
+		`config.chunkSize: unknown field (did you mean "chunk_size"?)`,
+		`config.compresion: unknown field (did you mean "compression"?)`,
+		`config.compression: unsupported compression "zstdd" (supported: none, gzip, zstd, lz4, brotli) (did you mean "zstd"?)`,
+	}
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("issues =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !issues[0].Unknown || !issues[1].Unknown || issues[2].Unknown {
+		t.Errorf("only the unknown fields should be warnings: %+v", issues)
+	}
+}
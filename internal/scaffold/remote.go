@@ -0,0 +1,286 @@
+package scaffold
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxRemoteTemplateSize caps how much data is read from a remote template source
+	maxRemoteTemplateSize = 1 << 20 // 1MB
+
+	// remoteTemplateTimeout bounds how long fetching a remote template may take
+	remoteTemplateTimeout = 30 * time.Second
+)
+
+// httpClient is used to fetch HTTPS templates (replaced in tests)
+var httpClient = &http.Client{Timeout: remoteTemplateTimeout}
+
+var (
+	checksumPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	commitPattern   = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// RemoteTemplateRef describes a template hosted outside the local templates directory.
+//
+// Supported forms:
+//
+//	https://example.com/templates/photo.json#sha256=<hex>   (pinned by content checksum)
+//	git+https://github.com/org/repo.git//templates/photo.json@<commit>   (pinned by commit)
+type RemoteTemplateRef struct {
+	URL      string // HTTPS URL of the template file, or the git repository URL
+	GitPath  string // Path of the template inside the git repository (git refs only)
+	Commit   string // Full commit hash (git refs only)
+	Checksum string // Expected sha256 of the template file (HTTPS refs only)
+}
+
+// IsGit reports whether the template is fetched from a git repository
+func (r *RemoteTemplateRef) IsGit() bool {
+	return r.GitPath != ""
+}
+
+// IsRemoteTemplate reports whether a --template value refers to a remote source
+func IsRemoteTemplate(ref string) bool {
+	return strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "git+")
+}
+
+// ParseRemoteTemplateRef parses and validates a remote template reference.
+// References must be pinned so that the fetched template cannot change underneath the user.
+func ParseRemoteTemplateRef(ref string) (*RemoteTemplateRef, error) {
+	if strings.HasPrefix(ref, "git+") {
+		return parseGitTemplateRef(strings.TrimPrefix(ref, "git+"))
+	}
+
+	if !strings.HasPrefix(ref, "https://") {
+		return nil, fmt.Errorf("remote templates must be fetched over https: %s", ref)
+	}
+
+	url, fragment, _ := strings.Cut(ref, "#")
+	checksum, found := strings.CutPrefix(fragment, "sha256=")
+	if !found || checksum == "" {
+		return nil, fmt.Errorf("remote template must be pinned with a checksum, e.g. %s#sha256=<hex>", url)
+	}
+	checksum = strings.ToLower(checksum)
+	if !checksumPattern.MatchString(checksum) {
+		return nil, fmt.Errorf("invalid sha256 checksum: %s", checksum)
+	}
+
+	return &RemoteTemplateRef{URL: url, Checksum: checksum}, nil
+}
+
+// parseGitTemplateRef parses "<repo-url>//<path>@<commit>"
+func parseGitTemplateRef(ref string) (*RemoteTemplateRef, error) {
+	at := strings.LastIndex(ref, "@")
+	if at < 0 {
+		return nil, fmt.Errorf("git template must be pinned to a commit, e.g. git+<repo>//<path>@<commit>")
+	}
+	location, commit := ref[:at], strings.ToLower(ref[at+1:])
+	if !commitPattern.MatchString(commit) {
+		return nil, fmt.Errorf("git template must be pinned to a full 40 character commit hash, got %q", commit)
+	}
+
+	schemeEnd := strings.Index(location, "://")
+	if schemeEnd < 0 {
+		return nil, fmt.Errorf("invalid git repository URL: %s", location)
+	}
+	if !strings.HasPrefix(location, "https://") {
+		return nil, fmt.Errorf("git templates must be fetched over https: %s", location)
+	}
+	sep := strings.Index(location[schemeEnd+3:], "//")
+	if sep < 0 {
+		return nil, fmt.Errorf("git template reference must include a file path, e.g. git+<repo>//<path>@<commit>")
+	}
+	repoURL := location[:schemeEnd+3+sep]
+	filePath := strings.TrimPrefix(location[schemeEnd+3+sep:], "//")
+	if filePath == "" || strings.Contains(filePath, "..") {
+		return nil, fmt.Errorf("invalid template path in git reference: %q", filePath)
+	}
+
+	return &RemoteTemplateRef{URL: repoURL, GitPath: filePath, Commit: commit}, nil
+}
+
+// CacheName returns the name the template is cached under in the templates directory.
+// The name includes the pin so different versions of the same template never collide.
+func (r *RemoteTemplateRef) CacheName() string {
+	source := r.URL
+	pin := r.Checksum
+	if r.IsGit() {
+		source = r.GitPath
+		pin = r.Commit
+	}
+
+	base := strings.TrimSuffix(path.Base(source), path.Ext(source))
+	base = strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			return c
+		}
+		return '-'
+	}, base)
+	if base == "" {
+		base = "remote"
+	}
+
+	return fmt.Sprintf("%s-%s", base, pin[:12])
+}
+
+// FetchRemoteTemplate downloads a pinned remote template, verifies it, caches it in the
+// templates directory and returns the cached template name for use with ValidateTemplate.
+// Previously cached templates are reused without touching the network.
+func FetchRemoteTemplate(ref string) (string, error) {
+	remote, err := ParseRemoteTemplateRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	templatesDir, err := GetTemplatesDirectory()
+	if err != nil {
+		return "", err
+	}
+	name := remote.CacheName()
+	cachedPath := filepath.Join(templatesDir, name+".json")
+
+	if _, err := os.Stat(cachedPath); err == nil {
+		fmt.Printf("Using cached remote template: %s\n", name)
+		return name, nil
+	}
+
+	var data []byte
+	if remote.IsGit() {
+		fmt.Printf("Fetching template %s from %s at %s...\n", remote.GitPath, remote.URL, remote.Commit[:12])
+		data, err = fetchGitTemplate(remote)
+	} else {
+		fmt.Printf("Fetching template from %s...\n", remote.URL)
+		data, err = fetchHTTPSTemplate(remote.URL)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !remote.IsGit() {
+		sum := sha256.Sum256(data)
+		actual := hex.EncodeToString(sum[:])
+		if actual != remote.Checksum {
+			return "", fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", remote.URL, remote.Checksum, actual)
+		}
+	}
+
+	source := remote.URL
+	if remote.IsGit() {
+		source = remote.GitPath
+	}
+	templateJSON, err := normalizeTemplateData(data, source)
+	if err != nil {
+		return "", err
+	}
+
+	if err := EnsureConfigDirectories(); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(cachedPath, templateJSON, 0644); err != nil {
+		return "", fmt.Errorf("failed to cache remote template: %v", err)
+	}
+
+	// Make sure what we cached is a usable template before handing it back.
+	// Special mode bits are checked again by scaffold against --allow-special-modes.
+	if _, err := ValidateTemplate(name, true); err != nil {
+		_ = os.Remove(cachedPath)
+		return "", err
+	}
+
+	fmt.Printf("Cached remote template as: %s\n", name)
+	return name, nil
+}
+
+// fetchHTTPSTemplate downloads a template file over HTTPS
+func fetchHTTPSTemplate(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch template: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch template: %s returned %s", url, resp.Status)
+	}
+
+	return readLimited(resp.Body)
+}
+
+// fetchGitTemplate reads a single file from a git repository at a specific commit
+func fetchGitTemplate(remote *RemoteTemplateRef) ([]byte, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is required to fetch templates from a repository")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "sietch-template-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// #nosec G204 - arguments are validated by ParseRemoteTemplateRef
+	clone := exec.Command("git", "clone", "--quiet", "--no-checkout", "--filter=blob:none", remote.URL, tmpDir)
+	if output, err := clone.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %v\n%s", remote.URL, err, output)
+	}
+
+	// #nosec G204 - arguments are validated by ParseRemoteTemplateRef
+	show := exec.Command("git", "-C", tmpDir, "show", remote.Commit+":"+remote.GitPath)
+	var stdout, stderr bytes.Buffer
+	show.Stdout = &stdout
+	show.Stderr = &stderr
+	if err := show.Run(); err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s: %v\n%s", remote.GitPath, remote.Commit, err, stderr.String())
+	}
+
+	return readLimited(&stdout)
+}
+
+// readLimited reads a template body, refusing anything larger than maxRemoteTemplateSize
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxRemoteTemplateSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %v", err)
+	}
+	if len(data) > maxRemoteTemplateSize {
+		return nil, fmt.Errorf("template exceeds maximum size of %d bytes", maxRemoteTemplateSize)
+	}
+	return data, nil
+}
+
+// normalizeTemplateData converts a fetched template (JSON or YAML) into the JSON form
+// stored in the templates directory
+func normalizeTemplateData(data []byte, source string) ([]byte, error) {
+	ext := strings.ToLower(path.Ext(source))
+	if ext == ".yaml" || ext == ".yml" {
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML template: %v", err)
+		}
+		converted, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert YAML template: %v", err)
+		}
+		return converted, nil
+	}
+
+	var template Template
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, fmt.Errorf("failed to parse template file: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,138 @@
+package scaffold
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const remoteTemplateJSON = `{
+  "name": "Team Vault",
+  "description": "Shared team template",
+  "version": "1.0.0",
+  "author": "Ops",
+  "tags": ["team"],
+  "config": {"chunking_strategy": "fixed", "chunk_size": "4MB", "hash_algorithm": "sha256", "compression": "none", "sync_mode": "manual"}
+}`
+
+func TestParseRemoteTemplateRef(t *testing.T) {
+	checksum := strings.Repeat("a", 64)
+	commit := strings.Repeat("b", 40)
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    RemoteTemplateRef
+		wantErr bool
+	}{
+		{
+			name: "https with checksum",
+			ref:  "https://example.com/t/team.json#sha256=" + checksum,
+			want: RemoteTemplateRef{URL: "https://example.com/t/team.json", Checksum: checksum},
+		},
+		{
+			name: "git with commit",
+			ref:  "git+https://github.com/org/templates.git//vaults/team.json@" + commit,
+			want: RemoteTemplateRef{URL: "https://github.com/org/templates.git", GitPath: "vaults/team.json", Commit: commit},
+		},
+		{name: "https without checksum", ref: "https://example.com/team.json", wantErr: true},
+		{name: "plain http", ref: "http://example.com/team.json#sha256=" + checksum, wantErr: true},
+		{name: "short checksum", ref: "https://example.com/team.json#sha256=abc", wantErr: true},
+		{name: "git without commit", ref: "git+https://github.com/org/templates.git//team.json", wantErr: true},
+		{name: "git with branch name", ref: "git+https://github.com/org/templates.git//team.json@main", wantErr: true},
+		{name: "git without path", ref: "git+https://github.com/org/templates.git@" + commit, wantErr: true},
+		{name: "git path traversal", ref: "git+https://github.com/org/templates.git//../x.json@" + commit, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRemoteTemplateRef(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseRemoteTemplateRef() expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRemoteTemplateRef() unexpected error: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseRemoteTemplateRef() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchRemoteTemplate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(remoteTemplateJSON))
+	}))
+	defer server.Close()
+
+	originalClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = originalClient }()
+
+	sum := sha256.Sum256([]byte(remoteTemplateJSON))
+	checksum := hex.EncodeToString(sum[:])
+
+	t.Run("checksum mismatch is rejected", func(t *testing.T) {
+		ref := server.URL + "/team.json#sha256=" + strings.Repeat("0", 64)
+		if _, err := FetchRemoteTemplate(ref); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Fatalf("expected checksum mismatch error, got %v", err)
+		}
+	})
+
+	t.Run("pinned template is fetched and cached", func(t *testing.T) {
+		ref := server.URL + "/team.json#sha256=" + checksum
+		name, err := FetchRemoteTemplate(ref)
+		if err != nil {
+			t.Fatalf("FetchRemoteTemplate() error: %v", err)
+		}
+		if name != "team-"+checksum[:12] {
+			t.Errorf("cache name = %q", name)
+		}
+
+		template, err := ValidateTemplate(name, false)
+		if err != nil {
+			t.Fatalf("ValidateTemplate() on cached template: %v", err)
+		}
+		if template.Name != "Team Vault" {
+			t.Errorf("template name = %q, want Team Vault", template.Name)
+		}
+
+		templatesDir, _ := GetTemplatesDirectory()
+		if _, err := os.Stat(filepath.Join(templatesDir, name+".json")); err != nil {
+			t.Errorf("expected cached template file: %v", err)
+		}
+
+		// A second fetch must be served from the cache
+		before := requests
+		if _, err := FetchRemoteTemplate(ref); err != nil {
+			t.Fatalf("cached FetchRemoteTemplate() error: %v", err)
+		}
+		if requests != before {
+			t.Errorf("expected cached template to be reused without a network request")
+		}
+	})
+}
+
+func TestNormalizeTemplateDataYAML(t *testing.T) {
+	yamlTemplate := "name: Team Vault\ndescription: From YAML\nversion: 1.0.0\nconfig:\n  chunk_size: 4MB\n  enable_dedup: true\n"
+	data, err := normalizeTemplateData([]byte(yamlTemplate), "team.yaml")
+	if err != nil {
+		t.Fatalf("normalizeTemplateData() error: %v", err)
+	}
+	if !strings.Contains(string(data), `"chunk_size": "4MB"`) {
+		t.Errorf("expected YAML to be converted to JSON, got %s", data)
+	}
+}
@@ -0,0 +1,115 @@
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Built-in variables available to template files
+const (
+	VarVaultName = "VaultName"
+	VarAuthor    = "Author"
+	VarDate      = "Date"
+)
+
+var (
+	builtinVariables = []string{VarVaultName, VarAuthor, VarDate}
+	variableName     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ParseSetFlags parses --set key=value arguments into variables
+func ParseSetFlags(values []string) (map[string]string, error) {
+	vars := make(map[string]string, len(values))
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --set %q: expected key=value", value)
+		}
+		if err := validateVariableName(key); err != nil {
+			return nil, fmt.Errorf("invalid --set %q: %v", value, err)
+		}
+		if slices.Contains(builtinVariables, key) {
+			return nil, fmt.Errorf("invalid --set %q: %s is set by scaffold (use --name or --author)", value, key)
+		}
+		vars[key] = val
+	}
+	return vars, nil
+}
+
+// validateVariableName checks that name can be referenced as {{.name}}
+func validateVariableName(name string) error {
+	if !variableName.MatchString(name) {
+		return fmt.Errorf("variable name %q must start with a letter or underscore and contain only letters, digits and underscores", name)
+	}
+	return nil
+}
+
+// TemplateVariables returns the values template files are rendered with: the
+// template's defaults, overridden by the built-in variables and then by set
+func TemplateVariables(t *Template, vaultName, author string, date time.Time, set map[string]string) map[string]string {
+	vars := make(map[string]string, len(t.Variables)+len(builtinVariables)+len(set))
+	for key, value := range t.Variables {
+		vars[key] = value
+	}
+	vars[VarVaultName] = vaultName
+	vars[VarAuthor] = author
+	vars[VarDate] = date.Format("2006-01-02")
+	for key, value := range set {
+		vars[key] = value
+	}
+	return vars
+}
+
+// RenderFiles renders the content of the template's files with text/template,
+// replacing it in place. A file referencing a variable without a value fails.
+func RenderFiles(t *Template, vars map[string]string) error {
+	for i, file := range t.Files {
+		content, err := renderContent(file.Path, file.Content, vars)
+		if err != nil {
+			return err
+		}
+		t.Files[i].Content = content
+	}
+	return nil
+}
+
+func renderContent(name, content string, vars map[string]string) (string, error) {
+	tmpl, err := parseContent(name, content)
+	if err != nil {
+		return "", fmt.Errorf("file %s: invalid template: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		if missing := missingVariables(content, vars); len(missing) > 0 {
+			return "", fmt.Errorf("file %s: undefined variable %s (pass --set %s=<value> or give it a default in the template's variables)",
+				name, strings.Join(missing, ", "), missing[0])
+		}
+		return "", fmt.Errorf("file %s: %v", name, err)
+	}
+	return buf.String(), nil
+}
+
+func parseContent(name, content string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(content)
+}
+
+// referencedVariable matches {{.name}} references, trimming markers included
+var referencedVariable = regexp.MustCompile(`\{\{-?\s*\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// missingVariables lists the variables content references that have no value
+func missingVariables(content string, vars map[string]string) []string {
+	var missing []string
+	for _, match := range referencedVariable.FindAllStringSubmatch(content, -1) {
+		if _, ok := vars[match[1]]; !ok && !slices.Contains(missing, match[1]) {
+			missing = append(missing, match[1])
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
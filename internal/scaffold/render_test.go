@@ -0,0 +1,95 @@
+package scaffold
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderFiles(t *testing.T) {
+	date := time.Date(2025, 3, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		content  string
+		defaults map[string]string
+		set      map[string]string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:    "built-ins",
+			content: "# {{.VaultName}}\nby {{.Author}} on {{.Date}}\n",
+			want:    "# Team Docs\nby Jane Doe on 2025-03-09\n",
+		},
+		{
+			name:    "verbatim",
+			content: "no variables here\n",
+			want:    "no variables here\n",
+		},
+		{
+			name:     "default",
+			content:  "project {{.project}}",
+			defaults: map[string]string{"project": "unnamed"},
+			want:     "project unnamed",
+		},
+		{
+			name:     "set overrides default",
+			content:  "project {{.project}}",
+			defaults: map[string]string{"project": "unnamed"},
+			set:      map[string]string{"project": "apollo"},
+			want:     "project apollo",
+		},
+		{
+			name:    "undefined",
+			content: "{{.team}} works on {{- .project}}",
+			wantErr: "undefined variable project, team (pass --set project=<value>",
+		},
+		{
+			name:    "undefined in a condition",
+			content: "{{if .draft}}draft{{end}}",
+			wantErr: `no entry for key "draft"`,
+		},
+		{
+			name:    "invalid",
+			content: "{{.VaultName",
+			wantErr: "file README.md: invalid template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &Template{
+				Files:     []TemplateFile{{Path: "README.md", Content: tt.content}},
+				Variables: tt.defaults,
+			}
+			err := RenderFiles(template, TemplateVariables(template, "Team Docs", "Jane Doe", date, tt.set))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RenderFiles() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderFiles() error: %v", err)
+			}
+			if got := template.Files[0].Content; got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSetFlags(t *testing.T) {
+	vars, err := ParseSetFlags([]string{"project=apollo", "motto=a=b, c", "empty="})
+	if err != nil {
+		t.Fatalf("ParseSetFlags() error: %v", err)
+	}
+	if vars["project"] != "apollo" || vars["motto"] != "a=b, c" || vars["empty"] != "" || len(vars) != 3 {
+		t.Errorf("ParseSetFlags() = %v", vars)
+	}
+
+	for _, bad := range []string{"project", "=x", "my-project=x", "1st=x", "VaultName=x"} {
+		if _, err := ParseSetFlags([]string{bad}); err == nil {
+			t.Errorf("ParseSetFlags(%q) accepted an invalid variable", bad)
+		}
+	}
+}
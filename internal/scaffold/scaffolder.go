@@ -1,9 +1,118 @@
 package scaffold
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
 )
 
+// TemplateSummary describes an installable template in machine-readable listings
+type TemplateSummary struct {
+	Name        string                 `json:"name" yaml:"name"`
+	Extends     string                 `json:"extends,omitempty" yaml:"extends,omitempty"`
+	Version     string                 `json:"version,omitempty" yaml:"version,omitempty"`
+	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Author      string                 `json:"author,omitempty" yaml:"author,omitempty"`
+	Tags        []string               `json:"tags" yaml:"tags"`
+	Config      *TemplateConfigSummary `json:"config,omitempty" yaml:"config,omitempty"`
+	Error       string                 `json:"error,omitempty" yaml:"error,omitempty"` // Why the template could not be loaded
+}
+
+// TemplateConfigSummary holds the settings that set templates apart
+type TemplateConfigSummary struct {
+	ChunkingStrategy string `json:"chunking_strategy" yaml:"chunking_strategy"`
+	ChunkSize        string `json:"chunk_size" yaml:"chunk_size"`
+	HashAlgorithm    string `json:"hash_algorithm" yaml:"hash_algorithm"`
+	Compression      string `json:"compression" yaml:"compression"`
+	CompressionLevel int    `json:"compression_level,omitempty" yaml:"compression_level,omitempty"`
+	Dedup            bool   `json:"dedup" yaml:"dedup"`
+	DedupStrategy    string `json:"dedup_strategy,omitempty" yaml:"dedup_strategy,omitempty"`
+	SyncMode         string `json:"sync_mode" yaml:"sync_mode"`
+	Passphrase       bool   `json:"passphrase" yaml:"passphrase"`
+}
+
+// Summarize returns the template's listing entry
+func (t *Template) Summarize(name string) TemplateSummary {
+	cfg := &t.Config
+	summary := TemplateSummary{
+		Name:        name,
+		Extends:     t.Extends,
+		Version:     t.Version,
+		Description: t.Description,
+		Author:      t.Author,
+		Tags:        t.Tags,
+		Config: &TemplateConfigSummary{
+			ChunkingStrategy: cfg.ChunkingStrategy,
+			ChunkSize:        cfg.ChunkSize,
+			HashAlgorithm:    cfg.HashAlgorithm,
+			Compression:      cfg.Compression,
+			CompressionLevel: cfg.CompressionLevel,
+			Dedup:            cfg.EnableDedup,
+			SyncMode:         cfg.SyncMode,
+			Passphrase:       cfg.Passphrase,
+		},
+	}
+	if cfg.EnableDedup {
+		summary.Config.DedupStrategy = cfg.DedupStrategy
+	}
+	if summary.Tags == nil {
+		summary.Tags = []string{}
+	}
+	return summary
+}
+
+// TemplateSummaries returns an entry for every template in the user templates
+// directory, installing the defaults first if there are none. A template that
+// fails to load is listed by name with the error.
+func TemplateSummaries() ([]TemplateSummary, error) {
+	if err := EnsureConfigDirectories(); err != nil {
+		return nil, fmt.Errorf("failed to ensure config directories: %v", err)
+	}
+	if err := EnsureDefaultTemplates(); err != nil {
+		return nil, fmt.Errorf("failed to ensure default templates: %v", err)
+	}
+	templates, err := ListAvailableTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %v", err)
+	}
+
+	summaries := make([]TemplateSummary, 0, len(templates))
+	for _, templateName := range templates {
+		template, err := LoadTemplate(templateName)
+		if err != nil {
+			summaries = append(summaries, TemplateSummary{Name: templateName, Tags: []string{}, Error: err.Error()})
+			continue
+		}
+		summaries = append(summaries, template.Summarize(templateName))
+	}
+	return summaries, nil
+}
+
+// WriteTemplateList writes the available templates to w as "json" or "yaml"
+func WriteTemplateList(w io.Writer, format string) error {
+	summaries, err := TemplateSummaries()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summaries)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(summaries); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return fmt.Errorf("invalid output format %q (expected text, json or yaml)", format)
+}
+
+// ListTemplates prints the available templates for people to read
 func ListTemplates() error {
 	// Ensure config directories exist
 	if err := EnsureConfigDirectories(); err != nil {
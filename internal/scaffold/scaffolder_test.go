@@ -0,0 +1,62 @@
+package scaffold
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWriteTemplateList(t *testing.T) {
+	writeUserTemplate(t, "team", `{"name": "Team", "version": "1.2.0", "description": "Shared docs", "tags": ["docs"],
+		"config": {"chunking_strategy": "cdc", "chunk_size": "4MB", "hash_algorithm": "sha256", "compression": "zstd",
+		"compression_level": 9, "sync_mode": "manual", "enable_dedup": true, "dedup_strategy": "content", "passphrase": true}}`)
+	templatesDir, err := GetTemplatesDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templatesDir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TemplateSummary{
+		{Name: "broken", Tags: []string{}},
+		{Name: "team", Version: "1.2.0", Description: "Shared docs", Tags: []string{"docs"}, Config: &TemplateConfigSummary{
+			ChunkingStrategy: "cdc", ChunkSize: "4MB", HashAlgorithm: "sha256", Compression: "zstd", CompressionLevel: 9,
+			Dedup: true, DedupStrategy: "content", SyncMode: "manual", Passphrase: true,
+		}},
+	}
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := WriteTemplateList(&out, format); err != nil {
+				t.Fatalf("WriteTemplateList() error: %v", err)
+			}
+			var got []TemplateSummary
+			if format == "json" {
+				err = json.Unmarshal(out.Bytes(), &got)
+			} else {
+				err = yaml.Unmarshal(out.Bytes(), &got)
+			}
+			if err != nil {
+				t.Fatalf("output does not parse: %v\n%s", err, out.String())
+			}
+			if len(got) != len(want) {
+				t.Fatalf("listed %d templates, want %d:\n%s", len(got), len(want), out.String())
+			}
+			if got[0].Name != "broken" || got[0].Error == "" || got[0].Config != nil {
+				t.Errorf("broken template listed as %+v, want its name and an error", got[0])
+			}
+			if got[1].Name != want[1].Name || got[1].Version != want[1].Version || got[1].Config == nil || *got[1].Config != *want[1].Config {
+				t.Errorf("team template listed as %+v (config %+v), want %+v", got[1], got[1].Config, *want[1].Config)
+			}
+		})
+	}
+
+	if err := WriteTemplateList(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("WriteTemplateList() accepted an unknown format")
+	}
+}
@@ -4,19 +4,37 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/validate"
 )
 
 // Template represents a vault template structure
 type Template struct {
 	Name        string         `json:"name"`
+	Extends     string         `json:"extends,omitempty"` // Base template whose settings this one overrides
 	Description string         `json:"description"`
 	Version     string         `json:"version"`
 	Author      string         `json:"author"`
 	Tags        []string       `json:"tags"`
 	Config      TemplateConfig `json:"config"`
+	Directories []string       `json:"directories,omitempty"`
+	Files       []TemplateFile `json:"files,omitempty"`
+	// Variables holds defaults for variables that file contents reference
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// TemplateFile represents a file created in the vault from a template. Its
+// content is a text/template rendered with the vault name, author, date and
+// template variables.
+type TemplateFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Mode    string `json:"mode,omitempty"` // Octal permissions, e.g. "0644"
 }
 
 // TemplateConfig represents default vault configuration in template
@@ -25,6 +43,7 @@ type TemplateConfig struct {
 	ChunkSize         string `json:"chunk_size"`
 	HashAlgorithm     string `json:"hash_algorithm"`
 	Compression       string `json:"compression"`
+	CompressionLevel  int    `json:"compression_level,omitempty"` // 0 = the algorithm's default
 	SyncMode          string `json:"sync_mode"`
 	EnableDedup       bool   `json:"enable_dedup"`
 	DedupStrategy     string `json:"dedup_strategy"`
@@ -32,6 +51,30 @@ type TemplateConfig struct {
 	DedupMaxSize      string `json:"dedup_max_size"`
 	DedupGCThreshold  int    `json:"dedup_gc_threshold"`
 	DedupIndexEnabled bool   `json:"dedup_index_enabled"`
+	DedupCrossFile    bool   `json:"dedup_cross_file"`
+
+	// Protect the vault key with a passphrase, as with 'sietch scaffold --passphrase'
+	Passphrase bool `json:"passphrase,omitempty"`
+
+	// Per-pattern chunking overrides; the first matching pattern wins
+	ChunkPolicies []TemplateChunkPolicy `json:"chunk_policies,omitempty"`
+
+	// Per-pattern compression overrides; the first matching pattern wins
+	CompressionPolicies []TemplateCompressionPolicy `json:"compression_policies,omitempty"`
+}
+
+// TemplateChunkPolicy overrides chunking for files matching a glob pattern
+type TemplateChunkPolicy struct {
+	Pattern   string `json:"pattern"`
+	Strategy  string `json:"strategy,omitempty"`
+	ChunkSize string `json:"chunk_size,omitempty"`
+}
+
+// TemplateCompressionPolicy overrides compression for files matching a glob pattern
+type TemplateCompressionPolicy struct {
+	Pattern     string `json:"pattern"`
+	Compression string `json:"compression"`
+	Level       int    `json:"level,omitempty"` // 0 = the algorithm's default
 }
 
 // GetTemplatesDirectory returns the path to templates directory
@@ -101,43 +144,224 @@ func GetBuiltInTemplates() []string {
 	return templates
 }
 
-// LoadTemplate loads a template from user config directory
-// This function assumes EnsureDefaultTemplates() has been called first
+// LoadTemplate loads a template from user config directory, merged with the
+// templates it extends. This function assumes EnsureDefaultTemplates() has been
+// called first.
 func LoadTemplate(templateName string) (*Template, error) {
-	// Load template from user config directory
-	templatesDir, err := GetTemplatesDirectory()
+	raw, err := loadRawTemplate(templateName)
 	if err != nil {
 		return nil, err
 	}
-
-	templatePath := filepath.Join(templatesDir, templateName+".json")
-	if _, err := os.Stat(templatePath); err != nil {
-		return nil, fmt.Errorf("template '%s' not found in user config directory (%s)", templateName, templatesDir)
+	resolved, err := resolveTemplate(raw, []string{templateName})
+	if err != nil {
+		return nil, err
 	}
-
-	// Read and parse template file
-	data, err := os.ReadFile(templatePath)
+	data, err := json.Marshal(resolved)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read template file: %v", err)
+		return nil, fmt.Errorf("failed to merge template: %v", err)
 	}
 
 	var template Template
 	if err := json.Unmarshal(data, &template); err != nil {
+		// Name the offending fields rather than the Go types they decode into
+		if errs, _ := validate.Split(validate.Check(resolved, reflect.TypeOf(Template{}), "json")); len(errs) > 0 {
+			return nil, &validate.Error{Source: "template " + templateName, Issues: errs}
+		}
 		return nil, fmt.Errorf("failed to parse template file: %v", err)
 	}
 
 	return &template, nil
 }
 
-// ValidateTemplate validates template name and returns the loaded template
-func ValidateTemplate(templateName string) (*Template, error) {
+// checkUnknownFields warns about the fields of a template file that no
+// template has, or refuses them when validation is strict. Templates it
+// extends are checked when they are loaded themselves.
+func checkUnknownFields(templateName string) error {
+	raw, err := loadRawTemplate(templateName)
+	if err != nil {
+		return err
+	}
+	var unknown []TemplateIssue
+	for _, issue := range validate.Check(raw, reflect.TypeOf(Template{}), "json") {
+		if issue.Unknown {
+			unknown = append(unknown, issue)
+		}
+	}
+	errs, warnings := validate.Split(unknown)
+	if len(errs) > 0 {
+		return &validate.Error{Source: "template " + templateName, Issues: errs}
+	}
+	for _, issue := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: template %s: %s\n", templateName, issue)
+	}
+	return nil
+}
+
+// ValidateTemplate validates template name and returns the loaded template.
+// File modes are checked here so a bad mode is caught before anything is written;
+// setuid, setgid and sticky bits are rejected unless allowSpecialModes is set.
+func ValidateTemplate(templateName string, allowSpecialModes bool) (*Template, error) {
 	template, err := LoadTemplate(templateName)
 	if err != nil {
 		return nil, fmt.Errorf("template validation failed: %v", err)
 	}
+	if err := checkUnknownFields(templateName); err != nil {
+		return nil, fmt.Errorf("template validation failed: %v", err)
+	}
+	if err := ValidateTemplatePaths(template); err != nil {
+		return nil, fmt.Errorf("template validation failed: %v", err)
+	}
+	if err := ValidateFileModes(template, allowSpecialModes); err != nil {
+		return nil, fmt.Errorf("template validation failed: %v", err)
+	}
 	return template, nil
 }
 
+// ValidateTemplatePaths checks that every directory and file entry stays inside the vault
+func ValidateTemplatePaths(template *Template) error {
+	for _, dir := range template.Directories {
+		if _, err := SanitizeTemplatePath(dir); err != nil {
+			return fmt.Errorf("directory %q: %v", dir, err)
+		}
+	}
+	for _, file := range template.Files {
+		if _, err := SanitizeTemplatePath(file.Path); err != nil {
+			return fmt.Errorf("file %q: %v", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// SanitizeTemplatePath returns a cleaned, vault-relative path for a template entry.
+// Templates may come from remote sources, so absolute paths, paths that escape the
+// vault root and paths into Sietch's own files (.sietch, vault.yaml) are rejected.
+func SanitizeTemplatePath(entry string) (string, error) {
+	if strings.TrimSpace(entry) == "" {
+		return "", fmt.Errorf("path must not be empty")
+	}
+	// Treat both separators alike so a template behaves the same on every platform
+	slashed := strings.ReplaceAll(entry, "\\", "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(entry) || filepath.VolumeName(entry) != "" {
+		return "", fmt.Errorf("absolute paths are not allowed")
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path must not contain '..'")
+		}
+	}
+
+	cleaned := path.Clean(slashed)
+	if cleaned == "." {
+		return "", fmt.Errorf("path must name an entry inside the vault")
+	}
+	first := strings.SplitN(cleaned, "/", 2)[0]
+	if strings.EqualFold(first, ".sietch") || strings.EqualFold(cleaned, "vault.yaml") {
+		return "", fmt.Errorf("%s is reserved for vault metadata", first)
+	}
+	return filepath.FromSlash(cleaned), nil
+}
+
+// ensureWithinVault resolves symlinks in dir and checks that it is still inside the vault
+func ensureWithinVault(vaultPath, dir string) error {
+	root, err := filepath.EvalSymlinks(vaultPath)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s resolves outside the vault", dir)
+	}
+	return nil
+}
+
+// ValidateFileModes checks every file mode in the template
+func ValidateFileModes(template *Template, allowSpecialModes bool) error {
+	for _, file := range template.Files {
+		if file.Mode == "" {
+			continue
+		}
+		mode, err := ParseFileMode(file.Mode)
+		if err != nil {
+			return fmt.Errorf("file %s: %v", file.Path, err)
+		}
+		if !allowSpecialModes && HasSpecialBits(mode) {
+			return fmt.Errorf("file %s: mode %s sets setuid, setgid or sticky bits (use --allow-special-modes to permit)", file.Path, file.Mode)
+		}
+	}
+	return nil
+}
+
+// osFileMode converts raw octal special bits into their os.FileMode flags
+func osFileMode(mode os.FileMode) os.FileMode {
+	converted := mode.Perm()
+	if mode&0o4000 != 0 {
+		converted |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		converted |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		converted |= os.ModeSticky
+	}
+	return converted
+}
+
+// ApplyTemplateLayout creates the template's directories and files inside the vault
+func ApplyTemplateLayout(vaultPath string, template *Template) error {
+	for _, dir := range template.Directories {
+		rel, err := SanitizeTemplatePath(dir)
+		if err != nil {
+			return fmt.Errorf("directory %q: %v", dir, err)
+		}
+		target := filepath.Join(vaultPath, rel)
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", dir, err)
+		}
+		if err := ensureWithinVault(vaultPath, target); err != nil {
+			return fmt.Errorf("directory %q: %v", dir, err)
+		}
+	}
+
+	for _, file := range template.Files {
+		mode := os.FileMode(0644)
+		if file.Mode != "" {
+			parsed, err := ParseFileMode(file.Mode)
+			if err != nil {
+				return fmt.Errorf("file %s: %v", file.Path, err)
+			}
+			mode = osFileMode(parsed)
+		}
+
+		rel, err := SanitizeTemplatePath(file.Path)
+		if err != nil {
+			return fmt.Errorf("file %q: %v", file.Path, err)
+		}
+		target := filepath.Join(vaultPath, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", file.Path, err)
+		}
+		if err := ensureWithinVault(vaultPath, filepath.Dir(target)); err != nil {
+			return fmt.Errorf("file %q: %v", file.Path, err)
+		}
+		// Never follow an existing symlink at the target itself
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("file %q: refusing to overwrite a symlink", file.Path)
+		}
+		if err := os.WriteFile(target, []byte(file.Content), mode); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file.Path, err)
+		}
+		// WriteFile is subject to the umask, so set the requested mode explicitly
+		if err := os.Chmod(target, mode); err != nil {
+			return fmt.Errorf("failed to set mode on %s: %v", file.Path, err)
+		}
+	}
+	return nil
+}
+
 // CopyDefaultTemplates copies built-in templates to user config directory
 func CopyDefaultTemplates() error {
 	templatesDir, err := GetTemplatesDirectory()
@@ -0,0 +1,145 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeUserTemplate stores a template in the user templates directory under a temporary HOME
+func writeUserTemplate(t *testing.T, name, data string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if err := EnsureConfigDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	templatesDir, err := GetTemplatesDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templatesDir, name+".json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateTemplateFileModes(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		allowSpecial bool
+		wantErr      bool
+	}{
+		{name: "default mode", mode: ""},
+		{name: "executable", mode: "0755"},
+		{name: "unparseable", mode: "rwxr-xr-x", wantErr: true},
+		{name: "out of range", mode: "0999", wantErr: true},
+		{name: "setuid rejected", mode: "4755", wantErr: true},
+		{name: "sticky rejected", mode: "1777", wantErr: true},
+		{name: "setuid allowed", mode: "4755", allowSpecial: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeUserTemplate(t, "modes", `{"name": "Modes", "description": "x", "version": "1",
+				"config": {"chunk_size": "4MB", "compression": "none"},
+				"files": [{"path": "run.sh", "content": "#!/bin/sh\n", "mode": "`+tt.mode+`"}]}`)
+
+			_, err := ValidateTemplate("modes", tt.allowSpecial)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyTemplateLayout(t *testing.T) {
+	vaultPath := t.TempDir()
+	template := &Template{
+		Directories: []string{"photos/raw", "data"},
+		Files: []TemplateFile{
+			{Path: "README.md", Content: "# Vault\n"},
+			{Path: "scripts/run.sh", Content: "#!/bin/sh\n", Mode: "0755"},
+		},
+	}
+
+	if err := ApplyTemplateLayout(vaultPath, template); err != nil {
+		t.Fatalf("ApplyTemplateLayout() error: %v", err)
+	}
+
+	for _, dir := range template.Directories {
+		if info, err := os.Stat(filepath.Join(vaultPath, dir)); err != nil || !info.IsDir() {
+			t.Errorf("expected directory %s to exist", dir)
+		}
+	}
+
+	modes := map[string]os.FileMode{"README.md": 0644, "scripts/run.sh": 0755}
+	for path, want := range modes {
+		info, err := os.Stat(filepath.Join(vaultPath, path))
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", path, err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s mode = %o, want %o", path, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestSanitizeTemplatePath(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{entry: "photos/raw", want: filepath.FromSlash("photos/raw")},
+		{entry: "./docs//README.md", want: filepath.FromSlash("docs/README.md")},
+		{entry: "a/./b", want: filepath.FromSlash("a/b")},
+		{entry: "", wantErr: true},
+		{entry: ".", wantErr: true},
+		{entry: "/etc/cron.d/x", wantErr: true},
+		{entry: "../../etc/cron.d/x", wantErr: true},
+		{entry: "photos/../../x", wantErr: true},
+		{entry: "photos/../README.md", wantErr: true},
+		{entry: `..\..\x`, wantErr: true},
+		{entry: `\windows\x`, wantErr: true},
+		{entry: ".sietch/keys/secret.key", wantErr: true},
+		{entry: "vault.yaml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := SanitizeTemplatePath(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SanitizeTemplatePath(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SanitizeTemplatePath(%q) = %q, want %q", tt.entry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTemplateRejectsTraversal(t *testing.T) {
+	writeUserTemplate(t, "evil", `{"name": "Evil", "description": "x", "version": "1",
+		"config": {"chunk_size": "4MB", "compression": "none"},
+		"files": [{"path": "../../etc/cron.d/x", "content": "* * * * * root id"}]}`)
+
+	if _, err := ValidateTemplate("evil", false); err == nil {
+		t.Error("expected traversal to fail validation")
+	}
+}
+
+func TestApplyTemplateLayoutRejectsSymlinkEscape(t *testing.T) {
+	vaultPath := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(vaultPath, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	template := &Template{Files: []TemplateFile{{Path: "link/x", Content: "x"}}}
+	if err := ApplyTemplateLayout(vaultPath, template); err == nil {
+		t.Error("expected write through a symlink leaving the vault to fail")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "x")); err == nil {
+		t.Error("file was written outside the vault")
+	}
+}
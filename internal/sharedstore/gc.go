@@ -0,0 +1,131 @@
+package sharedstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/internal/snapshot"
+)
+
+// GCResult summarises a garbage collection pass over a shared store
+type GCResult struct {
+	Vaults         int   `json:"vaults"`          // Registered vaults whose manifests were scanned
+	ChunksScanned  int   `json:"chunks_scanned"`  // Chunks in the store
+	ChunksRemoved  int   `json:"chunks_removed"`  // Unreferenced chunks deleted (or that would be, in a dry run)
+	BytesReclaimed int64 `json:"bytes_reclaimed"` // Size of the removed chunks
+	SkippedRecent  int   `json:"skipped_recent"`  // Unreferenced chunks kept because they were written recently
+}
+
+// GarbageCollect removes chunks that no registered vault references, from its
+// manifests or its snapshots. Every registered vault must be reachable, since a
+// chunk can only be proven unused by looking at all of them. Chunks written within
+// the grace period are kept: an add in progress writes chunks before its manifest.
+func (s *Store) GarbageCollect(grace time.Duration, dryRun bool) (*GCResult, error) {
+	unlock, err := Lock(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	vaults, err := s.Vaults()
+	if err != nil {
+		return nil, err
+	}
+	if len(vaults) == 0 {
+		return nil, fmt.Errorf("no vaults are registered with the store; refusing to collect every chunk")
+	}
+
+	referenced := make(map[string]bool)
+	for _, vault := range vaults {
+		if err := s.CheckMember(vault); err != nil {
+			return nil, fmt.Errorf("%v; run 'sietch store unregister %s' if it was removed", err, vault.VaultID)
+		}
+		if err := collectVaultReferences(vault.Path, referenced); err != nil {
+			return nil, fmt.Errorf("failed to read vault %s: %v", vault.Name, err)
+		}
+	}
+
+	hashes, err := layout.ListChunkHashesIn(layout.SharedChunkDirectory(s.Path))
+	if err != nil {
+		return nil, err
+	}
+	result := &GCResult{Vaults: len(vaults), ChunksScanned: len(hashes)}
+	cutoff := time.Now().Add(-grace)
+	for _, hash := range hashes {
+		if referenced[hash] {
+			continue
+		}
+		path := s.chunkPath(hash)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(cutoff) {
+			result.SkippedRecent++
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return result, fmt.Errorf("failed to remove chunk %s: %w", hash, err)
+			}
+		}
+		result.ChunksRemoved++
+		result.BytesReclaimed += info.Size()
+	}
+	return result, nil
+}
+
+// ReferencedBy returns the storage keys of every chunk a vault references from
+// its manifests or snapshots
+func ReferencedBy(vaultRoot string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	if err := collectVaultReferences(vaultRoot, referenced); err != nil {
+		return nil, err
+	}
+	return referenced, nil
+}
+
+// collectVaultReferences adds the chunk hashes a vault references to referenced
+func collectVaultReferences(vaultRoot string, referenced map[string]bool) error {
+	err := config.WalkManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(entry *config.ManifestEntry) error {
+		for _, chunk := range entry.Manifest.Chunks {
+			if chunk.Zero {
+				continue
+			}
+			referenced[chunk.Hash] = true
+			if chunk.EncryptedHash != "" {
+				referenced[chunk.EncryptedHash] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	refs, err := snapshot.CollectReferences(vaultRoot)
+	if err != nil {
+		return err
+	}
+	for hash := range refs.Chunks {
+		referenced[hash] = true
+	}
+	return nil
+}
+
+// chunkPath locates a chunk in the store, which may hold flat chunks copied in by hand
+func (s *Store) chunkPath(hash string) string {
+	path := layout.SharedChunkPath(s.Path, hash)
+	if _, err := os.Stat(path); err != nil {
+		if flat := filepath.Join(layout.SharedChunkDirectory(s.Path), hash); flat != path {
+			if _, err := os.Stat(flat); err == nil {
+				return flat
+			}
+		}
+	}
+	return path
+}
@@ -0,0 +1,461 @@
+// Package sharedstore lets several vaults keep their chunks in one directory.
+//
+// A shared store holds the chunks of every participating vault together with a
+// common deduplication index, so a chunk present in any vault is stored once.
+// Each vault keeps its own manifests and records the store in vault.yaml under
+// shared_store.path. The store's registry.yaml lists the participating vaults;
+// garbage collection walks all of their manifests before removing a chunk.
+//
+// Layout:
+//
+//	<store>/store.yaml     settings every vault must match (encryption, compression, ...)
+//	<store>/registry.yaml  participating vaults
+//	<store>/chunks/        chunks in the sharded layout
+//	<store>/index/         common deduplication index
+//	<store>/lock           held while the registry, index or chunks are rewritten
+package sharedstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+const (
+	configFileName   = "store.yaml"
+	registryFileName = "registry.yaml"
+	indexDirName     = "index"
+	lockFileName     = "lock"
+
+	lockTimeout  = 30 * time.Second
+	lockInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrNotStore is returned when a directory does not contain a shared store
+	ErrNotStore = errors.New("not a shared chunk store")
+
+	// ErrIncompatible is returned when a vault's settings differ from the store's
+	ErrIncompatible = errors.New("vault is incompatible with the shared store")
+)
+
+// Config is the content of store.yaml. Chunks written by one vault are read by
+// the others, so every setting that changes how a chunk is stored is fixed here.
+type Config struct {
+	Version        int       `yaml:"version"`
+	CreatedAt      time.Time `yaml:"created_at"`
+	KeyScheme      string    `yaml:"key_scheme"` // shared-key or none
+	EncryptionType string    `yaml:"encryption_type"`
+	Compression    string    `yaml:"compression"`
+	HashAlgorithm  string    `yaml:"hash_algorithm"`
+	MinChunkSize   string    `yaml:"dedup_min_chunk_size"`
+	MaxChunkSize   string    `yaml:"dedup_max_chunk_size"`
+
+	// ConvergentSecretID fingerprints the convergence secret of member vaults.
+	// Convergent chunks can only be shared by vaults holding the same secret.
+	ConvergentSecretID string `yaml:"convergent_secret_id,omitempty"`
+
+	// KeyProbe is a fixed value encrypted with the shared key. A vault may only join
+	// when it can decrypt the probe, which proves it holds the same key.
+	KeyProbe string `yaml:"key_probe,omitempty"`
+}
+
+// Vault is a vault registered with the store
+type Vault struct {
+	VaultID  string    `yaml:"vault_id" json:"vault_id"`
+	Name     string    `yaml:"name" json:"name"`
+	Path     string    `yaml:"path" json:"path"`
+	JoinedAt time.Time `yaml:"joined_at" json:"joined_at"`
+}
+
+// registry is the content of registry.yaml
+type registry struct {
+	Vaults []Vault `yaml:"vaults"`
+}
+
+// Store is an opened shared chunk store
+type Store struct {
+	Path   string
+	Config Config
+}
+
+// ConfigFor returns the store settings matching a vault's configuration.
+// The caller fills in KeyProbe for encrypted vaults.
+func ConfigFor(vaultConfig *config.VaultConfig) Config {
+	scheme := constants.SharedStoreKeyShared
+	if vaultConfig.Encryption.Type == "" || vaultConfig.Encryption.Type == "none" {
+		scheme = constants.SharedStoreKeyNone
+	}
+	secretID := ""
+	if settings := vaultConfig.Encryption.Convergent; settings != nil && settings.Secret != "" {
+		secretID = settings.SecretID
+	}
+	return Config{
+		Version:        constants.SharedStoreVersion,
+		CreatedAt:      time.Now().UTC(),
+		KeyScheme:      scheme,
+		EncryptionType: vaultConfig.Encryption.Type,
+		Compression:    vaultConfig.Compression,
+		HashAlgorithm:  vaultConfig.Chunking.HashAlgorithm,
+		MinChunkSize:   vaultConfig.Deduplication.MinChunkSize,
+		MaxChunkSize:   vaultConfig.Deduplication.MaxChunkSize,
+
+		ConvergentSecretID: secretID,
+	}
+}
+
+// Create initializes a new shared store at path
+func Create(path string, cfg Config) (*Store, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve store path: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(path, configFileName)); err == nil {
+		return nil, fmt.Errorf("a shared store already exists at %s", path)
+	}
+	for _, dir := range []string{layout.SharedChunkDirectory(path), IndexDir(path)} {
+		if err := os.MkdirAll(dir, constants.StandardDirPerms); err != nil {
+			return nil, fmt.Errorf("failed to create shared store: %w", err)
+		}
+	}
+
+	store := &Store{Path: path, Config: cfg}
+	if err := writeYAML(filepath.Join(path, configFileName), &store.Config); err != nil {
+		return nil, fmt.Errorf("failed to write store configuration: %w", err)
+	}
+	if err := writeYAML(filepath.Join(path, registryFileName), &registry{Vaults: []Vault{}}); err != nil {
+		return nil, fmt.Errorf("failed to write store registry: %w", err)
+	}
+	return store, nil
+}
+
+// Open reads the shared store at path
+func Open(path string) (*Store, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve store path: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(path, configFileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotStore, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store configuration: %w", err)
+	}
+
+	store := &Store{Path: path}
+	if err := yaml.Unmarshal(data, &store.Config); err != nil {
+		return nil, fmt.Errorf("failed to parse store configuration: %w", err)
+	}
+	if store.Config.Version > constants.SharedStoreVersion {
+		return nil, fmt.Errorf("shared store version %d is newer than supported version %d",
+			store.Config.Version, constants.SharedStoreVersion)
+	}
+	return store, nil
+}
+
+// ForVault opens the vault's shared store, returning nil when it has none
+func ForVault(vaultRoot string) (*Store, error) {
+	path := layout.SharedStore(vaultRoot)
+	if path == "" {
+		return nil, nil
+	}
+	return Open(path)
+}
+
+// IndexDir returns the directory holding the store's common deduplication index
+func IndexDir(storePath string) string {
+	return filepath.Join(storePath, indexDirName)
+}
+
+// CheckCompatible reports every setting in which the vault differs from the store.
+// The key itself is checked separately through the key probe.
+func (s *Store) CheckCompatible(vaultConfig *config.VaultConfig) error {
+	want := ConfigFor(vaultConfig)
+	var problems []string
+	if !vaultConfig.Deduplication.Enabled {
+		problems = append(problems, "deduplication must be enabled")
+	}
+	if want.KeyScheme != s.Config.KeyScheme {
+		if s.Config.KeyScheme == constants.SharedStoreKeyNone {
+			problems = append(problems, "the store holds unencrypted chunks but the vault is encrypted")
+		} else {
+			problems = append(problems, "the store holds encrypted chunks but the vault is unencrypted")
+		}
+	}
+	check := func(name, vaultValue, storeValue string) {
+		if vaultValue != storeValue {
+			problems = append(problems, fmt.Sprintf("%s is %q but the store uses %q", name, vaultValue, storeValue))
+		}
+	}
+	if want.KeyScheme == s.Config.KeyScheme {
+		check("encryption type", want.EncryptionType, s.Config.EncryptionType)
+	}
+	check("compression", want.Compression, s.Config.Compression)
+	check("hash algorithm", want.HashAlgorithm, s.Config.HashAlgorithm)
+	check("dedup min_chunk_size", want.MinChunkSize, s.Config.MinChunkSize)
+	check("dedup max_chunk_size", want.MaxChunkSize, s.Config.MaxChunkSize)
+	check("convergence secret", want.ConvergentSecretID, s.Config.ConvergentSecretID)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrIncompatible, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Vaults returns the vaults registered with the store
+func (s *Store) Vaults() ([]Vault, error) {
+	reg, err := s.readRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return reg.Vaults, nil
+}
+
+// Register adds a vault to the registry, replacing an entry with the same ID
+func (s *Store) Register(vault Vault) error {
+	unlock, err := Lock(s.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	reg, err := s.readRegistry()
+	if err != nil {
+		return err
+	}
+	vaults := reg.Vaults[:0]
+	for _, v := range reg.Vaults {
+		if v.VaultID != vault.VaultID {
+			vaults = append(vaults, v)
+		}
+	}
+	reg.Vaults = append(vaults, vault)
+	return writeYAML(filepath.Join(s.Path, registryFileName), reg)
+}
+
+// Unregister removes a vault from the registry
+func (s *Store) Unregister(vaultID string) error {
+	unlock, err := Lock(s.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	reg, err := s.readRegistry()
+	if err != nil {
+		return err
+	}
+	vaults := reg.Vaults[:0]
+	found := false
+	for _, v := range reg.Vaults {
+		if v.VaultID == vaultID {
+			found = true
+			continue
+		}
+		vaults = append(vaults, v)
+	}
+	if !found {
+		return fmt.Errorf("vault %s is not registered with the store", vaultID)
+	}
+	reg.Vaults = vaults
+	return writeYAML(filepath.Join(s.Path, registryFileName), reg)
+}
+
+// CheckMember verifies that a registered vault still exists and still uses this store
+func (s *Store) CheckMember(vault Vault) error {
+	vaultConfig, err := config.LoadVaultConfig(vault.Path)
+	if err != nil {
+		return fmt.Errorf("registered vault %s (%s) cannot be read: %v", vault.Name, vault.Path, err)
+	}
+	if vaultConfig.SharedStore.Path != s.Path {
+		return fmt.Errorf("registered vault %s (%s) no longer uses this store", vault.Name, vault.Path)
+	}
+	return nil
+}
+
+func (s *Store) readRegistry() (*registry, error) {
+	data, err := os.ReadFile(filepath.Join(s.Path, registryFileName))
+	if os.IsNotExist(err) {
+		return &registry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store registry: %w", err)
+	}
+	reg := &registry{}
+	if err := yaml.Unmarshal(data, reg); err != nil {
+		return nil, fmt.Errorf("failed to parse store registry: %w", err)
+	}
+	return reg, nil
+}
+
+// ImportChunks moves the chunks stored in a vault's own chunk directory into the
+// store. Chunks the store already holds are dropped from the vault.
+func (s *Store) ImportChunks(vaultRoot string) (int, error) {
+	localDir := layout.LocalChunkDirectory(vaultRoot)
+	hashes, err := layout.ListChunkHashesIn(localDir)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, hash := range hashes {
+		src, _ := layout.LocateLocalChunk(vaultRoot, hash)
+		dst := layout.SharedChunkPath(s.Path, hash)
+		if _, err := os.Stat(dst); err == nil {
+			if err := os.Remove(src); err != nil {
+				return moved, fmt.Errorf("failed to remove chunk %s: %w", hash, err)
+			}
+			continue
+		}
+		if err := moveFile(src, dst); err != nil {
+			return moved, fmt.Errorf("failed to move chunk %s into the store: %w", hash, err)
+		}
+		moved++
+	}
+
+	layout.RemoveEmptyShards(localDir)
+	return moved, nil
+}
+
+// ExportChunks copies chunks from the store back into a vault's own chunk
+// directory, in the vault's layout. Chunks missing from the store are reported.
+func (s *Store) ExportChunks(vaultRoot string, hashes map[string]bool) (copied int, missing []string, err error) {
+	for hash := range hashes {
+		src := layout.SharedChunkPath(s.Path, hash)
+		if _, err := os.Stat(src); err != nil {
+			missing = append(missing, hash)
+			continue
+		}
+		dst := layout.LocalChunkPath(vaultRoot, hash)
+		if err := copyFile(src, dst); err != nil {
+			return copied, missing, fmt.Errorf("failed to copy chunk %s out of the store: %w", hash, err)
+		}
+		copied++
+	}
+	return copied, missing, nil
+}
+
+// Lock takes the store's lock file, waiting for another process to release it.
+// A lock left by a process that no longer runs on this host is taken over.
+func Lock(storePath string) (func(), error) {
+	path := filepath.Join(storePath, lockFileName)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, constants.StandardFilePerms)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(file, "%d %s\n", os.Getpid(), host)
+			file.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock shared store: %w", err)
+		}
+		if staleLock(path) {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("shared store is locked by another sietch process (remove %s if none is running)", path)
+		}
+		time.Sleep(lockInterval)
+	}
+}
+
+// staleLock reports whether the lock was left by a dead process on this host
+func staleLock(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return false
+	}
+	host, _ := os.Hostname()
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || fields[1] != host {
+		return false
+	}
+	return !processRunning(pid)
+}
+
+// processRunning reports whether pid is alive. Errors other than "process done"
+// (such as missing permission to signal it) count as running.
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone)
+}
+
+// writeYAML atomically replaces path with the YAML encoding of v
+func writeYAML(path string, v any) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, constants.StandardFilePerms); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// moveFile renames src to dst, copying when they are on different filesystems
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), constants.StandardDirPerms); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst through a temporary file, so dst is never partial
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), constants.StandardDirPerms); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".import-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), constants.StandardFilePerms); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
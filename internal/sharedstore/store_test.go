@@ -0,0 +1,234 @@
+package sharedstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+func testVaultConfig(name string) *config.VaultConfig {
+	vc := &config.VaultConfig{VaultID: name + "-id", Name: name, Compression: "none"}
+	vc.Encryption.Type = "aes"
+	vc.Chunking.HashAlgorithm = "sha256"
+	vc.Deduplication = config.DeduplicationConfig{Enabled: true, MinChunkSize: "1KB", MaxChunkSize: "64MB"}
+	return vc
+}
+
+// newMember creates a vault that uses the store, with one manifest referencing hashes
+func newMember(t *testing.T, store *Store, name string, hashes ...string) Vault {
+	t.Helper()
+	root := t.TempDir()
+	vc := testVaultConfig(name)
+	vc.SharedStore.Path = store.Path
+	writeFile(t, filepath.Join(root, "vault.yaml"), vc)
+
+	manifest := config.FileManifest{FilePath: name + ".txt"}
+	for _, hash := range hashes {
+		manifest.Chunks = append(manifest.Chunks, config.ChunkRef{Hash: hash})
+	}
+	writeFile(t, filepath.Join(root, ".sietch", "manifests", name+".txt.yaml"), &manifest)
+
+	vault := Vault{VaultID: vc.VaultID, Name: name, Path: root, JoinedAt: time.Now().UTC()}
+	if err := store.Register(vault); err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	return vault
+}
+
+func writeFile(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// putChunk writes a chunk into the store with the given age
+func putChunk(t *testing.T, store *Store, hash string, age time.Duration) {
+	t.Helper()
+	path := layout.SharedChunkPath(store.Path, hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(hash), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Now().Add(-age)
+	if err := os.Chtimes(path, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateAndOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+	created, err := Create(path, ConfigFor(testVaultConfig("a")))
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if created.Config.KeyScheme != constants.SharedStoreKeyShared {
+		t.Errorf("KeyScheme = %q, want %q", created.Config.KeyScheme, constants.SharedStoreKeyShared)
+	}
+
+	opened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if opened.Config.Compression != "none" || opened.Config.HashAlgorithm != "sha256" {
+		t.Errorf("Open() config = %+v", opened.Config)
+	}
+	if _, err := Create(path, ConfigFor(testVaultConfig("a"))); err == nil {
+		t.Error("Create() over an existing store succeeded")
+	}
+	if _, err := Open(t.TempDir()); !errors.Is(err, ErrNotStore) {
+		t.Errorf("Open() of an empty directory error = %v, want ErrNotStore", err)
+	}
+}
+
+func TestCheckCompatible(t *testing.T) {
+	store, err := Create(filepath.Join(t.TempDir(), "store"), ConfigFor(testVaultConfig("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(vc *config.VaultConfig)
+		wantErr string
+	}{
+		{"matching vault", func(vc *config.VaultConfig) {}, ""},
+		{"deduplication disabled", func(vc *config.VaultConfig) { vc.Deduplication.Enabled = false }, "deduplication must be enabled"},
+		{"unencrypted vault", func(vc *config.VaultConfig) { vc.Encryption.Type = "none" }, "vault is unencrypted"},
+		{"different compression", func(vc *config.VaultConfig) { vc.Compression = "gzip" }, "compression"},
+		{"different chunk sizes", func(vc *config.VaultConfig) { vc.Deduplication.MaxChunkSize = "8MB" }, "max_chunk_size"},
+		{"convergence secret", func(vc *config.VaultConfig) {
+			vc.Encryption.Convergent = &config.ConvergentConfig{Enabled: true, Secret: "wrapped", SecretID: "0123456789abcdef"}
+		}, "convergence secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vc := testVaultConfig("b")
+			tt.modify(vc)
+			err := store.CheckCompatible(vc)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckCompatible() error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrIncompatible) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckCompatible() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	store, err := Create(filepath.Join(t.TempDir(), "store"), ConfigFor(testVaultConfig("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newMember(t, store, "a")
+	newMember(t, store, "b")
+
+	// Registering again replaces the entry instead of adding a second one
+	if err := store.Register(a); err != nil {
+		t.Fatal(err)
+	}
+	vaults, err := store.Vaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vaults) != 2 {
+		t.Fatalf("Vaults() = %d entries, want 2", len(vaults))
+	}
+
+	if err := store.Unregister(a.VaultID); err != nil {
+		t.Fatalf("Unregister() error: %v", err)
+	}
+	vaults, _ = store.Vaults()
+	if len(vaults) != 1 || vaults[0].Name != "b" {
+		t.Errorf("Vaults() after unregister = %+v", vaults)
+	}
+}
+
+func TestGarbageCollect(t *testing.T) {
+	store, err := Create(filepath.Join(t.TempDir(), "store"), ConfigFor(testVaultConfig("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GarbageCollect(0, false); err == nil {
+		t.Error("GarbageCollect() with no registered vaults succeeded")
+	}
+
+	newMember(t, store, "a", "aaaa", "shared")
+	b := newMember(t, store, "b", "bbbb", "shared")
+	old := 48 * time.Hour
+	for _, hash := range []string{"aaaa", "bbbb", "shared", "orphan"} {
+		putChunk(t, store, hash, old)
+	}
+	putChunk(t, store, "fresh", 0)
+
+	result, err := store.GarbageCollect(24*time.Hour, false)
+	if err != nil {
+		t.Fatalf("GarbageCollect() error: %v", err)
+	}
+	if result.Vaults != 2 || result.ChunksScanned != 5 || result.ChunksRemoved != 1 || result.SkippedRecent != 1 {
+		t.Errorf("GarbageCollect() = %+v", result)
+	}
+	for hash, want := range map[string]bool{"aaaa": true, "bbbb": true, "shared": true, "orphan": false, "fresh": true} {
+		if _, err := os.Stat(layout.SharedChunkPath(store.Path, hash)); (err == nil) != want {
+			t.Errorf("chunk %s present = %v, want %v", hash, err == nil, want)
+		}
+	}
+
+	// A vault that can no longer be read blocks collection, since its chunks are unknown
+	if err := os.Remove(filepath.Join(b.Path, "vault.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GarbageCollect(24*time.Hour, false); err == nil || !strings.Contains(err.Error(), "store unregister") {
+		t.Errorf("GarbageCollect() with an unreachable vault error = %v", err)
+	}
+	if _, err := os.Stat(layout.SharedChunkPath(store.Path, "bbbb")); err != nil {
+		t.Errorf("chunk bbbb removed: %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := t.TempDir()
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock() error: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		second, err := Lock(path)
+		if err == nil {
+			second()
+		}
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second Lock() succeeded while the lock was held")
+	case <-time.After(3 * lockInterval):
+	}
+	unlock()
+	<-acquired
+}
@@ -0,0 +1,204 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// CurrentState names the vault's live manifests in a diff
+const CurrentState = "current"
+
+// Change statuses reported by Compare
+const (
+	StatusAdded    = "added"
+	StatusRemoved  = "removed"
+	StatusModified = "modified"
+)
+
+// FileChange describes how one file differs between two vault states
+type FileChange struct {
+	Path          string `json:"path"`
+	Status        string `json:"status"`
+	OldSize       int64  `json:"old_size"`
+	NewSize       int64  `json:"new_size"`
+	ChunksAdded   int    `json:"chunks_added"`   // Chunks only in the newer version
+	ChunksRemoved int    `json:"chunks_removed"` // Chunks only in the older version
+	ChunksShared  int    `json:"chunks_shared"`  // Chunks both versions use
+}
+
+// Diff lists the files that differ between two vault states
+type Diff struct {
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Changes   []FileChange `json:"changes"` // Sorted by path
+	Unchanged int          `json:"unchanged"`
+}
+
+// Count returns the number of changes with the given status
+func (d *Diff) Count(status string) int {
+	n := 0
+	for _, change := range d.Changes {
+		if change.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare diffs the manifests of snapshot from against snapshot to, or against the
+// live vault when to is empty or CurrentState. Files are matched by vault path.
+func Compare(vaultRoot, from, to string) (*Diff, error) {
+	if to == "" {
+		to = CurrentState
+	}
+	oldFiles, err := loadState(vaultRoot, from)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := loadState(vaultRoot, to)
+	if err != nil {
+		return nil, err
+	}
+	return compareStates(from, to, oldFiles, newFiles), nil
+}
+
+// CompareVaults diffs the live manifests of the vault at rootA against those
+// of the vault at rootB, so files only in rootB are added and files only in
+// rootA removed. Chunks are matched by their plaintext hash, which agrees
+// between vaults that chunk and hash alike. Files with encrypted paths only
+// match when both vaults share the path key, as vaults replicated by sync do.
+func CompareVaults(rootA, rootB string) (*Diff, error) {
+	filesA, err := loadState(rootA, CurrentState)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := loadState(rootB, CurrentState)
+	if err != nil {
+		return nil, err
+	}
+	return compareStates(rootA, rootB, filesA, filesB), nil
+}
+
+// compareStates diffs two sets of manifests keyed by vault path
+func compareStates(from, to string, oldFiles, newFiles map[string]*config.FileManifest) *Diff {
+	diff := &Diff{From: from, To: to, Changes: []FileChange{}}
+	for path, newFile := range newFiles {
+		oldFile, ok := oldFiles[path]
+		if !ok {
+			diff.Changes = append(diff.Changes, FileChange{
+				Path: path, Status: StatusAdded, NewSize: newFile.Size, ChunksAdded: len(newFile.Chunks),
+			})
+			continue
+		}
+		change := compareFile(oldFile, newFile)
+		if change == nil {
+			diff.Unchanged++
+			continue
+		}
+		change.Path = path
+		diff.Changes = append(diff.Changes, *change)
+	}
+	for path, oldFile := range oldFiles {
+		if _, ok := newFiles[path]; !ok {
+			diff.Changes = append(diff.Changes, FileChange{
+				Path: path, Status: StatusRemoved, OldSize: oldFile.Size, ChunksRemoved: len(oldFile.Chunks),
+			})
+		}
+	}
+
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].Path < diff.Changes[j].Path
+	})
+	return diff
+}
+
+// loadState reads the manifests of a snapshot or of the live vault, keyed by vault path
+func loadState(vaultRoot, id string) (map[string]*config.FileManifest, error) {
+	dir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if id != CurrentState {
+		if _, err := Get(vaultRoot, id); err != nil {
+			return nil, err
+		}
+		dir = ManifestDir(vaultRoot, id)
+	}
+
+	files := make(map[string]*config.FileManifest)
+	err := config.WalkManifestDir(dir, func(entry *config.ManifestEntry) error {
+		manifest := entry.Manifest
+		key := manifest.Destination + manifest.FilePath
+		if manifest.PathID != "" {
+			key = manifest.PathID // The path is encrypted; its ID is stable across snapshots
+		}
+		files[key] = &manifest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// compareFile returns the change between two versions of a file, or nil when
+// their content is the same
+func compareFile(oldFile, newFile *config.FileManifest) *FileChange {
+	oldCounts := chunkCounts(oldFile)
+	newCounts := chunkCounts(newFile)
+
+	change := &FileChange{Status: StatusModified, OldSize: oldFile.Size, NewSize: newFile.Size}
+	for hash, n := range newCounts {
+		shared := min(n, oldCounts[hash])
+		change.ChunksShared += shared
+		change.ChunksAdded += n - shared
+	}
+	for hash, n := range oldCounts {
+		change.ChunksRemoved += n - min(n, newCounts[hash])
+	}
+
+	if change.ChunksAdded > 0 || change.ChunksRemoved > 0 || oldFile.Size != newFile.Size ||
+		!sameChunkOrder(oldFile, newFile) || !samePackedContent(oldFile, newFile) ||
+		oldFile.Type != newFile.Type || oldFile.LinkTarget != newFile.LinkTarget {
+		return change
+	}
+	return nil
+}
+
+// SameContent reports whether two versions of a file hold the same content
+func SameContent(a, b *config.FileManifest) bool {
+	return compareFile(a, b) == nil
+}
+
+// chunkCounts counts how often each chunk occurs in a file
+func chunkCounts(manifest *config.FileManifest) map[string]int {
+	counts := make(map[string]int, len(manifest.Chunks))
+	for _, chunk := range manifest.Chunks {
+		counts[chunk.Hash]++
+	}
+	return counts
+}
+
+// sameChunkOrder reports whether both versions list the same chunks in the same order
+func sameChunkOrder(oldFile, newFile *config.FileManifest) bool {
+	if len(oldFile.Chunks) != len(newFile.Chunks) {
+		return false
+	}
+	for i := range oldFile.Chunks {
+		if oldFile.Chunks[i].Hash != newFile.Chunks[i].Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// samePackedContent compares files stored in packs, which have no chunks, by
+// content hash; repacking moves an entry without changing it
+func samePackedContent(oldFile, newFile *config.FileManifest) bool {
+	if oldFile.Pack == nil && newFile.Pack == nil {
+		return true
+	}
+	if oldFile.Pack != nil && newFile.Pack != nil {
+		return oldFile.Pack.Hash == newFile.Pack.Hash
+	}
+	return oldFile.ContentHash != "" && oldFile.ContentHash == newFile.ContentHash
+}
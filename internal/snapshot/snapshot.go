@@ -0,0 +1,347 @@
+// Package snapshot keeps point-in-time copies of a vault's file manifests.
+//
+// A snapshot is a directory under .sietch/snapshots/<id>/ holding a copy of every
+// file manifest plus a small snapshot.yaml describing it. Chunks are content
+// addressed, so a snapshot only costs the size of its manifests; the chunks it
+// references are kept alive by delete and gc. Only 'sietch vault recompress'
+// rewrites stored chunks, and it updates the refs in snapshots along with the
+// live manifests.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+const (
+	metadataFileName = "snapshot.yaml"
+	manifestsDirName = "manifests"
+	tempPrefix       = ".tmp-"
+	idFormat         = "20060102T150405Z"
+)
+
+// ErrNotFound is returned when no snapshot has the requested ID
+var ErrNotFound = errors.New("snapshot not found")
+
+// Snapshot describes one point-in-time copy of the vault's manifests
+type Snapshot struct {
+	ID        string    `yaml:"id" json:"id"`
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+	Message   string    `yaml:"message,omitempty" json:"message,omitempty"`
+	Files     int       `yaml:"files" json:"files"`
+	Size      int64     `yaml:"size" json:"size"` // Total size of the files it records
+}
+
+// RestoreResult summarises a restore
+type RestoreResult struct {
+	Restored int // Manifests written from the snapshot
+	Removed  int // Live manifests not present in the snapshot
+}
+
+// References holds the chunks and packs referenced by any snapshot
+type References struct {
+	Chunks map[string]bool // Plaintext and encrypted chunk hashes
+	Packs  map[string]bool
+}
+
+// Dir returns the directory holding the vault's snapshots
+func Dir(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "snapshots")
+}
+
+// ManifestDir returns the directory holding a snapshot's manifest copies
+func ManifestDir(vaultRoot, id string) string {
+	return filepath.Join(Dir(vaultRoot), id, manifestsDirName)
+}
+
+// Create copies the current file manifests into a new snapshot. The snapshot is
+// assembled in a temporary directory and renamed into place, so an interrupted
+// create never leaves a partial snapshot behind.
+func Create(vaultRoot, message string) (*Snapshot, error) {
+	if err := os.MkdirAll(Dir(vaultRoot), constants.StandardDirPerms); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	id, err := newID(vaultRoot, now)
+	if err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(Dir(vaultRoot), tempPrefix+id)
+	if err := os.MkdirAll(filepath.Join(tmp, manifestsDirName), constants.StandardDirPerms); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	snap := &Snapshot{ID: id, CreatedAt: now, Message: message}
+	err = config.WalkManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(entry *config.ManifestEntry) error {
+		data, err := os.ReadFile(entry.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s: %w", filepath.Base(entry.Path), err)
+		}
+		dest := filepath.Join(tmp, manifestsDirName, filepath.Base(entry.Path))
+		if err := os.WriteFile(dest, data, constants.StandardFilePerms); err != nil {
+			return fmt.Errorf("failed to copy manifest %s: %w", filepath.Base(entry.Path), err)
+		}
+		snap.Files++
+		snap.Size += entry.Manifest.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, metadataFileName), data, constants.StandardFilePerms); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot metadata: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(Dir(vaultRoot), id)); err != nil {
+		return nil, fmt.Errorf("failed to finalize snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// newID returns a timestamp ID, suffixed when several snapshots share a second
+func newID(vaultRoot string, now time.Time) (string, error) {
+	base := now.Format(idFormat)
+	id := base
+	for i := 2; ; i++ {
+		_, err := os.Stat(filepath.Join(Dir(vaultRoot), id))
+		if os.IsNotExist(err) {
+			return id, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to check snapshot %s: %w", id, err)
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// List returns the vault's snapshots, oldest first
+func List(vaultRoot string) ([]*Snapshot, error) {
+	dirEntries, err := os.ReadDir(Dir(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range dirEntries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), tempPrefix) {
+			continue
+		}
+		snap, err := Get(vaultRoot, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].CreatedAt.Equal(snapshots[j].CreatedAt) {
+			return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+		}
+		return snapshots[i].ID < snapshots[j].ID
+	})
+	return snapshots, nil
+}
+
+// Get loads the metadata of a single snapshot
+func Get(vaultRoot, id string) (*Snapshot, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+	data, err := os.ReadFile(filepath.Join(Dir(vaultRoot), id, metadataFileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", id, err)
+	}
+
+	snap := &Snapshot{}
+	if err := yaml.Unmarshal(data, snap); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", id, err)
+	}
+	snap.ID = id
+	return snap, nil
+}
+
+// Delete removes a snapshot. Chunks it alone referenced become unreferenced and
+// are reclaimed by later deletes and garbage collection.
+func Delete(vaultRoot, id string) error {
+	if _, err := Get(vaultRoot, id); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(Dir(vaultRoot), id)); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s: %w", id, err)
+	}
+	return nil
+}
+
+// Restore replaces the live file manifests with the snapshot's copies in a single
+// transaction. Every chunk and pack the snapshot references must still be in the
+// store; nothing is changed otherwise. Callers rebuild the deduplication index
+// afterwards, since reference counts change with the manifests.
+func Restore(vaultRoot, id string) (*RestoreResult, error) {
+	keep, err := checkRestorable(vaultRoot, id)
+	if err != nil {
+		return nil, err
+	}
+	snapDir := ManifestDir(vaultRoot, id)
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "snapshot restore", "snapshot": id})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	result := &RestoreResult{}
+	err = config.WalkManifestDir(filepath.Join(vaultRoot, ".sietch", "manifests"), func(entry *config.ManifestEntry) error {
+		name := filepath.Base(entry.Path)
+		if keep[name] {
+			return nil
+		}
+		if err := txn.StageDelete(manifestRelPath(name)); err != nil {
+			return fmt.Errorf("stage manifest delete %s: %w", name, err)
+		}
+		result.Removed++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range keep {
+		data, err := os.ReadFile(filepath.Join(snapDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot manifest %s: %w", name, err)
+		}
+		w, err := txn.StageReplace(manifestRelPath(name))
+		if err != nil {
+			return nil, fmt.Errorf("stage manifest %s: %w", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			_ = w.Close()
+			return nil, fmt.Errorf("stage manifest %s: %w", name, err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("stage manifest %s: %w", name, err)
+		}
+		result.Restored++
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("commit restore: %w", err)
+	}
+	committed = true
+	return result, nil
+}
+
+// CheckRestorable reports an error when a snapshot cannot be restored because
+// chunks or packs it references are no longer in the store
+func CheckRestorable(vaultRoot, id string) error {
+	_, err := checkRestorable(vaultRoot, id)
+	return err
+}
+
+// checkRestorable returns the names of the snapshot's manifests once every chunk
+// they reference has been found
+func checkRestorable(vaultRoot, id string) (map[string]bool, error) {
+	if _, err := Get(vaultRoot, id); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	missing := 0
+	err := config.WalkManifestDir(ManifestDir(vaultRoot, id), func(entry *config.ManifestEntry) error {
+		names[filepath.Base(entry.Path)] = true
+		missing += countMissingData(vaultRoot, &entry.Manifest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if missing > 0 {
+		return nil, fmt.Errorf("snapshot %s references %d chunks that are no longer in the vault", id, missing)
+	}
+	return names, nil
+}
+
+// CollectReferences gathers the chunks and packs referenced by every snapshot, so
+// deletes and garbage collection can keep them
+func CollectReferences(vaultRoot string) (*References, error) {
+	refs := &References{Chunks: make(map[string]bool), Packs: make(map[string]bool)}
+	snapshots, err := List(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snapshots {
+		err := config.WalkManifestDir(ManifestDir(vaultRoot, snap.ID), func(entry *config.ManifestEntry) error {
+			if entry.Manifest.Pack != nil {
+				refs.Packs[entry.Manifest.Pack.ID] = true
+			}
+			for _, chunk := range entry.Manifest.Chunks {
+				refs.Chunks[chunk.Hash] = true
+				if chunk.EncryptedHash != "" {
+					refs.Chunks[chunk.EncryptedHash] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// countMissingData counts the chunks or pack a manifest needs that are not on disk
+func countMissingData(vaultRoot string, manifest *config.FileManifest) int {
+	if manifest.Pack != nil {
+		if _, err := os.Stat(layout.PackPath(vaultRoot, manifest.Pack.ID)); err != nil {
+			return 1
+		}
+		return 0
+	}
+	missing := 0
+	for _, chunk := range manifest.Chunks {
+		if chunk.Zero {
+			continue
+		}
+		key := chunk.Hash
+		if chunk.EncryptedHash != "" {
+			key = chunk.EncryptedHash
+		}
+		if _, exists := layout.LocateChunk(vaultRoot, key); !exists {
+			missing++
+		}
+	}
+	return missing
+}
+
+func manifestRelPath(name string) string {
+	return filepath.ToSlash(filepath.Join(".sietch", "manifests", name))
+}
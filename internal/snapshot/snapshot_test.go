@@ -0,0 +1,240 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+func writeManifest(t *testing.T, vaultRoot string, manifest config.FileManifest) {
+	t.Helper()
+	for _, ref := range manifest.Chunks {
+		if !fs.ChunkExists(vaultRoot, ref.Hash) {
+			if err := fs.StoreChunk(vaultRoot, ref.Hash, []byte(ref.Hash)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(&manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(manifestsDir, manifest.FilePath+".yaml"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func liveFiles(t *testing.T, vaultRoot string) map[string]bool {
+	t.Helper()
+	manager, _ := config.NewManager(vaultRoot)
+	manifest, err := manager.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]bool)
+	for _, file := range manifest.Files {
+		files[file.FilePath] = true
+	}
+	return files
+}
+
+func TestCreateAndList(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "a.txt", Size: 10, Chunks: []config.ChunkRef{{Hash: "aaaa"}}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "b.txt", Size: 20, Chunks: []config.ChunkRef{{Hash: "bbbb"}}})
+
+	first, err := Create(vaultRoot, "first")
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if first.Files != 2 || first.Size != 30 || first.Message != "first" {
+		t.Errorf("Create() = %+v", first)
+	}
+	second, err := Create(vaultRoot, "")
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if second.ID == first.ID {
+		t.Errorf("snapshots share ID %s", first.ID)
+	}
+
+	snapshots, err := List(vaultRoot)
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].ID != first.ID || snapshots[1].ID != second.ID {
+		t.Fatalf("List() = %+v", snapshots)
+	}
+
+	if err := Delete(vaultRoot, first.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := Get(vaultRoot, first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := Get(vaultRoot, "../manifests"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() with a path error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "a.txt", Size: 10, Chunks: []config.ChunkRef{{Hash: "aaaa"}}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "b.txt", Size: 20, Chunks: []config.ChunkRef{{Hash: "bbbb"}}})
+	snap, err := Create(vaultRoot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete one file, change another and add a third
+	if err := os.Remove(filepath.Join(vaultRoot, ".sietch", "manifests", "a.txt.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "b.txt", Size: 25, Chunks: []config.ChunkRef{{Hash: "bbb2"}}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "c.txt", Size: 30, Chunks: []config.ChunkRef{{Hash: "cccc"}}})
+
+	result, err := Restore(vaultRoot, snap.ID)
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if result.Restored != 2 || result.Removed != 1 {
+		t.Errorf("Restore() = %+v, want 2 restored and 1 removed", result)
+	}
+
+	files := liveFiles(t, vaultRoot)
+	if !files["a.txt"] || !files["b.txt"] || files["c.txt"] {
+		t.Errorf("files after restore = %v", files)
+	}
+	manager, _ := config.NewManager(vaultRoot)
+	manifest, _ := manager.GetManifest()
+	for _, file := range manifest.Files {
+		if file.FilePath == "b.txt" && file.Size != 20 {
+			t.Errorf("b.txt size = %d, want the snapshot's 20", file.Size)
+		}
+	}
+}
+
+func TestRestoreRequiresChunks(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "a.txt", Size: 10, Chunks: []config.ChunkRef{{Hash: "aaaa"}}})
+	snap, err := Create(vaultRoot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "b.txt", Size: 20, Chunks: []config.ChunkRef{{Hash: "bbbb"}}})
+	if err := os.Remove(filepath.Join(fs.GetChunkDirectory(vaultRoot), "aaaa")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(vaultRoot, snap.ID); err == nil {
+		t.Fatal("expected restore to fail when chunks are missing")
+	}
+	if files := liveFiles(t, vaultRoot); !files["b.txt"] {
+		t.Errorf("failed restore changed the vault: %v", files)
+	}
+}
+
+func TestCollectReferences(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "a.txt", Chunks: []config.ChunkRef{{Hash: "aaaa", EncryptedHash: "enc-aaaa"}},
+	})
+	writeManifest(t, vaultRoot, config.FileManifest{
+		FilePath: "small.txt", Pack: &config.PackRef{ID: "pack1"},
+	})
+	if _, err := Create(vaultRoot, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := CollectReferences(vaultRoot)
+	if err != nil {
+		t.Fatalf("CollectReferences() error: %v", err)
+	}
+	if !refs.Chunks["aaaa"] || !refs.Chunks["enc-aaaa"] || !refs.Packs["pack1"] {
+		t.Errorf("CollectReferences() = %+v", refs)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	vaultRoot := t.TempDir()
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "same.txt", Size: 10, Chunks: []config.ChunkRef{{Hash: "aaaa"}}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "edited.txt", Size: 20, Chunks: []config.ChunkRef{{Hash: "bbbb"}, {Hash: "cccc"}}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "gone.txt", Size: 5, Chunks: []config.ChunkRef{{Hash: "dddd"}}})
+	before, err := Create(vaultRoot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "edited.txt", Size: 30, Chunks: []config.ChunkRef{{Hash: "bbbb"}, {Hash: "eeee"}, {Hash: "ffff"}}})
+	writeManifest(t, vaultRoot, config.FileManifest{FilePath: "new.txt", Size: 7, Chunks: []config.ChunkRef{{Hash: "1111"}}})
+	if err := os.Remove(filepath.Join(vaultRoot, ".sietch", "manifests", "gone.txt.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := Compare(vaultRoot, before.ID, "")
+	if err != nil {
+		t.Fatalf("Compare() error: %v", err)
+	}
+	want := []FileChange{
+		{Path: "edited.txt", Status: StatusModified, OldSize: 20, NewSize: 30, ChunksAdded: 2, ChunksRemoved: 1, ChunksShared: 1},
+		{Path: "gone.txt", Status: StatusRemoved, OldSize: 5, ChunksRemoved: 1},
+		{Path: "new.txt", Status: StatusAdded, NewSize: 7, ChunksAdded: 1},
+	}
+	if len(diff.Changes) != len(want) {
+		t.Fatalf("Compare() changes = %+v, want %+v", diff.Changes, want)
+	}
+	for i := range want {
+		if diff.Changes[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, diff.Changes[i], want[i])
+		}
+	}
+	if diff.Unchanged != 1 || diff.To != CurrentState {
+		t.Errorf("Compare() unchanged = %d, to = %q", diff.Unchanged, diff.To)
+	}
+
+	// Comparing a snapshot with itself reports nothing
+	if same, err := Compare(vaultRoot, before.ID, before.ID); err != nil || len(same.Changes) != 0 {
+		t.Errorf("Compare() of a snapshot with itself = %+v, %v", same, err)
+	}
+	if _, err := Compare(vaultRoot, "missing", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Compare() with unknown snapshot error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCompareVaults(t *testing.T) {
+	primary, backup := t.TempDir(), t.TempDir()
+	for _, vaultRoot := range []string{primary, backup} {
+		writeManifest(t, vaultRoot, config.FileManifest{FilePath: "same.txt", Size: 10, Chunks: []config.ChunkRef{{Hash: "aaaa"}}})
+	}
+	writeManifest(t, primary, config.FileManifest{FilePath: "edited.txt", Size: 20, Chunks: []config.ChunkRef{{Hash: "bbbb"}, {Hash: "cccc"}}})
+	writeManifest(t, backup, config.FileManifest{FilePath: "edited.txt", Size: 20, Chunks: []config.ChunkRef{{Hash: "bbbb"}, {Hash: "dddd"}}})
+	writeManifest(t, primary, config.FileManifest{FilePath: "unsynced.txt", Size: 5, Chunks: []config.ChunkRef{{Hash: "eeee"}}})
+
+	diff, err := CompareVaults(primary, backup)
+	if err != nil {
+		t.Fatalf("CompareVaults() error: %v", err)
+	}
+	want := []FileChange{
+		{Path: "edited.txt", Status: StatusModified, OldSize: 20, NewSize: 20, ChunksAdded: 1, ChunksRemoved: 1, ChunksShared: 1},
+		{Path: "unsynced.txt", Status: StatusRemoved, OldSize: 5, ChunksRemoved: 1},
+	}
+	if len(diff.Changes) != len(want) || diff.Changes[0] != want[0] || diff.Changes[1] != want[1] {
+		t.Fatalf("CompareVaults() changes = %+v, want %+v", diff.Changes, want)
+	}
+	if diff.Unchanged != 1 || diff.From != primary || diff.To != backup {
+		t.Errorf("CompareVaults() = %+v", diff)
+	}
+	if same, err := CompareVaults(primary, primary); err != nil || len(same.Changes) != 0 {
+		t.Errorf("CompareVaults() of a vault with itself = %+v, %v", same, err)
+	}
+}
@@ -1,13 +1,17 @@
 package sneakernet
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/substantialcattle5/sietch/internal/atomic"
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/layout"
 	"gopkg.in/yaml.v3"
 )
 
@@ -48,7 +52,7 @@ func (st *SneakTransfer) Analyze() (*SneakAnalysis, error) {
 	destChunkMap := make(map[string]bool)
 
 	for _, file := range destManifest.Files {
-		destFileMap[file.FilePath] = file
+		destFileMap[file.Identity()] = file
 		for _, chunk := range file.Chunks {
 			destChunkMap[chunk.Hash] = true
 			if chunk.EncryptedHash != "" {
@@ -64,7 +68,7 @@ func (st *SneakTransfer) Analyze() (*SneakAnalysis, error) {
 			continue
 		}
 
-		if destFile, exists := destFileMap[sourceFile.FilePath]; exists {
+		if destFile, exists := destFileMap[sourceFile.Identity()]; exists {
 			// File exists in destination - check for conflicts
 			if st.filesConflict(sourceFile, destFile) {
 				conflict := FileConflict{
@@ -88,8 +92,21 @@ func (st *SneakTransfer) Analyze() (*SneakAnalysis, error) {
 			analysis.NewFiles = append(analysis.NewFiles, sourceFile)
 		}
 
+		// Small files live in packs rather than chunks
+		if sourceFile.Pack != nil && !destManager.PackExists(sourceFile.Pack.ID) && !slices.Contains(analysis.NewPacks, sourceFile.Pack.ID) {
+			analysis.NewPacks = append(analysis.NewPacks, sourceFile.Pack.ID)
+			analysis.TransferSize += sourceFile.Size
+		}
+
 		// Process chunks for this file
 		for _, chunk := range sourceFile.Chunks {
+			if chunk.Zero {
+				// Zero chunks are not stored and never need transferring
+				continue
+			}
+			if dict := chunk.CompressionDict; dict != "" && !destManager.DictionaryExists(dict) && !slices.Contains(analysis.NewDicts, dict) {
+				analysis.NewDicts = append(analysis.NewDicts, dict)
+			}
 			chunkExists := destChunkMap[chunk.Hash]
 			if chunk.EncryptedHash != "" && destChunkMap[chunk.EncryptedHash] {
 				chunkExists = true
@@ -164,6 +181,40 @@ func (st *SneakTransfer) Execute() (*TransferResult, error) {
 
 	result.ChunksSkipped = len(analysis.DuplicateChunks)
 
+	// Transfer packs holding small files
+	for _, packID := range analysis.NewPacks {
+		packData, err := sourceManager.GetChunk(packID)
+		if err == nil {
+			err = destManager.StorePack(packID, packData)
+		}
+		if err != nil {
+			errorMsg := fmt.Sprintf("failed to transfer pack %s: %v", packID, err)
+			result.Errors = append(result.Errors, errorMsg)
+			if st.Verbose {
+				fmt.Printf("Error: %s\n", errorMsg)
+			}
+			continue
+		}
+		result.PacksTransferred++
+	}
+
+	// Transfer the compression dictionaries the new chunks need
+	for _, id := range analysis.NewDicts {
+		dictData, err := sourceManager.GetChunk(layout.DictionaryName(id))
+		if err == nil {
+			err = destManager.StoreDictionary(id, dictData)
+		}
+		if err != nil {
+			errorMsg := fmt.Sprintf("failed to transfer compression dictionary %s: %v", id, err)
+			result.Errors = append(result.Errors, errorMsg)
+			if st.Verbose {
+				fmt.Printf("Error: %s\n", errorMsg)
+			}
+			continue
+		}
+		result.DictsTransferred++
+	}
+
 	// Transfer manifests for new files and resolved conflicts
 	err = st.transferManifestsWithAnalysis(result, analysis)
 	if err != nil {
@@ -321,6 +372,9 @@ func (st *SneakTransfer) writeFileManifest(manifestsDir string, fileManifest con
 
 	// Generate manifest filename (use a safe filename based on the file path)
 	manifestName := st.generateManifestFilename(fileManifest.FilePath)
+	if fileManifest.PathID != "" {
+		manifestName = fileManifest.PathID + ".yaml"
+	}
 	manifestPath := filepath.Join(manifestsDir, manifestName)
 
 	// Write manifest file (this would need to be implemented to match the existing format)
@@ -410,19 +464,23 @@ func (st *SneakTransfer) generateManifestFilename(filePath string) string {
 
 // saveFileManifest saves a file manifest
 func (st *SneakTransfer) saveFileManifest(manifestPath string, fileManifest config.FileManifest) error {
-	// Create the file
-	file, err := os.Create(manifestPath)
-	if err != nil {
-		return fmt.Errorf("failed to create manifest file: %v", err)
-	}
-	defer file.Close()
-
-	// Encode the manifest to YAML with proper indentation
-	encoder := yaml.NewEncoder(file)
+	// Encode the manifest to YAML with proper indentation, compressed if the
+	// destination vault's manifest format asks for it
+	var buf bytes.Buffer
+	w := config.NewManifestWriter(&buf, config.ManifestCompression(st.DestVault))
+	encoder := yaml.NewEncoder(w)
 	encoder.SetIndent(2)
 	if err := encoder.Encode(fileManifest); err != nil {
 		return fmt.Errorf("failed to encode manifest: %v", err)
 	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+
+	// Replace the file in one step, so a crash leaves the old manifest or the new one
+	if err := atomic.WriteFile(manifestPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
 
 	return nil
 }
@@ -22,6 +22,8 @@ type SneakAnalysis struct {
 	NewFiles        []config.FileManifest `json:"new_files"`
 	NewChunks       []string              `json:"new_chunks"`
 	DuplicateChunks []string              `json:"duplicate_chunks"`
+	NewPacks        []string              `json:"new_packs,omitempty"`
+	NewDicts        []string              `json:"new_dicts,omitempty"` // Compression dictionaries the new chunks need
 	Conflicts       []FileConflict        `json:"conflicts"`
 	TotalSize       int64                 `json:"total_size"`
 	TransferSize    int64                 `json:"transfer_size"`
@@ -47,6 +49,8 @@ type TransferResult struct {
 	FilesTransferred  int            `json:"files_transferred"`
 	ChunksTransferred int            `json:"chunks_transferred"`
 	ChunksSkipped     int            `json:"chunks_skipped"`
+	PacksTransferred  int            `json:"packs_transferred,omitempty"`
+	DictsTransferred  int            `json:"dicts_transferred,omitempty"`
 	BytesTransferred  int64          `json:"bytes_transferred"`
 	Duration          time.Duration  `json:"duration"`
 	Conflicts         []FileConflict `json:"conflicts"`
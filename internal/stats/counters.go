@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+)
+
+// Counters are what 'sietch status' reports without reading the vault: the
+// statistics last computed, kept until a command that changes the vault drops
+// them, and the times commands record as they finish. They live in
+// .sietch/status.json; losing the file only costs one recomputation.
+type Counters struct {
+	Stats       *Stats       `json:"stats,omitempty"`       // Nil once a command may have changed the vault
+	Reclaimable *Reclaimable `json:"reclaimable,omitempty"` // Computed along with Stats
+	ComputedAt  time.Time    `json:"computed_at,omitempty"`
+
+	LastAdd   time.Time            `json:"last_add,omitempty"`
+	LastSync  time.Time            `json:"last_sync,omitempty"`
+	PeersSeen map[string]time.Time `json:"peers_seen,omitempty"` // Last successful sync with each peer, by peer ID
+}
+
+// Reclaimable is what 'sietch dedup gc' would free: the chunks the dedup index
+// counts no references to
+type Reclaimable struct {
+	Chunks int   `json:"chunks"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// CountersPath returns the path of the vault's counters file
+func CountersPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "status.json")
+}
+
+// LoadCounters reads the vault's counters. A missing or unreadable file gives
+// empty counters, which only makes status recompute.
+func LoadCounters(vaultRoot string) (*Counters, error) {
+	counters := &Counters{}
+	data, err := os.ReadFile(CountersPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return counters, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", CountersPath(vaultRoot), err)
+	}
+	if err := json.Unmarshal(data, counters); err != nil {
+		return &Counters{}, nil
+	}
+	return counters, nil
+}
+
+// SaveCounters writes the vault's counters
+func SaveCounters(vaultRoot string, counters *Counters) error {
+	data, err := json.MarshalIndent(counters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode counters: %v", err)
+	}
+	return atomic.WriteFile(CountersPath(vaultRoot), data, 0o644)
+}
+
+// UpdateCounters applies update to the vault's counters and saves them
+func UpdateCounters(vaultRoot string, update func(counters *Counters)) error {
+	counters, err := LoadCounters(vaultRoot)
+	if err != nil {
+		return err
+	}
+	update(counters)
+	return SaveCounters(vaultRoot, counters)
+}
+
+// Invalidate drops the cached statistics, for a command about to change the
+// vault. The recorded times are kept.
+func Invalidate(vaultRoot string) error {
+	counters, err := LoadCounters(vaultRoot)
+	if err != nil {
+		return err
+	}
+	if counters.Stats == nil && counters.Reclaimable == nil {
+		return nil
+	}
+	counters.Stats, counters.Reclaimable = nil, nil
+	return SaveCounters(vaultRoot, counters)
+}
@@ -0,0 +1,58 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	vaultRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing to drop before anything was cached
+	if err := Invalidate(vaultRoot); err != nil {
+		t.Fatalf("Invalidate() error: %v", err)
+	}
+	if _, err := os.Stat(CountersPath(vaultRoot)); !os.IsNotExist(err) {
+		t.Error("Invalidate() wrote counters when none were cached")
+	}
+
+	synced := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	err := UpdateCounters(vaultRoot, func(c *Counters) {
+		c.Stats = &Stats{Files: 3}
+		c.Reclaimable = &Reclaimable{Chunks: 1, Bytes: 10}
+		c.LastSync = synced
+		c.PeersSeen = map[string]time.Time{"peer": synced}
+	})
+	if err != nil {
+		t.Fatalf("UpdateCounters() error: %v", err)
+	}
+	counters, err := LoadCounters(vaultRoot)
+	if err != nil || counters.Stats == nil || counters.Stats.Files != 3 {
+		t.Fatalf("LoadCounters() = %+v, %v; want the cached statistics", counters, err)
+	}
+
+	// A change drops the statistics and keeps the recorded times
+	if err := Invalidate(vaultRoot); err != nil {
+		t.Fatalf("Invalidate() error: %v", err)
+	}
+	counters, _ = LoadCounters(vaultRoot)
+	if counters.Stats != nil || counters.Reclaimable != nil {
+		t.Errorf("statistics survived Invalidate(): %+v", counters)
+	}
+	if !counters.LastSync.Equal(synced) || !counters.PeersSeen["peer"].Equal(synced) {
+		t.Errorf("Invalidate() lost the recorded times: %+v", counters)
+	}
+
+	// A damaged file is only a cache miss
+	if err := os.WriteFile(CountersPath(vaultRoot), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if counters, err := LoadCounters(vaultRoot); err != nil || counters.Stats != nil {
+		t.Errorf("LoadCounters() of a damaged file = %+v, %v; want empty counters", counters, err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package stats summarizes what a vault holds and what it takes on disk
+package stats
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/layout"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// Stats describes a vault's live files and the storage they use. Every distinct
+// chunk is counted once however many files reference it.
+type Stats struct {
+	Files        int   `json:"files"`
+	PackedFiles  int   `json:"packed_files"`
+	DamagedFiles int   `json:"damaged_files"` // Marked damaged by 'sietch fsck --repair'
+	LogicalSize  int64 `json:"logical_size"`  // Sum of file sizes
+
+	Chunks int `json:"chunks"` // Distinct stored chunks; all-zero and remote chunks are not stored
+	// Plaintext and compressed bytes of the chunks whose compressed size the
+	// manifests record. Manifests written before sizes were tracked leave
+	// chunks out of both, counted in UnknownChunks instead.
+	ChunkBytes      int64 `json:"chunk_bytes"`
+	CompressedBytes int64 `json:"compressed_bytes"`
+	UnknownChunks   int   `json:"unknown_chunks"`
+	// Bytes the chunk files take, encryption overhead included. Chunks the
+	// manifests have no size for are measured on disk.
+	StoredBytes int64 `json:"stored_bytes"`
+	// Encryption overhead of the chunks whose compressed and stored size are known
+	EncryptionBytes int64 `json:"encryption_bytes"`
+
+	Packs     int   `json:"packs"`
+	PackBytes int64 `json:"pack_bytes"`
+
+	// The chunks counted in ChunkBytes by the codec they were compressed
+	// with, those saving the most first
+	Codecs []CodecStats `json:"codecs,omitempty"`
+}
+
+// CodecStats is what one compression codec does for the chunks stored with it
+type CodecStats struct {
+	Codec           string `json:"codec"`                // Algorithm, or "none" for chunks stored uncompressed
+	Dictionary      bool   `json:"dictionary,omitempty"` // Compressed with a trained zstd dictionary
+	Chunks          int    `json:"chunks"`
+	ChunkBytes      int64  `json:"chunk_bytes"`              // Before compression
+	CompressedBytes int64  `json:"compressed_bytes"`         // After compression, before encryption
+	Incompressible  int    `json:"incompressible,omitempty"` // Stored uncompressed because compression saved too little
+}
+
+// Name returns the codec's name, marking dictionary compression
+func (c CodecStats) Name() string {
+	if c.Dictionary {
+		return c.Codec + "+dict"
+	}
+	return c.Codec
+}
+
+// Ratio returns the codec's chunk bytes over their compressed size; ok is
+// false when its chunks are all empty
+func (c CodecStats) Ratio() (ratio float64, ok bool) {
+	if c.CompressedBytes == 0 {
+		return 0, false
+	}
+	return float64(c.ChunkBytes) / float64(c.CompressedBytes), true
+}
+
+// chunkSizes is what Compute keeps per distinct chunk
+type chunkSizes struct {
+	size       int64
+	compressed int64
+	stored     int64
+	known      bool // compressed is recorded
+	storedOK   bool // stored is recorded
+	codec      codecKey
+	skipped    bool // Incompressible
+}
+
+// codecKey groups chunks in Stats.Codecs
+type codecKey struct {
+	codec      string
+	dictionary bool
+}
+
+// chunkCodec returns the codec a chunk was stored with
+func chunkCodec(ref config.ChunkRef) codecKey {
+	if !ref.Compressed || ref.CompressionType == "" {
+		return codecKey{codec: constants.CompressionTypeNone}
+	}
+	return codecKey{codec: ref.CompressionType, dictionary: ref.CompressionDict != ""}
+}
+
+// Compute walks the vault's file manifests and returns its statistics
+func Compute(vaultRoot string) (*Stats, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+
+	stats := &Stats{}
+	chunks := make(map[string]*chunkSizes)
+	packs := make(map[string]bool)
+	err = manager.WalkManifestEntries(func(entry *config.ManifestEntry) error {
+		manifest := &entry.Manifest
+		stats.Files++
+		stats.LogicalSize += manifest.Size
+		if manifest.Damaged {
+			stats.DamagedFiles++
+		}
+		if manifest.Pack != nil {
+			stats.PackedFiles++
+			packs[manifest.Pack.ID] = true
+			return nil
+		}
+		for _, ref := range manifest.Chunks {
+			if ref.Zero || ref.Remote {
+				continue
+			}
+			compressed, known := ref.CompressedBytes()
+			stored, storedOK := ref.StoredSize()
+			key := chunker.StorageKey(ref)
+			// A deduplicated reference may lack sizes the first one recorded
+			if c, ok := chunks[key]; ok && (c.known || !known) && (c.storedOK || !storedOK) {
+				continue
+			}
+			chunks[key] = &chunkSizes{size: ref.Size, compressed: compressed, stored: stored, known: known, storedOK: storedOK,
+				codec: chunkCodec(ref), skipped: ref.Incompressible}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	codecs := make(map[codecKey]*CodecStats)
+	for key, c := range chunks {
+		stats.Chunks++
+		if !c.storedOK {
+			c.stored = chunkFileSize(vaultRoot, key)
+		}
+		stats.StoredBytes += c.stored
+		if !c.known {
+			stats.UnknownChunks++
+			continue
+		}
+		stats.ChunkBytes += c.size
+		stats.CompressedBytes += c.compressed
+		if c.storedOK {
+			stats.EncryptionBytes += c.stored - c.compressed
+		}
+		codec, ok := codecs[c.codec]
+		if !ok {
+			codec = &CodecStats{Codec: c.codec.codec, Dictionary: c.codec.dictionary}
+			codecs[c.codec] = codec
+		}
+		codec.Chunks++
+		codec.ChunkBytes += c.size
+		codec.CompressedBytes += c.compressed
+		if c.skipped {
+			codec.Incompressible++
+		}
+	}
+	for _, codec := range codecs {
+		stats.Codecs = append(stats.Codecs, *codec)
+	}
+	sort.Slice(stats.Codecs, func(i, j int) bool {
+		a, b := stats.Codecs[i], stats.Codecs[j]
+		if savedA, savedB := a.ChunkBytes-a.CompressedBytes, b.ChunkBytes-b.CompressedBytes; savedA != savedB {
+			return savedA > savedB
+		}
+		return a.Name() < b.Name()
+	})
+	for id := range packs {
+		info, err := os.Stat(layout.PackPath(vaultRoot, id))
+		if err != nil {
+			continue
+		}
+		stats.Packs++
+		stats.PackBytes += info.Size()
+	}
+	return stats, nil
+}
+
+// CompressionRatio returns the plaintext size of the chunks with a known
+// compressed size over their compressed size; ok is false when there are none
+func (s *Stats) CompressionRatio() (ratio float64, ok bool) {
+	if s.CompressedBytes == 0 {
+		return 0, false
+	}
+	return float64(s.ChunkBytes) / float64(s.CompressedBytes), true
+}
+
+// DiskBytes returns the bytes the vault's chunks and packs take on disk
+func (s *Stats) DiskBytes() int64 {
+	return s.StoredBytes + s.PackBytes
+}
+
+// chunkFileSize returns the size of a stored chunk, or zero when it is missing
+func chunkFileSize(vaultRoot, storageKey string) int64 {
+	loc, exists := layout.LocateChunk(vaultRoot, storageKey)
+	if !exists {
+		return 0
+	}
+	size, err := loc.Size()
+	if err != nil {
+		return 0
+	}
+	return size
+}
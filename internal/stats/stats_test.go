@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+// writeManifest stores a file manifest, and for each of its chunks not yet in
+// the vault a chunk file of the given size
+func writeManifest(t *testing.T, vaultRoot string, manifest config.FileManifest, onDisk map[string]int) {
+	t.Helper()
+	for _, ref := range manifest.Chunks {
+		key := chunker.StorageKey(ref)
+		if size, ok := onDisk[key]; ok && !fs.ChunkExists(vaultRoot, key) {
+			if err := fs.StoreChunk(vaultRoot, key, make([]byte, size)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(&manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(manifestsDir, manifest.FilePath+".yaml"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	onDisk := map[string]int{"enc-a": 68, "bbbb": 40, "old": 30, "enc-old": 90}
+	gzipped := config.ChunkRef{Hash: "aaaa", EncryptedHash: "enc-a", Size: 100, Compressed: true, CompressionType: "gzip", CompressedSize: 40, EncryptedSize: 68}
+
+	tests := []struct {
+		name      string
+		manifests []config.FileManifest
+		want      Stats
+		wantRatio float64 // Zero when unknown
+	}{
+		{
+			name: "encrypted and deduplicated",
+			manifests: []config.FileManifest{
+				{FilePath: "a.txt", Size: 300, Chunks: []config.ChunkRef{
+					gzipped,
+					{Hash: "bbbb", Size: 100, CompressionType: "none", CompressedSize: 40, Compressed: true},
+					{Hash: "zero", Size: 100, Zero: true},
+				}},
+				{FilePath: "b.txt", Size: 100, Chunks: []config.ChunkRef{{Hash: "aaaa", EncryptedHash: "enc-a", Size: 100, Deduplicated: true, Compressed: true}}},
+			},
+			want: Stats{Files: 2, LogicalSize: 400, Chunks: 2, ChunkBytes: 200, CompressedBytes: 80, StoredBytes: 108, EncryptionBytes: 28,
+				Codecs: []CodecStats{{Codec: "gzip", Chunks: 1, ChunkBytes: 100, CompressedBytes: 40}, {Codec: "none", Chunks: 1, ChunkBytes: 100, CompressedBytes: 40}}},
+			wantRatio: 2.5,
+		},
+		{
+			name: "older manifests",
+			manifests: []config.FileManifest{
+				{FilePath: "old.txt", Size: 200, Chunks: []config.ChunkRef{
+					{Hash: "old", Size: 100, Compressed: true, CompressionType: "zstd"},
+					{Hash: "plain", EncryptedHash: "enc-old", Size: 100},
+				}},
+			},
+			want: Stats{Files: 1, LogicalSize: 200, Chunks: 2, ChunkBytes: 100, CompressedBytes: 100, StoredBytes: 120, UnknownChunks: 1,
+				Codecs: []CodecStats{{Codec: "none", Chunks: 1, ChunkBytes: 100, CompressedBytes: 100}}},
+			// The unencrypted, uncompressed chunk is known to be stored as is
+			wantRatio: 1,
+		},
+		{
+			name: "codecs",
+			manifests: []config.FileManifest{
+				{FilePath: "mixed.txt", Size: 400, Chunks: []config.ChunkRef{
+					{Hash: "z1", Size: 100, Compressed: true, CompressionType: "zstd", CompressedSize: 20},
+					{Hash: "z2", Size: 100, Compressed: true, CompressionType: "zstd", CompressedSize: 30},
+					{Hash: "d1", Size: 100, Compressed: true, CompressionType: "zstd", CompressionDict: "3a9c01f2", CompressedSize: 10},
+					{Hash: "jpg", Size: 100, CompressionType: "none", CompressedSize: 100, Incompressible: true},
+				}},
+			},
+			want: Stats{Files: 1, LogicalSize: 400, Chunks: 4, ChunkBytes: 400, CompressedBytes: 160, StoredBytes: 160, Codecs: []CodecStats{
+				{Codec: "zstd", Chunks: 2, ChunkBytes: 200, CompressedBytes: 50},
+				{Codec: "zstd", Dictionary: true, Chunks: 1, ChunkBytes: 100, CompressedBytes: 10},
+				{Codec: "none", Chunks: 1, ChunkBytes: 100, CompressedBytes: 100, Incompressible: 1},
+			}},
+			wantRatio: 2.5,
+		},
+		{
+			name: "packed and remote",
+			manifests: []config.FileManifest{
+				{FilePath: "small.txt", Size: 10, Pack: &config.PackRef{ID: "missing", Length: 10}},
+				{FilePath: "far.txt", Size: 100, Chunks: []config.ChunkRef{{Hash: "far", Size: 100, Remote: true}}},
+			},
+			want: Stats{Files: 2, PackedFiles: 1, LogicalSize: 110},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultRoot := t.TempDir()
+			for _, m := range tt.manifests {
+				writeManifest(t, vaultRoot, m, onDisk)
+			}
+			got, err := Compute(vaultRoot)
+			if err != nil {
+				t.Fatalf("Compute() error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Compute() = %+v, want %+v", *got, tt.want)
+			}
+			if ratio, ok := got.CompressionRatio(); ok != (tt.wantRatio != 0) || ratio != tt.wantRatio {
+				t.Errorf("CompressionRatio() = %v, %v; want %v", ratio, ok, tt.wantRatio)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/substantialcattle5/sietch/internal/compression"
 	"github.com/substantialcattle5/sietch/internal/config"
 )
 
@@ -34,7 +35,7 @@ func PrintSuccessMessage(cfg *config.VaultConfig, vaultID, vaultPath string) {
 	fmt.Println("\n💾 Storage:")
 	fmt.Printf("  • Chunking:    %s (size: %s)\n", cfg.Chunking.Strategy, cfg.Chunking.ChunkSize)
 	fmt.Printf("  • Hash:        %s\n", cfg.Chunking.HashAlgorithm)
-	fmt.Printf("  • Compression: %s\n", cfg.Compression)
+	fmt.Printf("  • Compression: %s\n", compression.Describe(cfg.Compression, cfg.CompressionLevel))
 
 	// Metadata
 	fmt.Println("\n📋 Metadata:")
@@ -16,6 +16,7 @@ import (
 	"golang.org/x/term"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
 	passphrasevalidation "github.com/substantialcattle5/sietch/internal/passphrase"
 )
 
@@ -68,6 +69,10 @@ func GetPassphraseForVault(cmd *cobra.Command, vaultConfig *config.VaultConfig)
 	if vaultConfig.Encryption.Type == "none" || !vaultConfig.Encryption.PassphraseProtected {
 		return "", nil
 	}
+	// A recipient identity unwraps the key without the passphrase
+	if encryption.UnlocksWithIdentity(vaultConfig.Encryption) {
+		return "", nil
+	}
 
 	passphrase := ""
 	var err error
@@ -0,0 +1,353 @@
+// Package validate reports problems in the YAML and JSON documents sietch
+// reads (templates, vault.yaml, manifests) by field path, with the allowed
+// values and a did-you-mean suggestion for near-miss keys.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Issue is a single problem found in a document
+type Issue struct {
+	Field      string // Full path of the offending field, e.g. "config.chunk_size"
+	Message    string
+	Suggestion string // Known key or value the offending one is close to
+	Unknown    bool   // The key is not known: a warning, unless validation is strict
+}
+
+func (i Issue) String() string {
+	s := i.Message
+	if i.Field != "" {
+		s = i.Field + ": " + s
+	}
+	if i.Suggestion != "" {
+		s += fmt.Sprintf(" (did you mean %q?)", i.Suggestion)
+	}
+	return s
+}
+
+// strict turns unknown keys from warnings into errors; set by --strict
+var strict bool
+
+// SetStrict makes unknown keys errors instead of warnings
+func SetStrict(on bool) {
+	strict = on
+}
+
+// Strict reports whether unknown keys are errors
+func Strict() bool {
+	return strict
+}
+
+// Split separates the issues that are errors from those that are only
+// warnings: unknown keys, unless validation is strict
+func Split(issues []Issue) (errs, warnings []Issue) {
+	for _, issue := range issues {
+		if issue.Unknown && !strict {
+			warnings = append(warnings, issue)
+		} else {
+			errs = append(errs, issue)
+		}
+	}
+	return errs, warnings
+}
+
+// Error is returned for a document with problems that keep it from being used
+type Error struct {
+	Source string // File or document the issues were found in
+	Issues []Issue
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		lines[i] = issue.String()
+	}
+	if len(lines) == 1 {
+		return fmt.Sprintf("invalid %s: %s", e.Source, lines[0])
+	}
+	return fmt.Sprintf("invalid %s:\n  - %s", e.Source, strings.Join(lines, "\n  - "))
+}
+
+// Choice returns an issue for a value that is not one of allowed, or nil
+func Choice(field, what, value string, allowed []string) *Issue {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return &Issue{
+		Field:      field,
+		Message:    fmt.Sprintf("unsupported %s %q (supported: %s)", what, value, strings.Join(allowed, ", ")),
+		Suggestion: Suggest(value, allowed),
+	}
+}
+
+// Check compares a decoded document (from encoding/json or yaml.v2, into an
+// interface{}) with the struct type it is meant for, keyed by the given struct
+// tag ("json" or "yaml"). It reports every unknown key, with the known key it
+// is closest to, and every value of the wrong kind, such as a word where a
+// number is expected.
+func Check(doc interface{}, t reflect.Type, tag string) []Issue {
+	return check(doc, t, tag, "")
+}
+
+func check(value interface{}, t reflect.Type, tag, path string) []Issue {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if value == nil || skipsCheck(t) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := asMap(value)
+		if !ok {
+			return []Issue{kindIssue(path, "a mapping", value)}
+		}
+		return checkStruct(m, t, tag, path)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil // []byte holds encoded data
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return []Issue{kindIssue(path, "a list", value)}
+		}
+		var issues []Issue
+		for i, item := range items {
+			issues = append(issues, check(item, t.Elem(), tag, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return issues
+	case reflect.Map:
+		m, ok := asMap(value)
+		if !ok {
+			return []Issue{kindIssue(path, "a mapping", value)}
+		}
+		var issues []Issue
+		for _, key := range sortedKeys(m) {
+			issues = append(issues, check(m[key], t.Elem(), tag, join(path, key))...)
+		}
+		return issues
+	case reflect.String:
+		// yaml.v2 reads any scalar into a string, encoding/json only strings
+		_, isString := value.(string)
+		_, isMap := asMap(value)
+		_, isList := value.([]interface{})
+		if isMap || isList || (tag == "json" && !isString) {
+			return []Issue{kindIssue(path, "a string", value)}
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return []Issue{kindIssue(path, "true or false", value)}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !isWholeNumber(value) {
+			return []Issue{kindIssue(path, "a whole number", value)}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch value.(type) {
+		case int, int64, uint64, float64:
+		default:
+			return []Issue{kindIssue(path, "a number", value)}
+		}
+	}
+	return nil
+}
+
+func checkStruct(m map[string]interface{}, t reflect.Type, tag, path string) []Issue {
+	fields := fieldsOf(t, tag)
+	known := make([]string, 0, len(fields))
+	for name := range fields {
+		known = append(known, name)
+	}
+	sort.Strings(known)
+
+	var issues []Issue
+	for _, key := range sortedKeys(m) {
+		fieldType, ok := fields[key]
+		if !ok && tag == "json" {
+			// encoding/json matches keys case-insensitively
+			for name, ft := range fields {
+				if strings.EqualFold(name, key) {
+					fieldType, ok = ft, true
+					break
+				}
+			}
+		}
+		if !ok {
+			issues = append(issues, Issue{Field: join(path, key), Message: "unknown field", Suggestion: Suggest(key, known), Unknown: true})
+			continue
+		}
+		issues = append(issues, check(m[key], fieldType, tag, join(path, key))...)
+	}
+	return issues
+}
+
+// fieldsOf maps the keys of struct t, as named by tag, to their types,
+// including those of inlined (yaml) and embedded (json) structs
+func fieldsOf(t reflect.Type, tag string) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		parts := strings.Split(field.Tag.Get(tag), ",")
+		name := parts[0]
+		if name == "-" {
+			continue
+		}
+		inline := (tag == "yaml" && contains(parts[1:], "inline")) || (tag == "json" && field.Anonymous && name == "")
+		if inline && field.Type.Kind() == reflect.Struct {
+			for key, ft := range fieldsOf(field.Type, tag) {
+				fields[key] = ft
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+			if tag == "yaml" {
+				name = strings.ToLower(name) // yaml.v2's default key
+			}
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// skipsCheck reports types decoded from a form other than their kind suggests
+func skipsCheck(t reflect.Type) bool {
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(time.Duration(0)):
+		return true
+	}
+	return t.Kind() == reflect.Interface
+}
+
+// Suggest returns the candidate closest to name: one that differs only in
+// case, "_" and "-" (chunkSize for chunk_size), or else the nearest by edit
+// distance if it is close enough to be a typo. It is empty when none is.
+func Suggest(name string, candidates []string) string {
+	normalized := normalize(name)
+	best, bestDistance := "", -1
+	for _, candidate := range candidates {
+		if normalize(candidate) == normalized {
+			return candidate
+		}
+		d := Levenshtein(strings.ToLower(name), strings.ToLower(candidate))
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	// About one edit in three characters, so short names only match closely
+	limit := min((len(name)+2)/3, 3)
+	if bestDistance < 0 || bestDistance > limit {
+		return ""
+	}
+	return best
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+}
+
+// Levenshtein returns the number of single-character insertions, deletions
+// and substitutions that turn a into b
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func kindIssue(path, expected string, value interface{}) Issue {
+	return Issue{Field: path, Message: fmt.Sprintf("expected %s, got %s", expected, describe(value))}
+}
+
+// describe names a decoded value for an error message
+func describe(value interface{}) string {
+	if _, ok := asMap(value); ok {
+		return "a mapping"
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		return "a list"
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isWholeNumber(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int64, uint64:
+		return true
+	case float64:
+		return v == float64(int64(v))
+	}
+	return false
+}
+
+// asMap returns a decoded mapping with string keys; yaml.v2 decodes mappings
+// with interface{} keys, encoding/json with string keys
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = item
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
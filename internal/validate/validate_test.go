@@ -0,0 +1,168 @@
+package validate
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSuggest(t *testing.T) {
+	known := []string{"chunk_size", "chunking_strategy", "compression", "compression_level", "hash_algorithm"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"chunkSize", "chunk_size"},
+		{"CHUNK-SIZE", "chunk_size"},
+		{"compresion", "compression"},
+		{"compression_levle", "compression_level"},
+		{"hash_algo", ""},
+		{"cipher", ""},
+		{"x", ""},
+	}
+	for _, tt := range tests {
+		if got := Suggest(tt.name, known); got != tt.want {
+			t.Errorf("Suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"zstd", "zstd", 0},
+		{"zstdd", "zstd", 1},
+		{"sha265", "sha256", 2},
+		{"kitten", "sitting", 3},
+		{"", "lz4", 3},
+	}
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+type testPolicy struct {
+	Pattern string `yaml:"pattern" json:"pattern"`
+	Level   int    `yaml:"level,omitempty" json:"level,omitempty"`
+}
+
+type testConfig struct {
+	Name     string            `yaml:"name" json:"name"`
+	Enabled  bool              `yaml:"enabled" json:"enabled"`
+	Interval time.Duration     `yaml:"interval" json:"interval"`
+	Policies []testPolicy      `yaml:"policies" json:"policies"`
+	Labels   map[string]string `yaml:"labels" json:"labels"`
+	Nested   *struct {
+		Size string `yaml:"size" json:"size"`
+	} `yaml:"nested" json:"nested"`
+	Inline testPolicy `yaml:",inline" json:"-"`
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		doc  string
+		want []string // Issue strings
+	}{
+		{
+			name: "valid yaml",
+			tag:  "yaml",
+			doc:  "name: x\nenabled: true\ninterval: 30s\npolicies: [{pattern: '*.jpg', level: 3}]\nnested: {size: 4MB}\npattern: inline\n",
+		},
+		{
+			name: "unknown keys",
+			tag:  "yaml",
+			doc:  "nmae: x\nnested: {sise: 4MB}\npolicies: [{patern: a}]\ncolour: red\n",
+			want: []string{
+				"colour: unknown field",
+				`nested.sise: unknown field (did you mean "size"?)`,
+				`nmae: unknown field (did you mean "name"?)`,
+				`policies[0].patern: unknown field (did you mean "pattern"?)`,
+			},
+		},
+		{
+			name: "wrong kinds",
+			tag:  "yaml",
+			doc:  "enabled: maybe\npolicies: {pattern: a}\nnested: 4MB\nlevel: high\nname: [a, b]\n",
+			want: []string{
+				`enabled: expected true or false, got "maybe"`,
+				`level: expected a whole number, got "high"`,
+				"name: expected a string, got a list",
+				`nested: expected a mapping, got "4MB"`,
+				"policies: expected a list, got a mapping",
+			},
+		},
+		{
+			name: "yaml reads numbers into strings",
+			tag:  "yaml",
+			doc:  "name: 42\nlabels: {a: 1}\n",
+		},
+		{
+			name: "json does not",
+			tag:  "json",
+			doc:  `{"name": 42, "labels": {"a": 1}, "Enabled": true}`,
+			want: []string{"labels.a: expected a string, got 1", "name: expected a string, got 42"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			var err error
+			if tt.tag == "json" {
+				err = json.Unmarshal([]byte(tt.doc), &doc)
+			} else {
+				err = yaml.Unmarshal([]byte(tt.doc), &doc)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Check(doc, reflect.TypeOf(testConfig{}), tt.tag) {
+				got = append(got, issue.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	issues := []Issue{
+		{Field: "colour", Message: "unknown field", Unknown: true},
+		{Field: "level", Message: "expected a whole number"},
+	}
+	defer SetStrict(false)
+
+	errs, warnings := Split(issues)
+	if len(errs) != 1 || len(warnings) != 1 || errs[0].Field != "level" {
+		t.Errorf("Split() = %v, %v; want level as the only error", errs, warnings)
+	}
+
+	SetStrict(true)
+	if errs, warnings = Split(issues); len(errs) != 2 || len(warnings) != 0 {
+		t.Errorf("strict Split() = %v, %v; want both as errors", errs, warnings)
+	}
+}
+
+func TestChoice(t *testing.T) {
+	if issue := Choice("compression", "compression", "zstd", []string{"none", "zstd"}); issue != nil {
+		t.Errorf("Choice(zstd) = %v, want nil", issue)
+	}
+	issue := Choice("config.compression", "compression", "zstdd", []string{"none", "zstd"})
+	want := `config.compression: unsupported compression "zstdd" (supported: none, zstd) (did you mean "zstd"?)`
+	if issue == nil || issue.String() != want {
+		t.Errorf("Choice(zstdd) = %v, want %s", issue, want)
+	}
+}
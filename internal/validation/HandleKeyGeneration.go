@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"crypto/rand"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,7 +12,9 @@ import (
 	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/encryption"
 	"github.com/substantialcattle5/sietch/internal/encryption/aesencryption/aeskey"
+	"github.com/substantialcattle5/sietch/internal/encryption/agekey"
 	"github.com/substantialcattle5/sietch/internal/encryption/chachaencryption/chachakey"
+	"github.com/substantialcattle5/sietch/internal/fs/private"
 	"github.com/substantialcattle5/sietch/internal/ui"
 )
 
@@ -35,6 +38,11 @@ func HandleKeyGeneration(cmd *cobra.Command, absVaultPath string, params KeyGenP
 	var err error
 
 	if params.KeyFile != "" {
+		// An age identity or recipients file wraps a new key instead of being one
+		if data, err := os.ReadFile(params.KeyFile); err == nil && agekey.IsKeyFile(data) {
+			return wrapKeyWithAge(data, keyPath, params)
+		}
+
 		// Import key from file
 		if err := importKeyFromFile(params.KeyFile, keyPath); err != nil {
 			return nil, err
@@ -60,18 +68,64 @@ func importKeyFromFile(sourceKeyFile, destKeyPath string) error {
 
 	// Ensure directory exists
 	keyDir := filepath.Dir(destKeyPath)
-	if err := os.MkdirAll(keyDir, 0o700); err != nil {
+	if err := private.Mkdir(keyDir); err != nil {
 		return fmt.Errorf("failed to create key directory: %w", err)
 	}
 
 	// Write key file with secure permissions
-	if err := os.WriteFile(destKeyPath, keyData, 0o600); err != nil {
+	if err := private.WriteFileAtomic(destKeyPath, keyData); err != nil {
 		return fmt.Errorf("failed to write key to %s: %w", destKeyPath, err)
 	}
 
 	return nil
 }
 
+// wrapKeyWithAge generates a vault key and stores it encrypted to the age
+// recipients of keyFileData, which may list identities, recipients or both
+func wrapKeyWithAge(keyFileData []byte, keyPath string, params KeyGenParams) (*config.KeyConfig, error) {
+	if params.KeyType != constants.EncryptionTypeAES && params.KeyType != constants.EncryptionTypeChaCha20 {
+		return nil, fmt.Errorf("age key files can only wrap aes or chacha20 keys")
+	}
+	if params.UsePassphrase {
+		return nil, fmt.Errorf("an age key file protects the vault key in place of a passphrase; drop --passphrase")
+	}
+	keyFile, err := agekey.ParseKeyFile(keyFileData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age key file %s: %w", params.KeyFile, err)
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	wrapped, err := agekey.Encrypt(dataKey, keyFile.Recipients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap key with age: %w", err)
+	}
+	if err := private.Mkdir(filepath.Dir(keyPath)); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := private.WriteFileAtomic(keyPath, wrapped); err != nil {
+		return nil, fmt.Errorf("failed to write key to %s: %w", keyPath, err)
+	}
+
+	ageConfig := &config.AgeConfig{}
+	for _, recipient := range keyFile.Recipients {
+		ageConfig.Recipients = append(ageConfig.Recipients, recipient.String())
+	}
+	if len(keyFile.Identities) > 0 {
+		if ageConfig.IdentityFile, err = filepath.Abs(params.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("Wrapped a new vault key for %d age recipient(s) from %s\n", len(ageConfig.Recipients), params.KeyFile)
+	if ageConfig.IdentityFile == "" {
+		fmt.Printf("Set %s to an age identity for one of these recipients to open the vault\n", encryption.IdentityEnv)
+	}
+	return &config.KeyConfig{AgeConfig: ageConfig}, nil
+}
+
 func generateNewKey(cmd *cobra.Command, keyPath string, params KeyGenParams) (*config.KeyConfig, error) {
 	var userPassphrase string
 	var err error
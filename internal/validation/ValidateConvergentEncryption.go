@@ -0,0 +1,31 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/convergent"
+)
+
+// ValidateConvergentEncryption checks a vault's convergent encryption settings and
+// returns the warnings to show the user. Enabling convergent mode always produces
+// the privacy warning, since it weakens what the vault key alone protects.
+func ValidateConvergentEncryption(vaultConfig *config.VaultConfig) ([]string, error) {
+	settings := vaultConfig.Encryption.Convergent
+	if settings == nil || !settings.Enabled {
+		return nil, nil
+	}
+	if vaultConfig.Encryption.Type == "" || vaultConfig.Encryption.Type == constants.EncryptionTypeNone {
+		return nil, fmt.Errorf("convergent encryption requires an encrypted vault")
+	}
+	if settings.Secret == "" {
+		return nil, fmt.Errorf("convergent encryption is enabled but no convergence secret is configured")
+	}
+
+	warnings := []string{convergent.PrivacyWarning}
+	if !vaultConfig.Encryption.EncryptPaths {
+		warnings = append(warnings, "File paths are stored in plaintext; a peer that sees matching chunks also sees which files they belong to. Consider 'sietch vault encrypt-paths'.")
+	}
+	return warnings, nil
+}
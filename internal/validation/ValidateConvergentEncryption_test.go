@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestValidateConvergentEncryption(t *testing.T) {
+	tests := []struct {
+		name         string
+		keyType      string
+		convergent   *config.ConvergentConfig
+		encryptPaths bool
+		wantWarnings int
+		wantErr      string
+	}{
+		{name: "not configured", keyType: "aes"},
+		{name: "disabled", keyType: "aes", convergent: &config.ConvergentConfig{Secret: "wrapped"}},
+		{
+			name:         "enabled",
+			keyType:      "aes",
+			convergent:   &config.ConvergentConfig{Enabled: true, Secret: "wrapped"},
+			encryptPaths: true,
+			wantWarnings: 1,
+		},
+		{
+			name:         "enabled with plaintext paths",
+			keyType:      "aes",
+			convergent:   &config.ConvergentConfig{Enabled: true, Secret: "wrapped"},
+			wantWarnings: 2,
+		},
+		{
+			name:       "unencrypted vault",
+			keyType:    "none",
+			convergent: &config.ConvergentConfig{Enabled: true, Secret: "wrapped"},
+			wantErr:    "requires an encrypted vault",
+		},
+		{
+			name:       "missing secret",
+			keyType:    "aes",
+			convergent: &config.ConvergentConfig{Enabled: true},
+			wantErr:    "no convergence secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultConfig := &config.VaultConfig{}
+			vaultConfig.Encryption.Type = tt.keyType
+			vaultConfig.Encryption.Convergent = tt.convergent
+			vaultConfig.Encryption.EncryptPaths = tt.encryptPaths
+
+			warnings, err := ValidateConvergentEncryption(vaultConfig)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ValidateConvergentEncryption() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateConvergentEncryption() error: %v", err)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("ValidateConvergentEncryption() = %d warnings, want %d", len(warnings), tt.wantWarnings)
+			}
+			if tt.wantWarnings > 0 && !strings.Contains(warnings[0], "confirm") && !strings.Contains(warnings[0], "check whether") {
+				t.Errorf("first warning does not explain the privacy tradeoff: %q", warnings[0])
+			}
+		})
+	}
+}
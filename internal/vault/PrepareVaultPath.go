@@ -4,9 +4,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
 )
 
-func PrepareVaultPath(vaultPath string, vaultName string, forceInit bool) (string, error) {
+// PrepareVaultPath returns the absolute path of the vault to create. A
+// directory left with a .sietch directory but no readable vault.yaml, e.g. by
+// an interrupted init, is only reused with forceInit. A working vault is
+// never replaced by forceInit alone, so a mistyped name cannot destroy one;
+// that takes overwriteVault.
+func PrepareVaultPath(vaultPath string, vaultName string, forceInit, overwriteVault bool) (string, error) {
 	absVaultPath, err := filepath.Abs(filepath.Join(vaultPath, vaultName))
 	if err != nil {
 		return "", fmt.Errorf("failed to get absolute path: %w", err)
@@ -14,12 +22,26 @@ func PrepareVaultPath(vaultPath string, vaultName string, forceInit bool) (strin
 
 	// Check if vault already exists by checking for .sietch directory
 	sietchDir := filepath.Join(absVaultPath, ".sietch")
-	if _, err := os.Stat(sietchDir); err == nil {
-		if !forceInit {
-			return "", fmt.Errorf("vault already exists at %s. Use --force to re-initialize (warning: this will destroy existing data)", absVaultPath)
+	if _, err := os.Stat(sietchDir); err != nil || overwriteVault {
+		return absVaultPath, nil
+	}
+	if isValidVault(absVaultPath) {
+		if forceInit {
+			return "", fmt.Errorf("vault already exists at %s and --force does not replace a vault. Use --overwrite-vault to re-initialize it (warning: this will destroy existing data)", absVaultPath)
 		}
-		// If force is true, we'll continue and overwrite
+		return "", fmt.Errorf("vault already exists at %s. Use --overwrite-vault to re-initialize (warning: this will destroy existing data)", absVaultPath)
+	}
+	if !forceInit {
+		return "", fmt.Errorf("incomplete vault already exists at %s (.sietch without a readable vault.yaml). Use --force to re-initialize", absVaultPath)
 	}
-
 	return absVaultPath, nil
 }
+
+// isValidVault reports whether path holds a vault whose vault.yaml can be read
+func isValidVault(path string) bool {
+	if !fs.IsVaultInitialized(path) {
+		return false
+	}
+	_, err := config.VaultSchemaVersion(path)
+	return err == nil
+}
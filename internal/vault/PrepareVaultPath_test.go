@@ -8,13 +8,27 @@ import (
 	"github.com/substantialcattle5/sietch/testutil"
 )
 
+// setupValidVault creates a vault with a readable vault.yaml
+func setupValidVault(t *testing.T) (string, string) {
+	parentDir := testutil.TempDir(t, "vault-parent")
+	vaultPath := filepath.Join(parentDir, "valid-vault")
+	if err := os.MkdirAll(filepath.Join(vaultPath, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultPath, "vault.yaml"), []byte("schema_version: 3\nname: valid-vault\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return parentDir, "valid-vault"
+}
+
 func TestPrepareVaultPath(t *testing.T) {
 	tests := []struct {
-		name        string
-		setupFunc   func(t *testing.T) (vaultPath, vaultName string)
-		forceInit   bool
-		wantErr     bool
-		errContains string
+		name           string
+		setupFunc      func(t *testing.T) (vaultPath, vaultName string)
+		forceInit      bool
+		overwriteVault bool
+		wantErr        bool
+		errContains    string
 	}{
 		{
 			name: "new vault creation",
@@ -43,6 +57,37 @@ func TestPrepareVaultPath(t *testing.T) {
 			wantErr:     true,
 			errContains: "vault already exists",
 		},
+		{
+			name:        "valid vault without force",
+			setupFunc:   setupValidVault,
+			wantErr:     true,
+			errContains: "Use --overwrite-vault",
+		},
+		{
+			name:        "valid vault with force",
+			setupFunc:   setupValidVault,
+			forceInit:   true,
+			wantErr:     true,
+			errContains: "--force does not replace a vault",
+		},
+		{
+			name:           "valid vault with overwrite",
+			setupFunc:      setupValidVault,
+			overwriteVault: true,
+			wantErr:        false,
+		},
+		{
+			name: "unreadable vault.yaml with force",
+			setupFunc: func(t *testing.T) (string, string) {
+				parentDir, vaultName := setupValidVault(t)
+				if err := os.WriteFile(filepath.Join(parentDir, vaultName, "vault.yaml"), []byte("name: [unclosed"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return parentDir, vaultName
+			},
+			forceInit: true,
+			wantErr:   false,
+		},
 		{
 			name: "existing vault with force",
 			setupFunc: func(t *testing.T) (string, string) {
@@ -85,7 +130,7 @@ func TestPrepareVaultPath(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			vaultPath, vaultName := tt.setupFunc(t)
 
-			absVaultPath, err := PrepareVaultPath(vaultPath, vaultName, tt.forceInit)
+			absVaultPath, err := PrepareVaultPath(vaultPath, vaultName, tt.forceInit, tt.overwriteVault)
 
 			if tt.wantErr {
 				if err == nil {
@@ -125,7 +170,7 @@ func TestPrepareVaultPath(t *testing.T) {
 func TestPrepareVaultPathEdgeCases(t *testing.T) {
 	t.Run("empty vault name", func(t *testing.T) {
 		tempDir := testutil.TempDir(t, "test")
-		_, err := PrepareVaultPath(tempDir, "", false)
+		_, err := PrepareVaultPath(tempDir, "", false, false)
 		if err != nil {
 			t.Errorf("PrepareVaultPath() with empty name should not error, got: %v", err)
 		}
@@ -143,7 +188,7 @@ func TestPrepareVaultPathEdgeCases(t *testing.T) {
 
 		for _, name := range specialNames {
 			t.Run("name_"+name, func(t *testing.T) {
-				absPath, err := PrepareVaultPath(tempDir, name, false)
+				absPath, err := PrepareVaultPath(tempDir, name, false, false)
 				if err != nil {
 					t.Errorf("PrepareVaultPath() with name %q failed: %v", name, err)
 					return
@@ -159,7 +204,7 @@ func TestPrepareVaultPathEdgeCases(t *testing.T) {
 		tempDir := testutil.TempDir(t, "test")
 		deepPath := filepath.Join(tempDir, "very", "deep", "nested", "path", "structure")
 
-		absPath, err := PrepareVaultPath(deepPath, "deep-vault", false)
+		absPath, err := PrepareVaultPath(deepPath, "deep-vault", false, false)
 		if err != nil {
 			t.Errorf("PrepareVaultPath() with deep path failed: %v", err)
 			return
@@ -197,7 +242,7 @@ func TestPrepareVaultPathEdgeCases(t *testing.T) {
 
 		for _, relPath := range relativePaths {
 			t.Run("path_"+relPath, func(t *testing.T) {
-				absPath, err := PrepareVaultPath(relPath, "test-vault", false)
+				absPath, err := PrepareVaultPath(relPath, "test-vault", false, false)
 				if err != nil {
 					t.Errorf("PrepareVaultPath() with relative path %q failed: %v", relPath, err)
 					return
@@ -217,7 +262,7 @@ func TestPrepareVaultPathConsistency(t *testing.T) {
 	// Call PrepareVaultPath multiple times with same inputs
 	paths := make([]string, 5)
 	for i := 0; i < 5; i++ {
-		path, err := PrepareVaultPath(tempDir, vaultName, false)
+		path, err := PrepareVaultPath(tempDir, vaultName, false, false)
 		if err != nil {
 			t.Fatalf("PrepareVaultPath() call %d failed: %v", i+1, err)
 		}
@@ -244,7 +289,7 @@ func TestPrepareVaultPathWithExistingFile(t *testing.T) {
 	}
 
 	// PrepareVaultPath should still work (it doesn't check if it's a file vs directory)
-	absPath, err := PrepareVaultPath(tempDir, vaultName, false)
+	absPath, err := PrepareVaultPath(tempDir, vaultName, false, false)
 	if err != nil {
 		t.Errorf("PrepareVaultPath() failed with existing file: %v", err)
 		return
@@ -283,7 +328,7 @@ func TestPrepareVaultPathPermissions(t *testing.T) {
 	})
 
 	// PrepareVaultPath should still work as it doesn't create directories
-	absPath, err := PrepareVaultPath(restrictedDir, vaultName, false)
+	absPath, err := PrepareVaultPath(restrictedDir, vaultName, false, false)
 	if err != nil {
 		t.Errorf("PrepareVaultPath() failed with restricted parent: %v", err)
 		return
@@ -321,7 +366,7 @@ func BenchmarkPrepareVaultPath(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := PrepareVaultPath(tempDir, vaultName, false)
+		_, err := PrepareVaultPath(tempDir, vaultName, false, false)
 		if err != nil {
 			b.Fatalf("PrepareVaultPath() failed: %v", err)
 		}
@@ -341,7 +386,7 @@ func BenchmarkPrepareVaultPathWithExistingVault(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := PrepareVaultPath(tempDir, vaultName, true) // force = true
+		_, err := PrepareVaultPath(tempDir, vaultName, true, false) // force = true
 		if err != nil {
 			b.Fatalf("PrepareVaultPath() failed: %v", err)
 		}
@@ -0,0 +1,93 @@
+package chunker
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is an in-memory LRU of decrypted chunks keyed by plaintext hash. One
+// Cache can be shared by every Reader in a process, so files read repeatedly
+// (or chunks shared between files) are only fetched and decrypted once. It is
+// safe for concurrent use. A nil *Cache is valid and caches nothing.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[string]*list.Element
+	order    *list.List // front is most recently used
+
+	hits, misses int64
+}
+
+type cacheEntry struct {
+	hash string
+	data []byte
+}
+
+// CacheStats reports how a cache has been used
+type CacheStats struct {
+	Entries int
+	Bytes   int64
+	Hits    int64
+	Misses  int64
+}
+
+// NewCache returns a cache holding at most maxBytes of chunk data, or nil (no
+// caching) when maxBytes is zero or negative
+func NewCache(maxBytes int64) *Cache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &Cache{maxBytes: maxBytes, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Get returns the cached plaintext of the chunk with the given hash. The
+// returned slice is shared and must not be modified.
+func (c *Cache) Get(hash string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[hash]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).data, true
+}
+
+// Add caches a chunk's plaintext, evicting the least recently used chunks to
+// stay within the size limit. Chunks larger than the whole cache are not kept.
+func (c *Cache) Add(hash string, data []byte) {
+	if c == nil || int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[hash]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[hash] = c.order.PushFront(&cacheEntry{hash: hash, data: data})
+	c.size += int64(len(data))
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.hash)
+		c.size -= int64(len(entry.data))
+	}
+}
+
+// Stats returns the cache's current contents and hit counts
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: len(c.entries), Bytes: c.size, Hits: c.hits, Misses: c.misses}
+}
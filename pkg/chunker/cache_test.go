@@ -0,0 +1,58 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestCacheServesRepeatedReads(t *testing.T) {
+	data := randomData(t, 4*1024)
+	opts := Options{ChunkSize: 1024, Cipher: xorCipher{key: 0x7f}, Cache: NewCache(1 << 20)}
+	store := NewMemoryStore()
+	refs, err := Split(context.Background(), bytes.NewReader(data), store, opts)
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+	if got := readAll(t, store, refs, opts); !bytes.Equal(got, data) {
+		t.Fatal("first read did not round-trip")
+	}
+
+	// Every chunk is now cached, so an empty store is never consulted
+	if got := readAll(t, NewMemoryStore(), refs, opts); !bytes.Equal(got, data) {
+		t.Error("cached read did not round-trip")
+	}
+	if stats := opts.Cache.Stats(); stats.Entries != len(refs) || stats.Hits != int64(len(refs)) || stats.Misses != int64(len(refs)) {
+		t.Errorf("Stats() = %+v, want %d entries, hits and misses", stats, len(refs))
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(30)
+	cache.Add("a", make([]byte, 10))
+	cache.Add("b", make([]byte, 10))
+	cache.Add("c", make([]byte, 10))
+	cache.Get("a")
+	cache.Add("d", make([]byte, 10))
+	cache.Add("huge", make([]byte, 31))
+
+	for hash, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true, "huge": false} {
+		if _, ok := cache.Get(hash); ok != want {
+			t.Errorf("Get(%q) cached = %v, want %v", hash, ok, want)
+		}
+	}
+	if stats := cache.Stats(); stats.Bytes != 30 {
+		t.Errorf("cache holds %d bytes, want 30", stats.Bytes)
+	}
+}
+
+func TestZeroSizeCacheIsNoop(t *testing.T) {
+	cache := NewCache(0)
+	if cache != nil {
+		t.Fatal("NewCache(0) should disable caching")
+	}
+	cache.Add("a", []byte("data"))
+	if _, ok := cache.Get("a"); ok {
+		t.Error("a disabled cache returned data")
+	}
+}
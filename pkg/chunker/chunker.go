@@ -0,0 +1,353 @@
+package chunker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// ChunkRef describes one stored chunk, as recorded in Sietch file manifests
+type ChunkRef = config.ChunkRef
+
+// Cipher encrypts and decrypts encoded chunk data
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// ConvergentCipher is a Cipher that can also encrypt a chunk under a key derived
+// from its plaintext hash, so identical chunks encrypt to identical data. Chunks
+// encrypted this way are marked Convergent in their ref.
+type ConvergentCipher interface {
+	Cipher
+	// Convergent reports whether new chunks should be encrypted convergently
+	Convergent() bool
+	EncryptChunk(hash string, plaintext []byte) ([]byte, error)
+	DecryptChunk(hash string, ciphertext []byte) ([]byte, error)
+}
+
+// ChunkStore persists encoded chunks. Chunks are addressed by StorageKey(ref).
+type ChunkStore interface {
+	// Put stores an encoded chunk and returns the reference to record for it.
+	// A store may return a modified ref, e.g. marked Deduplicated or pointing
+	// at an identical chunk it already holds.
+	Put(ref ChunkRef, data []byte) (ChunkRef, error)
+	// Get returns the encoded chunk previously stored for ref
+	Get(ref ChunkRef) ([]byte, error)
+}
+
+// DictionarySource returns compression dictionaries by ID
+type DictionarySource interface {
+	Dictionary(id string) ([]byte, error)
+}
+
+// Options configures the pipeline. The zero value of each field selects the
+// default: fixed chunking, 4MB chunks, SHA-256, no compression, no encryption.
+type Options struct {
+	Strategy      string // "fixed" or "cdc"
+	ChunkSize     int64  // Chunk size in bytes (average size for cdc)
+	HashAlgorithm string // sha256, sha512, sha1 or blake3
+	Compression   string // none, gzip, zstd, lz4 or brotli
+	Level         int    // Compression level; 0 is the algorithm's default
+	MinSavings    int    // Percent a chunk must shrink by to be stored compressed; 0 is 5%
+	Cipher        Cipher // nil leaves chunks unencrypted
+	Cache         *Cache // Decrypted chunks kept across reads; nil disables caching
+	Jobs          int    // Chunks Split encodes in parallel; 0 or 1 encodes one at a time
+
+	// Dictionary, if set, compresses new chunks with zstd and this dictionary,
+	// whatever Compression says
+	Dictionary *compression.Dictionary
+	// Dictionaries looks up the dictionaries recorded in chunk refs when reading
+	Dictionaries DictionarySource
+
+	// OnChunk, if set, is called after each chunk has been stored
+	OnChunk func(ref ChunkRef)
+
+	// SkipHashCheck makes Decode return chunks without checking them against
+	// their recorded hash, for reads that trade integrity for speed. Chunks
+	// that fail to decrypt or decompress are still refused.
+	SkipHashCheck bool
+}
+
+func (o Options) chunkSize() int64 {
+	if o.ChunkSize <= 0 {
+		return int64(constants.DefaultChunkSize)
+	}
+	return o.ChunkSize
+}
+
+func (o Options) compression() string {
+	if o.Compression == "" {
+		return constants.CompressionTypeNone
+	}
+	return o.Compression
+}
+
+// StorageKey returns the key a chunk is stored under: the hash of the encrypted
+// data for encrypted chunks, otherwise the plaintext hash
+func StorageKey(ref ChunkRef) string {
+	if ref.EncryptedHash != "" {
+		return ref.EncryptedHash
+	}
+	return ref.Hash
+}
+
+// Split reads r to the end, storing every chunk in store, and returns the chunk
+// references in order. It stops early with an error if ctx is cancelled.
+func Split(ctx context.Context, r io.Reader, store ChunkStore, opts Options) ([]ChunkRef, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	splitter, err := chunk.NewChunker(r, opts.Strategy, opts.chunkSize(), opts.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Jobs > 1 {
+		return splitParallel(ctx, splitter, store, opts)
+	}
+
+	refs := []ChunkRef{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("operation cancelled")
+		default:
+		}
+
+		next, err := splitter.Next()
+		if err == io.EOF {
+			return refs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ref, encoded, err := encodeChunk(next.Data, next.Hash, next.Index, opts)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %v", next.Index+1, err)
+		}
+		if !ref.Zero {
+			if ref, err = store.Put(ref, encoded); err != nil {
+				return nil, fmt.Errorf("failed to store chunk %d: %v", next.Index+1, err)
+			}
+		}
+		if opts.OnChunk != nil {
+			opts.OnChunk(ref)
+		}
+		refs = append(refs, ref)
+	}
+}
+
+// StoreWhole stores everything r yields as a single chunk without splitting it,
+// and returns its reference; empty input has none. The data is held in memory,
+// so it is meant for small files.
+func StoreWhole(r io.Reader, store ChunkStore, opts Options) ([]ChunkRef, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return []ChunkRef{}, nil
+	}
+	ref, encoded, err := Encode(data, 0, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !ref.Zero {
+		if ref, err = store.Put(ref, encoded); err != nil {
+			return nil, fmt.Errorf("failed to store chunk: %v", err)
+		}
+	}
+	if opts.OnChunk != nil {
+		opts.OnChunk(ref)
+	}
+	return []ChunkRef{ref}, nil
+}
+
+// Encode hashes, compresses and encrypts a single chunk. It returns the chunk's
+// reference and the bytes to store; zero chunks return nil data.
+func Encode(data []byte, index int, opts Options) (ChunkRef, []byte, error) {
+	hasher, err := chunk.CreateHasher(opts.HashAlgorithm)
+	if err != nil {
+		return ChunkRef{}, nil, err
+	}
+	hasher.Write(data)
+	return encodeChunk(data, fmt.Sprintf("%x", hasher.Sum(nil)), index, opts)
+}
+
+func encodeChunk(data []byte, hash string, index int, opts Options) (ChunkRef, []byte, error) {
+	if chunk.IsZero(data) {
+		return ChunkRef{Hash: hash, Size: int64(len(data)), Index: index, Zero: true}, nil, nil
+	}
+
+	var compressed []byte
+	var err error
+	ref := ChunkRef{
+		Hash:            hash,
+		Size:            int64(len(data)),
+		Index:           index,
+		Compressed:      opts.compression() != constants.CompressionTypeNone,
+		CompressionType: opts.Compression,
+	}
+	if opts.Dictionary != nil {
+		compressed, err = compression.CompressWithDictionary(data, opts.Level, opts.Dictionary.Data)
+		if err != nil {
+			return ChunkRef{}, nil, fmt.Errorf("failed to compress with dictionary %s: %v", opts.Dictionary.ID, err)
+		}
+		ref.Compressed = true
+		ref.CompressionType = constants.CompressionTypeZstd
+		ref.CompressionDict = opts.Dictionary.ID
+	} else {
+		compressed, err = compression.CompressDataLevel(data, opts.compression(), opts.Level)
+		if err != nil {
+			return ChunkRef{}, nil, fmt.Errorf("failed to compress (%s): %v", opts.compression(), err)
+		}
+	}
+	ref.CompressedSize = int64(len(compressed))
+	if ref.Compressed && !compression.Worthwhile(len(data), len(compressed), opts.MinSavings) {
+		// Already compressed data (JPEGs, videos, archives) barely shrinks and
+		// may grow; store it as is and record that compression was skipped
+		compressed = data
+		ref.Compressed = false
+		ref.CompressionType = constants.CompressionTypeNone
+		ref.CompressionDict = ""
+		ref.CompressedSize = int64(len(data))
+		ref.Incompressible = true
+	}
+	if opts.Cipher == nil {
+		return ref, compressed, nil
+	}
+
+	var encrypted []byte
+	if cc, ok := opts.Cipher.(ConvergentCipher); ok && cc.Convergent() {
+		encrypted, err = cc.EncryptChunk(hash, compressed)
+		ref.Convergent = true
+	} else {
+		encrypted, err = opts.Cipher.Encrypt(compressed)
+	}
+	if err != nil {
+		return ChunkRef{}, nil, fmt.Errorf("failed to encrypt: %v", err)
+	}
+	encHasher, err := chunk.CreateHasher(opts.HashAlgorithm)
+	if err != nil {
+		return ChunkRef{}, nil, err
+	}
+	encHasher.Write(encrypted)
+	ref.EncryptedHash = fmt.Sprintf("%x", encHasher.Sum(nil))
+	ref.EncryptedSize = int64(len(encrypted))
+	return ref, encrypted, nil
+}
+
+// ErrChunkTooLarge is returned by Decode for a chunk that decompresses to more
+// than the size its reference records
+var ErrChunkTooLarge = errors.New("chunk decompresses beyond its recorded size")
+
+// Decode reverses Encode: it decrypts and decompresses stored chunk data and
+// verifies the plaintext against ref.Hash. Decompression stops shortly past
+// ref.Size, failing with ErrChunkTooLarge.
+func Decode(ref ChunkRef, encoded []byte, opts Options) ([]byte, error) {
+	if ref.Zero {
+		return make([]byte, ref.Size), nil
+	}
+
+	data := encoded
+	if ref.Convergent {
+		cc, ok := opts.Cipher.(ConvergentCipher)
+		if !ok {
+			return nil, fmt.Errorf("chunk %s is convergently encrypted but no convergence secret is available", StorageKey(ref))
+		}
+		decrypted, err := cc.DecryptChunk(ref.Hash, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt chunk %s: %v", StorageKey(ref), err)
+		}
+		data = decrypted
+	} else if opts.Cipher != nil {
+		decrypted, err := opts.Cipher.Decrypt(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt chunk %s: %v", StorageKey(ref), err)
+		}
+		data = decrypted
+	}
+
+	if ref.Compressed {
+		// Use the compression recorded in the ref; the vault setting may have changed since
+		compressionType := ref.CompressionType
+		if compressionType == "" {
+			compressionType = opts.compression()
+		}
+		var decompressed []byte
+		var err error
+		limit := decompressionLimit(ref)
+		if ref.CompressionDict != "" {
+			decompressed, err = decompressWithDictionary(ref, data, limit, opts)
+		} else {
+			decompressed, err = compression.DecompressDataLimit(data, compressionType, limit)
+		}
+		if errors.Is(err, compression.ErrDecompressionBomb) {
+			return nil, fmt.Errorf("%w: chunk %s is recorded as %d bytes, refusing it as a possible decompression bomb", ErrChunkTooLarge, StorageKey(ref), ref.Size)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress chunk %s: %v", StorageKey(ref), err)
+		}
+		data = decompressed
+	}
+
+	if ref.Hash != "" && !opts.SkipHashCheck {
+		hasher, err := chunk.CreateHasher(opts.HashAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		hasher.Write(data)
+		if actual := fmt.Sprintf("%x", hasher.Sum(nil)); actual != ref.Hash {
+			return nil, fmt.Errorf("integrity check failed for chunk %s", StorageKey(ref))
+		}
+	}
+	return data, nil
+}
+
+// CheckStored checks data stored for ref without needing the vault key: an
+// encrypted chunk must hash to its EncryptedHash, any other chunk is decoded
+// and its plaintext hash compared. Only the hash algorithm and dictionaries of
+// opts are used.
+func CheckStored(ref ChunkRef, stored []byte, opts Options) error {
+	if ref.EncryptedHash == "" {
+		opts.Cipher, opts.SkipHashCheck = nil, false
+		_, err := Decode(ref, stored, opts)
+		return err
+	}
+	hasher, err := chunk.CreateHasher(opts.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	hasher.Write(stored)
+	if actual := fmt.Sprintf("%x", hasher.Sum(nil)); actual != ref.EncryptedHash {
+		return fmt.Errorf("integrity check failed for chunk %s", StorageKey(ref))
+	}
+	return nil
+}
+
+// decompressionLimit returns how large a chunk may decompress: its recorded size
+// and some slack, or the global cap for references without a size
+func decompressionLimit(ref ChunkRef) int {
+	if ref.Size <= 0 || ref.Size > constants.MaxDecompressionSize {
+		return constants.MaxDecompressionSize
+	}
+	return int(ref.Size) + constants.DecompressionSlack
+}
+
+func decompressWithDictionary(ref ChunkRef, data []byte, limit int, opts Options) ([]byte, error) {
+	if opts.Dictionaries == nil {
+		return nil, fmt.Errorf("compressed with dictionary %s but no dictionaries are available", ref.CompressionDict)
+	}
+	dict, err := opts.Dictionaries.Dictionary(ref.CompressionDict)
+	if err != nil {
+		return nil, err
+	}
+	return compression.DecompressWithDictionaryLimit(data, dict, limit)
+}
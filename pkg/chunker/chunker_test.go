@@ -0,0 +1,546 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/encryption/convergent"
+)
+
+// xorCipher is a reversible stand-in for the vault cipher
+type xorCipher struct{ key byte }
+
+func (c xorCipher) Encrypt(plaintext []byte) ([]byte, error) { return c.xor(plaintext), nil }
+func (c xorCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, errors.New("empty ciphertext")
+	}
+	return c.xor(ciphertext), nil
+}
+
+func (c xorCipher) xor(in []byte) []byte {
+	out := make([]byte, len(in))
+	for i, b := range in {
+		out[i] = b ^ c.key
+	}
+	return out
+}
+
+// convergentTestCipher encrypts convergently while enabled, otherwise like xorCipher
+type convergentTestCipher struct {
+	xorCipher
+	*convergent.Cipher
+	enabled bool
+}
+
+func (c convergentTestCipher) Convergent() bool { return c.enabled }
+
+func randomData(t testing.TB, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+// textData returns size bytes of compressible text
+func textData(size int) []byte {
+	words := strings.Fields("chunk vault peer sync manifest hash key passphrase config error info the a of to")
+	rng := rand.New(rand.NewSource(int64(size)))
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.WriteString(words[rng.Intn(len(words))])
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()[:size]
+}
+
+func readAll(t *testing.T, store ChunkStore, refs []ChunkRef, opts Options) []byte {
+	t.Helper()
+	got, err := io.ReadAll(NewReader(store, refs, opts))
+	if err != nil {
+		t.Fatalf("Reader error: %v", err)
+	}
+	return got
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "defaults", opts: Options{ChunkSize: 1024}},
+		{name: "gzip", opts: Options{ChunkSize: 1024, Compression: "gzip"}},
+		{name: "zstd encrypted", opts: Options{ChunkSize: 1024, Compression: "zstd", Cipher: xorCipher{key: 0x5a}}},
+		{name: "cdc blake3", opts: Options{Strategy: "cdc", ChunkSize: 1024, HashAlgorithm: "blake3"}},
+		{name: "brotli parallel", opts: Options{ChunkSize: 1024, Compression: "brotli", Cipher: xorCipher{key: 0x5a}, Jobs: 4}},
+	}
+
+	data := randomData(t, 10*1024+17)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			refs, err := Split(context.Background(), bytes.NewReader(data), store, tt.opts)
+			if err != nil {
+				t.Fatalf("Split() error: %v", err)
+			}
+			if len(refs) < 2 {
+				t.Fatalf("expected several chunks, got %d", len(refs))
+			}
+			if tt.opts.Cipher != nil && refs[0].EncryptedHash == "" {
+				t.Error("expected encrypted chunks to record an EncryptedHash")
+			}
+			if got := readAll(t, store, refs, tt.opts); !bytes.Equal(got, data) {
+				t.Errorf("reassembled %d bytes, want %d identical bytes", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestIncompressibleChunksAreStoredRaw(t *testing.T) {
+	// One compressible chunk followed by one random (incompressible) chunk
+	data := append(bytes.Repeat([]byte("sietch "), 1024)[:4096], randomData(t, 4096)...)
+	for _, opts := range []Options{
+		{ChunkSize: 4096, Compression: "zstd"},
+		{ChunkSize: 4096, Compression: "gzip", Cipher: xorCipher{key: 0x5a}},
+	} {
+		t.Run(opts.Compression, func(t *testing.T) {
+			store := NewMemoryStore()
+			refs, err := Split(context.Background(), bytes.NewReader(data), store, opts)
+			if err != nil {
+				t.Fatalf("Split() error: %v", err)
+			}
+			if !refs[0].Compressed || refs[0].Incompressible || refs[0].CompressionType != opts.Compression {
+				t.Errorf("compressible chunk = %+v, want it compressed", refs[0])
+			}
+			if refs[1].Compressed || !refs[1].Incompressible || refs[1].CompressedSize != 4096 {
+				t.Errorf("random chunk = %+v, want it stored raw", refs[1])
+			}
+			if got := readAll(t, store, refs, opts); !bytes.Equal(got, data) {
+				t.Error("mixed raw and compressed chunks did not read back")
+			}
+		})
+	}
+
+	// Hex text compresses by a little under half: enough for the default
+	// threshold, not for a 60% one
+	hexData := []byte(hex.EncodeToString(randomData(t, 2048)))
+	if ref, _, _ := Encode(hexData, 0, Options{Compression: "gzip"}); !ref.Compressed {
+		t.Errorf("Encode() with the default threshold = %+v, want the chunk compressed", ref)
+	}
+	ref, encoded, err := Encode(hexData, 0, Options{Compression: "gzip", MinSavings: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Compressed || !ref.Incompressible || !bytes.Equal(encoded, hexData) {
+		t.Errorf("Encode() with a 60%% threshold = %+v, want the chunk stored raw", ref)
+	}
+}
+
+// dictionaryMap is a DictionarySource over dictionaries held in memory
+type dictionaryMap map[string][]byte
+
+func (m dictionaryMap) Dictionary(id string) ([]byte, error) {
+	if data, ok := m[id]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("dictionary %s not found", id)
+}
+
+func TestDictionaryCompression(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 50; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"id": %d, "kind": "setting", "value": "enabled", "owner": "user-%d"}`, i, i*7)))
+	}
+	data, err := compression.TrainDictionary(samples, 8*1024, 0x00c0ffee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := &compression.Dictionary{ID: "00c0ffee", Data: data}
+
+	opts := Options{Compression: "gzip", Cipher: xorCipher{key: 0x21}, Dictionary: dict, Dictionaries: dictionaryMap{dict.ID: data}}
+	if err := opts.UseDictionary(""); err != nil || opts.Dictionary != nil {
+		t.Fatalf("UseDictionary(\"\") = %v, left %v", err, opts.Dictionary)
+	}
+	if err := opts.UseDictionary(dict.ID); err != nil || opts.Dictionary == nil {
+		t.Fatalf("UseDictionary() = %v", err)
+	}
+
+	file := []byte(`{"id": 99, "kind": "setting", "value": "enabled", "owner": "user-693"}`)
+	ref, encoded, err := Encode(file, 0, opts)
+	if err != nil {
+		t.Fatalf("Encode() error: %v", err)
+	}
+	if !ref.Compressed || ref.CompressionType != "zstd" || ref.CompressionDict != dict.ID {
+		t.Fatalf("Encode() ref = %+v, want zstd with dictionary %s", ref, dict.ID)
+	}
+	got, err := Decode(ref, encoded, opts)
+	if err != nil || !bytes.Equal(got, file) {
+		t.Fatalf("Decode() = %q, %v", got, err)
+	}
+	if _, err := Decode(ref, encoded, Options{Cipher: opts.Cipher}); err == nil {
+		t.Error("Decode() without the dictionary succeeded")
+	}
+
+	// Data the dictionary cannot shrink is stored raw, without a dictionary
+	ref, _, err = Encode(randomData(t, 1024), 0, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Compressed || ref.CompressionDict != "" {
+		t.Errorf("Encode(random) ref = %+v, want it stored raw", ref)
+	}
+}
+
+func TestSplitEmptyInput(t *testing.T) {
+	refs, err := Split(context.Background(), bytes.NewReader(nil), NewMemoryStore(), Options{})
+	if err != nil || len(refs) != 0 {
+		t.Errorf("Split(empty) = %d refs, err %v; want none", len(refs), err)
+	}
+}
+
+func TestStoreWhole(t *testing.T) {
+	data := randomData(t, 3000)
+	opts := Options{ChunkSize: 1024, Compression: "gzip", Cipher: xorCipher{key: 0x33}}
+	store := NewMemoryStore()
+	refs, err := StoreWhole(bytes.NewReader(data), store, opts)
+	if err != nil {
+		t.Fatalf("StoreWhole() error: %v", err)
+	}
+	if len(refs) != 1 || refs[0].Size != int64(len(data)) || store.Len() != 1 {
+		t.Fatalf("StoreWhole() = %d refs, %d stored; want one chunk of the whole file", len(refs), store.Len())
+	}
+	if got := readAll(t, store, refs, opts); !bytes.Equal(got, data) {
+		t.Error("whole file did not round-trip")
+	}
+
+	if refs, err := StoreWhole(bytes.NewReader(nil), store, opts); err != nil || len(refs) != 0 {
+		t.Errorf("StoreWhole(empty) = %d refs, err %v; want none", len(refs), err)
+	}
+}
+
+func TestZeroChunksAreNotStored(t *testing.T) {
+	data := append(make([]byte, 2048), randomData(t, 1024)...)
+	store := NewMemoryStore()
+	refs, err := Split(context.Background(), bytes.NewReader(data), store, Options{ChunkSize: 1024})
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+	if !refs[0].Zero || !refs[1].Zero || refs[2].Zero {
+		t.Errorf("unexpected zero flags: %v %v %v", refs[0].Zero, refs[1].Zero, refs[2].Zero)
+	}
+	if store.Len() != 1 {
+		t.Errorf("expected only the non-zero chunk to be stored, got %d", store.Len())
+	}
+
+	ref, chunk, err := NewReader(store, refs, Options{}).Next()
+	if err != nil || !ref.Zero || chunk != nil {
+		t.Errorf("Next() on a zero chunk = %v, %d bytes, %v; want zero ref with nil data", ref.Zero, len(chunk), err)
+	}
+	if got := readAll(t, store, refs, Options{}); !bytes.Equal(got, data) {
+		t.Error("zero chunks were not reproduced")
+	}
+}
+
+func TestDuplicateChunksAreDeduplicated(t *testing.T) {
+	block := randomData(t, 1024)
+	data := bytes.Repeat(block, 3)
+	store := NewMemoryStore()
+	refs, err := Split(context.Background(), bytes.NewReader(data), store, Options{ChunkSize: 1024})
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+	if store.Len() != 1 {
+		t.Errorf("expected 1 stored chunk, got %d", store.Len())
+	}
+	if refs[0].Deduplicated || !refs[1].Deduplicated || !refs[2].Deduplicated {
+		t.Error("expected the repeated chunks to be marked Deduplicated")
+	}
+}
+
+func TestConvergentChunksEncryptIdentically(t *testing.T) {
+	data := randomData(t, 4*1024)
+	secret := bytes.Repeat([]byte{7}, 32)
+	split := func(cipher Cipher) ([]ChunkRef, *MemoryStore) {
+		store := NewMemoryStore()
+		refs, err := Split(context.Background(), bytes.NewReader(data), store, Options{ChunkSize: 1024, Cipher: cipher})
+		if err != nil {
+			t.Fatalf("Split() error: %v", err)
+		}
+		return refs, store
+	}
+
+	// Two vaults with different vault keys but the same secret store identical chunks
+	first, store := split(convergentTestCipher{xorCipher{1}, convergent.NewCipher(secret), true})
+	second, _ := split(convergentTestCipher{xorCipher{2}, convergent.NewCipher(secret), true})
+	for i := range first {
+		if !first[i].Convergent || first[i].EncryptedHash != second[i].EncryptedHash {
+			t.Fatalf("chunk %d: convergent %v, encrypted hashes %s and %s", i, first[i].Convergent, first[i].EncryptedHash, second[i].EncryptedHash)
+		}
+	}
+	other, _ := split(convergentTestCipher{xorCipher{1}, convergent.NewCipher(bytes.Repeat([]byte{8}, 32)), true})
+	if other[0].EncryptedHash == first[0].EncryptedHash {
+		t.Error("a different secret produced the same ciphertext")
+	}
+
+	// Convergent chunks stay readable after the mode is turned off, but not without the secret
+	disabled := convergentTestCipher{xorCipher{1}, convergent.NewCipher(secret), false}
+	if got := readAll(t, store, first, Options{ChunkSize: 1024, Cipher: disabled}); !bytes.Equal(got, data) {
+		t.Error("convergent chunks did not round-trip")
+	}
+	if refs, _ := split(disabled); refs[0].Convergent {
+		t.Error("chunk encrypted convergently with the mode disabled")
+	}
+	encoded, _ := store.Get(first[0])
+	if _, err := Decode(first[0], encoded, Options{Cipher: xorCipher{1}}); err == nil {
+		t.Error("Decode() of a convergent chunk without the secret succeeded")
+	}
+}
+
+func TestReaderDetectsCorruption(t *testing.T) {
+	store := NewMemoryStore()
+	opts := Options{ChunkSize: 1024}
+	refs, err := Split(context.Background(), bytes.NewReader(randomData(t, 1024)), store, opts)
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+	store.chunks[StorageKey(refs[0])][0] ^= 0xff
+
+	if _, err := io.ReadAll(NewReader(store, refs, opts)); err == nil {
+		t.Error("expected an integrity error for a corrupted chunk")
+	}
+
+	// Reads that opt out of the check get the stored bytes as they are
+	opts.SkipHashCheck = true
+	if data, err := io.ReadAll(NewReader(store, refs, opts)); err != nil || len(data) != 1024 {
+		t.Errorf("ReadAll() with SkipHashCheck = %d bytes, %v; want the corrupted chunk", len(data), err)
+	}
+	if err := CheckStored(refs[0], store.chunks[StorageKey(refs[0])], opts); err == nil {
+		t.Error("CheckStored() honoured SkipHashCheck")
+	}
+}
+
+func TestCheckStored(t *testing.T) {
+	for _, cipher := range []Cipher{nil, xorCipher{key: 0x5a}} {
+		t.Run(fmt.Sprintf("cipher=%v", cipher != nil), func(t *testing.T) {
+			store := NewMemoryStore()
+			opts := Options{ChunkSize: 1024, Compression: "gzip", Cipher: cipher}
+			refs, err := Split(context.Background(), bytes.NewReader(textData(2048)), store, opts)
+			if err != nil {
+				t.Fatalf("Split() error: %v", err)
+			}
+			stored, _ := store.Get(refs[0])
+
+			// The key is never needed
+			if err := CheckStored(refs[0], stored, Options{}); err != nil {
+				t.Errorf("CheckStored() refused an intact chunk: %v", err)
+			}
+			if err := CheckStored(refs[0], bytes.Clone(stored[1:]), Options{}); err == nil {
+				t.Error("CheckStored() accepted a truncated chunk")
+			}
+			if other, _ := store.Get(refs[1]); CheckStored(refs[0], other, Options{}) == nil {
+				t.Error("CheckStored() accepted another chunk's data")
+			}
+		})
+	}
+}
+
+func TestReaderRefusesDecompressionBombs(t *testing.T) {
+	for _, algorithm := range []string{"gzip", "zstd"} {
+		t.Run(algorithm, func(t *testing.T) {
+			store := NewMemoryStore()
+			cipher := xorCipher{key: 0x5a}
+			opts := Options{ChunkSize: 4096, Compression: algorithm, Cipher: cipher}
+			refs, err := Split(context.Background(), bytes.NewReader(bytes.Repeat([]byte("sietch "), 1024)), store, opts)
+			if err != nil {
+				t.Fatalf("Split() error: %v", err)
+			}
+
+			// A peer swaps the first chunk for 64MB of zeros compressed to a few KB
+			bomb, err := compression.CompressData(make([]byte, 64<<20), algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := StorageKey(refs[0])
+			store.chunks[key], _ = cipher.Encrypt(bomb)
+
+			_, err = io.ReadAll(NewReader(store, refs, opts))
+			if !errors.Is(err, ErrChunkTooLarge) || !strings.Contains(err.Error(), key) {
+				t.Errorf("Reader error = %v, want ErrChunkTooLarge naming chunk %s", err, key)
+			}
+		})
+	}
+}
+
+func TestReaderMissingChunk(t *testing.T) {
+	refs, err := Split(context.Background(), bytes.NewReader(randomData(t, 100)), NewMemoryStore(), Options{})
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+	if _, _, err := NewReader(NewMemoryStore(), refs, Options{}).Next(); err == nil || errors.Is(err, ErrChunkNotLocal) {
+		t.Errorf("Next() error = %v, want a missing chunk error", err)
+	}
+
+	// A remote chunk that was never fetched asks for a sync
+	refs[0].Remote = true
+	if _, _, err := NewReader(NewMemoryStore(), refs, Options{}).Next(); !errors.Is(err, ErrChunkNotLocal) {
+		t.Errorf("Next() error = %v, want ErrChunkNotLocal", err)
+	}
+}
+
+func TestSplitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Split(ctx, bytes.NewReader(randomData(t, 100)), NewMemoryStore(), Options{}); err == nil {
+		t.Error("expected Split to stop on a cancelled context")
+	}
+}
+
+func TestSplitParallelMatchesSequential(t *testing.T) {
+	// Compressible and zero chunks encode at different speeds, so parallel
+	// encoders finish out of order
+	data := append(textData(6*1024), make([]byte, 2048)...)
+	data = append(data, randomData(t, 3000)...)
+	opts := Options{ChunkSize: 512, Compression: "zstd", Cipher: xorCipher{key: 0x5a}}
+
+	sequentialStore := NewMemoryStore()
+	want, err := Split(context.Background(), bytes.NewReader(data), sequentialStore, opts)
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+	for _, jobs := range []int{2, 3, 16} {
+		t.Run(fmt.Sprintf("jobs-%d", jobs), func(t *testing.T) {
+			opts := opts
+			opts.Jobs = jobs
+			var reported []int
+			opts.OnChunk = func(ref ChunkRef) { reported = append(reported, ref.Index) }
+
+			store := NewMemoryStore()
+			got, err := Split(context.Background(), bytes.NewReader(data), store, opts)
+			if err != nil {
+				t.Fatalf("Split() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parallel refs differ from sequential ones:\n%+v\n%+v", got, want)
+			}
+			for i, index := range reported {
+				if index != i {
+					t.Fatalf("OnChunk saw chunks in order %v", reported)
+				}
+			}
+			if !bytes.Equal(readAll(t, store, got, opts), data) {
+				t.Error("parallel split did not read back")
+			}
+		})
+	}
+
+	// Store failures stop the split
+	if _, err := Split(context.Background(), bytes.NewReader(data), failingStore{}, Options{ChunkSize: 512, Jobs: 4}); err == nil {
+		t.Error("expected the store failure to be reported")
+	}
+}
+
+// BenchmarkSplitJobs measures add throughput with brotli, whose encoder is slow
+// enough for parallel workers to matter, at several --jobs values. Run with:
+//
+//	go test ./pkg/chunker -run ^$ -bench SplitJobs
+func BenchmarkSplitJobs(b *testing.B) {
+	data := textData(8 * 1024 * 1024)
+	for _, level := range []int{0, 9} {
+		for _, jobs := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("brotli-%d/jobs-%d", level, jobs), func(b *testing.B) {
+				opts := Options{ChunkSize: 1024 * 1024, Compression: "brotli", Level: level, Jobs: jobs}
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					if _, err := Split(context.Background(), bytes.NewReader(data), NewMemoryStore(), opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWriterMatchesSplit(t *testing.T) {
+	data := randomData(t, 5000)
+	opts := Options{ChunkSize: 1024, Compression: "gzip"}
+
+	want, err := Split(context.Background(), bytes.NewReader(data), NewMemoryStore(), opts)
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+
+	store := NewMemoryStore()
+	w := NewWriter(store, opts)
+	for i := 0; i < len(data); i += 333 {
+		end := min(i+333, len(data))
+		if _, err := w.Write(data[i:end]); err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	got := w.Refs()
+	if len(got) != len(want) {
+		t.Fatalf("Writer produced %d chunks, Split %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Hash != want[i].Hash || got[i].Size != want[i].Size {
+			t.Errorf("chunk %d differs: %+v vs %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWriterReportsStoreErrors(t *testing.T) {
+	w := NewWriter(failingStore{}, Options{ChunkSize: 16})
+	_, writeErr := w.Write(randomData(t, 64))
+	closeErr := w.Close()
+	if writeErr == nil && closeErr == nil {
+		t.Error("expected the store failure to be reported")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Put(ref ChunkRef, data []byte) (ChunkRef, error) {
+	return ref, errors.New("disk full")
+}
+
+func (failingStore) Get(ref ChunkRef) ([]byte, error) {
+	return nil, errors.New("not found")
+}
+
+func TestVerifyContent(t *testing.T) {
+	data := randomData(t, 5000)
+	opts := Options{ChunkSize: 1024, Cipher: xorCipher{key: 0x11}}
+	store := NewMemoryStore()
+	refs, err := Split(context.Background(), bytes.NewReader(data), store, opts)
+	if err != nil {
+		t.Fatalf("Split() error: %v", err)
+	}
+	if err := VerifyContent(bytes.NewReader(data), store, refs, opts); err != nil {
+		t.Errorf("VerifyContent() error: %v", err)
+	}
+
+	changed := append([]byte(nil), data...)
+	changed[4999] ^= 1
+	if err := VerifyContent(bytes.NewReader(changed), store, refs, opts); err == nil {
+		t.Error("VerifyContent() accepted a source that differs from the stored data")
+	}
+	if err := VerifyContent(bytes.NewReader(data), store, refs[:len(refs)-1], opts); err == nil {
+		t.Error("VerifyContent() accepted a truncated chunk list")
+	}
+	if err := VerifyContent(bytes.NewReader(data), NewMemoryStore(), refs, opts); err == nil {
+		t.Error("VerifyContent() accepted chunks missing from the store")
+	}
+}
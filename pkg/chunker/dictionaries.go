@@ -0,0 +1,95 @@
+package chunker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// SaveDictionary stores a compression dictionary in the vault. Dictionaries are
+// built from file content, so they are encrypted with opts.Cipher like chunks.
+func SaveDictionary(vaultRoot string, dict compression.Dictionary, opts Options) error {
+	data := dict.Data
+	if opts.Cipher != nil {
+		encrypted, err := opts.Cipher.Encrypt(dict.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt dictionary %s: %v", dict.ID, err)
+		}
+		data = encrypted
+	}
+	path := layout.DictionaryPath(vaultRoot, dict.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create compression directory: %v", err)
+	}
+	if err := atomic.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write dictionary %s: %v", dict.ID, err)
+	}
+	return nil
+}
+
+// LoadDictionary reads a compression dictionary stored in the vault
+func LoadDictionary(vaultRoot string, id string, opts Options) (*compression.Dictionary, error) {
+	data, err := os.ReadFile(layout.DictionaryPath(vaultRoot, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("compression dictionary %s not found; run 'sietch sync' to fetch it", id)
+		}
+		return nil, fmt.Errorf("failed to read dictionary %s: %v", id, err)
+	}
+	if opts.Cipher != nil {
+		if data, err = opts.Cipher.Decrypt(data); err != nil {
+			return nil, fmt.Errorf("failed to decrypt dictionary %s: %v", id, err)
+		}
+	}
+	return &compression.Dictionary{ID: id, Data: data}, nil
+}
+
+// UseDictionary makes new chunks compress with dictionary id, loaded through
+// o.Dictionaries. An empty id clears the dictionary.
+func (o *Options) UseDictionary(id string) error {
+	if id == "" {
+		o.Dictionary = nil
+		return nil
+	}
+	if o.Dictionaries == nil {
+		return fmt.Errorf("no dictionaries available to load dictionary %s from", id)
+	}
+	data, err := o.Dictionaries.Dictionary(id)
+	if err != nil {
+		return err
+	}
+	o.Dictionary = &compression.Dictionary{ID: id, Data: data}
+	return nil
+}
+
+// vaultDictionaries loads the dictionaries chunks were compressed with from
+// the vault, keeping each one after its first use
+type vaultDictionaries struct {
+	vaultRoot string
+	opts      Options
+
+	mu     sync.Mutex
+	loaded map[string][]byte
+}
+
+func (d *vaultDictionaries) Dictionary(id string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if data, ok := d.loaded[id]; ok {
+		return data, nil
+	}
+	dict, err := LoadDictionary(d.vaultRoot, id, d.opts)
+	if err != nil {
+		return nil, err
+	}
+	if d.loaded == nil {
+		d.loaded = make(map[string][]byte)
+	}
+	d.loaded[id] = dict.Data
+	return dict.Data, nil
+}
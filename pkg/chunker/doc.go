@@ -0,0 +1,26 @@
+// Package chunker is Sietch's public chunking pipeline: it splits a byte stream
+// into chunks, compresses and optionally encrypts each one, and describes the
+// result as ChunkRef values that can later be reassembled.
+//
+// The pipeline per chunk is:
+//
+//	split (fixed/cdc) → hash plaintext → compress → encrypt → ChunkStore.Put
+//
+// and the reverse on read:
+//
+//	ChunkStore.Get → decrypt → decompress → verify hash
+//
+// A Cipher that also implements ConvergentCipher may encrypt chunks under a key
+// derived from their plaintext hash instead; such chunks are marked Convergent
+// and encrypt identically wherever the same secret is used.
+//
+// All-zero chunks are never stored; they are recorded as ChunkRef{Zero: true}
+// and reproduced on read. Writer accepts bytes through io.Writer and Reader
+// implements io.Reader, so files of any size can be processed without being
+// held in memory. Storage is pluggable through the ChunkStore interface;
+// MemoryStore and VaultStore are provided. Readers given a Cache keep decrypted
+// chunks in memory, so repeated reads skip the store and the cipher.
+//
+// This package is what `sietch add` and `sietch get` use, so chunks written
+// with options from VaultOptions are readable by the CLI and vice versa.
+package chunker
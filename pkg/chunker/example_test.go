@@ -0,0 +1,51 @@
+package chunker_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/pkg/chunker"
+)
+
+func ExampleWriter() {
+	store := chunker.NewMemoryStore()
+	w := chunker.NewWriter(store, chunker.Options{ChunkSize: 4, Compression: "gzip"})
+
+	fmt.Fprint(w, "abcdabcdxy")
+	if err := w.Close(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, ref := range w.Refs() {
+		fmt.Printf("chunk %d: %d bytes, deduplicated=%v\n", ref.Index, ref.Size, ref.Deduplicated)
+	}
+	fmt.Println("stored:", store.Len())
+	// Output:
+	// chunk 0: 4 bytes, deduplicated=false
+	// chunk 1: 4 bytes, deduplicated=true
+	// chunk 2: 2 bytes, deduplicated=false
+	// stored: 2
+}
+
+func ExampleReader() {
+	store := chunker.NewMemoryStore()
+	opts := chunker.Options{ChunkSize: 8}
+
+	refs, err := chunker.Split(context.Background(), strings.NewReader("reassembled from chunks"), store, opts)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	data, err := io.ReadAll(chunker.NewReader(store, refs, opts))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%d chunks: %s\n", len(refs), data)
+	// Output:
+	// 3 chunks: reassembled from chunks
+}
@@ -0,0 +1,100 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+// FuzzWriterBoundaries checks that chunk boundaries depend only on the data:
+// feeding the same bytes to a Writer in arbitrary pieces must give the same
+// chunks as Split, with every chunk but the last exactly ChunkSize long.
+func FuzzWriterBoundaries(f *testing.F) {
+	f.Add([]byte("hello world"), uint8(4), uint8(3))
+	f.Add(make([]byte, 100), uint8(16), uint8(7))
+	f.Add(bytes.Repeat([]byte("ab"), 64), uint8(1), uint8(1))
+	f.Add([]byte{}, uint8(8), uint8(2))
+
+	f.Fuzz(func(t *testing.T, data []byte, chunkSize uint8, step uint8) {
+		opts := Options{ChunkSize: int64(chunkSize%64) + 1}
+		pieceSize := int(step%32) + 1
+
+		want, err := Split(context.Background(), bytes.NewReader(data), NewMemoryStore(), opts)
+		if err != nil {
+			t.Fatalf("Split() error: %v", err)
+		}
+
+		store := NewMemoryStore()
+		w := NewWriter(store, opts)
+		for i := 0; i < len(data); i += pieceSize {
+			if _, err := w.Write(data[i:min(i+pieceSize, len(data))]); err != nil {
+				t.Fatalf("Write() error: %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error: %v", err)
+		}
+		got := w.Refs()
+
+		if len(got) != len(want) {
+			t.Fatalf("Writer produced %d chunks, Split %d", len(got), len(want))
+		}
+		var total int64
+		for i, ref := range got {
+			if ref.Hash != want[i].Hash || ref.Size != want[i].Size || ref.Index != i {
+				t.Fatalf("chunk %d: got %+v, want %+v", i, ref, want[i])
+			}
+			if i < len(got)-1 && ref.Size != opts.ChunkSize {
+				t.Fatalf("chunk %d has size %d, want %d", i, ref.Size, opts.ChunkSize)
+			}
+			total += ref.Size
+		}
+		if total != int64(len(data)) {
+			t.Fatalf("chunks cover %d bytes, input has %d", total, len(data))
+		}
+
+		out, err := io.ReadAll(NewReader(store, got, opts))
+		if err != nil {
+			t.Fatalf("Reader error: %v", err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatal("reassembled data differs from input")
+		}
+	})
+}
+
+// FuzzCDCRoundTrip checks that content-defined chunks always cover the input
+// exactly and reassemble to it
+func FuzzCDCRoundTrip(f *testing.F) {
+	f.Add([]byte("the quick brown fox jumps over the lazy dog"), uint16(64))
+	f.Add(make([]byte, 4096), uint16(512))
+
+	f.Fuzz(func(t *testing.T, data []byte, chunkSize uint16) {
+		opts := Options{Strategy: "cdc", ChunkSize: int64(chunkSize%4096) + 64, Compression: "gzip", Cipher: xorCipher{key: 0x42}}
+		store := NewMemoryStore()
+		refs, err := Split(context.Background(), bytes.NewReader(data), store, opts)
+		if err != nil {
+			t.Fatalf("Split() error: %v", err)
+		}
+
+		var total int64
+		for _, ref := range refs {
+			if ref.Size <= 0 {
+				t.Fatalf("chunk %d is empty", ref.Index)
+			}
+			total += ref.Size
+		}
+		if total != int64(len(data)) {
+			t.Fatalf("chunks cover %d bytes, input has %d", total, len(data))
+		}
+
+		out, err := io.ReadAll(NewReader(store, refs, opts))
+		if err != nil {
+			t.Fatalf("Reader error: %v", err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatal("reassembled data differs from input")
+		}
+	})
+}
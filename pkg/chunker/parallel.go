@@ -0,0 +1,86 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+)
+
+// encoded is the outcome of encoding one chunk
+type encoded struct {
+	ref  ChunkRef
+	data []byte
+	err  error
+}
+
+// splitParallel is Split with up to opts.Jobs chunks compressed and encrypted
+// at once. Chunks are still stored, and reported to OnChunk, in order, so the
+// result is the same as a sequential split.
+func splitParallel(ctx context.Context, splitter chunk.Chunker, store ChunkStore, opts Options) ([]ChunkRef, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each chunk read gets its own result channel, queued in read order. The
+	// queue holds Jobs-1 chunks besides the one being waited on, which bounds
+	// both the encoders running and the chunks held in memory.
+	pending := make(chan chan encoded, opts.Jobs-1)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		for {
+			next, err := splitter.Next()
+			if err != nil {
+				if err != io.EOF {
+					readErr <- err
+				}
+				return
+			}
+			// The splitter reuses its buffer for the next chunk
+			data := bytes.Clone(next.Data)
+			result := make(chan encoded, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				ref, encodedData, err := encodeChunk(data, next.Hash, next.Index, opts)
+				result <- encoded{ref: ref, data: encodedData, err: err}
+			}()
+		}
+	}()
+
+	refs := []ChunkRef{}
+	for result := range pending {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("operation cancelled")
+		default:
+		}
+
+		out := <-result
+		if out.err != nil {
+			return nil, fmt.Errorf("chunk %d: %v", len(refs)+1, out.err)
+		}
+		ref := out.ref
+		if !ref.Zero {
+			var err error
+			if ref, err = store.Put(ref, out.data); err != nil {
+				return nil, fmt.Errorf("failed to store chunk %d: %v", len(refs)+1, err)
+			}
+		}
+		if opts.OnChunk != nil {
+			opts.OnChunk(ref)
+		}
+		refs = append(refs, ref)
+	}
+	select {
+	case err := <-readErr:
+		return nil, err
+	default:
+	}
+	return refs, nil
+}
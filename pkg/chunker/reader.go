@@ -0,0 +1,111 @@
+package chunker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+)
+
+// ErrChunkNotLocal is returned when reading a chunk that was recorded as held by
+// another vault (from dedup hints) and has not been fetched yet
+var ErrChunkNotLocal = errors.New("chunk not local, run 'sietch sync' to fetch it")
+
+// Reader reassembles a file from its chunk references
+type Reader struct {
+	store ChunkStore
+	refs  []ChunkRef
+	opts  Options
+	next  int
+	buf   []byte
+}
+
+// NewReader returns a Reader over refs, fetching chunks from store. opts must
+// match the options the chunks were written with (the cipher in particular).
+func NewReader(store ChunkStore, refs []ChunkRef, opts Options) *Reader {
+	return &Reader{store: store, refs: refs, opts: opts}
+}
+
+// Next returns the next chunk's reference and verified plaintext, or io.EOF
+// after the last chunk. Zero chunks are returned with nil data so callers can
+// write a hole instead of ref.Size zero bytes. Data may come from opts.Cache and
+// must not be modified.
+func (r *Reader) Next() (ChunkRef, []byte, error) {
+	if r.next >= len(r.refs) {
+		return ChunkRef{}, nil, io.EOF
+	}
+	ref := r.refs[r.next]
+	r.next++
+
+	if ref.Zero {
+		return ref, nil, nil
+	}
+	if data, ok := r.opts.Cache.Get(ref.Hash); ok {
+		return ref, data, nil
+	}
+
+	encoded, err := r.store.Get(ref)
+	if err != nil {
+		if ref.Remote {
+			return ChunkRef{}, nil, fmt.Errorf("%w: %s", ErrChunkNotLocal, StorageKey(ref))
+		}
+		return ChunkRef{}, nil, err
+	}
+	if len(encoded) == 0 && r.opts.Cipher != nil {
+		return ChunkRef{}, nil, fmt.Errorf("chunk %s is empty", StorageKey(ref))
+	}
+	data, err := Decode(ref, encoded, r.opts)
+	if err != nil {
+		return ChunkRef{}, nil, err
+	}
+	r.opts.Cache.Add(ref.Hash, data)
+	return ref, data, nil
+}
+
+// Read implements io.Reader, producing the original file content
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		ref, data, err := r.Next()
+		if err != nil {
+			return 0, err
+		}
+		if ref.Zero {
+			data = make([]byte, ref.Size)
+		}
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// VerifyContent reads refs back from store and checks that they reassemble to
+// exactly the content of source. Every chunk is also verified against its hash
+// on the way. opts.Cache should be nil so that the stored data is really read.
+func VerifyContent(source io.Reader, store ChunkStore, refs []ChunkRef, opts Options) error {
+	want, wantSize, err := hashStream(source, opts.HashAlgorithm)
+	if err != nil {
+		return fmt.Errorf("failed to read source: %v", err)
+	}
+	got, gotSize, err := hashStream(NewReader(store, refs, opts), opts.HashAlgorithm)
+	if err != nil {
+		return fmt.Errorf("failed to read back stored chunks: %v", err)
+	}
+	if gotSize != wantSize || got != want {
+		return fmt.Errorf("stored content (%d bytes, hash %s) does not match the source (%d bytes, hash %s)", gotSize, got, wantSize, want)
+	}
+	return nil
+}
+
+func hashStream(r io.Reader, algorithm string) (string, int64, error) {
+	hasher, err := chunk.CreateHasher(algorithm)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := io.Copy(hasher, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), n, nil
+}
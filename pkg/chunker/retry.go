@@ -0,0 +1,131 @@
+package chunker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// RetryPolicy controls how failed chunk store operations are retried
+type RetryPolicy struct {
+	MaxRetries int           // Attempts after the first one; 0 disables retries
+	BaseDelay  time.Duration // Delay before the first retry, doubled for each one after it
+	MaxDelay   time.Duration // Longest delay between two attempts
+}
+
+// DefaultRetryPolicy rides out a few seconds of trouble on a network mount
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// RetryPolicyFromConfig returns the retry policy set in a vault's
+// configuration, with defaults for everything left unset
+func RetryPolicyFromConfig(retry config.StoreRetryConfig) (RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+	switch {
+	case retry.MaxRetries < 0:
+		policy.MaxRetries = 0
+	case retry.MaxRetries > 0:
+		policy.MaxRetries = retry.MaxRetries
+	}
+	if retry.BaseDelay != "" {
+		delay, err := time.ParseDuration(retry.BaseDelay)
+		if err != nil || delay <= 0 {
+			return RetryPolicy{}, fmt.Errorf("invalid store_retry.base_delay %q", retry.BaseDelay)
+		}
+		policy.BaseDelay = delay
+	}
+	if retry.MaxDelay != "" {
+		delay, err := time.ParseDuration(retry.MaxDelay)
+		if err != nil || delay <= 0 {
+			return RetryPolicy{}, fmt.Errorf("invalid store_retry.max_delay %q", retry.MaxDelay)
+		}
+		policy.MaxDelay = delay
+	}
+	return policy, nil
+}
+
+// Delay returns how long to wait before retry number attempt (starting at 1):
+// the base delay doubled for each earlier retry, capped at MaxDelay, of which
+// a random half is taken off so that concurrent clients spread out
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)))
+}
+
+// IsTransient reports whether a failed chunk store operation may succeed when
+// tried again. Missing chunks, permission errors and cancelled operations do not.
+func IsTransient(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, ErrChunkNotFound),
+		errors.Is(err, ErrChunkNotLocal),
+		errors.Is(err, os.ErrNotExist),
+		errors.Is(err, os.ErrPermission),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	return true
+}
+
+// RetryStore retries the failed operations of another ChunkStore with
+// exponential backoff. Chunks are content addressed, so writing one again
+// after a failed or half finished write stores the same data.
+type RetryStore struct {
+	store  ChunkStore
+	policy RetryPolicy
+	sleep  func(time.Duration)
+}
+
+// NewRetryStore wraps store so transient errors are retried under policy
+func NewRetryStore(store ChunkStore, policy RetryPolicy) *RetryStore {
+	return &RetryStore{store: store, policy: policy, sleep: time.Sleep}
+}
+
+// Put implements ChunkStore
+func (s *RetryStore) Put(ref ChunkRef, data []byte) (ChunkRef, error) {
+	var stored ChunkRef
+	err := s.retry("store", ref, func() error {
+		var err error
+		stored, err = s.store.Put(ref, data)
+		return err
+	})
+	return stored, err
+}
+
+// Get implements ChunkStore
+func (s *RetryStore) Get(ref ChunkRef) ([]byte, error) {
+	var data []byte
+	err := s.retry("read", ref, func() error {
+		var err error
+		data, err = s.store.Get(ref)
+		return err
+	})
+	return data, err
+}
+
+func (s *RetryStore) retry(operation string, ref ChunkRef, fn func() error) error {
+	err := fn()
+	for attempt := 1; attempt <= s.policy.MaxRetries && IsTransient(err); attempt++ {
+		s.sleep(s.policy.Delay(attempt))
+		err = fn()
+	}
+	if err != nil && IsTransient(err) && s.policy.MaxRetries > 0 {
+		return fmt.Errorf("failed to %s chunk %s after %d attempts: %w", operation, StorageKey(ref), s.policy.MaxRetries+1, err)
+	}
+	return err
+}
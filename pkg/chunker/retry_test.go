@@ -0,0 +1,125 @@
+package chunker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// flakyStore fails its first failures operations with err
+type flakyStore struct {
+	*MemoryStore
+	failures int
+	err      error
+	calls    int
+}
+
+func (s *flakyStore) fail() error {
+	s.calls++
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakyStore) Put(ref ChunkRef, data []byte) (ChunkRef, error) {
+	if err := s.fail(); err != nil {
+		return ChunkRef{}, err
+	}
+	return s.MemoryStore.Put(ref, data)
+}
+
+func (s *flakyStore) Get(ref ChunkRef) ([]byte, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.MemoryStore.Get(ref)
+}
+
+func TestRetryStore(t *testing.T) {
+	transient := errors.New("connection reset by peer")
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   string
+	}{
+		{name: "no failures", wantCalls: 1},
+		{name: "recovers", failures: 3, err: transient, wantCalls: 4},
+		{name: "gives up", failures: 10, err: transient, wantCalls: 4, wantErr: "after 4 attempts: connection reset by peer"},
+		{name: "missing chunk", failures: 10, err: fmt.Errorf("%w: abc", ErrChunkNotFound), wantCalls: 1, wantErr: "chunk not found: abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyStore{MemoryStore: NewMemoryStore(), failures: tt.failures, err: tt.err}
+			var slept []time.Duration
+			store := NewRetryStore(flaky, policy)
+			store.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+			_, err := store.Put(ChunkRef{Hash: "abc"}, []byte("data"))
+			if flaky.calls != tt.wantCalls {
+				t.Errorf("Put() made %d calls, want %d", flaky.calls, tt.wantCalls)
+			}
+			if len(slept) != tt.wantCalls-1 {
+				t.Errorf("Put() slept %d times, want %d", len(slept), tt.wantCalls-1)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Put() error: %v", err)
+				}
+				if data, err := store.Get(ChunkRef{Hash: "abc"}); err != nil || string(data) != "data" {
+					t.Errorf("Get() = %q, %v", data, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !errors.Is(err, tt.err) {
+				t.Errorf("Put() error = %v, want %q wrapping the cause", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, ceiling := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		ceiling *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := policy.Delay(attempt + 1); d < ceiling/2 || d > ceiling {
+				t.Fatalf("Delay(%d) = %v, want between %v and %v", attempt+1, d, ceiling/2, ceiling)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   config.StoreRetryConfig
+		want    RetryPolicy
+		wantErr bool
+	}{
+		{name: "defaults", want: DefaultRetryPolicy},
+		{name: "disabled", retry: config.StoreRetryConfig{MaxRetries: -1},
+			want: RetryPolicy{BaseDelay: DefaultRetryPolicy.BaseDelay, MaxDelay: DefaultRetryPolicy.MaxDelay}},
+		{name: "custom", retry: config.StoreRetryConfig{MaxRetries: 8, BaseDelay: "1s", MaxDelay: "1m"},
+			want: RetryPolicy{MaxRetries: 8, BaseDelay: time.Second, MaxDelay: time.Minute}},
+		{name: "bad delay", retry: config.StoreRetryConfig{BaseDelay: "soon"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RetryPolicyFromConfig(tt.retry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RetryPolicyFromConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("RetryPolicyFromConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package chunker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/layout"
+)
+
+// ErrChunkNotFound is returned by stores for chunks they do not hold
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// MemoryStore is an in-memory ChunkStore for tests and short-lived pipelines.
+// Chunks already present are not stored again and come back Deduplicated.
+type MemoryStore struct {
+	mu     sync.Mutex
+	chunks map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{chunks: make(map[string][]byte)}
+}
+
+// Put implements ChunkStore
+func (s *MemoryStore) Put(ref ChunkRef, data []byte) (ChunkRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := StorageKey(ref)
+	if _, exists := s.chunks[key]; exists {
+		ref.Deduplicated = true
+		return ref, nil
+	}
+	s.chunks[key] = append([]byte(nil), data...)
+	return ref, nil
+}
+
+// Get implements ChunkStore
+func (s *MemoryStore) Get(ref ChunkRef) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.chunks[StorageKey(ref)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChunkNotFound, StorageKey(ref))
+	}
+	return data, nil
+}
+
+// Len returns the number of distinct chunks stored
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.chunks)
+}
+
+// VaultStore reads and writes chunks in a vault's chunk directory. Writes go
+// straight to disk without updating the deduplication index or the transaction
+// log, so use `sietch add` to put files into a vault the CLI manages.
+type VaultStore struct {
+	vaultRoot string
+}
+
+// NewVaultStore returns a ChunkStore over the vault at vaultRoot
+func NewVaultStore(vaultRoot string) *VaultStore {
+	return &VaultStore{vaultRoot: vaultRoot}
+}
+
+// Put implements ChunkStore
+func (s *VaultStore) Put(ref ChunkRef, data []byte) (ChunkRef, error) {
+	key := StorageKey(ref)
+	if fs.ChunkExists(s.vaultRoot, key) {
+		ref.Deduplicated = true
+		return ref, nil
+	}
+	return ref, fs.StoreChunk(s.vaultRoot, key, data)
+}
+
+// Get implements ChunkStore
+func (s *VaultStore) Get(ref ChunkRef) ([]byte, error) {
+	key := StorageKey(ref)
+	loc, exists := layout.LocateChunk(s.vaultRoot, key)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrChunkNotFound, key)
+	}
+	data, err := loc.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,115 @@
+package chunker
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/encryption/convergent"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// VaultOptions loads the vault at vaultRoot and returns options matching its
+// chunking, compression and encryption settings. passphrase may be empty for
+// vaults whose key is not passphrase protected.
+func VaultOptions(vaultRoot string, passphrase string) (Options, error) {
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return Options{}, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	return OptionsFromConfig(vaultRoot, *vaultConfig, passphrase)
+}
+
+// OptionsFromConfig is VaultOptions for an already loaded vault configuration
+func OptionsFromConfig(vaultRoot string, vaultConfig config.VaultConfig, passphrase string) (Options, error) {
+	chunkSize, err := util.ParseChunkSize(vaultConfig.Chunking.ChunkSize)
+	if err != nil || chunkSize <= 0 {
+		chunkSize = int64(constants.DefaultChunkSize)
+	}
+	opts := Options{
+		Strategy:      vaultConfig.Chunking.Strategy,
+		ChunkSize:     chunkSize,
+		HashAlgorithm: vaultConfig.Chunking.HashAlgorithm,
+		Compression:   vaultConfig.Compression,
+		Level:         vaultConfig.CompressionLevel,
+		MinSavings:    vaultConfig.CompressionMinSavings,
+	}
+
+	if vaultConfig.Encryption.Type == "" || vaultConfig.Encryption.Type == constants.EncryptionTypeNone {
+		opts.Dictionaries = &vaultDictionaries{vaultRoot: vaultRoot}
+		return opts, nil
+	}
+	if vaultConfig.Encryption.Type == constants.EncryptionTypeAES && vaultConfig.Encryption.PassphraseProtected && passphrase == "" {
+		return Options{}, fmt.Errorf("passphrase required for encrypted vault but not provided")
+	}
+	vc := &vaultCipher{vaultRoot: vaultRoot, vaultConfig: vaultConfig, passphrase: passphrase}
+	if vc.convergent, err = convergent.Unlock(vaultRoot, &vaultConfig, passphrase); err != nil {
+		return Options{}, err
+	}
+	opts.Cipher = vc
+	opts.Dictionaries = &vaultDictionaries{vaultRoot: vaultRoot, opts: Options{Cipher: vc}}
+	return opts, nil
+}
+
+// vaultCipher encrypts chunks with the vault's key. Chunk data is base64 encoded
+// before encryption, which is the on-disk format the vault has always used.
+type vaultCipher struct {
+	vaultRoot   string
+	vaultConfig config.VaultConfig
+	passphrase  string
+	convergent  *convergent.Cipher // nil when the vault has no convergence secret
+}
+
+func (c *vaultCipher) Convergent() bool {
+	settings := c.vaultConfig.Encryption.Convergent
+	return c.convergent != nil && settings != nil && settings.Enabled
+}
+
+func (c *vaultCipher) EncryptChunk(hash string, plaintext []byte) ([]byte, error) {
+	if c.convergent == nil {
+		return nil, fmt.Errorf("vault has no convergence secret")
+	}
+	return c.convergent.EncryptChunk(hash, plaintext)
+}
+
+func (c *vaultCipher) DecryptChunk(hash string, ciphertext []byte) ([]byte, error) {
+	if c.convergent == nil {
+		return nil, fmt.Errorf("vault has no convergence secret")
+	}
+	return c.convergent.DecryptChunk(hash, ciphertext)
+}
+
+func (c *vaultCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	encoded := base64.StdEncoding.EncodeToString(plaintext)
+	var encrypted string
+	var err error
+	if c.vaultConfig.Encryption.PassphraseProtected {
+		encrypted, err = encryption.EncryptDataWithPassphrase(encoded, c.vaultConfig, c.passphrase)
+	} else {
+		encrypted, err = encryption.EncryptData(encoded, c.vaultConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encrypted), nil
+}
+
+func (c *vaultCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	var decrypted string
+	var err error
+	if c.vaultConfig.Encryption.PassphraseProtected {
+		decrypted, err = encryption.DecryptDataWithPassphrase(string(ciphertext), c.vaultRoot, c.passphrase)
+	} else {
+		decrypted, err = encryption.DecryptData(string(ciphertext), c.vaultRoot)
+	}
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode decrypted chunk: %v", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,50 @@
+package chunker
+
+import (
+	"context"
+	"io"
+)
+
+// Writer is a streaming front end to Split: bytes written to it are chunked,
+// encoded and stored as they arrive. Close must be called to store the final
+// chunk; the references are available from Refs afterwards.
+//
+// Chunk boundaries depend only on the data, never on how it was divided
+// between Write calls.
+type Writer struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	refs []ChunkRef
+	err  error
+}
+
+// NewWriter returns a Writer that stores chunks in store
+func NewWriter(store ChunkStore, opts Options) *Writer {
+	pr, pw := io.Pipe()
+	w := &Writer{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		w.refs, w.err = Split(context.Background(), pr, store, opts)
+		// Unblock any pending Write; after a failure it returns the same error
+		pr.CloseWithError(w.err)
+	}()
+	return w
+}
+
+// Write implements io.Writer
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close flushes the final chunk and waits for it to be stored
+func (w *Writer) Close() error {
+	_ = w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+// Refs returns the chunk references in order. It is only valid after Close
+// has returned without error.
+func (w *Writer) Refs() []ChunkRef {
+	return w.refs
+}
@@ -190,7 +190,7 @@ func AssertFileSize(t *testing.T, path string, expectedSize int64) {
 }
 
 // CaptureOutput captures stdout/stderr for testing CLI commands
-func CaptureOutput(t *testing.T, fn func()) (stdout, stderr string) {
+func CaptureOutput(t testing.TB, fn func()) (stdout, stderr string) {
 	t.Helper()
 
 	// Create pipes for stdout and stderr
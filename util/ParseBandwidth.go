@@ -0,0 +1,23 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseBandwidth parses a transfer rate such as 500KB/s or 2MB (the /s is
+// optional) into bytes per second. 0 means unlimited.
+func ParseBandwidth(value string) (int64, error) {
+	trimmed := strings.TrimSpace(value)
+	if lower := strings.ToLower(trimmed); strings.HasSuffix(lower, "/s") {
+		trimmed = trimmed[:len(trimmed)-2]
+	}
+	rate, err := ParseChunkSize(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q (expected e.g. 500KB/s or 2MB/s)", value)
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("invalid rate %q: must not be negative", value)
+	}
+	return rate, nil
+}
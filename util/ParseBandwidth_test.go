@@ -0,0 +1,31 @@
+package util
+
+import "testing"
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "500KB/s", want: 500 * 1024},
+		{input: "2MB", want: 2 * 1024 * 1024},
+		{input: " 1mb/S ", want: 1024 * 1024},
+		{input: "0", want: 0},
+		{input: "-1KB/s", wantErr: true},
+		{input: "fast", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseBandwidth(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBandwidth(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBandwidth(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
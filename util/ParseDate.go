@@ -0,0 +1,23 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseDate parses a date given on the command line. It accepts a plain date
+// (2006-01-02, local midnight), a date and time (2006-01-02 15:04 or
+// 2006-01-02T15:04:05, local time) or a full RFC 3339 timestamp.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339)", value)
+}
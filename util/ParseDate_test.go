@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{input: "2025-03-01", want: time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)},
+		{input: " 2025-03-01 14:30 ", want: time.Date(2025, 3, 1, 14, 30, 0, 0, time.Local)},
+		{input: "2025-03-01T14:30:15", want: time.Date(2025, 3, 1, 14, 30, 15, 0, time.Local)},
+		{input: "2025-03-01T14:30:00Z", want: time.Date(2025, 3, 1, 14, 30, 0, 0, time.UTC)},
+		{input: "", wantErr: true},
+		{input: "yesterday", wantErr: true},
+		{input: "2025-13-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ParseDate(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSince parses a cutoff time given on the command line, either as a
+// duration back from now (90m, 36h, 7d, 2w) or as a date ParseDate accepts
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if d, err := parseAge(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := ParseDate(value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected a duration such as 36h or 7d, or a date: YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339)", value)
+}
+
+// parseAge parses a non-negative duration, adding days (d) and weeks (w) to
+// the units time.ParseDuration knows
+func parseAge(value string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	switch unit := value[max(len(value)-1, 0):]; unit {
+	case "d", "w":
+		var n int
+		if n, err = strconv.Atoi(value[:len(value)-1]); err == nil {
+			d = time.Duration(n) * 24 * time.Hour
+			if unit == "w" {
+				d *= 7
+			}
+		}
+	default:
+		d, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{input: "36h", want: now.Add(-36 * time.Hour)},
+		{input: "90m", want: now.Add(-90 * time.Minute)},
+		{input: " 7d ", want: now.AddDate(0, 0, -7)},
+		{input: "2w", want: now.AddDate(0, 0, -14)},
+		{input: "2025-03-01", want: time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)},
+		{input: "2025-03-01T14:30:00Z", want: time.Date(2025, 3, 1, 14, 30, 0, 0, time.UTC)},
+		{input: "", wantErr: true},
+		{input: "-3d", wantErr: true},
+		{input: "-1h", wantErr: true},
+		{input: "d", wantErr: true},
+		{input: "last week", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSince(tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSince(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ParseSince(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
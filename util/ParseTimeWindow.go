@@ -0,0 +1,45 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily window of local time, such as 22:00-06:00. A window
+// whose end is before its start runs past midnight.
+type TimeWindow struct {
+	Start, End time.Duration // Time of day, as an offset from midnight
+}
+
+// ParseTimeWindow parses a window given as HH:MM-HH:MM
+func ParseTimeWindow(value string) (TimeWindow, error) {
+	start, end, ok := strings.Cut(strings.TrimSpace(value), "-")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q (expected HH:MM-HH:MM, e.g. 22:00-06:00)", value)
+	}
+	var window TimeWindow
+	for _, part := range []struct {
+		text string
+		into *time.Duration
+	}{{start, &window.Start}, {end, &window.End}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part.text))
+		if err != nil {
+			return TimeWindow{}, fmt.Errorf("invalid time window %q (expected HH:MM-HH:MM, e.g. 22:00-06:00)", value)
+		}
+		*part.into = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if window.Start == window.End {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: start and end are the same", value)
+	}
+	return window, nil
+}
+
+// Contains reports whether t, in its own location, falls inside the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	of := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return of >= w.Start && of < w.End
+	}
+	return of >= w.Start || of < w.End
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 3, 1, hour, minute, 0, 0, time.Local) }
+	tests := []struct {
+		input   string
+		inside  []time.Time
+		outside []time.Time
+		wantErr bool
+	}{
+		{input: "22:00-06:00", inside: []time.Time{at(22, 0), at(23, 59), at(0, 0), at(5, 59)}, outside: []time.Time{at(6, 0), at(12, 0), at(21, 59)}},
+		{input: " 09:30 - 17:00 ", inside: []time.Time{at(9, 30), at(16, 59)}, outside: []time.Time{at(9, 29), at(17, 0), at(0, 0)}},
+		{input: "22:00", wantErr: true},
+		{input: "25:00-06:00", wantErr: true},
+		{input: "08:00-08:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			window, err := ParseTimeWindow(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeWindow(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			for _, when := range tt.inside {
+				if !window.Contains(when) {
+					t.Errorf("%q does not contain %s", tt.input, when.Format("15:04"))
+				}
+			}
+			for _, when := range tt.outside {
+				if window.Contains(when) {
+					t.Errorf("%q contains %s", tt.input, when.Format("15:04"))
+				}
+			}
+		})
+	}
+}